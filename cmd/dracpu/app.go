@@ -21,6 +21,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -29,18 +30,21 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/admission"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/buildinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/cli"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/gatherinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/repaircdi"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sys/unix"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	nodeutil "k8s.io/component-helpers/node/util"
-	"k8s.io/utils/cpuset"
 )
 
 const (
@@ -50,6 +54,8 @@ const (
 var (
 	driverFlags = driverconfig.Default()
 	ready       atomic.Bool
+	// dracpu is set once the driver started, to report its NRI connection in the readiness check.
+	dracpu atomic.Pointer[driver.CPUDriver]
 )
 
 func init() {
@@ -68,14 +74,54 @@ func main() {
 		return
 	}
 
+	commands := []cli.Command{
+		{Name: "run", Summary: "Run the driver on the node (default when the first argument is a flag)", Run: runCommand},
+		{Name: "check", Summary: "Check the privileges and the kernel features the driver needs on the node", Run: cli.Check},
+		{Name: "topology", Summary: "Print the CPU topology of the node, as the driver discovers it", Run: cli.Topology},
+		{Name: "state", Summary: "Print the claims prepared by the driver running on the node, from its claims API", Run: cli.State},
+		{Name: "validate", Summary: "Validate the driver flags against the CPU topology of the node, without starting the driver", Run: cli.Validate},
+		{Name: "bench", Summary: "Time the packing of the claim CPUs on the CPU topology of the node", Run: cli.Bench},
+		{Name: "repair-cdi", Summary: "Rebuild the CDI specs of the claims prepared on the node", Run: repairCDICommand},
+		{Name: "webhook", Summary: "Serve the validating admission webhook rejecting the invalid CPU claim parameters at the creation of the claims", Run: webhookCommand},
+	}
+	env := &cli.Env{
+		DriverName:   driverName,
+		DriverConfig: driverFlags,
+		Out:          os.Stdout,
+	}
+	if err := cli.Main(os.Args[1:], commands, "run", env); err != nil {
+		fmt.Fprintf(os.Stderr, "dracpu: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runCommand runs the driver, with the driver flags registered on the command line flags.
+func runCommand(args []string, env *cli.Env) error {
 	ctxlog.AddFlags(flag.CommandLine)
-	flag.Parse()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
 
 	logger := ctxlog.Setup()
 
 	if err := runDriver(logger); err != nil {
+		// the error is logged already.
 		os.Exit(1)
 	}
+	return nil
+}
+
+func repairCDICommand(args []string, env *cli.Env) error {
+	return repaircdi.Run(args, repaircdi.Options{
+		DriverName:   env.DriverName,
+		DriverConfig: env.DriverConfig,
+		Out:          env.Out,
+		Output:       env.Output,
+	}, ctxlog.Setup())
+}
+
+func webhookCommand(args []string, env *cli.Env) error {
+	return admission.Run(args, admission.Options{DriverName: env.DriverName}, ctxlog.Setup())
 }
 
 func runDriver(logger logr.Logger) error {
@@ -92,9 +138,13 @@ func run(logger logr.Logger) error {
 		logger.Info("FLAG", "name", f.Name, "value", f.Value.String())
 	})
 
-	reservedCPUSet, err := cpuset.Parse(driverFlags.ReservedCPUs)
+	nodeName, err := nodeutil.GetHostname(driverFlags.HostnameOverride)
+	if err != nil {
+		return fmt.Errorf("can not obtain the node name, use the hostname-override flag if you want to set it to a specific value: %w", err)
+	}
+	driverConfig, err := driverFlags.DriverConfig(driverName, nodeName)
 	if err != nil {
-		return fmt.Errorf("failed to parse reserved CPUs: %w", err)
+		return err
 	}
 
 	mux := http.NewServeMux()
@@ -106,6 +156,20 @@ func run(logger logr.Logger) error {
 			w.WriteHeader(http.StatusOK)
 		}
 	})
+	// Add readyz handler: unlike healthz, it also fails while a driver component is not healthy,
+	// e.g. the NRI plugin is not connected
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		d := dracpu.Load()
+		if !ready.Load() || d == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := d.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
 	// Add metrics handler
 	mux.Handle("/metrics", promhttp.Handler())
 	server := &http.Server{
@@ -145,9 +209,13 @@ func run(logger logr.Logger) error {
 		return fmt.Errorf("can not create client-go client: %w", err)
 	}
 
-	nodeName, err := nodeutil.GetHostname(driverFlags.HostnameOverride)
-	if err != nil {
-		return fmt.Errorf("can not obtain the node name, use the hostname-override flag if you want to set it to a specific value: %w", err)
+	var dynamicClient dynamic.Interface
+	if driverFlags.NodeStatusNamespace != "" || driverFlags.FeatureGates[string(driver.FEATURE_GATE_CPU_PROFILES)] {
+		// the node status and the CPU profiles are custom resources, which are served only as JSON
+		dynamicClient, err = dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("can not create client-go dynamic client: %w", err)
+		}
 	}
 
 	// trap Ctrl+C and call cancel on the context
@@ -161,34 +229,53 @@ func run(logger logr.Logger) error {
 		cancel()
 	}()
 	signal.Notify(signalCh, os.Interrupt, unix.SIGINT)
+	// SIGHUP asks to check again the reserved CPUs and to publish the ResourceSlices again,
+	// e.g. after they were edited or deleted by mistake.
+	publishCh := make(chan os.Signal, 1)
+	defer signal.Stop(publishCh)
+	signal.Notify(publishCh, unix.SIGHUP)
 
-	driverConfig := &driver.Config{
-		DriverName:       driverName,
-		NodeName:         nodeName,
-		ReservedCPUs:     reservedCPUSet,
-		CPUDeviceMode:    driverFlags.CPUDeviceMode,
-		CPUDeviceGroupBy: driverFlags.GroupBy,
-		ExposePCIeRoots:  driverFlags.ExposePCIeRoots,
-	}
-	dracpu, asyncErr, err := driver.Start(ctx, clientset, driverConfig)
+	driverConfig.NodeStatusClient = dynamicClient
+	driverConfig.CPUProfileClient = dynamicClient
+	cpuDriver, asyncErr, err := driver.Start(ctx, clientset, driverConfig)
 	if err != nil {
 		return fmt.Errorf("driver failed to start: %w", err)
 	}
-	defer dracpu.Stop()
+	defer cpuDriver.Stop(ctxlog.NewContext(context.Background(), logger))
+	dracpu.Store(cpuDriver)
+	if driverFlags.ClaimsAPIAddress != "" {
+		claimsServer, err := startClaimsAPIServer(logger, driverFlags.ClaimsAPIAddress, cpuDriver.ClaimsAPIHandler())
+		if err != nil {
+			return err
+		}
+		defer claimsServer.Close()
+	}
 	ready.Store(true)
 	logger.Info("driver started")
 
 	var fatalErr error
 
-	select {
-	case <-signalCh:
-		logger.Info("exiting", "reason", "received signal")
-		cancel()
-	case <-ctx.Done():
-		logger.Info("exiting", "reason", "context cancelled")
-	case err := <-asyncErr:
-		cancel()
-		fatalErr = fmt.Errorf("NRI driver error: %w", err)
+loop:
+	for {
+		select {
+		case <-publishCh:
+			if err := cpuDriver.RevalidateReservedCPUs(logger); err != nil {
+				logger.Error(err, "reserved CPUs do not match the current CPU topology, restart the driver to apply a new reservation")
+			}
+			logger.Info("publishing the ResourceSlices", "reason", "received SIGHUP")
+			cpuDriver.RequestPublish(driver.PUBLISH_TRIGGER_MANUAL)
+		case <-signalCh:
+			logger.Info("exiting", "reason", "received signal")
+			cancel()
+			break loop
+		case <-ctx.Done():
+			logger.Info("exiting", "reason", "context cancelled")
+			break loop
+		case err := <-asyncErr:
+			cancel()
+			fatalErr = fmt.Errorf("NRI driver error: %w", err)
+			break loop
+		}
 	}
 
 	// Gracefully shutdown HTTP server
@@ -207,3 +294,29 @@ func printVersion(logger logr.Logger) {
 	}
 	logger.Info("dracpu", "goVersion", info.GoVersion, "build", info.VCSRevision, "time", info.VCSTime)
 }
+
+// startClaimsAPIServer serves the claims API. The API exposes node-local details,
+// so it is only allowed to listen on loopback addresses.
+func startClaimsAPIServer(logger logr.Logger, address string, handler http.Handler) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims API address %q: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("invalid claims API address %q: must be a loopback address", address)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		IdleTimeout:       120 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(err, "claims API server failed")
+		}
+	}()
+	return server, nil
+}
@@ -49,3 +49,20 @@ Selector labels
 app.kubernetes.io/name: {{ include "dra-driver-cpu.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
+
+{{/*
+Whether a feature gate is enabled by args.featureGates, parsed as the driver does: comma-separated
+<name>=<value> entries, where the value is any spelling of a boolean accepted by the driver (e.g. true,
+True or 1). Renders "true" when enabled, nothing otherwise.
+Usage: include "dra-driver-cpu.featureGateEnabled" (dict "featureGates" .Values.args.featureGates "gate" "CPUProfiles")
+*/}}
+{{- define "dra-driver-cpu.featureGateEnabled" -}}
+{{- $enabled := false }}
+{{- range splitList "," (.featureGates | default "") }}
+{{- $entry := splitList "=" (trim .) }}
+{{- if and (eq (len $entry) 2) (eq (trim (first $entry)) $.gate) }}
+{{- $enabled = has (trim (last $entry)) (list "1" "t" "T" "TRUE" "true" "True") }}
+{{- end }}
+{{- end }}
+{{- if $enabled }}true{{ end }}
+{{- end }}
@@ -0,0 +1,217 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package admission serves the validating admission webhook of the driver, which rejects the claims with invalid
+// or denied opaque parameters when they are created, instead of failing their preparation on the node.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+	admissionv1 "k8s.io/api/admission/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// ValidatePath is where the admission reviews are served.
+	ValidatePath = "/validate"
+	// maxReviewBytes bounds the size of the admission reviews, well above the size limit of the objects.
+	maxReviewBytes = 4 << 20
+)
+
+// Options configures the webhook.
+type Options struct {
+	DriverName string
+}
+
+// Validator reviews the ResourceClaims, the ResourceClaimTemplates and the CPUProfiles.
+type Validator struct {
+	// DriverName selects the opaque parameters of the driver in the claims.
+	DriverName string
+	// DeniedParameters are the settings the claims may not set, by their dotted path in the CPUClaimParameters,
+	// e.g. placement.coreType, whichever the spelling of the opaque parameters setting them.
+	DeniedParameters sets.Set[string]
+	// AllowedGovernors are the cpufreq governors the CPUProfiles may set, any if empty.
+	AllowedGovernors sets.Set[string]
+}
+
+// Run serves the webhook until the process is terminated.
+func Run(args []string, opts Options, logger logr.Logger) error {
+	fs := flag.NewFlagSet("dracpu webhook", flag.ExitOnError)
+	address := fs.String("address", ":8443", "The address the webhook listens on, with TLS.")
+	certFile := fs.String("tls-cert-file", "", "The file of the serving certificate of the webhook, in PEM. Required.")
+	keyFile := fs.String("tls-private-key-file", "", "The file of the private key of the serving certificate, in PEM. Required.")
+	deniedParameters := fs.String("denied-parameters", "", "Comma-separated list of the settings the claims may not set, by their dotted path in the CPUClaimParameters, e.g. tuning.profile,placement.coreType.")
+	allowedGovernors := fs.String("allowed-governors", "", "Comma-separated list of the cpufreq governors the CPUProfiles may set. Empty allows any.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *certFile == "" || *keyFile == "" {
+		return fmt.Errorf("the webhook requires --tls-cert-file and --tls-private-key-file")
+	}
+
+	denied := sets.New(driverconfig.SplitList(*deniedParameters)...)
+	if unknown := denied.Difference(sets.New(driver.ClaimParameterPaths()...)); unknown.Len() > 0 {
+		return fmt.Errorf("unknown denied parameters %s, must be among %s", strings.Join(sets.List(unknown), ", "), strings.Join(driver.ClaimParameterPaths(), ", "))
+	}
+	validator := &Validator{
+		DriverName:       opts.DriverName,
+		DeniedParameters: denied,
+		AllowedGovernors: sets.New(driverconfig.SplitList(*allowedGovernors)...),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, validator.Handler(logger))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{
+		Addr:              *address,
+		Handler:           mux,
+		IdleTimeout:       120 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServeTLS(*certFile, *keyFile)
+	}()
+	logger.Info("serving the admission webhook", "address", *address, "deniedParameters", sets.List(validator.DeniedParameters), "allowedGovernors", sets.List(validator.AllowedGovernors))
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("admission webhook failed: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// Handler serves the admission reviews of the validator.
+func (v *Validator) Handler(logger logr.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReviewBytes)).Decode(&review); err != nil {
+			http.Error(w, fmt.Sprintf("invalid admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "invalid admission review: no request", http.StatusBadRequest)
+			return
+		}
+		response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+		if err := v.Review(review.Request); err != nil {
+			logger.V(2).Info("denied", "kind", review.Request.Kind.Kind, "namespace", review.Request.Namespace, "name", review.Request.Name, "reason", err.Error())
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusUnprocessableEntity,
+				Reason:  metav1.StatusReasonInvalid,
+				Message: err.Error(),
+			}
+		}
+		review.Request = nil
+		review.Response = response
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			logger.Error(err, "failed to write the admission review")
+		}
+	})
+}
+
+// Review returns an error if the object of the request is invalid. The objects of other kinds are allowed.
+func (v *Validator) Review(request *admissionv1.AdmissionRequest) error {
+	switch {
+	case request.Kind.Group == resourceapi.GroupName && request.Kind.Kind == "ResourceClaim":
+		var claim resourceapi.ResourceClaim
+		if err := json.Unmarshal(request.Object.Raw, &claim); err != nil {
+			return fmt.Errorf("invalid ResourceClaim: %w", err)
+		}
+		return v.validateClaimSpec(claim.Spec)
+	case request.Kind.Group == resourceapi.GroupName && request.Kind.Kind == "ResourceClaimTemplate":
+		var template resourceapi.ResourceClaimTemplate
+		if err := json.Unmarshal(request.Object.Raw, &template); err != nil {
+			return fmt.Errorf("invalid ResourceClaimTemplate: %w", err)
+		}
+		return v.validateClaimSpec(template.Spec.Spec)
+	case request.Kind.Group == driver.CPUProfileResource.Group && request.Kind.Kind == "CPUProfile":
+		var profile struct {
+			Spec driver.CPUProfileSpec `json:"spec"`
+		}
+		if err := json.Unmarshal(request.Object.Raw, &profile); err != nil {
+			return fmt.Errorf("invalid CPUProfile: %w", err)
+		}
+		return v.validateCPUProfileSpec(profile.Spec)
+	}
+	return nil
+}
+
+// validateClaimSpec returns an error if the opaque parameters of the driver of a claim are invalid or denied.
+func (v *Validator) validateClaimSpec(spec resourceapi.ResourceClaimSpec) error {
+	var errs []error
+	for _, cfg := range spec.Devices.Config {
+		if cfg.Opaque == nil || cfg.Opaque.Driver != v.DriverName {
+			continue
+		}
+		// the configurations without requests apply to all of them.
+		requests := "*"
+		if len(cfg.Requests) > 0 {
+			requests = strings.Join(cfg.Requests, ",")
+		}
+		config, err := driver.ValidateDeviceConfig(requests, cfg.Opaque.Parameters.Raw)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// the decoded settings are matched, so the unversioned and the versioned spellings are denied alike.
+		for _, path := range driver.SetClaimParameters(config) {
+			if v.DeniedParameters.Has(path) {
+				errs = append(errs, fmt.Errorf("parameter %q of request %q is denied on this cluster", path, requests))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateCPUProfileSpec returns an error if the spec of a CPUProfile is invalid or sets a denied governor.
+func (v *Validator) validateCPUProfileSpec(spec driver.CPUProfileSpec) error {
+	err := spec.Validate()
+	if spec.Governor != "" && v.AllowedGovernors.Len() > 0 && !v.AllowedGovernors.Has(spec.Governor) {
+		err = errors.Join(err, fmt.Errorf("governor %q is denied on this cluster, must be one of %s", spec.Governor, strings.Join(sets.List(v.AllowedGovernors), ", ")))
+	}
+	return err
+}
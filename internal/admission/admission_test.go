@@ -0,0 +1,201 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const testDriverName = "dra.cpu"
+
+// claimRequest returns the admission request of a claim with the given opaque parameters of the driver.
+func claimRequest(t *testing.T, driverName, parameters string) *admissionv1.AdmissionRequest {
+	t.Helper()
+	claim := resourceapi.ResourceClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "resource.k8s.io/v1", Kind: "ResourceClaim"},
+		ObjectMeta: metav1.ObjectMeta{Name: "claim", Namespace: "default"},
+		Spec: resourceapi.ResourceClaimSpec{
+			Devices: resourceapi.DeviceClaim{
+				Config: []resourceapi.DeviceClaimConfiguration{{
+					DeviceConfiguration: resourceapi.DeviceConfiguration{
+						Opaque: &resourceapi.OpaqueDeviceConfiguration{
+							Driver:     driverName,
+							Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+						},
+					},
+				}},
+			},
+		},
+	}
+	raw, err := json.Marshal(claim)
+	require.NoError(t, err)
+	return &admissionv1.AdmissionRequest{
+		UID:    types.UID("review"),
+		Kind:   metav1.GroupVersionKind{Group: resourceapi.GroupName, Version: "v1", Kind: "ResourceClaim"},
+		Object: runtime.RawExtension{Raw: raw},
+	}
+}
+
+// cpuProfileRequest returns the admission request of a CPUProfile with the given spec.
+func cpuProfileRequest(spec string) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:    types.UID("review"),
+		Kind:   metav1.GroupVersionKind{Group: "cpu.dra.x-k8s.io", Version: "v1alpha1", Kind: "CPUProfile"},
+		Object: runtime.RawExtension{Raw: []byte(`{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUProfile", "metadata": {"name": "realtime"}, "spec": ` + spec + `}`)},
+	}
+}
+
+func TestReview(t *testing.T) {
+	validator := &Validator{
+		DriverName:       testDriverName,
+		DeniedParameters: sets.New("tuning.borrowIdleCPUs", "placement.requiredNUMANode"),
+		AllowedGovernors: sets.New("performance", "schedutil"),
+	}
+
+	testCases := []struct {
+		name        string
+		request     *admissionv1.AdmissionRequest
+		expectedErr string
+	}{
+		{
+			name:    "valid unversioned parameters",
+			request: claimRequest(t, testDriverName, `{"fullPCPUsOnly": true, "allocationStrategy": "spread"}`),
+		},
+		{
+			name:    "valid versioned parameters",
+			request: claimRequest(t, testDriverName, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"coreType": "performance"}}`),
+		},
+		{
+			name:        "invalid allocation strategy",
+			request:     claimRequest(t, testDriverName, `{"allocationStrategy": "random"}`),
+			expectedErr: `invalid allocation strategy "random"`,
+		},
+		{
+			name:        "unknown versioned field",
+			request:     claimRequest(t, testDriverName, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCore": true}`),
+			expectedErr: `unknown field "fullCore"`,
+		},
+		{
+			name:        "invalid profile",
+			request:     claimRequest(t, testDriverName, `{"profile": "realtime"}`),
+			expectedErr: `invalid profile "realtime"`,
+		},
+		{
+			name:        "denied parameter",
+			request:     claimRequest(t, testDriverName, `{"borrowIdleCPUs": true}`),
+			expectedErr: `parameter "tuning.borrowIdleCPUs" of request "*" is denied`,
+		},
+		{
+			name:        "denied versioned parameter",
+			request:     claimRequest(t, testDriverName, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "tuning": {"borrowIdleCPUs": true}}`),
+			expectedErr: `parameter "tuning.borrowIdleCPUs" of request "*" is denied`,
+		},
+		{
+			name:        "denied nested parameter",
+			request:     claimRequest(t, testDriverName, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"requiredNUMANode": 1}}`),
+			expectedErr: `parameter "placement.requiredNUMANode" of request "*" is denied`,
+		},
+		{
+			name:        "denied nested unversioned parameter",
+			request:     claimRequest(t, testDriverName, `{"requiredNUMANode": 1}`),
+			expectedErr: `parameter "placement.requiredNUMANode" of request "*" is denied`,
+		},
+		{
+			name:    "parameters of another driver",
+			request: claimRequest(t, "gpu.example.com", `{"profile": "realtime"}`),
+		},
+		{
+			name:    "valid CPUProfile",
+			request: cpuProfileRequest(`{"governor": "performance", "maxCState": 0, "irqPolicy": "exclude"}`),
+		},
+		{
+			name:        "denied governor",
+			request:     cpuProfileRequest(`{"governor": "powersave"}`),
+			expectedErr: `governor "powersave" is denied on this cluster, must be one of performance, schedutil`,
+		},
+		{
+			name:        "invalid CPUProfile",
+			request:     cpuProfileRequest(`{"smtPolicy": "half-cores"}`),
+			expectedErr: `invalid smtPolicy "half-cores"`,
+		},
+		{
+			name: "other kind",
+			request: &admissionv1.AdmissionRequest{
+				Kind:   metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Object: runtime.RawExtension{Raw: []byte(`{}`)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validator.Review(tc.request)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	validator := &Validator{DriverName: testDriverName}
+	handler := validator.Handler(testr.New(t))
+
+	review := func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		body, err := json.Marshal(admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request:  request,
+		})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var got admissionv1.AdmissionReview
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+		require.Equal(t, "AdmissionReview", got.Kind)
+		require.NotNil(t, got.Response)
+		require.Equal(t, request.UID, got.Response.UID)
+		return got.Response
+	}
+
+	response := review(claimRequest(t, testDriverName, `{"coreType": "performance"}`))
+	require.True(t, response.Allowed)
+
+	response = review(claimRequest(t, testDriverName, `{"coreType": "p-core"}`))
+	require.False(t, response.Allowed)
+	require.Equal(t, metav1.StatusReasonInvalid, response.Result.Reason)
+	require.Contains(t, response.Result.Message, `invalid coreType "p-core"`)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader([]byte(`{}`))))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -22,6 +22,7 @@ type Info struct {
 	GoVersion   string
 	VCSRevision string
 	VCSTime     string
+	Version     string
 }
 
 func Read() Info {
@@ -33,6 +34,9 @@ func Read() Info {
 	version := Info{
 		GoVersion: info.GoVersion,
 	}
+	if info.Main.Version != "(devel)" {
+		version.Version = info.Main.Version
+	}
 
 	for _, s := range info.Settings {
 		switch s.Key {
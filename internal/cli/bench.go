@@ -0,0 +1,115 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+	"k8s.io/utils/cpuset"
+)
+
+// BenchResult is the time the topology-aware packing takes to pick the CPUs of a claim on the node.
+type BenchResult struct {
+	NumCPUs    int   `json:"numCPUs"`
+	Iterations int   `json:"iterations"`
+	NsPerOp    int64 `json:"nsPerOp"`
+	// CPUs are the CPUs picked, the same at each iteration.
+	CPUs string `json:"cpus,omitempty"`
+	// Error is why the CPUs could not be picked, e.g. a claim larger than the free CPUs.
+	Error string `json:"error,omitempty"`
+}
+
+// Bench times the packing of claims of several sizes on the CPU topology of the node, with all the CPUs but the
+// reserved ones free, to compare the nodes and to catch the regressions of the allocation on the large parts.
+func Bench(args []string, env *Env) error {
+	return bench(args, env, ctxlog.Setup(), cpuinfo.NewSystemCPUInfo())
+}
+
+func bench(args []string, env *Env, logger logr.Logger, cpuInfoProvider driver.CPUInfoProvider) error {
+	fs := flag.NewFlagSet("dracpu bench", flag.ExitOnError)
+	reservedCPUs := fs.String("reserved-cpus", env.DriverConfig.ReservedCPUs, "The CPUs reserved for the OS and the kubelet, never picked, as the --reserved-cpus flag of the driver.")
+	sizes := fs.String("sizes", "1,2,4,8", "Comma-separated list of the numbers of CPUs of the claims to time.")
+	iterations := fs.Int("iterations", 1000, "How many times the CPUs of each claim are picked.")
+	AddOutputFlag(fs, &env.Output)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *iterations <= 0 {
+		return fmt.Errorf("the iterations must be positive, got %d", *iterations)
+	}
+	reserved, err := cpuset.Parse(*reservedCPUs)
+	if err != nil {
+		return fmt.Errorf("failed to parse reserved CPUs: %w", err)
+	}
+	var numCPUs []int
+	for _, size := range driverconfig.SplitList(*sizes) {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid claim size %q, must be a positive number of CPUs", size)
+		}
+		numCPUs = append(numCPUs, n)
+	}
+
+	topo, err := cpuInfoProvider.GetCPUTopology(logger)
+	if err != nil {
+		return fmt.Errorf("failed to get CPU topology: %w", err)
+	}
+	available := topo.CPUDetails.CPUs().Difference(reserved)
+	results := make([]BenchResult, 0, len(numCPUs))
+	for _, n := range numCPUs {
+		results = append(results, benchPacking(topo, available, n, *iterations))
+	}
+	return env.Print(results, func(w io.Writer) error {
+		tw := newTable(w, "CPUS", "ITERATIONS", "NS/OP", "PICKED")
+		for _, result := range results {
+			if result.Error != "" {
+				fmt.Fprintf(tw, "%d\t%d\t-\t%s\n", result.NumCPUs, result.Iterations, result.Error)
+				continue
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", result.NumCPUs, result.Iterations, result.NsPerOp, result.CPUs)
+		}
+		return tw.Flush()
+	})
+}
+
+// benchPacking picks the CPUs of a claim as the driver does, discarding the logs, which would dominate the time.
+func benchPacking(topo *cpuinfo.CPUTopology, available cpuset.CPUSet, numCPUs, iterations int) BenchResult {
+	result := BenchResult{NumCPUs: numCPUs, Iterations: iterations}
+	var cpus cpuset.CPUSet
+	start := time.Now()
+	for range iterations {
+		var err error
+		cpus, err = cpumanager.TakeByTopologyNUMAPacked(logr.Discard(), topo, available, numCPUs, cpumanager.CPUSortingStrategyPacked, true)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	result.NsPerOp = time.Since(start).Nanoseconds() / int64(iterations)
+	result.CPUs = cpus.String()
+	return result
+}
@@ -0,0 +1,69 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+)
+
+// Check runs the preflight checks of the node with the driver flags, the privileges of the enabled subsystems and
+// the kernel features, and prints all of them. It fails if a required check fails, as the driver would.
+func Check(args []string, env *Env) error {
+	cfg := env.DriverConfig
+	fs := flag.NewFlagSet("dracpu check", flag.ExitOnError)
+	cfg.AddFlags(fs)
+	AddOutputFlag(fs, &env.Output)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctxlog.Setup()
+
+	config, err := cfg.DriverConfig(env.DriverName, "")
+	if err != nil {
+		return err
+	}
+	checks := driver.Preflight(config)
+	err = env.Print(checks, func(w io.Writer) error {
+		tw := newTable(w, "CHECK", "REQUIRED", "RESULT", "MESSAGE")
+		for _, check := range checks {
+			result := "pass"
+			if !check.Passed {
+				result = "fail"
+			}
+			fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", check.Name, check.Required, result, check.Message)
+		}
+		return tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, check := range checks {
+		if check.Required && !check.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d required checks failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cli implements the subcommands of the driver binary, sharing the driver flags and the output formats.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the format the subcommands print their results in.
+type Format string
+
+const (
+	// OUTPUT_TEXT prints the results for humans, usually as tables.
+	OUTPUT_TEXT Format = "text"
+	// OUTPUT_JSON prints the results as indented JSON.
+	OUTPUT_JSON Format = "json"
+	// OUTPUT_YAML prints the results as YAML.
+	OUTPUT_YAML Format = "yaml"
+)
+
+// Env is what the subcommands share.
+type Env struct {
+	DriverName string
+	// DriverConfig are the defaults of the driver flags, which the subcommands using them accept as the driver does.
+	DriverConfig driverconfig.Config
+	// Output is the format of the results, set by the global --output flag or by the one of the subcommand.
+	Output Format
+	// Out receives the results. The logs go to stderr.
+	Out io.Writer
+}
+
+// Command is a subcommand of the driver binary.
+type Command struct {
+	Name string
+	// Summary is the one-line description listed by the help.
+	Summary string
+	Run     func(args []string, env *Env) error
+}
+
+// Main runs the subcommand named by the first argument after the global flags. The arguments starting with
+// another flag run the default subcommand with all the arguments, so the deployments passing the driver flags
+// without a subcommand keep working.
+func Main(args []string, commands []Command, defaultCommand string, env *Env) error {
+	if env.Output == "" {
+		env.Output = OUTPUT_TEXT
+	}
+	global := flag.NewFlagSet("dracpu", flag.ContinueOnError)
+	global.SetOutput(env.Out)
+	AddOutputFlag(global, &env.Output)
+	global.Usage = func() { usage(env.Out, global, commands) }
+
+	if len(args) > 0 && isOutputFlag(args[0]) {
+		if err := global.Parse(args); err != nil {
+			return err
+		}
+		args = global.Args()
+		if len(args) == 0 {
+			usage(env.Out, global, commands)
+			return fmt.Errorf("missing subcommand")
+		}
+	}
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(env.Out, global, commands)
+		return nil
+	}
+	for _, command := range commands {
+		if command.Name == name {
+			return command.Run(args, env)
+		}
+	}
+	usage(env.Out, global, commands)
+	return fmt.Errorf("unknown subcommand %q", name)
+}
+
+// isOutputFlag tells if the argument is the global --output flag, in any of the forms the flag package accepts.
+func isOutputFlag(arg string) bool {
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return strings.HasPrefix(arg, "-") && name == "output"
+}
+
+func usage(w io.Writer, global *flag.FlagSet, commands []Command) {
+	fmt.Fprintf(w, "Usage: dracpu [--output=text|json|yaml] <subcommand> [flags]\n\nSubcommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", command.Name, command.Summary)
+	}
+	fmt.Fprintf(tw, "  help\tList the subcommands\n")
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\nRun 'dracpu <subcommand> --help' for the flags of a subcommand.\n\nGlobal flags:\n")
+	global.PrintDefaults()
+}
+
+// AddOutputFlag adds the --output flag, which the subcommands accept after their name as well as before it.
+func AddOutputFlag(fs *flag.FlagSet, output *Format) {
+	fs.Var(&formatValue{value: output}, "output", "The format of the results: 'text', 'json' or 'yaml'. The logs go to stderr in any case.")
+}
+
+// Print writes the result in the output format: as JSON or YAML, or as text with the given function.
+func (e *Env) Print(v any, text func(w io.Writer) error) error {
+	switch e.Output {
+	case OUTPUT_JSON:
+		enc := json.NewEncoder(e.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case OUTPUT_YAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = e.Out.Write(data)
+		return err
+	default:
+		return text(e.Out)
+	}
+}
+
+// newTable returns the writer aligning the columns of the text results, to be flushed once written.
+func newTable(w io.Writer, header ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	return tw
+}
+
+type formatValue struct {
+	value *Format
+}
+
+func (v *formatValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return string(*v.value)
+}
+
+func (v *formatValue) Set(s string) error {
+	switch format := Format(s); format {
+	case OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML:
+		*v.value = format
+		return nil
+	}
+	return fmt.Errorf("invalid value: %q, must be %s, %s or %s", s, OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML)
+}
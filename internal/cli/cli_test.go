@@ -0,0 +1,166 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+var testCPUInfos = []cpuinfo.CPUInfo{
+	{CpuID: 0, CoreID: 0, SocketID: 0, NUMANodeID: 0, SiblingCPUID: 2},
+	{CpuID: 1, CoreID: 1, SocketID: 0, NUMANodeID: 0, SiblingCPUID: 3},
+	{CpuID: 2, CoreID: 0, SocketID: 0, NUMANodeID: 0, SiblingCPUID: 0},
+	{CpuID: 3, CoreID: 1, SocketID: 0, NUMANodeID: 0, SiblingCPUID: 1},
+}
+
+func TestMainDispatch(t *testing.T) {
+	var ran []string
+	var runArgs []string
+	commands := []Command{
+		{Name: "run", Run: func(args []string, env *Env) error {
+			ran = append(ran, "run")
+			runArgs = args
+			return nil
+		}},
+		{Name: "check", Run: func(args []string, env *Env) error {
+			ran = append(ran, "check:"+string(env.Output))
+			return nil
+		}},
+	}
+	testCases := []struct {
+		name        string
+		args        []string
+		expectedRan []string
+		expectedErr string
+	}{
+		{name: "no arguments", args: nil, expectedRan: []string{"run"}},
+		{name: "driver flags", args: []string{"--cpu-device-mode=grouped"}, expectedRan: []string{"run"}},
+		{name: "subcommand", args: []string{"check"}, expectedRan: []string{"check:text"}},
+		{name: "global output", args: []string{"--output=json", "check"}, expectedRan: []string{"check:json"}},
+		{name: "global output as two arguments", args: []string{"-output", "yaml", "check"}, expectedRan: []string{"check:yaml"}},
+		{name: "invalid output", args: []string{"--output=xml", "check"}, expectedErr: "invalid value"},
+		{name: "missing subcommand", args: []string{"--output=json"}, expectedErr: "missing subcommand"},
+		{name: "unknown subcommand", args: []string{"frobnicate"}, expectedErr: `unknown subcommand "frobnicate"`},
+		{name: "help", args: []string{"help"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ran = nil
+			var out bytes.Buffer
+			err := Main(tc.args, commands, "run", &Env{Out: &out})
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedRan, ran)
+		})
+	}
+
+	// the default subcommand gets all the arguments.
+	require.NoError(t, Main([]string{"--cpu-device-mode=grouped", "-v=4"}, commands, "run", &Env{Out: io.Discard}))
+	require.Equal(t, []string{"--cpu-device-mode=grouped", "-v=4"}, runArgs)
+}
+
+func TestPrint(t *testing.T) {
+	result := ValidationResult{Valid: false, Error: "boom"}
+	text := func(w io.Writer) error {
+		_, err := io.WriteString(w, "text\n")
+		return err
+	}
+	for _, format := range []Format{OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML} {
+		var out bytes.Buffer
+		env := &Env{Output: format, Out: &out}
+		require.NoError(t, env.Print(result, text))
+		switch format {
+		case OUTPUT_TEXT:
+			require.Equal(t, "text\n", out.String())
+		case OUTPUT_JSON:
+			var decoded ValidationResult
+			require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+			require.Equal(t, result, decoded)
+		case OUTPUT_YAML:
+			require.Equal(t, "error: boom\nvalid: false\n", out.String())
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	provider := &cpuinfo.MockCPUInfoProvider{CPUInfos: testCPUInfos}
+	var out bytes.Buffer
+	env := &Env{DriverName: "dra.cpu", DriverConfig: driverconfig.Default(), Output: OUTPUT_TEXT, Out: &out}
+	require.NoError(t, validate([]string{"--reserved-cpus=0"}, env, testr.New(t), provider))
+	require.Equal(t, "the configuration is valid\n", out.String())
+
+	out.Reset()
+	err := validate([]string{"--reserved-cpus=42", "--output=json"}, env, testr.New(t), provider)
+	require.ErrorIs(t, err, errInvalidConfig)
+	var result ValidationResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	require.False(t, result.Valid)
+	require.Contains(t, result.Error, "not present in the CPU topology")
+}
+
+func TestBench(t *testing.T) {
+	provider := &cpuinfo.MockCPUInfoProvider{CPUInfos: testCPUInfos}
+	var out bytes.Buffer
+	env := &Env{DriverConfig: driverconfig.Default(), Output: OUTPUT_YAML, Out: &out}
+	require.NoError(t, bench([]string{"--sizes=2,8", "--iterations=3", "--reserved-cpus=1"}, env, testr.New(t), provider))
+	var results []BenchResult
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &results))
+	require.Len(t, results, 2)
+	require.Equal(t, 2, results[0].NumCPUs)
+	require.Equal(t, 3, results[0].Iterations)
+	require.Equal(t, "0,2", results[0].CPUs)
+	require.Empty(t, results[0].Error)
+	// more CPUs than the free ones.
+	require.NotEmpty(t, results[1].Error)
+
+	require.ErrorContains(t, bench([]string{"--sizes=0"}, env, testr.New(t), provider), "invalid claim size")
+}
+
+func TestReadClaims(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, driver.ClaimsAPIPath, r.URL.Path)
+		_ = json.NewEncoder(w).Encode(driver.ClaimList{
+			APIVersion: driver.ClaimsAPIVersion,
+			Claims:     []driver.ClaimInfo{{ClaimUID: "claim-a", CPUs: "2-3", Containers: []driver.ContainerInfo{}}},
+		})
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	env := &Env{Output: OUTPUT_TEXT, Out: &out}
+	require.NoError(t, State([]string{"--claims-api-address=" + strings.TrimPrefix(server.URL, "http://")}, env))
+	require.Contains(t, out.String(), "claim-a")
+	require.Contains(t, out.String(), "2-3")
+
+	require.ErrorContains(t, State(nil, &Env{Out: io.Discard}), "set --claims-api-address")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+)
+
+// stateTimeout bounds the query of the claims API of the running driver.
+const stateTimeout = 10 * time.Second
+
+// State prints the claims prepared by the driver running on the node, with their CPUs and the containers consuming
+// them, read from its node-local claims API.
+func State(args []string, env *Env) error {
+	fs := flag.NewFlagSet("dracpu state", flag.ExitOnError)
+	address := fs.String("claims-api-address", env.DriverConfig.ClaimsAPIAddress, "The address the running driver serves the claims API at, as its --claims-api-address flag.")
+	AddOutputFlag(fs, &env.Output)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *address == "" {
+		return fmt.Errorf("the state is read from the claims API of the driver, set --claims-api-address")
+	}
+
+	claims, err := readClaims(&http.Client{Timeout: stateTimeout}, "http://"+*address+driver.ClaimsAPIPath)
+	if err != nil {
+		return err
+	}
+	return env.Print(claims, func(w io.Writer) error {
+		tw := newTable(w, "CLAIM", "CPUS", "POD", "CONTAINER")
+		for _, claim := range claims.Claims {
+			if len(claim.Containers) == 0 {
+				fmt.Fprintf(tw, "%s\t%s\t-\t-\n", claim.ClaimUID, claim.CPUs)
+			}
+			for _, ctr := range claim.Containers {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", claim.ClaimUID, claim.CPUs, ctr.PodUID, ctr.ContainerName)
+			}
+		}
+		return tw.Flush()
+	})
+}
+
+// readClaims reads the claims from the claims API, which sorts them by UID.
+func readClaims(client *http.Client, url string) (driver.ClaimList, error) {
+	var claims driver.ClaimList
+	resp, err := client.Get(url)
+	if err != nil {
+		return claims, fmt.Errorf("failed to query the claims API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return claims, fmt.Errorf("failed to query the claims API: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return claims, fmt.Errorf("malformed response of the claims API: %w", err)
+	}
+	return claims, nil
+}
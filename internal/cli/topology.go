@@ -0,0 +1,58 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/gatherinfo"
+)
+
+// Topology prints the CPU topology of the host, as the driver discovers it.
+func Topology(args []string, env *Env) error {
+	fs := flag.NewFlagSet("dracpu topology", flag.ExitOnError)
+	AddOutputFlag(fs, &env.Output)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	details, err := gatherinfo.CollectCPUDetails(ctxlog.Setup())
+	if err != nil {
+		return err
+	}
+	return env.Print(details, func(w io.Writer) error {
+		return printTopology(w, details)
+	})
+}
+
+func printTopology(w io.Writer, details gatherinfo.CPUDetails) error {
+	summary := details.Topology
+	fmt.Fprintf(w, "CPUs: %d, cores: %d, uncore caches: %d, sockets: %d, NUMA nodes: %d, SMT enabled: %t\n\n",
+		summary.NumCPUs, summary.NumCores, summary.NumUncoreCache, summary.NumSockets, summary.NumNUMANodes, summary.SMTEnabled)
+	tw := newTable(w, "CPU", "CORE", "SOCKET", "NUMA", "L3", "SIBLING", "TYPE")
+	for _, cpu := range details.CPUs {
+		coreType := cpu.CoreType
+		if coreType == "" {
+			coreType = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%s\n", cpu.CPUID, cpu.CoreID, cpu.SocketID, cpu.NUMANodeID, cpu.UncoreCacheID, cpu.Sibling, coreType)
+	}
+	return tw.Flush()
+}
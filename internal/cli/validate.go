@@ -0,0 +1,79 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+)
+
+// errInvalidConfig is returned once the reason was printed.
+var errInvalidConfig = errors.New("the configuration is invalid")
+
+// ValidationResult is the result of the validation of the driver flags.
+type ValidationResult struct {
+	Valid bool `json:"valid"`
+	// Error is why the driver would refuse to start.
+	Error string `json:"error,omitempty"`
+}
+
+// Validate checks the driver flags against the CPU topology of the node, as the driver does when it starts,
+// without starting it nor changing anything on the node.
+func Validate(args []string, env *Env) error {
+	return validate(args, env, ctxlog.Setup(), cpuinfo.NewSystemCPUInfo())
+}
+
+func validate(args []string, env *Env, logger logr.Logger, cpuInfoProvider driver.CPUInfoProvider) error {
+	cfg := env.DriverConfig
+	fs := flag.NewFlagSet("dracpu validate", flag.ExitOnError)
+	cfg.AddFlags(fs)
+	AddOutputFlag(fs, &env.Output)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := cfg.DriverConfig(env.DriverName, "")
+	if err == nil {
+		err = driver.ValidateConfig(ctxlog.NewContext(context.Background(), logger), config, cpuInfoProvider)
+	}
+	result := ValidationResult{Valid: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if err := env.Print(result, func(w io.Writer) error {
+		if result.Valid {
+			_, err := fmt.Fprintln(w, "the configuration is valid")
+			return err
+		}
+		_, err := fmt.Fprintf(w, "the configuration is invalid: %s\n", result.Error)
+		return err
+	}); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errInvalidConfig
+	}
+	return nil
+}
@@ -19,8 +19,16 @@ package driverconfig
 import (
 	"flag"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/procpinner"
+	"k8s.io/utils/cpuset"
 )
 
 type Config struct {
@@ -31,13 +39,94 @@ type Config struct {
 	CPUDeviceMode    string `json:"cpuDeviceMode"`
 	GroupBy          string `json:"groupBy,omitempty"`
 	ExposePCIeRoots  bool   `json:"exposePCIeRoots,omitempty"`
+	EnableCDI        bool   `json:"enableCDI"`
+	// NUMADeviceNaming names the NUMA node devices after the kernel NUMA node IDs or their physical identity.
+	NUMADeviceNaming string `json:"numaDeviceNaming,omitempty"`
+	// SocketNUMAPartitions publishes a device per NUMA node along the socket devices, sharing counters.
+	SocketNUMAPartitions bool `json:"socketNUMAPartitions,omitempty"`
+	// SocketDeviceModes maps socket IDs to the CPU device mode overriding CPUDeviceMode.
+	SocketDeviceModes map[int]string `json:"socketDeviceModes,omitempty"`
+	// NUMAMemoryBandwidth maps NUMA node IDs to their memory bandwidth in GB/s.
+	NUMAMemoryBandwidth map[int]int64 `json:"numaMemoryBandwidth,omitempty"`
+	// CPUTiers maps the CPU tier names to their CPUs, as a cpuset or a core type.
+	CPUTiers map[string]string `json:"cpuTiers,omitempty"`
+	// SplitCoreTypes splits the grouped devices of the hybrid parts by core type.
+	SplitCoreTypes bool `json:"splitCoreTypes,omitempty"`
+	// CPUPoolsFile is the file of the admin-defined CPU pools.
+	CPUPoolsFile string `json:"cpuPoolsFile,omitempty"`
+	// IsolatedCPUsPool publishes the CPUs isolated by the kernel as the "isolated" CPU pool.
+	IsolatedCPUsPool bool `json:"isolatedCPUsPool,omitempty"`
+	// CDIPassthroughAnnotations is a comma-separated allow-list of annotation keys.
+	CDIPassthroughAnnotations string `json:"cdiPassthroughAnnotations,omitempty"`
+	CDIPassthroughTarget      string `json:"cdiPassthroughTarget,omitempty"`
+	// PinSystemdUnits and PinProcessNames are comma-separated lists.
+	PinSystemdUnits            string        `json:"pinSystemdUnits,omitempty"`
+	PinProcessNames            string        `json:"pinProcessNames,omitempty"`
+	PinProcessesInterval       time.Duration `json:"pinProcessesInterval,omitempty"`
+	ClaimsAPIAddress           string        `json:"claimsAPIAddress,omitempty"`
+	ResourceSliceCleanupPolicy string        `json:"resourceSliceCleanupPolicy,omitempty"`
+	ResourceSliceMaxDevices    int           `json:"resourceSliceMaxDevices,omitempty"`
+	ResourceSliceGrouping      string        `json:"resourceSliceGrouping,omitempty"`
+	ResourcePoolPerGroup       bool          `json:"resourcePoolPerGroup,omitempty"`
+	TranslateLegacyDeviceNames bool          `json:"translateLegacyDeviceNames"`
+	CollapseUMADevices         bool          `json:"collapseUMADevices"`
+	LegacyNUMAAttribute        bool          `json:"legacyNUMAAttribute"`
+	NodeStatusNamespace        string        `json:"nodeStatusNamespace,omitempty"`
+	NodeStatusInterval         time.Duration `json:"nodeStatusInterval,omitempty"`
+	EfficiencyReportInterval   time.Duration `json:"efficiencyReportInterval,omitempty"`
+	ZeroCapacityPolicy         string        `json:"zeroCapacityPolicy,omitempty"`
+	CapacityRequestPolicy      string        `json:"capacityRequestPolicy,omitempty"`
+	PeakUsageFile              string        `json:"peakUsageFile,omitempty"`
+	SharedPoolFile             string        `json:"sharedPoolFile,omitempty"`
+	PinMemoryNodes             bool          `json:"pinMemoryNodes,omitempty"`
+	SharedPoolDevice           bool          `json:"sharedPoolDevice,omitempty"`
+	IsolationLabel             string        `json:"isolationLabel,omitempty"`
+	IsolationDomain            string        `json:"isolationDomain,omitempty"`
+	MinSharedCPUs              int           `json:"minSharedCPUs,omitempty"`
+	SharedPoolEvents           bool          `json:"sharedPoolEvents,omitempty"`
+	SystemClaimNamespaces      string        `json:"systemClaimNamespaces,omitempty"`
+	PodLevelPinningNamespaces  string        `json:"podLevelPinningNamespaces,omitempty"`
+	StrictEnforcement          bool          `json:"strictEnforcement,omitempty"`
+	FullPCPUsOnly              bool          `json:"fullPCPUsOnly,omitempty"`
+	SMTIsolation               bool          `json:"smtIsolation,omitempty"`
+	PreferAlignByUncoreCache   bool          `json:"preferAlignByUncoreCache"`
+	CPUSortingStrategy         string        `json:"cpuSortingStrategy,omitempty"`
+	AllocationPolicy           string        `json:"allocationPolicy,omitempty"`
+	FractionalCPUs             bool          `json:"fractionalCPUs,omitempty"`
+	UnhealthyCPUsFile          string        `json:"unhealthyCPUsFile,omitempty"`
+	KubeletPluginsDir          string        `json:"kubeletPluginsDir,omitempty"`
+	KubeletRegistrarDir        string        `json:"kubeletRegistrarDir,omitempty"`
+	CDISpecDir                 string        `json:"cdiSpecDir,omitempty"`
+	NRISocketPath              string        `json:"nriSocketPath,omitempty"`
+	// FeatureGates maps the feature gate names to their enablement.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
 }
 
 func Default() Config {
 	return Config{
-		BindAddress:   ":8080",
-		CPUDeviceMode: driver.CPU_DEVICE_MODE_GROUPED,
-		GroupBy:       driver.GROUP_BY_NUMA_NODE,
+		BindAddress:                ":8080",
+		CPUDeviceMode:              driver.CPU_DEVICE_MODE_GROUPED,
+		GroupBy:                    driver.GROUP_BY_NUMA_NODE,
+		NUMADeviceNaming:           driver.NUMA_DEVICE_NAMING_KERNEL,
+		EnableCDI:                  true,
+		CDIPassthroughTarget:       driver.CDI_PASSTHROUGH_ANNOTATIONS,
+		PinProcessesInterval:       procpinner.DefaultInterval,
+		ResourceSliceCleanupPolicy: driver.SLICE_CLEANUP_POLICY_RETAIN,
+		ResourceSliceGrouping:      driver.SLICE_GROUPING_NONE,
+		TranslateLegacyDeviceNames: true,
+		CollapseUMADevices:         true,
+		LegacyNUMAAttribute:        true,
+		PreferAlignByUncoreCache:   true,
+		CPUSortingStrategy:         driver.CPU_SORTING_STRATEGY_PACKED,
+		AllocationPolicy:           cpumanager.PolicyNUMAPacked,
+		NodeStatusInterval:         driver.DefaultNodeStatusInterval,
+		ZeroCapacityPolicy:         driver.ZERO_CAPACITY_POLICY_SHARED,
+		CapacityRequestPolicy:      driver.CAPACITY_REQUEST_POLICY_NONE,
+		IsolationDomain:            driver.ISOLATION_DOMAIN_NUMA_NODE,
+		KubeletPluginsDir:          driver.DefaultKubeletPluginsDir,
+		KubeletRegistrarDir:        driver.DefaultKubeletRegistrarDir,
+		CDISpecDir:                 driver.DefaultCDISpecDir,
+		NRISocketPath:              driver.DefaultNRISocketPath,
 	}
 }
 
@@ -46,11 +135,61 @@ func (c *Config) AddFlags(fs *flag.FlagSet) {
 
 	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "absolute path to the kubeconfig file")
 	fs.StringVar(&c.HostnameOverride, "hostname-override", c.HostnameOverride, "If non-empty, will be used as the name of the Node that kube-network-policies is running on. If unset, the node name is assumed to be the same as the node's hostname.")
-	fs.StringVar(&c.BindAddress, "bind-address", c.BindAddress, "The address to bind the HTTP server for /healthz and /metrics endpoints")
+	fs.StringVar(&c.BindAddress, "bind-address", c.BindAddress, "The address to bind the HTTP server for /healthz, /readyz and /metrics endpoints")
 	fs.StringVar(&c.ReservedCPUs, "reserved-cpus", c.ReservedCPUs, "cpuset of CPUs to be excluded from ResourceSlice.")
-	fs.Var(newCPUDeviceModeValue(&c.CPUDeviceMode, c.CPUDeviceMode), "cpu-device-mode", "Sets the mode for exposing CPU devices. 'grouped' exposes a single device per socket or numa node (based on --group-by). 'individual' exposes each CPU as a separate device.")
-	fs.Var(newGroupByValue(&c.GroupBy, c.GroupBy), "group-by", "When --cpu-device-mode=grouped, sets the criteria for grouping CPUs. Can be set to 'socket' or 'numanode'.")
+	fs.Var(newCPUDeviceModeValue(&c.CPUDeviceMode, c.CPUDeviceMode), "cpu-device-mode", "Sets the mode for exposing CPU devices. 'grouped' exposes a single device per socket or numa node (based on --group-by). 'individual' exposes each CPU as a separate device. 'mixed' exposes both, sharing per NUMA node counters.")
+	fs.Var(newSocketDeviceModesValue(&c.SocketDeviceModes), "socket-device-modes", "Comma-separated list of <socketID>=<mode> overriding --cpu-device-mode for the given sockets, e.g. '0=individual,1=grouped'.")
+	fs.Var(newNUMAMemoryBandwidthValue(&c.NUMAMemoryBandwidth), "numa-memory-bandwidth", "Comma-separated list of <numaNodeID>=<GB/s> setting the memory bandwidth of the NUMA nodes, e.g. '0=250,1=250', published as the dra.cpu/memoryBandwidth capacity of their devices, in bytes per second. The NUMA nodes not listed publish the read bandwidth of the HMAT of the firmware, if any. Requires --cpu-device-mode=grouped and --group-by=numanode.")
+	fs.Var(newCPUTiersValue(&c.CPUTiers), "cpu-tiers", "Semicolon-separated list of <tier>=<cpuset|coreType> partitioning the CPUs in named tiers, e.g. 'gold=0-3,8-11;silver=4-7' or 'gold=p-core;bronze=e-core'. The CPUs of each tier are published as separate devices with the dra.cpu/tier attribute.")
+	fs.BoolVar(&c.SplitCoreTypes, "split-core-types", c.SplitCoreTypes, "On the hybrid parts, split each grouped device in a device per core type, e.g. 'cpudevsocket000-p-core' and 'cpudevsocket000-e-core', with the dra.cpu/coreType attribute. Exclusive with --cpu-tiers.")
+	fs.StringVar(&c.CPUPoolsFile, "cpu-pools-file", c.CPUPoolsFile, "YAML or JSON file mapping the names of admin-defined CPU pools to their cpusets, under 'pools'. Each pool is published as a 'cpudevpool-<name>' device with the dra.cpu/pool attribute, and its CPUs are taken out of the other devices. Requires --cpu-device-mode=grouped.")
+	fs.BoolVar(&c.IsolatedCPUsPool, "isolated-cpus-pool", c.IsolatedCPUsPool, "Publish the CPUs isolated by the kernel, with isolcpus or nohz_full, as the 'isolated' CPU pool, a 'cpudevpool-isolated' device, so only the claims asking for it get them. Requires --cpu-device-mode=grouped.")
+	fs.Var(newGroupByValue(&c.GroupBy, c.GroupBy), "group-by", "When --cpu-device-mode=grouped, sets the criteria for grouping CPUs. Can be set to 'socket', 'numanode', 'die', 'cluster', 'l3', 'ccd' or 'core'.")
+	fs.Var(newNUMADeviceNamingValue(&c.NUMADeviceNaming, c.NUMADeviceNaming), "numa-device-naming", "How the NUMA node devices are named. 'kernel' uses the NUMA node IDs of the kernel, e.g. 'cpudevnuma001'. 'physical' hashes the socket, the dies and the memory of each NUMA node, e.g. 'cpudevnuma-5c1d0e7a', so the names survive a renumbering of the NUMA nodes by a firmware or kernel update. Changing it requires no allocated claims on the node.")
+	fs.BoolVar(&c.SocketNUMAPartitions, "socket-numa-partitions", c.SocketNUMAPartitions, "When --group-by=socket, also publish a device per NUMA node, e.g. 'cpudevnuma001', as a partition of its socket device: both consume from a counter set per NUMA node, so a NUMA node is allocated through one of them at a time. Requires the DRAPartitionableDevices feature gate in the cluster.")
+	fs.BoolVar(&c.CollapseUMADevices, "collapse-uma-devices", c.CollapseUMADevices, "When --cpu-device-mode=grouped, publish a single 'cpudevnode000' device without NUMA node attributes on the nodes with a single socket, NUMA node and die, whatever --group-by.")
 	fs.BoolVar(&c.ExposePCIeRoots, "expose-pcie-roots", c.ExposePCIeRoots, "Discover and expose PCIe roots as device attributes. Requires the DRAListTypeAttributes=true Feature Gate in the cluster.")
+	fs.BoolVar(&c.EnableCDI, "enable-cdi", c.EnableCDI, "Expose the allocated CPUs to containers through CDI environment variables. If disabled, the driver runs in NRI-only mode and only pins the containers.")
+	fs.BoolVar(&c.PinMemoryNodes, "pin-memory-nodes", c.PinMemoryNodes, "Also restrict the memory of the containers with guaranteed CPUs to the NUMA nodes of their CPUs, setting the cpuset memory nodes in their OCI spec.")
+	fs.BoolVar(&c.SharedPoolDevice, "shared-pool-device", c.SharedPoolDevice, "Publish the 'cpudevshared' virtual device of the shared pool, with the dra.cpu/sharedPool attribute, which any number of claims can be allocated: their containers run on the shared CPUs, without exclusive CPUs.")
+	fs.StringVar(&c.CDIPassthroughAnnotations, "cdi-passthrough-annotations", c.CDIPassthroughAnnotations, "Comma-separated list of annotation keys copied from the ResourceClaim and its pods into the CDI device of the claim. Claim annotations take precedence over pod annotations.")
+	fs.Var(newCDIPassthroughTargetValue(&c.CDIPassthroughTarget, c.CDIPassthroughTarget), "cdi-passthrough-target", "Where the passthrough annotations are copied. 'annotations' sets them as CDI device annotations, 'env' sets them as DRA_CPU_ANNOTATION_<claimUID>_<KEY> environment variables.")
+	fs.StringVar(&c.PinSystemdUnits, "pin-systemd-units", c.PinSystemdUnits, "Comma-separated list of systemd units whose processes are pinned to the reserved CPUs. Requires --reserved-cpus and the driver running in the host PID namespace.")
+	fs.StringVar(&c.PinProcessNames, "pin-process-names", c.PinProcessNames, "Comma-separated list of process command names (as in /proc/<pid>/comm) pinned to the reserved CPUs. Requires --reserved-cpus and the driver running in the host PID namespace.")
+	fs.DurationVar(&c.PinProcessesInterval, "pin-processes-interval", c.PinProcessesInterval, "How often the processes selected by --pin-systemd-units and --pin-process-names are pinned again to the reserved CPUs.")
+	fs.StringVar(&c.ClaimsAPIAddress, "claims-api-address", c.ClaimsAPIAddress, "If non-empty, serves the read-only node-local claims API (v1alpha) on this loopback address, e.g. 127.0.0.1:8081. The API lists the claims, their cpusets and the cgroup paths of their containers.")
+	fs.Var(newSliceCleanupPolicyValue(&c.ResourceSliceCleanupPolicy, c.ResourceSliceCleanupPolicy), "resourceslice-cleanup-policy", "What to do with the ResourceSlices of the node on shutdown. 'retain' leaves them in place for a fast restart. 'delete' removes them, for a clean uninstall.")
+	fs.IntVar(&c.ResourceSliceMaxDevices, "resourceslice-max-devices", c.ResourceSliceMaxDevices, "If non-zero, the maximum number of devices of each ResourceSlice, for more, smaller slices. Must not exceed the API limit, which is used when zero.")
+	fs.Var(newSliceGroupingValue(&c.ResourceSliceGrouping, c.ResourceSliceGrouping), "resourceslice-grouping", "Which devices never share a ResourceSlice, so the changes to a group only update its slices. 'none' fills the slices in order, for the fewest slices. 'socket', 'numanode' and 'l3' keep the devices of each socket, NUMA node or L3 cache in their own slices.")
+	fs.BoolVar(&c.ResourcePoolPerGroup, "resourcepool-per-group", c.ResourcePoolPerGroup, "Publish the ResourceSlices of each group of --resourceslice-grouping in a resource pool of its own, e.g. '<node>-numa001', instead of a single pool named as the node, so the updates and the failure domains of the pools are smaller. Requires --resourceslice-grouping=socket or numanode.")
+	fs.StringVar(&c.NodeStatusNamespace, "node-status-namespace", c.NodeStatusNamespace, "If non-empty, maintains in this namespace a CPUDriverNodeStatus object, named as the node, summarizing the allocations, the shared and reserved CPUs and the health of the driver. Requires the CPUDriverNodeStatus CRD.")
+	fs.DurationVar(&c.NodeStatusInterval, "node-status-interval", c.NodeStatusInterval, "How often the CPUDriverNodeStatus object of the node is updated, when --node-status-namespace is set.")
+	fs.DurationVar(&c.EfficiencyReportInterval, "efficiency-report-interval", c.EfficiencyReportInterval, "If non-zero, how often the exclusive CPUs allocated to each workload of the node are compared with their mean utilization, reported by metrics and by the claims API. Zero disables the report.")
+	fs.Var(newZeroCapacityPolicyValue(&c.ZeroCapacityPolicy, c.ZeroCapacityPolicy), "zero-capacity-policy", "How grouped devices allocated without consumed CPU capacity are prepared. 'shared' grants access to the shared CPUs only, 'one-cpu' assigns one exclusive CPU, 'error' fails the claim.")
+	fs.Var(newCapacityRequestPolicyValue(&c.CapacityRequestPolicy, c.CapacityRequestPolicy), "capacity-request-policy", "The request policy published for the CPU capacity of the grouped devices, which the scheduler enforces. 'none' publishes no policy. 'cpus' accepts whole CPUs only, or millicores with --fractional-cpus. 'cores' accepts multiples of the threads of a core, e.g. 2, 4, 6 with SMT. The claims without a CPU request consume the minimum, one CPU or one core.")
+	fs.StringVar(&c.IsolationLabel, "isolation-label", c.IsolationLabel, "If non-empty, the pod label key whose values are isolation tiers: the exclusive CPUs of the pods with different values never share an isolation domain (see --isolation-domain). Pods without the label are not isolated.")
+	fs.Var(newIsolationDomainValue(&c.IsolationDomain, c.IsolationDomain), "isolation-domain", "What the exclusive CPUs of the pods of different tiers never share, when --isolation-label is set. Can be set to 'numanode' or 'l3'.")
+	fs.IntVar(&c.MinSharedCPUs, "min-shared-cpus", c.MinSharedCPUs, "If non-zero, the minimum size of the shared pool: when the allocations shrink it to this number of CPUs or less, the driver reports it by metrics and in the node status, while still preparing the claims. Zero disables the check.")
+	fs.BoolVar(&c.SharedPoolEvents, "shared-pool-events", c.SharedPoolEvents, "When --min-shared-cpus is set, also emit an event on the node when the shared pool reaches the minimum and when it is above it again. Requires the permission to create events.")
+	fs.StringVar(&c.SystemClaimNamespaces, "system-claim-namespaces", c.SystemClaimNamespaces, "Comma-separated list of namespaces whose claims may request reserved CPUs with the systemCPUs device configuration, for the privileged system workloads. Empty disables the system claims.")
+	fs.StringVar(&c.PodLevelPinningNamespaces, "pod-level-pinning-namespaces", c.PodLevelPinningNamespaces, "Comma-separated list of namespaces whose claims pin all the containers of their pods to the claim CPUs, and not only the containers consuming them, as the podLevelPinning device configuration does for a single claim.")
+	fs.BoolVar(&c.StrictEnforcement, "strict-enforcement", c.StrictEnforcement, "Fail the preparation of the claims, which the kubelet retries, while the NRI plugin is not connected to the runtime or the runtime doesn't apply the container updates, instead of preparing them without enforcing their CPUs, as the strictEnforcement device configuration does for a single claim.")
+	fs.BoolVar(&c.FullPCPUsOnly, "full-pcpus-only", c.FullPCPUsOnly, "When SMT is enabled, allocate whole physical cores only, so the claims never share a core with other workloads, as the fullPCPUsOnly device configuration does for a single claim. The preparation of the claims requesting a number of CPUs which is not a multiple of the threads of a core, or allocated individual devices not forming whole cores, fails.")
+	fs.BoolVar(&c.SMTIsolation, "smt-isolation", c.SMTIsolation, "When SMT is enabled, never let two claims share a physical core: the allocations of the grouped devices are padded up to whole cores, e.g. 3 CPUs take 2 cores, and the individual devices are padded with their free siblings, failing the preparation if a sibling belongs to another claim. The padding CPUs are not accounted by the scheduler. --full-pcpus-only fails the padded requests instead.")
+	fs.BoolVar(&c.PreferAlignByUncoreCache, "prefer-align-by-uncore-cache", c.PreferAlignByUncoreCache, "Allocate the CPUs of the grouped devices from as few uncore (L3) caches as possible, taking whole caches first and then the cache with the fewest free CPUs fitting the request, before spilling to other caches, as the prefer-align-cpus-by-uncorecache option of the kubelet cpumanager does.")
+	fs.Var(newCPUSortingStrategyValue(&c.CPUSortingStrategy, c.CPUSortingStrategy), "cpu-sorting-strategy", "How the CPUs of the grouped devices are picked within the NUMA nodes and sockets. 'packed' fills whole physical cores first, keeping the other cores free. 'spread' takes distinct physical cores first, before the sibling threads of the cores already taken, for the workloads sensitive to the sharing of the core resources, as the distribute-cpus-across-cores option of the kubelet cpumanager. 'spread' disables --prefer-align-by-uncore-cache, which packs whole cores.")
+	fs.Var(newAllocationPolicyValue(&c.AllocationPolicy, c.AllocationPolicy), "allocation-policy", "The policy picking the CPUs of the claims consuming a part of a grouped device. 'numa-packed' packs them in as few NUMA nodes, uncore caches and cores as possible. 'numa-distributed' spreads them evenly, in whole cores, across the NUMA nodes when more than one is needed. The builds of the driver may compile in custom policies. Known policies: ["+strings.Join(cpumanager.PolicyNames(), ", ")+"].")
+	fs.BoolVar(&c.FractionalCPUs, "fractional-cpus", c.FractionalCPUs, "Let the claims consume a fraction of the dra.cpu/cpu capacity of the grouped devices, in millicores, e.g. '2500m'. The containers of a fractional claim run on the shared CPUs of the device, with a CPU quota and weight matching the millicores, instead of exclusive CPUs. Requires --enable-cdi.")
+	fs.StringVar(&c.PeakUsageFile, "peak-usage-file", c.PeakUsageFile, "If non-empty, persists to this file the daily and weekly peak exclusive CPU usage of each NUMA node, so the history survives restarts. The directory must exist and be on a persistent host path.")
+	fs.StringVar(&c.SharedPoolFile, "shared-pool-file", c.SharedPoolFile, "If non-empty, keeps this host file up to date with the shared CPUs, in the cpulist format of sysfs (e.g. '0-1,4-7'), replacing it atomically on each change, so host agents like irqbalance or tuned can align with the driver. The directory must exist.")
+	fs.StringVar(&c.UnhealthyCPUsFile, "unhealthy-cpus-file", c.UnhealthyCPUsFile, "If non-empty, the host file where the health agents of the node list the CPUs flagged unhealthy, in the cpulist format of sysfs (e.g. '3,7'). The devices of the unhealthy CPUs are tainted with dra.cpu/cpu-unhealthy, as the devices of the offline CPUs are with dra.cpu/cpu-offline. A missing file flags no CPU.")
+	fs.StringVar(&c.KubeletPluginsDir, "kubelet-plugins-dir", c.KubeletPluginsDir, "The kubelet plugins directory, where the driver serves its socket. Must be mounted at the same path as on the host.")
+	fs.StringVar(&c.KubeletRegistrarDir, "kubelet-registrar-dir", c.KubeletRegistrarDir, "The kubelet plugin registration directory. Must be mounted at the same path as on the host.")
+	fs.StringVar(&c.CDISpecDir, "cdi-spec-dir", c.CDISpecDir, "Where the host CDI spec directory is mounted, when --enable-cdi is set.")
+	fs.StringVar(&c.NRISocketPath, "nri-socket-path", c.NRISocketPath, "Where the NRI socket of the container runtime is mounted.")
+	fs.Var(newFeatureGatesValue(&c.FeatureGates), "feature-gates", "Comma-separated list of <name>=true|false enabling or disabling the experimental capabilities of the driver. Known gates: ["+strings.Join(driver.KnownFeatureGates(), ", ")+"].")
+	fs.BoolVar(&c.LegacyNUMAAttribute, "legacy-numa-attribute", c.LegacyNUMAAttribute, "Deprecated: also publish the NUMA node of the devices as the dra.net/numaNode attribute, next to resource.kubernetes.io/numaNode, for the DRA drivers still aligning on it. Will be removed in a future release.")
+	fs.BoolVar(&c.TranslateLegacyDeviceNames, "translate-legacy-device-names", c.TranslateLegacyDeviceNames, "Deprecated: translate the device names allocated by previous driver versions, so the claims allocated before an upgrade can still be prepared. Will be removed in a future release.")
 }
 
 func (c *Config) applyDefaults() {
@@ -64,6 +203,127 @@ func (c *Config) applyDefaults() {
 	if c.GroupBy == "" {
 		c.GroupBy = defaults.GroupBy
 	}
+	if c.NUMADeviceNaming == "" {
+		c.NUMADeviceNaming = defaults.NUMADeviceNaming
+	}
+	if c.CDIPassthroughTarget == "" {
+		c.CDIPassthroughTarget = defaults.CDIPassthroughTarget
+	}
+	if c.PinProcessesInterval == 0 {
+		c.PinProcessesInterval = defaults.PinProcessesInterval
+	}
+	if c.ResourceSliceCleanupPolicy == "" {
+		c.ResourceSliceCleanupPolicy = defaults.ResourceSliceCleanupPolicy
+	}
+	if c.ResourceSliceGrouping == "" {
+		c.ResourceSliceGrouping = defaults.ResourceSliceGrouping
+	}
+	if c.NodeStatusInterval == 0 {
+		c.NodeStatusInterval = defaults.NodeStatusInterval
+	}
+	if c.ZeroCapacityPolicy == "" {
+		c.ZeroCapacityPolicy = defaults.ZeroCapacityPolicy
+	}
+	if c.CapacityRequestPolicy == "" {
+		c.CapacityRequestPolicy = defaults.CapacityRequestPolicy
+	}
+	if c.CPUSortingStrategy == "" {
+		c.CPUSortingStrategy = defaults.CPUSortingStrategy
+	}
+	if c.AllocationPolicy == "" {
+		c.AllocationPolicy = defaults.AllocationPolicy
+	}
+	if c.IsolationDomain == "" {
+		c.IsolationDomain = defaults.IsolationDomain
+	}
+	if c.KubeletPluginsDir == "" {
+		c.KubeletPluginsDir = defaults.KubeletPluginsDir
+	}
+	if c.KubeletRegistrarDir == "" {
+		c.KubeletRegistrarDir = defaults.KubeletRegistrarDir
+	}
+	if c.CDISpecDir == "" {
+		c.CDISpecDir = defaults.CDISpecDir
+	}
+	if c.NRISocketPath == "" {
+		c.NRISocketPath = defaults.NRISocketPath
+	}
+}
+
+// DriverConfig returns the configuration of the driver for the node, without the clients and the components.
+func (c Config) DriverConfig(driverName, nodeName string) (*driver.Config, error) {
+	reservedCPUs, err := cpuset.Parse(c.ReservedCPUs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reserved CPUs: %w", err)
+	}
+	return &driver.Config{
+		DriverName:                 driverName,
+		NodeName:                   nodeName,
+		ReservedCPUs:               reservedCPUs,
+		CPUDeviceMode:              c.CPUDeviceMode,
+		CPUDeviceGroupBy:           c.GroupBy,
+		NUMADeviceNaming:           c.NUMADeviceNaming,
+		SocketNUMAPartitions:       c.SocketNUMAPartitions,
+		SocketDeviceModes:          c.SocketDeviceModes,
+		NUMAMemoryBandwidth:        c.NUMAMemoryBandwidth,
+		CPUTiers:                   c.CPUTiers,
+		SplitCoreTypes:             c.SplitCoreTypes,
+		CPUPoolsFile:               c.CPUPoolsFile,
+		IsolatedCPUsPool:           c.IsolatedCPUsPool,
+		ExposePCIeRoots:            c.ExposePCIeRoots,
+		EnableCDI:                  c.EnableCDI,
+		CDIPassthroughAnnotations:  SplitList(c.CDIPassthroughAnnotations),
+		CDIPassthroughTarget:       c.CDIPassthroughTarget,
+		PinnedSystemdUnits:         SplitList(c.PinSystemdUnits),
+		PinnedProcessNames:         SplitList(c.PinProcessNames),
+		ProcessPinningInterval:     c.PinProcessesInterval,
+		ResourceSliceCleanupPolicy: c.ResourceSliceCleanupPolicy,
+		ResourceSliceMaxDevices:    c.ResourceSliceMaxDevices,
+		ResourcePoolPerGroup:       c.ResourcePoolPerGroup,
+		ResourceSliceGrouping:      c.ResourceSliceGrouping,
+		TranslateLegacyDeviceNames: c.TranslateLegacyDeviceNames,
+		CollapseUMADevices:         c.CollapseUMADevices,
+		LegacyNUMAAttribute:        c.LegacyNUMAAttribute,
+		NodeStatusNamespace:        c.NodeStatusNamespace,
+		NodeStatusInterval:         c.NodeStatusInterval,
+		EfficiencyReportInterval:   c.EfficiencyReportInterval,
+		ZeroCapacityPolicy:         c.ZeroCapacityPolicy,
+		CapacityRequestPolicy:      c.CapacityRequestPolicy,
+		PeakUsageFile:              c.PeakUsageFile,
+		SharedPoolFile:             c.SharedPoolFile,
+		PinMemoryNodes:             c.PinMemoryNodes,
+		SharedPoolDevice:           c.SharedPoolDevice,
+		IsolationLabel:             c.IsolationLabel,
+		IsolationDomain:            c.IsolationDomain,
+		MinSharedCPUs:              c.MinSharedCPUs,
+		SharedPoolEvents:           c.SharedPoolEvents,
+		SystemClaimNamespaces:      SplitList(c.SystemClaimNamespaces),
+		PodLevelPinningNamespaces:  SplitList(c.PodLevelPinningNamespaces),
+		StrictEnforcement:          c.StrictEnforcement,
+		FullPCPUsOnly:              c.FullPCPUsOnly,
+		SMTIsolation:               c.SMTIsolation,
+		PreferAlignByUncoreCache:   c.PreferAlignByUncoreCache,
+		CPUSortingStrategy:         c.CPUSortingStrategy,
+		AllocationPolicy:           c.AllocationPolicy,
+		FractionalCPUs:             c.FractionalCPUs,
+		UnhealthyCPUsFile:          c.UnhealthyCPUsFile,
+		FeatureGates:               c.FeatureGates,
+		KubeletPluginsDir:          c.KubeletPluginsDir,
+		KubeletRegistrarDir:        c.KubeletRegistrarDir,
+		CDISpecDir:                 c.CDISpecDir,
+		NRISocketPath:              c.NRISocketPath,
+	}, nil
+}
+
+// SplitList splits a comma-separated list flag, dropping empty entries.
+func SplitList(s string) []string {
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 type cpuDeviceModeValue struct {
@@ -83,8 +343,8 @@ func (v *cpuDeviceModeValue) String() string {
 }
 
 func (v *cpuDeviceModeValue) Set(s string) error {
-	if s != driver.CPU_DEVICE_MODE_GROUPED && s != driver.CPU_DEVICE_MODE_INDIVIDUAL {
-		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.CPU_DEVICE_MODE_GROUPED, driver.CPU_DEVICE_MODE_INDIVIDUAL)
+	if modes := driver.DeviceModes(); !slices.Contains(modes, s) {
+		return fmt.Errorf("invalid value: %q, must be one of %s", s, strings.Join(modes, ", "))
 	}
 	*v.value = s
 	return nil
@@ -107,9 +367,407 @@ func (v *groupByValue) String() string {
 }
 
 func (v *groupByValue) Set(s string) error {
-	if s != driver.GROUP_BY_SOCKET && s != driver.GROUP_BY_NUMA_NODE {
-		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.GROUP_BY_SOCKET, driver.GROUP_BY_NUMA_NODE)
+	if s != driver.GROUP_BY_SOCKET && s != driver.GROUP_BY_NUMA_NODE && s != driver.GROUP_BY_DIE && s != driver.GROUP_BY_CLUSTER && s != driver.GROUP_BY_L3 && s != driver.GROUP_BY_CCD && s != driver.GROUP_BY_CORE {
+		return fmt.Errorf("invalid value: %q, must be %s, %s, %s, %s, %s, %s or %s", s, driver.GROUP_BY_SOCKET, driver.GROUP_BY_NUMA_NODE, driver.GROUP_BY_DIE, driver.GROUP_BY_CLUSTER, driver.GROUP_BY_L3, driver.GROUP_BY_CCD, driver.GROUP_BY_CORE)
+	}
+	*v.value = s
+	return nil
+}
+
+type numaDeviceNamingValue struct {
+	value *string
+}
+
+func newNUMADeviceNamingValue(val *string, def string) *numaDeviceNamingValue {
+	*val = def
+	return &numaDeviceNamingValue{value: val}
+}
+
+func (v *numaDeviceNamingValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *numaDeviceNamingValue) Set(s string) error {
+	if s != driver.NUMA_DEVICE_NAMING_KERNEL && s != driver.NUMA_DEVICE_NAMING_PHYSICAL {
+		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.NUMA_DEVICE_NAMING_KERNEL, driver.NUMA_DEVICE_NAMING_PHYSICAL)
+	}
+	*v.value = s
+	return nil
+}
+
+type cdiPassthroughTargetValue struct {
+	value *string
+}
+
+func newCDIPassthroughTargetValue(val *string, def string) *cdiPassthroughTargetValue {
+	*val = def
+	return &cdiPassthroughTargetValue{value: val}
+}
+
+func (v *cdiPassthroughTargetValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *cdiPassthroughTargetValue) Set(s string) error {
+	if s != driver.CDI_PASSTHROUGH_ANNOTATIONS && s != driver.CDI_PASSTHROUGH_ENV {
+		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.CDI_PASSTHROUGH_ANNOTATIONS, driver.CDI_PASSTHROUGH_ENV)
+	}
+	*v.value = s
+	return nil
+}
+
+type sliceCleanupPolicyValue struct {
+	value *string
+}
+
+func newSliceCleanupPolicyValue(val *string, def string) *sliceCleanupPolicyValue {
+	*val = def
+	return &sliceCleanupPolicyValue{value: val}
+}
+
+func (v *sliceCleanupPolicyValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *sliceCleanupPolicyValue) Set(s string) error {
+	if s != driver.SLICE_CLEANUP_POLICY_RETAIN && s != driver.SLICE_CLEANUP_POLICY_DELETE {
+		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.SLICE_CLEANUP_POLICY_RETAIN, driver.SLICE_CLEANUP_POLICY_DELETE)
+	}
+	*v.value = s
+	return nil
+}
+
+type sliceGroupingValue struct {
+	value *string
+}
+
+func newSliceGroupingValue(val *string, def string) *sliceGroupingValue {
+	*val = def
+	return &sliceGroupingValue{value: val}
+}
+
+func (v *sliceGroupingValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *sliceGroupingValue) Set(s string) error {
+	if s != driver.SLICE_GROUPING_NONE && s != driver.SLICE_GROUPING_SOCKET && s != driver.SLICE_GROUPING_NUMA_NODE && s != driver.SLICE_GROUPING_L3 {
+		return fmt.Errorf("invalid value: %q, must be %s, %s, %s or %s", s, driver.SLICE_GROUPING_NONE, driver.SLICE_GROUPING_SOCKET, driver.SLICE_GROUPING_NUMA_NODE, driver.SLICE_GROUPING_L3)
+	}
+	*v.value = s
+	return nil
+}
+
+type zeroCapacityPolicyValue struct {
+	value *string
+}
+
+func newZeroCapacityPolicyValue(val *string, def string) *zeroCapacityPolicyValue {
+	*val = def
+	return &zeroCapacityPolicyValue{value: val}
+}
+
+func (v *zeroCapacityPolicyValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *zeroCapacityPolicyValue) Set(s string) error {
+	if s != driver.ZERO_CAPACITY_POLICY_SHARED && s != driver.ZERO_CAPACITY_POLICY_ONE_CPU && s != driver.ZERO_CAPACITY_POLICY_ERROR {
+		return fmt.Errorf("invalid value: %q, must be %s, %s or %s", s, driver.ZERO_CAPACITY_POLICY_SHARED, driver.ZERO_CAPACITY_POLICY_ONE_CPU, driver.ZERO_CAPACITY_POLICY_ERROR)
+	}
+	*v.value = s
+	return nil
+}
+
+type cpuSortingStrategyValue struct {
+	value *string
+}
+
+func newCPUSortingStrategyValue(val *string, def string) *cpuSortingStrategyValue {
+	*val = def
+	return &cpuSortingStrategyValue{value: val}
+}
+
+func (v *cpuSortingStrategyValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *cpuSortingStrategyValue) Set(s string) error {
+	if s != driver.CPU_SORTING_STRATEGY_PACKED && s != driver.CPU_SORTING_STRATEGY_SPREAD {
+		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.CPU_SORTING_STRATEGY_PACKED, driver.CPU_SORTING_STRATEGY_SPREAD)
+	}
+	*v.value = s
+	return nil
+}
+
+type allocationPolicyValue struct {
+	value *string
+}
+
+func newAllocationPolicyValue(val *string, def string) *allocationPolicyValue {
+	*val = def
+	return &allocationPolicyValue{value: val}
+}
+
+func (v *allocationPolicyValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *allocationPolicyValue) Set(s string) error {
+	if _, ok := cpumanager.LookupPolicy(s); !ok {
+		return fmt.Errorf("invalid value: %q, must be one of %s", s, strings.Join(cpumanager.PolicyNames(), ", "))
+	}
+	*v.value = s
+	return nil
+}
+
+type capacityRequestPolicyValue struct {
+	value *string
+}
+
+func newCapacityRequestPolicyValue(val *string, def string) *capacityRequestPolicyValue {
+	*val = def
+	return &capacityRequestPolicyValue{value: val}
+}
+
+func (v *capacityRequestPolicyValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *capacityRequestPolicyValue) Set(s string) error {
+	if s != driver.CAPACITY_REQUEST_POLICY_NONE && s != driver.CAPACITY_REQUEST_POLICY_CPUS && s != driver.CAPACITY_REQUEST_POLICY_CORES {
+		return fmt.Errorf("invalid value: %q, must be %s, %s or %s", s, driver.CAPACITY_REQUEST_POLICY_NONE, driver.CAPACITY_REQUEST_POLICY_CPUS, driver.CAPACITY_REQUEST_POLICY_CORES)
 	}
 	*v.value = s
 	return nil
 }
+
+type isolationDomainValue struct {
+	value *string
+}
+
+func newIsolationDomainValue(val *string, def string) *isolationDomainValue {
+	*val = def
+	return &isolationDomainValue{value: val}
+}
+
+func (v *isolationDomainValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *isolationDomainValue) Set(s string) error {
+	if s != driver.ISOLATION_DOMAIN_NUMA_NODE && s != driver.ISOLATION_DOMAIN_L3 {
+		return fmt.Errorf("invalid value: %q, must be %s or %s", s, driver.ISOLATION_DOMAIN_NUMA_NODE, driver.ISOLATION_DOMAIN_L3)
+	}
+	*v.value = s
+	return nil
+}
+
+type socketDeviceModesValue struct {
+	value *map[int]string
+}
+
+func newSocketDeviceModesValue(val *map[int]string) *socketDeviceModesValue {
+	return &socketDeviceModesValue{value: val}
+}
+
+func (v *socketDeviceModesValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	var entries []string
+	for _, socketID := range slices.Sorted(maps.Keys(*v.value)) {
+		entries = append(entries, fmt.Sprintf("%d=%s", socketID, (*v.value)[socketID]))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *socketDeviceModesValue) Set(s string) error {
+	modes := make(map[int]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		socket, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid value: %q, must be <socketID>=<mode>", entry)
+		}
+		socketID, err := strconv.Atoi(strings.TrimSpace(socket))
+		if err != nil || socketID < 0 {
+			return fmt.Errorf("invalid socket ID: %q", socket)
+		}
+		mode = strings.TrimSpace(mode)
+		if mode != driver.CPU_DEVICE_MODE_GROUPED && mode != driver.CPU_DEVICE_MODE_INDIVIDUAL {
+			return fmt.Errorf("invalid mode for socket %d: %q, must be %s or %s", socketID, mode, driver.CPU_DEVICE_MODE_GROUPED, driver.CPU_DEVICE_MODE_INDIVIDUAL)
+		}
+		if _, ok := modes[socketID]; ok {
+			return fmt.Errorf("duplicate mode for socket %d", socketID)
+		}
+		modes[socketID] = mode
+	}
+	*v.value = modes
+	return nil
+}
+
+type numaMemoryBandwidthValue struct {
+	value *map[int]int64
+}
+
+func newNUMAMemoryBandwidthValue(val *map[int]int64) *numaMemoryBandwidthValue {
+	return &numaMemoryBandwidthValue{value: val}
+}
+
+func (v *numaMemoryBandwidthValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	var entries []string
+	for _, numaNodeID := range slices.Sorted(maps.Keys(*v.value)) {
+		entries = append(entries, fmt.Sprintf("%d=%d", numaNodeID, (*v.value)[numaNodeID]))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *numaMemoryBandwidthValue) Set(s string) error {
+	bandwidths := make(map[int]int64)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		node, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid value: %q, must be <numaNodeID>=<GB/s>", entry)
+		}
+		numaNodeID, err := strconv.Atoi(strings.TrimSpace(node))
+		if err != nil || numaNodeID < 0 {
+			return fmt.Errorf("invalid NUMA node ID: %q", node)
+		}
+		gbps, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || gbps <= 0 {
+			return fmt.Errorf("invalid memory bandwidth for NUMA node %d: %q, must be a positive number of GB/s", numaNodeID, value)
+		}
+		if _, ok := bandwidths[numaNodeID]; ok {
+			return fmt.Errorf("duplicate memory bandwidth for NUMA node %d", numaNodeID)
+		}
+		bandwidths[numaNodeID] = gbps
+	}
+	*v.value = bandwidths
+	return nil
+}
+
+type cpuTiersValue struct {
+	value *map[string]string
+}
+
+func newCPUTiersValue(val *map[string]string) *cpuTiersValue {
+	return &cpuTiersValue{value: val}
+}
+
+func (v *cpuTiersValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	var entries []string
+	for _, tier := range slices.Sorted(maps.Keys(*v.value)) {
+		entries = append(entries, fmt.Sprintf("%s=%s", tier, (*v.value)[tier]))
+	}
+	return strings.Join(entries, ";")
+}
+
+// Set parses the tiers; the names and the CPUs are validated against the topology at startup.
+func (v *cpuTiersValue) Set(s string) error {
+	tiers := make(map[string]string)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tier, cpus, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid value: %q, must be <tier>=<cpuset|coreType>", entry)
+		}
+		tier, cpus = strings.TrimSpace(tier), strings.TrimSpace(cpus)
+		if tier == "" || cpus == "" {
+			return fmt.Errorf("invalid value: %q, must be <tier>=<cpuset|coreType>", entry)
+		}
+		if _, ok := tiers[tier]; ok {
+			return fmt.Errorf("duplicate CPU tier %q", tier)
+		}
+		tiers[tier] = cpus
+	}
+	*v.value = tiers
+	return nil
+}
+
+type featureGatesValue struct {
+	value *map[string]bool
+}
+
+func newFeatureGatesValue(val *map[string]bool) *featureGatesValue {
+	return &featureGatesValue{value: val}
+}
+
+func (v *featureGatesValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	var entries []string
+	for _, name := range slices.Sorted(maps.Keys(*v.value)) {
+		entries = append(entries, fmt.Sprintf("%s=%t", name, (*v.value)[name]))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (v *featureGatesValue) Set(s string) error {
+	gates := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid value: %q, must be <name>=true|false", entry)
+		}
+		name = strings.TrimSpace(name)
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid value for feature gate %q: %q, must be true or false", name, value)
+		}
+		if _, ok := gates[name]; ok {
+			return fmt.Errorf("duplicate feature gate %q", name)
+		}
+		gates[name] = enabled
+	}
+	*v.value = gates
+	return nil
+}
@@ -190,26 +190,36 @@ func createOutputFile(parentDir string, now time.Time, pid int) (*os.File, strin
 }
 
 func collectReport(logger logr.Logger, defaults driverconfig.Config, driverCmdlinePath string) (Report, error) {
+	cpuDetails, err := CollectCPUDetails(logger)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Report{
+		ToolVersion:   readToolVersion(),
+		LayoutVersion: LayoutVersion,
+		CPUDetails:    cpuDetails,
+		DriverConfig:  detectDriverConfig(defaults, driverCmdlinePath),
+	}, nil
+}
+
+// CollectCPUDetails reads the CPU topology of the host.
+func CollectCPUDetails(logger logr.Logger) (CPUDetails, error) {
 	sys := cpuinfo.NewSystemCPUInfo()
 
 	topology, err := sys.GetCPUTopology(logger)
 	if err != nil {
-		return Report{}, fmt.Errorf("failed to get CPU topology: %w", err)
+		return CPUDetails{}, fmt.Errorf("failed to get CPU topology: %w", err)
 	}
 
 	cpus, err := sys.GetCPUInfos(logger)
 	if err != nil {
-		return Report{}, fmt.Errorf("failed to get CPU infos: %w", err)
+		return CPUDetails{}, fmt.Errorf("failed to get CPU infos: %w", err)
 	}
 
-	return Report{
-		ToolVersion:   readToolVersion(),
-		LayoutVersion: LayoutVersion,
-		CPUDetails: CPUDetails{
-			Topology: makeTopologySummary(topology),
-			CPUs:     makeCPUList(cpus),
-		},
-		DriverConfig: detectDriverConfig(defaults, driverCmdlinePath),
+	return CPUDetails{
+		Topology: makeTopologySummary(topology),
+		CPUs:     makeCPUList(cpus),
 	}, nil
 }
 
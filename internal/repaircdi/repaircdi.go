@@ -0,0 +1,172 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repaircdi
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/cli"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/driverconfig"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/driver"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	nodeutil "k8s.io/component-helpers/node/util"
+)
+
+// Options configures the repair of the CDI specs.
+type Options struct {
+	DriverName string
+	// DriverConfig are the defaults of the driver flags, which must be set as for the driver.
+	DriverConfig driverconfig.Config
+	// Out receives the changes of the CDI specs, os.Stdout if nil.
+	Out io.Writer
+	// Output is the format of the changes, text if empty.
+	Output cli.Format
+	// Client and CPUInfoProvider override the API server client built from the flags and the host topology.
+	Client          kubernetes.Interface
+	CPUInfoProvider driver.CPUInfoProvider
+}
+
+// Result are the changes of the CDI specs, printed as JSON or YAML.
+type Result struct {
+	Changes []Change `json:"changes"`
+	// Skipped are the prepared claims whose CDI spec cannot be regenerated, left as they are.
+	Skipped []string `json:"skipped,omitempty"`
+	// Applied is true if the changes were applied, with --apply.
+	Applied bool `json:"applied"`
+}
+
+// Change is a difference between the CDI spec file of a claim and the regenerated one.
+type Change struct {
+	// Action is create, update or delete.
+	Action   string    `json:"action"`
+	ClaimUID types.UID `json:"claimUID"`
+	Path     string    `json:"path"`
+	Diff     string    `json:"diff"`
+}
+
+// Run rebuilds the CDI specs of the claims prepared on the node, printing the changes. They are applied only with --apply.
+func Run(args []string, opts Options, logger logr.Logger) error {
+	cfg := opts.DriverConfig
+	fs := flag.NewFlagSet("dracpu repair-cdi", flag.ExitOnError)
+	cfg.AddFlags(fs)
+	apply := fs.Bool("apply", false, "Apply the changes to the CDI specs. Without it, the changes are only printed")
+	output := cmp.Or(opts.Output, cli.OUTPUT_TEXT)
+	cli.AddOutputFlag(fs, &output)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	nodeName, err := nodeutil.GetHostname(cfg.HostnameOverride)
+	if err != nil {
+		return fmt.Errorf("can not obtain the node name, use the hostname-override flag if you want to set it to a specific value: %w", err)
+	}
+	client := opts.Client
+	if client == nil {
+		if client, err = newClient(cfg.Kubeconfig); err != nil {
+			return err
+		}
+	}
+	cpuInfoProvider := opts.CPUInfoProvider
+	if cpuInfoProvider == nil {
+		cpuInfoProvider = cpuinfo.NewSystemCPUInfo()
+	}
+	out := opts.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	// the same configuration as the driver, so the CPUs and the content of the CDI specs are decided the same way.
+	config, err := cfg.DriverConfig(opts.DriverName, nodeName)
+	if err != nil {
+		return err
+	}
+	ctx := ctxlog.NewContext(context.Background(), logger)
+	plan, err := driver.PlanCDIRepair(ctx, client, config, cpuInfoProvider)
+	if err != nil {
+		return err
+	}
+
+	if output != cli.OUTPUT_TEXT {
+		result := Result{Changes: []Change{}, Applied: *apply && len(plan.Changes) > 0}
+		for _, change := range plan.Changes {
+			result.Changes = append(result.Changes, Change{Action: change.Action, ClaimUID: change.ClaimUID, Path: change.Path, Diff: change.Diff()})
+		}
+		for _, err := range plan.Errors {
+			result.Skipped = append(result.Skipped, err.Error())
+		}
+		if result.Applied {
+			if err := plan.Apply(logger, opts.DriverName); err != nil {
+				return err
+			}
+		}
+		env := &cli.Env{Output: output, Out: out}
+		if err := env.Print(result, nil); err != nil {
+			return err
+		}
+	} else {
+		for _, change := range plan.Changes {
+			fmt.Fprintf(out, "%s %s (claim %s)\n%s\n", change.Action, change.Path, change.ClaimUID, change.Diff())
+		}
+		for _, err := range plan.Errors {
+			fmt.Fprintf(out, "skipped: %v\n", err)
+		}
+		if len(plan.Changes) == 0 {
+			fmt.Fprintln(out, "the CDI specs are consistent with the prepared claims")
+		} else if !*apply {
+			fmt.Fprintf(out, "%d changes not applied, rerun with --apply to apply them\n", len(plan.Changes))
+		} else {
+			if err := plan.Apply(logger, opts.DriverName); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%d changes applied\n", len(plan.Changes))
+		}
+	}
+	if len(plan.Errors) > 0 {
+		return fmt.Errorf("the CDI specs of %d claims could not be regenerated", len(plan.Errors))
+	}
+	return nil
+}
+
+func newClient(kubeconfig string) (kubernetes.Interface, error) {
+	var restConfig *rest.Config
+	var err error
+	if kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not create client-go configuration: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("can not create client-go client: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuinfo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	amdVendorID = "AuthenticAMD"
+
+	// amdFamilyZen is the CPU family of Zen, Zen+ and Zen 2.
+	amdFamilyZen = 0x17
+	// amdFamilyZen3 is the CPU family of Zen 3 and Zen 4.
+	amdFamilyZen3 = 0x19
+)
+
+// readCCXsPerCCD returns how many CCXs, the core complexes sharing an L3 cache, each CCD of the CPUs holds,
+// from the vendor, family and model in /proc/cpuinfo. It returns 0 if the CPUs have no CCDs, or if it can't tell.
+func readCCXsPerCCD(logger logr.Logger) int {
+	lines, err := ReadLines(hostProc("cpuinfo"))
+	if err != nil {
+		logger.V(2).Info("could not read the CPU family, the CCDs are unknown", "err", err)
+		return 0
+	}
+	return ccxsPerCCD(lines)
+}
+
+// ccxsPerCCD returns how many CCXs each CCD holds, given the lines of /proc/cpuinfo. The kernel reports
+// the L3 sharing maps, the CCXs, but no CCD boundary: a CCD holds two CCXs with separate L3 caches on Zen 2
+// (and on the two-CCX dies of Zen and Zen+) and on the Zen 4c dense parts, and a single CCX from Zen 3 on.
+// It returns 0 on the non-AMD CPUs, which have no CCDs.
+func ccxsPerCCD(lines []string) int {
+	var vendor string
+	family, model := -1, -1
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			// the first processor is enough: the CPUs of a node have the same family and model.
+			if vendor != "" && strings.TrimSpace(line) == "" {
+				break
+			}
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "vendor_id":
+			vendor = value
+		case "cpu family":
+			family, _ = strconv.Atoi(value)
+		case "model":
+			model, _ = strconv.Atoi(value)
+		}
+	}
+	if vendor != amdVendorID || family < amdFamilyZen {
+		return 0
+	}
+	switch {
+	case family == amdFamilyZen:
+		return 2
+	case family == amdFamilyZen3 && model >= 0xa0 && model <= 0xaf:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// populateCCDs sets the CCD of the CPUs from their L3 cache ID. The L3 cache IDs are derived from the APIC IDs
+// and the number of CPUs sharing the cache, so the CCXs of a CCD have consecutive IDs, unique across the sockets.
+func populateCCDs(cpuInfos []CPUInfo, ccxsPerCCD int) {
+	if ccxsPerCCD <= 0 {
+		return
+	}
+	for i := range cpuInfos {
+		if cpuInfos[i].UncoreCacheID >= 0 {
+			cpuInfos[i].CCDID = cpuInfos[i].UncoreCacheID / ccxsPerCCD
+		}
+	}
+}
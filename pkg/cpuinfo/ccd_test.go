@@ -0,0 +1,121 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpuinfo
+
+import (
+	"strings"
+	"testing"
+)
+
+func fakeProcCPUInfo(vendor, family, model string) []string {
+	processor := "vendor_id\t: " + vendor + "\ncpu family\t: " + family + "\nmodel\t\t: " + model + "\nmodel name\t: fake\n"
+	return strings.Split("processor\t: 0\n"+processor+"\nprocessor\t: 1\n"+processor, "\n")
+}
+
+func TestCCXsPerCCD(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lines    []string
+		expected int
+	}{
+		{
+			name:     "zen 2 (rome)",
+			lines:    fakeProcCPUInfo("AuthenticAMD", "23", "49"),
+			expected: 2,
+		},
+		{
+			name:     "zen 3 (milan)",
+			lines:    fakeProcCPUInfo("AuthenticAMD", "25", "1"),
+			expected: 1,
+		},
+		{
+			name:     "zen 4c (bergamo)",
+			lines:    fakeProcCPUInfo("AuthenticAMD", "25", "160"),
+			expected: 2,
+		},
+		{
+			name:     "zen 5 (turin)",
+			lines:    fakeProcCPUInfo("AuthenticAMD", "26", "2"),
+			expected: 1,
+		},
+		{
+			name:     "pre-zen AMD",
+			lines:    fakeProcCPUInfo("AuthenticAMD", "21", "2"),
+			expected: 0,
+		},
+		{
+			name:     "intel",
+			lines:    fakeProcCPUInfo("GenuineIntel", "6", "85"),
+			expected: 0,
+		},
+		{
+			name:     "no CPU family (arm64)",
+			lines:    []string{"processor\t: 0", "BogoMIPS\t: 50.00", "CPU implementer\t: 0x41", ""},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ccxsPerCCD(tc.lines); got != tc.expected {
+				t.Errorf("expected %d CCXs per CCD, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPopulateCCDs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		ccxsPerCCD   int
+		expectedCCDs map[int]int
+	}{
+		{
+			name:         "two CCXs per CCD",
+			ccxsPerCCD:   2,
+			expectedCCDs: map[int]int{0: 0, 1: 0, 2: 1, 3: 1, 4: -1},
+		},
+		{
+			name:         "one CCX per CCD",
+			ccxsPerCCD:   1,
+			expectedCCDs: map[int]int{0: 0, 1: 1, 2: 2, 3: 3, 4: -1},
+		},
+		{
+			name:         "no CCDs",
+			ccxsPerCCD:   0,
+			expectedCCDs: map[int]int{0: -1, 1: -1, 2: -1, 3: -1, 4: -1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cpuInfos := []CPUInfo{
+				{CpuID: 0, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, UncoreCacheID: 1, CCDID: -1},
+				{CpuID: 2, UncoreCacheID: 2, CCDID: -1},
+				{CpuID: 3, UncoreCacheID: 3, CCDID: -1},
+				{CpuID: 4, UncoreCacheID: -1, CCDID: -1},
+			}
+			populateCCDs(cpuInfos, tc.ccxsPerCCD)
+			for _, info := range cpuInfos {
+				if info.CCDID != tc.expectedCCDs[info.CpuID] {
+					t.Errorf("cpu %d: expected CCD %d, got %d", info.CpuID, tc.expectedCCDs[info.CpuID], info.CCDID)
+				}
+			}
+		})
+	}
+}
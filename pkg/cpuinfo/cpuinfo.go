@@ -18,6 +18,7 @@ package cpuinfo
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -42,6 +43,314 @@ func OnlineCPUs(logger logr.Logger, sysfs fs.ReadLinkFS) (cpuset.CPUSet, error)
 	return allCPUs, nil
 }
 
+// IsolatedCPUs returns the CPUs the kernel isolates from the scheduler (isolcpus) or runs without the
+// periodic tick (nohz_full). The files missing on the older kernels, or empty, contribute no CPU.
+func IsolatedCPUs(sysfs fs.FS) (cpuset.CPUSet, error) {
+	isolcpus, nohzFull, err := KernelIsolatedCPUs(sysfs)
+	if err != nil {
+		return cpuset.New(), err
+	}
+	return isolcpus.Union(nohzFull), nil
+}
+
+// KernelIsolatedCPUs returns apart the CPUs the kernel isolates from the scheduler (isolcpus) and the CPUs
+// it runs without the periodic tick (nohz_full). The files missing on the older kernels, or empty, list no CPU.
+func KernelIsolatedCPUs(sysfs fs.FS) (isolcpus cpuset.CPUSet, nohzFull cpuset.CPUSet, err error) {
+	isolcpus, err = readKernelCPUList(sysfs, "isolated")
+	if err != nil {
+		return cpuset.New(), cpuset.New(), err
+	}
+	nohzFull, err = readKernelCPUList(sysfs, "nohz_full")
+	if err != nil {
+		return cpuset.New(), cpuset.New(), err
+	}
+	return isolcpus, nohzFull, nil
+}
+
+func readKernelCPUList(sysfs fs.FS, name string) (cpuset.CPUSet, error) {
+	data, err := fs.ReadFile(sysfs, filepath.Join("devices", "system", "cpu", name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cpuset.New(), nil
+	}
+	if err != nil {
+		return cpuset.New(), err
+	}
+	// nohz_full reads "(null)" on the kernels built with NO_HZ_FULL but booted without it.
+	value := strings.TrimSpace(string(data))
+	if value == "" || value == "(null)" {
+		return cpuset.New(), nil
+	}
+	cpus, err := cpuset.Parse(value)
+	if err != nil {
+		return cpuset.New(), fmt.Errorf("failed to parse the %s CPUs %q: %w", name, value, err)
+	}
+	return cpus, nil
+}
+
+// NUMANodeMemTotal returns the memory of the NUMA node in bytes, from the MemTotal line of its meminfo
+// ("Node 0 MemTotal:       65843164 kB"). The memoryless NUMA nodes have no memory.
+func NUMANodeMemTotal(sysfs fs.FS, numaNodeID int) (int64, error) {
+	path := filepath.Join("devices", "system", "node", fmt.Sprintf("node%d", numaNodeID), "meminfo")
+	data, err := fs.ReadFile(sysfs, path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[2] != "MemTotal:" || fields[4] != "kB" {
+			continue
+		}
+		kiB, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse the memory of NUMA node %d %q: %w", numaNodeID, line, err)
+		}
+		return kiB * 1024, nil
+	}
+	return 0, fmt.Errorf("no MemTotal in the meminfo of NUMA node %d", numaNodeID)
+}
+
+// NUMADistances returns the distances between the online NUMA nodes, by NUMA node ID, from their distance file
+// in sysfs ("10 21"): the relative cost of accessing the memory of each node, 10 being the local access. The
+// distance file lists the distances to the online NUMA nodes in order.
+func NUMADistances(sysfs fs.FS) (map[int]map[int]int, error) {
+	data, err := fs.ReadFile(sysfs, filepath.Join("devices", "system", "node", "online"))
+	if err != nil {
+		return nil, err
+	}
+	online, err := cpuset.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the online NUMA nodes %q: %w", strings.TrimSpace(string(data)), err)
+	}
+	nodeIDs := online.List()
+	distances := make(map[int]map[int]int, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		data, err := fs.ReadFile(sysfs, filepath.Join("devices", "system", "node", fmt.Sprintf("node%d", nodeID), "distance"))
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != len(nodeIDs) {
+			return nil, fmt.Errorf("NUMA node %d has %d distances, %d NUMA nodes are online", nodeID, len(fields), len(nodeIDs))
+		}
+		distances[nodeID] = make(map[int]int, len(nodeIDs))
+		for i, field := range fields {
+			distance, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the distances of NUMA node %d: %w", nodeID, err)
+			}
+			distances[nodeID][nodeIDs[i]] = distance
+		}
+	}
+	return distances, nil
+}
+
+// NUMANodeReadBandwidth returns the read bandwidth of the memory of the NUMA node from its local CPUs, in MB/s,
+// from the HMAT of the firmware as reported in sysfs. The nodes whose firmware has no HMAT report none.
+func NUMANodeReadBandwidth(sysfs fs.FS, numaNodeID int) (int64, error) {
+	path := filepath.Join("devices", "system", "node", fmt.Sprintf("node%d", numaNodeID), "access0", "initiators", "read_bandwidth")
+	data, err := fs.ReadFile(sysfs, path)
+	if err != nil {
+		return 0, err
+	}
+	mbps, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the read bandwidth of NUMA node %d: %w", numaNodeID, err)
+	}
+	return mbps, nil
+}
+
+// FrequencyLimits are the frequency limits of a CPU, in kHz, from its cpufreq policy.
+type FrequencyLimits struct {
+	// MaxKHz is the maximum frequency of the CPU (cpuinfo_max_freq).
+	MaxKHz int64
+	// ScalingMaxKHz is the maximum frequency the CPU is currently allowed to run at (scaling_max_freq),
+	// lower than MaxKHz when the frequency is capped, e.g. for power or thermal reasons.
+	ScalingMaxKHz int64
+	// MinKHz is the minimum frequency of the CPU (cpuinfo_min_freq), 0 if unknown.
+	MinKHz int64
+	// BaseKHz is the base, non-turbo, frequency of the CPU (base_frequency), 0 if the cpufreq driver doesn't
+	// report it: only some do, e.g. intel_pstate.
+	BaseKHz int64
+}
+
+// CPUFrequencyLimits returns the frequency limits of the CPUs, by CPU ID. The CPUs without a cpufreq
+// policy, e.g. in the virtual machines without frequency scaling, are left out.
+func CPUFrequencyLimits(sysfs fs.FS, cpus cpuset.CPUSet) (map[int]FrequencyLimits, error) {
+	limits := make(map[int]FrequencyLimits)
+	for _, cpuID := range cpus.List() {
+		dir := filepath.Join("devices", "system", "cpu", fmt.Sprintf("cpu%d", cpuID), "cpufreq")
+		maxKHz, err := readKHz(sysfs, filepath.Join(dir, "cpuinfo_max_freq"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the maximum frequency of CPU %d: %w", cpuID, err)
+		}
+		scalingMaxKHz, err := readKHz(sysfs, filepath.Join(dir, "scaling_max_freq"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the scaling maximum frequency of CPU %d: %w", cpuID, err)
+		}
+		minKHz, err := readOptionalKHz(sysfs, filepath.Join(dir, "cpuinfo_min_freq"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the minimum frequency of CPU %d: %w", cpuID, err)
+		}
+		baseKHz, err := readOptionalKHz(sysfs, filepath.Join(dir, "base_frequency"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the base frequency of CPU %d: %w", cpuID, err)
+		}
+		limits[cpuID] = FrequencyLimits{MaxKHz: maxKHz, ScalingMaxKHz: min(scalingMaxKHz, maxKHz), MinKHz: minKHz, BaseKHz: baseKHz}
+	}
+	return limits, nil
+}
+
+// CPUCapacities returns the capacities of the CPUs, by CPU ID, from their cpu_capacity in sysfs: the
+// performance of each CPU normalized to 1024 for the most performant ones, from the DMIPS of the firmware on
+// the asymmetric systems, e.g. big.LITTLE. The kernels reporting no capacity leave the CPUs out.
+func CPUCapacities(sysfs fs.FS, cpus cpuset.CPUSet) (map[int]int64, error) {
+	capacities := make(map[int]int64)
+	for _, cpuID := range cpus.List() {
+		path := filepath.Join("devices", "system", "cpu", fmt.Sprintf("cpu%d", cpuID), "cpu_capacity")
+		data, err := fs.ReadFile(sysfs, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the capacity of CPU %d: %w", cpuID, err)
+		}
+		capacity, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the capacity of CPU %d: %w", cpuID, err)
+		}
+		capacities[cpuID] = capacity
+	}
+	return capacities, nil
+}
+
+// PerformanceScores returns the relative performance score of the CPUs, by CPU ID: the frequency each CPU
+// is allowed to run at, in percent of the highest maximum frequency of the CPUs. An uncapped CPU of the
+// fastest kind scores 100, and the capped CPUs score lower in proportion to their cap.
+func PerformanceScores(limits map[int]FrequencyLimits) map[int]int64 {
+	var highestKHz int64
+	for _, limit := range limits {
+		highestKHz = max(highestKHz, limit.MaxKHz)
+	}
+	scores := make(map[int]int64, len(limits))
+	if highestKHz <= 0 {
+		return scores
+	}
+	for cpuID, limit := range limits {
+		scores[cpuID] = limit.ScalingMaxKHz * 100 / highestKHz
+	}
+	return scores
+}
+
+// CPUFlags returns the feature flags of the CPUs, by CPU ID, from the cpuinfo file of procfs: the "flags"
+// of the x86 CPUs, or the "Features" of the arm64 ones.
+func CPUFlags(procfs fs.FS) (map[int]sets.Set[string], error) {
+	data, err := fs.ReadFile(procfs, "cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[int]sets.Set[string])
+	cpuID := -1
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			cpuID, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the processor of %q: %w", line, err)
+			}
+		case "flags", "Features":
+			if cpuID < 0 {
+				return nil, fmt.Errorf("the flags %q precede the first processor", line)
+			}
+			flags[cpuID] = sets.New(strings.Fields(value)...)
+		}
+	}
+	return flags, nil
+}
+
+// CPUModel identifies the model of a CPU, from the cpuinfo file of procfs. The family and the stepping are -1
+// if unknown, e.g. on arm64.
+type CPUModel struct {
+	Vendor    string `json:"vendor,omitempty"`
+	ModelName string `json:"modelName,omitempty"`
+	Family    int    `json:"family"`
+	Stepping  int    `json:"stepping"`
+}
+
+// CPUModels returns the models of the CPUs, by CPU ID, from the cpuinfo file of procfs: the "vendor_id",
+// "model name", "cpu family" and "stepping" of the x86 CPUs.
+func CPUModels(procfs fs.FS) (map[int]CPUModel, error) {
+	data, err := fs.ReadFile(procfs, "cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	models := make(map[int]CPUModel)
+	cpuID := -1
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "processor" {
+			cpuID, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the processor of %q: %w", line, err)
+			}
+			models[cpuID] = CPUModel{Family: -1, Stepping: -1}
+			continue
+		}
+		if cpuID < 0 {
+			continue
+		}
+		model := models[cpuID]
+		switch key {
+		case "vendor_id":
+			model.Vendor = value
+		case "model name":
+			model.ModelName = value
+		case "cpu family":
+			model.Family, err = strconv.Atoi(value)
+		case "stepping":
+			model.Stepping, err = strconv.Atoi(value)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the %s of %q: %w", key, line, err)
+		}
+		models[cpuID] = model
+	}
+	return models, nil
+}
+
+// readOptionalKHz reads a frequency the cpufreq drivers may not report, 0 if missing.
+func readOptionalKHz(sysfs fs.FS, path string) (int64, error) {
+	kHz, err := readKHz(sysfs, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return kHz, err
+}
+
+func readKHz(sysfs fs.FS, path string) (int64, error) {
+	data, err := fs.ReadFile(sysfs, path)
+	if err != nil {
+		return 0, err
+	}
+	kHz, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return kHz, nil
+}
+
 // CoreType is an enum for the type of CPU core.
 type CoreType int
 
@@ -110,6 +419,9 @@ type CPUInfo struct {
 	// SocketID is the physical socket ID
 	SocketID int `json:"socketID"`
 
+	// DieID is the die ID, unique within each SocketID. Packages without die topology are a single die.
+	DieID int `json:"dieID"`
+
 	// ClusterID is the cluster ID, which sits between Socket and Core on some architectures (e.g. ARM)
 	ClusterID int `json:"clusterID"`
 
@@ -127,6 +439,13 @@ type CPUInfo struct {
 
 	// UncoreCacheID is the L3 cache ID
 	UncoreCacheID int `json:"uncoreCacheID"`
+
+	// CCDID is the AMD core complex die (CCD) ID, derived from the L3 cache ID, -1 on the other CPUs
+	CCDID int `json:"ccdID"`
+
+	// L2CacheKiB and L3CacheKiB are the sizes of the L2 and L3 caches of the CPU, 0 if unknown.
+	L2CacheKiB int64 `json:"l2CacheKiB,omitempty"`
+	L3CacheKiB int64 `json:"l3CacheKiB,omitempty"`
 }
 
 // CPUTopology contains details of node cpu, where :
@@ -140,6 +459,7 @@ type CPUTopology struct {
 	NumCores       int
 	NumUncoreCache int
 	NumSockets     int
+	NumDies        int
 	NumNUMANodes   int
 	SMTEnabled     bool
 	CPUDetails     CPUDetails
@@ -170,11 +490,17 @@ func (s *SystemCPUInfo) GetCPUTopology(logger logr.Logger) (*CPUTopology, error)
 	}
 	cores := sets.New[coreIdent]()
 	uncoreCaches := sets.NewInt()
+	type dieIdent struct {
+		SocketID int
+		DieID    int
+	}
+	dies := sets.New[dieIdent]()
 
 	for i := range cpuInfos {
 		info := cpuInfos[i]
 		cpuDetails[info.CpuID] = info
 		sockets.Insert(info.SocketID)
+		dies.Insert(dieIdent{SocketID: info.SocketID, DieID: info.DieID})
 		numaNodes.Insert(info.NUMANodeID)
 		// A core is unique by socket, cluster, and core id
 		coreKey := coreIdent{SocketID: info.SocketID, ClusterID: info.ClusterID, CoreID: info.CoreID}
@@ -194,6 +520,7 @@ func (s *SystemCPUInfo) GetCPUTopology(logger logr.Logger) (*CPUTopology, error)
 		NumCPUs:        len(cpuInfos),
 		NumCores:       cores.Len(),
 		NumSockets:     sockets.Len(),
+		NumDies:        dies.Len(),
 		NumNUMANodes:   numaNodes.Len(),
 		NumUncoreCache: uncoreCaches.Len(),
 		SMTEnabled:     smtEnabled,
@@ -251,6 +578,7 @@ func (s *SystemCPUInfo) GetCPUInfos(logger logr.Logger) ([]CPUInfo, error) {
 			NUMANodeID:     -1,
 			NumaNodeCPUSet: cpuset.New(),
 			UncoreCacheID:  -1,
+			CCDID:          -1,
 			SiblingCPUID:   -1,
 			CoreType:       CoreTypeUndefined,
 		}
@@ -274,6 +602,7 @@ func (s *SystemCPUInfo) GetCPUInfos(logger logr.Logger) ([]CPUInfo, error) {
 	}
 
 	populateCpuSiblings(cpuInfos)
+	populateCCDs(cpuInfos, readCCXsPerCCD(logger))
 
 	return cpuInfos, nil
 }
@@ -293,6 +622,19 @@ func populateTopologyInfo(cpuInfo *CPUInfo, logger logr.Logger) error {
 	}
 	cpuInfo.SocketID = socketID
 
+	// Get Die ID from sysfs. Not all architectures and kernels expose it:
+	// if missing, consider the whole socket a single die.
+	diePath := hostSys(fmt.Sprintf("devices/system/cpu/cpu%d/topology/die_id", cpuID))
+	dieStr, err := ReadFile(diePath)
+	if err == nil {
+		dieID, err := strconv.Atoi(strings.TrimSpace(dieStr))
+		if err != nil || dieID < 0 {
+			logger.V(2).Info("could not parse sysfs data", "dieID", dieStr, "cpuID", cpuID, "err", err)
+			dieID = 0
+		}
+		cpuInfo.DieID = dieID
+	}
+
 	// Get Cluster ID from sysfs. While this sysfs file is present on most
 	// architectures, on ARM this defines the physical boundary for shared resources (like L2 cache).
 	clusterPath := hostSys(fmt.Sprintf("devices/system/cpu/cpu%d/topology/cluster_id", cpuID))
@@ -369,7 +711,7 @@ func populateTopologyInfo(cpuInfo *CPUInfo, logger logr.Logger) error {
 		return fmt.Errorf("incomplete topology information for CPU %d (socket: %d, core: %d, NUMA node: %d)", cpuID, cpuInfo.SocketID, cpuInfo.CoreID, cpuInfo.NUMANodeID)
 	}
 
-	// Get L3 Cache ID
+	// Get the L3 cache ID, and the sizes of the L2 and L3 caches
 	cachePath := hostSys(fmt.Sprintf("devices/system/cpu/cpu%d/cache", cpuID))
 	cacheEntries, err := os.ReadDir(cachePath)
 	if err != nil {
@@ -387,10 +729,20 @@ func populateTopologyInfo(cpuInfo *CPUInfo, logger logr.Logger) error {
 			continue
 		}
 
-		// We are only interested in L3 caches
-		if strings.TrimSpace(levelStr) != "3" {
+		// We are only interested in the L2 and L3 caches, the L2 caches only for their size
+		level := strings.TrimSpace(levelStr)
+		if level != "2" && level != "3" {
 			continue
 		}
+		size, err := readCacheKiB(filepath.Join(cachePath, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if level == "2" {
+			cpuInfo.L2CacheKiB = size
+			continue
+		}
+		cpuInfo.L3CacheKiB = size
 
 		l3CacheDir := filepath.Join(cachePath, entry.Name())
 
@@ -423,12 +775,40 @@ func populateTopologyInfo(cpuInfo *CPUInfo, logger logr.Logger) error {
 		}
 
 		cpuInfo.UncoreCacheID = id
-		break
 	}
 
 	return nil
 }
 
+// readCacheKiB reads the size of a cache of a CPU, in KiB, 0 if unknown or if it is an instruction cache.
+func readCacheKiB(cacheDir string) (int64, error) {
+	if cacheType, err := ReadFile(filepath.Join(cacheDir, "type")); err == nil && strings.TrimSpace(cacheType) == "Instruction" {
+		return 0, nil
+	}
+	sizePath := filepath.Join(cacheDir, "size")
+	sizeStr, err := ReadFile(sizePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not read the cache size from %s: %w", sizePath, err)
+	}
+	sizeStr = strings.TrimSpace(sizeStr)
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(sizeStr, "K"):
+		sizeStr = strings.TrimSuffix(sizeStr, "K")
+	case strings.HasSuffix(sizeStr, "M"):
+		sizeStr = strings.TrimSuffix(sizeStr, "M")
+		multiplier = 1024
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the cache size '%s' of %s: %w", sizeStr, sizePath, err)
+	}
+	return size * multiplier, nil
+}
+
 // TODO: Handle more complex sibling relationships (e.g. 4-way SMT) if needed in the future. For now we only handle 2-way hyperthreading which is the most common case.
 func populateCpuSiblings(cpuInfos []CPUInfo) {
 	// Define a key struct to identify a unique physical core.
@@ -494,6 +874,10 @@ func hostSys(combineWith ...string) string {
 	return hostRoot(combinePath("sys", combineWith...))
 }
 
+func hostProc(combineWith ...string) string {
+	return hostRoot(combinePath("proc", combineWith...))
+}
+
 // GetEnv retrieves the environment variable key, or uses the default value.
 func GetEnv(key string, otherwise string, combineWith ...string) string {
 	value := os.Getenv(key)
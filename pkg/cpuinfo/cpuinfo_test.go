@@ -17,7 +17,9 @@ limitations under the License.
 package cpuinfo
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -27,6 +29,7 @@ import (
 	"testing/fstest"
 
 	"github.com/go-logr/logr/testr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/utils/cpuset"
 )
 
@@ -77,6 +80,268 @@ func TestOnlineCPUs(t *testing.T) {
 	}
 }
 
+func TestIsolatedCPUs(t *testing.T) {
+	cpuFile := func(name, data string) (string, *fstest.MapFile) {
+		return filepath.Join("devices", "system", "cpu", name), &fstest.MapFile{Data: []byte(data)}
+	}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "no files",
+			want: "",
+		},
+		{
+			name:  "nothing isolated",
+			files: map[string]string{"isolated": "\n", "nohz_full": "(null)\n"},
+			want:  "",
+		},
+		{
+			name:  "isolcpus and nohz_full",
+			files: map[string]string{"isolated": "2-3\n", "nohz_full": "3-5\n"},
+			want:  "2-5",
+		},
+		{
+			name:    "invalid list",
+			files:   map[string]string{"isolated": "2-\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sysfs := fstest.MapFS{}
+			for name, data := range tt.files {
+				path, file := cpuFile(name, data)
+				sysfs[path] = file
+			}
+			got, err := IsolatedCPUs(sysfs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelIsolatedCPUs(t *testing.T) {
+	sysfs := fstest.MapFS{
+		filepath.Join("devices", "system", "cpu", "isolated"):  &fstest.MapFile{Data: []byte("2-3\n")},
+		filepath.Join("devices", "system", "cpu", "nohz_full"): &fstest.MapFile{Data: []byte("3-5\n")},
+	}
+	isolcpus, nohzFull, err := KernelIsolatedCPUs(sysfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if isolcpus.String() != "2-3" || nohzFull.String() != "3-5" {
+		t.Errorf("got isolcpus %q and nohz_full %q, want \"2-3\" and \"3-5\"", isolcpus.String(), nohzFull.String())
+	}
+}
+
+func TestNUMANodeMemTotal(t *testing.T) {
+	meminfo := func(node int, data string) (string, *fstest.MapFile) {
+		return filepath.Join("devices", "system", "node", fmt.Sprintf("node%d", node), "meminfo"), &fstest.MapFile{Data: []byte(data)}
+	}
+	sysfs := fstest.MapFS{}
+	path, file := meminfo(0, "Node 0 MemTotal:       65843164 kB\nNode 0 MemFree:        60000000 kB\n")
+	sysfs[path] = file
+	path, file = meminfo(1, "Node 1 MemFree:        60000000 kB\n")
+	sysfs[path] = file
+
+	got, err := NUMANodeMemTotal(sysfs, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := int64(65843164 * 1024); got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	if _, err := NUMANodeMemTotal(sysfs, 1); err == nil {
+		t.Error("expected error without MemTotal, got nil")
+	}
+	if _, err := NUMANodeMemTotal(sysfs, 2); err == nil {
+		t.Error("expected error for a missing NUMA node, got nil")
+	}
+}
+
+func TestCPUFrequencyLimits(t *testing.T) {
+	cpufreq := func(sysfs fstest.MapFS, cpuID int, maxKHz, scalingMaxKHz string) {
+		dir := filepath.Join("devices", "system", "cpu", fmt.Sprintf("cpu%d", cpuID), "cpufreq")
+		sysfs[filepath.Join(dir, "cpuinfo_max_freq")] = &fstest.MapFile{Data: []byte(maxKHz + "\n")}
+		sysfs[filepath.Join(dir, "scaling_max_freq")] = &fstest.MapFile{Data: []byte(scalingMaxKHz + "\n")}
+	}
+	sysfs := fstest.MapFS{}
+	// CPUs 0-1 are performance cores, CPU 1 capped at 2GHz; CPU 2 is an efficiency core; CPU 3 has no cpufreq.
+	cpufreq(sysfs, 0, "4000000", "4000000")
+	cpufreq(sysfs, 1, "4000000", "2000000")
+	cpufreq(sysfs, 2, "3000000", "3000000")
+	// CPU 0 reports its minimum and base frequencies.
+	sysfs["devices/system/cpu/cpu0/cpufreq/cpuinfo_min_freq"] = &fstest.MapFile{Data: []byte("800000\n")}
+	sysfs["devices/system/cpu/cpu0/cpufreq/base_frequency"] = &fstest.MapFile{Data: []byte("2100000\n")}
+
+	got, err := CPUFrequencyLimits(sysfs, cpuset.New(0, 1, 2, 3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[int]FrequencyLimits{
+		0: {MaxKHz: 4000000, ScalingMaxKHz: 4000000, MinKHz: 800000, BaseKHz: 2100000},
+		1: {MaxKHz: 4000000, ScalingMaxKHz: 2000000},
+		2: {MaxKHz: 3000000, ScalingMaxKHz: 3000000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if scores, want := PerformanceScores(got), map[int]int64{0: 100, 1: 50, 2: 75}; !reflect.DeepEqual(scores, want) {
+		t.Errorf("got scores %v, want %v", scores, want)
+	}
+	if scores := PerformanceScores(nil); len(scores) != 0 {
+		t.Errorf("got scores %v without cpufreq, want none", scores)
+	}
+
+	cpufreq(sysfs, 3, "4000000", "4000000")
+	sysfs["devices/system/cpu/cpu3/cpufreq/base_frequency"] = &fstest.MapFile{Data: []byte("base\n")}
+	if _, err := CPUFrequencyLimits(sysfs, cpuset.New(3)); err == nil {
+		t.Error("expected error for an invalid base frequency, got nil")
+	}
+
+	cpufreq(sysfs, 4, "4000000", "fast")
+	if _, err := CPUFrequencyLimits(sysfs, cpuset.New(4)); err == nil {
+		t.Error("expected error for an invalid frequency, got nil")
+	}
+}
+
+func TestCPUFlags(t *testing.T) {
+	procfs := fstest.MapFS{"cpuinfo": &fstest.MapFile{Data: []byte(`processor	: 0
+vendor_id	: GenuineIntel
+flags		: fpu sse4_1 sse4_2 avx512f amx_tile
+
+processor	: 1
+vendor_id	: GenuineIntel
+flags		: fpu sse4_1 sse4_2
+
+processor	: 2
+BogoMIPS	: 50.00
+Features	: fp asimd sve
+`)}}
+	got, err := CPUFlags(procfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[int][]string{
+		0: {"amx_tile", "avx512f", "fpu", "sse4_1", "sse4_2"},
+		1: {"fpu", "sse4_1", "sse4_2"},
+		2: {"asimd", "fp", "sve"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got flags of %d CPUs, want %d", len(got), len(want))
+	}
+	for cpuID, flags := range want {
+		if !reflect.DeepEqual(sets.List(got[cpuID]), flags) {
+			t.Errorf("CPU %d: got flags %v, want %v", cpuID, sets.List(got[cpuID]), flags)
+		}
+	}
+
+	if _, err := CPUFlags(fstest.MapFS{}); err == nil {
+		t.Error("expected error for a missing cpuinfo, got nil")
+	}
+	procfs["cpuinfo"] = &fstest.MapFile{Data: []byte("processor\t: zero\nflags\t: fpu\n")}
+	if _, err := CPUFlags(procfs); err == nil {
+		t.Error("expected error for an invalid processor, got nil")
+	}
+}
+
+func TestCPUModels(t *testing.T) {
+	procfs := fstest.MapFS{"cpuinfo": &fstest.MapFile{Data: []byte(`processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 143
+model name	: Intel(R) Xeon(R) Platinum 8480+
+stepping	: 8
+
+processor	: 1
+BogoMIPS	: 50.00
+Features	: fp asimd sve
+`)}}
+	got, err := CPUModels(procfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[int]CPUModel{
+		0: {Vendor: "GenuineIntel", ModelName: "Intel(R) Xeon(R) Platinum 8480+", Family: 6, Stepping: 8},
+		1: {Family: -1, Stepping: -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got models %+v, want %+v", got, want)
+	}
+
+	if _, err := CPUModels(fstest.MapFS{}); err == nil {
+		t.Error("expected error for a missing cpuinfo, got nil")
+	}
+	procfs["cpuinfo"] = &fstest.MapFile{Data: []byte("processor\t: 0\ncpu family\t: six\n")}
+	if _, err := CPUModels(procfs); err == nil {
+		t.Error("expected error for an invalid family, got nil")
+	}
+}
+
+func TestNUMANodeReadBandwidth(t *testing.T) {
+	path := filepath.Join("devices", "system", "node", "node1", "access0", "initiators", "read_bandwidth")
+	sysfs := fstest.MapFS{path: &fstest.MapFile{Data: []byte("262144\n")}}
+	got, err := NUMANodeReadBandwidth(sysfs, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 262144 {
+		t.Errorf("got %d MB/s, want 262144", got)
+	}
+	if _, err := NUMANodeReadBandwidth(sysfs, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing bandwidth, got %v", err)
+	}
+	sysfs[path] = &fstest.MapFile{Data: []byte("fast\n")}
+	if _, err := NUMANodeReadBandwidth(sysfs, 1); err == nil {
+		t.Error("expected error for an invalid bandwidth, got nil")
+	}
+}
+
+func TestNUMADistances(t *testing.T) {
+	nodeDir := filepath.Join("devices", "system", "node")
+	sysfs := fstest.MapFS{
+		filepath.Join(nodeDir, "online"):            &fstest.MapFile{Data: []byte("0-1,3\n")},
+		filepath.Join(nodeDir, "node0", "distance"): &fstest.MapFile{Data: []byte("10 21 32\n")},
+		filepath.Join(nodeDir, "node1", "distance"): &fstest.MapFile{Data: []byte("21 10 21\n")},
+		filepath.Join(nodeDir, "node3", "distance"): &fstest.MapFile{Data: []byte("32 21 10\n")},
+	}
+	got, err := NUMADistances(sysfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[int]map[int]int{
+		0: {0: 10, 1: 21, 3: 32},
+		1: {0: 21, 1: 10, 3: 21},
+		3: {0: 32, 1: 21, 3: 10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got distances %v, want %v", got, want)
+	}
+
+	if _, err := NUMADistances(fstest.MapFS{}); err == nil {
+		t.Error("expected error for missing online NUMA nodes, got nil")
+	}
+	sysfs[filepath.Join(nodeDir, "node3", "distance")] = &fstest.MapFile{Data: []byte("32 21\n")}
+	if _, err := NUMADistances(sysfs); err == nil {
+		t.Error("expected error for missing distances, got nil")
+	}
+}
+
 func TestPopulateCpuSiblings(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -126,6 +391,7 @@ type fakeCPUTopology struct {
 	cpusPerCore           int
 	coresPerL3            int
 	numClustersPerSocket  int // Needed for ARM support
+	numDiesPerSocket      int
 	hybrid                bool
 	eCores                string
 }
@@ -188,6 +454,12 @@ func createFakeCPUTopology(t *testing.T, dir string, topo fakeCPUTopology) {
 		if err := os.WriteFile(filepath.Join(topologyDir, "core_id"), []byte(fmt.Sprintf("%d\n", coreID)), 0600); err != nil {
 			t.Fatal(err)
 		}
+		if topo.numDiesPerSocket > 0 {
+			dieID := coreID / (coresPerSocket / topo.numDiesPerSocket)
+			if err := os.WriteFile(filepath.Join(topologyDir, "die_id"), []byte(fmt.Sprintf("%d\n", dieID)), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
 		if topo.numClustersPerSocket > 1 {
 			clusterID := (i / topo.cpusPerCore) / (coresPerSocket / topo.numClustersPerSocket) % topo.numClustersPerSocket
 			if err := os.WriteFile(filepath.Join(topologyDir, "cluster_id"), []byte(fmt.Sprintf("%d\n", clusterID)), 0600); err != nil {
@@ -264,10 +536,10 @@ func TestGetCPUInfos(t *testing.T) {
 				hybrid:                false,
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 2, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 3, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 2, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 0, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 3, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 2, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 3, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 2, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 0, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 3, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 		{
@@ -281,8 +553,8 @@ func TestGetCPUInfos(t *testing.T) {
 				hybrid:                false,
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 		{
@@ -296,14 +568,14 @@ func TestGetCPUInfos(t *testing.T) {
 				hybrid:                false,
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 2, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 3, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 2, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 0, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 3, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 4, CoreID: 0, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 6, CoreType: CoreTypeStandard, UncoreCacheID: 1},
-				{CpuID: 5, CoreID: 1, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 7, CoreType: CoreTypeStandard, UncoreCacheID: 1},
-				{CpuID: 6, CoreID: 0, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 4, CoreType: CoreTypeStandard, UncoreCacheID: 1},
-				{CpuID: 7, CoreID: 1, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 5, CoreType: CoreTypeStandard, UncoreCacheID: 1},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 2, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 3, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 2, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 0, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 3, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: 1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 4, CoreID: 0, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 6, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
+				{CpuID: 5, CoreID: 1, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 7, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
+				{CpuID: 6, CoreID: 0, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 4, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
+				{CpuID: 7, CoreID: 1, SocketID: 1, ClusterID: -1, NUMANodeID: 1, NumaNodeCPUSet: cpuset.New(4, 5, 6, 7), SiblingCPUID: 5, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
 			},
 		},
 		{
@@ -318,10 +590,10 @@ func TestGetCPUInfos(t *testing.T) {
 				eCores:                "2,3",
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0},
-				{CpuID: 2, CoreID: 2, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeEfficiency, UncoreCacheID: 0},
-				{CpuID: 3, CoreID: 3, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeEfficiency, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 2, CoreID: 2, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeEfficiency, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 3, CoreID: 3, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeEfficiency, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 		{
@@ -336,8 +608,8 @@ func TestGetCPUInfos(t *testing.T) {
 				eCores:                "",
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1), SiblingCPUID: -1, CoreType: CoreTypePerformance, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 		{
@@ -352,10 +624,28 @@ func TestGetCPUInfos(t *testing.T) {
 				hybrid:                false,
 			},
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: 0, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: 0, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 2, CoreID: 2, SocketID: 0, ClusterID: 1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
-				{CpuID: 3, CoreID: 3, SocketID: 0, ClusterID: 1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: 0, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: 0, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 2, CoreID: 2, SocketID: 0, ClusterID: 1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 3, CoreID: 3, SocketID: 0, ClusterID: 1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+			},
+		},
+		{
+			name: "multi-die package",
+			topology: fakeCPUTopology{
+				numSockets:            1,
+				numNumaNodesPerSocket: 1,
+				numCoresPerNumaNode:   4,
+				cpusPerCore:           1,
+				coresPerL3:            2,
+				numDiesPerSocket:      2,
+				hybrid:                false,
+			},
+			expectedInfos: []CPUInfo{
+				{CpuID: 0, CoreID: 0, SocketID: 0, DieID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 1, CoreID: 1, SocketID: 0, DieID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+				{CpuID: 2, CoreID: 2, SocketID: 0, DieID: 1, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
+				{CpuID: 3, CoreID: 3, SocketID: 0, DieID: 1, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0, 1, 2, 3), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 1, CCDID: -1},
 			},
 		},
 	}
@@ -418,7 +708,7 @@ func TestGetCPUInfos_ErrorScenarios(t *testing.T) {
 			},
 			expectedErrorSubstring: "", // Should warn and continue
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 		{
@@ -450,8 +740,40 @@ func TestGetCPUInfos_ErrorScenarios(t *testing.T) {
 			},
 			expectedErrorSubstring: "", // Should succeed with synthetic ID
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
+			},
+		},
+		{
+			name: "cache sizes",
+			setup: func(t *testing.T, dir string) {
+				cacheDir := filepath.Join(dir, "sys/devices/system/cpu/cpu0/cache")
+				for file, content := range map[string]string{
+					"index0/level": "1\n", "index0/type": "Data\n", "index0/size": "48K\n",
+					"index2/level": "2\n", "index2/type": "Unified\n", "index2/size": "2048K\n",
+					"index3/type": "Unified\n", "index3/size": "32M\n",
+				} {
+					if err := os.MkdirAll(filepath.Dir(filepath.Join(cacheDir, file)), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(filepath.Join(cacheDir, file), []byte(content), 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			expectedErrorSubstring: "",
+			expectedInfos: []CPUInfo{
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1, L2CacheKiB: 2048, L3CacheKiB: 32768},
+			},
+		},
+		{
+			name: "invalid cache size",
+			setup: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "sys/devices/system/cpu/cpu0/cache/index3/size"), []byte("large\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
 			},
+			expectedErrorSubstring: "",          // Should warn and skip CPU
+			expectedInfos:          []CPUInfo{}, // CPU gets skipped
 		},
 		{
 			name: "x86 cluster_id 65535 fallback",
@@ -462,7 +784,7 @@ func TestGetCPUInfos_ErrorScenarios(t *testing.T) {
 			},
 			expectedErrorSubstring: "", // Should succeed and map 65535 to -1
 			expectedInfos: []CPUInfo{
-				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0},
+				{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: -1, NUMANodeID: 0, NumaNodeCPUSet: cpuset.New(0), SiblingCPUID: -1, CoreType: CoreTypeStandard, UncoreCacheID: 0, CCDID: -1},
 			},
 		},
 	}
@@ -660,3 +982,24 @@ func TestGetCPUTopology(t *testing.T) {
 		})
 	}
 }
+
+func TestCPUCapacities(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"devices/system/cpu/cpu0/cpu_capacity": &fstest.MapFile{Data: []byte("1024\n")},
+		"devices/system/cpu/cpu1/cpu_capacity": &fstest.MapFile{Data: []byte("1024\n")},
+		"devices/system/cpu/cpu2/cpu_capacity": &fstest.MapFile{Data: []byte("446\n")},
+	}
+	// CPU 3 reports no capacity.
+	got, err := CPUCapacities(sysfs, cpuset.New(0, 1, 2, 3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[int]int64{0: 1024, 1: 1024, 2: 446}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	sysfs["devices/system/cpu/cpu3/cpu_capacity"] = &fstest.MapFile{Data: []byte("big\n")}
+	if _, err := CPUCapacities(sysfs, cpuset.New(3)); err == nil {
+		t.Error("expected error for an invalid capacity, got nil")
+	}
+}
@@ -48,6 +48,50 @@ func (d CPUDetails) CPUs() cpuset.CPUSet {
 	return cpuset.New(cpuIDs...)
 }
 
+// Cores returns all of the core IDs associated with the CPUs in this
+// CPUDetails.
+func (d CPUDetails) Cores() cpuset.CPUSet {
+	var coreIDs []int
+	for _, info := range d {
+		coreIDs = append(coreIDs, info.CoreID)
+	}
+	return cpuset.New(coreIDs...)
+}
+
+// UncoreCaches returns all of the uncore cache IDs associated with the CPUs in
+// this CPUDetails.
+func (d CPUDetails) UncoreCaches() cpuset.CPUSet {
+	var uncoreCacheIDs []int
+	for _, info := range d {
+		uncoreCacheIDs = append(uncoreCacheIDs, info.UncoreCacheID)
+	}
+	return cpuset.New(uncoreCacheIDs...)
+}
+
+// CCDs returns all of the AMD CCD IDs associated with the CPUs in this CPUDetails,
+// -1 for the CPUs without a CCD.
+func (d CPUDetails) CCDs() cpuset.CPUSet {
+	var ccdIDs []int
+	for _, info := range d {
+		ccdIDs = append(ccdIDs, info.CCDID)
+	}
+	return cpuset.New(ccdIDs...)
+}
+
+// CPUsInCCDs returns all of the logical CPU IDs associated with the given
+// CCD IDs in this CPUDetails.
+func (d CPUDetails) CPUsInCCDs(ids ...int) cpuset.CPUSet {
+	var cpuIDs []int
+	for _, id := range ids {
+		for cpu, info := range d {
+			if info.CCDID == id {
+				cpuIDs = append(cpuIDs, cpu)
+			}
+		}
+	}
+	return cpuset.New(cpuIDs...)
+}
+
 // CPUsInNUMANodes returns all of the logical CPU IDs associated with the given
 // NUMANode IDs in this CPUDetails.
 func (d CPUDetails) CPUsInNUMANodes(ids ...int) cpuset.CPUSet {
@@ -170,6 +214,58 @@ func (d CPUDetails) CoresInSockets(ids ...int) cpuset.CPUSet {
 	return cpuset.New(coreIDs...)
 }
 
+// DiesInSockets returns all of the die IDs associated with the given socket
+// IDs in this CPUDetails. Die IDs are unique only within a socket.
+func (d CPUDetails) DiesInSockets(ids ...int) cpuset.CPUSet {
+	var dieIDs []int
+	for _, id := range ids {
+		for _, info := range d {
+			if info.SocketID == id {
+				dieIDs = append(dieIDs, info.DieID)
+			}
+		}
+	}
+	return cpuset.New(dieIDs...)
+}
+
+// CPUsInDie returns all of the logical CPU IDs associated with the given die
+// of the given socket in this CPUDetails.
+func (d CPUDetails) CPUsInDie(socketID, dieID int) cpuset.CPUSet {
+	var cpuIDs []int
+	for cpu, info := range d {
+		if info.SocketID == socketID && info.DieID == dieID {
+			cpuIDs = append(cpuIDs, cpu)
+		}
+	}
+	return cpuset.New(cpuIDs...)
+}
+
+// ClustersInSockets returns all of the cluster IDs associated with the given socket
+// IDs in this CPUDetails. Cluster IDs are unique only within a socket, and -1 if unknown.
+func (d CPUDetails) ClustersInSockets(ids ...int) cpuset.CPUSet {
+	var clusterIDs []int
+	for _, id := range ids {
+		for _, info := range d {
+			if info.SocketID == id {
+				clusterIDs = append(clusterIDs, info.ClusterID)
+			}
+		}
+	}
+	return cpuset.New(clusterIDs...)
+}
+
+// CPUsInCluster returns all of the logical CPU IDs associated with the given cluster
+// of the given socket in this CPUDetails.
+func (d CPUDetails) CPUsInCluster(socketID, clusterID int) cpuset.CPUSet {
+	var cpuIDs []int
+	for cpu, info := range d {
+		if info.SocketID == socketID && info.ClusterID == clusterID {
+			cpuIDs = append(cpuIDs, cpu)
+		}
+	}
+	return cpuset.New(cpuIDs...)
+}
+
 // NUMANodesInSockets returns all of the logical NUMANode IDs associated with
 // the given socket IDs in this CPUDetails.
 func (d CPUDetails) NUMANodesInSockets(ids ...int) cpuset.CPUSet {
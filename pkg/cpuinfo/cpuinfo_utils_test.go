@@ -81,6 +81,57 @@ func TestCPUs(t *testing.T) {
 	assert.True(t, cpuset.New(0, 1, 2, 3, 4, 5, 6, 7).Equals(testCPUDetails.CPUs()))
 }
 
+func TestCores(t *testing.T) {
+	assert.True(t, cpuset.New(0, 1, 2, 3).Equals(testCPUDetails.Cores()))
+	assert.True(t, cpuset.New(2).Equals(testCPUDetails.KeepOnly(cpuset.New(4, 5)).Cores()))
+}
+
+func TestUncoreCaches(t *testing.T) {
+	assert.True(t, cpuset.New(0, 1).Equals(testCPUDetails.UncoreCaches()))
+	assert.True(t, cpuset.New(1).Equals(testCPUDetails.KeepOnly(cpuset.New(6)).UncoreCaches()))
+}
+
+func TestDiesInSockets(t *testing.T) {
+	details := CPUDetails{
+		0: {CpuID: 0, SocketID: 0, DieID: 0},
+		1: {CpuID: 1, SocketID: 0, DieID: 1},
+		2: {CpuID: 2, SocketID: 1, DieID: 0},
+		3: {CpuID: 3, SocketID: 1, DieID: 1},
+	}
+	assert.True(t, cpuset.New(0, 1).Equals(details.DiesInSockets(0)))
+	assert.True(t, cpuset.New().Equals(details.DiesInSockets(2)))
+	assert.True(t, cpuset.New(1).Equals(details.CPUsInDie(0, 1)))
+	assert.True(t, cpuset.New(2).Equals(details.CPUsInDie(1, 0)))
+	assert.True(t, cpuset.New().Equals(details.CPUsInDie(2, 0)))
+}
+
+func TestClustersInSockets(t *testing.T) {
+	details := CPUDetails{
+		0: {CpuID: 0, SocketID: 0, ClusterID: 0},
+		1: {CpuID: 1, SocketID: 0, ClusterID: 1},
+		2: {CpuID: 2, SocketID: 1, ClusterID: 0},
+		3: {CpuID: 3, SocketID: 1, ClusterID: -1},
+	}
+	assert.True(t, cpuset.New(0, 1).Equals(details.ClustersInSockets(0)))
+	assert.True(t, cpuset.New(-1, 0).Equals(details.ClustersInSockets(1)))
+	assert.True(t, cpuset.New(1).Equals(details.CPUsInCluster(0, 1)))
+	assert.True(t, cpuset.New(3).Equals(details.CPUsInCluster(1, -1)))
+	assert.True(t, cpuset.New().Equals(details.CPUsInCluster(2, 0)))
+}
+
+func TestCCDs(t *testing.T) {
+	details := CPUDetails{
+		0: {CpuID: 0, UncoreCacheID: 0, CCDID: 0},
+		1: {CpuID: 1, UncoreCacheID: 1, CCDID: 0},
+		2: {CpuID: 2, UncoreCacheID: 2, CCDID: 1},
+		3: {CpuID: 3, UncoreCacheID: -1, CCDID: -1},
+	}
+	assert.True(t, cpuset.New(-1, 0, 1).Equals(details.CCDs()))
+	assert.True(t, cpuset.New(0, 1).Equals(details.CPUsInCCDs(0)))
+	assert.True(t, cpuset.New(0, 1, 2).Equals(details.CPUsInCCDs(0, 1)))
+	assert.True(t, cpuset.New().Equals(details.CPUsInCCDs(2)))
+}
+
 func TestCPUsInNUMANodes(t *testing.T) {
 	assert.True(t, cpuset.New(0, 1, 2, 3).Equals(testCPUDetails.CPUsInNUMANodes(0)))
 	assert.True(t, cpuset.New(4, 5, 6, 7).Equals(testCPUDetails.CPUsInNUMANodes(1)))
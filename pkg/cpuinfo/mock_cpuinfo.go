@@ -34,6 +34,7 @@ func (m *MockCPUInfoProvider) GetCPUInfos(_ logr.Logger) ([]CPUInfo, error) {
 func (m *MockCPUInfoProvider) GetCPUTopology(_ logr.Logger) (*CPUTopology, error) {
 	cpuDetails := make(CPUDetails)
 	sockets := make(map[int]struct{})
+	dies := make(map[string]struct{})
 	numaNodes := make(map[int]struct{})
 	cores := make(map[string]struct{})
 	uncoreCaches := make(map[int]struct{})
@@ -42,6 +43,7 @@ func (m *MockCPUInfoProvider) GetCPUTopology(_ logr.Logger) (*CPUTopology, error
 		info := m.CPUInfos[i]
 		cpuDetails[info.CpuID] = info
 		sockets[info.SocketID] = struct{}{}
+		dies[fmt.Sprintf("%d-%d", info.SocketID, info.DieID)] = struct{}{}
 		numaNodes[info.NUMANodeID] = struct{}{}
 		// A core is unique by socket and core id
 		coreKey := fmt.Sprintf("%d-%d", info.SocketID, info.CoreID)
@@ -55,6 +57,7 @@ func (m *MockCPUInfoProvider) GetCPUTopology(_ logr.Logger) (*CPUTopology, error
 		NumCPUs:        len(m.CPUInfos),
 		NumCores:       len(cores),
 		NumSockets:     len(sockets),
+		NumDies:        len(dies),
 		NumNUMANodes:   len(numaNodes),
 		NumUncoreCache: len(uncoreCaches),
 		CPUDetails:     cpuDetails,
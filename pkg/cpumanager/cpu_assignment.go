@@ -566,6 +566,12 @@ func (a *cpuAccumulator) takeFullUncore() {
 }
 
 func (a *cpuAccumulator) takePartialUncore(uncoreID int) {
+	// NOTE: differently from the kubelet, an odd request takes its remainder from a core already broken by the
+	// other allocations, if the UncoreCache has one, instead of breaking one of the free cores.
+	if a.takePartialUncoreFromBrokenCores(uncoreID) {
+		return
+	}
+
 	// determine the number of cores needed whether SMT/hyperthread is enabled or disabled
 	numCoresNeeded := (a.numCPUsNeeded + a.topo.CPUsPerCore() - 1) / a.topo.CPUsPerCore()
 
@@ -605,6 +611,48 @@ func (a *cpuAccumulator) takePartialUncore(uncoreID int) {
 	a.take(freeCPUs)
 }
 
+// takePartialUncoreFromBrokenCores claims the CPUs needed within the UncoreCache taking the remainder of a
+// request which is not a multiple of the threads of a core from a broken core, one with some of its CPUs
+// unavailable, e.g. allocated to other claims, and the rest as whole free cores. The broken core with the
+// fewest available CPUs fitting the remainder wins, to keep the others for the next odd requests.
+// Returns false, claiming nothing, without SMT, for an even request, or if the UncoreCache can't satisfy
+// the request this way.
+func (a *cpuAccumulator) takePartialUncoreFromBrokenCores(uncoreID int) bool {
+	cpusPerCore := a.topo.CPUsPerCore()
+	remainder := a.numCPUsNeeded % cpusPerCore
+	if cpusPerCore < 2 || remainder == 0 {
+		return false
+	}
+
+	// the core IDs are unique within a socket only, so the cores are looked up within the UncoreCache.
+	uncoreDetails := a.details.KeepOnly(a.details.CPUsInUncoreCaches(uncoreID))
+	uncoreTopoDetails := a.topo.CPUDetails.KeepOnly(a.topo.CPUDetails.CPUsInUncoreCaches(uncoreID))
+	var brokenCores, freeCores []int
+	for _, core := range uncoreDetails.Cores().List() {
+		available := uncoreDetails.CPUsInCores(core).Size()
+		if available == uncoreTopoDetails.CPUsInCores(core).Size() {
+			freeCores = append(freeCores, core)
+		} else if available >= remainder {
+			brokenCores = append(brokenCores, core)
+		}
+	}
+	numFreeCoresNeeded := a.numCPUsNeeded / cpusPerCore
+	if len(brokenCores) == 0 || len(freeCores) < numFreeCoresNeeded {
+		return false
+	}
+	a.sort(brokenCores, uncoreDetails.CPUsInCores)
+
+	cpus := cpuset.New(uncoreDetails.CPUsInCores(brokenCores[0]).List()[:remainder]...)
+	cpus = cpus.Union(uncoreDetails.CPUsInCores(freeCores[:numFreeCoresNeeded]...))
+	a.logger.V(4).Info("takePartialUncore: claiming the remainder from a broken core",
+		"uncore", uncoreID,
+		"needed", a.numCPUsNeeded,
+		"brokenCore", brokenCores[0],
+		"cpus", cpus.String())
+	a.take(cpus)
+	return true
+}
+
 // First try to take full UncoreCache, if available and need is at least the size of the UncoreCache group.
 // Second try to take the partial UncoreCache if available and the request size can fit w/in the UncoreCache.
 func (a *cpuAccumulator) takeUncoreCache() {
@@ -828,7 +876,7 @@ func TakeByTopologyNUMAPacked(logger logr.Logger, topo *topology.CPUTopology, av
 	return cpuset.New(), fmt.Errorf("failed to allocate cpus")
 }
 
-// takeByTopologyNUMADistributed returns a CPUSet of size 'numCPUs'.
+// TakeByTopologyNUMADistributed returns a CPUSet of size 'numCPUs'.
 //
 // It generates this CPUset by allocating CPUs from 'availableCPUs' according
 // to the algorithm outlined in KEP-2902:
@@ -891,7 +939,7 @@ func TakeByTopologyNUMAPacked(logger logr.Logger, topo *topology.CPUTopology, av
 // of size 'cpuGroupSize' according to the algorithm described above. This is
 // important, for example, to ensure that all CPUs (i.e. all hyperthreads) from
 // a single core are allocated together.
-func takeByTopologyNUMADistributed(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, cpuGroupSize int, cpuSortingStrategy CPUSortingStrategy) (cpuset.CPUSet, error) {
+func TakeByTopologyNUMADistributed(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, cpuGroupSize int, cpuSortingStrategy CPUSortingStrategy) (cpuset.CPUSet, error) {
 	// If the number of CPUs requested cannot be handed out in chunks of
 	// 'cpuGroupSize', then we just call out the packing algorithm since we
 	// can't distribute CPUs in this chunk size.
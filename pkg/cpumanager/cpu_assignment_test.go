@@ -767,6 +767,26 @@ func TestTakeByTopologyNUMAPacked(t *testing.T) {
 			"",
 			mustParseCPUSet(t, "4-7,12-15,1,9"),
 		},
+		// NOTE: the following test cases are specific to this codebase, which takes the remainder of the odd requests
+		// from the broken cores.
+		{
+			"take one cpu from the broken core of the UncoreCache - SMT enabled",
+			topoUncoreSingleSocketSMT,
+			StaticPolicyOptions{PreferAlignByUncoreCacheOption: true},
+			mustParseCPUSet(t, "0-8,10-15"),
+			1,
+			"",
+			cpuset.New(1),
+		},
+		{
+			"take the remainder of an odd request from the broken core of the UncoreCache - SMT enabled",
+			topoUncoreSingleSocketSMT,
+			StaticPolicyOptions{PreferAlignByUncoreCacheOption: true},
+			mustParseCPUSet(t, "0-7,9-15"),
+			3,
+			"",
+			cpuset.New(0, 1, 9),
+		},
 	}...)
 
 	for _, tc := range testCases {
@@ -1072,7 +1092,7 @@ func TestTakeByTopologyNUMADistributed(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
-			result, err := takeByTopologyNUMADistributed(logger, tc.topo, tc.availableCPUs, tc.numCPUs, tc.cpuGroupSize, CPUSortingStrategyPacked)
+			result, err := TakeByTopologyNUMADistributed(logger, tc.topo, tc.availableCPUs, tc.numCPUs, tc.cpuGroupSize, CPUSortingStrategyPacked)
 			if err != nil {
 				if tc.expErr == "" {
 					t.Errorf("unexpected error [%v]", err)
@@ -0,0 +1,103 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpumanager
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/go-logr/logr"
+	topology "github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// PolicyNUMAPacked packs the CPUs in as few NUMA nodes, sockets, uncore caches and cores as possible,
+	// as the static policy of the kubelet cpumanager.
+	PolicyNUMAPacked = "numa-packed"
+	// PolicyNUMADistributed spreads the CPUs evenly across the NUMA nodes when more than one is needed, in
+	// chunks of whole cores, as the distribute-cpus-across-numa option of the kubelet cpumanager.
+	PolicyNUMADistributed = "numa-distributed"
+)
+
+// PolicyOptions are the driver options the policies are expected to honor.
+type PolicyOptions struct {
+	// CPUSortingStrategy is how the CPUs are picked within the NUMA nodes and sockets.
+	CPUSortingStrategy CPUSortingStrategy
+	// PreferAlignByUncoreCache allocates the CPUs from as few uncore caches as possible.
+	PreferAlignByUncoreCache bool
+}
+
+// Policy picks numCPUs CPUs among the available CPUs of the topology.
+type Policy interface {
+	Allocate(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error)
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error)
+
+// Allocate calls f.
+func (f PolicyFunc) Allocate(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error) {
+	return f(logger, topo, availableCPUs, numCPUs, opts)
+}
+
+var (
+	policiesLock sync.RWMutex
+	// policies are the allocation policies by name, the builtin ones and the ones registered by the
+	// packages compiled into the driver.
+	policies = map[string]Policy{
+		PolicyNUMAPacked: PolicyFunc(func(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error) {
+			return TakeByTopologyNUMAPacked(logger, topo, availableCPUs, numCPUs, opts.CPUSortingStrategy, opts.PreferAlignByUncoreCache)
+		}),
+		PolicyNUMADistributed: PolicyFunc(func(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error) {
+			return TakeByTopologyNUMADistributed(logger, topo, availableCPUs, numCPUs, topo.CPUsPerCore(), opts.CPUSortingStrategy)
+		}),
+	}
+)
+
+// RegisterPolicy makes a custom allocation policy available by name, so the driver can select it by
+// configuration. It is meant to be called from the init function of the package implementing the policy.
+// Returns an error if the name is empty or already registered.
+func RegisterPolicy(name string, policy Policy) error {
+	if name == "" || policy == nil {
+		return fmt.Errorf("an allocation policy needs a name and an implementation")
+	}
+	policiesLock.Lock()
+	defer policiesLock.Unlock()
+	if _, ok := policies[name]; ok {
+		return fmt.Errorf("allocation policy %q already registered", name)
+	}
+	policies[name] = policy
+	return nil
+}
+
+// LookupPolicy returns the allocation policy registered with the given name.
+func LookupPolicy(name string) (Policy, bool) {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	policy, ok := policies[name]
+	return policy, ok
+}
+
+// PolicyNames returns the names of the registered allocation policies, sorted.
+func PolicyNames() []string {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	return slices.Sorted(maps.Keys(policies))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpumanager
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	topology "github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/cpuset"
+)
+
+func TestBuiltinPolicies(t *testing.T) {
+	logger := klog.Background()
+	opts := PolicyOptions{CPUSortingStrategy: CPUSortingStrategyPacked}
+
+	packed, ok := LookupPolicy(PolicyNUMAPacked)
+	if !ok {
+		t.Fatalf("policy %q not registered", PolicyNUMAPacked)
+	}
+	result, err := packed.Allocate(logger, topoDualSocketHT, topoDualSocketHT.CPUDetails.CPUs(), 4, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := cpuset.New(0, 2, 6, 8); !result.Equals(expected) {
+		t.Errorf("expected %s from %q, got %s", expected, PolicyNUMAPacked, result)
+	}
+
+	// 8 CPUs fit no NUMA node: they are split evenly, in whole cores.
+	distributed, ok := LookupPolicy(PolicyNUMADistributed)
+	if !ok {
+		t.Fatalf("policy %q not registered", PolicyNUMADistributed)
+	}
+	result, err = distributed.Allocate(logger, topoDualSocketHT, topoDualSocketHT.CPUDetails.CPUs(), 8, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size := result.Intersection(topoDualSocketHT.CPUDetails.CPUsInNUMANodes(0)).Size(); size != 4 {
+		t.Errorf("expected 4 CPUs of NUMA node 0 from %q, got %s", PolicyNUMADistributed, result)
+	}
+}
+
+func TestRegisterPolicy(t *testing.T) {
+	name := "test-lowest-ids"
+	lowest := PolicyFunc(func(logger logr.Logger, topo *topology.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts PolicyOptions) (cpuset.CPUSet, error) {
+		return cpuset.New(availableCPUs.List()[:numCPUs]...), nil
+	})
+
+	if err := RegisterPolicy(name, lowest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RegisterPolicy(name, lowest); err == nil {
+		t.Errorf("expected an error registering %q twice", name)
+	}
+	if err := RegisterPolicy(PolicyNUMAPacked, lowest); err == nil {
+		t.Errorf("expected an error replacing the builtin policy %q", PolicyNUMAPacked)
+	}
+	if err := RegisterPolicy("", lowest); err == nil {
+		t.Errorf("expected an error registering a policy without name")
+	}
+	if !slices.Contains(PolicyNames(), name) {
+		t.Errorf("expected %q among the policies, got %v", name, PolicyNames())
+	}
+
+	policy, ok := LookupPolicy(name)
+	if !ok {
+		t.Fatalf("policy %q not registered", name)
+	}
+	result, err := policy.Allocate(klog.Background(), topoDualSocketHT, cpuset.New(3, 5, 7, 9), 2, PolicyOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := cpuset.New(3, 5); !result.Equals(expected) {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+	if _, ok := LookupPolicy("unknown"); ok {
+		t.Errorf("unexpected policy %q", "unknown")
+	}
+}
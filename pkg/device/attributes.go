@@ -21,9 +21,27 @@ import (
 	"k8s.io/utils/ptr"
 )
 
+const (
+	// AttributeNUMANode is the NUMA node of a device, the attribute the devices of the DRA drivers align on,
+	// e.g. with a matchAttribute constraint across the requests of a claim. The other drivers import it.
+	AttributeNUMANode resourceapi.QualifiedName = "resource.kubernetes.io/numaNode"
+	// LegacyAttributeNUMANode is the NUMA node attribute first published by the DRA network driver, which the
+	// drivers not knowing AttributeNUMANode align on. Deprecated: align on AttributeNUMANode.
+	LegacyAttributeNUMANode resourceapi.QualifiedName = "dra.net/numaNode"
+)
+
+// SetAlignmentAttributes sets the NUMA node attribute the devices of the DRA drivers align on, and the legacy
+// one too if requested, for the drivers not knowing the former yet.
+func SetAlignmentAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, numaID int64, legacy bool) {
+	attrs[AttributeNUMANode] = resourceapi.DeviceAttribute{IntValue: ptr.To(numaID)}
+	if legacy {
+		SetCompatibilityAttributes(attrs, numaID)
+	}
+}
+
 // SetCompatibilityAttributes add attributes to enable compatibility (e.g. alignment) with other
 // DRA resource drivers leveraging attributes which are not kubernetes standard.
 // This is the "staging area" which enables attribute sharing until (or before) they become standard.
 func SetCompatibilityAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, numaID int64) {
-	attrs["dra.net/numaNode"] = resourceapi.DeviceAttribute{IntValue: ptr.To(numaID)}
+	attrs[LegacyAttributeNUMANode] = resourceapi.DeviceAttribute{IntValue: ptr.To(numaID)}
 }
@@ -0,0 +1,74 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry maps the device modes to the factories of their device managers, so a driver chooses its
+// managers at startup, by the name of a mode, rather than in its wiring. F is the factory type of the
+// driver: the registry knows nothing of the managers it builds.
+type Registry[F any] struct {
+	lock      sync.RWMutex
+	factories map[string]F
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry[F any]() *Registry[F] {
+	return &Registry[F]{factories: make(map[string]F)}
+}
+
+// Register adds the factory of the device manager of a mode. Registering a mode twice is a programming
+// error, like registering it with an empty name, and panics.
+func (r *Registry[F]) Register(mode string, factory F) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if mode == "" {
+		panic("device: registering a device manager without a mode")
+	}
+	if _, ok := r.factories[mode]; ok {
+		panic(fmt.Sprintf("device: device manager of mode %q registered twice", mode))
+	}
+	r.factories[mode] = factory
+}
+
+// Get returns the factory of the device manager of a mode, or an error listing the registered modes.
+func (r *Registry[F]) Get(mode string) (F, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	factory, ok := r.factories[mode]
+	if !ok {
+		return factory, fmt.Errorf("no device manager for mode %q, must be one of %s", mode, strings.Join(r.modesLocked(), ", "))
+	}
+	return factory, nil
+}
+
+// Modes returns the modes with a registered device manager, sorted.
+func (r *Registry[F]) Modes() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.modesLocked()
+}
+
+func (r *Registry[F]) modesLocked() []string {
+	return slices.Sorted(maps.Keys(r.factories))
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2025 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package device
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry[func(n int) string]()
+	registry.Register("individual", func(n int) string { return strings.Repeat("i", n) })
+	registry.Register("grouped", func(n int) string { return strings.Repeat("g", n) })
+
+	if got, want := registry.Modes(), []string{"grouped", "individual"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected modes %v, got %v", want, got)
+	}
+
+	factory, err := registry.Get("grouped")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := factory(2); got != "gg" {
+		t.Errorf("expected the grouped factory, got %q", got)
+	}
+
+	_, err = registry.Get("mixed")
+	if err == nil {
+		t.Fatal("expected an error for an unregistered mode")
+	}
+	if !strings.Contains(err.Error(), "grouped, individual") {
+		t.Errorf("expected the error to list the registered modes, got %v", err)
+	}
+}
+
+func TestRegistryRegisterTwice(t *testing.T) {
+	registry := NewRegistry[func() string]()
+	registry.Register("grouped", func() string { return "" })
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a mode twice to panic")
+		}
+	}()
+	registry.Register("grouped", func() string { return "" })
+}
@@ -0,0 +1,91 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	"k8s.io/utils/cpuset"
+)
+
+// allocationStrategy is how the CPUs of a request consuming a part of a grouped device are picked.
+type allocationStrategy struct {
+	// policy is the name of the cpumanager allocation policy.
+	policy string
+	// cpuSorting is CPU_SORTING_STRATEGY_PACKED or CPU_SORTING_STRATEGY_SPREAD.
+	cpuSorting string
+}
+
+// allocationStrategyFor returns how the CPUs of a request are picked: as configured for the driver, unless the
+// allocationStrategy of the opaque configuration of the request overrides it.
+func (cp *CPUDriver) allocationStrategyFor(request string, config DeviceConfig) (allocationStrategy, error) {
+	if err := validateAllocationStrategyConfig(request, config); err != nil {
+		return allocationStrategy{}, err
+	}
+	strategy := allocationStrategy{policy: cp.allocationPolicy, cpuSorting: cp.cpuSortingStrategy}
+	if strategy.policy == "" {
+		strategy.policy = cpumanager.PolicyNUMAPacked
+	}
+	switch config.AllocationStrategy {
+	case ALLOCATION_STRATEGY_PACKED:
+		strategy = allocationStrategy{policy: cpumanager.PolicyNUMAPacked, cpuSorting: CPU_SORTING_STRATEGY_PACKED}
+	case ALLOCATION_STRATEGY_SPREAD:
+		strategy = allocationStrategy{policy: cpumanager.PolicyNUMAPacked, cpuSorting: CPU_SORTING_STRATEGY_SPREAD}
+	case ALLOCATION_STRATEGY_DISTRIBUTED:
+		strategy.policy = cpumanager.PolicyNUMADistributed
+	}
+	return strategy, nil
+}
+
+// validateAllocationStrategyConfig returns an error if the allocation strategy of the opaque configuration of a
+// request is invalid.
+func validateAllocationStrategyConfig(request string, config DeviceConfig) error {
+	switch config.AllocationStrategy {
+	case "", ALLOCATION_STRATEGY_PACKED, ALLOCATION_STRATEGY_SPREAD, ALLOCATION_STRATEGY_DISTRIBUTED:
+		return nil
+	}
+	return fmt.Errorf("invalid allocation strategy %q for request %q, must be %s, %s or %s", config.AllocationStrategy, request, ALLOCATION_STRATEGY_PACKED, ALLOCATION_STRATEGY_SPREAD, ALLOCATION_STRATEGY_DISTRIBUTED)
+}
+
+// takeByAllocationPolicy picks the CPUs of a request consuming a part of a grouped device with the allocation
+// policy of its strategy.
+func (cp *CPUDriver) takeByAllocationPolicy(logger logr.Logger, topo *cpuinfo.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, strategy allocationStrategy) (cpuset.CPUSet, error) {
+	policy, ok := cpumanager.LookupPolicy(strategy.policy)
+	if !ok {
+		return cpuset.New(), fmt.Errorf("unknown allocation policy %q", strategy.policy)
+	}
+	opts := cpumanager.PolicyOptions{
+		CPUSortingStrategy:       cpumanager.CPUSortingStrategyPacked,
+		PreferAlignByUncoreCache: cp.preferAlignByUncoreCache,
+	}
+	if strategy.cpuSorting == CPU_SORTING_STRATEGY_SPREAD {
+		// the uncore cache alignment packs whole cores, so the spread strategy goes without it, as in the kubelet.
+		opts = cpumanager.PolicyOptions{CPUSortingStrategy: cpumanager.CPUSortingStrategySpread}
+	}
+	cpus, err := policy.Allocate(logger, topo, availableCPUs, numCPUs, opts)
+	if err != nil {
+		return cpuset.New(), err
+	}
+	// the custom policies are not trusted to stay within the available CPUs.
+	if cpus.Size() != numCPUs || !cpus.IsSubsetOf(availableCPUs) {
+		return cpuset.New(), fmt.Errorf("allocation policy %q picked the CPUs %q for %d CPUs among %q", strategy.policy, cpus.String(), numCPUs, availableCPUs.String())
+	}
+	return cpus, nil
+}
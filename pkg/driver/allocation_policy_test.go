@@ -0,0 +1,168 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func init() {
+	// the highest CPU IDs, the opposite of the packing.
+	_ = cpumanager.RegisterPolicy("test-highest-ids", cpumanager.PolicyFunc(func(logger logr.Logger, topo *cpuinfo.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts cpumanager.PolicyOptions) (cpuset.CPUSet, error) {
+		cpus := availableCPUs.List()
+		return cpuset.New(cpus[len(cpus)-numCPUs:]...), nil
+	}))
+	// too many CPUs, some not available.
+	_ = cpumanager.RegisterPolicy("test-all-cpus", cpumanager.PolicyFunc(func(logger logr.Logger, topo *cpuinfo.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, opts cpumanager.PolicyOptions) (cpuset.CPUSet, error) {
+		return topo.CPUDetails.CPUs(), nil
+	}))
+}
+
+func TestPrepareResourceClaimsAllocationPolicy(t *testing.T) {
+	claimUID := types.UID("claim-policy")
+
+	testCases := []struct {
+		name           string
+		policy         string
+		expectedCPUSet cpuset.CPUSet
+		expectedError  bool
+	}{
+		{
+			name:           "default",
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:           "builtin",
+			policy:         cpumanager.PolicyNUMAPacked,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:           "registered",
+			policy:         "test-highest-ids",
+			expectedCPUSet: cpuset.New(4, 5),
+		},
+		{
+			name:          "CPUs not available",
+			policy:        "test-all-cpus",
+			expectedError: true,
+		},
+		{
+			name:          "unknown",
+			policy:        "unknown",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.allocationPolicy = tc.policy
+			})
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+				testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestValidateAllocationPolicy(t *testing.T) {
+	require.NoError(t, Config{AllocationPolicy: cpumanager.PolicyNUMADistributed}.validate())
+	require.NoError(t, Config{AllocationPolicy: "test-highest-ids"}.validate())
+	require.Error(t, Config{AllocationPolicy: "unknown"}.validate())
+}
+
+func TestPrepareResourceClaimsAllocationStrategy(t *testing.T) {
+	claimUID := types.UID("claim-strategy")
+
+	testCases := []struct {
+		name           string
+		cpuSorting     string
+		parameters     string
+		expectedCPUSet cpuset.CPUSet
+		expectedError  bool
+	}{
+		{
+			name:           "driver strategy",
+			cpuSorting:     CPU_SORTING_STRATEGY_SPREAD,
+			parameters:     `{}`,
+			expectedCPUSet: cpuset.New(0, 1),
+		},
+		{
+			name:           "packed override",
+			cpuSorting:     CPU_SORTING_STRATEGY_SPREAD,
+			parameters:     `{"allocationStrategy": "packed"}`,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:           "spread override",
+			parameters:     `{"allocationStrategy": "spread"}`,
+			expectedCPUSet: cpuset.New(0, 1),
+		},
+		{
+			// the request fits a NUMA node, so it is packed.
+			name:           "distributed override",
+			parameters:     `{"allocationStrategy": "distributed"}`,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:          "invalid",
+			parameters:    `{"allocationStrategy": "random"}`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.cpuSortingStrategy = tc.cpuSorting
+			})
+
+			claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), tc.parameters)
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
@@ -17,16 +17,94 @@ limitations under the License.
 package driver
 
 import (
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
 	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
 )
 
 const (
 	AttributeNUMANodeID resourceapi.QualifiedName = "dra.cpu/numaNodeID"
 	AttributeSocketID   resourceapi.QualifiedName = "dra.cpu/socketID"
+	AttributeDieID      resourceapi.QualifiedName = "dra.cpu/dieID"
+	AttributeClusterID  resourceapi.QualifiedName = "dra.cpu/clusterID"
 	AttributeSMTEnabled resourceapi.QualifiedName = "dra.cpu/smtEnabled"
 	AttributeCacheL3ID  resourceapi.QualifiedName = "dra.cpu/cacheL3ID"
+	AttributeCCDID      resourceapi.QualifiedName = "dra.cpu/ccdID"
 	AttributeCoreType   resourceapi.QualifiedName = "dra.cpu/coreType"
 	AttributeCoreID     resourceapi.QualifiedName = "dra.cpu/coreID"
 	AttributeCPUID      resourceapi.QualifiedName = "dra.cpu/cpuID"
 	AttributeNumCPUs    resourceapi.QualifiedName = "dra.cpu/numCPUs"
+	// AttributeCPUTier is the operator-defined CPU tier of the device.
+	AttributeCPUTier resourceapi.QualifiedName = "dra.cpu/tier"
+	// AttributeCPUPool is the admin-defined CPU pool of the device.
+	AttributeCPUPool resourceapi.QualifiedName = "dra.cpu/pool"
+	// AttributeSharedPool marks the virtual device of the shared pool.
+	AttributeSharedPool resourceapi.QualifiedName = "dra.cpu/sharedPool"
+	// AttributePerformanceScore is the relative performance of the CPUs of the device, in percent of the fastest
+	// uncapped CPU of the node, lowered by the frequency caps.
+	AttributePerformanceScore resourceapi.QualifiedName = "dra.cpu/performanceScore"
+	// AttributeBaseFrequencyMHz, AttributeMaxFrequencyMHz and AttributeMinFrequencyMHz are the frequencies of
+	// the CPUs of the device from their cpufreq policy, the lowest of the CPUs for a grouped device.
+	AttributeBaseFrequencyMHz resourceapi.QualifiedName = "dra.cpu/baseFrequencyMHz"
+	AttributeMaxFrequencyMHz  resourceapi.QualifiedName = "dra.cpu/maxFrequencyMHz"
+	AttributeMinFrequencyMHz  resourceapi.QualifiedName = "dra.cpu/minFrequencyMHz"
+	// AttributeAVX512, AttributeAMX, AttributeSSE4, AttributeSVE and AttributeSGX report the instruction set
+	// features all the CPUs of the device have, from the flags of /proc/cpuinfo.
+	AttributeAVX512 resourceapi.QualifiedName = "dra.cpu/avx512"
+	AttributeAMX    resourceapi.QualifiedName = "dra.cpu/amx"
+	AttributeSSE4   resourceapi.QualifiedName = "dra.cpu/sse4"
+	AttributeSVE    resourceapi.QualifiedName = "dra.cpu/sve"
+	AttributeSGX    resourceapi.QualifiedName = "dra.cpu/sgx"
+	// AttributeL2CacheKiB and AttributeL3CacheKiB are the sizes of the L2 and L3 caches of the CPUs of the device,
+	// the smallest of the CPUs for a grouped device.
+	AttributeL2CacheKiB resourceapi.QualifiedName = "dra.cpu/l2CacheKiB"
+	AttributeL3CacheKiB resourceapi.QualifiedName = "dra.cpu/l3CacheKiB"
+	// AttributeVendor, AttributeModelName, AttributeFamily and AttributeStepping identify the model of the CPUs
+	// of the device, from /proc/cpuinfo, reported for a grouped device only if all its CPUs agree.
+	AttributeVendor    resourceapi.QualifiedName = "dra.cpu/vendor"
+	AttributeModelName resourceapi.QualifiedName = "dra.cpu/modelName"
+	AttributeFamily    resourceapi.QualifiedName = "dra.cpu/family"
+	AttributeStepping  resourceapi.QualifiedName = "dra.cpu/stepping"
+	// AttributeNUMANearestRemoteDistance and AttributeNUMAFarthestRemoteDistance are the distances from the NUMA
+	// node of the device to the nearest and the farthest other NUMA nodes, from sysfs.
+	AttributeNUMANearestRemoteDistance  resourceapi.QualifiedName = "dra.cpu/numaNearestRemoteDistance"
+	AttributeNUMAFarthestRemoteDistance resourceapi.QualifiedName = "dra.cpu/numaFarthestRemoteDistance"
+	// AttributeIsolated and AttributeNohzFull report whether the CPU of an individual device is isolated from the
+	// scheduler (isolcpus) and runs without the periodic tick (nohz_full), from the kernel boot parameters.
+	AttributeIsolated resourceapi.QualifiedName = "dra.cpu/isolated"
+	AttributeNohzFull resourceapi.QualifiedName = "dra.cpu/nohzFull"
+	// AttributeCPUs lists the allocatable CPUs of a grouped device, in the cpuset list format, e.g. "2-15,18-31".
+	AttributeCPUs resourceapi.QualifiedName = "dra.cpu/cpus"
+	// AttributeCPUCapacity and AttributeTotalCPUCapacity are the lowest and the total capacities of the CPUs of
+	// the device on the asymmetric systems, normalized to 1024 for the most performant CPUs, from sysfs.
+	AttributeCPUCapacity      resourceapi.QualifiedName = "dra.cpu/cpuCapacity"
+	AttributeTotalCPUCapacity resourceapi.QualifiedName = "dra.cpu/totalCPUCapacity"
+
+	// AttributeCgroupV2Cpuset, AttributeCpusetPartitions and AttributeSMTControl report the optional kernel features of the node.
+	AttributeCgroupV2Cpuset   resourceapi.QualifiedName = "dra.cpu/cgroupV2Cpuset"
+	AttributeCpusetPartitions resourceapi.QualifiedName = "dra.cpu/cpusetPartitions"
+	AttributeSMTControl       resourceapi.QualifiedName = "dra.cpu/smtControl"
+
+	// AttributeDriverVersion, AttributeDriverCommit and AttributeDeviceSchemaVersion report the build of the driver
+	// and the version of the device model which published the device.
+	AttributeDriverVersion       resourceapi.QualifiedName = "dra.cpu/driverVersion"
+	AttributeDriverCommit        resourceapi.QualifiedName = "dra.cpu/driverCommit"
+	AttributeDeviceSchemaVersion resourceapi.QualifiedName = "dra.cpu/deviceSchemaVersion"
 )
+
+// setAlignmentAttributes sets the NUMA node attributes the devices of the other DRA drivers align on, the legacy
+// one only if enabled.
+func (cp *CPUDriver) setAlignmentAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, numaNodeID int) {
+	device.SetAlignmentAttributes(attrs, int64(numaNodeID), cp.legacyNUMAAttribute)
+}
+
+// setCPUsAttribute lists the allocatable CPUs of a grouped device. The list is not reported if it exceeds the
+// maximum length of the attribute values, as on the large nodes with interleaved CPU IDs.
+func setCPUsAttribute(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	list := cpus.String()
+	if list == "" || len(list) > resourceapi.DeviceAttributeMaxValueLength {
+		return
+	}
+	attrs[AttributeCPUs] = resourceapi.DeviceAttribute{StringValue: ptr.To(list)}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/scoring"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+)
+
+// the scoring package doesn't import the driver, so it keeps its own copy of the names.
+func TestAttributesMatchScoring(t *testing.T) {
+	for published, decoded := range map[resourceapi.QualifiedName]resourceapi.QualifiedName{
+		AttributeNUMANodeID:            scoring.AttributeNUMANodeID,
+		AttributeSocketID:              scoring.AttributeSocketID,
+		AttributeDieID:                 scoring.AttributeDieID,
+		AttributeClusterID:             scoring.AttributeClusterID,
+		AttributeSMTEnabled:            scoring.AttributeSMTEnabled,
+		AttributeCacheL3ID:             scoring.AttributeCacheL3ID,
+		AttributeCCDID:                 scoring.AttributeCCDID,
+		AttributeCoreType:              scoring.AttributeCoreType,
+		AttributeCoreID:                scoring.AttributeCoreID,
+		AttributeCPUID:                 scoring.AttributeCPUID,
+		AttributeNumCPUs:               scoring.AttributeNumCPUs,
+		AttributeCPUTier:               scoring.AttributeCPUTier,
+		cpuResourceQualifiedName:       scoring.CapacityCPU,
+		fullCoresResourceQualifiedName: scoring.CapacityFullCores,
+	} {
+		require.Equal(t, published, decoded)
+	}
+}
+
+func TestAlignmentAttributes(t *testing.T) {
+	logger := testr.New(t)
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	for _, dev := range driver.createGroupedCPUDeviceChunks(logger)[0].devices {
+		require.Equal(t, *dev.Attributes[AttributeNUMANodeID].IntValue, *dev.Attributes[device.AttributeNUMANode].IntValue, dev.Name)
+		require.NotContains(t, dev.Attributes, device.LegacyAttributeNUMANode, dev.Name)
+	}
+
+	driver = newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.legacyNUMAAttribute = true
+	})
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			require.Equal(t, *dev.Attributes[AttributeNUMANodeID].IntValue, *dev.Attributes[device.AttributeNUMANode].IntValue, dev.Name)
+			require.Equal(t, *dev.Attributes[AttributeNUMANodeID].IntValue, *dev.Attributes[device.LegacyAttributeNUMANode].IntValue, dev.Name)
+		}
+	}
+}
+
+func TestCPUsAttribute(t *testing.T) {
+	logger := testr.New(t)
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.reservedCPUs = cpuset.New(0)
+	})
+	expected := map[string]string{}
+	for _, info := range driver.groupedCPUDeviceInfos() {
+		expected[info.name] = info.cpus.String()
+	}
+	published := map[string]string{}
+	for _, dev := range driver.createGroupedCPUDeviceChunks(logger)[0].devices {
+		published[dev.Name] = *dev.Attributes[AttributeCPUs].StringValue
+	}
+	require.Equal(t, expected, published)
+
+	// the interleaved CPU IDs of the large nodes don't fit in an attribute.
+	var interleaved []int
+	for cpuID := 0; cpuID < 64; cpuID += 2 {
+		interleaved = append(interleaved, cpuID)
+	}
+	attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+	setCPUsAttribute(attrs, cpuset.New(interleaved...))
+	require.NotContains(t, attrs, AttributeCPUs)
+}
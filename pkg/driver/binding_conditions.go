@@ -0,0 +1,237 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// BindingConditionCPUsReady is set on the devices of a claim once the node is ready to prepare it: the
+	// scheduler binds the pods consuming the claim only then, instead of the kubelet failing the preparation.
+	BindingConditionCPUsReady = "CPUsReady"
+	// BindingFailureConditionCPUsUnavailable is set on the devices of a claim the node can't prepare: the
+	// scheduler then allocates the claim again, possibly on another node.
+	BindingFailureConditionCPUsUnavailable = "CPUsUnavailable"
+
+	// bindingConditionsResync is how often the claims waiting for their binding conditions are checked again.
+	bindingConditionsResync = 10 * time.Second
+)
+
+// setBindingConditions makes the scheduler wait, before binding the pods consuming the devices, for the driver
+// to report the node ready for the claims allocated them. The devices bind the claims to the node.
+func (cp *CPUDriver) setBindingConditions(chunks []deviceChunk) {
+	if !cp.FeatureEnabled(FEATURE_GATE_BINDING_CONDITIONS) {
+		return
+	}
+	for _, chunk := range chunks {
+		for i := range chunk.devices {
+			chunk.devices[i].BindsToNode = ptr.To(true)
+			chunk.devices[i].BindingConditions = []string{BindingConditionCPUsReady}
+			chunk.devices[i].BindingFailureConditions = []string{BindingFailureConditionCPUsUnavailable}
+		}
+	}
+}
+
+// bindingResults returns the devices of the driver on the node allocated to the claim with binding conditions.
+func (cp *CPUDriver) bindingResults(claim *resourceapi.ResourceClaim) []resourceapi.DeviceRequestAllocationResult {
+	if claim.Status.Allocation == nil {
+		return nil
+	}
+	var results []resourceapi.DeviceRequestAllocationResult
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver == cp.driverName && cp.ownsResourcePool(result.Pool) && len(result.BindingConditions) > 0 {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// checkBinding returns why the node can't prepare the claim, or nil if it can. The claims allocated more
+// exclusive CPUs of a device than it has free, online and healthy fail, and the claims with the strict
+// enforcement wait, with errEnforcementUnavailable, until their CPUs can be enforced.
+func (cp *CPUDriver) checkBinding(logger logr.Logger, claim *resourceapi.ResourceClaim, results []resourceapi.DeviceRequestAllocationResult) error {
+	deviceCPUs := cp.publishedDeviceCPUs()
+	offline, unhealthy := cp.cpuHealth.get()
+	freeCPUs := cp.cpuAllocationStore.GetSharedCPUs().Difference(cp.reservedCPUs).Difference(offline).Difference(unhealthy)
+	requested := make(map[string]int64)
+	var devices []string
+	for _, result := range results {
+		deviceName := cp.resolveDeviceName(logger, result.Device)
+		if deviceName == cpuDeviceSharedPool {
+			continue
+		}
+		if _, ok := deviceCPUs[deviceName]; !ok {
+			return fmt.Errorf("device %s is not published on node %s", result.Device, cp.nodeName)
+		}
+		if _, ok := requested[deviceName]; !ok {
+			devices = append(devices, deviceName)
+			requested[deviceName] = 0
+		}
+		if _, ok := cp.deviceNameToCPUID[deviceName]; ok {
+			// an individual device is a CPU.
+			requested[deviceName]++
+			continue
+		}
+		// the fractions of CPUs run on the shared CPUs of the device, and need no free CPU.
+		if quantity, ok := result.ConsumedCapacity[cpuResourceQualifiedName]; ok && !isFractionalCPUQuantity(quantity) {
+			requested[deviceName] += quantity.Value()
+		}
+	}
+	for _, deviceName := range devices {
+		free := deviceCPUs[deviceName].Intersection(freeCPUs)
+		if requested[deviceName] > int64(free.Size()) {
+			return fmt.Errorf("device %s has %d free CPUs, %d requested", deviceName, free.Size(), requested[deviceName])
+		}
+	}
+	return cp.checkClaimEnforcement(claim)
+}
+
+// bindingConditionsReporter sets the binding conditions of the devices of the claims allocated on the node,
+// through the claim status reporter, as the claims are allocated and on each resync while they wait.
+type bindingConditionsReporter struct {
+	cp      *CPUDriver
+	client  kubernetes.Interface
+	lock    sync.Mutex
+	tracked sets.Set[types.UID]
+	factory informers.SharedInformerFactory
+	cancel  context.CancelFunc
+}
+
+func newBindingConditionsReporter(cp *CPUDriver, client kubernetes.Interface) *bindingConditionsReporter {
+	return &bindingConditionsReporter{
+		cp:      cp,
+		client:  client,
+		tracked: sets.New[types.UID](),
+	}
+}
+
+// sync sets the binding conditions of the devices of the claim, unless already set.
+func (r *bindingConditionsReporter) sync(logger logr.Logger, claim *resourceapi.ResourceClaim) {
+	results := r.cp.bindingResults(claim)
+	if len(results) == 0 {
+		if claim.Status.Allocation == nil {
+			r.release(claim.UID)
+		}
+		return
+	}
+	conditions := r.cp.claimStatus.conditions(claim.UID)
+	if meta.IsStatusConditionTrue(conditions, BindingConditionCPUsReady) || meta.IsStatusConditionTrue(conditions, BindingFailureConditionCPUsUnavailable) {
+		return
+	}
+	r.lock.Lock()
+	r.tracked.Insert(claim.UID)
+	r.lock.Unlock()
+	r.cp.claimStatus.track(claim)
+
+	cLogger := logger.WithValues("claim", ctxlog.KObj(claim), "claimUID", claim.UID)
+	err := r.cp.checkBinding(cLogger, claim, results)
+	switch {
+	case err == nil:
+		cLogger.V(2).Info("the node is ready to prepare the claim")
+		r.cp.claimStatus.setCondition(claim.UID, BindingConditionCPUsReady, metav1.ConditionTrue, "CPUsAvailable", "the CPUs of the devices are available on the node")
+	case errors.Is(err, errEnforcementUnavailable):
+		cLogger.V(2).Info("the claim waits for its CPUs to be enforceable", "reason", err.Error())
+		r.cp.claimStatus.setCondition(claim.UID, BindingConditionCPUsReady, metav1.ConditionFalse, "EnforcementUnavailable", err.Error())
+	default:
+		cLogger.Info("the node can't prepare the claim, failing its binding", "reason", err.Error())
+		r.cp.claimStatus.setCondition(claim.UID, BindingFailureConditionCPUsUnavailable, metav1.ConditionTrue, "CPUsUnavailable", err.Error())
+	}
+}
+
+// release forgets the status of a claim deallocated or deleted while waiting for its binding: the status
+// goes away with the allocation.
+func (r *bindingConditionsReporter) release(claimUID types.UID) {
+	r.lock.Lock()
+	tracked := r.tracked.Has(claimUID)
+	r.tracked.Delete(claimUID)
+	r.lock.Unlock()
+	if tracked {
+		r.cp.claimStatus.forget(claimUID)
+	}
+}
+
+// Name implements Component.
+func (r *bindingConditionsReporter) Name() string {
+	return COMPONENT_BINDING_CONDITIONS
+}
+
+// Start watches the claims, and waits for the first list of them.
+func (r *bindingConditionsReporter) Start(ctx context.Context) error {
+	logger := ctxlog.FromContext(ctx).WithName("binding-conditions")
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.factory = informers.NewSharedInformerFactory(r.client, bindingConditionsResync)
+	informer := r.factory.Resource().V1().ResourceClaims().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if claim, ok := obj.(*resourceapi.ResourceClaim); ok {
+				r.sync(logger, claim)
+			}
+		},
+		UpdateFunc: func(_, obj any) {
+			if claim, ok := obj.(*resourceapi.ResourceClaim); ok {
+				r.sync(logger, claim)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if claim, ok := obj.(*resourceapi.ResourceClaim); ok {
+				r.release(claim.UID)
+			}
+		},
+	})
+	if err != nil {
+		r.cancel()
+		return err
+	}
+	r.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		r.cancel()
+		r.factory.Shutdown()
+		return fmt.Errorf("the claims were not listed")
+	}
+	return nil
+}
+
+// Stop stops watching the claims.
+func (r *bindingConditionsReporter) Stop(ctx context.Context) {
+	r.cancel()
+	r.factory.Shutdown()
+}
+
+// Healthy implements Component. The watch of the claims is restarted by the informer.
+func (r *bindingConditionsReporter) Healthy() error {
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+)
+
+// testBindingClaim is a claim allocated the devices with the binding conditions of the driver.
+func testBindingClaim(claimUID string, consumedCapacity map[string]int64) *resourceapi.ResourceClaim {
+	claim := testClaim(types.UID(claimUID), testDriverName, testNodeName, consumedCapacity)
+	for i := range claim.Status.Allocation.Devices.Results {
+		claim.Status.Allocation.Devices.Results[i].BindingConditions = []string{BindingConditionCPUsReady}
+		claim.Status.Allocation.Devices.Results[i].BindingFailureConditions = []string{BindingFailureConditionCPUsUnavailable}
+	}
+	return claim
+}
+
+func newBindingConditionsTestDriver(t *testing.T) (*CPUDriver, *bindingConditionsReporter) {
+	gates, err := newFeatureGates(knownFeatureGates, map[string]bool{
+		string(FEATURE_GATE_CLAIM_DEVICE_STATUS): true,
+		string(FEATURE_GATE_BINDING_CONDITIONS):  true,
+	})
+	require.NoError(t, err)
+	client := fake.NewClientset()
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.featureGates = gates
+		cp.claimStatus = newClaimStatusReporter(client, testDriverName)
+	})
+	return driver, newBindingConditionsReporter(driver, client)
+}
+
+func TestBindingConditionsFeatureGate(t *testing.T) {
+	_, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_BINDING_CONDITIONS): true})
+	require.EqualError(t, err, "the BindingConditions feature gate requires the ClaimDeviceStatus feature gate")
+}
+
+func TestSetBindingConditions(t *testing.T) {
+	logger := testr.New(t)
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	chunks := driver.createGroupedCPUDeviceChunks(logger)
+	driver.setBindingConditions(chunks)
+	require.Nil(t, chunks[0].devices[0].BindingConditions)
+
+	driver, _ = newBindingConditionsTestDriver(t)
+	chunks = driver.createGroupedCPUDeviceChunks(logger)
+	driver.setBindingConditions(chunks)
+	for _, chunk := range chunks {
+		for _, device := range chunk.devices {
+			require.True(t, *device.BindsToNode)
+			require.Equal(t, []string{BindingConditionCPUsReady}, device.BindingConditions)
+			require.Equal(t, []string{BindingFailureConditionCPUsUnavailable}, device.BindingFailureConditions)
+		}
+	}
+}
+
+func TestBindingConditionsReporter(t *testing.T) {
+	logger := testr.New(t)
+	driver, reporter := newBindingConditionsTestDriver(t)
+
+	// NUMA node 0 has the CPUs 0,1,4,5, all free.
+	ready := testBindingClaim("claim-ready", map[string]int64{"cpudevnuma000": 2})
+	reporter.sync(logger, ready)
+	require.True(t, meta.IsStatusConditionTrue(driver.claimStatus.conditions(ready.UID), BindingConditionCPUsReady))
+
+	// the CPUs 0,1,4 are allocated, and the CPU 5 is offline.
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", cpuset.New(0, 1, 4))
+	require.True(t, driver.cpuHealth.set(cpuset.New(5), cpuset.New(), metav1.Now()))
+	unavailable := testBindingClaim("claim-unavailable", map[string]int64{"cpudevnuma000": 1})
+	reporter.sync(logger, unavailable)
+	failed := meta.FindStatusCondition(driver.claimStatus.conditions(unavailable.UID), BindingFailureConditionCPUsUnavailable)
+	require.NotNil(t, failed)
+	require.Equal(t, "device cpudevnuma000 has 0 free CPUs, 1 requested", failed.Message)
+	require.Nil(t, meta.FindStatusCondition(driver.claimStatus.conditions(unavailable.UID), BindingConditionCPUsReady))
+
+	// the conditions once set are not checked again.
+	reporter.sync(logger, ready)
+	require.True(t, meta.IsStatusConditionTrue(driver.claimStatus.conditions(ready.UID), BindingConditionCPUsReady))
+	require.Nil(t, meta.FindStatusCondition(driver.claimStatus.conditions(ready.UID), BindingFailureConditionCPUsUnavailable))
+
+	// the claims allocated devices without binding conditions are ignored.
+	plain := testClaim("claim-plain", testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 1})
+	reporter.sync(logger, plain)
+	require.Empty(t, driver.claimStatus.conditions(plain.UID))
+
+	// the claim deallocated after the binding failure is forgotten.
+	unavailable.Status.Allocation = nil
+	reporter.sync(logger, unavailable)
+	require.Empty(t, driver.claimStatus.conditions(unavailable.UID))
+	require.False(t, reporter.tracked.Has(unavailable.UID))
+}
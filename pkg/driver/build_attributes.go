@@ -0,0 +1,52 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"maps"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/buildinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/utils/ptr"
+)
+
+// DeviceSchemaVersion is the version of the device model: the names, the attributes and the capacities of the
+// published devices. The major version changes with the incompatible changes, e.g. a renamed attribute, and the
+// minor version with the additions, so the consumers depending on the model can check it in their selectors.
+const DeviceSchemaVersion = "1.11.0"
+
+// newBuildAttributes returns the attributes of the build of the driver, set on all the devices so the audits of
+// a fleet can detect the version skew. The version and the commit the build doesn't know are left out.
+func newBuildAttributes(info buildinfo.Info) map[resourceapi.QualifiedName]resourceapi.DeviceAttribute {
+	attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		AttributeDeviceSchemaVersion: {VersionValue: ptr.To(DeviceSchemaVersion)},
+	}
+	// the attribute is a semantic version without the "v" prefix of the tags.
+	if v, err := version.ParseSemantic(info.Version); err == nil {
+		attrs[AttributeDriverVersion] = resourceapi.DeviceAttribute{VersionValue: ptr.To(v.String())}
+	}
+	if info.VCSRevision != "" {
+		attrs[AttributeDriverCommit] = resourceapi.DeviceAttribute{StringValue: ptr.To(info.VCSRevision)}
+	}
+	return attrs
+}
+
+// setBuildAttributes sets the attributes of the build of the driver.
+func (cp *CPUDriver) setBuildAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute) {
+	maps.Copy(attrs, cp.buildAttributes)
+}
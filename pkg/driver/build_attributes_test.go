@@ -0,0 +1,73 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/buildinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestNewBuildAttributes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		info     buildinfo.Info
+		expected map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	}{
+		{
+			name: "release build",
+			info: buildinfo.Info{Version: "v0.3.1", VCSRevision: "0123456789abcdef"},
+			expected: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttributeDeviceSchemaVersion: {VersionValue: ptr.To(DeviceSchemaVersion)},
+				AttributeDriverVersion:       {VersionValue: ptr.To("0.3.1")},
+				AttributeDriverCommit:        {StringValue: ptr.To("0123456789abcdef")},
+			},
+		},
+		{
+			name: "development build",
+			info: buildinfo.Info{},
+			expected: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttributeDeviceSchemaVersion: {VersionValue: ptr.To(DeviceSchemaVersion)},
+			},
+		},
+		{
+			name: "invalid version",
+			info: buildinfo.Info{Version: "latest", VCSRevision: "0123456789abcdef"},
+			expected: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+				AttributeDeviceSchemaVersion: {VersionValue: ptr.To(DeviceSchemaVersion)},
+				AttributeDriverCommit:        {StringValue: ptr.To("0123456789abcdef")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, newBuildAttributes(tc.info))
+		})
+	}
+}
+
+func TestSharedPoolDeviceBuildAttributes(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	driver.buildAttributes = newBuildAttributes(buildinfo.Info{Version: "v0.3.1"})
+
+	device := driver.createSharedPoolDevice()
+	require.Equal(t, ptr.To("0.3.1"), device.Attributes[AttributeDriverVersion].VersionValue)
+	require.Equal(t, ptr.To(DeviceSchemaVersion), device.Attributes[AttributeDeviceSchemaVersion].VersionValue)
+}
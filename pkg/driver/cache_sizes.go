@@ -0,0 +1,47 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// setCacheSizeAttributes reports the sizes of the L2 and L3 caches of the CPUs of a device: the smallest of its
+// CPUs, as a claim may get any of them. A size is not reported if a CPU doesn't know it.
+func setCacheSizeAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, topo *cpuinfo.CPUTopology, cpus cpuset.CPUSet) {
+	for _, cache := range []struct {
+		attribute resourceapi.QualifiedName
+		size      func(cpuinfo.CPUInfo) int64
+	}{
+		{attribute: AttributeL2CacheKiB, size: func(info cpuinfo.CPUInfo) int64 { return info.L2CacheKiB }},
+		{attribute: AttributeL3CacheKiB, size: func(info cpuinfo.CPUInfo) int64 { return info.L3CacheKiB }},
+	} {
+		smallest := int64(-1)
+		for _, cpuID := range cpus.UnsortedList() {
+			size := cache.size(topo.CPUDetails[cpuID])
+			if smallest < 0 || size < smallest {
+				smallest = size
+			}
+		}
+		if smallest > 0 {
+			attrs[cache.attribute] = resourceapi.DeviceAttribute{IntValue: ptr.To(smallest)}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSizeAttributes(t *testing.T) {
+	logger := testr.New(t)
+	cpuInfos := make([]cpuinfo.CPUInfo, len(mockCPUInfos_SingleSocket_4CPUS_HT))
+	copy(cpuInfos, mockCPUInfos_SingleSocket_4CPUS_HT)
+	for i := range cpuInfos {
+		cpuInfos[i].L2CacheKiB = 2048
+		cpuInfos[i].L3CacheKiB = 32768
+	}
+	// the CPU 3 has a smaller L2 cache, and no known L3 cache.
+	cpuInfos[3].L2CacheKiB = 1024
+	cpuInfos[3].L3CacheKiB = 0
+
+	driver := newTestDriver(t, cpuInfos, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			if driver.deviceNameToCPUID[dev.Name] == 3 {
+				require.Equal(t, int64(1024), *dev.Attributes[AttributeL2CacheKiB].IntValue, dev.Name)
+				require.NotContains(t, dev.Attributes, AttributeL3CacheKiB, dev.Name)
+				continue
+			}
+			require.Equal(t, int64(2048), *dev.Attributes[AttributeL2CacheKiB].IntValue, dev.Name)
+			require.Equal(t, int64(32768), *dev.Attributes[AttributeL3CacheKiB].IntValue, dev.Name)
+		}
+	}
+
+	// the grouped devices report the smallest caches of their CPUs.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	attrs := driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.Equal(t, int64(1024), *attrs[AttributeL2CacheKiB].IntValue)
+	require.NotContains(t, attrs, AttributeL3CacheKiB)
+
+	// without the sizes, no cache is reported.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	attrs = driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.NotContains(t, attrs, AttributeL2CacheKiB)
+	require.NotContains(t, attrs, AttributeL3CacheKiB)
+}
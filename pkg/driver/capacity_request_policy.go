@@ -0,0 +1,56 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+// minFractionalMilliCPUs is the smallest fraction of a CPU a claim may consume, the smallest CPU quota over the
+// default period.
+const minFractionalMilliCPUs = minCPUQuota * 1000 / defaultCPUPeriod
+
+// cpuCapacityRequestPolicy returns the request policy of the CPU capacity of the grouped devices, nil with
+// CAPACITY_REQUEST_POLICY_NONE. The scheduler rounds the requests up to the next valid value, and the claims
+// without a CPU request consume one CPU, or one core, instead of the whole device.
+func (cp *CPUDriver) cpuCapacityRequestPolicy() *resourceapi.CapacityRequestPolicy {
+	var minimum, step, defaultValue resource.Quantity
+	switch cp.capacityRequestPolicy {
+	case CAPACITY_REQUEST_POLICY_CPUS:
+		defaultValue = *resource.NewQuantity(1, resource.DecimalSI)
+		minimum, step = defaultValue, defaultValue
+		if cp.fractionalCPUs {
+			minimum = *resource.NewMilliQuantity(minFractionalMilliCPUs, resource.DecimalSI)
+			step = *resource.NewMilliQuantity(1, resource.DecimalSI)
+		}
+	case CAPACITY_REQUEST_POLICY_CORES:
+		// without SMT, a core is a CPU.
+		defaultValue = *resource.NewQuantity(int64(cp.cpuTopology.CPUsPerCore()), resource.DecimalSI)
+		minimum, step = defaultValue, defaultValue
+	default:
+		return nil
+	}
+	return &resourceapi.CapacityRequestPolicy{
+		Default: ptr.To(defaultValue),
+		ValidRange: &resourceapi.CapacityRequestPolicyRange{
+			Min:  ptr.To(minimum),
+			Step: ptr.To(step),
+		},
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUCapacityRequestPolicy(t *testing.T) {
+	testCases := []struct {
+		name            string
+		cpuInfos        []cpuinfo.CPUInfo
+		policy          string
+		fractionalCPUs  bool
+		expectedNil     bool
+		expectedDefault string
+		expectedMin     string
+		expectedStep    string
+	}{
+		{
+			name:        "no policy",
+			cpuInfos:    mockCPUInfos_SingleSocket_4CPUS_HT,
+			policy:      CAPACITY_REQUEST_POLICY_NONE,
+			expectedNil: true,
+		},
+		{
+			name:            "whole CPUs",
+			cpuInfos:        mockCPUInfos_SingleSocket_4CPUS_HT,
+			policy:          CAPACITY_REQUEST_POLICY_CPUS,
+			expectedDefault: "1",
+			expectedMin:     "1",
+			expectedStep:    "1",
+		},
+		{
+			name:            "fractional CPUs",
+			cpuInfos:        mockCPUInfos_SingleSocket_4CPUS_HT,
+			policy:          CAPACITY_REQUEST_POLICY_CPUS,
+			fractionalCPUs:  true,
+			expectedDefault: "1",
+			expectedMin:     "10m",
+			expectedStep:    "1m",
+		},
+		{
+			name:            "cores with SMT",
+			cpuInfos:        mockCPUInfos_SingleSocket_4CPUS_HT,
+			policy:          CAPACITY_REQUEST_POLICY_CORES,
+			fractionalCPUs:  true,
+			expectedDefault: "2",
+			expectedMin:     "2",
+			expectedStep:    "2",
+		},
+		{
+			name:            "cores without SMT",
+			cpuInfos:        mockCPUInfos_SingleSocket_4CPUs_HT_Off,
+			policy:          CAPACITY_REQUEST_POLICY_CORES,
+			expectedDefault: "1",
+			expectedMin:     "1",
+			expectedStep:    "1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, tc.cpuInfos, func(cp *CPUDriver) {
+				cp.capacityRequestPolicy = tc.policy
+				cp.fractionalCPUs = tc.fractionalCPUs
+			})
+			for _, chunk := range driver.createGroupedCPUDeviceSlices(testr.New(t)) {
+				for _, device := range chunk {
+					policy := device.Capacity[cpuResourceQualifiedName].RequestPolicy
+					if tc.expectedNil {
+						require.Nil(t, policy)
+						continue
+					}
+					require.NotNil(t, policy)
+					require.Equal(t, tc.expectedDefault, policy.Default.String())
+					require.Equal(t, tc.expectedMin, policy.ValidRange.Min.String())
+					require.Equal(t, tc.expectedStep, policy.ValidRange.Step.String())
+					require.Nil(t, policy.ValidRange.Max)
+				}
+			}
+		})
+	}
+}
@@ -17,8 +17,12 @@ package driver
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdiSpec "tags.cncf.io/container-device-interface/specs-go"
 )
@@ -27,14 +31,82 @@ const (
 	cdiSpecVersion  = "0.8.0"
 	cdiVendor       = "dra.k8s.io"
 	cdiClass        = "cpu"
+	cdiKind         = cdiVendor + "/" + cdiClass
 	cdiEnvVarPrefix = "DRA_CPUSET"
-	cdiSpecDir      = "/var/run/cdi"
+
+	// cdiAnnotationEnvVarPrefix prefixes the env vars carrying passthrough annotations.
+	cdiAnnotationEnvVarPrefix = "DRA_CPU_ANNOTATION"
 )
 
+const (
+	// CDI_PASSTHROUGH_ANNOTATIONS copies the allowed annotations into the CDI device annotations.
+	CDI_PASSTHROUGH_ANNOTATIONS = "annotations"
+	// CDI_PASSTHROUGH_ENV copies the allowed annotations into the container environment.
+	CDI_PASSTHROUGH_ENV = "env"
+)
+
+// cdiDeviceOption customizes the CDI device written for a claim allocation.
+type cdiDeviceOption func(dev *cdiSpec.Device)
+
+// withCDIAnnotations adds the given annotations to the CDI device.
+func withCDIAnnotations(annotations map[string]string) cdiDeviceOption {
+	return func(dev *cdiSpec.Device) {
+		if len(annotations) == 0 {
+			return
+		}
+		if dev.Annotations == nil {
+			dev.Annotations = make(map[string]string, len(annotations))
+		}
+		maps.Copy(dev.Annotations, annotations)
+	}
+}
+
+// withCDIEnv adds the given "KEY=value" entries to the CDI device container edits.
+func withCDIEnv(envs ...string) cdiDeviceOption {
+	return func(dev *cdiSpec.Device) {
+		dev.ContainerEdits.Env = append(dev.ContainerEdits.Env, envs...)
+	}
+}
+
+// annotationEnvVarName returns the env var name carrying an annotation of a claim.
+// Annotation keys are not valid env var names, so all the non-alphanumeric characters become
+// underscores and the result is uppercased: "example.com/my-key" => DRA_CPU_ANNOTATION_<claimUID>_EXAMPLE_COM_MY_KEY.
+func annotationEnvVarName(claimUID types.UID, key string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+	return fmt.Sprintf("%s_%s_%s", cdiAnnotationEnvVarPrefix, claimUID, strings.ToUpper(name))
+}
+
+// annotationEnvVars converts the annotations of a claim into env var entries, sorted by key for stable output.
+func annotationEnvVars(claimUID types.UID, annotations map[string]string) []string {
+	envs := make([]string, 0, len(annotations))
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		envs = append(envs, fmt.Sprintf("%s=%s", annotationEnvVarName(claimUID, key), annotations[key]))
+	}
+	return envs
+}
+
+// validateAnnotationEnvVarNames rejects allow-lists whose keys map to the same env var name,
+// like "a.b/c" and "a-b/c": one of the values would silently override the other.
+func validateAnnotationEnvVarNames(keys []string) error {
+	seen := make(map[string]string, len(keys))
+	for _, key := range keys {
+		name := annotationEnvVarName("", key)
+		if other, ok := seen[name]; ok && other != key {
+			return fmt.Errorf("passthrough annotations %q and %q map to the same env var", other, key)
+		}
+		seen[name] = key
+	}
+	return nil
+}
+
 // CdiManager handles the lifecycle of CDI allocations for the driver.
 type CdiManager struct {
 	cache      *cdiapi.Cache
-	cdiKind    string
 	driverName string
 }
 
@@ -52,7 +124,6 @@ func NewCdiManager(logger logr.Logger, driverName string, cdiDir string) (*CdiMa
 
 	c := &CdiManager{
 		cache:      cache,
-		cdiKind:    fmt.Sprintf("%s/%s", cdiVendor, cdiClass),
 		driverName: driverName,
 	}
 
@@ -62,31 +133,49 @@ func NewCdiManager(logger logr.Logger, driverName string, cdiDir string) (*CdiMa
 
 // getSpecName generates a unique, sanitized filename for a specific device allocation.
 func (c *CdiManager) getSpecName(deviceName string) string {
+	return cdiSpecName(deviceName)
+}
+
+// cdiSpecName generates a unique, sanitized filename for a specific device allocation.
+func cdiSpecName(deviceName string) string {
 	return cdiapi.GenerateTransientSpecName(cdiVendor, cdiClass, deviceName) + ".json"
 }
 
-// AddDevice writes a dedicated CDI spec file for a single device allocation.
-func (c *CdiManager) AddDevice(logger logr.Logger, deviceName string, envVar string) error {
-	specName := c.getSpecName(deviceName)
+// newCDISpec returns the dedicated CDI spec of a single device allocation.
+func newCDISpec(deviceName string, envVar string, opts ...cdiDeviceOption) *cdiSpec.Spec {
+	dev := cdiSpec.Device{
+		Name: deviceName,
+		ContainerEdits: cdiSpec.ContainerEdits{
+			Env: []string{envVar},
+		},
+	}
+	for _, opt := range opts {
+		opt(&dev)
+	}
 
-	spec := &cdiSpec.Spec{
+	return &cdiSpec.Spec{
 		Version: cdiSpecVersion,
-		Kind:    c.cdiKind,
-		Devices: []cdiSpec.Device{
-			{
-				Name: deviceName,
-				ContainerEdits: cdiSpec.ContainerEdits{
-					Env: []string{envVar},
-				},
-			},
-		},
+		Kind:    cdiKind,
+		Devices: []cdiSpec.Device{dev},
 	}
+}
 
+// AddDevice writes a dedicated CDI spec file for a single device allocation.
+func (c *CdiManager) AddDevice(logger logr.Logger, deviceName string, envVar string, opts ...cdiDeviceOption) error {
+	if err := c.writeSpec(newCDISpec(deviceName, envVar, opts...), deviceName); err != nil {
+		return err
+	}
+
+	logger.V(4).Info("Added CDI device", "deviceName", deviceName, "specName", c.getSpecName(deviceName), "env", envVar)
+	return nil
+}
+
+// writeSpec writes the dedicated CDI spec file of a single device allocation.
+func (c *CdiManager) writeSpec(spec *cdiSpec.Spec, deviceName string) error {
+	specName := c.getSpecName(deviceName)
 	if err := c.cache.WriteSpec(spec, specName); err != nil {
 		return fmt.Errorf("failed to write CDI spec %q: %w", specName, err)
 	}
-
-	logger.V(4).Info("Added CDI device", "deviceName", deviceName, "specName", specName, "env", envVar)
 	return nil
 }
 
@@ -0,0 +1,329 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/cpuset"
+	cdiSpec "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// CDI_REPAIR_CREATE writes the missing CDI spec of a prepared claim.
+	CDI_REPAIR_CREATE = "create"
+	// CDI_REPAIR_UPDATE overwrites the CDI spec of a prepared claim which differs from the regenerated one.
+	CDI_REPAIR_UPDATE = "update"
+	// CDI_REPAIR_DELETE removes the CDI spec of a claim which is not prepared on the node anymore.
+	CDI_REPAIR_DELETE = "delete"
+)
+
+// CDISpecChange is a difference between a CDI spec file of a claim and the regenerated one.
+type CDISpecChange struct {
+	// Action is one of the CDI_REPAIR_* values.
+	Action   string
+	ClaimUID types.UID
+	// Path is the CDI spec file.
+	Path string
+	// Current is the spec found on disk, nil if missing or unreadable. Desired is nil for the deleted specs.
+	Current *cdiSpec.Spec
+	Desired *cdiSpec.Spec
+}
+
+// Diff returns a human-readable diff between the current and the desired spec.
+func (c CDISpecChange) Diff() string {
+	return gocmp.Diff(c.Current, c.Desired)
+}
+
+// CDIRepairPlan are the changes rebuilding the CDI specs of the claims prepared on the node.
+type CDIRepairPlan struct {
+	// Changes are sorted by claim UID. They are empty if the CDI specs are consistent with the claims.
+	Changes []CDISpecChange
+	// Errors are the prepared claims whose CDI spec cannot be regenerated, left as they are.
+	Errors  []error
+	specDir string
+}
+
+// PlanCDIRepair rebuilds the CDI specs of the claims prepared on the node from the ResourceClaim objects,
+// and compares them with the spec files. The CPUs recorded in the readable spec files are kept, because the
+// containers already run on them; the CPUs of the other claims are allocated again by replaying their
+// preparation, ordered by claim creation, so the result does not change from one run to the next.
+func PlanCDIRepair(ctx context.Context, clientset kubernetes.Interface, config *Config, cpuInfoProvider CPUInfoProvider) (*CDIRepairPlan, error) {
+	ctx, logger := ctxlog.WithValues(ctx, "driver", config.DriverName)
+	if !config.EnableCDI {
+		return nil, fmt.Errorf("CDI is disabled, the driver runs in NRI-only mode and writes no CDI spec")
+	}
+	topo, err := cpuInfoProvider.GetCPUTopology(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CPU topology: %w", err)
+	}
+	if err := validateReservedCPUs(logger, topo, config.ReservedCPUs); err != nil {
+		return nil, err
+	}
+	if err := validateSocketDeviceModes(topo, config.SocketDeviceModes); err != nil {
+		return nil, err
+	}
+
+	specs := newCDISpecCollector()
+	cp := newCPUDriver(clientset, config)
+	cp.cpuTopology = topo
+	if err := cp.resolveNUMADeviceNames(logger, config, os.DirFS(device.SysfsRoot)); err != nil {
+		return nil, err
+	}
+	if err := cp.resolveCPUPartitions(logger, config, os.DirFS(device.SysfsRoot)); err != nil {
+		return nil, err
+	}
+	cp.cpuAllocationStore = store.NewCPUAllocation(topo, config.ReservedCPUs)
+	cp.podConfigStore = store.NewPodConfig()
+	cp.cdiMgr = specs
+	cp.initializeDeviceLookupMaps()
+	if _, err := cp.verifyPublishedDeviceMappings(ctx); err != nil {
+		logger.Error(err, "failed to verify the device mapping against the published ResourceSlices")
+	}
+
+	claims, err := cp.listPreparedClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	specDir := config.hostPaths().cdiSpecDir
+	current, err := readClaimCDISpecs(logger, specDir)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CDIRepairPlan{specDir: specDir}
+	var replayed []*resourceapi.ResourceClaim
+	for _, claim := range claims {
+		cpus, ok := cp.recordedClaimCPUs(current[claim.UID], claim.UID)
+		if !ok {
+			replayed = append(replayed, claim)
+			continue
+		}
+		if err := cp.restoreClaimSpec(ctx, logger, claim, cpus, current[claim.UID]); err != nil {
+			plan.Errors = append(plan.Errors, fmt.Errorf("claim %s/%s: %w", claim.Namespace, claim.Name, err))
+		}
+	}
+	for _, claim := range replayed {
+		// the trace ID of a lost spec is lost too: derive it from the claim, so it is stable across runs.
+		cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, repairTraceID(claim.UID))
+		result, err := cp.PrepareResourceClaims(ctx, []*resourceapi.ResourceClaim{claim})
+		if err == nil {
+			err = result[claim.UID].Err
+		}
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Errorf("claim %s/%s: %w", claim.Namespace, claim.Name, err))
+		}
+	}
+
+	for claimUID, spec := range specs.specs {
+		change := CDISpecChange{ClaimUID: claimUID, Path: filepath.Join(specDir, cdiSpecName(getCDIDeviceName(claimUID))), Desired: spec}
+		existing, ok := current[claimUID]
+		switch {
+		case !ok || existing == nil:
+			change.Action = CDI_REPAIR_CREATE
+			if ok {
+				change.Action = CDI_REPAIR_UPDATE
+			}
+		case !gocmp.Equal(existing, spec):
+			change.Action = CDI_REPAIR_UPDATE
+			change.Current = existing
+		default:
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	preparedClaims := make(map[types.UID]bool, len(claims))
+	for _, claim := range claims {
+		preparedClaims[claim.UID] = true
+	}
+	for claimUID, existing := range current {
+		// the specs of the claims failing to regenerate are left alone.
+		if _, ok := specs.specs[claimUID]; ok || preparedClaims[claimUID] {
+			continue
+		}
+		plan.Changes = append(plan.Changes, CDISpecChange{
+			Action:   CDI_REPAIR_DELETE,
+			ClaimUID: claimUID,
+			Path:     filepath.Join(specDir, cdiSpecName(getCDIDeviceName(claimUID))),
+			Current:  existing,
+		})
+	}
+	slices.SortFunc(plan.Changes, func(a, b CDISpecChange) int {
+		return cmp.Compare(a.ClaimUID, b.ClaimUID)
+	})
+	return plan, nil
+}
+
+// Apply writes and removes the CDI spec files of the changes.
+func (p *CDIRepairPlan) Apply(logger logr.Logger, driverName string) error {
+	cdiMgr, err := NewCdiManager(logger, driverName, p.specDir)
+	if err != nil {
+		return fmt.Errorf("failed to create CDI manager: %w", err)
+	}
+	var errs []error
+	for _, change := range p.Changes {
+		deviceName := getCDIDeviceName(change.ClaimUID)
+		if change.Action == CDI_REPAIR_DELETE {
+			err = cdiMgr.RemoveDevice(logger, deviceName)
+		} else {
+			err = cdiMgr.writeSpec(change.Desired, deviceName)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info("repaired CDI spec", "action", change.Action, "claimUID", change.ClaimUID, "path", change.Path)
+	}
+	return errors.Join(errs...)
+}
+
+// listPreparedClaims returns the claims allocated from the devices of the node and reserved for a consumer,
+// which the kubelet prepares, ordered by creation.
+func (cp *CPUDriver) listPreparedClaims(ctx context.Context) ([]*resourceapi.ResourceClaim, error) {
+	claimList, err := cp.kubeClient.ResourceV1().ResourceClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ResourceClaims: %w", err)
+	}
+	var claims []*resourceapi.ResourceClaim
+	for i := range claimList.Items {
+		claim := &claimList.Items[i]
+		if claim.Status.Allocation == nil || len(claim.Status.ReservedFor) == 0 {
+			continue
+		}
+		if slices.ContainsFunc(claim.Status.Allocation.Devices.Results, func(result resourceapi.DeviceRequestAllocationResult) bool {
+			return result.Driver == cp.driverName && cp.ownsResourcePool(result.Pool)
+		}) {
+			claims = append(claims, claim)
+		}
+	}
+	slices.SortFunc(claims, func(a, b *resourceapi.ResourceClaim) int {
+		return cmp.Or(a.CreationTimestamp.Compare(b.CreationTimestamp.Time), cmp.Compare(a.UID, b.UID))
+	})
+	return claims, nil
+}
+
+// recordedClaimCPUs returns the CPUs recorded in the CDI spec of a claim, if they can still be assigned to it.
+func (cp *CPUDriver) recordedClaimCPUs(spec *cdiSpec.Spec, claimUID types.UID) (cpuset.CPUSet, bool) {
+	if spec == nil || len(spec.Devices) != 1 {
+		return cpuset.New(), false
+	}
+	allocations, err := parseDRAEnvToClaimAllocations(logr.Discard(), spec.Devices[0].ContainerEdits.Env)
+	if err != nil {
+		return cpuset.New(), false
+	}
+	cpus, ok := allocations[claimUID]
+	if !ok || cpus.IsEmpty() || !cpus.IsSubsetOf(cp.cpuAllocationStore.GetSharedCPUs()) {
+		return cpuset.New(), false
+	}
+	return cpus, true
+}
+
+// restoreClaimSpec regenerates the CDI spec of a claim keeping the CPUs and the trace ID it records.
+func (cp *CPUDriver) restoreClaimSpec(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, cpus cpuset.CPUSet, spec *cdiSpec.Spec) error {
+	envs := spec.Devices[0].ContainerEdits.Env
+	traceID := parseTraceIDEnv(envs)[claim.UID]
+	if traceID == "" {
+		traceID = repairTraceID(claim.UID)
+	}
+	tier, err := cp.claimTier(ctx, logger, claim)
+	if err != nil {
+		return err
+	}
+	cp.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, cpus)
+	cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, traceID)
+	cp.cpuAllocationStore.SetResourceClaimFullCores(claim.UID, parseFullCoresEnv(envs).Has(claim.UID))
+	cp.setClaimTier(claim.UID, tier)
+	_, err = cp.exposeClaimAllocation(ctx, logger, claim, cpus, traceID)
+	return err
+}
+
+// repairTraceID derives a trace ID from the claim UID.
+func repairTraceID(claimUID types.UID) string {
+	sum := sha256.Sum256([]byte(claimUID))
+	return hex.EncodeToString(sum[:])[:traceIDLen]
+}
+
+// readClaimCDISpecs reads the CDI specs of the claims from the spec directory. The unreadable specs are
+// reported as nil, to be overwritten or removed.
+func readClaimCDISpecs(logger logr.Logger, specDir string) (map[types.UID]*cdiSpec.Spec, error) {
+	entries, err := os.ReadDir(specDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read the CDI spec directory: %w", err)
+	}
+	prefix, suffix, _ := strings.Cut(cdiSpecName(getCDIDeviceName("*")), "*")
+	specs := make(map[types.UID]*cdiSpec.Spec)
+	for _, entry := range entries {
+		uid, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		uid, ok = strings.CutSuffix(uid, suffix)
+		if !ok || uid == "" {
+			continue
+		}
+		path := filepath.Join(specDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CDI spec %s: %w", path, err)
+		}
+		spec := &cdiSpec.Spec{}
+		if err := json.Unmarshal(data, spec); err != nil {
+			logger.Error(err, "unreadable CDI spec", "path", path)
+			spec = nil
+		}
+		specs[types.UID(uid)] = spec
+	}
+	return specs, nil
+}
+
+// cdiSpecCollector keeps the CDI specs in memory instead of writing them.
+type cdiSpecCollector struct {
+	specs map[types.UID]*cdiSpec.Spec
+}
+
+func newCDISpecCollector() *cdiSpecCollector {
+	return &cdiSpecCollector{specs: make(map[types.UID]*cdiSpec.Spec)}
+}
+
+func (c *cdiSpecCollector) AddDevice(_ logr.Logger, deviceName string, envVar string, opts ...cdiDeviceOption) error {
+	c.specs[types.UID(strings.TrimPrefix(deviceName, "claim-"))] = newCDISpec(deviceName, envVar, opts...)
+	return nil
+}
+
+func (c *cdiSpecCollector) RemoveDevice(_ logr.Logger, deviceName string) error {
+	delete(c.specs, types.UID(strings.TrimPrefix(deviceName, "claim-")))
+	return nil
+}
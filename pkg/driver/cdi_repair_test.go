@@ -0,0 +1,118 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+)
+
+// testPreparedClaim returns a claim allocated from the node and reserved for a pod, created at the given minute.
+func testPreparedClaim(claimUID types.UID, device string, numCPUs int64, minute int) *resourceapi.ResourceClaim {
+	claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{device: numCPUs})
+	claim.Namespace = "default"
+	claim.CreationTimestamp = metav1.NewTime(time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC))
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "pod-" + string(claimUID), UID: "pod-uid"}}
+	return claim
+}
+
+func TestPlanCDIRepair(t *testing.T) {
+	logger := testr.New(t)
+	specDir := t.TempDir()
+	cdiMgr, err := NewCdiManager(logger, testDriverName, specDir)
+	require.NoError(t, err)
+
+	// the spec of claim-a is intact: its CPUs are kept.
+	require.NoError(t, cdiMgr.AddDevice(logger, getCDIDeviceName("claim-a"), fmt.Sprintf("%s_claim-a=1,5", cdiEnvVarPrefix),
+		withCDIAnnotations(map[string]string{traceIDAnnotation: "0123456789abcdef"}),
+		withCDIEnv(traceIDEnvVar("claim-a", "0123456789abcdef")),
+	))
+	// the spec of claim-c is unreadable, claim-d is not prepared anymore, the spec of claim-b is lost.
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, cdiSpecName(getCDIDeviceName("claim-c"))), []byte("{garbage"), 0600))
+	require.NoError(t, cdiMgr.AddDevice(logger, getCDIDeviceName("claim-d"), fmt.Sprintf("%s_claim-d=2", cdiEnvVarPrefix)))
+
+	unprepared := testPreparedClaim("claim-e", "cpudevnuma001", 1, 0)
+	unprepared.Status.ReservedFor = nil
+	otherNode := testPreparedClaim("claim-f", "cpudevnuma001", 1, 0)
+	otherNode.Status.Allocation.Devices.Results[0].Pool = "other-node"
+	client := fake.NewClientset(
+		testPreparedClaim("claim-c", "cpudevnuma001", 1, 2),
+		testPreparedClaim("claim-b", "cpudevnuma000", 2, 1),
+		testPreparedClaim("claim-a", "cpudevnuma000", 2, 0),
+		unprepared,
+		otherNode,
+	)
+	config := &Config{
+		DriverName:       testDriverName,
+		NodeName:         testNodeName,
+		CPUDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+		CPUDeviceGroupBy: GROUP_BY_NUMA_NODE,
+		EnableCDI:        true,
+		CDISpecDir:       specDir,
+	}
+	provider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+
+	plan, err := PlanCDIRepair(context.Background(), client, config, provider)
+	require.NoError(t, err)
+	require.Empty(t, plan.Errors)
+	actions := make(map[types.UID]string)
+	for _, change := range plan.Changes {
+		actions[change.ClaimUID] = change.Action
+		require.NotEmpty(t, change.Diff())
+	}
+	require.Equal(t, map[types.UID]string{
+		"claim-b": CDI_REPAIR_CREATE,
+		"claim-c": CDI_REPAIR_UPDATE,
+		"claim-d": CDI_REPAIR_DELETE,
+	}, actions)
+
+	// the lost claims get the CPUs left by the kept ones, in creation order.
+	expectedCPUs := map[types.UID]cpuset.CPUSet{"claim-b": cpuset.New(0, 4), "claim-c": cpuset.New(2)}
+	for _, change := range plan.Changes {
+		if change.Desired == nil {
+			continue
+		}
+		allocations, err := parseDRAEnvToClaimAllocations(logger, change.Desired.Devices[0].ContainerEdits.Env)
+		require.NoError(t, err)
+		require.True(t, expectedCPUs[change.ClaimUID].Equals(allocations[change.ClaimUID]), "claim %s: got %s", change.ClaimUID, allocations[change.ClaimUID])
+		require.Contains(t, change.Desired.Devices[0].ContainerEdits.Env, traceIDEnvVar(change.ClaimUID, repairTraceID(change.ClaimUID)))
+	}
+
+	require.NoError(t, plan.Apply(logger, testDriverName))
+	plan, err = PlanCDIRepair(context.Background(), client, config, provider)
+	require.NoError(t, err)
+	require.Empty(t, plan.Changes)
+}
+
+func TestPlanCDIRepairNRIOnly(t *testing.T) {
+	provider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	_, err := PlanCDIRepair(context.Background(), fake.NewClientset(), &Config{DriverName: testDriverName}, provider)
+	require.ErrorContains(t, err, "CDI is disabled")
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/go-logr/logr/testr"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
 	cdiSpec "tags.cncf.io/container-device-interface/specs-go"
 )
 
@@ -115,6 +116,54 @@ func TestAddDevice(t *testing.T) {
 	}
 }
 
+func TestAddDeviceWithOptions(t *testing.T) {
+	logger := testr.New(t)
+	mgr, err := NewCdiManager(logger, testDriverName, t.TempDir())
+	require.NoError(t, err)
+
+	deviceName := "claim-cpu-add-options"
+	err = mgr.AddDevice(logger, deviceName, "CPU=0,1",
+		withCDIAnnotations(map[string]string{"example.com/profile": "low-latency"}),
+		withCDIEnv("FOO=bar"),
+	)
+	require.NoError(t, err)
+
+	expectedSpec := &cdiSpec.Spec{
+		Version: cdiSpecVersion,
+		Kind:    cdiVendor + "/" + cdiClass,
+		Devices: []cdiSpec.Device{
+			{
+				Name:        deviceName,
+				Annotations: map[string]string{"example.com/profile": "low-latency"},
+				ContainerEdits: cdiSpec.ContainerEdits{
+					Env: []string{"CPU=0,1", "FOO=bar"},
+				},
+			},
+		},
+	}
+	got := getSpecFromCache(mgr, mgr.getSpecName(deviceName))
+	if diff := cmp.Diff(expectedSpec, got); diff != "" {
+		t.Errorf("unexpected spec diff: %v", diff)
+	}
+}
+
+func TestAnnotationEnvVars(t *testing.T) {
+	claimUID := types.UID("claim-uid")
+	require.Empty(t, annotationEnvVars(claimUID, nil))
+	require.Equal(t, []string{
+		"DRA_CPU_ANNOTATION_claim-uid_EXAMPLE_COM_MY_KEY=value",
+		"DRA_CPU_ANNOTATION_claim-uid_TIER=gold",
+	}, annotationEnvVars(claimUID, map[string]string{
+		"tier":               "gold",
+		"example.com/my-key": "value",
+	}))
+}
+
+func TestValidateAnnotationEnvVarNames(t *testing.T) {
+	require.NoError(t, validateAnnotationEnvVarNames([]string{"example.com/tier", "example.com/profile", "example.com/tier"}))
+	require.Error(t, validateAnnotationEnvVarNames([]string{"a.b/c", "a-b/c"}))
+}
+
 func TestRemoveDevice(t *testing.T) {
 	testcases := []struct {
 		name          string
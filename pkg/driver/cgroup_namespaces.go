@@ -0,0 +1,92 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// procSelfCgroup is where the cgroup of the driver process is read from.
+	procSelfCgroup = "/proc/self/cgroup"
+	// hostSysfsRoot is where the deployment mounts the cgroup hierarchy of the host, under fs/cgroup, for the
+	// drivers running in their own cgroup namespace.
+	hostSysfsRoot = "/host/sys"
+	// userNamespaceType is the type of the user namespaces in the OCI spec of the containers.
+	userNamespaceType = "user"
+)
+
+// inCgroupNamespace returns true if the process whose cgroup file is given runs in its own cgroup namespace.
+// A namespace shows the cgroup of the process as the root of the hierarchy, and no pod runs in the host root cgroup.
+func inCgroupNamespace(cgroupFile string) (bool, error) {
+	data, err := os.ReadFile(cgroupFile)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		// the cgroup v2 entry: "0::<path>".
+		if cgroup, ok := strings.CutPrefix(line, "0::"); ok {
+			return cgroup == "/", nil
+		}
+	}
+	return false, fmt.Errorf("no cgroup v2 entry in %s", cgroupFile)
+}
+
+// resolveCgroupFS returns the sysfs the cgroups of the containers are read from, with the host paths the runtime
+// reports. In its own cgroup namespace, the default with cgroup v2 for the non-privileged containers, the driver
+// sees only its cgroup under /sys/fs/cgroup, so the host hierarchy is read where the deployment mounts it.
+// Returns nil, disabling the direct reads, if the host hierarchy is not available.
+func resolveCgroupFS(logger logr.Logger, sysfs fs.FS, cgroupFile, hostRoot string) fs.FS {
+	namespaced, err := inCgroupNamespace(cgroupFile)
+	if err != nil {
+		logger.Info("cannot detect the cgroup namespace of the driver, assuming the host one", "err", err)
+		return sysfs
+	}
+	if !namespaced {
+		return sysfs
+	}
+	if _, err := os.Stat(path.Join(hostRoot, cgroupRoot, "cgroup.controllers")); err != nil {
+		logger.Info("the driver runs in its own cgroup namespace and the host cgroup hierarchy is not mounted: the container cgroups can't be read", "hostCgroupRoot", path.Join(hostRoot, cgroupRoot), "err", err)
+		return nil
+	}
+	logger.Info("the driver runs in its own cgroup namespace, reading the container cgroups from the host cgroup hierarchy", "hostCgroupRoot", path.Join(hostRoot, cgroupRoot))
+	return os.DirFS(hostRoot)
+}
+
+// usesUserNamespace returns true if the namespaces include a user namespace. The runtime creates the cgroups of
+// the containers of the user-namespaced pods on the host like the others, and reports their host path: only the
+// view of the containers, through their cgroup namespace, differs.
+func usesUserNamespace(namespaces []*api.LinuxNamespace) bool {
+	for _, ns := range namespaces {
+		if ns.GetType() == userNamespaceType {
+			return true
+		}
+	}
+	return false
+}
+
+// podUsesUserNamespace returns true if the pod, or the container, runs in a user namespace (hostUsers: false).
+func podUsesUserNamespace(pod *api.PodSandbox, ctr *api.Container) bool {
+	return usesUserNamespace(pod.GetLinux().GetNamespaces()) || usesUserNamespace(ctr.GetLinux().GetNamespaces())
+}
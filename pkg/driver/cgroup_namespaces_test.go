@@ -0,0 +1,208 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func writeCgroupFile(t *testing.T, content string) string {
+	t.Helper()
+	cgroupFile := filepath.Join(t.TempDir(), "cgroup")
+	require.NoError(t, os.WriteFile(cgroupFile, []byte(content), 0600))
+	return cgroupFile
+}
+
+func TestInCgroupNamespace(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expected    bool
+		expectedErr bool
+	}{
+		{
+			name:     "own cgroup namespace",
+			content:  "0::/\n",
+			expected: true,
+		},
+		{
+			name:    "host cgroup namespace",
+			content: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-abcd.scope\n",
+		},
+		{
+			name:     "hybrid hierarchy",
+			content:  "12:cpuset:/\n1:name=systemd:/\n0::/\n",
+			expected: true,
+		},
+		{
+			name:        "cgroup v1 only",
+			content:     "12:cpuset:/kubepods/pod1234/abcd\n",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			namespaced, err := inCgroupNamespace(writeCgroupFile(t, tc.content))
+			if tc.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, namespaced)
+		})
+	}
+}
+
+func TestResolveCgroupFS(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{
+		"fs/cgroup/cgroup.controllers": {Data: []byte("cpuset cpu\n")},
+	}
+	hostRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(hostRoot, cgroupRoot, "kubepods", "pod1234", "abcd"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(hostRoot, cgroupRoot, "cgroup.controllers"), []byte("cpuset cpu\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(hostRoot, cgroupRoot, "kubepods", "pod1234", "abcd", "cpuset.cpus"), []byte("1,3\n"), 0600))
+
+	// in the host cgroup namespace, the sysfs of the driver shows the whole hierarchy.
+	cgroupFS := resolveCgroupFS(logger, sysfs, writeCgroupFile(t, "0::/system.slice/dracpu.service\n"), hostRoot)
+	require.Equal(t, fs.FS(sysfs), cgroupFS)
+	// a cgroup file which can't be read assumes the host cgroup namespace.
+	cgroupFS = resolveCgroupFS(logger, sysfs, filepath.Join(t.TempDir(), "missing"), hostRoot)
+	require.Equal(t, fs.FS(sysfs), cgroupFS)
+
+	// in its own cgroup namespace, the driver reads the host hierarchy where it is mounted.
+	cgroupFS = resolveCgroupFS(logger, sysfs, writeCgroupFile(t, "0::/\n"), hostRoot)
+	require.NotNil(t, cgroupFS)
+	cpus, err := readCgroupCPUSet(cgroupFS, "/kubepods/pod1234/abcd")
+	require.NoError(t, err)
+	require.Equal(t, "1,3", cpus.String())
+
+	// without the mount, the container cgroups are not read.
+	cgroupFS = resolveCgroupFS(logger, sysfs, writeCgroupFile(t, "0::/\n"), t.TempDir())
+	require.Nil(t, cgroupFS)
+}
+
+func TestPodUsesUserNamespace(t *testing.T) {
+	userns := &api.LinuxNamespace{Type: userNamespaceType}
+	netns := &api.LinuxNamespace{Type: "network"}
+	testCases := []struct {
+		name     string
+		pod      *api.PodSandbox
+		ctr      *api.Container
+		expected bool
+	}{
+		{
+			name: "host users",
+			pod:  &api.PodSandbox{Linux: &api.LinuxPodSandbox{Namespaces: []*api.LinuxNamespace{netns}}},
+			ctr:  &api.Container{Linux: &api.LinuxContainer{Namespaces: []*api.LinuxNamespace{netns}}},
+		},
+		{
+			name:     "pod user namespace",
+			pod:      &api.PodSandbox{Linux: &api.LinuxPodSandbox{Namespaces: []*api.LinuxNamespace{netns, userns}}},
+			ctr:      &api.Container{},
+			expected: true,
+		},
+		{
+			name:     "container joining the pod user namespace",
+			pod:      &api.PodSandbox{},
+			ctr:      &api.Container{Linux: &api.LinuxContainer{Namespaces: []*api.LinuxNamespace{{Type: userNamespaceType, Path: "/proc/42/ns/user"}}}},
+			expected: true,
+		},
+		{
+			name: "no linux section",
+			pod:  &api.PodSandbox{},
+			ctr:  &api.Container{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, podUsesUserNamespace(tc.pod, tc.ctr))
+		})
+	}
+}
+
+// userNamespacedPod returns a pod with hostUsers: false, and its container, as the runtime reports them.
+func userNamespacedPod(cgroupsPath string, env ...string) (*api.PodSandbox, *api.Container) {
+	pod := &api.PodSandbox{
+		Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1",
+		Linux: &api.LinuxPodSandbox{Namespaces: []*api.LinuxNamespace{{Type: "network"}, {Type: userNamespaceType}}},
+	}
+	ctr := &api.Container{
+		Id: "userns", PodSandboxId: pod.Id, Name: "userns", Env: env,
+		Linux: &api.LinuxContainer{
+			CgroupsPath: cgroupsPath,
+			Namespaces:  []*api.LinuxNamespace{{Type: userNamespaceType, Path: "/proc/42/ns/user"}},
+		},
+	}
+	return pod, ctr
+}
+
+func TestCreateContainerUserNamespace(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.podConfigStore = store.NewPodConfig()
+		cp.claimTracker = store.NewClaimTracker()
+	})
+	pod, ctr := userNamespacedPod("kubepods-pod1234.slice:cri-containerd:userns", fmt.Sprintf("%s_claim-1=%s", cdiEnvVarPrefix, "1,3"))
+
+	adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+	require.NoError(t, err)
+	require.Equal(t, "1,3", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+	state := driver.podConfigStore.GetContainerState(types.UID(pod.Uid), ctr.Name)
+	require.NotNil(t, state)
+	require.Equal(t, []types.UID{"claim-1"}, state.ResourceClaimUIDs())
+}
+
+func TestPostStartContainerUserNamespace(t *testing.T) {
+	logger := testr.New(t)
+	gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_CPUSET_VERIFICATION): true})
+	require.NoError(t, err)
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.featureGates = gates
+		cp.podConfigStore = store.NewPodConfig()
+	})
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(1, 3))
+
+	pod, ctr := userNamespacedPod("kubepods-pod1234.slice:cri-containerd:userns")
+	driver.podConfigStore.SetContainerState(types.UID(pod.Uid), store.NewContainerState(ctr.Name, types.UID(ctr.Id), "claim-1"))
+	// the cgroup of the container is on the host path the runtime reports, whatever the user namespace.
+	driver.cgroupFS = fstest.MapFS{
+		"fs/cgroup/kubepods.slice/kubepods-pod1234.slice/cri-containerd-userns.scope/cpuset.cpus": {Data: []byte("1,3\n")},
+	}
+	mismatches := testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck))
+	require.NoError(t, driver.PostStartContainer(context.Background(), pod, ctr))
+	require.Equal(t, mismatches, testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck)))
+
+	driver.cgroupFS = fstest.MapFS{
+		"fs/cgroup/kubepods.slice/kubepods-pod1234.slice/cri-containerd-userns.scope/cpuset.cpus": {Data: []byte("0-3\n")},
+	}
+	require.NoError(t, driver.PostStartContainer(context.Background(), pod, ctr))
+	require.Equal(t, mismatches+1, testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck)))
+}
@@ -0,0 +1,307 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ClaimParametersAPIVersion is the API version of the versioned opaque configuration of the claims.
+	ClaimParametersAPIVersion = "cpu.dra.x-k8s.io/v1alpha1"
+	// ClaimParametersKind is the kind of the versioned opaque configuration of the claims.
+	ClaimParametersKind = "CPUClaimParameters"
+
+	// SMT_POLICY_SHARED lets the claim share the physical cores with other workloads. This is the default.
+	SMT_POLICY_SHARED = "shared"
+	// SMT_POLICY_FULL_CORES allocates whole physical cores only to the claim, as fullCores does.
+	SMT_POLICY_FULL_CORES = "full-cores"
+)
+
+// CPUClaimParameters is the versioned opaque configuration of the claims, the structured alternative
+// to the unversioned DeviceConfig. It is recognized by its apiVersion and kind.
+type CPUClaimParameters struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// AllCPUs requests all the allocatable CPUs of the allocated grouped device, whatever the consumed
+	// capacity: the request fails unless the device is free.
+	AllCPUs *bool `json:"allCPUs,omitempty"`
+	// SystemCPUs requests this number of the reserved CPUs of the allocated grouped device, for the
+	// privileged system workloads of the namespaces of --system-claim-namespaces. Exclusive with allCPUs.
+	SystemCPUs int `json:"systemCPUs,omitempty"`
+	// FullCores is the shorthand of the SMT_POLICY_FULL_CORES smtPolicy.
+	FullCores *bool `json:"fullCores,omitempty"`
+	// SMTPolicy is whether the claim shares its physical cores with other workloads when SMT is enabled:
+	// SMT_POLICY_SHARED allows it, SMT_POLICY_FULL_CORES allocates whole cores only to the claim.
+	// Defaults to SMT_POLICY_FULL_CORES with fullCores and to SMT_POLICY_SHARED without, left unset, as the
+	// SMT policy of the earlier configurations, when neither is set.
+	SMTPolicy string `json:"smtPolicy,omitempty"`
+	// RequireFullCores rounds the CPUs of the claim up to whole physical cores when SMT is enabled, allocating
+	// the siblings of its CPUs to it too, where the SMT_POLICY_FULL_CORES smtPolicy fails the preparation.
+	RequireFullCores *bool `json:"requireFullCores,omitempty"`
+	// Placement holds the hints picking the CPUs of the request.
+	Placement *PlacementHints `json:"placement,omitempty"`
+	// Tuning holds the settings of the containers consuming the claim.
+	Tuning *TuningParameters `json:"tuning,omitempty"`
+}
+
+// PlacementHints are the hints picking the CPUs of a request.
+type PlacementHints struct {
+	// Strategy overrides --allocation-policy and --cpu-sorting-strategy for the request:
+	// ALLOCATION_STRATEGY_PACKED packs the CPUs on as few cores and caches as possible,
+	// ALLOCATION_STRATEGY_SPREAD spreads them across the cores and ALLOCATION_STRATEGY_DISTRIBUTED
+	// evenly across the NUMA nodes of the device.
+	Strategy string `json:"strategy,omitempty"`
+	// L3AntiAffinity takes the CPUs of the claim from the L3 caches no other claim uses, when enough of
+	// them are free, so the claim has its last level cache to itself.
+	L3AntiAffinity *bool `json:"l3AntiAffinity,omitempty"`
+	// PreferredNUMANode takes the CPUs of the request from this NUMA node when the allocated device spans
+	// several and the node has enough of them available, else from any NUMA node of the device.
+	PreferredNUMANode *int `json:"preferredNUMANode,omitempty"`
+	// RequiredNUMANode takes the CPUs of the request from this NUMA node only: the preparation of the claim
+	// fails if the allocated device hasn't enough of them available there. Mutually exclusive with
+	// PreferredNUMANode.
+	RequiredNUMANode *int `json:"requiredNUMANode,omitempty"`
+	// CoreType takes the CPUs of the request from the cores of this type only on the hybrid parts, even when the
+	// allocated device has both: CORE_TYPE_PERFORMANCE, CORE_TYPE_EFFICIENCY or CORE_TYPE_ANY, the default. The
+	// preparation of the claim fails if the device hasn't enough of them available.
+	CoreType string `json:"coreType,omitempty"`
+}
+
+// TuningParameters are the settings of the containers consuming the claim. They apply to the whole claim.
+type TuningParameters struct {
+	// BorrowIdleCPUs lets the containers also run on the shared CPUs no exclusive claim is allocated,
+	// until an exclusive claim needs them back.
+	BorrowIdleCPUs *bool `json:"borrowIdleCPUs,omitempty"`
+	// DisableCPUQuota removes the CPU quota of the containers, so they are never throttled on their
+	// exclusive CPUs.
+	DisableCPUQuota *bool `json:"disableCPUQuota,omitempty"`
+	// DisableNUMABalancing confines the memory of the containers to the NUMA nodes of their CPUs, leaving
+	// the automatic NUMA balancing no remote node to migrate their pages to.
+	DisableNUMABalancing *bool `json:"disableNUMABalancing,omitempty"`
+	// PodLevelPinning pins all the containers of the pods the claim is reserved for to the claim CPUs,
+	// and not only the containers consuming the claim.
+	PodLevelPinning *bool `json:"podLevelPinning,omitempty"`
+	// StrictEnforcement fails the preparation of the claim, retried by the kubelet, while the driver can't
+	// enforce its CPUs, instead of preparing it without pinning the containers.
+	StrictEnforcement *bool `json:"strictEnforcement,omitempty"`
+	// Profile applies the bundle of tunings of a profile to the claim CPUs while the claim is prepared:
+	// PROFILE_LOW_LATENCY is the only profile.
+	Profile string `json:"profile,omitempty"`
+	// CPUProfile is the name of the cluster-scoped CPUProfile whose settings apply to the claim CPUs while the
+	// claim is prepared, taking precedence over the ones of Profile.
+	CPUProfile string `json:"cpuProfile,omitempty"`
+}
+
+// decodeClaimParameters decodes the versioned opaque configuration strictly, so misspelled fields are
+// reported instead of being ignored, then defaults and validates it.
+func decodeClaimParameters(raw []byte) (*CPUClaimParameters, error) {
+	params := &CPUClaimParameters{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(params); err != nil {
+		return nil, err
+	}
+	params.setDefaults()
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// setDefaults fills in the SMT policy from fullCores when only fullCores is set.
+func (p *CPUClaimParameters) setDefaults() {
+	if p.SMTPolicy != "" || p.FullCores == nil {
+		return
+	}
+	p.SMTPolicy = SMT_POLICY_SHARED
+	if *p.FullCores {
+		p.SMTPolicy = SMT_POLICY_FULL_CORES
+	}
+}
+
+// validate returns all the errors of the defaulted parameters.
+func (p *CPUClaimParameters) validate() error {
+	var errs []error
+	if p.SystemCPUs < 0 {
+		errs = append(errs, fmt.Errorf("systemCPUs must not be negative, got %d", p.SystemCPUs))
+	}
+	if ptr.Deref(p.AllCPUs, false) && p.SystemCPUs > 0 {
+		errs = append(errs, errors.New("allCPUs and systemCPUs are mutually exclusive"))
+	}
+	switch p.SMTPolicy {
+	case "", SMT_POLICY_SHARED, SMT_POLICY_FULL_CORES:
+		if p.FullCores != nil && *p.FullCores != (p.SMTPolicy == SMT_POLICY_FULL_CORES) {
+			errs = append(errs, fmt.Errorf("fullCores conflicts with smtPolicy %q", p.SMTPolicy))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid smtPolicy %q, must be %s or %s", p.SMTPolicy, SMT_POLICY_SHARED, SMT_POLICY_FULL_CORES))
+	}
+	if p.Placement != nil {
+		switch p.Placement.Strategy {
+		case "", ALLOCATION_STRATEGY_PACKED, ALLOCATION_STRATEGY_SPREAD, ALLOCATION_STRATEGY_DISTRIBUTED:
+		default:
+			errs = append(errs, fmt.Errorf("invalid placement strategy %q, must be %s, %s or %s", p.Placement.Strategy, ALLOCATION_STRATEGY_PACKED, ALLOCATION_STRATEGY_SPREAD, ALLOCATION_STRATEGY_DISTRIBUTED))
+		}
+		if p.Placement.PreferredNUMANode != nil && p.Placement.RequiredNUMANode != nil {
+			errs = append(errs, errors.New("placement preferredNUMANode and requiredNUMANode are mutually exclusive"))
+		}
+		if p.Placement.PreferredNUMANode != nil && *p.Placement.PreferredNUMANode < 0 {
+			errs = append(errs, fmt.Errorf("placement preferredNUMANode must not be negative, got %d", *p.Placement.PreferredNUMANode))
+		}
+		if p.Placement.RequiredNUMANode != nil && *p.Placement.RequiredNUMANode < 0 {
+			errs = append(errs, fmt.Errorf("placement requiredNUMANode must not be negative, got %d", *p.Placement.RequiredNUMANode))
+		}
+	}
+	if p.Tuning != nil {
+		switch p.Tuning.Profile {
+		case "", PROFILE_LOW_LATENCY:
+		default:
+			errs = append(errs, fmt.Errorf("invalid tuning profile %q, must be %s", p.Tuning.Profile, PROFILE_LOW_LATENCY))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyTo sets the settings of the parameters in the device configuration. Like the unversioned
+// configurations, the parameters only set what they specify, so the later configurations override
+// the earlier ones, false included.
+func (p *CPUClaimParameters) applyTo(config *DeviceConfig) {
+	assignBool(&config.AllCPUs, p.AllCPUs)
+	if p.SystemCPUs > 0 {
+		config.SystemCPUs = p.SystemCPUs
+	}
+	if p.SMTPolicy != "" {
+		config.FullPCPUsOnly = p.SMTPolicy == SMT_POLICY_FULL_CORES
+	}
+	assignBool(&config.RequireFullCores, p.RequireFullCores)
+	if p.Placement != nil {
+		if p.Placement.Strategy != "" {
+			config.AllocationStrategy = p.Placement.Strategy
+		}
+		assignBool(&config.L3AntiAffinity, p.Placement.L3AntiAffinity)
+		if p.Placement.PreferredNUMANode != nil {
+			config.PreferredNUMANode = p.Placement.PreferredNUMANode
+		}
+		if p.Placement.RequiredNUMANode != nil {
+			config.RequiredNUMANode = p.Placement.RequiredNUMANode
+		}
+		if p.Placement.CoreType != "" {
+			config.CoreType = p.Placement.CoreType
+		}
+	}
+	if p.Tuning != nil {
+		assignBool(&config.BorrowIdleCPUs, p.Tuning.BorrowIdleCPUs)
+		assignBool(&config.DisableCPUQuota, p.Tuning.DisableCPUQuota)
+		assignBool(&config.DisableNUMABalancing, p.Tuning.DisableNUMABalancing)
+		assignBool(&config.PodLevelPinning, p.Tuning.PodLevelPinning)
+		assignBool(&config.StrictEnforcement, p.Tuning.StrictEnforcement)
+		if p.Tuning.Profile != "" {
+			config.Profile = p.Tuning.Profile
+		}
+		if p.Tuning.CPUProfile != "" {
+			config.CPUProfile = p.Tuning.CPUProfile
+		}
+	}
+}
+
+// assignBool sets the setting to the value of the parameter, when the parameter is set.
+func assignBool(setting *bool, parameter *bool) {
+	if parameter != nil {
+		*setting = *parameter
+	}
+}
+
+// decodeDeviceConfig decodes an opaque configuration of the driver into the device configuration: the
+// versioned CPUClaimParameters when the configuration carries an apiVersion or a kind, the unversioned
+// DeviceConfig otherwise. The core type is validated here for both, so the admission and the preparation
+// of the claims refuse the same values.
+func decodeDeviceConfig(raw []byte, config *DeviceConfig) error {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return err
+	}
+	if typeMeta.APIVersion == "" && typeMeta.Kind == "" {
+		if err := json.Unmarshal(raw, config); err != nil {
+			return err
+		}
+		return validateCoreType(config.CoreType)
+	}
+	if typeMeta.APIVersion != ClaimParametersAPIVersion || typeMeta.Kind != ClaimParametersKind {
+		return fmt.Errorf("unsupported configuration %s %s, must be %s %s", typeMeta.APIVersion, typeMeta.Kind, ClaimParametersAPIVersion, ClaimParametersKind)
+	}
+	params, err := decodeClaimParameters(raw)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", ClaimParametersKind, err)
+	}
+	params.applyTo(config)
+	return validateCoreType(config.CoreType)
+}
+
+// claimParameters are the settings of the opaque configurations, by their dotted path in the CPUClaimParameters,
+// with whether a decoded DeviceConfig sets them. The unversioned spellings of a setting have the same path, e.g.
+// fullPCPUsOnly and fullCores are smtPolicy.
+var claimParameters = []struct {
+	path string
+	set  func(config DeviceConfig) bool
+}{
+	{path: "allCPUs", set: func(config DeviceConfig) bool { return config.AllCPUs }},
+	{path: "systemCPUs", set: func(config DeviceConfig) bool { return config.SystemCPUs > 0 }},
+	{path: "smtPolicy", set: func(config DeviceConfig) bool { return config.FullPCPUsOnly }},
+	{path: "requireFullCores", set: func(config DeviceConfig) bool { return config.RequireFullCores }},
+	{path: "placement.strategy", set: func(config DeviceConfig) bool { return config.AllocationStrategy != "" }},
+	{path: "placement.l3AntiAffinity", set: func(config DeviceConfig) bool { return config.L3AntiAffinity }},
+	{path: "placement.preferredNUMANode", set: func(config DeviceConfig) bool { return config.PreferredNUMANode != nil }},
+	{path: "placement.requiredNUMANode", set: func(config DeviceConfig) bool { return config.RequiredNUMANode != nil }},
+	{path: "placement.coreType", set: func(config DeviceConfig) bool { return config.CoreType != "" }},
+	{path: "tuning.borrowIdleCPUs", set: func(config DeviceConfig) bool { return config.BorrowIdleCPUs }},
+	{path: "tuning.disableCPUQuota", set: func(config DeviceConfig) bool { return config.DisableCPUQuota }},
+	{path: "tuning.disableNUMABalancing", set: func(config DeviceConfig) bool { return config.DisableNUMABalancing }},
+	{path: "tuning.podLevelPinning", set: func(config DeviceConfig) bool { return config.PodLevelPinning }},
+	{path: "tuning.strictEnforcement", set: func(config DeviceConfig) bool { return config.StrictEnforcement }},
+	{path: "tuning.profile", set: func(config DeviceConfig) bool { return config.Profile != "" }},
+	{path: "tuning.cpuProfile", set: func(config DeviceConfig) bool { return config.CPUProfile != "" }},
+}
+
+// ClaimParameterPaths returns the dotted paths of all the settings of the opaque configurations, e.g.
+// placement.coreType.
+func ClaimParameterPaths() []string {
+	paths := make([]string, 0, len(claimParameters))
+	for _, parameter := range claimParameters {
+		paths = append(paths, parameter.path)
+	}
+	return paths
+}
+
+// SetClaimParameters returns the dotted paths of the settings a decoded opaque configuration sets, whichever
+// the spelling of its parameters, versioned or not, e.g. to deny some settings at admission. The settings left
+// to their defaults, like the shared smtPolicy, are not reported.
+func SetClaimParameters(config DeviceConfig) []string {
+	var paths []string
+	for _, parameter := range claimParameters {
+		if parameter.set(config) {
+			paths = append(paths, parameter.path)
+		}
+	}
+	return paths
+}
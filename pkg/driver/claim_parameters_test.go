@@ -0,0 +1,250 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDecodeDeviceConfig(t *testing.T) {
+	testCases := []struct {
+		name           string
+		parameters     string
+		expectedConfig DeviceConfig
+		expectedErr    string
+	}{
+		{
+			name:           "unversioned",
+			parameters:     `{"fullPCPUsOnly": true, "allocationStrategy": "spread"}`,
+			expectedConfig: DeviceConfig{FullPCPUsOnly: true, AllocationStrategy: ALLOCATION_STRATEGY_SPREAD},
+		},
+		{
+			name:           "full cores",
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCores": true}`,
+			expectedConfig: DeviceConfig{FullPCPUsOnly: true},
+		},
+		{
+			name:           "smt policy",
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "smtPolicy": "full-cores"}`,
+			expectedConfig: DeviceConfig{FullPCPUsOnly: true},
+		},
+		{
+			name:           "placement",
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"strategy": "distributed", "l3AntiAffinity": true}}`,
+			expectedConfig: DeviceConfig{AllocationStrategy: ALLOCATION_STRATEGY_DISTRIBUTED, L3AntiAffinity: true},
+		},
+		{
+			name:           "tuning",
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "tuning": {"disableCPUQuota": true, "podLevelPinning": true}}`,
+			expectedConfig: DeviceConfig{DisableCPUQuota: true, PodLevelPinning: true},
+		},
+		{
+			name:           "tuning profile",
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "tuning": {"profile": "low-latency"}}`,
+			expectedConfig: DeviceConfig{Profile: PROFILE_LOW_LATENCY},
+		},
+		{
+			name:        "invalid tuning profile",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "tuning": {"profile": "realtime"}}`,
+			expectedErr: `invalid tuning profile "realtime"`,
+		},
+		{
+			name:        "tuning outside its group",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "disableCPUQuota": true}`,
+			expectedErr: `unknown field "disableCPUQuota"`,
+		},
+		{
+			name:        "unknown field",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCore": true}`,
+			expectedErr: `unknown field "fullCore"`,
+		},
+		{
+			name:        "unsupported version",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1", "kind": "CPUClaimParameters"}`,
+			expectedErr: "unsupported configuration",
+		},
+		{
+			name:        "conflicting smt policy",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCores": true, "smtPolicy": "shared"}`,
+			expectedErr: "fullCores conflicts with smtPolicy",
+		},
+		{
+			name:        "invalid placement strategy",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"strategy": "random"}}`,
+			expectedErr: `invalid placement strategy "random"`,
+		},
+		{
+			name:        "invalid placement core type",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"coreType": "p-core"}}`,
+			expectedErr: `invalid coreType "p-core"`,
+		},
+		{
+			name:        "preferred and required NUMA nodes",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"preferredNUMANode": 0, "requiredNUMANode": 1}}`,
+			expectedErr: "mutually exclusive",
+		},
+		{
+			name:        "all and system CPUs",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "allCPUs": true, "systemCPUs": 1}`,
+			expectedErr: "mutually exclusive",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config DeviceConfig
+			err := decodeDeviceConfig([]byte(tc.parameters), &config)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
+
+func TestDeviceConfigForRequestMixedParameters(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	claim := testClaim(types.UID("claim-params"), testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	testClaimAllCPUs(claim, `{"strictEnforcement": true}`)
+	testClaimAllCPUs(claim, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCores": true}`)
+
+	config, err := driver.deviceConfigForRequest(claim, claim.Status.Allocation.Devices.Results[0].Request)
+	require.NoError(t, err)
+	// the versioned parameters don't reset the settings of the earlier configuration.
+	require.Equal(t, DeviceConfig{FullPCPUsOnly: true, StrictEnforcement: true}, config)
+}
+
+func TestDeviceConfigForRequestResetParameters(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	claim := testClaim(types.UID("claim-params"), testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	testClaimAllCPUs(claim, `{"fullPCPUsOnly": true, "strictEnforcement": true, "l3AntiAffinity": true}`)
+	testClaimAllCPUs(claim, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "smtPolicy": "shared", "tuning": {"strictEnforcement": false}}`)
+
+	config, err := driver.deviceConfigForRequest(claim, claim.Status.Allocation.Devices.Results[0].Request)
+	require.NoError(t, err)
+	// the versioned parameters set to false reset the settings of the earlier configuration, the others are kept.
+	require.Equal(t, DeviceConfig{L3AntiAffinity: true}, config)
+}
+
+func TestSetClaimParameters(t *testing.T) {
+	testCases := []struct {
+		name          string
+		parameters    string
+		expectedPaths []string
+	}{
+		{
+			name:       "defaults",
+			parameters: `{}`,
+		},
+		{
+			name:          "unversioned parameters",
+			parameters:    `{"fullPCPUsOnly": true, "coreType": "efficiency", "profile": "low-latency"}`,
+			expectedPaths: []string{"smtPolicy", "placement.coreType", "tuning.profile"},
+		},
+		{
+			name:          "versioned parameters",
+			parameters:    `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "fullCores": true, "placement": {"requiredNUMANode": 0}, "tuning": {"borrowIdleCPUs": true}}`,
+			expectedPaths: []string{"smtPolicy", "placement.requiredNUMANode", "tuning.borrowIdleCPUs"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config DeviceConfig
+			require.NoError(t, decodeDeviceConfig([]byte(tc.parameters), &config))
+			paths := SetClaimParameters(config)
+			require.Equal(t, tc.expectedPaths, paths)
+			require.Subset(t, ClaimParameterPaths(), paths)
+		})
+	}
+}
+
+func TestDeviceConfigForSubrequests(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	claim := testClaimWithResults(types.UID("claim-subrequests"), []resourceapi.DeviceRequestAllocationResult{
+		{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma000", Request: "cpus/whole-cores"},
+		{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma001", Request: "other/any"},
+	})
+	for requests, parameters := range map[string]string{
+		"cpus":             `{"strictEnforcement": true}`,
+		"cpus/whole-cores": `{"fullPCPUsOnly": true}`,
+		"cpus/any":         `{"allocationStrategy": "spread"}`,
+		"other/any":        `{"podLevelPinning": true}`,
+	} {
+		claim.Status.Allocation.Devices.Config = append(claim.Status.Allocation.Devices.Config, resourceapi.DeviceAllocationConfiguration{
+			Source:   resourceapi.AllocationConfigSourceClaim,
+			Requests: []string{requests},
+			DeviceConfiguration: resourceapi.DeviceConfiguration{
+				Opaque: &resourceapi.OpaqueDeviceConfiguration{
+					Driver:     testDriverName,
+					Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+				},
+			},
+		})
+	}
+
+	tests := []struct {
+		name     string
+		request  string
+		expected DeviceConfig
+	}{
+		{
+			name:     "main request",
+			request:  "cpus",
+			expected: DeviceConfig{StrictEnforcement: true},
+		},
+		{
+			name:     "subrequest with its own parameters",
+			request:  "cpus/whole-cores",
+			expected: DeviceConfig{FullPCPUsOnly: true, StrictEnforcement: true},
+		},
+		{
+			name:     "other subrequest of the same request",
+			request:  "cpus/any",
+			expected: DeviceConfig{AllocationStrategy: ALLOCATION_STRATEGY_SPREAD, StrictEnforcement: true},
+		},
+		{
+			name:     "subrequest without parameters",
+			request:  "cpus/other",
+			expected: DeviceConfig{StrictEnforcement: true},
+		},
+		{
+			name:     "subrequest of another request",
+			request:  "other/any",
+			expected: DeviceConfig{PodLevelPinning: true},
+		},
+		{
+			name:     "same subrequest name under another request",
+			request:  "another/any",
+			expected: DeviceConfig{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := driver.deviceConfigForRequest(claim, tt.request)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, config)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// ClaimConditionPrepared is true once the CPUs of the claim are allocated on the node.
+	ClaimConditionPrepared = "Prepared"
+	// ClaimConditionEnforced is true once a container consuming the claim is pinned to its CPUs.
+	ClaimConditionEnforced = "Enforced"
+	// ClaimConditionDegraded is true while the pinning of the claim is not fully effective.
+	ClaimConditionDegraded = "Degraded"
+	// ClaimConditionL3AntiAffinity is true if the CPUs of a claim requesting L3 anti-affinity share no uncore
+	// cache with other claims, false if the allocation fell back to shared uncore caches.
+	ClaimConditionL3AntiAffinity = "L3AntiAffinity"
+)
+
+const (
+	// claimStatusTimeout bounds each update of the status of a claim.
+	claimStatusTimeout = 10 * time.Second
+	// claimStatusRetryInterval is how long a failed update of the status of a claim waits before the next attempt.
+	claimStatusRetryInterval = 5 * time.Second
+)
+
+// claimStatus is the status the driver maintains for the devices of a claim.
+type claimStatus struct {
+	namespace  string
+	name       string
+	devices    []resourceapi.DeviceRequestAllocationResult
+	conditions []metav1.Condition
+}
+
+// claimStatusReporter maintains the conditions of the devices of the prepared claims in the claim status,
+// so `kubectl describe resourceclaim` tells how the claim is enforced. The conditions are recorded
+// in memory by the hooks, which never wait for the API server, and written in the background.
+type claimStatusReporter struct {
+	client     kubernetes.Interface
+	driverName string
+	lock       sync.Mutex
+	claims     map[types.UID]*claimStatus
+	dirty      sets.Set[types.UID]
+	wakeup     chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func newClaimStatusReporter(client kubernetes.Interface, driverName string) *claimStatusReporter {
+	return &claimStatusReporter{
+		client:     client,
+		driverName: driverName,
+		claims:     make(map[types.UID]*claimStatus),
+		dirty:      sets.New[types.UID](),
+		wakeup:     make(chan struct{}, 1),
+	}
+}
+
+// track starts maintaining the status of the devices of the driver allocated to the claim.
+func (r *claimStatusReporter) track(claim *resourceapi.ResourceClaim) {
+	if r == nil || claim.Status.Allocation == nil {
+		return
+	}
+	var devices []resourceapi.DeviceRequestAllocationResult
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver == r.driverName {
+			devices = append(devices, result)
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if status, ok := r.claims[claim.UID]; ok {
+		status.devices = devices
+		return
+	}
+	r.claims[claim.UID] = &claimStatus{namespace: claim.Namespace, name: claim.Name, devices: devices}
+}
+
+// setCondition records a condition of the devices of a tracked claim, to be written in the background.
+// The transition time changes only if the status does.
+func (r *claimStatusReporter) setCondition(claimUID types.UID, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	claim, ok := r.claims[claimUID]
+	if !ok {
+		r.lock.Unlock()
+		return
+	}
+	changed := meta.SetStatusCondition(&claim.conditions, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	if changed {
+		r.dirty.Insert(claimUID)
+	}
+	r.lock.Unlock()
+	if changed {
+		r.kick()
+	}
+}
+
+// forget stops maintaining the status of the claim. The status goes away with the allocation of the claim.
+func (r *claimStatusReporter) forget(claimUID types.UID) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.claims, claimUID)
+	r.dirty.Delete(claimUID)
+}
+
+// conditions returns a copy of the conditions recorded for the claim.
+func (r *claimStatusReporter) conditions(claimUID types.UID) []metav1.Condition {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	claim, ok := r.claims[claimUID]
+	if !ok {
+		return nil
+	}
+	return slices.Clone(claim.conditions)
+}
+
+func (r *claimStatusReporter) kick() {
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+		// an update is already pending, it will include this change.
+	}
+}
+
+// run writes the changed claim statuses on each change, until the context is cancelled.
+func (r *claimStatusReporter) run(ctx context.Context) {
+	logger := ctxlog.FromContext(ctx).WithName("claim-status")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wakeup:
+		}
+		if failed := r.flush(ctx, logger); failed > 0 {
+			time.AfterFunc(claimStatusRetryInterval, r.kick)
+		}
+	}
+}
+
+// flush writes the status of the changed claims, and returns how many updates failed.
+func (r *claimStatusReporter) flush(ctx context.Context, logger logr.Logger) int {
+	r.lock.Lock()
+	pending := make(map[types.UID]claimStatus, r.dirty.Len())
+	for claimUID := range r.dirty {
+		claim := r.claims[claimUID]
+		pending[claimUID] = claimStatus{namespace: claim.namespace, name: claim.name, devices: claim.devices, conditions: slices.Clone(claim.conditions)}
+	}
+	r.dirty.Clear()
+	r.lock.Unlock()
+
+	failed := 0
+	for claimUID, status := range pending {
+		if err := r.update(ctx, claimUID, status); err != nil {
+			logger.Error(err, "cannot update the claim status", "claim", status.namespace+"/"+status.name, "claimUID", claimUID)
+			r.lock.Lock()
+			if _, ok := r.claims[claimUID]; ok {
+				r.dirty.Insert(claimUID)
+			}
+			r.lock.Unlock()
+			failed++
+		}
+	}
+	return failed
+}
+
+// update writes the conditions of the devices of the driver in the status of the claim,
+// leaving the entries of the other drivers as they are.
+func (r *claimStatusReporter) update(ctx context.Context, claimUID types.UID, status claimStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, claimStatusTimeout)
+	defer cancel()
+	claims := r.client.ResourceV1().ResourceClaims(status.namespace)
+	claim, err := claims.Get(ctx, status.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if claim.UID != claimUID {
+		return fmt.Errorf("claim %s/%s has UID %s, expected %s", status.namespace, status.name, claim.UID, claimUID)
+	}
+	for _, device := range status.devices {
+		entry := resourceapi.AllocatedDeviceStatus{
+			Driver:     device.Driver,
+			Pool:       device.Pool,
+			Device:     device.Device,
+			Conditions: status.conditions,
+		}
+		if device.ShareID != nil {
+			// the shared allocations of a device have an entry each.
+			entry.ShareID = ptr.To(string(*device.ShareID))
+		}
+		i := slices.IndexFunc(claim.Status.Devices, func(existing resourceapi.AllocatedDeviceStatus) bool {
+			return existing.Driver == entry.Driver && existing.Pool == entry.Pool && existing.Device == entry.Device && ptr.Equal(existing.ShareID, entry.ShareID)
+		})
+		if i < 0 {
+			claim.Status.Devices = append(claim.Status.Devices, entry)
+		} else {
+			claim.Status.Devices[i].Conditions = entry.Conditions
+		}
+	}
+	_, err = claims.UpdateStatus(ctx, claim, metav1.UpdateOptions{})
+	return err
+}
+
+// Name implements Component.
+func (r *claimStatusReporter) Name() string {
+	return COMPONENT_CLAIM_STATUS
+}
+
+// Start writes the claim statuses in the background.
+func (r *claimStatusReporter) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		r.run(ctx)
+	}()
+	return nil
+}
+
+// Stop stops writing the claim statuses, waiting for the update in progress, if any.
+func (r *claimStatusReporter) Stop(ctx context.Context) {
+	r.cancel()
+	<-r.done
+}
+
+// Healthy implements Component. The failed updates are retried.
+func (r *claimStatusReporter) Healthy() error {
+	return nil
+}
+
+// reportPrepareResult records the outcome of the preparation of the claim.
+func (cp *CPUDriver) reportPrepareResult(claim *resourceapi.ResourceClaim, result kubeletplugin.PrepareResult) {
+	if cp.claimStatus == nil {
+		return
+	}
+	cp.claimStatus.track(claim)
+	if result.Err != nil {
+		cp.claimStatus.setCondition(claim.UID, ClaimConditionPrepared, metav1.ConditionFalse, "PrepareFailed", result.Err.Error())
+		return
+	}
+	message := "the containers run on the shared CPUs"
+	if cpus, ok := cp.cpuAllocationStore.GetResourceClaimAllocation(claim.UID); ok {
+		message = fmt.Sprintf("CPUs %s allocated", cpus.String())
+	}
+	cp.claimStatus.setCondition(claim.UID, ClaimConditionPrepared, metav1.ConditionTrue, "CPUsAllocated", message)
+}
+
+// reportEnforced records that a container consuming the claims was pinned to their CPUs. The pinning
+// is degraded on the runtimes which don't apply the container updates.
+func (cp *CPUDriver) reportEnforced(claimUIDs []types.UID, podName, containerName string, cpus cpuset.CPUSet) {
+	if cp.claimStatus == nil {
+		return
+	}
+	for _, claimUID := range claimUIDs {
+		cp.claimStatus.setCondition(claimUID, ClaimConditionEnforced, metav1.ConditionTrue, "ContainerPinned", fmt.Sprintf("container %s of pod %s pinned to CPUs %s", containerName, podName, cpus.String()))
+		if cp.nriSupervisor.Runtime().ContainerUpdates {
+			cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionFalse, "AsExpected", "the CPUs are pinned and kept up to date")
+		} else {
+			cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionTrue, "CreateTimePinningOnly", "the runtime does not apply the container updates: the CPUs are pinned only at container creation")
+		}
+	}
+}
+
+// reportCPUSetMismatch records that the cgroup of a container consuming the claims doesn't run on their CPUs.
+func (cp *CPUDriver) reportCPUSetMismatch(claimUIDs []types.UID, podName, containerName string, actual cpuset.CPUSet) {
+	if cp.claimStatus == nil {
+		return
+	}
+	for _, claimUID := range claimUIDs {
+		cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionTrue, "CPUSetMismatch", fmt.Sprintf("container %s of pod %s runs on CPUs %s", containerName, podName, actual.String()))
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestClaimStatusReporter(t *testing.T) {
+	logger := testr.New(t)
+	claim := testClaim("claim-status", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	claim.Namespace = "default"
+	// the entries of the other drivers are left as they are.
+	claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results, resourceapi.DeviceRequestAllocationResult{
+		Driver: "gpu.example.com", Pool: testNodeName, Device: "gpu0",
+	})
+	claim.Status.Devices = []resourceapi.AllocatedDeviceStatus{
+		{Driver: "gpu.example.com", Pool: testNodeName, Device: "gpu0", Conditions: []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"}}},
+	}
+	client := fake.NewClientset(claim)
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.claimStatus = newClaimStatusReporter(client, testDriverName)
+	})
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, cpuset.New(1, 3))
+
+	driver.reportPrepareResult(claim, kubeletplugin.PrepareResult{})
+	require.Zero(t, driver.claimStatus.flush(context.Background(), logger))
+
+	updated, err := client.ResourceV1().ResourceClaims("default").Get(context.Background(), claim.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, updated.Status.Devices, 2)
+	require.Equal(t, "gpu0", updated.Status.Devices[0].Device)
+	require.Equal(t, "Ready", updated.Status.Devices[0].Conditions[0].Type)
+	require.Equal(t, "cpudevnuma000", updated.Status.Devices[1].Device)
+	prepared := meta.FindStatusCondition(updated.Status.Devices[1].Conditions, ClaimConditionPrepared)
+	require.NotNil(t, prepared)
+	require.Equal(t, metav1.ConditionTrue, prepared.Status)
+	require.Equal(t, "CPUs 1,3 allocated", prepared.Message)
+
+	// the same condition again changes nothing, so it is not written again.
+	driver.reportPrepareResult(claim, kubeletplugin.PrepareResult{})
+	require.Empty(t, driver.claimStatus.dirty)
+
+	driver.reportCPUSetMismatch([]types.UID{claim.UID}, "my-pod", "my-ctr", cpuset.New(0, 1, 2, 3))
+	require.Zero(t, driver.claimStatus.flush(context.Background(), logger))
+	updated, err = client.ResourceV1().ResourceClaims("default").Get(context.Background(), claim.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, updated.Status.Devices, 2)
+	require.True(t, meta.IsStatusConditionTrue(updated.Status.Devices[1].Conditions, ClaimConditionDegraded))
+	require.True(t, meta.IsStatusConditionTrue(updated.Status.Devices[1].Conditions, ClaimConditionPrepared))
+
+	// the claims prepared again are tracked again, the unprepared ones are forgotten.
+	driver.reportPrepareResult(claim, kubeletplugin.PrepareResult{Err: errors.New("boom")})
+	require.True(t, meta.IsStatusConditionFalse(driver.claimStatus.conditions(claim.UID), ClaimConditionPrepared))
+	driver.claimStatus.forget(claim.UID)
+	require.Empty(t, driver.claimStatus.conditions(claim.UID))
+}
+
+func TestClaimStatusReporterRetriesFailedUpdates(t *testing.T) {
+	logger := testr.New(t)
+	claim := testClaim("claim-missing", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	reporter := newClaimStatusReporter(fake.NewClientset(), testDriverName)
+	reporter.track(claim)
+	reporter.setCondition(claim.UID, ClaimConditionPrepared, metav1.ConditionTrue, "CPUsAllocated", "")
+
+	require.Equal(t, 1, reporter.flush(context.Background(), logger))
+	require.True(t, reporter.dirty.Has(claim.UID))
+}
+
+// the driver without the ClaimDeviceStatus feature gate reports nothing.
+func TestClaimStatusReporterDisabled(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	claim := testClaim("claim-disabled", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	driver.reportPrepareResult(claim, kubeletplugin.PrepareResult{})
+	driver.reportEnforced([]types.UID{claim.UID}, "my-pod", "my-ctr", cpuset.New(1))
+	driver.claimStatus.forget(claim.UID)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ClaimsAPIVersion is the version of the node-local claims API.
+	ClaimsAPIVersion = "v1alpha"
+	// ClaimsAPIPath is the path the node-local claims API is served at.
+	ClaimsAPIPath = "/apis/" + ClaimsAPIVersion + "/claims"
+	// PeakUsageAPIPath is the path the history of the peak exclusive CPU usage is served at.
+	PeakUsageAPIPath = "/apis/" + ClaimsAPIVersion + "/peakusage"
+	// EfficiencyAPIPath is the path the efficiency report of the exclusive CPU allocations is served at.
+	EfficiencyAPIPath = "/apis/" + ClaimsAPIVersion + "/efficiency"
+	// ExamplesAPIPath is the path the example claims allocating from the published devices are served at, as YAML.
+	ExamplesAPIPath = "/apis/" + ClaimsAPIVersion + "/examples"
+)
+
+// ClaimList is the response of the node-local claims API.
+type ClaimList struct {
+	APIVersion string      `json:"apiVersion"`
+	Claims     []ClaimInfo `json:"claims"`
+}
+
+// ClaimInfo describes the CPUs allocated to a claim, and the containers consuming them.
+type ClaimInfo struct {
+	ClaimUID   types.UID       `json:"claimUID"`
+	TraceID    string          `json:"traceID,omitempty"`
+	CPUs       string          `json:"cpus"`
+	Containers []ContainerInfo `json:"containers"`
+}
+
+// ContainerInfo describes a container consuming a claim. The cgroup path
+// is reported as-is from the container runtime, and may be empty.
+type ContainerInfo struct {
+	PodUID        types.UID `json:"podUID"`
+	ContainerName string    `json:"containerName"`
+	ContainerID   string    `json:"containerID"`
+	CgroupsPath   string    `json:"cgroupsPath,omitempty"`
+}
+
+// ClaimsAPIHandler returns the read-only handler serving the claims API, the peak usage history, the efficiency report
+// and the example claims.
+// With the FaultInjection feature gate, it also controls the faults to inject.
+func (cp *CPUDriver) ClaimsAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+ClaimsAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cp.listClaims()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("GET "+PeakUsageAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cp.peakUsageHistory()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("GET "+EfficiencyAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cp.efficiencyReport()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("GET "+ExamplesAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		data, err := cp.exampleClaimsYAML()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(data)
+	})
+	if cp.faults != nil {
+		mux.HandleFunc("GET "+FaultsAPIPath, cp.faults.handleFaults)
+		mux.HandleFunc("PUT "+FaultsAPIPath, cp.faults.handleFaults)
+	}
+	return mux
+}
+
+func (cp *CPUDriver) listClaims() ClaimList {
+	containersByClaim := cp.podConfigStore.GetContainersByClaim()
+	claims := []ClaimInfo{}
+	for claimUID, cpus := range cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		info := ClaimInfo{
+			ClaimUID:   claimUID,
+			TraceID:    cp.cpuAllocationStore.GetResourceClaimTraceID(claimUID),
+			CPUs:       cpus.String(),
+			Containers: []ContainerInfo{},
+		}
+		for _, ctr := range containersByClaim[claimUID] {
+			info.Containers = append(info.Containers, ContainerInfo{
+				PodUID:        ctr.PodUID,
+				ContainerName: ctr.ContainerName,
+				ContainerID:   string(ctr.ContainerUID),
+				CgroupsPath:   ctr.CgroupsPath,
+			})
+		}
+		slices.SortFunc(info.Containers, func(a, b ContainerInfo) int {
+			return cmp.Or(cmp.Compare(a.PodUID, b.PodUID), cmp.Compare(a.ContainerName, b.ContainerName))
+		})
+		claims = append(claims, info)
+	}
+	slices.SortFunc(claims, func(a, b ClaimInfo) int {
+		return cmp.Compare(a.ClaimUID, b.ClaimUID)
+	})
+	return ClaimList{
+		APIVersion: ClaimsAPIVersion,
+		Claims:     claims,
+	}
+}
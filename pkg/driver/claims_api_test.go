@@ -0,0 +1,113 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestClaimsAPIHandler(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podConfigStore:     store.NewPodConfig(),
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-b", cpuset.New(2, 6))
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-a", cpuset.New(0, 1))
+	driver.podConfigStore.SetContainerState("pod-1", store.NewContainerState("ctr-2", "ctr-id-2", "claim-a").SetCgroupsPath("/kubepods/pod-1/ctr-id-2"))
+	driver.podConfigStore.SetContainerState("pod-1", store.NewContainerState("ctr-1", "ctr-id-1", "claim-a"))
+	driver.podConfigStore.SetContainerState("pod-1", store.NewContainerState("ctr-shared", "ctr-id-3"))
+
+	handler := driver.ClaimsAPIHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ClaimsAPIPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got ClaimList
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Equal(t, ClaimList{
+		APIVersion: ClaimsAPIVersion,
+		Claims: []ClaimInfo{
+			{
+				ClaimUID: "claim-a",
+				CPUs:     "0-1",
+				Containers: []ContainerInfo{
+					{PodUID: "pod-1", ContainerName: "ctr-1", ContainerID: "ctr-id-1"},
+					{PodUID: "pod-1", ContainerName: "ctr-2", ContainerID: "ctr-id-2", CgroupsPath: "/kubepods/pod-1/ctr-id-2"},
+				},
+			},
+			{
+				ClaimUID:   "claim-b",
+				CPUs:       "2,6",
+				Containers: []ContainerInfo{},
+			},
+		},
+	}, got)
+
+	// the API is read-only
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ClaimsAPIPath, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPeakUsageAPI(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podConfigStore:     store.NewPodConfig(),
+		peakUsage:          store.NewPeakUsage(logger, ""),
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-a", cpuset.New(0, 1, 4))
+	driver.updateAllocationMetrics(logger)
+	driver.cpuAllocationStore.RemoveResourceClaimAllocation(logger, "claim-a")
+	driver.updateAllocationMetrics(logger)
+	require.Equal(t, 3.0, testutil.ToFloat64(numaNodePeakExclusiveCPUs.WithLabelValues("0", peakUsagePeriodDay)))
+	require.Equal(t, 0.0, testutil.ToFloat64(numaNodePeakExclusiveCPUs.WithLabelValues("1", peakUsagePeriodWeek)))
+
+	rec := httptest.NewRecorder()
+	driver.ClaimsAPIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PeakUsageAPIPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var got store.PeakUsageHistory
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Len(t, got.Daily, 1)
+	for _, peaks := range got.Daily {
+		require.Equal(t, map[int]int{0: 3, 1: 0}, peaks)
+	}
+	require.Len(t, got.Weekly, 1)
+}
@@ -0,0 +1,241 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containerd/nri/pkg/stub"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+// kubeletPluginComponent registers the driver with the kubelet. With the DegradedStartup feature gate,
+// a failed registration doesn't fail the start of the driver: it is retried in the background.
+type kubeletPluginComponent struct {
+	cp   *CPUDriver
+	opts []kubeletplugin.Option
+	// degraded completes the start without the registration, retried in the background.
+	degraded bool
+	status   *startupStatus
+	plugin   *kubeletPluginHandle
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (k *kubeletPluginComponent) Name() string {
+	return COMPONENT_KUBELET_PLUGIN
+}
+
+// Start starts the kubelet plugin and waits for its registration.
+func (k *kubeletPluginComponent) Start(ctx context.Context) error {
+	logger := ctxlog.FromContext(ctx)
+	k.plugin = &kubeletPluginHandle{}
+	k.cp.draPlugin = k.plugin
+	err := k.register(ctx)
+	if err == nil {
+		return nil
+	}
+	if !k.degraded {
+		k.plugin.Stop()
+		return err
+	}
+	logger.Error(err, "not registered with the kubelet, retrying in the background", "retryInterval", startupRetryInterval)
+	ctx, k.cancel = context.WithCancel(ctx)
+	k.done = make(chan struct{})
+	go func() {
+		defer close(k.done)
+		k.retryRegistration(ctx)
+	}()
+	return nil
+}
+
+// register starts the kubelet plugin, unless it is running, and waits for its registration.
+func (k *kubeletPluginComponent) register(ctx context.Context) error {
+	helper := k.plugin.get()
+	if helper == nil {
+		var err error
+		if helper, err = kubeletplugin.Start(ctx, k.cp, k.opts...); err != nil {
+			err = fmt.Errorf("start kubelet plugin: %w", err)
+			k.status.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionFalse, "StartFailed", err.Error())
+			return err
+		}
+		k.plugin.set(helper)
+	}
+	err := wait.PollUntilContextTimeout(ctx, 1*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
+		status := helper.RegistrationStatus()
+		if status == nil {
+			return false, nil
+		}
+		return status.PluginRegistered, nil
+	})
+	if err != nil {
+		k.status.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionFalse, "NotRegistered", fmt.Sprintf("not registered with the kubelet: %v", err))
+		return err
+	}
+	k.status.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionTrue, "Registered", "registered with the kubelet")
+	return nil
+}
+
+// retryRegistration waits for the registration of the running kubelet plugin, and starts it again when it
+// failed to start or when the kubelet rejected it: the kubelet only retries on a new registration socket.
+func (k *kubeletPluginComponent) retryRegistration(ctx context.Context) {
+	logger := ctxlog.FromContext(ctx)
+	ticker := time.NewTicker(startupRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if helper := k.plugin.get(); helper != nil {
+			if status := helper.RegistrationStatus(); status != nil && !status.PluginRegistered && status.Error != "" {
+				logger.Info("the kubelet rejected the registration, starting the kubelet plugin again", "error", status.Error)
+				k.plugin.Stop()
+			}
+		}
+		if err := k.register(ctx); err != nil {
+			logger.V(2).Info("not registered with the kubelet", "err", err)
+			continue
+		}
+		logger.Info("registered with the kubelet")
+		// the ResourceSlices are not published without a running kubelet plugin.
+		k.cp.RequestPublish(PUBLISH_TRIGGER_STARTUP)
+		return
+	}
+}
+
+func (k *kubeletPluginComponent) Stop(ctx context.Context) {
+	if k.cancel != nil {
+		k.cancel()
+		<-k.done
+	}
+	k.plugin.Stop()
+}
+
+func (k *kubeletPluginComponent) Healthy() error {
+	helper := k.plugin.get()
+	if helper == nil {
+		return fmt.Errorf("kubelet plugin not started")
+	}
+	status := helper.RegistrationStatus()
+	if status == nil || !status.PluginRegistered {
+		return fmt.Errorf("not registered with the kubelet")
+	}
+	return nil
+}
+
+// kubeletPluginHandle is the kubelet plugin of the driver, which a degraded start may start again.
+type kubeletPluginHandle struct {
+	lock   sync.Mutex
+	helper *kubeletplugin.Helper
+}
+
+func (h *kubeletPluginHandle) get() *kubeletplugin.Helper {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.helper
+}
+
+func (h *kubeletPluginHandle) set(helper *kubeletplugin.Helper) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.helper = helper
+}
+
+// PublishResources implements KubeletPlugin.
+func (h *kubeletPluginHandle) PublishResources(ctx context.Context, resources resourceslice.DriverResources) error {
+	helper := h.get()
+	if helper == nil {
+		return fmt.Errorf("the kubelet plugin is not started")
+	}
+	return helper.PublishResources(ctx, resources)
+}
+
+// Stop implements KubeletPlugin.
+func (h *kubeletPluginHandle) Stop() {
+	h.lock.Lock()
+	helper := h.helper
+	h.helper = nil
+	h.lock.Unlock()
+	if helper != nil {
+		helper.Stop()
+	}
+}
+
+// nriEnforcer pins the containers to their CPUs through the NRI plugin, which is
+// restarted by the supervisor when it fails. It is healthy while connected to the runtime.
+type nriEnforcer struct {
+	cp          *CPUDriver
+	maxAttempts int
+	// asyncErr receives the error of the supervisor, once the plugin can't be restarted anymore.
+	asyncErr chan<- error
+	cancel   context.CancelFunc
+}
+
+func (n *nriEnforcer) Name() string {
+	return COMPONENT_NRI_ENFORCER
+}
+
+func (n *nriEnforcer) Start(ctx context.Context) error {
+	logger := ctxlog.FromContext(ctx)
+	cp := n.cp
+	nriOpts := []stub.Option{
+		stub.WithPluginName(cp.driverName),
+		stub.WithPluginIdx("00"),
+		stub.WithSocketPath(cp.nriSocketPath),
+		// https://github.com/containerd/nri/pull/173
+		// Otherwise it silently exits the program
+		stub.WithOnClose(func() {
+			logger.Info("NRI plugin closed")
+			cp.nriSupervisor.setCondition(NRI_STATE_RECONNECTING, "ConnectionClosed", "the runtime closed the connection")
+		}),
+	}
+	plugin, err := stub.New(cp, nriOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create plugin stub: %w", err)
+	}
+	cp.nriPlugin = plugin
+
+	ctx, n.cancel = context.WithCancel(ctx)
+	go func() {
+		if err := cp.nriSupervisor.run(ctx, plugin, n.maxAttempts); err != nil && ctx.Err() == nil {
+			logger.Error(err, "NRI plugin failed to be restarted", "maxAttempts", n.maxAttempts)
+			n.asyncErr <- err
+		}
+	}()
+	return nil
+}
+
+func (n *nriEnforcer) Stop(ctx context.Context) {
+	n.cancel()
+	n.cp.nriPlugin.Stop()
+}
+
+func (n *nriEnforcer) Healthy() error {
+	if cond := n.cp.NRICondition(); cond.State != NRI_STATE_CONNECTED {
+		return fmt.Errorf("NRI %s: %s", cond.State, cond.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// CORE_TYPE_ANY allocates the CPUs of a request from any core type. This is the default.
+	CORE_TYPE_ANY = "any"
+	// CORE_TYPE_PERFORMANCE allocates the CPUs of a request from the performance cores (p-cores) of the hybrid parts.
+	CORE_TYPE_PERFORMANCE = "performance"
+	// CORE_TYPE_EFFICIENCY allocates the CPUs of a request from the efficiency cores (e-cores) of the hybrid parts.
+	CORE_TYPE_EFFICIENCY = "efficiency"
+)
+
+// validateCoreType returns an error if the core type of an opaque configuration is invalid. It is checked
+// when the configuration is decoded, whichever its spelling, versioned or not.
+func validateCoreType(coreType string) error {
+	switch coreType {
+	case "", CORE_TYPE_ANY, CORE_TYPE_PERFORMANCE, CORE_TYPE_EFFICIENCY:
+		return nil
+	}
+	return fmt.Errorf("invalid coreType %q, must be %s, %s or %s", coreType, CORE_TYPE_PERFORMANCE, CORE_TYPE_EFFICIENCY, CORE_TYPE_ANY)
+}
+
+// coreTypeCPUs returns the CPUs of the core type the opaque configuration of a request selects, and false
+// if it selects no core type or the node has a single core type, so the request can get any CPU.
+func (cp *CPUDriver) coreTypeCPUs(config DeviceConfig) (cpuset.CPUSet, bool) {
+	var coreType cpuinfo.CoreType
+	switch config.CoreType {
+	case CORE_TYPE_PERFORMANCE:
+		coreType = cpuinfo.CoreTypePerformance
+	case CORE_TYPE_EFFICIENCY:
+		coreType = cpuinfo.CoreTypeEfficiency
+	default:
+		return cpuset.New(), false
+	}
+	if coreTypeTierSpecs(cp.cpuTopology) == nil {
+		return cpuset.New(), false
+	}
+	var cpuIDs []int
+	for cpuID, info := range cp.cpuTopology.CPUDetails {
+		if info.CoreType == coreType {
+			cpuIDs = append(cpuIDs, cpuID)
+		}
+	}
+	return cpuset.New(cpuIDs...), true
+}
+
+// checkCoreType returns an error if the given CPUs, allocated to a request as a whole, are not all of the core
+// type its opaque configuration selects.
+func (cp *CPUDriver) checkCoreType(deviceName string, config DeviceConfig, cpus cpuset.CPUSet) error {
+	coreTypeCPUs, ok := cp.coreTypeCPUs(config)
+	if !ok {
+		return nil
+	}
+	if other := cpus.Difference(coreTypeCPUs); !other.IsEmpty() {
+		return fmt.Errorf("CPUs %s of device %s are not %s cores", other.String(), deviceName, config.CoreType)
+	}
+	return nil
+}
+
+// filterByCoreType returns the available CPUs of a request consuming a part of a device, restricted to the core
+// type its opaque configuration selects. The core type must have numCPUs available CPUs.
+func (cp *CPUDriver) filterByCoreType(deviceName string, config DeviceConfig, availableCPUs cpuset.CPUSet, numCPUs int) (cpuset.CPUSet, error) {
+	coreTypeCPUs, ok := cp.coreTypeCPUs(config)
+	if !ok {
+		return availableCPUs, nil
+	}
+	available := availableCPUs.Intersection(coreTypeCPUs)
+	if available.Size() < numCPUs {
+		return cpuset.New(), fmt.Errorf("not enough %s cores of device %s available: requested=%d, available=%d", config.CoreType, deviceName, numCPUs, available.Size())
+	}
+	return available, nil
+}
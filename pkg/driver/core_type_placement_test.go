@@ -0,0 +1,141 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsCoreType(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-core-type")
+
+	// the hybrid node has the p-core 0,2 and the e-core 1,3.
+	testCases := []struct {
+		name           string
+		cpuInfos       []cpuinfo.CPUInfo
+		parameters     string
+		numCPUs        int64
+		allocated      cpuset.CPUSet
+		expectedCPUSet cpuset.CPUSet
+		expectedErr    string
+	}{
+		{
+			name:           "any core type",
+			cpuInfos:       mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:     `{"coreType": "any"}`,
+			numCPUs:        2,
+			expectedCPUSet: cpuset.New(0, 2),
+		},
+		{
+			name:           "efficiency cores",
+			cpuInfos:       mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:     `{"coreType": "efficiency"}`,
+			numCPUs:        2,
+			expectedCPUSet: cpuset.New(1, 3),
+		},
+		{
+			name:           "performance cores",
+			cpuInfos:       mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"coreType": "performance"}}`,
+			numCPUs:        1,
+			allocated:      cpuset.New(0),
+			expectedCPUSet: cpuset.New(2),
+		},
+		{
+			name:        "not enough cores of the type",
+			cpuInfos:    mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:  `{"coreType": "performance"}`,
+			numCPUs:     2,
+			allocated:   cpuset.New(0),
+			expectedErr: "not enough performance cores of device cpudevnuma000 available: requested=2, available=1",
+		},
+		{
+			name:        "whole device",
+			cpuInfos:    mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:  `{"coreType": "efficiency", "allCPUs": true}`,
+			expectedErr: "CPUs 0,2 of device cpudevnuma000 are not efficiency cores",
+		},
+		{
+			// the node has a single core type, the parameter has no effect.
+			name:           "not hybrid",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			parameters:     `{"coreType": "efficiency"}`,
+			numCPUs:        2,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:        "invalid core type",
+			cpuInfos:    mockCPUInfos_SingleSocket_Hybrid_HT,
+			parameters:  `{"coreType": "big"}`,
+			numCPUs:     1,
+			expectedErr: `invalid coreType "big"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, tc.cpuInfos)
+			if !tc.allocated.IsEmpty() {
+				driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", tc.allocated)
+			}
+
+			claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": tc.numCPUs}), tc.parameters)
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, prepared[claimUID].Err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestPrepareResourceClaimsCoreTypeIndividualDevices(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_Hybrid_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	deviceNames := map[int]string{}
+	for name, cpuID := range driver.deviceNameToCPUID {
+		deviceNames[cpuID] = name
+	}
+	claimOf := func(claimUID types.UID, cpuID int) *resourceapi.ResourceClaim {
+		claim := testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+			{Driver: testDriverName, Pool: testNodeName, Device: deviceNames[cpuID]},
+		})
+		return testClaimAllCPUs(claim, `{"coreType": "performance"}`)
+	}
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-p-core", 0),
+		claimOf("claim-e-core", 1),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-p-core"].Err)
+	require.ErrorContains(t, prepared["claim-e-core"].Err, "are not performance cores")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/cpuset"
+)
+
+// borrowIdleCPUsEnvVarPrefix is the prefix of the container environment variable marking the claims whose
+// containers borrow the idle CPUs. Like the trace ID, it survives the driver restarts.
+const borrowIdleCPUsEnvVarPrefix = "DRA_CPU_BORROW_IDLE_CPUS"
+
+const (
+	// borrowEventBorrow labels a container created with the idle CPUs on top of the CPUs of its claims.
+	borrowEventBorrow = "borrow"
+	// borrowEventRevoke labels a container shrunk to give the borrowed CPUs to a new exclusive claim.
+	borrowEventRevoke = "revoke"
+	// borrowEventRevokeFailure labels a container which could not be shrunk, failing the preparation of the new claim.
+	borrowEventRevokeFailure = "revoke_failure"
+)
+
+// borrowIdleCPUsEnvVar returns the environment variable marking the containers of a claim to borrow the idle CPUs.
+func borrowIdleCPUsEnvVar(claimUID types.UID) string {
+	return fmt.Sprintf("%s_%s=true", borrowIdleCPUsEnvVarPrefix, claimUID)
+}
+
+// parseBorrowIdleCPUsEnv returns the claims whose containers borrow the idle CPUs, from the container environment.
+func parseBorrowIdleCPUsEnv(envs []string) sets.Set[types.UID] {
+	return parseClaimFlagEnv(envs, borrowIdleCPUsEnvVarPrefix)
+}
+
+// claimBorrowsIdleCPUs returns true if any request of the claim allocated by the driver borrows the idle CPUs.
+func (cp *CPUDriver) claimBorrowsIdleCPUs(claim *resourceapi.ResourceClaim) (bool, error) {
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.BorrowIdleCPUs })
+}
+
+// containerBorrowsIdleCPUs returns true if any of the claims of a container borrows the idle CPUs, preferring
+// what is found in the container environment. The CPUs are lent only if the runtime applies the container
+// updates: the borrowers could not give them back otherwise.
+func (cp *CPUDriver) containerBorrowsIdleCPUs(envs []string, claimUIDs []types.UID) bool {
+	if !cp.nriSupervisor.Runtime().ContainerUpdates {
+		return false
+	}
+	envClaimUIDs := parseBorrowIdleCPUsEnv(envs)
+	for _, claimUID := range claimUIDs {
+		if envClaimUIDs.Has(claimUID) || cp.cpuAllocationStore.IsResourceClaimBorrowing(claimUID) {
+			return true
+		}
+	}
+	return false
+}
+
+// getBorrowerContainerUpdates returns the updates of the cpusets of the containers borrowing the idle CPUs,
+// to the CPUs of their claims and the current shared CPUs, sorted by container ID.
+func (cp *CPUDriver) getBorrowerContainerUpdates(logger logr.Logger, excludeID types.UID) []*api.ContainerUpdate {
+	var updates []*api.ContainerUpdate
+	seen := sets.New[types.UID]()
+	for _, containers := range cp.podConfigStore.GetContainersByClaim() {
+		for _, ctr := range containers {
+			if ctr.ContainerUID == excludeID || seen.Has(ctr.ContainerUID) {
+				continue
+			}
+			seen.Insert(ctr.ContainerUID)
+			claimUIDs := cp.podConfigStore.GetContainerState(ctr.PodUID, ctr.ContainerName).ResourceClaimUIDs()
+			if !cp.containerBorrowsIdleCPUs(nil, claimUIDs) {
+				continue
+			}
+			cpus, ok := cp.expectedContainerCPUs(ctr.PodUID, ctr.ContainerName)
+			if !ok {
+				continue
+			}
+			update := &api.ContainerUpdate{ContainerId: string(ctr.ContainerUID)}
+			update.SetLinuxCPUSetCPUs(cpus.String())
+			updates = append(updates, update)
+		}
+	}
+	slices.SortFunc(updates, func(a, b *api.ContainerUpdate) int { return strings.Compare(a.ContainerId, b.ContainerId) })
+	if len(updates) > 0 {
+		logger.V(2).Info("updating CPU allocation for containers borrowing the idle CPUs", "sharedCPUs", cp.cpuAllocationStore.GetSharedCPUs().String(), "entries", len(updates))
+	}
+	return updates
+}
+
+// revokeBorrowedCPUs shrinks the containers borrowing the idle CPUs after an exclusive claim was allocated some
+// of them. It must succeed before the claim is prepared, so its containers never share its CPUs with the borrowers.
+func (cp *CPUDriver) revokeBorrowedCPUs(logger logr.Logger, cpus cpuset.CPUSet) error {
+	updates := cp.getBorrowerContainerUpdates(logger, "")
+	if len(updates) == 0 {
+		return nil
+	}
+	if cp.nriPlugin == nil {
+		cpuBorrowingEvents.WithLabelValues(borrowEventRevokeFailure).Add(float64(len(updates)))
+		return fmt.Errorf("cannot revoke the CPUs %s borrowed by %d containers: the NRI plugin is not running", cpus.String(), len(updates))
+	}
+	failed, err := cp.nriPlugin.UpdateContainers(updates)
+	if err == nil && len(failed) > 0 {
+		err = fmt.Errorf("the runtime failed to update %d containers", len(failed))
+	}
+	if err != nil {
+		cpuBorrowingEvents.WithLabelValues(borrowEventRevokeFailure).Add(float64(len(updates)))
+		return fmt.Errorf("cannot revoke the CPUs %s borrowed by %d containers: %w", cpus.String(), len(updates), err)
+	}
+	cpuBorrowingEvents.WithLabelValues(borrowEventRevoke).Add(float64(len(updates)))
+	logger.V(2).Info("revoked the borrowed CPUs", "cpus", cpus.String(), "containers", len(updates))
+	return nil
+}
+
+// releaseRevokedClaimAllocation releases the allocation of a claim whose preparation failed after it was recorded,
+// e.g. because the borrowed CPUs could not be revoked, so the kubelet retry finds its CPUs free again.
+func (cp *CPUDriver) releaseRevokedClaimAllocation(logger logr.Logger, claimUID types.UID) {
+	cp.cpuAllocationStore.RemoveResourceClaimAllocation(logger, claimUID)
+	cp.updateAllocationMetrics(logger)
+	cp.republishFullCores()
+}
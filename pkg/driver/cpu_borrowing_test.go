@@ -0,0 +1,218 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+// fakeNRIStub records the unsolicited container updates, and fails them with err.
+type fakeNRIStub struct {
+	stub.Stub
+	updates []*api.ContainerUpdate
+	err     error
+}
+
+func (s *fakeNRIStub) UpdateContainers(updates []*api.ContainerUpdate) ([]*api.ContainerUpdate, error) {
+	if s.err != nil {
+		return updates, s.err
+	}
+	s.updates = append(s.updates, updates...)
+	return nil, nil
+}
+
+func TestParseBorrowIdleCPUsEnv(t *testing.T) {
+	claimUIDs := parseBorrowIdleCPUsEnv([]string{
+		borrowIdleCPUsEnvVar("claim-A"),
+		cpuQuotaDisabledEnvVar("claim-B"),
+		"DRA_CPU_BORROW_IDLE_CPUS_claim-C=false",
+		fmt.Sprintf("%s_claim-D=%s", cdiEnvVarPrefix, "0-1"),
+	})
+	require.ElementsMatch(t, []types.UID{"claim-A"}, claimUIDs.UnsortedList())
+}
+
+func TestCreateContainerBorrowIdleCPUs(t *testing.T) {
+	logger := testr.New(t)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-borrower", cpuset.New(2, 6))
+	driver.cpuAllocationStore.SetResourceClaimBorrowing("claim-borrower", true)
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-exclusive", cpuset.New(0, 4))
+
+	borrower := &api.Container{
+		Id: "borrower", PodSandboxId: pod.Id, Name: "borrower",
+		Env: []string{fmt.Sprintf("%s_claim-borrower=%s", cdiEnvVarPrefix, "2,6"), borrowIdleCPUsEnvVar("claim-borrower")},
+	}
+	adjust, _, err := driver.CreateContainer(context.Background(), pod, borrower)
+	require.NoError(t, err)
+	// the CPUs of the claim, and the shared CPUs, but not the CPUs of the other exclusive claim.
+	require.Equal(t, "1-3,5-7", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+	cpus, ok := driver.expectedContainerCPUs("pod-uid-1", "borrower")
+	require.True(t, ok)
+	require.Equal(t, "1-3,5-7", cpus.String())
+
+	exclusive := &api.Container{
+		Id: "exclusive", PodSandboxId: pod.Id, Name: "exclusive",
+		Env: []string{fmt.Sprintf("%s_claim-exclusive=%s", cdiEnvVarPrefix, "0,4")},
+	}
+	adjust, updates, err := driver.CreateContainer(context.Background(), pod, exclusive)
+	require.NoError(t, err)
+	require.Equal(t, "0,4", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+	require.Len(t, updates, 1)
+	require.Equal(t, "borrower", updates[0].ContainerId)
+	require.Equal(t, "1-3,5-7", updates[0].GetLinux().GetResources().GetCpu().GetCpus())
+}
+
+func TestPrepareResourceClaimsRevokesBorrowedCPUs(t *testing.T) {
+	logger := testr.New(t)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		updateErr     error
+		expectedError bool
+	}{
+		{
+			name: "revoked",
+		},
+		{
+			name:          "revocation failed",
+			updateErr:     errors.New("runtime unavailable"),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nriPlugin := &fakeNRIStub{err: tc.updateErr}
+			driver := &CPUDriver{
+				driverName:         testDriverName,
+				cdiMgr:             newMockCdiMgr(),
+				podConfigStore:     store.NewPodConfig(),
+				cpuTopology:        topo,
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				claimTracker:       store.NewClaimTracker(),
+				cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+				reservedCPUs:       cpuset.New(),
+				nriPlugin:          nriPlugin,
+			}
+			driver.initializeDeviceLookupMaps()
+
+			borrowerUID := types.UID("claim-borrower")
+			claims := []*resourceapi.ResourceClaim{
+				testClaimAllCPUs(testClaim(borrowerUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), `{"borrowIdleCPUs": true}`),
+			}
+			prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+			require.NoError(t, err)
+			require.NoError(t, prepared[borrowerUID].Err)
+			require.True(t, driver.cpuAllocationStore.IsResourceClaimBorrowing(borrowerUID))
+			borrowerCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(borrowerUID)
+			require.True(t, ok)
+
+			borrower := &api.Container{
+				Id: "borrower", PodSandboxId: pod.Id, Name: "borrower",
+				Env: []string{fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, borrowerUID, borrowerCPUs.String())},
+			}
+			_, _, err = driver.CreateContainer(context.Background(), pod, borrower)
+			require.NoError(t, err)
+
+			exclusiveUID := types.UID("claim-exclusive")
+			claims = []*resourceapi.ResourceClaim{
+				testClaim(exclusiveUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}),
+			}
+			prepared, err = driver.PrepareResourceClaims(context.Background(), claims)
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[exclusiveUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(exclusiveUID)
+				require.False(t, ok, "the allocation of the failed claim must be released")
+				return
+			}
+			require.NoError(t, prepared[exclusiveUID].Err)
+			exclusiveCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(exclusiveUID)
+			require.True(t, ok)
+			require.Len(t, nriPlugin.updates, 1)
+			require.Equal(t, "borrower", nriPlugin.updates[0].ContainerId)
+			revoked, err := cpuset.Parse(nriPlugin.updates[0].GetLinux().GetResources().GetCpu().GetCpus())
+			require.NoError(t, err)
+			require.True(t, revoked.Intersection(exclusiveCPUs).IsEmpty(), "the borrower still runs on the exclusive CPUs %s: %s", exclusiveCPUs, revoked)
+			require.True(t, borrowerCPUs.IsSubsetOf(revoked))
+		})
+	}
+}
+
+func TestSynchronizeBorrowIdleCPUs(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	containers := []*api.Container{
+		{
+			Id: "borrower", PodSandboxId: pod.Id, Name: "borrower",
+			Env: []string{fmt.Sprintf("%s_claim-A=%s", cdiEnvVarPrefix, "2,6"), borrowIdleCPUsEnvVar("claim-A")},
+		},
+		{
+			Id: "exclusive", PodSandboxId: pod.Id, Name: "exclusive",
+			Env: []string{fmt.Sprintf("%s_claim-B=%s", cdiEnvVarPrefix, "0,4")},
+		},
+	}
+
+	updates, err := driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, containers)
+	require.NoError(t, err)
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimBorrowing("claim-A"))
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimBorrowing("claim-B"))
+	cpusByID := make(map[string]string)
+	for _, update := range updates {
+		cpusByID[update.ContainerId] = update.GetLinux().GetResources().GetCpu().GetCpus()
+	}
+	require.Equal(t, "1-3,5-7", cpusByID["borrower"])
+	require.Equal(t, "0,4", cpusByID["exclusive"])
+}
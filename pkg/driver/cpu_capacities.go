@@ -0,0 +1,68 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// readCPUCapacities reads the capacities of the CPUs. They are kept only on the asymmetric systems, where the
+// CPUs differ: the devices of the symmetric ones, and of the nodes whose kernel reports no capacity, report none.
+func (cp *CPUDriver) readCPUCapacities(logger logr.Logger, sysfs fs.FS) {
+	capacities, err := cpuinfo.CPUCapacities(sysfs, cp.cpuTopology.CPUDetails.CPUs())
+	if err != nil {
+		logger.Error(err, "failed to read the capacities of the CPUs, the devices report no capacity")
+		return
+	}
+	distinct := make(map[int64]bool)
+	for _, capacity := range capacities {
+		distinct[capacity] = true
+	}
+	if len(distinct) < 2 {
+		return
+	}
+	logger.Info("asymmetric CPU capacities detected", "capacities", capacities)
+	cp.cpuCapacities = capacities
+}
+
+// setCPUCapacityAttributes reports the capacity of the CPUs of a device: the lowest of its CPUs, as a claim may
+// get any of them, and their total, for the claims to select the devices by the throughput they offer rather
+// than by their number of CPUs. Nothing is reported if the capacity of a CPU is unknown.
+func (cp *CPUDriver) setCPUCapacityAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	if len(cp.cpuCapacities) == 0 || cpus.IsEmpty() {
+		return
+	}
+	lowest, total := int64(-1), int64(0)
+	for _, cpuID := range cpus.UnsortedList() {
+		capacity, ok := cp.cpuCapacities[cpuID]
+		if !ok {
+			return
+		}
+		if lowest < 0 || capacity < lowest {
+			lowest = capacity
+		}
+		total += capacity
+	}
+	attrs[AttributeCPUCapacity] = resourceapi.DeviceAttribute{IntValue: ptr.To(lowest)}
+	attrs[AttributeTotalCPUCapacity] = resourceapi.DeviceAttribute{IntValue: ptr.To(total)}
+}
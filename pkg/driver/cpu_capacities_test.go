@@ -0,0 +1,74 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUCapacityAttributes(t *testing.T) {
+	logger := testr.New(t)
+	// the even CPUs are big, the odd ones little.
+	capacity := func(cpuID int) int64 {
+		if cpuID%2 == 0 {
+			return 1024
+		}
+		return 446
+	}
+	sysfs := fstest.MapFS{}
+	for cpuID := range 8 {
+		sysfs[fmt.Sprintf("devices/system/cpu/cpu%d/cpu_capacity", cpuID)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("%d\n", capacity(cpuID)))}
+	}
+
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.readCPUCapacities(logger, sysfs)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			cpuCapacity := capacity(int(*dev.Attributes[AttributeCPUID].IntValue))
+			require.Equal(t, cpuCapacity, *dev.Attributes[AttributeCPUCapacity].IntValue, dev.Name)
+			require.Equal(t, cpuCapacity, *dev.Attributes[AttributeTotalCPUCapacity].IntValue, dev.Name)
+		}
+	}
+
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	totals := map[string]int64{}
+	for _, info := range driver.groupedCPUDeviceInfos() {
+		for _, cpuID := range info.cpus.List() {
+			totals[info.name] += capacity(cpuID)
+		}
+	}
+	for _, dev := range driver.createGroupedCPUDeviceChunks(logger)[0].devices {
+		require.Equal(t, int64(446), *dev.Attributes[AttributeCPUCapacity].IntValue, dev.Name)
+		require.Equal(t, totals[dev.Name], *dev.Attributes[AttributeTotalCPUCapacity].IntValue, dev.Name)
+	}
+
+	// the CPUs of the symmetric systems don't differ, they report no capacity.
+	for cpuID := range 8 {
+		sysfs[fmt.Sprintf("devices/system/cpu/cpu%d/cpu_capacity", cpuID)] = &fstest.MapFile{Data: []byte("1024\n")}
+	}
+	driver = newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	driver.readCPUCapacities(logger, sysfs)
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeCPUCapacity)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+)
+
+// deviceIDsCheckpointFile is the file, in the plugin data directory, checkpointing the IDs of the individual devices.
+const deviceIDsCheckpointFile = "device-ids.json"
+
+// cpuDeviceName returns the name of the individual device with the given ID.
+func cpuDeviceName(deviceID int) string {
+	return fmt.Sprintf("%s%03d", cpuDevicePrefix, deviceID)
+}
+
+// resolveCPUDeviceNames names the individual devices after the checkpointed device IDs of their CPUs, so the
+// names survive the restarts even if the reserved CPUs or the online CPUs change. The CPUs without an ID get
+// new ones in the order of the devices, so a first start names the devices as the previous driver versions did.
+func (cp *CPUDriver) resolveCPUDeviceNames(logger logr.Logger, deviceIDs *store.DeviceIDs) error {
+	cp.cpuDeviceNames = nil
+	devices := cp.cpuDeviceInfos()
+	cpuIDs := make([]int, 0, len(devices))
+	for _, device := range devices {
+		cpuIDs = append(cpuIDs, device.cpu.CpuID)
+	}
+	assigned, err := deviceIDs.Assign(cpuIDs)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string, len(assigned))
+	// the names which differ from the ones derived from the order are kept from an earlier topology.
+	kept := 0
+	for _, device := range devices {
+		names[device.cpu.CpuID] = cpuDeviceName(assigned[device.cpu.CpuID])
+		if names[device.cpu.CpuID] != device.name {
+			kept++
+		}
+	}
+	cp.cpuDeviceNames = names
+	logger.Info("individual devices named after the checkpointed device IDs", "devices", len(names), "keptFromEarlierTopology", kept)
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestResolveCPUDeviceNames(t *testing.T) {
+	logger := testr.New(t)
+	path := filepath.Join(t.TempDir(), deviceIDsCheckpointFile)
+	newDriver := func(reservedCPUs cpuset.CPUSet) *CPUDriver {
+		driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+			cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+			cp.reservedCPUs = reservedCPUs
+		})
+		deviceIDs, err := store.NewDeviceIDsCheckpoint(path)
+		require.NoError(t, err)
+		require.NoError(t, driver.resolveCPUDeviceNames(logger, deviceIDs))
+		driver.initializeDeviceLookupMaps()
+		return driver
+	}
+
+	// the first start names the devices in order, as without the checkpoint.
+	driver := newDriver(cpuset.New())
+	unnamed := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	require.Equal(t, unnamed.deviceNameToCPUID, driver.deviceNameToCPUID)
+	initial := driver.deviceNameToCPUID
+
+	// reserving the CPUs of the first core would shift the names of all the others without the checkpoint.
+	driver = newDriver(cpuset.New(0, 2))
+	for name, cpuID := range driver.deviceNameToCPUID {
+		require.Equal(t, initial[name], cpuID, "device %s was renamed", name)
+	}
+	require.Len(t, driver.deviceNameToCPUID, len(initial)-2)
+
+	// the CPUs released from the reserved ones get their names back.
+	driver = newDriver(cpuset.New())
+	require.Equal(t, initial, driver.deviceNameToCPUID)
+}
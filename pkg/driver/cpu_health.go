@@ -0,0 +1,232 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// cpuHealthMonitorInterval is how often the online and the unhealthy CPUs are read again.
+	cpuHealthMonitorInterval = 30 * time.Second
+
+	// DeviceTaintCPUOffline taints the devices with CPUs the kernel reports offline.
+	DeviceTaintCPUOffline = "dra.cpu/cpu-offline"
+	// DeviceTaintCPUUnhealthy taints the devices with CPUs flagged unhealthy in the unhealthy CPUs file.
+	DeviceTaintCPUUnhealthy = "dra.cpu/cpu-unhealthy"
+)
+
+// cpuHealth tracks the CPUs of the topology which are offline or flagged unhealthy, with the time each was
+// first seen so, as the taints keep their time, the publications of unchanged devices are skipped.
+type cpuHealth struct {
+	lock      sync.Mutex
+	offline   map[int]metav1.Time
+	unhealthy map[int]metav1.Time
+	// degradedClaims are the claims reported degraded because of their CPUs.
+	degradedClaims sets.Set[types.UID]
+}
+
+// set records the offline and unhealthy CPUs, and returns true if they changed.
+func (h *cpuHealth) set(offline, unhealthy cpuset.CPUSet, now metav1.Time) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var changed bool
+	h.offline, changed = flaggedSince(h.offline, offline, now)
+	var unhealthyChanged bool
+	h.unhealthy, unhealthyChanged = flaggedSince(h.unhealthy, unhealthy, now)
+	return changed || unhealthyChanged
+}
+
+// flaggedSince returns when each of the flagged CPUs was first seen, keeping the known times, and true if the
+// flagged CPUs changed.
+func flaggedSince(known map[int]metav1.Time, flagged cpuset.CPUSet, now metav1.Time) (map[int]metav1.Time, bool) {
+	since := make(map[int]metav1.Time, flagged.Size())
+	changed := len(known) != flagged.Size()
+	for _, cpuID := range flagged.UnsortedList() {
+		t, ok := known[cpuID]
+		if !ok {
+			t = now
+			changed = true
+		}
+		since[cpuID] = t
+	}
+	return since, changed
+}
+
+// get returns the offline and the unhealthy CPUs.
+func (h *cpuHealth) get() (cpuset.CPUSet, cpuset.CPUSet) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return cpusOf(h.offline), cpusOf(h.unhealthy)
+}
+
+func cpusOf(since map[int]metav1.Time) cpuset.CPUSet {
+	cpuIDs := make([]int, 0, len(since))
+	for cpuID := range since {
+		cpuIDs = append(cpuIDs, cpuID)
+	}
+	return cpuset.New(cpuIDs...)
+}
+
+// taints returns the taints of a device with the given CPUs, nil if they are all healthy. The taints are
+// NoSchedule: the scheduler places no new claim on the device, and the claims already allocated keep it.
+func (h *cpuHealth) taints(cpus cpuset.CPUSet) []resourceapi.DeviceTaint {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var taints []resourceapi.DeviceTaint
+	for _, flagged := range []struct {
+		key   string
+		since map[int]metav1.Time
+	}{
+		{key: DeviceTaintCPUOffline, since: h.offline},
+		{key: DeviceTaintCPUUnhealthy, since: h.unhealthy},
+	} {
+		var earliest *metav1.Time
+		for _, cpuID := range cpus.UnsortedList() {
+			if t, ok := flagged.since[cpuID]; ok && (earliest == nil || t.Before(earliest)) {
+				earliest = &t
+			}
+		}
+		if earliest != nil {
+			taints = append(taints, resourceapi.DeviceTaint{Key: flagged.key, Effect: resourceapi.DeviceTaintEffectNoSchedule, TimeAdded: earliest})
+		}
+	}
+	return taints
+}
+
+// readUnhealthyCPUs reads the CPUs flagged unhealthy by the health agents of the node, in the cpulist format.
+// A missing or empty file flags no CPU.
+func readUnhealthyCPUs(path string) (cpuset.CPUSet, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cpuset.New(), nil
+	}
+	if err != nil {
+		return cpuset.New(), err
+	}
+	cpus, err := cpuset.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return cpuset.New(), fmt.Errorf("malformed unhealthy CPUs file %q: %w", path, err)
+	}
+	return cpus, nil
+}
+
+// refreshCPUHealth reads the online and the unhealthy CPUs again, and returns true if the CPUs of the topology
+// offline or unhealthy changed. A read failure keeps the previous state.
+func (cp *CPUDriver) refreshCPUHealth(logger logr.Logger) bool {
+	if cp.cpuHealthFS == nil {
+		return false
+	}
+	offline, unhealthy := cp.cpuHealth.get()
+	online, err := cpuinfo.OnlineCPUs(logger, cp.cpuHealthFS)
+	if err != nil {
+		logger.Error(err, "failed to read the online CPUs, keeping the offline CPUs")
+	} else if nowOffline := cp.cpuTopology.CPUDetails.CPUs().Difference(online); !nowOffline.Equals(offline) {
+		offline = nowOffline
+		// the topology changed: the reserved CPUs may be offline now, or online again.
+		if err := cp.RevalidateReservedCPUs(logger); err != nil {
+			logger.Error(err, "reserved CPUs do not match the current CPU topology, restart the driver to apply a new reservation")
+		}
+	}
+	if cp.unhealthyCPUsFile != "" {
+		flagged, err := readUnhealthyCPUs(cp.unhealthyCPUsFile)
+		if err != nil {
+			logger.Error(err, "failed to read the unhealthy CPUs, keeping them")
+		} else {
+			unhealthy = flagged.Intersection(cp.cpuTopology.CPUDetails.CPUs())
+		}
+	}
+	if !cp.cpuHealth.set(offline, unhealthy, metav1.Now()) {
+		return false
+	}
+	logger.Info("the health of the CPUs changed", "offlineCPUs", offline.String(), "unhealthyCPUs", unhealthy.String())
+	cp.reportCPUHealth(offline, unhealthy)
+	return true
+}
+
+// reportCPUHealth reports the claims allocated offline or unhealthy CPUs as degraded, and the others as not
+// degraded any more if they were.
+func (cp *CPUDriver) reportCPUHealth(offline, unhealthy cpuset.CPUSet) {
+	if cp.claimStatus == nil {
+		return
+	}
+	cp.cpuHealth.lock.Lock()
+	defer cp.cpuHealth.lock.Unlock()
+	if cp.cpuHealth.degradedClaims == nil {
+		cp.cpuHealth.degradedClaims = sets.New[types.UID]()
+	}
+	for claimUID, cpus := range cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		switch {
+		case !cpus.Intersection(offline).IsEmpty():
+			cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionTrue, "CPUOffline", fmt.Sprintf("CPUs %s are offline", cpus.Intersection(offline).String()))
+			cp.cpuHealth.degradedClaims.Insert(claimUID)
+		case !cpus.Intersection(unhealthy).IsEmpty():
+			cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionTrue, "CPUUnhealthy", fmt.Sprintf("CPUs %s are flagged unhealthy", cpus.Intersection(unhealthy).String()))
+			cp.cpuHealth.degradedClaims.Insert(claimUID)
+		case cp.cpuHealth.degradedClaims.Has(claimUID):
+			cp.claimStatus.setCondition(claimUID, ClaimConditionDegraded, metav1.ConditionFalse, "CPUsHealthy", "the CPUs are online and healthy again")
+			cp.cpuHealth.degradedClaims.Delete(claimUID)
+		}
+	}
+}
+
+// runCPUHealthMonitor reads the online and the unhealthy CPUs periodically, and publishes the devices again
+// when their taints change.
+func (cp *CPUDriver) runCPUHealthMonitor(ctx context.Context, interval time.Duration) {
+	logger := ctxlog.FromContext(ctx).WithName("cpu-health")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if trigger, ok := cp.cpuHealthChange(logger); ok {
+			cp.RequestPublish(trigger)
+		}
+	}
+}
+
+// cpuHealthChange refreshes the health of the CPUs, and returns the trigger of the publication the change needs:
+// the online CPUs changing is a change of the topology, the unhealthy CPUs changing only of their health.
+func (cp *CPUDriver) cpuHealthChange(logger logr.Logger) (PublishTrigger, bool) {
+	offline, _ := cp.cpuHealth.get()
+	if !cp.refreshCPUHealth(logger) {
+		return "", false
+	}
+	if nowOffline, _ := cp.cpuHealth.get(); !nowOffline.Equals(offline) {
+		return PUBLISH_TRIGGER_TOPOLOGY_CHANGE, true
+	}
+	return PUBLISH_TRIGGER_CPU_HEALTH_CHANGE, true
+}
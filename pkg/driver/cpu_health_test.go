@@ -0,0 +1,199 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+)
+
+func setOnlineCPUs(sysfs fstest.MapFS, cpus string) {
+	sysfs["devices/system/cpu/online"] = &fstest.MapFile{Data: []byte(cpus + "\n")}
+}
+
+func taintsByDevice(chunks []deviceChunk) map[string][]resourceapi.DeviceTaint {
+	taints := make(map[string][]resourceapi.DeviceTaint)
+	for _, chunk := range chunks {
+		for _, device := range chunk.devices {
+			taints[device.Name] = device.Taints
+		}
+	}
+	return taints
+}
+
+func TestCPUHealthTaints(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	setOnlineCPUs(sysfs, "0-7")
+	unhealthyFile := filepath.Join(t.TempDir(), "unhealthy_cpus")
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuHealthFS = sysfs
+		cp.unhealthyCPUsFile = unhealthyFile
+	})
+
+	// all the CPUs online, and no unhealthy CPUs file.
+	require.False(t, driver.refreshCPUHealth(logger))
+	for name, taints := range taintsByDevice(driver.createGroupedCPUDeviceChunks(logger)) {
+		require.Empty(t, taints, name)
+	}
+
+	// CPU 4 of NUMA node 0 goes offline, CPU 99 outside the topology is ignored.
+	setOnlineCPUs(sysfs, "0-3,5-7")
+	require.NoError(t, os.WriteFile(unhealthyFile, []byte("99\n"), 0o644))
+	require.True(t, driver.refreshCPUHealth(logger))
+	taints := taintsByDevice(driver.createGroupedCPUDeviceChunks(logger))
+	require.Len(t, taints["cpudevnuma000"], 1)
+	require.Equal(t, DeviceTaintCPUOffline, taints["cpudevnuma000"][0].Key)
+	require.Equal(t, resourceapi.DeviceTaintEffectNoSchedule, taints["cpudevnuma000"][0].Effect)
+	require.NotNil(t, taints["cpudevnuma000"][0].TimeAdded)
+	require.Empty(t, taints["cpudevnuma001"])
+
+	// an unchanged state keeps the time of the taint, so the devices are the same.
+	require.False(t, driver.refreshCPUHealth(logger))
+	require.Equal(t, taints, taintsByDevice(driver.createGroupedCPUDeviceChunks(logger)))
+
+	// CPU 2 of NUMA node 1 is flagged unhealthy.
+	require.NoError(t, os.WriteFile(unhealthyFile, []byte("2\n"), 0o644))
+	require.True(t, driver.refreshCPUHealth(logger))
+	taints = taintsByDevice(driver.createGroupedCPUDeviceChunks(logger))
+	require.Len(t, taints["cpudevnuma000"], 1)
+	require.Len(t, taints["cpudevnuma001"], 1)
+	require.Equal(t, DeviceTaintCPUUnhealthy, taints["cpudevnuma001"][0].Key)
+
+	// a malformed file keeps the unhealthy CPUs, and the recovered CPUs are untainted.
+	require.NoError(t, os.WriteFile(unhealthyFile, []byte("not-a-cpulist"), 0o644))
+	setOnlineCPUs(sysfs, "0-7")
+	require.True(t, driver.refreshCPUHealth(logger))
+	taints = taintsByDevice(driver.createGroupedCPUDeviceChunks(logger))
+	require.Empty(t, taints["cpudevnuma000"])
+	require.Len(t, taints["cpudevnuma001"], 1)
+}
+
+func TestCPUHealthRevalidatesReservedCPUs(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	setOnlineCPUs(sysfs, "0-7")
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuHealthFS = sysfs
+		cp.cpuTopologyProvider = mockProvider
+		cp.reservedCPUs = cpuset.New(0, 7)
+	})
+	require.False(t, driver.refreshCPUHealth(logger))
+
+	// the reserved CPU 7 goes offline.
+	setOnlineCPUs(sysfs, "0-6")
+	mockProvider.CPUInfos = mockCPUInfos_DualSocket_4CPUsPerSocket_HT[:7]
+	require.True(t, driver.refreshCPUHealth(logger))
+	require.Equal(t, float64(1), testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU)))
+
+	// and comes back online.
+	setOnlineCPUs(sysfs, "0-7")
+	mockProvider.CPUInfos = mockCPUInfos_DualSocket_4CPUsPerSocket_HT
+	require.True(t, driver.refreshCPUHealth(logger))
+	require.Equal(t, float64(0), testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU)))
+}
+
+func TestCPUHealthChangeTrigger(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	setOnlineCPUs(sysfs, "0-7")
+	unhealthyFile := filepath.Join(t.TempDir(), "unhealthy_cpus")
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuHealthFS = sysfs
+		cp.unhealthyCPUsFile = unhealthyFile
+	})
+	_, ok := driver.cpuHealthChange(logger)
+	require.False(t, ok)
+
+	setOnlineCPUs(sysfs, "0-6")
+	trigger, ok := driver.cpuHealthChange(logger)
+	require.True(t, ok)
+	require.Equal(t, PUBLISH_TRIGGER_TOPOLOGY_CHANGE, trigger)
+
+	require.NoError(t, os.WriteFile(unhealthyFile, []byte("2\n"), 0o644))
+	trigger, ok = driver.cpuHealthChange(logger)
+	require.True(t, ok)
+	require.Equal(t, PUBLISH_TRIGGER_CPU_HEALTH_CHANGE, trigger)
+
+	// both changed: the topology change wins.
+	setOnlineCPUs(sysfs, "0-7")
+	require.NoError(t, os.WriteFile(unhealthyFile, []byte("3\n"), 0o644))
+	trigger, ok = driver.cpuHealthChange(logger)
+	require.True(t, ok)
+	require.Equal(t, PUBLISH_TRIGGER_TOPOLOGY_CHANGE, trigger)
+}
+
+func TestCPUHealthIndividualTaints(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	setOnlineCPUs(sysfs, "0,2-3")
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.cpuHealthFS = sysfs
+	})
+	require.True(t, driver.refreshCPUHealth(logger))
+	var tainted []string
+	for name, taints := range taintsByDevice(driver.createCPUDeviceChunks()) {
+		if len(taints) > 0 {
+			tainted = append(tainted, name)
+		}
+	}
+	for _, deviceInfo := range driver.cpuDeviceInfos() {
+		if deviceInfo.cpu.CpuID == 1 {
+			require.Equal(t, []string{deviceInfo.name}, tainted)
+		}
+	}
+}
+
+func TestCPUHealthDegradedClaims(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	setOnlineCPUs(sysfs, "0-3")
+	claim := testClaim("claim-health", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuHealthFS = sysfs
+		cp.claimStatus = newClaimStatusReporter(fake.NewClientset(claim), testDriverName)
+	})
+	driver.claimStatus.track(claim)
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, cpuset.New(1, 3))
+
+	setOnlineCPUs(sysfs, "0-2")
+	require.True(t, driver.refreshCPUHealth(logger))
+	degraded := meta.FindStatusCondition(driver.claimStatus.conditions(claim.UID), ClaimConditionDegraded)
+	require.NotNil(t, degraded)
+	require.Equal(t, "CPUOffline", degraded.Reason)
+	require.Equal(t, "CPUs 3 are offline", degraded.Message)
+
+	setOnlineCPUs(sysfs, "0-3")
+	require.True(t, driver.refreshCPUHealth(logger))
+	degraded = meta.FindStatusCondition(driver.claimStatus.conditions(claim.UID), ClaimConditionDegraded)
+	require.NotNil(t, degraded)
+	require.Equal(t, "CPUsHealthy", degraded.Reason)
+	require.False(t, meta.IsStatusConditionTrue(driver.claimStatus.conditions(claim.UID), ClaimConditionDegraded))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// readCPUModels reads the models of the CPUs. The devices report no model if they can't be read.
+func (cp *CPUDriver) readCPUModels(logger logr.Logger, procfs fs.FS) {
+	models, err := cpuinfo.CPUModels(procfs)
+	if err != nil {
+		logger.Error(err, "failed to read the models of the CPUs, the devices report no model")
+		return
+	}
+	cp.cpuModels = models
+}
+
+// setCPUModelAttributes reports the vendor, model name, family and stepping of the CPUs of a device. A grouped
+// device reports each of them only if all its CPUs agree, and nothing is reported if the model of a CPU is unknown.
+func (cp *CPUDriver) setCPUModelAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	if len(cp.cpuModels) == 0 || cpus.IsEmpty() {
+		return
+	}
+	var models []cpuinfo.CPUModel
+	for _, cpuID := range cpus.List() {
+		model, ok := cp.cpuModels[cpuID]
+		if !ok {
+			return
+		}
+		models = append(models, model)
+	}
+	model := models[0]
+	for _, other := range models[1:] {
+		if other.Vendor != model.Vendor {
+			model.Vendor = ""
+		}
+		if other.ModelName != model.ModelName {
+			model.ModelName = ""
+		}
+		if other.Family != model.Family {
+			model.Family = -1
+		}
+		if other.Stepping != model.Stepping {
+			model.Stepping = -1
+		}
+	}
+	if model.Vendor != "" {
+		attrs[AttributeVendor] = resourceapi.DeviceAttribute{StringValue: ptr.To(model.Vendor)}
+	}
+	if model.ModelName != "" {
+		attrs[AttributeModelName] = resourceapi.DeviceAttribute{StringValue: ptr.To(model.ModelName)}
+	}
+	if model.Family >= 0 {
+		attrs[AttributeFamily] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(model.Family))}
+	}
+	if model.Stepping >= 0 {
+		attrs[AttributeStepping] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(model.Stepping))}
+	}
+}
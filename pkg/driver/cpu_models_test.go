@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUModelAttributes(t *testing.T) {
+	logger := testr.New(t)
+	var cpuinfo strings.Builder
+	for cpuID := range 4 {
+		stepping := 8
+		if cpuID == 3 {
+			stepping = 6
+		}
+		fmt.Fprintf(&cpuinfo, "processor\t: %d\nvendor_id\t: GenuineIntel\ncpu family\t: 6\nmodel name\t: Intel(R) Xeon(R) Platinum 8480+\nstepping\t: %d\n\n", cpuID, stepping)
+	}
+	procfs := fstest.MapFS{"cpuinfo": &fstest.MapFile{Data: []byte(cpuinfo.String())}}
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.readCPUModels(logger, procfs)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			require.Equal(t, "GenuineIntel", *dev.Attributes[AttributeVendor].StringValue, dev.Name)
+			require.Equal(t, "Intel(R) Xeon(R) Platinum 8480+", *dev.Attributes[AttributeModelName].StringValue, dev.Name)
+			require.Equal(t, int64(6), *dev.Attributes[AttributeFamily].IntValue, dev.Name)
+			stepping := int64(8)
+			if driver.deviceNameToCPUID[dev.Name] == 3 {
+				stepping = 6
+			}
+			require.Equal(t, stepping, *dev.Attributes[AttributeStepping].IntValue, dev.Name)
+		}
+	}
+
+	// the grouped devices report what all their CPUs agree on.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	attrs := driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.Equal(t, "GenuineIntel", *attrs[AttributeVendor].StringValue)
+	require.Equal(t, int64(6), *attrs[AttributeFamily].IntValue)
+	require.NotContains(t, attrs, AttributeStepping)
+
+	// without the cpuinfo file, no model is reported.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	driver.readCPUModels(logger, fstest.MapFS{})
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeVendor)
+}
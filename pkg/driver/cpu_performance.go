@@ -0,0 +1,166 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// frequencyMonitorInterval is how often the frequency limits of the CPUs are read again: the operators and
+// the thermal and power management cap the frequencies at runtime.
+const frequencyMonitorInterval = time.Minute
+
+// performanceScores are the frequency limits of the CPUs, by CPU ID, and the relative performance scores
+// derived from them. Empty if the node has no cpufreq.
+type performanceScores struct {
+	lock   sync.Mutex
+	limits map[int]cpuinfo.FrequencyLimits
+	scores map[int]int64
+}
+
+// get returns the scores.
+func (p *performanceScores) get() map[int]int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.scores
+}
+
+// frequencyLimits returns the frequency limits.
+func (p *performanceScores) frequencyLimits() map[int]cpuinfo.FrequencyLimits {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.limits
+}
+
+// set replaces the frequency limits and their scores, and returns true if the limits changed.
+func (p *performanceScores) set(limits map[int]cpuinfo.FrequencyLimits) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if maps.Equal(p.limits, limits) {
+		return false
+	}
+	p.limits = limits
+	p.scores = cpuinfo.PerformanceScores(limits)
+	return true
+}
+
+// refreshPerformanceScores reads the frequency limits of the CPUs again, and returns true if they changed.
+// A read failure keeps the previous scores.
+func (cp *CPUDriver) refreshPerformanceScores(logger logr.Logger) bool {
+	if cp.cpufreqFS == nil {
+		return false
+	}
+	limits, err := cpuinfo.CPUFrequencyLimits(cp.cpufreqFS, cp.cpuTopology.CPUDetails.CPUs())
+	if err != nil {
+		logger.Error(err, "failed to read the frequency limits of the CPUs, keeping the performance scores")
+		return false
+	}
+	if !cp.performanceScores.set(limits) {
+		return false
+	}
+	capped := cpuset.New()
+	for cpuID, limit := range limits {
+		if limit.ScalingMaxKHz < limit.MaxKHz {
+			capped = capped.Union(cpuset.New(cpuID))
+		}
+	}
+	logger.Info("the frequency limits of the CPUs changed", "cpusWithFrequency", len(limits), "cappedCPUs", capped.String())
+	return true
+}
+
+// runFrequencyMonitor reads the frequency limits of the CPUs periodically, and publishes the devices again
+// when their performance scores or frequencies change.
+func (cp *CPUDriver) runFrequencyMonitor(ctx context.Context, interval time.Duration) {
+	logger := ctxlog.FromContext(ctx).WithName("frequency")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if cp.refreshPerformanceScores(logger) {
+			cp.RequestPublish(PUBLISH_TRIGGER_FREQUENCY_CHANGE)
+		}
+	}
+}
+
+// setPerformanceScoreAttribute reports the performance score of a device: the lowest score of its CPUs,
+// as a claim may get any of them. Not reported if a CPU has no score.
+func (cp *CPUDriver) setPerformanceScoreAttribute(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	scores := cp.performanceScores.get()
+	if len(scores) == 0 || cpus.IsEmpty() {
+		return
+	}
+	lowest := int64(-1)
+	for _, cpuID := range cpus.UnsortedList() {
+		score, ok := scores[cpuID]
+		if !ok {
+			return
+		}
+		if lowest < 0 || score < lowest {
+			lowest = score
+		}
+	}
+	attrs[AttributePerformanceScore] = resourceapi.DeviceAttribute{IntValue: ptr.To(lowest)}
+}
+
+// setFrequencyAttributes reports the base, maximum and minimum frequencies of a device, in MHz: the lowest of
+// its CPUs, as a claim may get any of them. Not reported if a CPU has no cpufreq, nor the base frequency if
+// a CPU doesn't report it.
+func (cp *CPUDriver) setFrequencyAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	limits := cp.performanceScores.frequencyLimits()
+	if len(limits) == 0 || cpus.IsEmpty() {
+		return
+	}
+	lowest := cpuinfo.FrequencyLimits{MaxKHz: -1, MinKHz: -1, BaseKHz: -1}
+	for _, cpuID := range cpus.UnsortedList() {
+		limit, ok := limits[cpuID]
+		if !ok {
+			return
+		}
+		lowest.MaxKHz = lowestKHz(lowest.MaxKHz, limit.MaxKHz)
+		lowest.MinKHz = lowestKHz(lowest.MinKHz, limit.MinKHz)
+		lowest.BaseKHz = lowestKHz(lowest.BaseKHz, limit.BaseKHz)
+	}
+	attrs[AttributeMaxFrequencyMHz] = resourceapi.DeviceAttribute{IntValue: ptr.To(lowest.MaxKHz / 1000)}
+	if lowest.MinKHz > 0 {
+		attrs[AttributeMinFrequencyMHz] = resourceapi.DeviceAttribute{IntValue: ptr.To(lowest.MinKHz / 1000)}
+	}
+	if lowest.BaseKHz > 0 {
+		attrs[AttributeBaseFrequencyMHz] = resourceapi.DeviceAttribute{IntValue: ptr.To(lowest.BaseKHz / 1000)}
+	}
+}
+
+// lowestKHz returns the lowest of two frequencies, the first being -1 until set. An unknown frequency, 0, wins.
+func lowestKHz(lowest, kHz int64) int64 {
+	if lowest < 0 {
+		return kHz
+	}
+	return min(lowest, kHz)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func setCPUFrequency(sysfs fstest.MapFS, cpuID int, maxKHz, scalingMaxKHz int64) {
+	dir := fmt.Sprintf("devices/system/cpu/cpu%d/cpufreq", cpuID)
+	sysfs[dir+"/cpuinfo_max_freq"] = &fstest.MapFile{Data: []byte(fmt.Sprintf("%d\n", maxKHz))}
+	sysfs[dir+"/scaling_max_freq"] = &fstest.MapFile{Data: []byte(fmt.Sprintf("%d\n", scalingMaxKHz))}
+}
+
+func TestPerformanceScoreAttribute(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	for cpuID := range 4 {
+		setCPUFrequency(sysfs, cpuID, 4000000, 4000000)
+	}
+	// CPU 1 is capped at 3GHz.
+	setCPUFrequency(sysfs, 1, 4000000, 3000000)
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.cpufreqFS = sysfs
+	})
+	require.True(t, driver.refreshPerformanceScores(logger))
+	require.False(t, driver.refreshPerformanceScores(logger), "unchanged limits must not republish the devices")
+
+	scores := make(map[int]int64)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			attr, ok := dev.Attributes[AttributePerformanceScore]
+			require.True(t, ok, "device %s has no performance score", dev.Name)
+			scores[driver.deviceNameToCPUID[dev.Name]] = *attr.IntValue
+		}
+	}
+	require.Equal(t, map[int]int64{0: 100, 1: 75, 2: 100, 3: 100}, scores)
+
+	// the grouped devices report the lowest score of their CPUs.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	chunks := driver.createGroupedCPUDeviceChunks(logger)
+	require.Len(t, chunks, 1)
+	require.Len(t, chunks[0].devices, 1)
+	require.Equal(t, int64(75), *chunks[0].devices[0].Attributes[AttributePerformanceScore].IntValue)
+
+	// lifting the cap changes the scores.
+	setCPUFrequency(sysfs, 1, 4000000, 4000000)
+	require.True(t, driver.refreshPerformanceScores(logger))
+	chunks = driver.createGroupedCPUDeviceChunks(logger)
+	require.Equal(t, int64(100), *chunks[0].devices[0].Attributes[AttributePerformanceScore].IntValue)
+
+	// without cpufreq, no score is reported.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	require.False(t, driver.refreshPerformanceScores(logger))
+	chunks = driver.createGroupedCPUDeviceChunks(logger)
+	require.NotContains(t, chunks[0].devices[0].Attributes, AttributePerformanceScore)
+}
+
+func TestFrequencyAttributes(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{}
+	for cpuID := range 4 {
+		setCPUFrequency(sysfs, cpuID, 4000000, 4000000)
+		dir := fmt.Sprintf("devices/system/cpu/cpu%d/cpufreq", cpuID)
+		sysfs[dir+"/cpuinfo_min_freq"] = &fstest.MapFile{Data: []byte("800000\n")}
+		sysfs[dir+"/base_frequency"] = &fstest.MapFile{Data: []byte("2100000\n")}
+	}
+	// CPU 3 is an efficiency core, without base frequency.
+	setCPUFrequency(sysfs, 3, 3000000, 3000000)
+	delete(sysfs, "devices/system/cpu/cpu3/cpufreq/base_frequency")
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.cpufreqFS = sysfs
+	})
+	require.True(t, driver.refreshPerformanceScores(logger))
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			require.Equal(t, int64(800), *dev.Attributes[AttributeMinFrequencyMHz].IntValue, dev.Name)
+			if driver.deviceNameToCPUID[dev.Name] == 3 {
+				require.Equal(t, int64(3000), *dev.Attributes[AttributeMaxFrequencyMHz].IntValue)
+				require.NotContains(t, dev.Attributes, AttributeBaseFrequencyMHz)
+				continue
+			}
+			require.Equal(t, int64(4000), *dev.Attributes[AttributeMaxFrequencyMHz].IntValue, dev.Name)
+			require.Equal(t, int64(2100), *dev.Attributes[AttributeBaseFrequencyMHz].IntValue, dev.Name)
+		}
+	}
+
+	// the grouped devices report the lowest frequencies of their CPUs.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	attrs := driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.Equal(t, int64(3000), *attrs[AttributeMaxFrequencyMHz].IntValue)
+	require.Equal(t, int64(800), *attrs[AttributeMinFrequencyMHz].IntValue)
+	require.NotContains(t, attrs, AttributeBaseFrequencyMHz)
+
+	// without cpufreq, no frequency is reported.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeMaxFrequencyMHz)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// cpuDevicePoolPrefix is the prefix of the devices of the admin-defined CPU pools, followed by the pool name.
+	cpuDevicePoolPrefix = "cpudevpool-"
+	// maxCPUPoolNameLength keeps the names of the pool devices within the limit of the device names.
+	maxCPUPoolNameLength = 32
+	// isolatedCPUPoolName is the pool of the CPUs isolated by the kernel, with --isolated-cpus-pool.
+	isolatedCPUPoolName = "isolated"
+)
+
+// CPUPoolsConfig is the content of the CPU pools file, in YAML or JSON:
+//
+//	pools:
+//	  realtime: "2-5,34-37"
+//	  batch: "6-31,38-63"
+type CPUPoolsConfig struct {
+	// Pools maps the names of the pools to their cpuset.
+	Pools map[string]string `json:"pools"`
+}
+
+// loadCPUPools reads the CPU pools file. A file which can't be read or parsed fails the start of the
+// driver: publishing the CPUs of the pools as regular devices would break the partitioning of the node.
+func loadCPUPools(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CPU pools file: %w", err)
+	}
+	var config CPUPoolsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the CPU pools file %s: %w", path, err)
+	}
+	return config.Pools, nil
+}
+
+// withIsolatedCPUPool adds the pool of the CPUs isolated by the kernel to the pool specs. The isolated CPUs
+// which are reserved or not in the topology are left out, and no pool is added if none is left.
+func withIsolatedCPUPool(logger logr.Logger, specs map[string]string, sysfs fs.FS, topo *cpuinfo.CPUTopology, reservedCPUs cpuset.CPUSet) (map[string]string, error) {
+	if _, ok := specs[isolatedCPUPoolName]; ok {
+		return nil, fmt.Errorf("the CPU pool %q is reserved for the isolated CPUs", isolatedCPUPoolName)
+	}
+	isolated, err := cpuinfo.IsolatedCPUs(sysfs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the isolated CPUs: %w", err)
+	}
+	cpus := isolated.Intersection(topo.CPUDetails.CPUs()).Difference(reservedCPUs)
+	if cpus.IsEmpty() {
+		logger.Info("no isolated CPUs to publish as a CPU pool", "isolatedCPUs", isolated.String())
+		return specs, nil
+	}
+	logger.Info("publishing the isolated CPUs as a CPU pool", "pool", isolatedCPUPoolName, "cpus", cpus.String(), "isolatedCPUs", isolated.String())
+	specs = maps.Clone(specs)
+	if specs == nil {
+		specs = map[string]string{}
+	}
+	specs[isolatedCPUPoolName] = cpus.String()
+	return specs, nil
+}
+
+// resolveCPUPools resolves the CPUs of the admin-defined pools. The pools must have valid names, must not
+// overlap, and must not contain reserved CPUs.
+func resolveCPUPools(topo *cpuinfo.CPUTopology, reservedCPUs cpuset.CPUSet, specs map[string]string) (map[string]cpuset.CPUSet, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	pools := make(map[string]cpuset.CPUSet, len(specs))
+	allCPUs := topo.CPUDetails.CPUs()
+	pooledCPUs := cpuset.New()
+	for _, name := range slices.Sorted(maps.Keys(specs)) {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid CPU pool name %q: %s", name, strings.Join(errs, ", "))
+		}
+		if len(name) > maxCPUPoolNameLength {
+			return nil, fmt.Errorf("invalid CPU pool name %q: must be no more than %d characters", name, maxCPUPoolNameLength)
+		}
+		cpus, err := cpuset.Parse(strings.TrimSpace(specs[name]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPUs of pool %q: %w", name, err)
+		}
+		if cpus.IsEmpty() {
+			return nil, fmt.Errorf("CPU pool %q has no CPUs", name)
+		}
+		if missing := cpus.Difference(allCPUs); !missing.IsEmpty() {
+			return nil, fmt.Errorf("CPU pool %q has CPUs which are not in the topology: %s", name, missing.String())
+		}
+		if reserved := cpus.Intersection(reservedCPUs); !reserved.IsEmpty() {
+			return nil, fmt.Errorf("CPU pool %q has reserved CPUs: %s", name, reserved.String())
+		}
+		if overlap := cpus.Intersection(pooledCPUs); !overlap.IsEmpty() {
+			return nil, fmt.Errorf("CPU pool %q overlaps with other pools: %s", name, overlap.String())
+		}
+		pooledCPUs = pooledCPUs.Union(cpus)
+		pools[name] = cpus
+	}
+	return pools, nil
+}
+
+// validateCPUPools checks the pools are used in a configuration which supports them. The pools are
+// grouped devices, and their CPUs are taken out of the topology devices as the tiers split them.
+func (cp *CPUDriver) validateCPUPools() error {
+	if len(cp.cpuPools) == 0 {
+		return nil
+	}
+	if cp.cpuDeviceMode != CPU_DEVICE_MODE_GROUPED || len(cp.socketDeviceModes) > 0 {
+		return fmt.Errorf("the CPU pools require the %s device mode on all the sockets", CPU_DEVICE_MODE_GROUPED)
+	}
+	if len(cp.cpuTiers) > 0 {
+		return fmt.Errorf("the CPU pools and the CPU tiers are mutually exclusive")
+	}
+	return nil
+}
+
+// cpuPoolDeviceName returns the name of the device of the pool.
+func cpuPoolDeviceName(pool string) string {
+	return cpuDevicePoolPrefix + pool
+}
+
+// pooledCPUs returns the CPUs of all the pools.
+func (cp *CPUDriver) pooledCPUs() cpuset.CPUSet {
+	cpus := cpuset.New()
+	for _, poolCPUs := range cp.cpuPools {
+		cpus = cpus.Union(poolCPUs)
+	}
+	return cpus
+}
+
+// excludeCPUPoolDeviceInfos takes the CPUs of the pools out of the topology devices, which are dropped if
+// they have no CPUs left: the CPUs of the pools are available through the devices of the pools only.
+func (cp *CPUDriver) excludeCPUPoolDeviceInfos(devices []groupedCPUDeviceInfo) []groupedCPUDeviceInfo {
+	if len(cp.cpuPools) == 0 {
+		return devices
+	}
+	pooledCPUs := cp.pooledCPUs()
+	var kept []groupedCPUDeviceInfo
+	for _, device := range devices {
+		device.cpus = device.cpus.Difference(pooledCPUs)
+		if device.cpus.IsEmpty() {
+			continue
+		}
+		kept = append(kept, device)
+	}
+	return kept
+}
+
+// createCPUPoolDevices returns the devices of the pools, sorted by name, with their slice groups.
+func (cp *CPUDriver) createCPUPoolDevices() ([]resourceapi.Device, []int) {
+	var devices []resourceapi.Device
+	var groups []int
+	topo := cp.cpuTopology
+	for _, pool := range slices.Sorted(maps.Keys(cp.cpuPools)) {
+		cpus := cp.cpuPools[pool]
+		numCPUs := int64(cpus.Size())
+		attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			AttributeCPUPool:    {StringValue: ptr.To(pool)},
+			AttributeSMTEnabled: {BoolValue: ptr.To(topo.SMTEnabled)},
+			AttributeNumCPUs:    {IntValue: ptr.To(numCPUs)},
+		}
+		// the pools within a socket or a NUMA node report it, so the claims can align them with other devices.
+		if sockets := topo.CPUDetails.KeepOnly(cpus).Sockets(); sockets.Size() == 1 {
+			attrs[AttributeSocketID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(sockets.List()[0]))}
+		}
+		if numaNodes := topo.CPUDetails.KeepOnly(cpus).NUMANodes(); numaNodes.Size() == 1 {
+			attrs[AttributeNUMANodeID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(numaNodes.List()[0]))}
+			cp.setAlignmentAttributes(attrs, numaNodes.List()[0])
+		}
+		setCoreTypeAttribute(attrs, topo, cpus)
+		cp.setPerformanceScoreAttribute(attrs, cpus)
+		cp.setFrequencyAttributes(attrs, cpus)
+		cp.setISAFeatureAttributes(attrs, cpus)
+		cp.setCPUModelAttributes(attrs, cpus)
+		cp.setCPUCapacityAttributes(attrs, cpus)
+		cp.setNUMADistanceAttributes(attrs, cpus)
+		setCacheSizeAttributes(attrs, cp.cpuTopology, cpus)
+		setCPUsAttribute(attrs, cpus)
+		cp.setPCIeRootsAttribute(attrs, cpus.UnsortedList()...)
+		cp.setKernelFeatureAttributes(attrs)
+		cp.setBuildAttributes(attrs)
+
+		devices = append(devices, resourceapi.Device{
+			Name:       cpuPoolDeviceName(pool),
+			Attributes: attrs,
+			Capacity: map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+				cpuResourceQualifiedName:       {Value: *resource.NewQuantity(numCPUs, resource.DecimalSI), RequestPolicy: cp.cpuCapacityRequestPolicy()},
+				fullCoresResourceQualifiedName: {Value: *resource.NewQuantity(cp.fullCoresCapacity(cpus), resource.DecimalSI), RequestPolicy: fullCoresCapacityRequestPolicy()},
+			},
+			AllowMultipleAllocations: ptr.To(true),
+			Taints:                   cp.cpuHealth.taints(cpus),
+		})
+		groups = append(groups, cp.sliceGroupOf(cpus))
+	}
+	return devices, groups
+}
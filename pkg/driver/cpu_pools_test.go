@@ -0,0 +1,262 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestLoadCPUPools(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cpu-pools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pools:\n  realtime: \"0,4\"\n  batch: 2-3\n"), 0600))
+	pools, err := loadCPUPools(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"realtime": "0,4", "batch": "2-3"}, pools)
+
+	require.NoError(t, os.WriteFile(path, []byte("partitions:\n  realtime: \"0,4\"\n"), 0600))
+	_, err = loadCPUPools(path)
+	require.ErrorContains(t, err, "failed to parse the CPU pools file")
+
+	_, err = loadCPUPools(filepath.Join(dir, "missing.yaml"))
+	require.ErrorContains(t, err, "failed to read the CPU pools file")
+}
+
+func TestResolveCPUPools(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		specs         map[string]string
+		reservedCPUs  cpuset.CPUSet
+		expectedPools map[string]cpuset.CPUSet
+		expectedError string
+	}{
+		{
+			name: "no pools",
+		},
+		{
+			name:          "pools",
+			specs:         map[string]string{"realtime": "0,4", "batch": " 2-3 "},
+			expectedPools: map[string]cpuset.CPUSet{"realtime": cpuset.New(0, 4), "batch": cpuset.New(2, 3)},
+		},
+		{
+			name:          "invalid name",
+			specs:         map[string]string{"Realtime": "0"},
+			expectedError: "invalid CPU pool name",
+		},
+		{
+			name:          "invalid cpuset",
+			specs:         map[string]string{"realtime": "fast"},
+			expectedError: "invalid CPUs of pool",
+		},
+		{
+			name:          "no CPUs",
+			specs:         map[string]string{"realtime": ""},
+			expectedError: "has no CPUs",
+		},
+		{
+			name:          "CPUs not in the topology",
+			specs:         map[string]string{"realtime": "0-8"},
+			expectedError: "not in the topology",
+		},
+		{
+			name:          "reserved CPUs",
+			specs:         map[string]string{"realtime": "0-1"},
+			reservedCPUs:  cpuset.New(1),
+			expectedError: "has reserved CPUs",
+		},
+		{
+			name:          "overlapping pools",
+			specs:         map[string]string{"realtime": "0-1", "batch": "1-2"},
+			expectedError: "overlaps with other pools",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pools, err := resolveCPUPools(topo, tc.reservedCPUs, tc.specs)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedPools, pools)
+		})
+	}
+}
+
+func newCPUPoolsTestDriver(t *testing.T) *CPUDriver {
+	t.Helper()
+	return newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		// realtime takes a core of NUMA node 0, batch all of NUMA node 1.
+		pools, err := resolveCPUPools(driver.cpuTopology, driver.reservedCPUs, map[string]string{"realtime": "0,4", "batch": "2-3,6-7"})
+		require.NoError(t, err)
+		driver.cpuPools = pools
+		require.NoError(t, driver.validateCPUPools())
+	})
+}
+
+func TestWithIsolatedCPUPool(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	isolatedSysfs := func(isolated, nohzFull string) fstest.MapFS {
+		return fstest.MapFS{
+			"devices/system/cpu/isolated":  &fstest.MapFile{Data: []byte(isolated + "\n")},
+			"devices/system/cpu/nohz_full": &fstest.MapFile{Data: []byte(nohzFull + "\n")},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		specs         map[string]string
+		sysfs         fstest.MapFS
+		reservedCPUs  cpuset.CPUSet
+		expectedSpecs map[string]string
+		expectedErr   string
+	}{
+		{
+			name:          "isolcpus and nohz_full",
+			specs:         map[string]string{"batch": "0-1"},
+			sysfs:         isolatedSysfs("6", "7"),
+			expectedSpecs: map[string]string{"batch": "0-1", "isolated": "6-7"},
+		},
+		{
+			name:          "reserved and offline CPUs left out",
+			sysfs:         isolatedSysfs("0,6,42", "(null)"),
+			reservedCPUs:  cpuset.New(0),
+			expectedSpecs: map[string]string{"isolated": "6"},
+		},
+		{
+			name:          "nothing isolated",
+			specs:         map[string]string{"batch": "0-1"},
+			sysfs:         isolatedSysfs("", "(null)"),
+			expectedSpecs: map[string]string{"batch": "0-1"},
+		},
+		{
+			name:        "pool name taken by the file",
+			specs:       map[string]string{"isolated": "0-1"},
+			sysfs:       isolatedSysfs("6", ""),
+			expectedErr: "reserved for the isolated CPUs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			specs, err := withIsolatedCPUPool(logger, tc.specs, tc.sysfs, topo, tc.reservedCPUs)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedSpecs, specs)
+		})
+	}
+
+	// the isolated CPUs overlapping with the pools of the file are refused.
+	specs, err := withIsolatedCPUPool(logger, map[string]string{"batch": "5-6"}, isolatedSysfs("6", ""), topo, cpuset.New())
+	require.NoError(t, err)
+	_, err = resolveCPUPools(topo, cpuset.New(), specs)
+	require.ErrorContains(t, err, "overlaps with other pools")
+}
+
+func TestCreateGroupedCPUDeviceSlicesCPUPools(t *testing.T) {
+	driver := newCPUPoolsTestDriver(t)
+
+	expected := map[string]struct {
+		numCPUs    int64
+		pool       string
+		numaNodeID int64
+	}{
+		"cpudevnuma000":       {numCPUs: 2, numaNodeID: 0},
+		"cpudevpool-batch":    {numCPUs: 4, pool: "batch", numaNodeID: 1},
+		"cpudevpool-realtime": {numCPUs: 2, pool: "realtime", numaNodeID: 0},
+	}
+	var devices []resourceapi.Device
+	for _, chunk := range driver.createGroupedCPUDeviceSlices(testr.New(t)) {
+		devices = append(devices, chunk...)
+	}
+	require.Len(t, devices, len(expected))
+	for _, device := range devices {
+		want, ok := expected[device.Name]
+		require.True(t, ok, "unexpected device %s", device.Name)
+		require.Equal(t, want.numCPUs, capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+		require.Equal(t, want.numaNodeID, *device.Attributes[AttributeNUMANodeID].IntValue, "device %s", device.Name)
+		if want.pool == "" {
+			require.NotContains(t, device.Attributes, AttributeCPUPool)
+			continue
+		}
+		require.Equal(t, want.pool, *device.Attributes[AttributeCPUPool].StringValue, "device %s", device.Name)
+	}
+}
+
+func TestPrepareResourceClaimsCPUPools(t *testing.T) {
+	driver := newCPUPoolsTestDriver(t)
+
+	// the CPUs of the pools are available through the devices of the pools only.
+	for _, tc := range []struct {
+		claimUID   types.UID
+		device     string
+		numCPUs    int64
+		deviceCPUs cpuset.CPUSet
+	}{
+		{"claim-1", "cpudevnuma000", 2, cpuset.New(1, 5)},
+		{"claim-2", "cpudevpool-realtime", 1, cpuset.New(0, 4)},
+		{"claim-3", "cpudevpool-batch", 4, cpuset.New(2, 3, 6, 7)},
+	} {
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(tc.claimUID, testDriverName, testNodeName, map[string]int64{tc.device: tc.numCPUs}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[tc.claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(tc.claimUID)
+		require.Equal(t, int(tc.numCPUs), gotCPUs.Size(), "claim %s: got %s", tc.claimUID, gotCPUs)
+		require.True(t, gotCPUs.IsSubsetOf(tc.deviceCPUs), "claim %s: got %s", tc.claimUID, gotCPUs)
+	}
+
+	// the NUMA node device is exhausted, while a CPU of the realtime pool on the same NUMA node is still free.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-4", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-4"].Err)
+}
+
+func TestValidateCPUPools(t *testing.T) {
+	driver := newCPUPoolsTestDriver(t)
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	require.ErrorContains(t, driver.validateCPUPools(), "require the grouped device mode")
+
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.cpuTiers = map[string]cpuset.CPUSet{"gold": cpuset.New(1)}
+	require.ErrorContains(t, driver.validateCPUPools(), "mutually exclusive")
+}
@@ -0,0 +1,203 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// IRQ_POLICY_DEFAULT leaves the interrupts where they are. This is the default.
+	IRQ_POLICY_DEFAULT = "default"
+	// IRQ_POLICY_EXCLUDE steers the interrupts away from the CPUs of the claims.
+	IRQ_POLICY_EXCLUDE = "exclude"
+
+	// cpuProfilesResync is how often the watched CPUProfiles are resynced.
+	cpuProfilesResync = 10 * time.Minute
+)
+
+// CPUProfileResource is the resource of the cluster-scoped CPUProfile objects.
+var CPUProfileResource = schema.GroupVersionResource{Group: "cpu.dra.x-k8s.io", Version: "v1alpha1", Resource: "cpuprofiles"}
+
+// CPUProfileSpec is the spec of a CPUProfile: a bundle of settings the cluster admins define once, and the
+// claims reference by name with the cpuProfile parameter.
+type CPUProfileSpec struct {
+	// Governor is the cpufreq governor of the CPUs of the claims, e.g. performance. Empty keeps theirs.
+	Governor string `json:"governor,omitempty"`
+	// MaxCState is the deepest cpuidle state the CPUs of the claims may enter, by index: the deeper states are
+	// disabled, so the CPUs wake up faster. Nil keeps all the states.
+	MaxCState *int `json:"maxCState,omitempty"`
+	// IRQPolicy is IRQ_POLICY_EXCLUDE or IRQ_POLICY_DEFAULT, the default.
+	IRQPolicy string `json:"irqPolicy,omitempty"`
+	// SMTPolicy is SMT_POLICY_FULL_CORES, as the fullPCPUsOnly parameter, or SMT_POLICY_SHARED, the default.
+	SMTPolicy string `json:"smtPolicy,omitempty"`
+}
+
+// Validate returns an error if the spec is invalid, e.g. to reject the CPUProfiles at admission.
+func (s *CPUProfileSpec) Validate() error {
+	var errs []error
+	if s.MaxCState != nil && *s.MaxCState < 0 {
+		errs = append(errs, fmt.Errorf("invalid maxCState %d, must not be negative", *s.MaxCState))
+	}
+	switch s.IRQPolicy {
+	case "", IRQ_POLICY_DEFAULT, IRQ_POLICY_EXCLUDE:
+	default:
+		errs = append(errs, fmt.Errorf("invalid irqPolicy %q, must be %s or %s", s.IRQPolicy, IRQ_POLICY_EXCLUDE, IRQ_POLICY_DEFAULT))
+	}
+	switch s.SMTPolicy {
+	case "", SMT_POLICY_SHARED, SMT_POLICY_FULL_CORES:
+	default:
+		errs = append(errs, fmt.Errorf("invalid smtPolicy %q, must be %s or %s", s.SMTPolicy, SMT_POLICY_SHARED, SMT_POLICY_FULL_CORES))
+	}
+	return errors.Join(errs...)
+}
+
+// applyTo sets the tunings of the profile, overriding the ones it sets.
+func (s *CPUProfileSpec) applyTo(tuning *cpuTuning) {
+	if s.Governor != "" {
+		tuning.governor = s.Governor
+	}
+	if s.MaxCState != nil {
+		tuning.maxCState = s.MaxCState
+	}
+	switch s.IRQPolicy {
+	case IRQ_POLICY_EXCLUDE:
+		tuning.excludeInterrupts = true
+	case IRQ_POLICY_DEFAULT:
+		tuning.excludeInterrupts = false
+	}
+}
+
+// claimCPUProfile returns the CPUProfile the requests of the claim allocated by the driver reference, nil
+// if none does. Returns an error if the profile is unknown or invalid, or the requests reference different
+// profiles.
+func (cp *CPUDriver) claimCPUProfile(claim *resourceapi.ResourceClaim) (*CPUProfileSpec, error) {
+	if claim.Status.Allocation == nil {
+		return nil, nil
+	}
+	var name string
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		deviceConfig, err := cp.deviceConfigForRequest(claim, alloc.Request)
+		if err != nil {
+			return nil, err
+		}
+		if deviceConfig.CPUProfile == "" {
+			continue
+		}
+		if name != "" && name != deviceConfig.CPUProfile {
+			return nil, fmt.Errorf("claim %s/%s references the CPUProfiles %q and %q, at most one applies to a claim", claim.Namespace, claim.Name, name, deviceConfig.CPUProfile)
+		}
+		name = deviceConfig.CPUProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	if cp.cpuProfiles == nil {
+		return nil, fmt.Errorf("claim %s/%s references the CPUProfile %q, which requires the %s feature gate", claim.Namespace, claim.Name, name, FEATURE_GATE_CPU_PROFILES)
+	}
+	profile, err := cp.cpuProfiles.get(name)
+	if err != nil {
+		return nil, fmt.Errorf("claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	return profile, nil
+}
+
+// cpuProfileWatcher caches the CPUProfiles, so the claims are prepared without a round trip to the API server.
+type cpuProfileWatcher struct {
+	factory dynamicinformer.DynamicSharedInformerFactory
+	// informer is nil in the tests, which fill the store directly.
+	informer cache.SharedIndexInformer
+	store    cache.Store
+	cancel   context.CancelFunc
+}
+
+func newCPUProfileWatcher(client dynamic.Interface) *cpuProfileWatcher {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, cpuProfilesResync)
+	informer := factory.ForResource(CPUProfileResource).Informer()
+	return &cpuProfileWatcher{
+		factory:  factory,
+		informer: informer,
+		store:    informer.GetStore(),
+	}
+}
+
+// get returns the spec of a CPUProfile.
+func (w *cpuProfileWatcher) get(name string) (*CPUProfileSpec, error) {
+	obj, exists, err := w.store.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("CPUProfile %q not found", name)
+	}
+	profile, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected CPUProfile object %T", obj)
+	}
+	var spec CPUProfileSpec
+	if rawSpec, ok := profile.Object["spec"].(map[string]any); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(rawSpec, &spec, true); err != nil {
+			return nil, fmt.Errorf("invalid CPUProfile %q: %w", name, err)
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid CPUProfile %q: %w", name, err)
+	}
+	return &spec, nil
+}
+
+// Name implements Component.
+func (w *cpuProfileWatcher) Name() string {
+	return COMPONENT_CPU_PROFILES
+}
+
+// Start watches the CPUProfiles, and waits for the first list of them.
+func (w *cpuProfileWatcher) Start(ctx context.Context) error {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), w.informer.HasSynced) {
+		w.cancel()
+		w.factory.Shutdown()
+		return fmt.Errorf("the CPUProfiles were not listed")
+	}
+	return nil
+}
+
+// Stop stops watching the CPUProfiles.
+func (w *cpuProfileWatcher) Stop(ctx context.Context) {
+	w.cancel()
+	w.factory.Shutdown()
+}
+
+// Healthy implements Component. The watch of the CPUProfiles is restarted by the informer.
+func (w *cpuProfileWatcher) Healthy() error {
+	return nil
+}
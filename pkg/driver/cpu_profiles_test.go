@@ -0,0 +1,157 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+// newTestCPUProfiles returns a watcher of the given CPUProfiles, by name.
+func newTestCPUProfiles(t *testing.T, specs map[string]map[string]any) *cpuProfileWatcher {
+	t.Helper()
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for name, spec := range specs {
+		profile := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "cpu.dra.x-k8s.io/v1alpha1",
+			"kind":       "CPUProfile",
+			"metadata":   map[string]any{"name": name},
+			"spec":       spec,
+		}}
+		require.NoError(t, store.Add(profile))
+	}
+	return &cpuProfileWatcher{store: store}
+}
+
+func TestCPUProfileWatcherGet(t *testing.T) {
+	watcher := newTestCPUProfiles(t, map[string]map[string]any{
+		"realtime":      {"governor": "performance", "maxCState": int64(0), "irqPolicy": "exclude", "smtPolicy": "full-cores"},
+		"bad-irq":       {"irqPolicy": "isolate"},
+		"bad-cstate":    {"maxCState": int64(-1)},
+		"unknown-field": {"governour": "performance"},
+	})
+
+	spec, err := watcher.get("realtime")
+	require.NoError(t, err)
+	require.Equal(t, "performance", spec.Governor)
+	require.Equal(t, 0, *spec.MaxCState)
+	var tuning cpuTuning
+	spec.applyTo(&tuning)
+	require.Equal(t, "performance", tuning.governor)
+	require.True(t, tuning.excludeInterrupts)
+	require.False(t, tuning.disableTimerMigration)
+
+	_, err = watcher.get("missing")
+	require.ErrorContains(t, err, `CPUProfile "missing" not found`)
+	_, err = watcher.get("bad-irq")
+	require.ErrorContains(t, err, `invalid irqPolicy "isolate"`)
+	_, err = watcher.get("bad-cstate")
+	require.ErrorContains(t, err, "invalid maxCState -1")
+	_, err = watcher.get("unknown-field")
+	require.ErrorContains(t, err, "governour")
+}
+
+func TestPrepareResourceClaimsCPUProfile(t *testing.T) {
+	claimUID := types.UID("claim-cpu-profile")
+	newClaim := func(numCPUs int64, parameters string) *resourceapi.ResourceClaim {
+		return testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": numCPUs}), parameters)
+	}
+	profiles := map[string]map[string]any{
+		"realtime": {"governor": "performance", "maxCState": int64(1), "irqPolicy": "exclude", "smtPolicy": "full-cores"},
+		// the profile keeps the interrupts of the low-latency profile where they are.
+		"quiet-irqs": {"irqPolicy": "default"},
+	}
+
+	t.Run("feature gate disabled", func(t *testing.T) {
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{newClaim(2, `{"cpuProfile": "realtime"}`)})
+		require.NoError(t, err)
+		require.ErrorContains(t, prepared[claimUID].Err, "requires the CPUProfiles feature gate")
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+			cp.cpuProfiles = newTestCPUProfiles(t, profiles)
+		})
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{newClaim(2, `{"cpuProfile": "missing"}`)})
+		require.NoError(t, err)
+		require.ErrorContains(t, prepared[claimUID].Err, `CPUProfile "missing" not found`)
+	})
+
+	t.Run("full cores SMT policy", func(t *testing.T) {
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+			cp.cpuProfiles = newTestCPUProfiles(t, profiles)
+			cp.tuner = newCPUTuner(t.TempDir(), t.TempDir(), cpuset.New(0, 1, 2, 3, 4, 5, 6, 7))
+		})
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{newClaim(1, `{"cpuProfile": "realtime"}`)})
+		require.NoError(t, err)
+		require.ErrorContains(t, prepared[claimUID].Err, "requires whole physical cores")
+	})
+
+	t.Run("applied and reverted", func(t *testing.T) {
+		onlineCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+		sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+			cp.cpuProfiles = newTestCPUProfiles(t, profiles)
+			cp.tuner = newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+		})
+		claim := newClaim(2, `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "tuning": {"cpuProfile": "realtime"}}`)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		require.NoError(t, err)
+		require.NoError(t, prepared[claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		require.Equal(t, "0,4", gotCPUs.String())
+		require.Equal(t, "performance", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+		require.Equal(t, "0", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpuidle", "state1", "disable"))
+		require.Equal(t, "1", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpuidle", "state2", "disable"))
+		require.Equal(t, "1-3,5-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+		require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+
+		_, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+		require.NoError(t, err)
+		require.Equal(t, "powersave", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+		require.Equal(t, "0", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpuidle", "state2", "disable"))
+		require.Equal(t, "0-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+	})
+
+	t.Run("overrides the low-latency profile", func(t *testing.T) {
+		onlineCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+		sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+		gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_LOW_LATENCY_PROFILE): true})
+		require.NoError(t, err)
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+			cp.featureGates = gates
+			cp.cpuProfiles = newTestCPUProfiles(t, profiles)
+			cp.tuner = newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+		})
+		claim := newClaim(2, `{"profile": "low-latency", "cpuProfile": "quiet-irqs"}`)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		require.NoError(t, err)
+		require.NoError(t, prepared[claimUID].Err)
+		require.Equal(t, "performance", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+		require.Equal(t, "0", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+		require.Equal(t, "0-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+	})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// cpuQuotaDisabledEnvVarPrefix is the prefix of the container environment variable marking the claims
+	// whose containers run without CPU quota. Like the trace ID, it survives the driver restarts.
+	cpuQuotaDisabledEnvVarPrefix = "DRA_CPU_QUOTA_DISABLED"
+	// cpuQuotaAnnotation is the container annotation keeping the CPU quota the container was created with,
+	// before the driver removed it, so it can be restored.
+	cpuQuotaAnnotation = "dra.cpu/cpu-quota"
+	// unlimitedCPUQuota is the OCI CPU quota meaning no limit, "max" in the cgroup v2 cpu.max file.
+	unlimitedCPUQuota int64 = -1
+)
+
+// cpuQuotaDisabledEnvVar returns the environment variable marking the containers of a claim to run without CPU quota.
+func cpuQuotaDisabledEnvVar(claimUID types.UID) string {
+	return fmt.Sprintf("%s_%s=true", cpuQuotaDisabledEnvVarPrefix, claimUID)
+}
+
+// parseCPUQuotaDisabledEnv returns the claims whose containers run without CPU quota, from the container environment.
+func parseCPUQuotaDisabledEnv(envs []string) sets.Set[types.UID] {
+	return parseClaimFlagEnv(envs, cpuQuotaDisabledEnvVarPrefix)
+}
+
+// parseClaimFlagEnv returns the claims whose flag, with the given prefix, is set in the container environment.
+func parseClaimFlagEnv(envs []string, prefix string) sets.Set[types.UID] {
+	claimUIDs := sets.New[types.UID]()
+	for _, env := range envs {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || value != "true" {
+			continue
+		}
+		claimUID, ok := strings.CutPrefix(key, prefix+"_")
+		if !ok || claimUID == "" {
+			continue
+		}
+		claimUIDs.Insert(types.UID(claimUID))
+	}
+	return claimUIDs
+}
+
+// claimDisablesCPUQuota returns true if any request of the claim allocated by the driver disables the CPU quota.
+func (cp *CPUDriver) claimDisablesCPUQuota(claim *resourceapi.ResourceClaim) (bool, error) {
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.DisableCPUQuota })
+}
+
+// containerCPUQuotaDisabled returns true if any of the claims of a container disables the CPU quota,
+// preferring what is found in the container environment.
+func (cp *CPUDriver) containerCPUQuotaDisabled(envs []string, claimUIDs []types.UID) bool {
+	envClaimUIDs := parseCPUQuotaDisabledEnv(envs)
+	for _, claimUID := range claimUIDs {
+		if envClaimUIDs.Has(claimUID) || cp.cpuAllocationStore.IsResourceClaimCPUQuotaDisabled(claimUID) {
+			return true
+		}
+	}
+	return false
+}
+
+// disableCPUQuota removes the CPU quota of a container being created, remembering the original one in
+// a container annotation. The containers created without quota are left alone.
+func disableCPUQuota(ctr *api.Container, adjust *api.ContainerAdjustment) bool {
+	quota := ctr.GetLinux().GetResources().GetCpu().GetQuota()
+	if quota == nil || quota.GetValue() <= 0 {
+		return false
+	}
+	adjust.AddAnnotation(cpuQuotaAnnotation, strconv.FormatInt(quota.GetValue(), 10))
+	adjust.SetLinuxCPUQuota(unlimitedCPUQuota)
+	return true
+}
+
+// originalCPUQuota returns the CPU quota a container was created with, if the driver removed it.
+func originalCPUQuota(ctr *api.Container) (int64, bool) {
+	value, ok := ctr.GetAnnotations()[cpuQuotaAnnotation]
+	if !ok {
+		return 0, false
+	}
+	quota, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	return quota, true
+}
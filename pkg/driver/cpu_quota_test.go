@@ -0,0 +1,169 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestParseCPUQuotaDisabledEnv(t *testing.T) {
+	claimUIDs := parseCPUQuotaDisabledEnv([]string{
+		cpuQuotaDisabledEnvVar("claim-A"),
+		"DRA_CPU_QUOTA_DISABLED_claim-B=false",
+		"DRA_CPU_QUOTA_DISABLED_=true",
+		fmt.Sprintf("%s_claim-C=%s", cdiEnvVarPrefix, "0-1"),
+	})
+	require.ElementsMatch(t, []types.UID{"claim-A"}, claimUIDs.UnsortedList())
+}
+
+func TestPrepareResourceClaimsDisableCPUQuota(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             cdiMgr,
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	quotaUID := types.UID("claim-no-quota")
+	defaultUID := types.UID("claim-default")
+	claims := []*resourceapi.ResourceClaim{
+		testClaimAllCPUs(testClaim(quotaUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), `{"disableCPUQuota": true}`),
+		testClaim(defaultUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}),
+	}
+	prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+	require.NoError(t, prepared[quotaUID].Err)
+	require.NoError(t, prepared[defaultUID].Err)
+
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimCPUQuotaDisabled(quotaUID))
+	require.Contains(t, cdiMgr.specs[getCDIDeviceName(quotaUID)].ContainerEdits.Env, cpuQuotaDisabledEnvVar(quotaUID))
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimCPUQuotaDisabled(defaultUID))
+	require.NotContains(t, cdiMgr.specs[getCDIDeviceName(defaultUID)].ContainerEdits.Env, cpuQuotaDisabledEnvVar(defaultUID))
+}
+
+func TestCreateContainerDisableCPUQuota(t *testing.T) {
+	logger := testr.New(t)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	withQuota := func(quota int64) *api.LinuxContainer {
+		return &api.LinuxContainer{Resources: &api.LinuxResources{Cpu: &api.LinuxCPU{Quota: api.Int64(quota), Period: api.UInt64(100000)}}}
+	}
+
+	testCases := []struct {
+		name               string
+		env                []string
+		linux              *api.LinuxContainer
+		expectedQuota      *api.OptionalInt64
+		expectedAnnotation string
+	}{
+		{
+			name:  "quota kept by default",
+			env:   []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "2,6")},
+			linux: withQuota(200000),
+		},
+		{
+			name:               "quota removed",
+			env:                []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "2,6"), cpuQuotaDisabledEnvVar("claim-uid-1")},
+			linux:              withQuota(200000),
+			expectedQuota:      api.Int64(unlimitedCPUQuota),
+			expectedAnnotation: "200000",
+		},
+		{
+			name: "no quota to remove",
+			env:  []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "2,6"), cpuQuotaDisabledEnvVar("claim-uid-1")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &CPUDriver{
+				podConfigStore:     store.NewPodConfig(),
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				claimTracker:       store.NewClaimTracker(),
+				cpuTopology:        topo,
+			}
+			ctr := &api.Container{Id: "ctr-id-1", PodSandboxId: pod.Id, Name: "my-ctr", Env: tc.env, Linux: tc.linux}
+			adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedQuota, adjust.GetLinux().GetResources().GetCpu().GetQuota())
+			require.Equal(t, tc.expectedAnnotation, adjust.GetAnnotations()[cpuQuotaAnnotation])
+		})
+	}
+}
+
+func TestSynchronizeCPUQuota(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	quotaAnnotation := map[string]string{cpuQuotaAnnotation: "200000"}
+	containers := []*api.Container{
+		{
+			Id: "exclusive", PodSandboxId: pod.Id, Name: "exclusive", Annotations: quotaAnnotation,
+			Env: []string{fmt.Sprintf("%s_claim-A=%s", cdiEnvVarPrefix, "0,4"), cpuQuotaDisabledEnvVar("claim-A")},
+		},
+		// the claim of the container was released while the driver was down: it is back on the shared CPUs.
+		{Id: "released", PodSandboxId: pod.Id, Name: "released", Annotations: quotaAnnotation},
+		{Id: "shared", PodSandboxId: pod.Id, Name: "shared"},
+	}
+
+	updates, err := driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, containers)
+	require.NoError(t, err)
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimCPUQuotaDisabled("claim-A"))
+
+	quotas := make(map[string]*api.OptionalInt64)
+	for _, update := range updates {
+		quotas[update.ContainerId] = update.GetLinux().GetResources().GetCpu().GetQuota()
+	}
+	require.Equal(t, api.Int64(unlimitedCPUQuota), quotas["exclusive"])
+	require.Equal(t, api.Int64(200000), quotas["released"])
+	require.Nil(t, quotas["shared"])
+}
@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsCPUSortingStrategy(t *testing.T) {
+	claimUID := types.UID("claim-sorting")
+
+	testCases := []struct {
+		name           string
+		strategy       string
+		expectedCPUSet cpuset.CPUSet
+	}{
+		{
+			// the sibling threads of a core.
+			name:           "default",
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:           "packed",
+			strategy:       CPU_SORTING_STRATEGY_PACKED,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			// a thread of two distinct cores.
+			name:           "spread",
+			strategy:       CPU_SORTING_STRATEGY_SPREAD,
+			expectedCPUSet: cpuset.New(0, 1),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.cpuSortingStrategy = tc.strategy
+			})
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+				testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			})
+			require.NoError(t, err)
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// maxCPUTierNameLength keeps the names of the grouped devices of the tiers within the limit of the device names.
+const maxCPUTierNameLength = 32
+
+// resolveCPUTiers resolves the CPUs of the operator-defined CPU tiers. Each tier is defined by a cpuset,
+// or by a core type ("standard", "p-core" or "e-core") selecting all the CPUs of that type. The tiers
+// must have valid names and must not overlap.
+func resolveCPUTiers(topo *cpuinfo.CPUTopology, specs map[string]string) (map[string]cpuset.CPUSet, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	tiers := make(map[string]cpuset.CPUSet, len(specs))
+	allCPUs := topo.CPUDetails.CPUs()
+	tieredCPUs := cpuset.New()
+	for _, name := range slices.Sorted(maps.Keys(specs)) {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid CPU tier name %q: %s", name, strings.Join(errs, ", "))
+		}
+		if len(name) > maxCPUTierNameLength {
+			return nil, fmt.Errorf("invalid CPU tier name %q: must be no more than %d characters", name, maxCPUTierNameLength)
+		}
+		cpus, err := cpuTierCPUs(topo, specs[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPUs of tier %q: %w", name, err)
+		}
+		if cpus.IsEmpty() {
+			return nil, fmt.Errorf("CPU tier %q has no CPUs", name)
+		}
+		if missing := cpus.Difference(allCPUs); !missing.IsEmpty() {
+			return nil, fmt.Errorf("CPU tier %q has CPUs which are not in the topology: %s", name, missing.String())
+		}
+		if overlap := cpus.Intersection(tieredCPUs); !overlap.IsEmpty() {
+			return nil, fmt.Errorf("CPU tier %q overlaps with other tiers: %s", name, overlap.String())
+		}
+		tieredCPUs = tieredCPUs.Union(cpus)
+		tiers[name] = cpus
+	}
+	return tiers, nil
+}
+
+// cpuTierCPUs returns the CPUs selected by the definition of a tier.
+func cpuTierCPUs(topo *cpuinfo.CPUTopology, spec string) (cpuset.CPUSet, error) {
+	spec = strings.TrimSpace(spec)
+	for _, coreType := range []cpuinfo.CoreType{cpuinfo.CoreTypeStandard, cpuinfo.CoreTypePerformance, cpuinfo.CoreTypeEfficiency} {
+		if !strings.EqualFold(spec, coreType.String()) {
+			continue
+		}
+		var cpuIDs []int
+		for cpuID, info := range topo.CPUDetails {
+			if info.CoreType == coreType {
+				cpuIDs = append(cpuIDs, cpuID)
+			}
+		}
+		return cpuset.New(cpuIDs...), nil
+	}
+	return cpuset.Parse(spec)
+}
+
+// coreTypeTierSpecs defines a tier per core type on the hybrid parts, named after the core type (e.g. "p-core"),
+// so each grouped device is split in a device per core type. The parts with a single core type have no tiers.
+func coreTypeTierSpecs(topo *cpuinfo.CPUTopology) map[string]string {
+	specs := make(map[string]string)
+	for _, info := range topo.CPUDetails {
+		if info.CoreType != cpuinfo.CoreTypeUndefined {
+			specs[info.CoreType.String()] = info.CoreType.String()
+		}
+	}
+	if len(specs) < 2 {
+		return nil
+	}
+	return specs
+}
+
+// cpuTierDeviceName returns the name of the device grouping the CPUs of the tier among the CPUs of a group.
+func cpuTierDeviceName(groupName, tier string) string {
+	return groupName + "-" + tier
+}
+
+// tieredCPUs returns the CPUs of all the tiers.
+func (cp *CPUDriver) tieredCPUs() cpuset.CPUSet {
+	cpus := cpuset.New()
+	for _, tierCPUs := range cp.cpuTiers {
+		cpus = cpus.Union(tierCPUs)
+	}
+	return cpus
+}
+
+// cpuTierOf returns the tier of the CPU, or empty if the CPU is in no tier.
+func (cp *CPUDriver) cpuTierOf(cpuID int) string {
+	for tier, cpus := range cp.cpuTiers {
+		if cpus.Contains(cpuID) {
+			return tier
+		}
+	}
+	return ""
+}
+
+// splitCPUTierDeviceInfos splits each grouped device in a device per tier, for the CPUs of the group
+// in the tier, and keeps the device of the group for the CPUs in no tier, if any.
+func (cp *CPUDriver) splitCPUTierDeviceInfos(devices []groupedCPUDeviceInfo) []groupedCPUDeviceInfo {
+	if len(cp.cpuTiers) == 0 {
+		return devices
+	}
+	tieredCPUs := cp.tieredCPUs()
+	tiers := slices.Sorted(maps.Keys(cp.cpuTiers))
+	var split []groupedCPUDeviceInfo
+	for _, device := range devices {
+		if untiered := device.cpus.Difference(tieredCPUs); !untiered.IsEmpty() {
+			untieredDevice := device
+			untieredDevice.cpus = untiered
+			split = append(split, untieredDevice)
+		}
+		for _, tier := range tiers {
+			cpus := device.cpus.Intersection(cp.cpuTiers[tier])
+			if cpus.IsEmpty() {
+				continue
+			}
+			tierDevice := device
+			tierDevice.name = cpuTierDeviceName(device.name, tier)
+			tierDevice.aliases = nil
+			for _, alias := range device.aliases {
+				tierDevice.aliases = append(tierDevice.aliases, cpuTierDeviceName(alias, tier))
+			}
+			tierDevice.cpus = cpus
+			tierDevice.cpuTier = tier
+			split = append(split, tierDevice)
+		}
+	}
+	return split
+}
+
+// cpuTierCPUsOfDevice restricts the CPUs of the group of a grouped device to the CPUs of its tier,
+// or to the CPUs in no tier for the devices of no tier.
+func (cp *CPUDriver) cpuTierCPUsOfDevice(deviceName string, cpus cpuset.CPUSet) cpuset.CPUSet {
+	if len(cp.cpuTiers) == 0 {
+		return cpus
+	}
+	if tier, ok := cp.deviceNameToCPUTier[deviceName]; ok {
+		return cpus.Intersection(cp.cpuTiers[tier])
+	}
+	return cpus.Difference(cp.tieredCPUs())
+}
+
+// setCoreTypeAttribute reports the core type of a grouped device whose CPUs all have the same core type.
+func setCoreTypeAttribute(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, topo *cpuinfo.CPUTopology, cpus cpuset.CPUSet) {
+	coreType := cpuinfo.CoreTypeUndefined
+	for i, cpuID := range cpus.List() {
+		if i == 0 {
+			coreType = topo.CPUDetails[cpuID].CoreType
+		} else if topo.CPUDetails[cpuID].CoreType != coreType {
+			return
+		}
+	}
+	if coreType == cpuinfo.CoreTypeUndefined {
+		return
+	}
+	attrs[AttributeCoreType] = resourceapi.DeviceAttribute{StringValue: ptr.To(coreType.String())}
+}
+
+// setCPUTierAttribute reports the tier of the device, if any.
+func setCPUTierAttribute(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, tier string) {
+	if tier == "" {
+		return
+	}
+	attrs[AttributeCPUTier] = resourceapi.DeviceAttribute{StringValue: ptr.To(tier)}
+}
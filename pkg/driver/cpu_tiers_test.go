@@ -0,0 +1,253 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestResolveCPUTiers(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_Hybrid_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		specs         map[string]string
+		expectedTiers map[string]cpuset.CPUSet
+		expectedError string
+	}{
+		{
+			name:          "no tiers",
+			expectedTiers: nil,
+		},
+		{
+			name:          "cpusets",
+			specs:         map[string]string{"gold": "0,2", "silver": "1"},
+			expectedTiers: map[string]cpuset.CPUSet{"gold": cpuset.New(0, 2), "silver": cpuset.New(1)},
+		},
+		{
+			name:          "core types",
+			specs:         map[string]string{"gold": "p-core", "bronze": "E-Core"},
+			expectedTiers: map[string]cpuset.CPUSet{"gold": cpuset.New(0, 2), "bronze": cpuset.New(1, 3)},
+		},
+		{
+			name:          "invalid name",
+			specs:         map[string]string{"Gold": "0"},
+			expectedError: "invalid CPU tier name",
+		},
+		{
+			name:          "name too long",
+			specs:         map[string]string{strings.Repeat("a", maxCPUTierNameLength+1): "0"},
+			expectedError: "invalid CPU tier name",
+		},
+		{
+			name:          "invalid cpuset",
+			specs:         map[string]string{"gold": "fast"},
+			expectedError: "invalid CPUs of tier",
+		},
+		{
+			name:          "no CPUs of the core type",
+			specs:         map[string]string{"gold": "standard"},
+			expectedError: "has no CPUs",
+		},
+		{
+			name:          "CPUs not in the topology",
+			specs:         map[string]string{"gold": "0-7"},
+			expectedError: "not in the topology",
+		},
+		{
+			name:          "overlapping tiers",
+			specs:         map[string]string{"gold": "p-core", "silver": "0-1"},
+			expectedError: "overlaps with other tiers",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tiers, err := resolveCPUTiers(topo, tc.specs)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, tiers, len(tc.expectedTiers))
+			for tier, cpus := range tc.expectedTiers {
+				require.True(t, cpus.Equals(tiers[tier]), "tier %s: got %s", tier, tiers[tier])
+			}
+		})
+	}
+}
+
+func newCPUTiersTestDriver(t *testing.T, cpuDeviceMode string) *CPUDriver {
+	t.Helper()
+	return newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		// gold takes a core of NUMA node 0, silver all of NUMA node 1.
+		tiers, err := resolveCPUTiers(driver.cpuTopology, map[string]string{"gold": "0,4", "silver": "2-3,6-7"})
+		require.NoError(t, err)
+		driver.cpuDeviceMode = cpuDeviceMode
+		driver.cpuTiers = tiers
+	})
+}
+
+func TestCreateGroupedCPUDeviceSlicesCPUTiers(t *testing.T) {
+	driver := newCPUTiersTestDriver(t, CPU_DEVICE_MODE_GROUPED)
+
+	expected := map[string]struct {
+		numCPUs int64
+		tier    string
+	}{
+		"cpudevnuma000":        {numCPUs: 2},
+		"cpudevnuma000-gold":   {numCPUs: 2, tier: "gold"},
+		"cpudevnuma001-silver": {numCPUs: 4, tier: "silver"},
+	}
+	var devices []resourceapi.Device
+	for _, chunk := range driver.createGroupedCPUDeviceSlices(testr.New(t)) {
+		devices = append(devices, chunk...)
+	}
+	require.Len(t, devices, len(expected))
+	for _, device := range devices {
+		want, ok := expected[device.Name]
+		require.True(t, ok, "unexpected device %s", device.Name)
+		require.Equal(t, want.numCPUs, capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+		if want.tier == "" {
+			require.NotContains(t, device.Attributes, AttributeCPUTier)
+			continue
+		}
+		require.Equal(t, want.tier, *device.Attributes[AttributeCPUTier].StringValue, "device %s", device.Name)
+	}
+}
+
+func TestCreateCPUDeviceSlicesCPUTiers(t *testing.T) {
+	driver := newCPUTiersTestDriver(t, CPU_DEVICE_MODE_INDIVIDUAL)
+
+	for _, chunk := range driver.createCPUDeviceSlices() {
+		for _, device := range chunk {
+			cpuID := int(*device.Attributes[AttributeCPUID].IntValue)
+			tier := driver.cpuTierOf(cpuID)
+			if tier == "" {
+				require.NotContains(t, device.Attributes, AttributeCPUTier, "cpu %d", cpuID)
+				continue
+			}
+			require.Equal(t, tier, *device.Attributes[AttributeCPUTier].StringValue, "cpu %d", cpuID)
+		}
+	}
+}
+
+func TestPrepareResourceClaimsCPUTiers(t *testing.T) {
+	driver := newCPUTiersTestDriver(t, CPU_DEVICE_MODE_GROUPED)
+
+	// the CPUs of each device never leave its tier.
+	for _, tc := range []struct {
+		claimUID   types.UID
+		device     string
+		numCPUs    int64
+		deviceCPUs cpuset.CPUSet
+	}{
+		{"claim-1", "cpudevnuma000", 2, cpuset.New(1, 5)},
+		{"claim-2", "cpudevnuma000-gold", 2, cpuset.New(0, 4)},
+		{"claim-3", "cpudevnuma001-silver", 3, cpuset.New(2, 3, 6, 7)},
+	} {
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(tc.claimUID, testDriverName, testNodeName, map[string]int64{tc.device: tc.numCPUs}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[tc.claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(tc.claimUID)
+		require.Equal(t, int(tc.numCPUs), gotCPUs.Size(), "claim %s: got %s", tc.claimUID, gotCPUs)
+		require.True(t, gotCPUs.IsSubsetOf(tc.deviceCPUs), "claim %s: got %s", tc.claimUID, gotCPUs)
+	}
+
+	// the gold tier is exhausted, while a CPU of the silver tier is still free.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-4", testDriverName, testNodeName, map[string]int64{"cpudevnuma000-gold": 1}),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-4"].Err)
+}
+
+func TestCreateGroupedCPUDeviceSlicesSplitCoreTypes(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_Hybrid_HT, func(driver *CPUDriver) {
+		tiers, err := resolveCPUTiers(driver.cpuTopology, coreTypeTierSpecs(driver.cpuTopology))
+		require.NoError(t, err)
+		driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+		driver.cpuDeviceGroupBy = GROUP_BY_SOCKET
+		driver.collapseUMADevices = false
+		driver.cpuTiers = tiers
+	})
+
+	expected := map[string]struct {
+		numCPUs  int64
+		coreType string
+	}{
+		"cpudevsocket000-p-core": {numCPUs: 2, coreType: "p-core"},
+		"cpudevsocket000-e-core": {numCPUs: 2, coreType: "e-core"},
+	}
+	var devices []resourceapi.Device
+	for _, chunk := range driver.createGroupedCPUDeviceSlices(testr.New(t)) {
+		devices = append(devices, chunk...)
+	}
+	require.Len(t, devices, len(expected))
+	for _, device := range devices {
+		want, ok := expected[device.Name]
+		require.True(t, ok, "unexpected device %s", device.Name)
+		require.Equal(t, want.numCPUs, capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+		require.Equal(t, want.coreType, *device.Attributes[AttributeCoreType].StringValue, "device %s", device.Name)
+	}
+
+	// the claims of the efficiency cores get the efficiency cores only.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-e-core", testDriverName, testNodeName, map[string]int64{"cpudevsocket000-e-core": 2}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-e-core"].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-e-core")
+	require.Equal(t, cpuset.New(1, 3), gotCPUs)
+}
+
+func TestCoreTypeTierSpecs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cpuInfos []cpuinfo.CPUInfo
+		expected map[string]string
+	}{
+		{
+			name:     "hybrid",
+			cpuInfos: mockCPUInfos_SingleSocket_Hybrid_HT,
+			expected: map[string]string{"p-core": "p-core", "e-core": "e-core"},
+		},
+		{
+			name:     "single core type",
+			cpuInfos: mockCPUInfos_SingleSocket_4CPUS_HT,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: tc.cpuInfos}
+			topo, err := mockProvider.GetCPUTopology(testr.New(t))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, coreTypeTierSpecs(topo))
+		})
+	}
+}
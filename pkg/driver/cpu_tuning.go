@@ -0,0 +1,447 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+// cpuTuningsCheckpointFile is the file, in the plugin data directory, checkpointing the CPU tunings of the claims.
+const cpuTuningsCheckpointFile = "cpu-tunings.json"
+
+// cpuTuning are the kernel tunings of the CPUs of a claim while it is prepared.
+type cpuTuning struct {
+	// governor is the cpufreq governor of the CPUs, empty to keep theirs.
+	governor string
+	// maxCState is the deepest cpuidle state the CPUs may enter, the deeper ones are disabled. Nil keeps them all.
+	maxCState *int
+	// excludeInterrupts steers the interrupts away from the CPUs.
+	excludeInterrupts bool
+	// disableTimerMigration sets kernel.timer_migration to 0, so the timers stay on the CPUs they are armed on.
+	disableTimerMigration bool
+}
+
+// claimTuning returns the tunings of the CPUs of a claim, from its profile and its CPUProfile, whose settings
+// take precedence. Returns nil if the claim tunes nothing.
+func (cp *CPUDriver) claimTuning(claim *resourceapi.ResourceClaim) (*cpuTuning, error) {
+	lowLatency, err := cp.claimUsesLowLatencyProfile(claim)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := cp.claimCPUProfile(claim)
+	if err != nil {
+		return nil, err
+	}
+	var tuning cpuTuning
+	if lowLatency {
+		tuning = lowLatencyTuning
+	}
+	if profile != nil {
+		profile.applyTo(&tuning)
+	}
+	if tuning == (cpuTuning{}) {
+		return nil, nil
+	}
+	return &tuning, nil
+}
+
+// revertClaimTuning reverts the tunings of the CPUs of a claim, if any. The claim is released anyway, so a
+// failure is only logged: a retry would find nothing to revert.
+func (cp *CPUDriver) revertClaimTuning(logger logr.Logger, claimUID types.UID) {
+	if cp.tuner == nil {
+		return
+	}
+	if err := cp.tuner.revert(logger, claimUID); err != nil {
+		logger.Error(err, "failed to revert the CPU tunings")
+	}
+}
+
+// cpuTuner applies the kernel tunings of the claims to their CPUs, and reverts them when the claims are
+// unprepared. If a path is set, the tuned claims and the previous values of the tunables are checkpointed
+// there before the tunables are changed, so the claims unprepared after a restart of the driver get their
+// CPUs restored too.
+//
+// The scheduler load balancing has no runtime switch outside of the cpuset partitions, which the cgroups of the
+// kubelet are not: the exclusive CPUs already run the tasks of their claim only, so the balancer finds nothing
+// to move there.
+type cpuTuner struct {
+	// sysfsRoot and procfsRoot are where the host sysfs and procfs are mounted.
+	sysfsRoot  string
+	procfsRoot string
+	// onlineCPUs are the CPUs the interrupts are steered to, without the CPUs of the claims excluding them.
+	onlineCPUs cpuset.CPUSet
+	// path is the checkpoint file, empty to keep the tunings in memory only.
+	path string
+
+	lock sync.Mutex
+	// claims are the tuned claims.
+	claims map[types.UID]tunedClaim
+	// previous are the previous values of the per-CPU tunables set for the claims, by path.
+	previous map[string]string
+	// timerMigration is the previous kernel.timer_migration, empty if it's not overridden.
+	timerMigration string
+}
+
+// tunedClaim is a claim whose CPUs are tuned.
+type tunedClaim struct {
+	cpus   cpuset.CPUSet
+	tuning cpuTuning
+	// paths are the per-CPU tunables set for the claim.
+	paths []string
+}
+
+// cpuTunerCheckpoint is the serialized form of the state of a cpuTuner.
+type cpuTunerCheckpoint struct {
+	Claims         map[types.UID]tunedClaimCheckpoint `json:"claims"`
+	Previous       map[string]string                  `json:"previous"`
+	TimerMigration string                             `json:"timerMigration,omitempty"`
+}
+
+// tunedClaimCheckpoint is the serialized form of a tunedClaim.
+type tunedClaimCheckpoint struct {
+	CPUs                  string   `json:"cpus"`
+	Governor              string   `json:"governor,omitempty"`
+	MaxCState             *int     `json:"maxCState,omitempty"`
+	ExcludeInterrupts     bool     `json:"excludeInterrupts,omitempty"`
+	DisableTimerMigration bool     `json:"disableTimerMigration,omitempty"`
+	Paths                 []string `json:"paths,omitempty"`
+}
+
+// newCPUTuner creates a new cpuTuner, keeping the tunings in memory only.
+func newCPUTuner(sysfsRoot, procfsRoot string, onlineCPUs cpuset.CPUSet) *cpuTuner {
+	return &cpuTuner{
+		sysfsRoot:  sysfsRoot,
+		procfsRoot: procfsRoot,
+		onlineCPUs: onlineCPUs,
+		claims:     make(map[types.UID]tunedClaim),
+		previous:   make(map[string]string),
+	}
+}
+
+// newCPUTunerCheckpoint creates a new cpuTuner checkpointed at the path, restoring the tuned claims from there
+// if it exists. Like the pod claims, an unreadable checkpoint is fatal: the CPUs of the claims tuned before the
+// restart would never be restored.
+func newCPUTunerCheckpoint(sysfsRoot, procfsRoot string, onlineCPUs cpuset.CPUSet, path string) (*cpuTuner, error) {
+	t := newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+	t.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the CPU tunings checkpoint: %w", err)
+	}
+	var checkpoint cpuTunerCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("cannot parse the CPU tunings checkpoint: %w", err)
+	}
+	for claimUID, entry := range checkpoint.Claims {
+		cpus, err := cpuset.Parse(entry.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse the CPUs of claim %s in the CPU tunings checkpoint: %w", claimUID, err)
+		}
+		t.claims[claimUID] = tunedClaim{
+			cpus: cpus,
+			tuning: cpuTuning{
+				governor:              entry.Governor,
+				maxCState:             entry.MaxCState,
+				excludeInterrupts:     entry.ExcludeInterrupts,
+				disableTimerMigration: entry.DisableTimerMigration,
+			},
+			paths: entry.Paths,
+		}
+	}
+	for path, value := range checkpoint.Previous {
+		t.previous[path] = value
+	}
+	t.timerMigration = checkpoint.TimerMigration
+	return t, nil
+}
+
+// apply tunes the CPUs of a claim. On failure, the tunings of the claim are reverted.
+func (t *cpuTuner) apply(logger logr.Logger, claimUID types.UID, cpus cpuset.CPUSet, tuning cpuTuning) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.claims[claimUID]; ok {
+		return nil
+	}
+
+	claim := tunedClaim{cpus: cpus, tuning: tuning}
+	var errs []error
+	values := make(map[string]string)
+	for _, cpu := range cpus.List() {
+		if tuning.governor != "" {
+			values[filepath.Join(t.cpuPath(cpu), "cpufreq", "scaling_governor")] = tuning.governor
+		}
+		if tuning.maxCState != nil {
+			states, err := t.deeperIdleStates(cpu, *tuning.maxCState)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			for _, state := range states {
+				values[filepath.Join(state, "disable")] = "1"
+			}
+		}
+	}
+
+	// the previous values are checkpointed before any tunable is overridden, so they can be restored
+	// after a restart too.
+	for _, path := range slices.Sorted(maps.Keys(values)) {
+		previous, err := readTunable(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// the CPU has no such tunable, e.g. no cpufreq.
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.previous[path] = previous
+		claim.paths = append(claim.paths, path)
+	}
+	disableTimerMigration := tuning.disableTimerMigration && !t.timerMigrationDisabled()
+	if disableTimerMigration {
+		previous, err := readTunable(t.timerMigrationPath())
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			t.timerMigration = previous
+		}
+	}
+	t.claims[claimUID] = claim
+	if len(errs) == 0 {
+		errs = append(errs, t.persist())
+	}
+
+	if err := errors.Join(errs...); err == nil {
+		for _, path := range claim.paths {
+			errs = append(errs, writeTunable(path, values[path]))
+		}
+		if disableTimerMigration {
+			errs = append(errs, writeTunable(t.timerMigrationPath(), "0"))
+		}
+		if tuning.excludeInterrupts {
+			errs = append(errs, t.steerInterrupts(logger))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		if revertErr := t.revertLocked(logger, claimUID); revertErr != nil {
+			logger.Error(revertErr, "failed to revert the CPU tunings", "claimUID", claimUID)
+		}
+		return fmt.Errorf("failed to tune the CPUs of the claim: %w", err)
+	}
+	logger.V(2).Info("applied the CPU tunings", "claimUID", claimUID, "cpus", cpus.String())
+	return nil
+}
+
+// revert restores the tunings of the CPUs of a claim. Unknown claims are ignored.
+func (t *cpuTuner) revert(logger logr.Logger, claimUID types.UID) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.revertLocked(logger, claimUID)
+}
+
+func (t *cpuTuner) revertLocked(logger logr.Logger, claimUID types.UID) error {
+	claim, ok := t.claims[claimUID]
+	if !ok {
+		return nil
+	}
+	delete(t.claims, claimUID)
+
+	var errs []error
+	for _, path := range claim.paths {
+		if err := writeTunable(path, t.previous[path]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(t.previous, path)
+	}
+	if claim.tuning.disableTimerMigration && !t.timerMigrationDisabled() && t.timerMigration != "" {
+		if err := writeTunable(t.timerMigrationPath(), t.timerMigration); err != nil {
+			errs = append(errs, err)
+		} else {
+			t.timerMigration = ""
+		}
+	}
+	if claim.tuning.excludeInterrupts {
+		errs = append(errs, t.steerInterrupts(logger))
+	}
+	// the values failing to be restored stay in the checkpoint, for the record.
+	errs = append(errs, t.persist())
+	logger.V(2).Info("reverted the CPU tunings", "claimUID", claimUID, "cpus", claim.cpus.String())
+	return errors.Join(errs...)
+}
+
+// timerMigrationDisabled returns true if a tuned claim disables the timer migration.
+func (t *cpuTuner) timerMigrationDisabled() bool {
+	for _, claim := range t.claims {
+		if claim.tuning.disableTimerMigration {
+			return true
+		}
+	}
+	return false
+}
+
+// deeperIdleStates returns the cpuidle states of a CPU deeper than the given one. The CPUs without cpuidle
+// have none.
+func (t *cpuTuner) deeperIdleStates(cpu, maxCState int) ([]string, error) {
+	dir := filepath.Join(t.cpuPath(cpu), "cpuidle")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var states []string
+	for _, entry := range entries {
+		index, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "state"))
+		if err != nil || !strings.HasPrefix(entry.Name(), "state") || index <= maxCState {
+			continue
+		}
+		states = append(states, filepath.Join(dir, entry.Name()))
+	}
+	return states, nil
+}
+
+// steerInterrupts sets the affinity of the interrupts, and the default one of the new interrupts, to the online
+// CPUs not allocated to the claims excluding them. The interrupts the kernel doesn't let move, e.g. the per-CPU
+// and the managed ones, are skipped.
+func (t *cpuTuner) steerInterrupts(logger logr.Logger) error {
+	housekeeping := t.onlineCPUs
+	for _, claim := range t.claims {
+		if claim.tuning.excludeInterrupts {
+			housekeeping = housekeeping.Difference(claim.cpus)
+		}
+	}
+	if housekeeping.IsEmpty() {
+		return fmt.Errorf("no CPU left for the interrupts outside of the claims excluding them")
+	}
+	irqDir := filepath.Join(t.procfsRoot, "irq")
+	if err := writeTunable(filepath.Join(irqDir, "default_smp_affinity"), cpuMask(housekeeping)); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(irqDir)
+	if err != nil {
+		return err
+	}
+	skipped := 0
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		if err := writeTunable(filepath.Join(irqDir, entry.Name(), "smp_affinity_list"), housekeeping.String()); err != nil {
+			skipped++
+		}
+	}
+	logger.V(4).Info("steered the interrupts", "cpus", housekeeping.String(), "skippedInterrupts", skipped)
+	return nil
+}
+
+// persist writes the checkpoint atomically.
+func (t *cpuTuner) persist() error {
+	if t.path == "" {
+		return nil
+	}
+	checkpoint := cpuTunerCheckpoint{
+		Claims:         make(map[types.UID]tunedClaimCheckpoint, len(t.claims)),
+		Previous:       t.previous,
+		TimerMigration: t.timerMigration,
+	}
+	for claimUID, claim := range t.claims {
+		checkpoint.Claims[claimUID] = tunedClaimCheckpoint{
+			CPUs:                  claim.cpus.String(),
+			Governor:              claim.tuning.governor,
+			MaxCState:             claim.tuning.maxCState,
+			ExcludeInterrupts:     claim.tuning.excludeInterrupts,
+			DisableTimerMigration: claim.tuning.disableTimerMigration,
+			Paths:                 claim.paths,
+		}
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(t.path, data); err != nil {
+		return fmt.Errorf("failed to persist the CPU tunings checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (t *cpuTuner) cpuPath(cpu int) string {
+	return filepath.Join(t.sysfsRoot, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu))
+}
+
+func (t *cpuTuner) timerMigrationPath() string {
+	return filepath.Join(t.procfsRoot, "sys", "kernel", "timer_migration")
+}
+
+// readTunable returns the value of a kernel tunable, without the trailing newline.
+func readTunable(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeTunable sets the value of an existing kernel tunable.
+func writeTunable(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	return errors.Join(err, f.Close())
+}
+
+// cpuMask formats the CPUs as a kernel CPU mask: comma-separated 32-bit hex words, the most significant first.
+func cpuMask(cpus cpuset.CPUSet) string {
+	list := cpus.List()
+	if len(list) == 0 {
+		return "0"
+	}
+	words := make([]uint32, list[len(list)-1]/32+1)
+	for _, cpu := range list {
+		words[cpu/32] |= 1 << (cpu % 32)
+	}
+	var sb strings.Builder
+	for i := len(words) - 1; i >= 0; i-- {
+		if i == len(words)-1 {
+			fmt.Fprintf(&sb, "%x", words[i])
+		} else {
+			fmt.Fprintf(&sb, ",%08x", words[i])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,196 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// newTestTunables creates the sysfs and procfs tunables of a node with the given CPUs and interrupts.
+func newTestTunables(t *testing.T, cpus cpuset.CPUSet, irqs ...int) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	sysfsRoot, procfsRoot := filepath.Join(root, "sys"), filepath.Join(root, "proc")
+	write := func(path, value string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0644))
+	}
+	for _, cpu := range cpus.List() {
+		cpuDir := filepath.Join(sysfsRoot, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu))
+		write(filepath.Join(cpuDir, "cpufreq", "scaling_governor"), "powersave")
+		for state := range 3 {
+			write(filepath.Join(cpuDir, "cpuidle", fmt.Sprintf("state%d", state), "disable"), "0")
+		}
+	}
+	write(filepath.Join(procfsRoot, "sys", "kernel", "timer_migration"), "1")
+	write(filepath.Join(procfsRoot, "irq", "default_smp_affinity"), cpuMask(cpus))
+	for _, irq := range irqs {
+		write(filepath.Join(procfsRoot, "irq", fmt.Sprint(irq), "smp_affinity_list"), cpus.String())
+	}
+	return sysfsRoot, procfsRoot
+}
+
+// readTestTunable returns a tunable created by newTestTunables.
+func readTestTunable(t *testing.T, path ...string) string {
+	t.Helper()
+	value, err := readTunable(filepath.Join(path...))
+	require.NoError(t, err)
+	return value
+}
+
+func TestCPUMask(t *testing.T) {
+	testCases := []struct {
+		cpus     cpuset.CPUSet
+		expected string
+	}{
+		{cpus: cpuset.New(), expected: "0"},
+		{cpus: cpuset.New(0), expected: "1"},
+		{cpus: cpuset.New(0, 1, 2, 3), expected: "f"},
+		{cpus: cpuset.New(4, 31), expected: "80000010"},
+		{cpus: cpuset.New(0, 33), expected: "2,00000001"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.cpus.String(), func(t *testing.T) {
+			require.Equal(t, tc.expected, cpuMask(tc.cpus))
+		})
+	}
+}
+
+func TestCPUTunerLowLatency(t *testing.T) {
+	logger := testr.New(t)
+	onlineCPUs := cpuset.New(0, 1, 2, 3)
+	sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10, 11)
+	tuner := newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+	governor := func(cpu int) string {
+		return readTestTunable(t, sysfsRoot, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu), "cpufreq", "scaling_governor")
+	}
+	timerMigration := func() string { return readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration") }
+	irqAffinity := func(irq string) string { return readTestTunable(t, procfsRoot, "irq", irq, "smp_affinity_list") }
+	defaultIRQAffinity := func() string { return readTestTunable(t, procfsRoot, "irq", "default_smp_affinity") }
+
+	require.NoError(t, tuner.apply(logger, "claim-a", cpuset.New(2, 3), lowLatencyTuning))
+	require.Equal(t, "powersave", governor(1))
+	require.Equal(t, "performance", governor(2))
+	require.Equal(t, "performance", governor(3))
+	require.Equal(t, "0", timerMigration())
+	require.Equal(t, "0-1", irqAffinity("10"))
+	require.Equal(t, "0-1", irqAffinity("11"))
+	require.Equal(t, "3", defaultIRQAffinity())
+
+	require.NoError(t, tuner.apply(logger, "claim-b", cpuset.New(1), lowLatencyTuning))
+	require.Equal(t, "performance", governor(1))
+	require.Equal(t, "0", irqAffinity("10"))
+	require.Equal(t, "1", defaultIRQAffinity())
+
+	// the timer migration stays disabled while a low-latency claim is prepared.
+	require.NoError(t, tuner.revert(logger, "claim-a"))
+	require.Equal(t, "powersave", governor(2))
+	require.Equal(t, "powersave", governor(3))
+	require.Equal(t, "0", timerMigration())
+	require.Equal(t, "0,2-3", irqAffinity("10"))
+	require.Equal(t, "d", defaultIRQAffinity())
+
+	require.NoError(t, tuner.revert(logger, "claim-b"))
+	require.Equal(t, "powersave", governor(1))
+	require.Equal(t, "1", timerMigration())
+	require.Equal(t, "0-3", irqAffinity("11"))
+	require.Equal(t, "f", defaultIRQAffinity())
+
+	// the unknown claims, e.g. prepared before a restart, are ignored.
+	require.NoError(t, tuner.revert(logger, "claim-unknown"))
+
+	// no CPU would be left for the interrupts: nothing stays tuned.
+	require.Error(t, tuner.apply(logger, "claim-all", onlineCPUs, lowLatencyTuning))
+	require.Equal(t, "powersave", governor(0))
+	require.Equal(t, "1", timerMigration())
+	require.Equal(t, "f", defaultIRQAffinity())
+}
+
+func TestCPUTunerIdleStates(t *testing.T) {
+	logger := testr.New(t)
+	onlineCPUs := cpuset.New(0, 1, 2, 3)
+	sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+	tuner := newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+	idleState := func(cpu, state int) string {
+		return readTestTunable(t, sysfsRoot, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu), "cpuidle", fmt.Sprintf("state%d", state), "disable")
+	}
+
+	require.NoError(t, tuner.apply(logger, "claim-a", cpuset.New(1), cpuTuning{maxCState: ptr.To(1)}))
+	require.Equal(t, "0", idleState(1, 0))
+	require.Equal(t, "0", idleState(1, 1))
+	require.Equal(t, "1", idleState(1, 2))
+	require.Equal(t, "0", idleState(0, 2))
+	// the claims not excluding the interrupts leave them alone.
+	require.Equal(t, "0-3", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+	require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+
+	require.NoError(t, tuner.revert(logger, "claim-a"))
+	require.Equal(t, "0", idleState(1, 2))
+}
+
+func TestCPUTunerCheckpoint(t *testing.T) {
+	logger := testr.New(t)
+	onlineCPUs := cpuset.New(0, 1, 2, 3)
+	sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+	path := filepath.Join(t.TempDir(), cpuTuningsCheckpointFile)
+	governor := func(cpu int) string {
+		return readTestTunable(t, sysfsRoot, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu), "cpufreq", "scaling_governor")
+	}
+
+	tuner, err := newCPUTunerCheckpoint(sysfsRoot, procfsRoot, onlineCPUs, path)
+	require.NoError(t, err)
+	require.NoError(t, tuner.apply(logger, "claim-a", cpuset.New(2, 3), lowLatencyTuning))
+	require.NoError(t, tuner.apply(logger, "claim-b", cpuset.New(1), lowLatencyTuning))
+	require.NoError(t, tuner.revert(logger, "claim-b"))
+	require.NoError(t, tuner.apply(logger, "claim-d", cpuset.New(0), cpuTuning{maxCState: ptr.To(0)}))
+
+	// the driver restarts: the claim tuned before is restored when it is unprepared.
+	restarted, err := newCPUTunerCheckpoint(sysfsRoot, procfsRoot, onlineCPUs, path)
+	require.NoError(t, err)
+	require.Equal(t, "performance", governor(2))
+	require.NoError(t, restarted.revert(logger, "claim-a"))
+	require.Equal(t, "powersave", governor(2))
+	require.Equal(t, "powersave", governor(3))
+	require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+	require.Equal(t, "0-3", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+	require.Equal(t, "f", readTestTunable(t, procfsRoot, "irq", "default_smp_affinity"))
+	idleState := readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu0", "cpuidle", "state1", "disable")
+	require.Equal(t, "1", idleState)
+	require.NoError(t, restarted.revert(logger, "claim-d"))
+	idleState = readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu0", "cpuidle", "state1", "disable")
+	require.Equal(t, "0", idleState)
+
+	// nothing is tuned without a checkpoint to restore it from.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0755))
+	require.Error(t, restarted.apply(logger, "claim-c", cpuset.New(1), lowLatencyTuning))
+	require.Equal(t, "powersave", governor(1))
+	require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	_, err = newCPUTunerCheckpoint(sysfsRoot, procfsRoot, onlineCPUs, path)
+	require.Error(t, err)
+}
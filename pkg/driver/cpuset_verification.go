@@ -0,0 +1,160 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// cpusetVerificationFirstCheck labels the mismatches found right after the container started.
+	cpusetVerificationFirstCheck = "first_check"
+	// cpusetVerificationAfterRetry labels the mismatches still there after the update was sent again.
+	cpusetVerificationAfterRetry = "after_retry"
+)
+
+// PostStartContainer verifies, if the CPUSetVerification feature gate is enabled, that the cpuset
+// the runtime applied to the cgroup of the container is the one the driver asked for. A runtime
+// may override or ignore the adjustments: a mismatch is reported and the update is sent once more.
+func (cp *CPUDriver) PostStartContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) error {
+	if !cp.featureGates.Enabled(FEATURE_GATE_CPUSET_VERIFICATION) || cp.cgroupFS == nil {
+		return nil
+	}
+	_, logger := ctxlog.WithValues(ctx, "opID", generateShortID(opIDLen), "pod", ctxlog.KObj(pod), "podUID", pod.Uid, "container", ctr.Name, "containerID", ctr.Id)
+	if podUsesUserNamespace(pod, ctr) {
+		logger = logger.WithValues("userNamespace", true)
+	}
+	expected, ok := cp.expectedContainerCPUs(types.UID(pod.GetUid()), ctr.GetName())
+	if !ok {
+		return nil
+	}
+	cgroupsPath := ctr.GetLinux().GetCgroupsPath()
+	actual, ok := cp.verifyContainerCPUs(logger, cgroupsPath, expected, cpusetVerificationFirstCheck)
+	if ok {
+		return nil
+	}
+	claimUIDs := cp.podConfigStore.GetContainerState(types.UID(pod.GetUid()), ctr.GetName()).ResourceClaimUIDs()
+	if cp.nriPlugin == nil || !cp.nriSupervisor.Runtime().ContainerUpdates {
+		cp.reportCPUSetMismatch(claimUIDs, pod.GetName(), ctr.GetName(), actual)
+		return nil
+	}
+	update := &api.ContainerUpdate{ContainerId: ctr.GetId()}
+	update.SetLinuxCPUSetCPUs(expected.String())
+	if _, err := cp.nriPlugin.UpdateContainers([]*api.ContainerUpdate{update}); err != nil {
+		logger.Error(err, "cannot send again the cpuset of the container")
+		cp.reportCPUSetMismatch(claimUIDs, pod.GetName(), ctr.GetName(), actual)
+		return nil
+	}
+	if actual, ok := cp.verifyContainerCPUs(logger, cgroupsPath, expected, cpusetVerificationAfterRetry); !ok {
+		cp.reportCPUSetMismatch(claimUIDs, pod.GetName(), ctr.GetName(), actual)
+	}
+	return nil
+}
+
+// expectedContainerCPUs returns the CPUs the driver assigned to the container: the CPUs of its claims, with
+// the shared CPUs if they borrow the idle CPUs, or the shared CPUs. Containers the driver doesn't know are not verified.
+func (cp *CPUDriver) expectedContainerCPUs(podUID types.UID, containerName string) (cpuset.CPUSet, bool) {
+	state := cp.podConfigStore.GetContainerState(podUID, containerName)
+	if state == nil {
+		return cpuset.New(), false
+	}
+	if !state.HasExclusiveCPUAllocation() {
+		return cp.cpuAllocationStore.GetSharedCPUs(), true
+	}
+	if fractional, ok := cp.fractionalClaimsOf(state.ResourceClaimUIDs()); ok {
+		return cp.fractionalContainerCPUs(fractional.CPUs), true
+	}
+	cpus := cpuset.New()
+	for _, claimUID := range state.ResourceClaimUIDs() {
+		claimCPUs, ok := cp.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		if !ok {
+			// released meanwhile: nothing sensible to compare with.
+			return cpuset.New(), false
+		}
+		cpus = cpus.Union(claimCPUs)
+	}
+	if cp.containerBorrowsIdleCPUs(nil, state.ResourceClaimUIDs()) {
+		cpus = cpus.Union(cp.cpuAllocationStore.GetSharedCPUs())
+	}
+	return cpus, true
+}
+
+// verifyContainerCPUs compares the cpuset of the container cgroup with the expected CPUs, and reports a mismatch.
+// It returns the cpuset of the cgroup, and false on a mismatch. A cgroup which can't be read is not a mismatch:
+// the runtime may not use the cgroup layout the driver knows.
+func (cp *CPUDriver) verifyContainerCPUs(logger logr.Logger, cgroupsPath string, expected cpuset.CPUSet, check string) (cpuset.CPUSet, bool) {
+	actual, err := readCgroupCPUSet(cp.cgroupFS, cgroupsPath)
+	if err != nil {
+		logger.V(2).Info("cannot verify the cpuset of the container", "cgroupsPath", cgroupsPath, "err", err)
+		return expected, true
+	}
+	if actual.Equals(expected) {
+		return actual, true
+	}
+	cpusetVerificationMismatches.WithLabelValues(check).Inc()
+	logger.Info("the cpuset of the container does not match the assigned CPUs", "check", check, "expected", expected.String(), "actual", actual.String())
+	return actual, false
+}
+
+// readCgroupCPUSet reads the cpuset.cpus of a container cgroup, relative to the cgroup v2 root in the sysfs.
+func readCgroupCPUSet(sysfs fs.FS, cgroupsPath string) (cpuset.CPUSet, error) {
+	dir, err := cgroupDir(cgroupsPath)
+	if err != nil {
+		return cpuset.New(), err
+	}
+	data, err := fs.ReadFile(sysfs, path.Join(cgroupRoot, dir, "cpuset.cpus"))
+	if err != nil {
+		return cpuset.New(), err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(data)))
+}
+
+// cgroupDir converts the cgroups path the runtime reports into a directory relative to the cgroup root.
+// The cgroupfs driver reports the path itself, e.g. "/kubepods/burstable/pod<UID>/<ID>"; the systemd driver
+// reports "<slice>:<prefix>:<name>", e.g. "kubepods-burstable-pod<UID>.slice:cri-containerd:<ID>", whose
+// slice nests in its parent slices: "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<UID>.slice".
+func cgroupDir(cgroupsPath string) (string, error) {
+	if cgroupsPath == "" {
+		return "", fmt.Errorf("empty cgroups path")
+	}
+	if strings.HasPrefix(cgroupsPath, "/") {
+		return strings.TrimPrefix(path.Clean(cgroupsPath), "/"), nil
+	}
+	parts := strings.Split(cgroupsPath, ":")
+	if len(parts) != 3 || !strings.HasSuffix(parts[0], ".slice") {
+		return "", fmt.Errorf("unknown cgroups path format %q", cgroupsPath)
+	}
+	var dirs []string
+	if slice := strings.TrimSuffix(parts[0], ".slice"); slice != "-" {
+		names := strings.Split(slice, "-")
+		for i := range names {
+			dirs = append(dirs, strings.Join(names[:i+1], "-")+".slice")
+		}
+	}
+	dirs = append(dirs, parts[1]+"-"+parts[2]+".scope")
+	return path.Join(dirs...), nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestCgroupDir(t *testing.T) {
+	testCases := []struct {
+		cgroupsPath string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			cgroupsPath: "/kubepods/burstable/pod1234/abcd",
+			expected:    "kubepods/burstable/pod1234/abcd",
+		},
+		{
+			cgroupsPath: "kubepods-burstable-pod1234.slice:cri-containerd:abcd",
+			expected:    "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-abcd.scope",
+		},
+		{
+			cgroupsPath: "-.slice:crio:abcd",
+			expected:    "crio-abcd.scope",
+		},
+		{
+			cgroupsPath: "",
+			expectedErr: true,
+		},
+		{
+			cgroupsPath: "kubepods:abcd",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.cgroupsPath, func(t *testing.T) {
+			dir, err := cgroupDir(tc.cgroupsPath)
+			if tc.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, dir)
+		})
+	}
+}
+
+func TestPostStartContainerCPUSetVerification(t *testing.T) {
+	logger := testr.New(t)
+	gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_CPUSET_VERIFICATION): true})
+	require.NoError(t, err)
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.featureGates = gates
+		cp.podConfigStore = store.NewPodConfig()
+	})
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(1, 3))
+
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	pinned := &api.Container{Id: "pinned", Name: "pinned", Linux: &api.LinuxContainer{CgroupsPath: "/kubepods/pod-uid-1/pinned"}}
+	shared := &api.Container{Id: "shared", Name: "shared", Linux: &api.LinuxContainer{CgroupsPath: "/kubepods/pod-uid-1/shared"}}
+	driver.podConfigStore.SetContainerState(types.UID(pod.Uid), store.NewContainerState(pinned.Name, types.UID(pinned.Id), "claim-1"))
+	driver.podConfigStore.SetContainerState(types.UID(pod.Uid), store.NewContainerState(shared.Name, types.UID(shared.Id)))
+
+	driver.cgroupFS = fstest.MapFS{
+		"fs/cgroup/kubepods/pod-uid-1/pinned/cpuset.cpus": {Data: []byte("1,3\n")},
+		"fs/cgroup/kubepods/pod-uid-1/shared/cpuset.cpus": {Data: []byte("0-3\n")},
+	}
+	mismatches := testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck))
+	require.NoError(t, driver.PostStartContainer(context.Background(), pod, pinned))
+	require.NoError(t, driver.PostStartContainer(context.Background(), pod, shared))
+	// the shared container runs on the CPUs of the claim too.
+	require.Equal(t, mismatches+1, testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck)))
+
+	// the containers the driver doesn't know are not verified.
+	unknown := &api.Container{Id: "unknown", Name: "unknown", Linux: &api.LinuxContainer{CgroupsPath: "/kubepods/pod-uid-1/unknown"}}
+	require.NoError(t, driver.PostStartContainer(context.Background(), pod, unknown))
+	require.Equal(t, mismatches+1, testutil.ToFloat64(cpusetVerificationMismatches.WithLabelValues(cpusetVerificationFirstCheck)))
+}
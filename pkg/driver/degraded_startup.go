@@ -0,0 +1,200 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// NodeStatusConditionKubeletPluginRegistered is true once the kubelet registered the driver.
+	// Reported with the DegradedStartup feature gate only.
+	NodeStatusConditionKubeletPluginRegistered = "KubeletPluginRegistered"
+	// NodeStatusConditionCDIAvailable is true once the CDI manager is created, so the claims can be prepared.
+	// Reported with the DegradedStartup feature gate only.
+	NodeStatusConditionCDIAvailable = "CDIAvailable"
+)
+
+// startupRetryInterval is how often a degraded start retries the steps which failed.
+const startupRetryInterval = 10 * time.Second
+
+// errCDIUnavailable is returned while the CDI manager could not be created yet. The kubelet
+// retries the preparation of the claims, which succeeds once the CDI manager is created.
+var errCDIUnavailable = errors.New("CDI is not available yet")
+
+// startupStatus records the conditions of the startup steps retried in the background,
+// so the node status tells why a running driver is degraded.
+type startupStatus struct {
+	lock       sync.Mutex
+	conditions []metav1.Condition
+}
+
+// set records the condition of a startup step, and the degraded metric of its component.
+func (s *startupStatus) set(component, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	if s == nil {
+		return
+	}
+	degraded := 0.0
+	if status != metav1.ConditionTrue {
+		degraded = 1
+	}
+	startupDegraded.WithLabelValues(component).Set(degraded)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	meta.SetStatusCondition(&s.conditions, metav1.Condition{Type: conditionType, Status: status, Reason: reason, Message: message})
+}
+
+// list returns the conditions of the startup steps, sorted by type.
+func (s *startupStatus) list() []metav1.Condition {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	conditions := slices.Clone(s.conditions)
+	slices.SortFunc(conditions, func(a, b metav1.Condition) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+	return conditions
+}
+
+// deferredCdiManager creates the CDI manager in the background when it can't be created at startup,
+// e.g. while the CDI spec directory is not mounted yet. Until then, the claims fail to be prepared
+// with errCDIUnavailable and the kubelet retries them.
+type deferredCdiManager struct {
+	create func() (cdiManager, error)
+	status *startupStatus
+
+	lock   sync.Mutex
+	mgr    cdiManager
+	err    error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDeferredCdiManager(create func() (cdiManager, error), status *startupStatus) *deferredCdiManager {
+	return &deferredCdiManager{create: create, status: status}
+}
+
+// get returns the CDI manager, or the error of its last creation attempt.
+func (d *deferredCdiManager) get() (cdiManager, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.mgr == nil {
+		return nil, fmt.Errorf("%w: %w", errCDIUnavailable, d.err)
+	}
+	return d.mgr, nil
+}
+
+// tryCreate creates the CDI manager, unless already created.
+func (d *deferredCdiManager) tryCreate() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.mgr != nil {
+		return nil
+	}
+	mgr, err := d.create()
+	if err != nil {
+		d.err = err
+		d.status.set(COMPONENT_CDI_MANAGER, NodeStatusConditionCDIAvailable, metav1.ConditionFalse, "CreationFailed", err.Error())
+		return err
+	}
+	d.mgr, d.err = mgr, nil
+	d.status.set(COMPONENT_CDI_MANAGER, NodeStatusConditionCDIAvailable, metav1.ConditionTrue, "Created", "the CDI manager is created")
+	return nil
+}
+
+// AddDevice implements cdiManager.
+func (d *deferredCdiManager) AddDevice(logger logr.Logger, deviceName string, envVar string, opts ...cdiDeviceOption) error {
+	mgr, err := d.get()
+	if err != nil {
+		return err
+	}
+	return mgr.AddDevice(logger, deviceName, envVar, opts...)
+}
+
+// RemoveDevice implements cdiManager.
+func (d *deferredCdiManager) RemoveDevice(logger logr.Logger, deviceName string) error {
+	mgr, err := d.get()
+	if err != nil {
+		return err
+	}
+	return mgr.RemoveDevice(logger, deviceName)
+}
+
+// Name implements Component.
+func (d *deferredCdiManager) Name() string {
+	return COMPONENT_CDI_MANAGER
+}
+
+// Start creates the CDI manager, or keeps trying in the background if it fails.
+func (d *deferredCdiManager) Start(ctx context.Context) error {
+	logger := ctxlog.FromContext(ctx)
+	err := d.tryCreate()
+	if err == nil {
+		return nil
+	}
+	logger.Error(err, "failed to create the CDI manager, retrying in the background", "retryInterval", startupRetryInterval)
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(startupRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := d.tryCreate(); err != nil {
+				logger.V(2).Info("failed to create the CDI manager", "err", err)
+				continue
+			}
+			logger.Info("CDI manager created, the claims can be prepared")
+			return
+		}
+	}()
+	return nil
+}
+
+// Stop implements Component.
+func (d *deferredCdiManager) Stop(ctx context.Context) {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+}
+
+// Healthy implements Component.
+func (d *deferredCdiManager) Healthy() error {
+	_, err := d.get()
+	return err
+}
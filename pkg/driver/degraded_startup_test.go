@@ -0,0 +1,75 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeferredCdiManager(t *testing.T) {
+	logger := testr.New(t)
+	status := &startupStatus{}
+	mockMgr := newMockCdiMgr()
+	createErr := errors.New("no CDI spec directory")
+	mgr := newDeferredCdiManager(func() (cdiManager, error) {
+		if createErr != nil {
+			return nil, createErr
+		}
+		return mockMgr, nil
+	}, status)
+
+	// the start completes without the CDI manager, whose creation is retried in the background.
+	require.NoError(t, mgr.Start(context.Background()))
+	defer mgr.Stop(context.Background())
+	require.ErrorIs(t, mgr.Healthy(), errCDIUnavailable)
+	err := mgr.AddDevice(logger, "claim-1", "DRA_CPUS_claim-1=1")
+	require.ErrorIs(t, err, errCDIUnavailable)
+	require.ErrorContains(t, err, "no CDI spec directory")
+	require.ErrorIs(t, mgr.RemoveDevice(logger, "claim-1"), errCDIUnavailable)
+	require.True(t, meta.IsStatusConditionFalse(status.list(), NodeStatusConditionCDIAvailable))
+
+	createErr = nil
+	require.NoError(t, mgr.tryCreate())
+	require.NoError(t, mgr.Healthy())
+	require.NoError(t, mgr.AddDevice(logger, "claim-1", "DRA_CPUS_claim-1=1"))
+	require.Equal(t, "DRA_CPUS_claim-1=1", mockMgr.devices["claim-1"])
+	require.True(t, meta.IsStatusConditionTrue(status.list(), NodeStatusConditionCDIAvailable))
+}
+
+func TestStartupStatus(t *testing.T) {
+	var disabled *startupStatus
+	disabled.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionFalse, "NotRegistered", "")
+	require.Empty(t, disabled.list())
+
+	status := &startupStatus{}
+	status.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionFalse, "NotRegistered", "")
+	status.set(COMPONENT_CDI_MANAGER, NodeStatusConditionCDIAvailable, metav1.ConditionTrue, "Created", "")
+	status.set(COMPONENT_KUBELET_PLUGIN, NodeStatusConditionKubeletPluginRegistered, metav1.ConditionTrue, "Registered", "")
+
+	conditions := status.list()
+	require.Len(t, conditions, 2)
+	require.Equal(t, NodeStatusConditionCDIAvailable, conditions[0].Type)
+	require.Equal(t, NodeStatusConditionKubeletPluginRegistered, conditions[1].Type)
+	require.Equal(t, metav1.ConditionTrue, conditions[1].Status)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+)
+
+// DeviceConfig is the opaque device configuration the driver accepts in the claims. The versioned
+// CPUClaimParameters is decoded into it too.
+type DeviceConfig struct {
+	// AllCPUs requests all the allocatable CPUs of the allocated grouped device.
+	AllCPUs bool `json:"allCPUs,omitempty"`
+	// BorrowIdleCPUs lets the containers consuming the claim run also on the idle CPUs, the shared CPUs no
+	// exclusive claim is allocated, until an exclusive claim needs them. Applies to the whole claim.
+	BorrowIdleCPUs bool `json:"borrowIdleCPUs,omitempty"`
+	// DisableCPUQuota removes the CPU quota of the containers consuming the claim, so the
+	// containers pinned to exclusive CPUs are never throttled. Applies to the whole claim.
+	DisableCPUQuota bool `json:"disableCPUQuota,omitempty"`
+	// DisableNUMABalancing confines the memory of the containers consuming the claim to the NUMA nodes
+	// of their CPUs, so the automatic NUMA balancing has no remote node to migrate their pages to.
+	// Applies to the whole claim.
+	DisableNUMABalancing bool `json:"disableNUMABalancing,omitempty"`
+	// SystemCPUs requests this number of the reserved CPUs of the allocated grouped device, for the
+	// privileged system workloads. The request must not consume CPU capacity, so the capacity of the
+	// device is unaffected, and the namespace of the claim must be allowed by --system-claim-namespaces.
+	SystemCPUs int `json:"systemCPUs,omitempty"`
+	// PodLevelPinning pins all the containers of the pods the claim is reserved for to the CPUs of the claim,
+	// and not only the containers consuming it: the pod as a whole is confined to the CPUs, and its containers
+	// share them. Applies to the whole claim.
+	PodLevelPinning bool `json:"podLevelPinning,omitempty"`
+	// StrictEnforcement fails the preparation of the claim, until the kubelet retries it, while the NRI plugin
+	// is not connected to the runtime or the runtime doesn't apply the container updates, as --strict-enforcement
+	// does for all the claims. Applies to the whole claim.
+	StrictEnforcement bool `json:"strictEnforcement,omitempty"`
+	// FullPCPUsOnly allocates whole physical cores only to the claim when SMT is enabled, as --full-pcpus-only
+	// does for all the claims: the claim never shares a core with another workload. Applies to the whole claim.
+	FullPCPUsOnly bool `json:"fullPCPUsOnly,omitempty"`
+	// RequireFullCores rounds the CPUs of the claim up to whole physical cores when SMT is enabled, whatever
+	// --full-pcpus-only and --smt-isolation: the siblings of its CPUs are allocated to the claim too, instead of
+	// failing the preparation as FullPCPUsOnly does, which it takes precedence over. Applies to the whole claim.
+	RequireFullCores bool `json:"requireFullCores,omitempty"`
+	// AllocationStrategy overrides --allocation-policy and --cpu-sorting-strategy for the request:
+	// ALLOCATION_STRATEGY_PACKED, ALLOCATION_STRATEGY_SPREAD or ALLOCATION_STRATEGY_DISTRIBUTED.
+	AllocationStrategy string `json:"allocationStrategy,omitempty"`
+	// L3AntiAffinity allocates the claim CPUs from the uncore (L3) caches without CPUs of other claims, when
+	// enough of them are free, so the claim doesn't share its last level cache. Applies to the whole claim.
+	L3AntiAffinity bool `json:"l3AntiAffinity,omitempty"`
+	// PreferredNUMANode allocates the CPUs of the request from this NUMA node when the allocated device spans
+	// more than one and the node has enough available CPUs, else from any NUMA node of the device.
+	PreferredNUMANode *int `json:"preferredNUMANode,omitempty"`
+	// RequiredNUMANode allocates the CPUs of the request from this NUMA node only: the preparation of the
+	// claim fails if the node hasn't enough available CPUs in the allocated device.
+	RequiredNUMANode *int `json:"requiredNUMANode,omitempty"`
+	// CoreType allocates the CPUs of the request from the cores of this type on the hybrid parts, even when the
+	// allocated device has both: CORE_TYPE_PERFORMANCE, CORE_TYPE_EFFICIENCY or CORE_TYPE_ANY, the default.
+	// The preparation of the claim fails if the device hasn't enough available CPUs of the type.
+	CoreType string `json:"coreType,omitempty"`
+	// Profile applies a bundle of node tunings to the CPUs of the claim while it is prepared: PROFILE_LOW_LATENCY.
+	// Requires the LowLatencyProfile feature gate. Applies to the whole claim.
+	Profile string `json:"profile,omitempty"`
+	// CPUProfile is the name of the CPUProfile whose tunings and SMT policy apply to the claim, as defined by
+	// the cluster admins. Its settings take precedence over the ones of Profile. Requires the CPUProfiles
+	// feature gate. Applies to the whole claim.
+	CPUProfile string `json:"cpuProfile,omitempty"`
+}
+
+// deviceConfigForRequest returns the opaque configuration of the driver which applies to the given request.
+// Configurations are applied in order, so the later ones override the earlier ones.
+func (cp *CPUDriver) deviceConfigForRequest(claim *resourceapi.ResourceClaim, request string) (DeviceConfig, error) {
+	var config DeviceConfig
+	for _, cfg := range claim.Status.Allocation.Devices.Config {
+		if cfg.Opaque == nil || cfg.Opaque.Driver != cp.driverName {
+			continue
+		}
+		if !configAppliesToRequest(cfg.Requests, request) {
+			continue
+		}
+		if err := decodeDeviceConfig(cfg.Opaque.Parameters.Raw, &config); err != nil {
+			return DeviceConfig{}, fmt.Errorf("invalid device configuration for request %q: %w", request, err)
+		}
+	}
+	return config, nil
+}
+
+// configAppliesToRequest returns true if a configuration listing the given requests, all of them if none, applies
+// to the request of an allocation result. The results of the prioritized lists (firstAvailable) name the subrequest
+// picked as "<request>/<subrequest>": the configurations naming the main request apply to all its subrequests, the
+// ones naming a subrequest only to that one.
+func configAppliesToRequest(requests []string, request string) bool {
+	if len(requests) == 0 {
+		return true
+	}
+	mainRequest, _, _ := strings.Cut(request, "/")
+	return slices.ContainsFunc(requests, func(name string) bool { return name == request || name == mainRequest })
+}
+
+// ValidateDeviceConfig decodes the opaque parameters of the driver applying to a request, and returns an error if
+// they are invalid on any node, e.g. to reject the claims at admission. The settings depending on the node, like
+// the NUMA node IDs or the namespaces allowed the system CPUs, are checked when the claim is prepared.
+func ValidateDeviceConfig(request string, parameters []byte) (DeviceConfig, error) {
+	var config DeviceConfig
+	if err := decodeDeviceConfig(parameters, &config); err != nil {
+		return DeviceConfig{}, fmt.Errorf("invalid device configuration for request %q: %w", request, err)
+	}
+	err := errors.Join(
+		validateAllocationStrategyConfig(request, config),
+		validateNUMANodeConfig(request, config),
+		validateProfileConfig(request, config),
+	)
+	return config, err
+}
+
+// claimDeviceConfigEnables returns true if the opaque configuration of any request of the claim allocated
+// by the driver enables the given setting.
+func (cp *CPUDriver) claimDeviceConfigEnables(claim *resourceapi.ResourceClaim, enabled func(DeviceConfig) bool) (bool, error) {
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		deviceConfig, err := cp.deviceConfigForRequest(claim, alloc.Request)
+		if err != nil {
+			return false, err
+		}
+		if enabled(deviceConfig) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// takeWholeDevice assigns all the allocatable CPUs of a device at once: either all of them
+// are available, or the claim fails. The consumed capacity, if any, must be the full capacity
+// of the device, so the scheduler also regards the device as fully consumed.
+func takeWholeDevice(deviceName string, allocatableCPUs, availableCPUs cpuset.CPUSet, claimCPUCount int64) (cpuset.CPUSet, error) {
+	if claimCPUCount != 0 && claimCPUCount != int64(allocatableCPUs.Size()) {
+		return cpuset.New(), fmt.Errorf("all CPUs of device %s requested, but the consumed capacity is %d instead of %d", deviceName, claimCPUCount, allocatableCPUs.Size())
+	}
+	if !availableCPUs.Equals(allocatableCPUs) {
+		return cpuset.New(), fmt.Errorf("all CPUs of device %s requested, but CPUs %s are already in use", deviceName, allocatableCPUs.Difference(availableCPUs).String())
+	}
+	return allocatableCPUs, nil
+}
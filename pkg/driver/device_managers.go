@@ -0,0 +1,107 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+// deviceManager exposes CPUs of the node as the devices of a device mode, and assigns CPUs to the claims
+// allocated its devices.
+type deviceManager interface {
+	// createDeviceChunks returns the devices to publish, in chunks fitting a ResourceSlice.
+	createDeviceChunks(logger logr.Logger) []deviceChunk
+	// prepareResourceClaim assigns CPUs to a claim allocated devices of the mode.
+	prepareResourceClaim(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, traceID string) kubeletplugin.PrepareResult
+}
+
+// deviceManagers is the registry of the device managers, by device mode. The mixed mode is not a manager
+// of its own: it uses both the grouped and the individual managers.
+var deviceManagers = device.NewRegistry[func(cp *CPUDriver) deviceManager]()
+
+func init() {
+	deviceManagers.Register(CPU_DEVICE_MODE_GROUPED, func(cp *CPUDriver) deviceManager { return groupedDeviceManager{cp: cp} })
+	deviceManagers.Register(CPU_DEVICE_MODE_INDIVIDUAL, func(cp *CPUDriver) deviceManager { return individualDeviceManager{cp: cp} })
+}
+
+// DeviceModes returns the device modes the driver can be configured with.
+func DeviceModes() []string {
+	return append(deviceManagers.Modes(), CPU_DEVICE_MODE_MIXED)
+}
+
+// groupedDeviceManager exposes the groups of CPUs of --group-by, the CPU tiers and the CPU pools as devices.
+type groupedDeviceManager struct {
+	cp *CPUDriver
+}
+
+func (m groupedDeviceManager) createDeviceChunks(logger logr.Logger) []deviceChunk {
+	return m.cp.createGroupedCPUDeviceChunks(logger)
+}
+
+func (m groupedDeviceManager) prepareResourceClaim(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, traceID string) kubeletplugin.PrepareResult {
+	return m.cp.prepareGroupedResourceClaim(ctx, logger, claim, traceID)
+}
+
+// individualDeviceManager exposes each CPU as a device.
+type individualDeviceManager struct {
+	cp *CPUDriver
+}
+
+func (m individualDeviceManager) createDeviceChunks(_ logr.Logger) []deviceChunk {
+	return m.cp.createCPUDeviceChunks()
+}
+
+func (m individualDeviceManager) prepareResourceClaim(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, traceID string) kubeletplugin.PrepareResult {
+	return m.cp.prepareResourceClaim(ctx, logger, claim, traceID)
+}
+
+// deviceModesInUse returns the modes of the devices the CPUs are exposed with, grouped first.
+func (cp *CPUDriver) deviceModesInUse() []string {
+	var modes []string
+	if cp.usesGroupedDevices() {
+		modes = append(modes, CPU_DEVICE_MODE_GROUPED)
+	}
+	if cp.usesIndividualDevices() {
+		modes = append(modes, CPU_DEVICE_MODE_INDIVIDUAL)
+	}
+	return modes
+}
+
+// deviceManager returns the device manager of a mode, built from the registry.
+func (cp *CPUDriver) deviceManager(mode string) (deviceManager, error) {
+	factory, err := deviceManagers.Get(mode)
+	if err != nil {
+		return nil, err
+	}
+	return factory(cp), nil
+}
+
+// validateDeviceManagers checks every device mode in use has a device manager, so a mode without one
+// fails the startup rather than the publication and the preparation of the claims.
+func (cp *CPUDriver) validateDeviceManagers() error {
+	for _, mode := range cp.deviceModesInUse() {
+		if _, err := deviceManagers.Get(mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
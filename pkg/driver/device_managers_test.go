@@ -0,0 +1,80 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceModes(t *testing.T) {
+	require.ElementsMatch(t, []string{CPU_DEVICE_MODE_GROUPED, CPU_DEVICE_MODE_INDIVIDUAL, CPU_DEVICE_MODE_MIXED}, DeviceModes())
+}
+
+func TestDeviceManagers(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mode          string
+		socketModes   map[int]string
+		expectedModes []string
+	}{
+		{
+			name:          "grouped",
+			mode:          CPU_DEVICE_MODE_GROUPED,
+			expectedModes: []string{CPU_DEVICE_MODE_GROUPED},
+		},
+		{
+			name:          "individual",
+			mode:          CPU_DEVICE_MODE_INDIVIDUAL,
+			expectedModes: []string{CPU_DEVICE_MODE_INDIVIDUAL},
+		},
+		{
+			name:          "mixed",
+			mode:          CPU_DEVICE_MODE_MIXED,
+			expectedModes: []string{CPU_DEVICE_MODE_GROUPED, CPU_DEVICE_MODE_INDIVIDUAL},
+		},
+		{
+			name:          "grouped with an individual socket",
+			mode:          CPU_DEVICE_MODE_GROUPED,
+			socketModes:   map[int]string{0: CPU_DEVICE_MODE_INDIVIDUAL},
+			expectedModes: []string{CPU_DEVICE_MODE_GROUPED, CPU_DEVICE_MODE_INDIVIDUAL},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cp := &CPUDriver{cpuDeviceMode: tc.mode, socketDeviceModes: tc.socketModes}
+			require.Equal(t, tc.expectedModes, cp.deviceModesInUse())
+			require.NoError(t, cp.validateDeviceManagers())
+			for _, mode := range tc.expectedModes {
+				manager, err := cp.deviceManager(mode)
+				require.NoError(t, err)
+				require.NotNil(t, manager)
+			}
+		})
+	}
+
+	cp := &CPUDriver{cpuDeviceMode: CPU_DEVICE_MODE_GROUPED}
+	manager, err := cp.deviceManager(CPU_DEVICE_MODE_GROUPED)
+	require.NoError(t, err)
+	require.IsType(t, groupedDeviceManager{}, manager)
+	manager, err = cp.deviceManager(CPU_DEVICE_MODE_INDIVIDUAL)
+	require.NoError(t, err)
+	require.IsType(t, individualDeviceManager{}, manager)
+	_, err = cp.deviceManager(CPU_DEVICE_MODE_MIXED)
+	require.Error(t, err)
+}
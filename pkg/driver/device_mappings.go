@@ -0,0 +1,151 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// deviceMappingMismatch describes a published device which doesn't resolve to the same CPUs anymore.
+type deviceMappingMismatch struct {
+	device string
+	reason string
+}
+
+// verifyPublishedDeviceMappings compares the device lookup maps, derived from the topology, with the
+// devices of the ResourceSlices found for the node, which were published by the previous driver instance
+// when the driver restarts. The claims allocated before the restart reference the published devices:
+// a mismatch means the topology or the configuration changed, and these claims may get other CPUs
+// than the ones the scheduler picked. Must be called before the ResourceSlices are published again.
+func (cp *CPUDriver) verifyPublishedDeviceMappings(ctx context.Context) ([]deviceMappingMismatch, error) {
+	logger := ctxlog.FromContext(ctx)
+	resourceSlices, err := cp.listResourceSlices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []deviceMappingMismatch
+	verified := 0
+	for _, slice := range resourceSlices {
+		for _, device := range slice.Spec.Devices {
+			if reason := cp.verifyDeviceMapping(device); reason != "" {
+				mismatches = append(mismatches, deviceMappingMismatch{device: device.Name, reason: reason})
+				logger.Error(nil, "published device does not match the current device mapping, the claims allocated with it may get different CPUs",
+					"resourceSlice", slice.Name, "device", device.Name, "reason", reason)
+				continue
+			}
+			verified++
+		}
+	}
+	deviceMappingMismatches.Set(float64(len(mismatches)))
+	logger.V(2).Info("verified the device mapping against the published ResourceSlices", "resourceSlices", len(resourceSlices), "verifiedDevices", verified, "mismatches", len(mismatches))
+	return mismatches, nil
+}
+
+// verifyDeviceMapping returns why the published device doesn't match the device lookup maps, or empty if it does.
+func (cp *CPUDriver) verifyDeviceMapping(device resourceapi.Device) string {
+	if cpuID, ok := cp.deviceNameToCPUID[device.Name]; ok {
+		return verifyIntAttribute(device, AttributeCPUID, cpuID)
+	}
+	if device.Name == cpuDeviceNodeName && cp.collapsibleUMATopology() {
+		// the node device has the socket attribute only, whatever the group-by mode.
+		return verifyIntAttribute(device, AttributeSocketID, cp.cpuTopology.CPUDetails.Sockets().List()[0])
+	}
+	if socketID, ok := cp.deviceNameToSocketID[device.Name]; ok {
+		return verifyIntAttribute(device, AttributeSocketID, socketID)
+	}
+	if numaNodeID, ok := cp.deviceNameToNUMANodeID[device.Name]; ok {
+		return verifyIntAttribute(device, AttributeNUMANodeID, numaNodeID)
+	}
+	if die, ok := cp.deviceNameToDie[device.Name]; ok {
+		if reason := verifyIntAttribute(device, AttributeSocketID, die.socketID); reason != "" {
+			return reason
+		}
+		return verifyIntAttribute(device, AttributeDieID, die.dieID)
+	}
+	if cluster, ok := cp.deviceNameToCluster[device.Name]; ok {
+		if reason := verifyIntAttribute(device, AttributeSocketID, cluster.socketID); reason != "" {
+			return reason
+		}
+		return verifyIntAttribute(device, AttributeClusterID, cluster.clusterID)
+	}
+	if uncoreCacheID, ok := cp.deviceNameToUncoreCache[device.Name]; ok {
+		return verifyIntAttribute(device, AttributeCacheL3ID, uncoreCacheID)
+	}
+	if ccdID, ok := cp.deviceNameToCCD[device.Name]; ok {
+		return verifyIntAttribute(device, AttributeCCDID, ccdID)
+	}
+	if core, ok := cp.deviceNameToCore[device.Name]; ok {
+		if reason := verifyIntAttribute(device, AttributeSocketID, core.socketID); reason != "" {
+			return reason
+		}
+		return verifyIntAttribute(device, AttributeCoreID, core.coreID)
+	}
+	if device.Name == cpuDeviceSharedPool && cp.sharedPoolDevice {
+		// the shared pool device is bound to no CPU: its claims follow the shared CPUs whatever they are.
+		return verifyBoolAttribute(device, AttributeSharedPool, true)
+	}
+	if pool, ok := cp.deviceNameToCPUPool[device.Name]; ok {
+		if reason := verifyStringAttribute(device, AttributeCPUPool, pool); reason != "" {
+			return reason
+		}
+		cpus := cp.cpuPools[pool]
+		if _, ok := device.Attributes[AttributeCPUs]; ok {
+			return verifyStringAttribute(device, AttributeCPUs, cpus.String())
+		}
+		// the list of the CPUs is not published when too long: the pool must have kept its size at least.
+		return verifyIntAttribute(device, AttributeNumCPUs, cpus.Size())
+	}
+	return "the device does not exist anymore"
+}
+
+func verifyStringAttribute(device resourceapi.Device, name resourceapi.QualifiedName, expected string) string {
+	attr, ok := device.Attributes[name]
+	if !ok || attr.StringValue == nil {
+		return fmt.Sprintf("attribute %s is missing", name)
+	}
+	if *attr.StringValue != expected {
+		return fmt.Sprintf("attribute %s is %q, expected %q", name, *attr.StringValue, expected)
+	}
+	return ""
+}
+
+func verifyBoolAttribute(device resourceapi.Device, name resourceapi.QualifiedName, expected bool) string {
+	attr, ok := device.Attributes[name]
+	if !ok || attr.BoolValue == nil {
+		return fmt.Sprintf("attribute %s is missing", name)
+	}
+	if *attr.BoolValue != expected {
+		return fmt.Sprintf("attribute %s is %t, expected %t", name, *attr.BoolValue, expected)
+	}
+	return ""
+}
+
+func verifyIntAttribute(device resourceapi.Device, name resourceapi.QualifiedName, expected int) string {
+	attr, ok := device.Attributes[name]
+	if !ok || attr.IntValue == nil {
+		return fmt.Sprintf("attribute %s is missing", name)
+	}
+	if *attr.IntValue != int64(expected) {
+		return fmt.Sprintf("attribute %s is %d, expected %d", name, *attr.IntValue, expected)
+	}
+	return ""
+}
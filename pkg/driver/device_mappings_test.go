@@ -0,0 +1,254 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+func TestCPUDeviceInfosDeterministic(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+	cp := &CPUDriver{cpuTopology: topo, reservedCPUs: cpuset.New(1)}
+
+	// the topology is a map: the enumeration must not depend on its iteration order.
+	expected := cp.cpuDeviceInfos()
+	for range 20 {
+		require.Equal(t, expected, cp.cpuDeviceInfos())
+	}
+}
+
+func TestVerifyPublishedDeviceMappings(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		cpuDeviceMode        string
+		publishedReserved    cpuset.CPUSet
+		currentReserved      cpuset.CPUSet
+		currentMode          string
+		expectedMismatches   int
+		expectedMismatchName string
+	}{
+		{
+			name:              "individual devices unchanged",
+			cpuDeviceMode:     CPU_DEVICE_MODE_INDIVIDUAL,
+			publishedReserved: cpuset.New(),
+			currentReserved:   cpuset.New(),
+		},
+		{
+			name:                 "individual devices shifted by a new reservation",
+			cpuDeviceMode:        CPU_DEVICE_MODE_INDIVIDUAL,
+			publishedReserved:    cpuset.New(),
+			currentReserved:      cpuset.New(0, 4),
+			expectedMismatches:   8,
+			expectedMismatchName: "cpudev000",
+		},
+		{
+			name:              "grouped devices unchanged",
+			cpuDeviceMode:     CPU_DEVICE_MODE_GROUPED,
+			publishedReserved: cpuset.New(),
+			currentReserved:   cpuset.New(0),
+		},
+		{
+			name:                 "grouped device of a fully reserved NUMA node",
+			cpuDeviceMode:        CPU_DEVICE_MODE_GROUPED,
+			publishedReserved:    cpuset.New(),
+			currentReserved:      cpuset.New(0, 1, 4, 5),
+			expectedMismatches:   1,
+			expectedMismatchName: "cpudevnuma000",
+		},
+		{
+			name:                 "device mode changed",
+			cpuDeviceMode:        CPU_DEVICE_MODE_GROUPED,
+			publishedReserved:    cpuset.New(),
+			currentReserved:      cpuset.New(),
+			currentMode:          CPU_DEVICE_MODE_INDIVIDUAL,
+			expectedMismatches:   2,
+			expectedMismatchName: "cpudevnuma000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			// the previous driver instance publishes its devices.
+			previous := &CPUDriver{
+				cpuTopology:             topo,
+				cpuDeviceMode:           tc.cpuDeviceMode,
+				cpuDeviceGroupBy:        GROUP_BY_NUMA_NODE,
+				reservedCPUs:            tc.publishedReserved,
+				pcieRootMapper:          store.NewPCIeRootMapper(),
+				devicesPerResourceSlice: resourceapi.ResourceSliceMaxDevices,
+			}
+			var devices []resourceapi.Device
+			if tc.cpuDeviceMode == CPU_DEVICE_MODE_GROUPED {
+				devices = previous.createGroupedCPUDeviceSlices(logger)[0]
+			} else {
+				devices = previous.createCPUDeviceSlices()[0]
+			}
+			client := fake.NewClientset(&resourceapi.ResourceSlice{
+				ObjectMeta: metav1.ObjectMeta{Name: "published-slice"},
+				Spec: resourceapi.ResourceSliceSpec{
+					Driver:   testDriverName,
+					NodeName: ptr.To(testNodeName),
+					Pool:     resourceapi.ResourcePool{Name: testNodeName},
+					Devices:  devices,
+				},
+			})
+
+			currentMode := tc.currentMode
+			if currentMode == "" {
+				currentMode = tc.cpuDeviceMode
+			}
+			current := &CPUDriver{
+				driverName:       testDriverName,
+				nodeName:         testNodeName,
+				kubeClient:       client,
+				cpuTopology:      topo,
+				cpuDeviceMode:    currentMode,
+				cpuDeviceGroupBy: GROUP_BY_NUMA_NODE,
+				reservedCPUs:     tc.currentReserved,
+			}
+			current.initializeDeviceLookupMaps()
+
+			mismatches, err := current.verifyPublishedDeviceMappings(context.Background())
+			require.NoError(t, err)
+			require.Len(t, mismatches, tc.expectedMismatches)
+			if tc.expectedMismatchName != "" {
+				require.Equal(t, tc.expectedMismatchName, mismatches[0].device)
+			}
+		})
+	}
+}
+
+func TestVerifyPublishedDeviceMappingsCPUPools(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		currentPools         map[string]string
+		expectedMismatches   int
+		expectedMismatchName string
+	}{
+		{
+			name:         "pools unchanged",
+			currentPools: map[string]string{"realtime": "0,4", "batch": "2-3,6-7"},
+		},
+		{
+			name:                 "pool resized",
+			currentPools:         map[string]string{"realtime": "0,4", "batch": "3,7"},
+			expectedMismatches:   1,
+			expectedMismatchName: "cpudevpool-batch",
+		},
+		{
+			name:                 "pool removed",
+			currentPools:         map[string]string{"batch": "2-3,6-7"},
+			expectedMismatches:   1,
+			expectedMismatchName: "cpudevpool-realtime",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			// the previous driver instance publishes the devices of its pools.
+			previous := newCPUPoolsTestDriver(t)
+			var devices []resourceapi.Device
+			for _, chunk := range previous.createGroupedCPUDeviceSlices(logger) {
+				devices = append(devices, chunk...)
+			}
+			client := fake.NewClientset(&resourceapi.ResourceSlice{
+				ObjectMeta: metav1.ObjectMeta{Name: "published-slice"},
+				Spec: resourceapi.ResourceSliceSpec{
+					Driver:   testDriverName,
+					NodeName: ptr.To(testNodeName),
+					Pool:     resourceapi.ResourcePool{Name: testNodeName},
+					Devices:  devices,
+				},
+			})
+
+			current := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.kubeClient = client
+				pools, err := resolveCPUPools(cp.cpuTopology, cp.reservedCPUs, tc.currentPools)
+				require.NoError(t, err)
+				cp.cpuPools = pools
+			})
+			mismatches, err := current.verifyPublishedDeviceMappings(context.Background())
+			require.NoError(t, err)
+			require.Len(t, mismatches, tc.expectedMismatches, "mismatches: %v", mismatches)
+			if tc.expectedMismatchName != "" {
+				require.Equal(t, tc.expectedMismatchName, mismatches[0].device)
+			}
+		})
+	}
+}
+
+func TestVerifyPublishedDeviceMappingsSharedPool(t *testing.T) {
+	testCases := []struct {
+		name               string
+		sharedPoolDevice   bool
+		expectedMismatches int
+	}{
+		{name: "shared pool device still published", sharedPoolDevice: true},
+		{name: "shared pool device disabled", expectedMismatches: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			previous := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.sharedPoolDevice = true
+			})
+			var devices []resourceapi.Device
+			for _, chunk := range previous.createGroupedCPUDeviceSlices(logger) {
+				devices = append(devices, chunk...)
+			}
+			devices = append(devices, previous.createSharedPoolDevice())
+			client := fake.NewClientset(&resourceapi.ResourceSlice{
+				ObjectMeta: metav1.ObjectMeta{Name: "published-slice"},
+				Spec: resourceapi.ResourceSliceSpec{
+					Driver:   testDriverName,
+					NodeName: ptr.To(testNodeName),
+					Pool:     resourceapi.ResourcePool{Name: testNodeName},
+					Devices:  devices,
+				},
+			})
+
+			current := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.kubeClient = client
+				cp.sharedPoolDevice = tc.sharedPoolDevice
+			})
+			mismatches, err := current.verifyPublishedDeviceMappings(context.Background())
+			require.NoError(t, err)
+			require.Len(t, mismatches, tc.expectedMismatches, "mismatches: %v", mismatches)
+			if tc.expectedMismatches > 0 {
+				require.Equal(t, cpuDeviceSharedPool, mismatches[0].device)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// deviceModeOfSocket returns the device mode the CPUs of the socket are exposed with.
+func (cp *CPUDriver) deviceModeOfSocket(socketID int) string {
+	if mode, ok := cp.socketDeviceModes[socketID]; ok {
+		return mode
+	}
+	return cp.cpuDeviceMode
+}
+
+// usesGroupedDevices returns true if some CPUs are exposed as grouped devices.
+func (cp *CPUDriver) usesGroupedDevices() bool {
+	return cp.cpuDeviceMode == CPU_DEVICE_MODE_GROUPED || cp.cpuDeviceMode == CPU_DEVICE_MODE_MIXED || cp.socketsUseDeviceMode(CPU_DEVICE_MODE_GROUPED)
+}
+
+// usesIndividualDevices returns true if some CPUs are exposed as individual devices.
+func (cp *CPUDriver) usesIndividualDevices() bool {
+	return cp.cpuDeviceMode != CPU_DEVICE_MODE_GROUPED || cp.socketsUseDeviceMode(CPU_DEVICE_MODE_INDIVIDUAL)
+}
+
+func (cp *CPUDriver) socketsUseDeviceMode(mode string) bool {
+	for _, socketMode := range cp.socketDeviceModes {
+		if socketMode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// claimDeviceMode returns the mode of the devices of the driver allocated to the claim.
+// When both modes are in use, the devices of a claim must all be of the same mode.
+func (cp *CPUDriver) claimDeviceMode(claim *resourceapi.ResourceClaim) (string, error) {
+	if !cp.usesIndividualDevices() {
+		return CPU_DEVICE_MODE_GROUPED, nil
+	}
+	if !cp.usesGroupedDevices() || claim.Status.Allocation == nil {
+		return CPU_DEVICE_MODE_INDIVIDUAL, nil
+	}
+	mode := ""
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		allocMode := CPU_DEVICE_MODE_GROUPED
+		if _, ok := cp.deviceNameToCPUID[alloc.Device]; ok {
+			allocMode = CPU_DEVICE_MODE_INDIVIDUAL
+		} else if current, ok := cp.legacyDeviceNames[alloc.Device]; ok {
+			if _, ok := cp.deviceNameToCPUID[current]; ok {
+				allocMode = CPU_DEVICE_MODE_INDIVIDUAL
+			}
+		}
+		if mode != "" && mode != allocMode {
+			return "", fmt.Errorf("claim %s/%s mixes individual and grouped CPU devices", claim.Namespace, claim.Name)
+		}
+		mode = allocMode
+	}
+	if mode == "" {
+		mode = cp.cpuDeviceMode
+		if mode == CPU_DEVICE_MODE_MIXED {
+			mode = CPU_DEVICE_MODE_INDIVIDUAL
+		}
+	}
+	return mode, nil
+}
+
+// validateSocketDeviceModes checks the per-socket device modes refer to existing sockets.
+func validateSocketDeviceModes(topo *cpuinfo.CPUTopology, socketDeviceModes map[int]string) error {
+	sockets := topo.CPUDetails.Sockets()
+	for _, socketID := range slices.Sorted(maps.Keys(socketDeviceModes)) {
+		if !sockets.Contains(socketID) {
+			return fmt.Errorf("device mode set for socket %d, which is not in the topology (sockets: %s)", socketID, sockets.String())
+		}
+		mode := socketDeviceModes[socketID]
+		if mode != CPU_DEVICE_MODE_GROUPED && mode != CPU_DEVICE_MODE_INDIVIDUAL {
+			return fmt.Errorf("invalid device mode %q for socket %d", mode, socketID)
+		}
+	}
+	return nil
+}
+
+// validateGroupBy checks the topology has the groups the grouped devices are made of. Without it, e.g. grouping
+// by cluster on a host whose CPUs report no cluster, the driver would publish no devices at all.
+func validateGroupBy(topo *cpuinfo.CPUTopology, groupBy string) error {
+	switch groupBy {
+	case GROUP_BY_CLUSTER:
+		for _, info := range topo.CPUDetails {
+			if info.ClusterID >= 0 {
+				return nil
+			}
+		}
+		return fmt.Errorf("grouping by %s requires the CPU clusters, but no CPU reports its cluster in the topology", groupBy)
+	case GROUP_BY_CCD:
+		for _, info := range topo.CPUDetails {
+			if info.CCDID >= 0 {
+				return nil
+			}
+		}
+		return fmt.Errorf("grouping by %s requires the AMD CCDs, but no CPU of the topology is in a CCD", groupBy)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func newMixedModesDriver(t *testing.T) *CPUDriver {
+	t.Helper()
+	return newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		driver.socketDeviceModes = map[int]string{0: CPU_DEVICE_MODE_INDIVIDUAL}
+	})
+}
+
+func TestMixedDeviceModesLookupMaps(t *testing.T) {
+	driver := newMixedModesDriver(t)
+
+	require.ElementsMatch(t, []int{0, 1, 4, 5}, slices.Collect(maps.Values(driver.deviceNameToCPUID)))
+	require.Equal(t, map[string]int{"cpudevnuma001": 1}, driver.deviceNameToNUMANodeID)
+}
+
+func TestMixedDeviceModesPublishResources(t *testing.T) {
+	driver := newMixedModesDriver(t)
+	mockPlugin := &mockKubeletPlugin{}
+	driver.draPlugin = mockPlugin
+	driver.pcieRootMapper = store.NewPCIeRootMapper()
+
+	driver.PublishResources(context.Background())
+
+	require.NotNil(t, mockPlugin.publishedResources)
+	var deviceNames []string
+	for _, pool := range mockPlugin.publishedResources.Pools {
+		for _, slice := range pool.Slices {
+			for _, device := range slice.Devices {
+				deviceNames = append(deviceNames, device.Name)
+			}
+		}
+	}
+	expected := append([]string{"cpudevnuma001"}, slices.Collect(maps.Keys(driver.deviceNameToCPUID))...)
+	require.ElementsMatch(t, expected, deviceNames)
+}
+
+func TestMixedDeviceModesPrepareResourceClaims(t *testing.T) {
+	individualUID := types.UID("claim-individual")
+	groupedUID := types.UID("claim-grouped")
+	mixedUID := types.UID("claim-mixed")
+
+	driver := newMixedModesDriver(t)
+	individualDevice := slices.Sorted(maps.Keys(driver.deviceNameToCPUID))[0]
+	claims := []*resourceapi.ResourceClaim{
+		testClaimWithResults(individualUID, []resourceapi.DeviceRequestAllocationResult{
+			{Driver: testDriverName, Pool: testNodeName, Device: individualDevice, Request: "req-0"},
+		}),
+		testClaim(groupedUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}),
+		testClaimWithResults(mixedUID, []resourceapi.DeviceRequestAllocationResult{
+			{Driver: testDriverName, Pool: testNodeName, Device: individualDevice, Request: "req-0"},
+			{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma001", Request: "req-1"},
+		}),
+	}
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+
+	require.NoError(t, prepared[individualUID].Err)
+	gotCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(individualUID)
+	require.True(t, ok)
+	require.True(t, gotCPUs.Equals(cpuset.New(driver.deviceNameToCPUID[individualDevice])), "got %s", gotCPUs)
+
+	require.NoError(t, prepared[groupedUID].Err)
+	gotCPUs, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(groupedUID)
+	require.True(t, ok)
+	require.True(t, gotCPUs.IsSubsetOf(cpuset.New(2, 3, 6, 7)), "got %s", gotCPUs)
+	require.Equal(t, 2, gotCPUs.Size())
+
+	require.Error(t, prepared[mixedUID].Err)
+	_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(mixedUID)
+	require.False(t, ok)
+}
+
+func TestValidateSocketDeviceModes(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		modes         map[int]string
+		expectedError bool
+	}{
+		{
+			name: "no overrides",
+		},
+		{
+			name:  "valid overrides",
+			modes: map[int]string{0: CPU_DEVICE_MODE_INDIVIDUAL, 1: CPU_DEVICE_MODE_GROUPED},
+		},
+		{
+			name:          "unknown socket",
+			modes:         map[int]string{2: CPU_DEVICE_MODE_INDIVIDUAL},
+			expectedError: true,
+		},
+		{
+			name:          "unknown mode",
+			modes:         map[int]string{0: "bogus"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSocketDeviceModes(topo, tc.modes)
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateGroupBy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cpuInfos      []cpuinfo.CPUInfo
+		groupBy       string
+		expectedError bool
+	}{
+		{
+			name:     "cluster with clusters",
+			cpuInfos: mockCPUInfos_SingleSocket_2Clusters_ARM,
+			groupBy:  GROUP_BY_CLUSTER,
+		},
+		{
+			name:          "cluster without clusters",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Clusters_ARM[4:],
+			groupBy:       GROUP_BY_CLUSTER,
+			expectedError: true,
+		},
+		{
+			name:     "ccd with CCDs",
+			cpuInfos: mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			groupBy:  GROUP_BY_CCD,
+		},
+		{
+			name:          "ccd without CCDs",
+			cpuInfos:      mockCPUInfos_SingleSocket_2CCDs_Zen2[8:],
+			groupBy:       GROUP_BY_CCD,
+			expectedError: true,
+		},
+		{
+			name:     "numa node without clusters",
+			cpuInfos: mockCPUInfos_SingleSocket_2Clusters_ARM[4:],
+			groupBy:  GROUP_BY_NUMA_NODE,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: tc.cpuInfos}
+			topo, err := mockProvider.GetCPUTopology(testr.New(t))
+			require.NoError(t, err)
+			err = validateGroupBy(topo, tc.groupBy)
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// legacyDeviceName returns the name the device had before the device IDs were zero-padded
+// (e.g. cpudevnuma0 for cpudevnuma000), or empty if the name did not change.
+func legacyDeviceName(name string) string {
+	prefix := strings.TrimRight(name, "0123456789")
+	id, err := strconv.Atoi(name[len(prefix):])
+	if err != nil {
+		return ""
+	}
+	legacy := prefix + strconv.Itoa(id)
+	if legacy == name {
+		return ""
+	}
+	return legacy
+}
+
+// addLegacyDeviceName remembers the legacy name of a device, if legacy names are translated.
+func (cp *CPUDriver) addLegacyDeviceName(name string) {
+	if cp.legacyDeviceNames == nil {
+		return
+	}
+	if legacy := legacyDeviceName(name); legacy != "" {
+		cp.legacyDeviceNames[legacy] = name
+	}
+}
+
+// resolveDeviceName translates the device names allocated by previous driver versions,
+// so the claims allocated before an upgrade can still be prepared.
+// The translation is deprecated and will be removed in a future release.
+func (cp *CPUDriver) resolveDeviceName(logger logr.Logger, name string) string {
+	current, ok := cp.legacyDeviceNames[name]
+	if !ok {
+		return name
+	}
+	legacyDeviceNameTranslations.Inc()
+	logger.Info("translated deprecated device name, the claim should be recreated", "legacyDevice", name, "device", current)
+	return current
+}
@@ -0,0 +1,121 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestLegacyDeviceName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "cpudev000", expected: "cpudev0"},
+		{name: "cpudev012", expected: "cpudev12"},
+		{name: "cpudevnuma001", expected: "cpudevnuma1"},
+		{name: "cpudevsocket000", expected: "cpudevsocket0"},
+		{name: "cpudev1024", expected: ""},
+		{name: "cpudev", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, legacyDeviceName(tc.name))
+		})
+	}
+}
+
+func TestPrepareResourceClaimsLegacyDeviceNames(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-legacy")
+
+	testCases := []struct {
+		name             string
+		cpuDeviceMode    string
+		cpuDeviceGroupBy string
+		translate        bool
+		claim            *resourceapi.ResourceClaim
+		expectedError    bool
+	}{
+		{
+			name:          "individual mode",
+			cpuDeviceMode: CPU_DEVICE_MODE_INDIVIDUAL,
+			translate:     true,
+			claim: testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0"},
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudev001"},
+			}),
+		},
+		{
+			name:             "numa grouped",
+			cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy: GROUP_BY_NUMA_NODE,
+			translate:        true,
+			claim:            testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma1": 2}),
+		},
+		{
+			name:             "translation disabled",
+			cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy: GROUP_BY_NUMA_NODE,
+			claim:            testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma1": 2}),
+			expectedError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			driver := &CPUDriver{
+				driverName:           testDriverName,
+				cpuTopology:          topo,
+				cpuAllocationStore:   store.NewCPUAllocation(topo, cpuset.New()),
+				cdiMgr:               newMockCdiMgr(),
+				cpuDeviceMode:        tc.cpuDeviceMode,
+				cpuDeviceGroupBy:     tc.cpuDeviceGroupBy,
+				reservedCPUs:         cpuset.New(),
+				translateLegacyNames: tc.translate,
+				podConfigStore:       store.NewPodConfig(),
+				claimTracker:         store.NewClaimTracker(),
+			}
+			driver.initializeDeviceLookupMaps()
+			translations := testutil.ToFloat64(legacyDeviceNameTranslations)
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				require.Equal(t, translations, testutil.ToFloat64(legacyDeviceNameTranslations))
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			require.Equal(t, translations+1, testutil.ToFloat64(legacyDeviceNameTranslations))
+		})
+	}
+}
@@ -23,16 +23,19 @@ import (
 	"os"
 	"slices"
 	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
-	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
-	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	corev1 "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/dynamic-resource-allocation/deviceattribute"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
@@ -48,15 +51,64 @@ const (
 	// cpuResourceQualifiedName is the qualified name for the CPU resource capacity.
 	cpuResourceQualifiedName = "dra.cpu/cpu"
 
-	cpuDeviceSocketGroupedPrefix = "cpudevsocket"
-	cpuDeviceNUMAGroupedPrefix   = "cpudevnuma"
+	cpuDeviceSocketGroupedPrefix  = "cpudevsocket"
+	cpuDeviceNUMAGroupedPrefix    = "cpudevnuma"
+	cpuDeviceDieGroupedPrefix     = "cpudevdie"
+	cpuDeviceClusterGroupedPrefix = "cpudevcluster"
+	cpuDeviceL3GroupedPrefix      = "cpudevl3"
+	cpuDeviceCCDGroupedPrefix     = "cpudevccd"
+	cpuDeviceCoreGroupedPrefix    = "cpudevcore"
+	cpuDeviceNodeGroupedPrefix    = "cpudevnode"
 )
 
 type groupedCPUDeviceInfo struct {
-	name       string
-	cpus       cpuset.CPUSet
-	socketID   int
-	numaNodeID int
+	name          string
+	cpus          cpuset.CPUSet
+	socketID      int
+	numaNodeID    int
+	dieID         int
+	clusterID     int
+	uncoreCacheID int
+	ccdID         int
+	core          coreIdent
+	// aliases are the other names resolving to the device, not published.
+	aliases []string
+	// cpuTier is the CPU tier of the device, empty for the CPUs in no tier.
+	cpuTier string
+}
+
+// dieIdent identifies a die: die IDs are unique only within a socket.
+type dieIdent struct {
+	socketID int
+	dieID    int
+}
+
+// clusterIdent identifies a CPU cluster: cluster IDs are unique only within a socket.
+type clusterIdent struct {
+	socketID  int
+	clusterID int
+}
+
+// coreIdent identifies a physical core: core IDs are unique only within a socket and cluster.
+type coreIdent struct {
+	socketID  int
+	clusterID int
+	coreID    int
+}
+
+func coreIdentOf(cpu cpuinfo.CPUInfo) coreIdent {
+	return coreIdent{socketID: cpu.SocketID, clusterID: cpu.ClusterID, coreID: cpu.CoreID}
+}
+
+// cpusInCore returns the hardware threads of a physical core.
+func cpusInCore(topo *cpuinfo.CPUTopology, core coreIdent) cpuset.CPUSet {
+	var cpuIDs []int
+	for cpuID, info := range topo.CPUDetails {
+		if coreIdentOf(info) == core {
+			cpuIDs = append(cpuIDs, cpuID)
+		}
+	}
+	return cpuset.New(cpuIDs...)
 }
 
 type cpuDeviceInfo struct {
@@ -93,12 +145,131 @@ func (cp *CPUDriver) groupedCPUDeviceInfos() []groupedCPUDeviceInfo {
 			// All CPUs in a NUMA node belong to the same socket.
 			anyCPU := allocatableCPUs.UnsortedList()[0]
 			devices = append(devices, groupedCPUDeviceInfo{
-				name:       fmt.Sprintf("%s%03d", cpuDeviceNUMAGroupedPrefix, numaID),
+				name:       cp.numaDeviceName(numaID),
 				cpus:       allocatableCPUs,
 				socketID:   topo.CPUDetails[anyCPU].SocketID,
 				numaNodeID: numaID,
 			})
 		}
+	case GROUP_BY_DIE:
+		// Dies are numbered across sockets, so skipping a fully reserved die must not shift the others.
+		dieIndex := 0
+		for _, socketID := range topo.CPUDetails.Sockets().List() {
+			for _, dieID := range topo.CPUDetails.DiesInSockets(socketID).List() {
+				name := fmt.Sprintf("%s%03d", cpuDeviceDieGroupedPrefix, dieIndex)
+				dieIndex++
+				allocatableCPUs := topo.CPUDetails.CPUsInDie(socketID, dieID).Difference(cp.reservedCPUs)
+				if allocatableCPUs.Size() == 0 {
+					continue
+				}
+				devices = append(devices, groupedCPUDeviceInfo{
+					name:     name,
+					cpus:     allocatableCPUs,
+					socketID: socketID,
+					dieID:    dieID,
+				})
+			}
+		}
+	case GROUP_BY_CLUSTER:
+		// Clusters are numbered across sockets, so skipping a fully reserved cluster must not shift the others.
+		// The CPUs with an unknown cluster are in no device.
+		clusterIndex := 0
+		for _, socketID := range topo.CPUDetails.Sockets().List() {
+			for _, clusterID := range topo.CPUDetails.ClustersInSockets(socketID).List() {
+				if clusterID < 0 {
+					continue
+				}
+				name := fmt.Sprintf("%s%03d", cpuDeviceClusterGroupedPrefix, clusterIndex)
+				clusterIndex++
+				allocatableCPUs := topo.CPUDetails.CPUsInCluster(socketID, clusterID).Difference(cp.reservedCPUs)
+				if allocatableCPUs.Size() == 0 {
+					continue
+				}
+				devices = append(devices, groupedCPUDeviceInfo{
+					name:      name,
+					cpus:      allocatableCPUs,
+					socketID:  socketID,
+					clusterID: clusterID,
+				})
+			}
+		}
+	case GROUP_BY_L3:
+		// the CPUs with an unknown uncore cache are in no device.
+		for _, uncoreCacheID := range topo.CPUDetails.UncoreCaches().List() {
+			if uncoreCacheID < 0 {
+				continue
+			}
+			allocatableCPUs := topo.CPUDetails.CPUsInUncoreCaches(uncoreCacheID).Difference(cp.reservedCPUs)
+			if allocatableCPUs.Size() == 0 {
+				continue
+			}
+
+			// An uncore cache is local to a NUMA node, and to its socket.
+			anyCPU := topo.CPUDetails[allocatableCPUs.List()[0]]
+			devices = append(devices, groupedCPUDeviceInfo{
+				name:          fmt.Sprintf("%s%03d", cpuDeviceL3GroupedPrefix, uncoreCacheID),
+				cpus:          allocatableCPUs,
+				socketID:      anyCPU.SocketID,
+				numaNodeID:    anyCPU.NUMANodeID,
+				uncoreCacheID: uncoreCacheID,
+			})
+		}
+	case GROUP_BY_CCD:
+		// the CPUs of the other vendors, or with an unknown uncore cache, are in no device.
+		for _, ccdID := range topo.CPUDetails.CCDs().List() {
+			if ccdID < 0 {
+				continue
+			}
+			allocatableCPUs := topo.CPUDetails.CPUsInCCDs(ccdID).Difference(cp.reservedCPUs)
+			if allocatableCPUs.Size() == 0 {
+				continue
+			}
+
+			// A CCD is local to its socket, but not always to a NUMA node: with the L3 as NUMA node, its
+			// two CCXs of Zen 2 are two NUMA nodes.
+			devices = append(devices, groupedCPUDeviceInfo{
+				name:     fmt.Sprintf("%s%03d", cpuDeviceCCDGroupedPrefix, ccdID),
+				cpus:     allocatableCPUs,
+				socketID: topo.CPUDetails[allocatableCPUs.List()[0]].SocketID,
+				ccdID:    ccdID,
+			})
+		}
+	case GROUP_BY_CORE:
+		// Cores are numbered by their first CPU, and skipping a fully reserved core must not shift the others.
+		var cores []coreIdent
+		coreCPUs := make(map[coreIdent][]int)
+		for _, cpuID := range topo.CPUDetails.CPUs().List() {
+			core := coreIdentOf(topo.CPUDetails[cpuID])
+			if _, ok := coreCPUs[core]; !ok {
+				cores = append(cores, core)
+			}
+			coreCPUs[core] = append(coreCPUs[core], cpuID)
+		}
+		for coreIndex, core := range cores {
+			allocatableCPUs := cpuset.New(coreCPUs[core]...).Difference(cp.reservedCPUs)
+			if allocatableCPUs.Size() == 0 {
+				continue
+			}
+			anyCPU := topo.CPUDetails[allocatableCPUs.List()[0]]
+			devices = append(devices, groupedCPUDeviceInfo{
+				name:          fmt.Sprintf("%s%03d", cpuDeviceCoreGroupedPrefix, coreIndex),
+				cpus:          allocatableCPUs,
+				socketID:      anyCPU.SocketID,
+				numaNodeID:    anyCPU.NUMANodeID,
+				dieID:         anyCPU.DieID,
+				uncoreCacheID: anyCPU.UncoreCacheID,
+				core:          core,
+			})
+		}
+	}
+	devices = cp.collapseUMADeviceInfos(devices)
+	devices = cp.splitCPUTierDeviceInfos(devices)
+	devices = cp.excludeCPUPoolDeviceInfos(devices)
+	if len(cp.socketDeviceModes) > 0 {
+		// the sockets exposing individual devices have no grouped devices.
+		devices = slices.DeleteFunc(devices, func(device groupedCPUDeviceInfo) bool {
+			return cp.deviceModeOfSocket(device.socketID) != CPU_DEVICE_MODE_GROUPED
+		})
 	}
 	return devices
 }
@@ -118,6 +289,10 @@ func (cp *CPUDriver) cpuDeviceInfos() []cpuDeviceInfo {
 	availableCPUs := []cpuinfo.CPUInfo{}
 	for _, cpu := range topo.CPUDetails {
 		allCPUs = append(allCPUs, cpu)
+		if len(cp.socketDeviceModes) > 0 && cp.deviceModeOfSocket(cpu.SocketID) != CPU_DEVICE_MODE_INDIVIDUAL {
+			// the sockets exposing grouped devices have no individual devices.
+			continue
+		}
 		if !reservedCPUs[cpu.CpuID] {
 			availableCPUs = append(availableCPUs, cpu)
 		}
@@ -155,8 +330,12 @@ func (cp *CPUDriver) cpuDeviceInfos() []cpuDeviceInfo {
 	devID := 0
 	for _, group := range coreGroups {
 		for _, cpu := range group {
+			name, ok := cp.cpuDeviceNames[cpu.CpuID]
+			if !ok {
+				name = cpuDeviceName(devID)
+			}
 			devices = append(devices, cpuDeviceInfo{
-				name: fmt.Sprintf("%s%03d", cpuDevicePrefix, devID),
+				name: name,
 				cpu:  cpu,
 			})
 			devID++
@@ -172,73 +351,148 @@ func (cp *CPUDriver) initializeDeviceLookupMaps() {
 	cp.deviceNameToCPUID = make(map[string]int)
 	cp.deviceNameToSocketID = make(map[string]int)
 	cp.deviceNameToNUMANodeID = make(map[string]int)
+	cp.deviceNameToDie = make(map[string]dieIdent)
+	cp.deviceNameToCluster = make(map[string]clusterIdent)
+	cp.deviceNameToUncoreCache = make(map[string]int)
+	cp.deviceNameToCCD = make(map[string]int)
+	cp.deviceNameToCore = make(map[string]coreIdent)
+	cp.deviceNameToCPUTier = make(map[string]string)
+	cp.deviceNameToCPUPool = make(map[string]string)
+	cp.legacyDeviceNames = nil
+	if cp.translateLegacyNames {
+		cp.legacyDeviceNames = make(map[string]string)
+	}
 
-	if cp.cpuDeviceMode == CPU_DEVICE_MODE_GROUPED {
+	if cp.usesGroupedDevices() {
 		for _, device := range cp.groupedCPUDeviceInfos() {
-			switch cp.cpuDeviceGroupBy {
-			case GROUP_BY_SOCKET:
-				cp.deviceNameToSocketID[device.name] = device.socketID
-			case GROUP_BY_NUMA_NODE:
-				cp.deviceNameToNUMANodeID[device.name] = device.numaNodeID
+			for _, name := range append([]string{device.name}, device.aliases...) {
+				if name != cpuDeviceNodeName && device.cpuTier == "" && !cp.isPhysicalNUMADeviceName(name) {
+					cp.addLegacyDeviceName(name)
+				}
+				if device.cpuTier != "" {
+					cp.deviceNameToCPUTier[name] = device.cpuTier
+				}
+				switch cp.cpuDeviceGroupBy {
+				case GROUP_BY_SOCKET:
+					cp.deviceNameToSocketID[name] = device.socketID
+				case GROUP_BY_NUMA_NODE:
+					cp.deviceNameToNUMANodeID[name] = device.numaNodeID
+				case GROUP_BY_DIE:
+					cp.deviceNameToDie[name] = dieIdent{socketID: device.socketID, dieID: device.dieID}
+				case GROUP_BY_CLUSTER:
+					cp.deviceNameToCluster[name] = clusterIdent{socketID: device.socketID, clusterID: device.clusterID}
+				case GROUP_BY_L3:
+					cp.deviceNameToUncoreCache[name] = device.uncoreCacheID
+				case GROUP_BY_CCD:
+					cp.deviceNameToCCD[name] = device.ccdID
+				case GROUP_BY_CORE:
+					cp.deviceNameToCore[name] = device.core
+				}
 			}
 		}
-		return
 	}
-
-	for _, device := range cp.cpuDeviceInfos() {
-		cp.deviceNameToCPUID[device.name] = device.cpu.CpuID
+	for pool := range cp.cpuPools {
+		cp.deviceNameToCPUPool[cpuPoolDeviceName(pool)] = pool
+	}
+	for _, partition := range cp.socketNUMAPartitionInfos() {
+		cp.deviceNameToNUMANodeID[partition.name] = partition.numaNodeID
+	}
+	if cp.usesIndividualDevices() {
+		for _, device := range cp.cpuDeviceInfos() {
+			cp.addLegacyDeviceName(device.name)
+			cp.deviceNameToCPUID[device.name] = device.cpu.CpuID
+		}
 	}
 }
 
 // createGroupedCPUDeviceSlices creates Device objects based on the CPU topology, grouped by a specific criteria.
 func (cp *CPUDriver) createGroupedCPUDeviceSlices(logger logr.Logger) [][]resourceapi.Device {
+	return chunkDevicesOf(cp.createGroupedCPUDeviceChunks(logger))
+}
+
+// createGroupedCPUDeviceChunks creates the grouped devices, in chunks with their slice group.
+func (cp *CPUDriver) createGroupedCPUDeviceChunks(logger logr.Logger) []deviceChunk {
 	logger.V(4).Info("creating grouped CPU devices")
 	var devices []resourceapi.Device
+	var groups []int
 
 	for _, deviceInfo := range cp.groupedCPUDeviceInfos() {
+		groups = append(groups, cp.sliceGroupOf(deviceInfo.cpus))
 		availableCPUs := int64(deviceInfo.cpus.Size())
 		deviceCapacity := map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
-			cpuResourceQualifiedName: {Value: *resource.NewQuantity(availableCPUs, resource.DecimalSI)},
+			cpuResourceQualifiedName:       {Value: *resource.NewQuantity(availableCPUs, resource.DecimalSI), RequestPolicy: cp.cpuCapacityRequestPolicy()},
+			fullCoresResourceQualifiedName: {Value: *resource.NewQuantity(cp.fullCoresCapacity(deviceInfo.cpus), resource.DecimalSI), RequestPolicy: fullCoresCapacityRequestPolicy()},
 		}
 
-		switch cp.cpuDeviceGroupBy {
-		case GROUP_BY_SOCKET:
-			deviceAttrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
-				AttributeSocketID:   {IntValue: ptr.To(int64(deviceInfo.socketID))},
-				AttributeNumCPUs:    {IntValue: ptr.To(availableCPUs)},
-				AttributeSMTEnabled: {BoolValue: ptr.To(cp.cpuTopology.SMTEnabled)},
+		deviceAttrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			AttributeSocketID:   {IntValue: ptr.To(int64(deviceInfo.socketID))},
+			AttributeSMTEnabled: {BoolValue: ptr.To(cp.cpuTopology.SMTEnabled)},
+			AttributeNumCPUs:    {IntValue: ptr.To(availableCPUs)},
+		}
+		// the node device of the UMA nodes has no NUMA node nor die to advertise.
+		if deviceInfo.name != cpuDeviceNodeName {
+			switch cp.cpuDeviceGroupBy {
+			case GROUP_BY_NUMA_NODE:
+				deviceAttrs[AttributeNUMANodeID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.numaNodeID))}
+				cp.setAlignmentAttributes(deviceAttrs, deviceInfo.numaNodeID)
+				cp.setMemoryBandwidthCapacity(deviceCapacity, deviceInfo.numaNodeID)
+			case GROUP_BY_DIE:
+				deviceAttrs[AttributeDieID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.dieID))}
+			case GROUP_BY_CLUSTER:
+				deviceAttrs[AttributeClusterID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.clusterID))}
+			case GROUP_BY_L3:
+				deviceAttrs[AttributeCacheL3ID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.uncoreCacheID))}
+				deviceAttrs[AttributeNUMANodeID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.numaNodeID))}
+				cp.setAlignmentAttributes(deviceAttrs, deviceInfo.numaNodeID)
+			case GROUP_BY_CCD:
+				deviceAttrs[AttributeCCDID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.ccdID))}
+			case GROUP_BY_CORE:
+				deviceAttrs[AttributeCoreID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.core.coreID))}
+				deviceAttrs[AttributeCacheL3ID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.uncoreCacheID))}
+				deviceAttrs[AttributeDieID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.dieID))}
+				deviceAttrs[AttributeNUMANodeID] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(deviceInfo.numaNodeID))}
+				cp.setAlignmentAttributes(deviceAttrs, deviceInfo.numaNodeID)
 			}
-			cp.setPCIeRootsAttribute(deviceAttrs, deviceInfo.cpus.UnsortedList()...)
-
-			devices = append(devices, resourceapi.Device{
-				Name:                     deviceInfo.name,
-				Attributes:               deviceAttrs,
-				Capacity:                 deviceCapacity,
-				AllowMultipleAllocations: ptr.To(true),
-			})
-		case GROUP_BY_NUMA_NODE:
-			deviceAttrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
-				AttributeNUMANodeID: {IntValue: ptr.To(int64(deviceInfo.numaNodeID))},
-				AttributeSocketID:   {IntValue: ptr.To(int64(deviceInfo.socketID))},
-				AttributeSMTEnabled: {BoolValue: ptr.To(cp.cpuTopology.SMTEnabled)},
-				AttributeNumCPUs:    {IntValue: ptr.To(availableCPUs)},
-			}
-			device.SetCompatibilityAttributes(deviceAttrs, int64(deviceInfo.numaNodeID))
-			cp.setPCIeRootsAttribute(deviceAttrs, deviceInfo.cpus.UnsortedList()...)
-
-			devices = append(devices, resourceapi.Device{
-				Name:                     deviceInfo.name,
-				Attributes:               deviceAttrs,
-				Capacity:                 deviceCapacity,
-				AllowMultipleAllocations: ptr.To(true),
-			})
 		}
+		// the CPUs of a core have the same core type, and so have the CPUs of the groups of the hybrid
+		// parts split by core type.
+		setCoreTypeAttribute(deviceAttrs, cp.cpuTopology, deviceInfo.cpus)
+		cp.setPerformanceScoreAttribute(deviceAttrs, deviceInfo.cpus)
+		cp.setFrequencyAttributes(deviceAttrs, deviceInfo.cpus)
+		cp.setISAFeatureAttributes(deviceAttrs, deviceInfo.cpus)
+		cp.setCPUModelAttributes(deviceAttrs, deviceInfo.cpus)
+		cp.setCPUCapacityAttributes(deviceAttrs, deviceInfo.cpus)
+		cp.setNUMADistanceAttributes(deviceAttrs, deviceInfo.cpus)
+		setCacheSizeAttributes(deviceAttrs, cp.cpuTopology, deviceInfo.cpus)
+		setCPUsAttribute(deviceAttrs, deviceInfo.cpus)
+		cp.setPCIeRootsAttribute(deviceAttrs, deviceInfo.cpus.UnsortedList()...)
+		cp.setKernelFeatureAttributes(deviceAttrs)
+		cp.setBuildAttributes(deviceAttrs)
+		setCPUTierAttribute(deviceAttrs, deviceInfo.cpuTier)
+
+		groupedDevice := resourceapi.Device{
+			Name:                     deviceInfo.name,
+			Attributes:               deviceAttrs,
+			Capacity:                 deviceCapacity,
+			AllowMultipleAllocations: ptr.To(true),
+			Taints:                   cp.cpuHealth.taints(deviceInfo.cpus),
+		}
+		if cp.usesNUMANodeCounters() {
+			groupedDevice.ConsumesCounters = cp.numaNodeCounterConsumption(deviceInfo.cpus)
+		}
+		devices = append(devices, groupedDevice)
 	}
+	partitionDevices, partitionGroups := cp.createSocketNUMAPartitionDevices()
+	devices = append(devices, partitionDevices...)
+	groups = append(groups, partitionGroups...)
+	poolDevices, poolGroups := cp.createCPUPoolDevices()
+	devices = append(devices, poolDevices...)
+	groups = append(groups, poolGroups...)
 
 	if len(devices) == 0 {
 		return nil
 	}
-	return [][]resourceapi.Device{devices}
+	return cp.groupChunks(devices, groups)
 }
 
 // CreateCPUDeviceSlices creates Device objects based on the CPU topology.
@@ -246,25 +500,48 @@ func (cp *CPUDriver) createGroupedCPUDeviceSlices(logger logr.Logger) [][]resour
 // This allows the DRA scheduler, which requests resources in contiguous blocks,
 // to co-locate workloads on hyperthreads of the same core.
 func (cp *CPUDriver) createCPUDeviceSlices() [][]resourceapi.Device {
+	return chunkDevicesOf(cp.createCPUDeviceChunks())
+}
+
+// createCPUDeviceChunks creates the individual devices, in chunks with their slice group.
+func (cp *CPUDriver) createCPUDeviceChunks() []deviceChunk {
 	var allDevices []resourceapi.Device
+	var groups []int
 	for _, deviceInfo := range cp.cpuDeviceInfos() {
 		cpu := deviceInfo.cpu
+		groups = append(groups, cp.sliceGroupOf(cpuset.New(cpu.CpuID)))
 		deviceAttrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
 			AttributeNUMANodeID: {IntValue: ptr.To(int64(cpu.NUMANodeID))},
 			AttributeSocketID:   {IntValue: ptr.To(int64(cpu.SocketID))},
+			AttributeDieID:      {IntValue: ptr.To(int64(cpu.DieID))},
 			AttributeSMTEnabled: {BoolValue: ptr.To(cp.cpuTopology.SMTEnabled)},
 			AttributeCacheL3ID:  {IntValue: ptr.To(int64(cpu.UncoreCacheID))},
 			AttributeCoreType:   {StringValue: ptr.To(cpu.CoreType.String())},
 			AttributeCoreID:     {IntValue: ptr.To(int64(cpu.CoreID))},
 			AttributeCPUID:      {IntValue: ptr.To(int64(cpu.CpuID))},
 		}
-		device.SetCompatibilityAttributes(deviceAttrs, int64(cpu.NUMANodeID))
+		cp.setAlignmentAttributes(deviceAttrs, cpu.NUMANodeID)
+		cp.setPerformanceScoreAttribute(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setFrequencyAttributes(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setISAFeatureAttributes(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setCPUModelAttributes(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setCPUCapacityAttributes(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setNUMADistanceAttributes(deviceAttrs, cpuset.New(cpu.CpuID))
+		cp.setKernelIsolationAttributes(deviceAttrs, cpu.CpuID)
+		setCacheSizeAttributes(deviceAttrs, cp.cpuTopology, cpuset.New(cpu.CpuID))
 		cp.setPCIeRootsAttribute(deviceAttrs, cpu.CpuID)
+		cp.setKernelFeatureAttributes(deviceAttrs)
+		cp.setBuildAttributes(deviceAttrs)
+		setCPUTierAttribute(deviceAttrs, cp.cpuTierOf(cpu.CpuID))
 
 		cpuDevice := resourceapi.Device{
 			Name:       deviceInfo.name,
 			Attributes: deviceAttrs,
 			Capacity:   make(map[resourceapi.QualifiedName]resourceapi.DeviceCapacity),
+			Taints:     cp.cpuHealth.taints(cpuset.New(cpu.CpuID)),
+		}
+		if cp.cpuDeviceMode == CPU_DEVICE_MODE_MIXED {
+			cpuDevice.ConsumesCounters = cp.numaNodeCounterConsumption(cpuset.New(cpu.CpuID))
 		}
 		allDevices = append(allDevices, cpuDevice)
 	}
@@ -273,50 +550,129 @@ func (cp *CPUDriver) createCPUDeviceSlices() [][]resourceapi.Device {
 		return nil
 	}
 
-	// Chunk devices into slices of at most devicesPerResourceSlice
-	return slices.Collect(slices.Chunk(allDevices, cp.devicesPerResourceSlice))
+	return cp.groupChunks(allDevices, groups)
+}
+
+// sliceGroupOf returns the slice group of a device with the given CPUs: the devices of different groups
+// never share a ResourceSlice. The devices spanning several groups go with the first one.
+func (cp *CPUDriver) sliceGroupOf(cpus cpuset.CPUSet) int {
+	details := cp.cpuTopology.CPUDetails.KeepOnly(cpus)
+	switch cp.sliceGrouping {
+	case SLICE_GROUPING_SOCKET:
+		return details.Sockets().List()[0]
+	case SLICE_GROUPING_NUMA_NODE:
+		return details.NUMANodes().List()[0]
+	case SLICE_GROUPING_L3:
+		// the devices of the CPUs whose L3 cache is unknown, with ID -1, go together.
+		caches := details.UncoreCaches().List()
+		for _, cacheID := range caches {
+			if cacheID >= 0 {
+				return cacheID
+			}
+		}
+		return caches[0]
+	}
+	return 0
+}
+
+// deviceChunk is a chunk of devices published as a ResourceSlice, with the slice group of its devices.
+type deviceChunk struct {
+	group   int
+	devices []resourceapi.Device
+}
+
+// chunkDevicesOf returns the devices of the chunks.
+func chunkDevicesOf(chunks []deviceChunk) [][]resourceapi.Device {
+	var devices [][]resourceapi.Device
+	for _, chunk := range chunks {
+		devices = append(devices, chunk.devices)
+	}
+	return devices
+}
+
+// chunkDevices splits the devices in the chunks published as ResourceSlices: the devices of different
+// slice groups, in groups, never share a chunk, and each chunk has at most devicesPerResourceSlice devices.
+// The devices keep their order.
+func (cp *CPUDriver) chunkDevices(devices []resourceapi.Device, groups []int) [][]resourceapi.Device {
+	return chunkDevicesOf(cp.groupChunks(devices, groups))
+}
+
+// groupChunks splits the devices in chunks as chunkDevices does, keeping the slice group of each chunk.
+func (cp *CPUDriver) groupChunks(devices []resourceapi.Device, groups []int) []deviceChunk {
+	size := cp.devicesPerResourceSlice
+	if size <= 0 {
+		size = resourceapi.ResourceSliceMaxDevices
+	}
+	var groupOrder []int
+	devicesByGroup := make(map[int][]resourceapi.Device)
+	for i, device := range devices {
+		if _, ok := devicesByGroup[groups[i]]; !ok {
+			groupOrder = append(groupOrder, groups[i])
+		}
+		devicesByGroup[groups[i]] = append(devicesByGroup[groups[i]], device)
+	}
+	var chunks []deviceChunk
+	for _, group := range groupOrder {
+		for chunk := range slices.Chunk(devicesByGroup[group], size) {
+			chunks = append(chunks, deviceChunk{group: group, devices: chunk})
+		}
+	}
+	return chunks
 }
 
 // PublishResources publishes ResourceSlice for CPU resources.
+// Once the driver is started, publications should be requested with RequestPublish, which serializes them.
 func (cp *CPUDriver) PublishResources(ctx context.Context) {
 	ctx, logger := ctxlog.WithValues(ctx, "opID", generateShortID(opIDLen), "deviceMode", cp.cpuDeviceMode, "groupBy", cp.cpuDeviceGroupBy)
 
 	logger.V(4).Info("begin: publishing resources")
 	defer logger.V(4).Info("end: publishing resources")
 
-	var deviceChunks [][]resourceapi.Device
-	if cp.cpuDeviceMode == CPU_DEVICE_MODE_GROUPED {
-		deviceChunks = cp.createGroupedCPUDeviceSlices(logger)
-	} else {
-		deviceChunks = cp.createCPUDeviceSlices()
+	var deviceChunks []deviceChunk
+	for _, mode := range cp.deviceModesInUse() {
+		manager, err := cp.deviceManager(mode)
+		if err != nil {
+			logger.Error(err, "error creating the devices", "mode", mode)
+			continue
+		}
+		deviceChunks = append(deviceChunks, manager.createDeviceChunks(logger)...)
+	}
+	if cp.sharedPoolDevice {
+		// the shared pool spans all the groups.
+		deviceChunks = append(deviceChunks, deviceChunk{group: nodePoolGroup, devices: []resourceapi.Device{cp.createSharedPoolDevice()}})
 	}
 
 	if deviceChunks == nil {
 		logger.Info("no devices to publish or error occurred")
 		return
 	}
+	cp.setBindingConditions(deviceChunks)
 
-	slices := make([]resourceslice.Slice, 0, len(deviceChunks))
-	for _, chunk := range deviceChunks {
-		slices = append(slices, resourceslice.Slice{Devices: chunk})
+	resources := resourceslice.DriverResources{
+		Pools: cp.resourcePools(deviceChunks),
 	}
 
-	resources := resourceslice.DriverResources{
-		Pools: map[string]resourceslice.Pool{
-			// All slices are published under the same pool for this node.
-			cp.nodeName: {Slices: slices},
-		},
+	changedPools := cp.publishedPools.changed(resources.Pools)
+	if len(changedPools) == 0 {
+		logger.V(2).Info("no resource pool changed since the last publication, skipping it")
+		resourcePublicationsSkipped.Inc()
+		return
 	}
+	logger.V(2).Info("publishing the changed resource pools", "changedPools", changedPools)
 
 	err := cp.draPlugin.PublishResources(ctx, resources)
 	if err != nil {
 		logger.Error(err, "error publishing resources")
+		// the next publication must not be skipped.
+		cp.publishedPools.reset()
+		return
 	}
+	cp.publishedPools.set(resources.Pools)
 }
 
 // PrepareResourceClaims is called by the kubelet to prepare a resource claim.
 func (cp *CPUDriver) PrepareResourceClaims(ctx context.Context, claims []*resourceapi.ResourceClaim) (map[types.UID]kubeletplugin.PrepareResult, error) {
-	_, logger := ctxlog.WithValues(ctx, "opID", generateShortID(opIDLen))
+	ctx, logger := ctxlog.WithValues(ctx, "opID", generateShortID(opIDLen))
 
 	logger.V(4).Info("begin: preparing resource claims", "numClaims", len(claims))
 	defer logger.V(4).Info("end: preparing resource claims", "numClaims", len(claims))
@@ -328,12 +684,44 @@ func (cp *CPUDriver) PrepareResourceClaims(ctx context.Context, claims []*resour
 	}
 
 	for _, claim := range claims {
-		cLogger := logger.WithValues("claim", ctxlog.KObj(claim), "claimUID", claim.UID)
-		if cp.cpuDeviceMode == CPU_DEVICE_MODE_GROUPED {
-			result[claim.UID] = cp.prepareGroupedResourceClaim(cLogger, claim)
-		} else {
-			result[claim.UID] = cp.prepareResourceClaim(cLogger, claim)
+		// a claim prepared again keeps its trace ID, so the story of the allocation is not split.
+		traceID := cp.cpuAllocationStore.GetResourceClaimTraceID(claim.UID)
+		if traceID == "" {
+			traceID = generateShortID(traceIDLen)
+		}
+		cLogger := logger.WithValues("claim", ctxlog.KObj(claim), "claimUID", claim.UID, "traceID", traceID)
+		sharedPoolClaim, err := cp.isSharedPoolClaim(claim)
+		if err != nil {
+			result[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
+		if sharedPoolClaim {
+			result[claim.UID] = cp.prepareSharedPoolClaim(cLogger, claim)
+			cp.reportPrepareResult(claim, result[claim.UID])
+			continue
+		}
+		mode, err := cp.claimDeviceMode(claim)
+		if err != nil {
+			result[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
+		if prepared, ok := cp.preparedResult(cLogger, claim); ok {
+			result[claim.UID] = prepared
+			continue
+		}
+		if err := cp.checkClaimEnforcement(claim); err != nil {
+			cLogger.Info("claim not prepared until its CPUs can be enforced", "reason", err.Error())
+			result[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			cp.reportPrepareResult(claim, result[claim.UID])
+			continue
 		}
+		manager, err := cp.deviceManager(mode)
+		if err != nil {
+			result[claim.UID] = kubeletplugin.PrepareResult{Err: err}
+			continue
+		}
+		result[claim.UID] = manager.prepareResourceClaim(ctx, cLogger, claim, traceID)
+		cp.reportPrepareResult(claim, result[claim.UID])
 	}
 	return result, nil
 }
@@ -342,7 +730,7 @@ func getCDIDeviceName(uid types.UID) string {
 	return fmt.Sprintf("claim-%s", uid)
 }
 
-func (cp *CPUDriver) prepareGroupedResourceClaim(logger logr.Logger, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
+func (cp *CPUDriver) prepareGroupedResourceClaim(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, traceID string) kubeletplugin.PrepareResult {
 	logger.V(4).Info("preparing grouped resource claim")
 
 	if claim.Status.Allocation == nil {
@@ -351,10 +739,46 @@ func (cp *CPUDriver) prepareGroupedResourceClaim(logger logr.Logger, claim *reso
 		}
 	}
 
+	tier, err := cp.claimTier(ctx, logger, claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	isolatedCPUs, conflictingTiers := cp.isolatedCPUs(tier)
+	fullPCPUsOnly, err := cp.claimUsesFullPCPUsOnly(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	requireFullCores, err := cp.claimRequiresFullCores(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	tuning, err := cp.claimTuning(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	l3AntiAffinity, err := cp.claimUsesL3AntiAffinity(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	var sharedL3CPUs cpuset.CPUSet
+	if l3AntiAffinity {
+		sharedL3CPUs = cp.sharedL3CPUs(claim.UID)
+	}
+
 	var cpuAssignment cpuset.CPUSet
+	// systemAssignment are the reserved CPUs assigned to the requests of a system claim.
+	systemAssignment := cpuset.New()
+	// sharedDevices counts the devices prepared with access to the shared CPUs only.
+	sharedDevices := 0
+	// claimFullCores is true if the claim consumed the full cores capacity of any device.
+	claimFullCores := false
+	// fractional is the fraction of the CPUs of the devices consumed by the requests of a fractional claim.
+	fractional := store.FractionalClaim{}
 	sharedCPUs := cp.cpuAllocationStore.GetSharedCPUs()
 	for _, alloc := range claim.Status.Allocation.Devices.Results {
 		claimCPUCount := int64(0)
+		claimCoreCount := int64(0)
+		claimMilliCPUs := int64(0)
 		if alloc.Driver != cp.driverName {
 			continue
 		}
@@ -362,52 +786,299 @@ func (cp *CPUDriver) prepareGroupedResourceClaim(logger logr.Logger, claim *reso
 			count := quantity.Value()
 			claimCPUCount = count
 			logger.V(4).Info("found CPU request", "numCPUs", count, "device", alloc.Device)
+			if cp.fractionalCPUs && isFractionalCPUQuantity(quantity) {
+				claimMilliCPUs = quantity.MilliValue()
+				logger.V(4).Info("found fractional CPU request", "milliCPUs", claimMilliCPUs, "device", alloc.Device)
+			}
 		}
 
 		topo := cp.cpuTopology
-
-		var availableCPUsForDevice cpuset.CPUSet
-		if cp.cpuDeviceGroupBy == GROUP_BY_SOCKET {
-			socketID, ok := cp.deviceNameToSocketID[alloc.Device]
-			if !ok {
-				return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid socket ID found for device %s", alloc.Device)}
+		if quantity, ok := alloc.ConsumedCapacity[fullCoresResourceQualifiedName]; ok && quantity.Value() > 0 {
+			claimCoreCount = quantity.Value()
+			logger.V(4).Info("found full cores request", "numCores", claimCoreCount, "device", alloc.Device)
+			if expected := claimCoreCount * int64(topo.CPUsPerCore()); claimCPUCount != expected {
+				return kubeletplugin.PrepareResult{Err: fmt.Errorf("%d full cores of device %s requested, but the consumed CPU capacity is %d instead of %d", claimCoreCount, alloc.Device, claimCPUCount, expected)}
 			}
-			socketCPUs := topo.CPUDetails.CPUsInSockets(socketID)
-			availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(socketCPUs)
-			logger.V(4).Info("socket CPU availability", "socketID", socketID, "socketCPUs", socketCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
-		} else { // numanode
-			numaNodeID, ok := cp.deviceNameToNUMANodeID[alloc.Device]
-			if !ok {
-				return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid NUMA node ID found for device %s", alloc.Device)}
+			claimFullCores = true
+		}
+		deviceName := cp.resolveDeviceName(logger, alloc.Device)
+
+		var deviceCPUs, availableCPUsForDevice cpuset.CPUSet
+		if pool, ok := cp.deviceNameToCPUPool[deviceName]; ok {
+			deviceCPUs = cp.cpuPools[pool]
+			availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(deviceCPUs)
+			logger.V(4).Info("CPU pool availability", "cpuPool", pool, "poolCPUs", deviceCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+		} else if numaNodeID, ok := cp.deviceNameToNUMANodeID[deviceName]; ok && cp.usesSocketNUMAPartitions() {
+			deviceCPUs = topo.CPUDetails.CPUsInNUMANodes(numaNodeID)
+			availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(deviceCPUs)
+			logger.V(4).Info("NUMA partition CPU availability", "numaNodeID", numaNodeID, "numaCPUs", deviceCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+		} else {
+			switch cp.cpuDeviceGroupBy {
+			case GROUP_BY_SOCKET:
+				socketID, ok := cp.deviceNameToSocketID[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid socket ID found for device %s", alloc.Device)}
+				}
+				socketCPUs := topo.CPUDetails.CPUsInSockets(socketID)
+				deviceCPUs = socketCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(socketCPUs)
+				logger.V(4).Info("socket CPU availability", "socketID", socketID, "socketCPUs", socketCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			case GROUP_BY_DIE:
+				die, ok := cp.deviceNameToDie[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid die found for device %s", alloc.Device)}
+				}
+				dieCPUs := topo.CPUDetails.CPUsInDie(die.socketID, die.dieID)
+				deviceCPUs = dieCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(dieCPUs)
+				logger.V(4).Info("die CPU availability", "socketID", die.socketID, "dieID", die.dieID, "dieCPUs", dieCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			case GROUP_BY_CLUSTER:
+				cluster, ok := cp.deviceNameToCluster[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid cluster found for device %s", alloc.Device)}
+				}
+				clusterCPUs := topo.CPUDetails.CPUsInCluster(cluster.socketID, cluster.clusterID)
+				deviceCPUs = clusterCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(clusterCPUs)
+				logger.V(4).Info("cluster CPU availability", "socketID", cluster.socketID, "clusterID", cluster.clusterID, "clusterCPUs", clusterCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			case GROUP_BY_L3:
+				uncoreCacheID, ok := cp.deviceNameToUncoreCache[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid uncore cache found for device %s", alloc.Device)}
+				}
+				uncoreCacheCPUs := topo.CPUDetails.CPUsInUncoreCaches(uncoreCacheID)
+				deviceCPUs = uncoreCacheCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(uncoreCacheCPUs)
+				logger.V(4).Info("uncore cache CPU availability", "uncoreCacheID", uncoreCacheID, "uncoreCacheCPUs", uncoreCacheCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			case GROUP_BY_CCD:
+				ccdID, ok := cp.deviceNameToCCD[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid CCD found for device %s", alloc.Device)}
+				}
+				ccdCPUs := topo.CPUDetails.CPUsInCCDs(ccdID)
+				deviceCPUs = ccdCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(ccdCPUs)
+				logger.V(4).Info("CCD CPU availability", "ccdID", ccdID, "ccdCPUs", ccdCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			case GROUP_BY_CORE:
+				core, ok := cp.deviceNameToCore[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid core found for device %s", alloc.Device)}
+				}
+				coreCPUs := cpusInCore(topo, core)
+				deviceCPUs = coreCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(coreCPUs)
+				logger.V(4).Info("core CPU availability", "socketID", core.socketID, "coreID", core.coreID, "coreCPUs", coreCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			default: // numanode
+				numaNodeID, ok := cp.deviceNameToNUMANodeID[deviceName]
+				if !ok {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("no valid NUMA node ID found for device %s", alloc.Device)}
+				}
+				numaCPUs := topo.CPUDetails.CPUsInNUMANodes(numaNodeID)
+				deviceCPUs = numaCPUs
+				availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(numaCPUs)
+				logger.V(4).Info("NUMA node CPU availability", "numaNodeID", numaNodeID, "numaCPUs", numaCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+			}
+			if len(cp.cpuPools) > 0 {
+				// the CPUs of the pools are available through the devices of the pools only.
+				deviceCPUs = deviceCPUs.Difference(cp.pooledCPUs())
+				availableCPUsForDevice = availableCPUsForDevice.Intersection(deviceCPUs)
 			}
-			numaCPUs := topo.CPUDetails.CPUsInNUMANodes(numaNodeID)
-			availableCPUsForDevice = sharedCPUs.Difference(cpuAssignment).Intersection(numaCPUs)
-			logger.V(4).Info("NUMA node CPU availability", "numaNodeID", numaNodeID, "numaCPUs", numaCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
+		}
+		if len(cp.cpuTiers) > 0 {
+			// the CPUs of the group are split among the devices of the tiers.
+			deviceCPUs = cp.cpuTierCPUsOfDevice(deviceName, deviceCPUs)
+			availableCPUsForDevice = availableCPUsForDevice.Intersection(deviceCPUs)
+			logger.V(4).Info("CPU tier availability", "cpuTier", cp.deviceNameToCPUTier[deviceName], "deviceCPUs", deviceCPUs.String(), "availableCPUs", availableCPUsForDevice.String())
 		}
 
-		cur, err := cpumanager.TakeByTopologyNUMAPacked(logger, topo, availableCPUsForDevice, int(claimCPUCount), cpumanager.CPUSortingStrategyPacked, true)
+		deviceConfig, err := cp.deviceConfigForRequest(claim, alloc.Request)
 		if err != nil {
 			return kubeletplugin.PrepareResult{Err: err}
 		}
+		strategy, err := cp.allocationStrategyFor(alloc.Request, deviceConfig)
+		if err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if err := validateNUMANodeConfig(alloc.Request, deviceConfig); err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if err := validateProfileConfig(alloc.Request, deviceConfig); err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if deviceConfig.SystemCPUs > 0 {
+			cur, err := cp.takeSystemCPUs(logger, claim, alloc.Device, deviceCPUs, systemAssignment, claimCPUCount, deviceConfig.SystemCPUs)
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+			systemAssignment = systemAssignment.Union(cur)
+			logger.V(2).Info("reserved CPU assignment for device", "device", alloc.Device, "assigned", cur.String(), "allAssigned", systemAssignment.String())
+			continue
+		}
+		if claimMilliCPUs > 0 && !deviceConfig.AllCPUs {
+			// a fraction of the CPUs is not pinned: the containers run on the shared CPUs of the device.
+			fractional.MilliCPUs += claimMilliCPUs
+			fractional.CPUs = fractional.CPUs.Union(deviceCPUs.Difference(cp.reservedCPUs))
+			logger.V(2).Info("fractional CPU assignment for device", "device", alloc.Device, "milliCPUs", claimMilliCPUs, "deviceCPUs", deviceCPUs.String())
+			continue
+		}
+		if claimCPUCount == 0 && !deviceConfig.AllCPUs {
+			switch cp.zeroCapacityPolicy {
+			case ZERO_CAPACITY_POLICY_ERROR:
+				return kubeletplugin.PrepareResult{Err: fmt.Errorf("device %s allocated without consumed CPU capacity", alloc.Device)}
+			case ZERO_CAPACITY_POLICY_ONE_CPU:
+				logger.V(2).Info("device allocated without consumed CPU capacity, assigning one CPU", "device", alloc.Device)
+				claimCPUCount = 1
+			default:
+				logger.V(2).Info("device allocated without consumed CPU capacity, granting access to the shared CPUs only", "device", alloc.Device)
+				sharedDevices++
+				continue
+			}
+		}
+		// Consuming the full published capacity of the device is the same as asking for all its CPUs.
+		allocatableCPUs := deviceCPUs.Difference(cp.reservedCPUs)
+		// the CPUs sharing an isolation domain with the claims of other tiers are not available to this claim.
+		if overlap := availableCPUsForDevice.Intersection(isolatedCPUs); !overlap.IsEmpty() {
+			logger.V(4).Info("CPUs excluded by the isolation of other tiers", "tier", tier, "conflictingTiers", conflictingTiers, "cpus", overlap.String())
+			availableCPUsForDevice = availableCPUsForDevice.Difference(isolatedCPUs)
+		}
+		wholeDevice := deviceConfig.AllCPUs || claimCPUCount == int64(allocatableCPUs.Size())
+		if !wholeDevice {
+			neededCPUs := int(claimCPUCount)
+			if claimCoreCount > 0 {
+				neededCPUs = int(claimCoreCount) * topo.CPUsPerCore()
+			} else if fullPCPUsOnly || requireFullCores || cp.usesSMTIsolation() {
+				neededCPUs = (neededCPUs + topo.CPUsPerCore() - 1) / topo.CPUsPerCore() * topo.CPUsPerCore()
+			}
+			availableCPUsForDevice, err = cp.filterByNUMANode(logger, alloc.Device, deviceConfig, availableCPUsForDevice, neededCPUs)
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+			availableCPUsForDevice, err = cp.filterByCoreType(alloc.Device, deviceConfig, availableCPUsForDevice, neededCPUs)
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+			if l3AntiAffinity {
+				availableCPUsForDevice = preferL3AntiAffinity(logger, alloc.Device, availableCPUsForDevice, sharedL3CPUs, neededCPUs)
+			}
+		}
+		var cur cpuset.CPUSet
+		if wholeDevice {
+			if err := cp.checkRequiredNUMANode(alloc.Device, deviceConfig, allocatableCPUs); err != nil {
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+			if err := cp.checkCoreType(alloc.Device, deviceConfig, allocatableCPUs); err != nil {
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+			cur, err = takeWholeDevice(alloc.Device, allocatableCPUs, availableCPUsForDevice, claimCPUCount)
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: cp.isolationError(err, tier, conflictingTiers, deviceCPUs, isolatedCPUs)}
+			}
+			// the reserved CPUs may break the cores of the device.
+			if fullPCPUsOnly || requireFullCores {
+				if err := cp.checkFullPCPUs(claim, cur); err != nil {
+					return kubeletplugin.PrepareResult{Err: err}
+				}
+			}
+			logger.V(2).Info("device fully consumed", "device", alloc.Device, "cpus", cur.String())
+		} else if claimCoreCount > 0 {
+			cur, err = cp.takeFullCores(logger, alloc.Device, availableCPUsForDevice, int(claimCoreCount))
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: cp.isolationError(err, tier, conflictingTiers, deviceCPUs, isolatedCPUs)}
+			}
+			logger.V(2).Info("full cores assigned", "device", alloc.Device, "numCores", claimCoreCount, "cpus", cur.String())
+		} else if fullPCPUsOnly || requireFullCores || cp.usesSMTIsolation() {
+			cpusPerCore := int64(topo.CPUsPerCore())
+			numCores := claimCPUCount / cpusPerCore
+			if claimCPUCount%cpusPerCore != 0 {
+				if fullPCPUsOnly && !requireFullCores {
+					return kubeletplugin.PrepareResult{Err: fmt.Errorf("claim %s/%s requires whole physical cores, but requests %d CPUs of device %s, not a multiple of the %d threads of a core", claim.Namespace, claim.Name, claimCPUCount, alloc.Device, cpusPerCore)}
+				}
+				// the allocation is padded with the siblings, which no other claim may get.
+				numCores++
+				logger.V(2).Info("allocation padded to whole physical cores", "device", alloc.Device, "requestedCPUs", claimCPUCount, "numCores", numCores)
+			}
+			cur, err = cp.takeFullCores(logger, alloc.Device, availableCPUsForDevice, int(numCores))
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: cp.isolationError(err, tier, conflictingTiers, deviceCPUs, isolatedCPUs)}
+			}
+			logger.V(2).Info("whole physical cores assigned", "device", alloc.Device, "cpus", cur.String())
+		} else if small, ok := cp.takeSmallClaim(availableCPUsForDevice, int(claimCPUCount), strategy); ok {
+			cur = small
+			logger.V(4).Info("CPUs assigned from the free lists", "device", alloc.Device, "cpus", cur.String())
+		} else {
+			cur, err = cp.takeByAllocationPolicy(logger, topo, availableCPUsForDevice, int(claimCPUCount), strategy)
+			if err != nil {
+				return kubeletplugin.PrepareResult{Err: cp.isolationError(err, tier, conflictingTiers, deviceCPUs, isolatedCPUs)}
+			}
+			warnIfFragmented(logger, topo, availableCPUsForDevice, int(claimCPUCount), cur)
+		}
 		cpuAssignment = cpuAssignment.Union(cur)
 		logger.V(2).Info("CPU assignment for device", "device", alloc.Device, "assigned", cur.String(), "allAssigned", cpuAssignment.String())
 	}
 
-	if cpuAssignment.Size() == 0 {
+	systemClaim := !systemAssignment.IsEmpty()
+	fractionalClaim := fractional.MilliCPUs > 0
+	if systemClaim && (cpuAssignment.Size() > 0 || sharedDevices > 0 || fractionalClaim) {
+		return kubeletplugin.PrepareResult{Err: fmt.Errorf("claim %s/%s mixes requests of reserved CPUs with requests of other CPUs", claim.Namespace, claim.Name)}
+	}
+	if fractionalClaim && cpuAssignment.Size() > 0 {
+		return kubeletplugin.PrepareResult{Err: fmt.Errorf("claim %s/%s mixes requests of a fraction of the CPUs with requests of whole CPUs", claim.Namespace, claim.Name)}
+	}
+	if cpuAssignment.Size() == 0 && sharedDevices == 0 && !systemClaim && !fractionalClaim {
 		logger.V(6).Info("claim has no CPU allocations for this driver")
 		return kubeletplugin.PrepareResult{}
 	}
 
-	cp.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, cpuAssignment)
+	var cdiDeviceIDs []string
+	if systemClaim {
+		// the system claims run on the reserved CPUs, outside of the allocations of the shared CPUs.
+		cp.cpuAllocationStore.AddSystemClaimAllocation(logger, claim.UID, systemAssignment)
+		cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, traceID)
 
-	deviceName := getCDIDeviceName(claim.UID)
-	envVar := fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claim.UID, cpuAssignment.String())
-	if err := cp.cdiMgr.AddDevice(logger, deviceName, envVar); err != nil {
-		return kubeletplugin.PrepareResult{Err: err}
+		cdiDeviceIDs, err = cp.exposeClaimAllocation(ctx, logger, claim, systemAssignment, traceID)
+		if err != nil {
+			cp.rollbackClaimPreparation(logger, claim.UID)
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		cp.recordPreparedResult(claim, cdiDeviceIDs)
+	} else if cpuAssignment.Size() > 0 {
+		cp.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, cpuAssignment)
+		cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, traceID)
+		cp.cpuAllocationStore.SetResourceClaimFullCores(claim.UID, claimFullCores)
+		cp.setClaimTier(claim.UID, tier)
+		if l3AntiAffinity {
+			cp.reportL3AntiAffinity(logger, claim, cpuAssignment, sharedL3CPUs)
+		}
+		cp.updateAllocationMetrics(logger)
+		cp.republishFullCores()
+		if err := cp.revokeBorrowedCPUs(logger, cpuAssignment); err != nil {
+			cp.rollbackClaimPreparation(logger, claim.UID)
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if tuning != nil {
+			if err := cp.tuner.apply(logger, claim.UID, cpuAssignment, *tuning); err != nil {
+				cp.rollbackClaimPreparation(logger, claim.UID)
+				return kubeletplugin.PrepareResult{Err: err}
+			}
+		}
+
+		cdiDeviceIDs, err = cp.exposeClaimAllocation(ctx, logger, claim, cpuAssignment, traceID)
+		if err != nil {
+			cp.rollbackClaimPreparation(logger, claim.UID)
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		cp.recordPreparedResult(claim, cdiDeviceIDs)
+	} else if fractionalClaim {
+		cdiDeviceIDs, err = cp.prepareFractionalClaim(logger, claim, fractional, traceID)
+		if err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		cp.recordPreparedResult(claim, cdiDeviceIDs)
+	} else {
+		// nothing to pin: the containers consuming the claim run on the shared CPUs.
+		logger.V(2).Info("claim prepared with access to the shared CPUs only", "devices", sharedDevices)
 	}
 
-	qualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, deviceName)
-	logger.V(6).Info("prepared CDI device", "cdiDeviceName", deviceName, "envVar", envVar, "qualifiedName", qualifiedName)
 	preparedDevices := []kubeletplugin.Device{}
 	for _, allocResult := range claim.Status.Allocation.Devices.Results {
 		if allocResult.Driver != cp.driverName {
@@ -416,7 +1087,7 @@ func (cp *CPUDriver) prepareGroupedResourceClaim(logger logr.Logger, claim *reso
 		preparedDevice := kubeletplugin.Device{
 			PoolName:     allocResult.Pool,
 			DeviceName:   allocResult.Device,
-			CDIDeviceIDs: []string{qualifiedName},
+			CDIDeviceIDs: cdiDeviceIDs,
 			Requests:     []string{allocResult.Request},
 		}
 		preparedDevices = append(preparedDevices, preparedDevice)
@@ -428,7 +1099,7 @@ func (cp *CPUDriver) prepareGroupedResourceClaim(logger logr.Logger, claim *reso
 	}
 }
 
-func (cp *CPUDriver) prepareResourceClaim(logger logr.Logger, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
+func (cp *CPUDriver) prepareResourceClaim(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, traceID string) kubeletplugin.PrepareResult {
 	logger.V(4).Info("preparing individual resource claim")
 
 	if claim.Status.Allocation == nil {
@@ -442,12 +1113,23 @@ func (cp *CPUDriver) prepareResourceClaim(logger logr.Logger, claim *resourceapi
 		if alloc.Driver != cp.driverName {
 			continue
 		}
-		cpuID, ok := cp.deviceNameToCPUID[alloc.Device]
+		cpuID, ok := cp.deviceNameToCPUID[cp.resolveDeviceName(logger, alloc.Device)]
 		if !ok {
 			return kubeletplugin.PrepareResult{
 				Err: fmt.Errorf("device %q not found in device to CPU ID map", alloc.Device),
 			}
 		}
+		// the scheduler picks the individual devices: their core type can only be checked.
+		deviceConfig, err := cp.deviceConfigForRequest(claim, alloc.Request)
+		if err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if err := validateProfileConfig(alloc.Request, deviceConfig); err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+		if err := cp.checkCoreType(alloc.Device, deviceConfig, cpuset.New(cpuID)); err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
 		claimCPUIDs = append(claimCPUIDs, cpuID)
 	}
 
@@ -464,16 +1146,62 @@ func (cp *CPUDriver) prepareResourceClaim(logger logr.Logger, claim *resourceapi
 			Err: fmt.Errorf("claim %s/%s has overlapping device assignment with other claims", claim.Namespace, claim.Name),
 		}
 	}
+	// the scheduler doesn't know about the cores: the individual devices it picked may break them.
+	fullPCPUsOnly, err := cp.claimUsesFullPCPUsOnly(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	if fullPCPUsOnly {
+		if err := cp.checkFullPCPUs(claim, claimCPUSet); err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+	}
+	requireFullCores, err := cp.claimRequiresFullCores(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	tuning, err := cp.claimTuning(claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	if cp.usesSMTIsolation() || requireFullCores {
+		// the siblings of the individual devices join the claim, so no other claim can be prepared on them.
+		claimCPUSet, err = cp.padToFullCores(claim, claimCPUSet, sharedCPUs)
+		if err != nil {
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+	}
+	// the scheduler doesn't know about the tiers: the individual devices it picked may break the isolation.
+	tier, err := cp.claimTier(ctx, logger, claim)
+	if err != nil {
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	if err := cp.checkIsolation(tier, claimCPUSet); err != nil {
+		isolationConflicts.Inc()
+		return kubeletplugin.PrepareResult{Err: err}
+	}
 
 	cp.cpuAllocationStore.AddResourceClaimAllocation(logger, claim.UID, claimCPUSet)
-	deviceName := getCDIDeviceName(claim.UID)
-	envVar := fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claim.UID, claimCPUSet.String())
-	if err := cp.cdiMgr.AddDevice(logger, deviceName, envVar); err != nil {
+	cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, traceID)
+	cp.setClaimTier(claim.UID, tier)
+	cp.updateAllocationMetrics(logger)
+	if err := cp.revokeBorrowedCPUs(logger, claimCPUSet); err != nil {
+		cp.rollbackClaimPreparation(logger, claim.UID)
 		return kubeletplugin.PrepareResult{Err: err}
 	}
+	if tuning != nil {
+		if err := cp.tuner.apply(logger, claim.UID, claimCPUSet, *tuning); err != nil {
+			cp.rollbackClaimPreparation(logger, claim.UID)
+			return kubeletplugin.PrepareResult{Err: err}
+		}
+	}
+	cdiDeviceIDs, err := cp.exposeClaimAllocation(ctx, logger, claim, claimCPUSet, traceID)
+	if err != nil {
+		cp.rollbackClaimPreparation(logger, claim.UID)
+		return kubeletplugin.PrepareResult{Err: err}
+	}
+	cp.recordPreparedResult(claim, cdiDeviceIDs)
 
-	qualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, deviceName)
-	logger.V(6).Info("prepared CDI device", "cdiDeviceName", deviceName, "envVar", envVar, "qualifiedName", qualifiedName)
 	preparedDevices := []kubeletplugin.Device{}
 	for _, allocResult := range claim.Status.Allocation.Devices.Results {
 		if allocResult.Driver != cp.driverName {
@@ -482,7 +1210,8 @@ func (cp *CPUDriver) prepareResourceClaim(logger logr.Logger, claim *resourceapi
 		preparedDevice := kubeletplugin.Device{
 			PoolName:     allocResult.Pool,
 			DeviceName:   allocResult.Device,
-			CDIDeviceIDs: []string{qualifiedName},
+			CDIDeviceIDs: cdiDeviceIDs,
+			Requests:     []string{allocResult.Request},
 		}
 		preparedDevices = append(preparedDevices, preparedDevice)
 	}
@@ -508,8 +1237,13 @@ func (cp *CPUDriver) UnprepareResourceClaims(ctx context.Context, claims []kubel
 
 	for _, claim := range claims {
 		// note kubeletplugin.NamespacedObject doesn't implement KMetadata
-		cLogger := logger.WithValues("claim", claim.String(), "claimUID", claim.UID)
+		cLogger := logger.WithValues("claim", claim.String(), "claimUID", claim.UID, "traceID", cp.cpuAllocationStore.GetResourceClaimTraceID(claim.UID))
 		cLogger.V(2).Info("unpreparing resource claim")
+		if cp.faults.dropUnprepare() {
+			cLogger.Info("injected fault: dropping the unprepare of the claim")
+			result[claim.UID] = nil
+			continue
+		}
 		err := cp.unprepareResourceClaim(cLogger, claim)
 		result[claim.UID] = err
 		if err != nil {
@@ -519,12 +1253,222 @@ func (cp *CPUDriver) UnprepareResourceClaims(ctx context.Context, claims []kubel
 	return result, nil
 }
 
+// exposeClaimAllocation makes the CPUs assigned to a claim discoverable by the NRI hooks
+// and returns the CDI device IDs to report back to the kubelet, if any.
+func (cp *CPUDriver) exposeClaimAllocation(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim, cpus cpuset.CPUSet, traceID string) ([]string, error) {
+	cpuQuotaDisabled, err := cp.claimDisablesCPUQuota(claim)
+	if err != nil {
+		return nil, err
+	}
+	cp.cpuAllocationStore.SetResourceClaimCPUQuotaDisabled(claim.UID, cpuQuotaDisabled)
+	numaBalancingDisabled, err := cp.claimDisablesNUMABalancing(claim)
+	if err != nil {
+		return nil, err
+	}
+	cp.cpuAllocationStore.SetResourceClaimNUMABalancingDisabled(claim.UID, numaBalancingDisabled)
+	borrowIdleCPUs, err := cp.claimBorrowsIdleCPUs(claim)
+	if err != nil {
+		return nil, err
+	}
+	cp.cpuAllocationStore.SetResourceClaimBorrowing(claim.UID, borrowIdleCPUs)
+	podLevelPinning, err := cp.claimUsesPodLevelPinning(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if podLevelPinning {
+		// the containers not consuming the claim get no CDI device: we remember all the containers of its pods.
+		containersByPodUID, err := cp.claimPodContainers(ctx, claim)
+		if err != nil {
+			return nil, err
+		}
+		if err := cp.podClaims.Set(claim.UID, cpus, containersByPodUID); err != nil {
+			return nil, err
+		}
+		logger.V(6).Info("claim allocation pinned at the pod level", "cpus", cpus.String(), "containers", containersByPodUID)
+		if cp.nriOnly {
+			return nil, nil
+		}
+	} else if cp.nriOnly {
+		// NRI-only mode: we can't inject the allocation in the container environment,
+		// so we remember which containers of which pods consume the claim.
+		containersByPodUID, err := cp.claimContainers(ctx, claim)
+		if err != nil {
+			return nil, err
+		}
+		if err := cp.podClaims.Set(claim.UID, cpus, containersByPodUID); err != nil {
+			return nil, err
+		}
+		logger.V(6).Info("CDI disabled, claim allocation enforced by NRI only", "cpus", cpus.String(), "containers", containersByPodUID)
+		return nil, nil
+	}
+
+	var opts []cdiDeviceOption
+	if annotations := cp.passthroughAnnotations(ctx, logger, claim); len(annotations) > 0 {
+		if cp.cdiPassthroughTarget == CDI_PASSTHROUGH_ENV {
+			opts = append(opts, withCDIEnv(annotationEnvVars(claim.UID, annotations)...))
+		} else {
+			opts = append(opts, withCDIAnnotations(annotations))
+		}
+	}
+	opts = append(opts,
+		withCDIAnnotations(map[string]string{traceIDAnnotation: traceID}),
+		withCDIEnv(traceIDEnvVar(claim.UID, traceID)),
+	)
+	if cpuQuotaDisabled {
+		opts = append(opts, withCDIEnv(cpuQuotaDisabledEnvVar(claim.UID)))
+	}
+	if numaBalancingDisabled {
+		opts = append(opts, withCDIEnv(numaBalancingDisabledEnvVar(claim.UID)))
+	}
+	if borrowIdleCPUs {
+		opts = append(opts, withCDIEnv(borrowIdleCPUsEnvVar(claim.UID)))
+	}
+	if cp.cpuAllocationStore.IsResourceClaimFullCores(claim.UID) {
+		opts = append(opts, withCDIEnv(fullCoresEnvVar(claim.UID)))
+	}
+
+	deviceName := getCDIDeviceName(claim.UID)
+	envVar := fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claim.UID, cpus.String())
+	if err := cp.cdiMgr.AddDevice(logger, deviceName, envVar, opts...); err != nil {
+		return nil, err
+	}
+
+	qualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, deviceName)
+	logger.V(6).Info("prepared CDI device", "cdiDeviceName", deviceName, "envVar", envVar, "qualifiedName", qualifiedName)
+	return []string{qualifiedName}, nil
+}
+
+// podReadTimeout bounds the time spent reading the pods a claim is reserved for.
+const podReadTimeout = 5 * time.Second
+
+// passthroughAnnotations collects the allow-listed annotations of the claim and of the pods
+// the claim is reserved for. Claim annotations take precedence over pod annotations.
+func (cp *CPUDriver) passthroughAnnotations(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim) map[string]string {
+	if len(cp.cdiPassthroughAnnotations) == 0 {
+		return nil
+	}
+	annotations := make(map[string]string)
+	if cp.kubeClient != nil {
+		// the pods are read once per Prepare: don't let a slow API server stall the kubelet.
+		ctx, cancel := context.WithTimeout(ctx, podReadTimeout)
+		defer cancel()
+		for _, consumer := range claim.Status.ReservedFor {
+			if consumer.Resource != "pods" {
+				continue
+			}
+			pod, err := cp.getConsumerPod(ctx, claim.Namespace, consumer)
+			if err != nil {
+				// not critical: the annotations are hints for downstream runtime hooks.
+				logger.Info("cannot read pod annotations for passthrough", "pod", consumer.Name, "err", err)
+				continue
+			}
+			copyAllowedAnnotations(annotations, pod.Annotations, cp.cdiPassthroughAnnotations)
+		}
+	}
+	copyAllowedAnnotations(annotations, claim.Annotations, cp.cdiPassthroughAnnotations)
+	return annotations
+}
+
+// claimContainers returns the names of the containers consuming the claim, by pod UID.
+// Unlike the passthrough, a pod which can't be read fails the Prepare: pinning all its
+// containers would be wrong, and the kubelet retries anyway.
+func (cp *CPUDriver) claimContainers(ctx context.Context, claim *resourceapi.ResourceClaim) (map[types.UID][]string, error) {
+	containersByPodUID := make(map[types.UID][]string)
+	ctx, cancel := context.WithTimeout(ctx, podReadTimeout)
+	defer cancel()
+	for _, consumer := range claim.Status.ReservedFor {
+		if consumer.Resource != "pods" {
+			continue
+		}
+		if cp.kubeClient == nil {
+			return nil, fmt.Errorf("cannot read pod %s/%s: no API client", claim.Namespace, consumer.Name)
+		}
+		pod, err := cp.getConsumerPod(ctx, claim.Namespace, consumer)
+		if err != nil {
+			return nil, err
+		}
+		containersByPodUID[consumer.UID] = podClaimContainers(pod, claim.Name)
+	}
+	return containersByPodUID, nil
+}
+
+// getConsumerPod reads the pod a claim is reserved for, checking it is still the same pod.
+func (cp *CPUDriver) getConsumerPod(ctx context.Context, namespace string, consumer resourceapi.ResourceClaimConsumerReference) (*corev1.Pod, error) {
+	pod, err := cp.kubeClient.CoreV1().Pods(namespace).Get(ctx, consumer.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pod %s/%s: %w", namespace, consumer.Name, err)
+	}
+	if pod.UID != consumer.UID {
+		return nil, fmt.Errorf("pod %s/%s has UID %s, the claim is reserved for %s", namespace, consumer.Name, pod.UID, consumer.UID)
+	}
+	return pod, nil
+}
+
+// podClaimContainers returns the names of the containers of the pod which reference the claim in their resources.
+// The pod refers to the claim by name, directly or through the status of the claims generated from a template.
+func podClaimContainers(pod *corev1.Pod, claimName string) []string {
+	podClaimNames := sets.New[string]()
+	for _, podClaim := range pod.Spec.ResourceClaims {
+		name := ptr.Deref(podClaim.ResourceClaimName, "")
+		for _, status := range pod.Status.ResourceClaimStatuses {
+			if name == "" && status.Name == podClaim.Name {
+				name = ptr.Deref(status.ResourceClaimName, "")
+			}
+		}
+		if name == claimName {
+			podClaimNames.Insert(podClaim.Name)
+		}
+	}
+	var containers []string
+	for _, ctr := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		if slices.ContainsFunc(ctr.Resources.Claims, func(ref corev1.ResourceClaim) bool { return podClaimNames.Has(ref.Name) }) {
+			containers = append(containers, ctr.Name)
+		}
+	}
+	return containers
+}
+
+func copyAllowedAnnotations(dst, src map[string]string, allowed []string) {
+	for _, key := range allowed {
+		if value, ok := src[key]; ok {
+			dst[key] = value
+		}
+	}
+}
+
 func (cp *CPUDriver) unprepareResourceClaim(logger logr.Logger, claim kubeletplugin.NamespacedObject) error {
+	cp.claimStatus.forget(claim.UID)
+	cp.revertClaimTuning(logger, claim.UID)
 	cp.cpuAllocationStore.RemoveResourceClaimAllocation(logger, claim.UID)
+	cp.forgetClaimTier(claim.UID)
+	cp.updateAllocationMetrics(logger)
+	cp.republishFullCores()
+	if cp.podClaims != nil {
+		if err := cp.podClaims.RemoveClaim(claim.UID); err != nil {
+			return err
+		}
+	}
+	if cp.nriOnly {
+		return nil
+	}
 	// Remove the device from the CDI spec file using the manager.
 	return cp.cdiMgr.RemoveDevice(logger, getCDIDeviceName(claim.UID))
 }
 
+// rollbackClaimPreparation undoes a preparation which failed after the claim allocation was recorded,
+// so the kubelet retry finds the CPUs free and prepares the claim from scratch.
+func (cp *CPUDriver) rollbackClaimPreparation(logger logr.Logger, claimUID types.UID) {
+	cp.revertClaimTuning(logger, claimUID)
+	if cp.podClaims != nil {
+		if err := cp.podClaims.RemoveClaim(claimUID); err != nil {
+			logger.Error(err, "failed to forget the containers of the claim")
+		}
+	}
+	cp.forgetClaimTier(claimUID)
+	cp.releaseRevokedClaimAllocation(logger, claimUID)
+}
+
 // HandleError is called by the kubelet plugin framework when an error occurs in the background,
 // for example while publishing ResourceSlices.
 func (cp *CPUDriver) HandleError(ctx context.Context, err error, msg string) {
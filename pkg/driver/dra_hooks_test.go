@@ -27,14 +27,20 @@ import (
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	resourceapi "k8s.io/api/resource/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
 	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
+	cdiSpec "tags.cncf.io/container-device-interface/specs-go"
 )
 
 const (
@@ -59,6 +65,7 @@ func (m *mockKubeletPlugin) Stop() {}
 
 type mockCdiMgr struct {
 	devices     map[string]string
+	specs       map[string]cdiSpec.Device
 	addError    error
 	removeError error
 }
@@ -66,14 +73,25 @@ type mockCdiMgr struct {
 func newMockCdiMgr() *mockCdiMgr {
 	return &mockCdiMgr{
 		devices: make(map[string]string),
+		specs:   make(map[string]cdiSpec.Device),
 	}
 }
 
-func (m *mockCdiMgr) AddDevice(_ logr.Logger, deviceName, envVar string) error {
+func (m *mockCdiMgr) AddDevice(_ logr.Logger, deviceName, envVar string, opts ...cdiDeviceOption) error {
 	if m.addError != nil {
 		return m.addError
 	}
 	m.devices[deviceName] = envVar
+	dev := cdiSpec.Device{
+		Name: deviceName,
+		ContainerEdits: cdiSpec.ContainerEdits{
+			Env: []string{envVar},
+		},
+	}
+	for _, opt := range opts {
+		opt(&dev)
+	}
+	m.specs[deviceName] = dev
 	return nil
 }
 
@@ -117,6 +135,38 @@ var (
 		{CpuID: 6, CoreID: 2, SocketID: 1, NUMANodeID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 2},
 		{CpuID: 7, CoreID: 3, SocketID: 1, NUMANodeID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 3},
 	}
+	// 1 socket, 2 dies with 2 cores/die, HT on. Each die has its own uncore cache.
+	mockCPUInfos_SingleSocket_2Dies_HT = []cpuinfo.CPUInfo{
+		{CpuID: 0, CoreID: 0, SocketID: 0, DieID: 0, NUMANodeID: 0, UncoreCacheID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 4},
+		{CpuID: 1, CoreID: 1, SocketID: 0, DieID: 0, NUMANodeID: 0, UncoreCacheID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 5},
+		{CpuID: 2, CoreID: 2, SocketID: 0, DieID: 1, NUMANodeID: 0, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 6},
+		{CpuID: 3, CoreID: 3, SocketID: 0, DieID: 1, NUMANodeID: 0, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 7},
+		{CpuID: 4, CoreID: 0, SocketID: 0, DieID: 0, NUMANodeID: 0, UncoreCacheID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 0},
+		{CpuID: 5, CoreID: 1, SocketID: 0, DieID: 0, NUMANodeID: 0, UncoreCacheID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 1},
+		{CpuID: 6, CoreID: 2, SocketID: 0, DieID: 1, NUMANodeID: 0, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 2},
+		{CpuID: 7, CoreID: 3, SocketID: 0, DieID: 1, NUMANodeID: 0, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 3},
+	}
+	// 1 socket, 2 clusters with 2 cores/cluster, no SMT, like the arm64 servers. CPU 4 has no known cluster.
+	mockCPUInfos_SingleSocket_2Clusters_ARM = []cpuinfo.CPUInfo{
+		{CpuID: 0, CoreID: 0, SocketID: 0, ClusterID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 1, CoreID: 1, SocketID: 0, ClusterID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 2, CoreID: 2, SocketID: 0, ClusterID: 1, NUMANodeID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 3, CoreID: 3, SocketID: 0, ClusterID: 1, NUMANodeID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 4, CoreID: 4, SocketID: 0, ClusterID: -1, NUMANodeID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+	}
+	// 1 socket, 2 CCDs of 2 CCXs with 2 cores/CCX, no SMT, like the AMD Zen 2 parts: each CCX has its own
+	// uncore cache. CPU 8, of another vendor, has no known CCD.
+	mockCPUInfos_SingleSocket_2CCDs_Zen2 = []cpuinfo.CPUInfo{
+		{CpuID: 0, CoreID: 0, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 0, CCDID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 1, CoreID: 1, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 0, CCDID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 2, CoreID: 4, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 1, CCDID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 3, CoreID: 5, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 1, CCDID: 0, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 4, CoreID: 8, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 2, CCDID: 1, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 5, CoreID: 9, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 2, CCDID: 1, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 6, CoreID: 12, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 3, CCDID: 1, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 7, CoreID: 13, SocketID: 0, NUMANodeID: 0, UncoreCacheID: 3, CCDID: 1, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+		{CpuID: 8, CoreID: 16, SocketID: 0, NUMANodeID: 0, UncoreCacheID: -1, CCDID: -1, CoreType: cpuinfo.CoreTypeStandard, SiblingCPUID: -1},
+	}
 	mockCPUInfos_DualSocket_EqualsResourceSliceLimit = func() []cpuinfo.CPUInfo {
 		var infos []cpuinfo.CPUInfo
 		cpusPerNumaNode := resourceapi.ResourceSliceMaxDevices / 2
@@ -227,6 +277,15 @@ func TestPublishResources(t *testing.T) {
 			expectedDevices:            len(mockCPUInfos_DualSocket_4CPUsPerSocket_HT),
 			expectedDevicesPerNUMANode: map[int]int{0: 4, 1: 4},
 		},
+		{
+			name:                       "single socket, 2 dies, HT on",
+			cpuInfos:                   mockCPUInfos_SingleSocket_2Dies_HT,
+			reservedCPUs:               cpuset.New(),
+			expectPublish:              true,
+			expectedNumSlices:          1,
+			expectedDevices:            len(mockCPUInfos_SingleSocket_2Dies_HT),
+			expectedDevicesPerNUMANode: map[int]int{0: 8},
+		},
 		{
 			name:                       "dual socket, 120 CPUs per socker, HT on",
 			cpuInfos:                   mockCPUInfos_DualSocket_120CPUsPerSocket_HT,
@@ -285,6 +344,26 @@ func TestPublishResources(t *testing.T) {
 			expectedDevices:            len(mockCPUInfos_DualSocket_EqualsResourceSliceLimit),
 			expectedDevicesPerNUMANode: map[int]int{0: resourceapi.ResourceSliceMaxDevices / 2, 1: resourceapi.ResourceSliceMaxDevices / 2},
 		},
+		{
+			name:                       "smaller slices",
+			cpuInfos:                   mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			config:                     Config{ResourceSliceMaxDevices: 3},
+			reservedCPUs:               cpuset.New(),
+			expectPublish:              true,
+			expectedNumSlices:          3,
+			expectedDevices:            len(mockCPUInfos_DualSocket_4CPUsPerSocket_HT),
+			expectedDevicesPerNUMANode: map[int]int{0: 4, 1: 4},
+		},
+		{
+			name:                       "smaller slices grouped by socket",
+			cpuInfos:                   mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			config:                     Config{ResourceSliceMaxDevices: 3, ResourceSliceGrouping: SLICE_GROUPING_SOCKET},
+			reservedCPUs:               cpuset.New(),
+			expectPublish:              true,
+			expectedNumSlices:          4,
+			expectedDevices:            len(mockCPUInfos_DualSocket_4CPUsPerSocket_HT),
+			expectedDevicesPerNUMANode: map[int]int{0: 4, 1: 4},
+		},
 		{
 			name:                       "publish with reserved cpus",
 			cpuInfos:                   mockCPUInfos_SingleSocket_4CPUS_HT,
@@ -318,6 +397,7 @@ func TestPublishResources(t *testing.T) {
 				reservedCPUs:            tc.reservedCPUs,
 				pcieRootMapper:          store.NewPCIeRootMapper(),
 				devicesPerResourceSlice: tc.config.DevicesPerResourceSlice(),
+				sliceGrouping:           tc.config.ResourceSliceGrouping,
 			}
 
 			cp.PublishResources(context.Background())
@@ -373,11 +453,13 @@ func TestPublishResources(t *testing.T) {
 					CacheL3ID := int64(cpuInfo.UncoreCacheID)
 					coreType := cpuInfo.CoreType.String()
 					socketID := int64(cpuInfo.SocketID)
+					dieID := int64(cpuInfo.DieID)
 
 					require.Equal(t, numaNode, *device.Attributes[AttributeNUMANodeID].IntValue)
 					require.Equal(t, CacheL3ID, *device.Attributes[AttributeCacheL3ID].IntValue)
 					require.Equal(t, coreType, *device.Attributes[AttributeCoreType].StringValue)
 					require.Equal(t, socketID, *device.Attributes[AttributeSocketID].IntValue)
+					require.Equal(t, dieID, *device.Attributes[AttributeDieID].IntValue)
 					devicesPerNumaInSlices[cpuInfo.NUMANodeID]++
 				}
 			}
@@ -420,18 +502,245 @@ func TestPublishResources(t *testing.T) {
 	}
 }
 
+func TestCreateGroupedCPUDeviceSlicesByCore(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_2Dies_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	cp := &CPUDriver{
+		cpuTopology:      topo,
+		reservedCPUs:     cpuset.New(0),
+		cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy: GROUP_BY_CORE,
+		pcieRootMapper:   store.NewPCIeRootMapper(),
+	}
+
+	expected := map[string]struct {
+		coreID    int64
+		dieID     int64
+		numCPUs   int64
+		fullCores int64
+	}{
+		// the sibling of the reserved CPU 0 is left alone on its core.
+		"cpudevcore000": {coreID: 0, dieID: 0, numCPUs: 1, fullCores: 0},
+		"cpudevcore001": {coreID: 1, dieID: 0, numCPUs: 2, fullCores: 1},
+		"cpudevcore002": {coreID: 2, dieID: 1, numCPUs: 2, fullCores: 1},
+		"cpudevcore003": {coreID: 3, dieID: 1, numCPUs: 2, fullCores: 1},
+	}
+	var devices []resourceapi.Device
+	for _, chunk := range cp.createGroupedCPUDeviceSlices(logger) {
+		devices = append(devices, chunk...)
+	}
+	require.Len(t, devices, len(expected))
+	for _, device := range devices {
+		want, ok := expected[device.Name]
+		require.True(t, ok, "unexpected device %s", device.Name)
+		require.Equal(t, want.numCPUs, capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+		require.Equal(t, want.fullCores, capacityValue(device, fullCoresResourceQualifiedName), "device %s", device.Name)
+		require.Equal(t, ptr.To(want.coreID), device.Attributes[AttributeCoreID].IntValue, "device %s", device.Name)
+		require.Equal(t, ptr.To(want.dieID), device.Attributes[AttributeDieID].IntValue, "device %s", device.Name)
+		require.Equal(t, ptr.To("p-core"), device.Attributes[AttributeCoreType].StringValue, "device %s", device.Name)
+		require.True(t, *device.AllowMultipleAllocations)
+	}
+}
+
+func TestCreateGroupedCPUDeviceSlicesByCluster(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_2Clusters_ARM}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		reservedCPUs cpuset.CPUSet
+		// expected maps the devices to their cluster ID and number of CPUs.
+		expected map[string][2]int64
+	}{
+		{
+			name:         "no reserved CPUs",
+			reservedCPUs: cpuset.New(),
+			// CPU 4, in no known cluster, is in no device.
+			expected: map[string][2]int64{"cpudevcluster000": {0, 2}, "cpudevcluster001": {1, 2}},
+		},
+		{
+			name:         "reserved cluster keeps the index of the others",
+			reservedCPUs: cpuset.New(0, 1, 2),
+			expected:     map[string][2]int64{"cpudevcluster001": {1, 1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cp := &CPUDriver{
+				cpuTopology:      topo,
+				reservedCPUs:     tc.reservedCPUs,
+				cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy: GROUP_BY_CLUSTER,
+				pcieRootMapper:   store.NewPCIeRootMapper(),
+			}
+			var devices []resourceapi.Device
+			for _, chunk := range cp.createGroupedCPUDeviceSlices(logger) {
+				devices = append(devices, chunk...)
+			}
+			require.Len(t, devices, len(tc.expected))
+			for _, device := range devices {
+				want, ok := tc.expected[device.Name]
+				require.True(t, ok, "unexpected device %s", device.Name)
+				require.Equal(t, ptr.To(want[0]), device.Attributes[AttributeClusterID].IntValue, "device %s", device.Name)
+				require.Equal(t, ptr.To(int64(0)), device.Attributes[AttributeSocketID].IntValue, "device %s", device.Name)
+				require.Equal(t, want[1], capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+				require.True(t, *device.AllowMultipleAllocations)
+			}
+		})
+	}
+}
+
+func TestCreateGroupedCPUDeviceSlicesByCCD(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_2CCDs_Zen2}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		reservedCPUs cpuset.CPUSet
+		// expected maps the devices to their CCD ID and number of CPUs.
+		expected map[string][2]int64
+	}{
+		{
+			name:         "no reserved CPUs",
+			reservedCPUs: cpuset.New(),
+			// the two CCXs of a CCD are in one device, and CPU 8, in no known CCD, is in no device.
+			expected: map[string][2]int64{"cpudevccd000": {0, 4}, "cpudevccd001": {1, 4}},
+		},
+		{
+			name:         "reserved CCD is not published",
+			reservedCPUs: cpuset.New(0, 1, 2, 3, 4),
+			expected:     map[string][2]int64{"cpudevccd001": {1, 3}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cp := &CPUDriver{
+				cpuTopology:      topo,
+				reservedCPUs:     tc.reservedCPUs,
+				cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy: GROUP_BY_CCD,
+				pcieRootMapper:   store.NewPCIeRootMapper(),
+			}
+			var devices []resourceapi.Device
+			for _, chunk := range cp.createGroupedCPUDeviceSlices(logger) {
+				devices = append(devices, chunk...)
+			}
+			require.Len(t, devices, len(tc.expected))
+			for _, device := range devices {
+				want, ok := tc.expected[device.Name]
+				require.True(t, ok, "unexpected device %s", device.Name)
+				require.Equal(t, ptr.To(want[0]), device.Attributes[AttributeCCDID].IntValue, "device %s", device.Name)
+				require.Equal(t, ptr.To(int64(0)), device.Attributes[AttributeSocketID].IntValue, "device %s", device.Name)
+				require.NotContains(t, device.Attributes, AttributeCacheL3ID, "device %s", device.Name)
+				require.Equal(t, want[1], capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+				require.True(t, *device.AllowMultipleAllocations)
+			}
+		})
+	}
+}
+
+func TestPublishResourcesSliceGrouping(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name              string
+		cpuDeviceMode     string
+		sliceGrouping     string
+		expectedNumSlices int
+	}{
+		{name: "individual devices in order", cpuDeviceMode: CPU_DEVICE_MODE_INDIVIDUAL, sliceGrouping: SLICE_GROUPING_NONE, expectedNumSlices: 1},
+		{name: "individual devices by NUMA node", cpuDeviceMode: CPU_DEVICE_MODE_INDIVIDUAL, sliceGrouping: SLICE_GROUPING_NUMA_NODE, expectedNumSlices: 2},
+		{name: "grouped devices in order", cpuDeviceMode: CPU_DEVICE_MODE_GROUPED, sliceGrouping: SLICE_GROUPING_NONE, expectedNumSlices: 1},
+		{name: "grouped devices by socket", cpuDeviceMode: CPU_DEVICE_MODE_GROUPED, sliceGrouping: SLICE_GROUPING_SOCKET, expectedNumSlices: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPlugin := &mockKubeletPlugin{}
+			cp := &CPUDriver{
+				nodeName:                testNodeName,
+				draPlugin:               mockPlugin,
+				cpuTopology:             topo,
+				cpuDeviceMode:           tc.cpuDeviceMode,
+				cpuDeviceGroupBy:        GROUP_BY_NUMA_NODE,
+				reservedCPUs:            cpuset.New(),
+				pcieRootMapper:          store.NewPCIeRootMapper(),
+				devicesPerResourceSlice: Config{}.DevicesPerResourceSlice(),
+				sliceGrouping:           tc.sliceGrouping,
+			}
+			cp.PublishResources(context.Background())
+
+			require.NotNil(t, mockPlugin.publishedResources)
+			pool := mockPlugin.publishedResources.Pools[testNodeName]
+			require.Len(t, pool.Slices, tc.expectedNumSlices)
+			if tc.sliceGrouping == SLICE_GROUPING_NONE {
+				return
+			}
+			// on this topology sockets and NUMA nodes match: each slice has the devices of one of them.
+			for _, slice := range pool.Slices {
+				numaNodes := sets.New[int64]()
+				for _, device := range slice.Devices {
+					numaNodes.Insert(*device.Attributes[AttributeNUMANodeID].IntValue)
+				}
+				require.Equal(t, 1, numaNodes.Len(), "slice mixes NUMA nodes %v", numaNodes.UnsortedList())
+			}
+		})
+	}
+}
+
+func TestPublishResourcesSliceGroupingL3(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_2Dies_HT, func(driver *CPUDriver) {
+		driver.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		driver.devicesPerResourceSlice = Config{}.DevicesPerResourceSlice()
+		driver.sliceGrouping = SLICE_GROUPING_L3
+	})
+	mockPlugin := &mockKubeletPlugin{}
+	driver.draPlugin = mockPlugin
+
+	driver.PublishResources(context.Background())
+
+	require.NotNil(t, mockPlugin.publishedResources)
+	pool := mockPlugin.publishedResources.Pools[testNodeName]
+	// the single NUMA node has 2 L3 caches: each slice has the devices of one of them.
+	require.Len(t, pool.Slices, 2)
+	for _, slice := range pool.Slices {
+		caches := sets.New[int64]()
+		for _, device := range slice.Devices {
+			caches.Insert(*device.Attributes[AttributeCacheL3ID].IntValue)
+		}
+		require.Equal(t, 1, caches.Len(), "slice mixes L3 caches %v", caches.UnsortedList())
+		require.Len(t, slice.Devices, 4)
+	}
+}
+
 func TestInitializeDeviceLookupMaps(t *testing.T) {
 	logger := testr.New(t)
 
 	testCases := []struct {
-		name                       string
-		cpuDeviceMode              string
-		cpuDeviceGroupBy           string
-		cpuInfos                   []cpuinfo.CPUInfo
-		reservedCPUs               cpuset.CPUSet
-		expectedDeviceNameToCPUID  map[string]int
-		expectedDeviceNameToSocket map[string]int
-		expectedDeviceNameToNUMA   map[string]int
+		name                        string
+		cpuDeviceMode               string
+		cpuDeviceGroupBy            string
+		cpuInfos                    []cpuinfo.CPUInfo
+		reservedCPUs                cpuset.CPUSet
+		expectedDeviceNameToCPUID   map[string]int
+		expectedDeviceNameToSocket  map[string]int
+		expectedDeviceNameToNUMA    map[string]int
+		expectedDeviceNameToDie     map[string]dieIdent
+		expectedDeviceNameToCluster map[string]clusterIdent
+		expectedDeviceNameToL3      map[string]int
+		expectedDeviceNameToCCD     map[string]int
+		expectedDeviceNameToCore    map[string]coreIdent
 	}{
 		{
 			name:          "individual mode",
@@ -460,6 +769,50 @@ func TestInitializeDeviceLookupMaps(t *testing.T) {
 			reservedCPUs:             cpuset.New(2, 3, 6, 7),
 			expectedDeviceNameToNUMA: map[string]int{"cpudevnuma000": 0},
 		},
+		{
+			name:                    "grouped by die",
+			cpuDeviceMode:           CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy:        GROUP_BY_DIE,
+			cpuInfos:                mockCPUInfos_SingleSocket_2Dies_HT,
+			reservedCPUs:            cpuset.New(0, 1, 4, 5),
+			expectedDeviceNameToDie: map[string]dieIdent{"cpudevdie001": {socketID: 0, dieID: 1}},
+		},
+		{
+			name:                        "grouped by cluster",
+			cpuDeviceMode:               CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy:            GROUP_BY_CLUSTER,
+			cpuInfos:                    mockCPUInfos_SingleSocket_2Clusters_ARM,
+			reservedCPUs:                cpuset.New(0, 1),
+			expectedDeviceNameToCluster: map[string]clusterIdent{"cpudevcluster001": {socketID: 0, clusterID: 1}},
+		},
+		{
+			name:                   "grouped by l3",
+			cpuDeviceMode:          CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy:       GROUP_BY_L3,
+			cpuInfos:               mockCPUInfos_SingleSocket_2Dies_HT,
+			reservedCPUs:           cpuset.New(0, 1, 4, 5),
+			expectedDeviceNameToL3: map[string]int{"cpudevl3001": 1},
+		},
+		{
+			name:                    "grouped by ccd",
+			cpuDeviceMode:           CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy:        GROUP_BY_CCD,
+			cpuInfos:                mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			reservedCPUs:            cpuset.New(0, 1, 2, 3),
+			expectedDeviceNameToCCD: map[string]int{"cpudevccd001": 1},
+		},
+		{
+			name:             "grouped by core",
+			cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy: GROUP_BY_CORE,
+			cpuInfos:         mockCPUInfos_SingleSocket_2Dies_HT,
+			reservedCPUs:     cpuset.New(0, 1, 4, 5),
+			// the reserved cores keep their index.
+			expectedDeviceNameToCore: map[string]coreIdent{
+				"cpudevcore002": {socketID: 0, coreID: 2},
+				"cpudevcore003": {socketID: 0, coreID: 3},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -485,9 +838,29 @@ func TestInitializeDeviceLookupMaps(t *testing.T) {
 			if tc.expectedDeviceNameToNUMA == nil {
 				tc.expectedDeviceNameToNUMA = map[string]int{}
 			}
+			if tc.expectedDeviceNameToDie == nil {
+				tc.expectedDeviceNameToDie = map[string]dieIdent{}
+			}
+			if tc.expectedDeviceNameToCluster == nil {
+				tc.expectedDeviceNameToCluster = map[string]clusterIdent{}
+			}
+			if tc.expectedDeviceNameToL3 == nil {
+				tc.expectedDeviceNameToL3 = map[string]int{}
+			}
+			if tc.expectedDeviceNameToCCD == nil {
+				tc.expectedDeviceNameToCCD = map[string]int{}
+			}
+			if tc.expectedDeviceNameToCore == nil {
+				tc.expectedDeviceNameToCore = map[string]coreIdent{}
+			}
 			require.Equal(t, tc.expectedDeviceNameToCPUID, cp.deviceNameToCPUID)
 			require.Equal(t, tc.expectedDeviceNameToSocket, cp.deviceNameToSocketID)
 			require.Equal(t, tc.expectedDeviceNameToNUMA, cp.deviceNameToNUMANodeID)
+			require.Equal(t, tc.expectedDeviceNameToDie, cp.deviceNameToDie)
+			require.Equal(t, tc.expectedDeviceNameToCluster, cp.deviceNameToCluster)
+			require.Equal(t, tc.expectedDeviceNameToL3, cp.deviceNameToUncoreCache)
+			require.Equal(t, tc.expectedDeviceNameToCCD, cp.deviceNameToCCD)
+			require.Equal(t, tc.expectedDeviceNameToCore, cp.deviceNameToCore)
 		})
 	}
 }
@@ -507,6 +880,10 @@ func TestPublishResourcesDoesNotInitializeGroupedLookupMaps(t *testing.T) {
 			name:             "numa grouped",
 			cpuDeviceGroupBy: GROUP_BY_NUMA_NODE,
 		},
+		{
+			name:             "die grouped",
+			cpuDeviceGroupBy: GROUP_BY_DIE,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -521,6 +898,7 @@ func TestPublishResourcesDoesNotInitializeGroupedLookupMaps(t *testing.T) {
 				draPlugin:              mockPlugin,
 				deviceNameToSocketID:   make(map[string]int),
 				deviceNameToNUMANodeID: make(map[string]int),
+				deviceNameToDie:        make(map[string]dieIdent),
 				cpuTopology:            topo,
 				cpuDeviceMode:          CPU_DEVICE_MODE_GROUPED,
 				cpuDeviceGroupBy:       tc.cpuDeviceGroupBy,
@@ -533,6 +911,7 @@ func TestPublishResourcesDoesNotInitializeGroupedLookupMaps(t *testing.T) {
 			require.NotNil(t, mockPlugin.publishedResources)
 			require.Empty(t, cp.deviceNameToSocketID)
 			require.Empty(t, cp.deviceNameToNUMANodeID)
+			require.Empty(t, cp.deviceNameToDie)
 		})
 	}
 }
@@ -567,6 +946,18 @@ func TestPrepareResourceClaimsSucceedsBeforePublishResources(t *testing.T) {
 			cpuDeviceGroupBy: GROUP_BY_NUMA_NODE,
 			claim:            testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
 		},
+		{
+			name:             "die grouped",
+			cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy: GROUP_BY_DIE,
+			claim:            testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevdie000": 2}),
+		},
+		{
+			name:             "l3 grouped",
+			cpuDeviceMode:    CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy: GROUP_BY_L3,
+			claim:            testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevl3000": 2}),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -583,6 +974,8 @@ func TestPrepareResourceClaimsSucceedsBeforePublishResources(t *testing.T) {
 				cpuDeviceMode:      tc.cpuDeviceMode,
 				cpuDeviceGroupBy:   tc.cpuDeviceGroupBy,
 				reservedCPUs:       cpuset.New(),
+				podConfigStore:     store.NewPodConfig(),
+				claimTracker:       store.NewClaimTracker(),
 			}
 			driver.initializeDeviceLookupMaps()
 
@@ -610,6 +1003,8 @@ func TestPrepareResourceClaims(t *testing.T) {
 				"cpudev1": 1,
 			},
 			cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+			podConfigStore:     store.NewPodConfig(),
+			claimTracker:       store.NewClaimTracker(),
 		}
 	}
 
@@ -639,8 +1034,8 @@ func TestPrepareResourceClaims(t *testing.T) {
 						Allocation: &resourceapi.AllocationResult{
 							Devices: resourceapi.DeviceAllocationResult{
 								Results: []resourceapi.DeviceRequestAllocationResult{
-									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0"},
-									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev1"},
+									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0", Request: "req-0"},
+									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev1", Request: "req-0"},
 								},
 							},
 						},
@@ -652,8 +1047,8 @@ func TestPrepareResourceClaims(t *testing.T) {
 			expectedCdiDevice:       cdiDeviceName,
 			expectedCdiEnvVar:       fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claimUID, "0-1"),
 			expectedPreparedDevices: []kubeletplugin.Device{
-				{PoolName: testNodeName, DeviceName: "cpudev0", CDIDeviceIDs: []string{cdiQualifiedName}},
-				{PoolName: testNodeName, DeviceName: "cpudev1", CDIDeviceIDs: []string{cdiQualifiedName}},
+				{PoolName: testNodeName, DeviceName: "cpudev0", Requests: []string{"req-0"}, CDIDeviceIDs: []string{cdiQualifiedName}},
+				{PoolName: testNodeName, DeviceName: "cpudev1", Requests: []string{"req-0"}, CDIDeviceIDs: []string{cdiQualifiedName}},
 			},
 		},
 		{
@@ -743,7 +1138,7 @@ func TestPrepareResourceClaims(t *testing.T) {
 						Allocation: &resourceapi.AllocationResult{
 							Devices: resourceapi.DeviceAllocationResult{
 								Results: []resourceapi.DeviceRequestAllocationResult{
-									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0"},
+									{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0", Request: "req-0"},
 									{Driver: "other-driver", Pool: testNodeName, Device: "other-device"},
 								},
 							},
@@ -757,7 +1152,7 @@ func TestPrepareResourceClaims(t *testing.T) {
 			expectedCdiEnvVar:       fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claimUID, "0"),
 			// only our driver's device should appear in preparedDevices
 			expectedPreparedDevices: []kubeletplugin.Device{
-				{PoolName: testNodeName, DeviceName: "cpudev0", CDIDeviceIDs: []string{cdiQualifiedName}},
+				{PoolName: testNodeName, DeviceName: "cpudev0", Requests: []string{"req-0"}, CDIDeviceIDs: []string{cdiQualifiedName}},
 			},
 		},
 		{
@@ -819,6 +1214,179 @@ func TestPrepareResourceClaims(t *testing.T) {
 	}
 }
 
+func TestPrepareResourceClaimsNRIOnly(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-nri-only")
+	podUID := types.UID("pod-nri-only")
+
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_4CPUS_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	// only the containers referencing the claim consume it.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default", UID: podUID},
+		Spec: corev1.PodSpec{
+			ResourceClaims: []corev1.PodResourceClaim{{Name: "cpus", ResourceClaimTemplateName: ptr.To("cpus-template")}},
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers: []corev1.Container{
+				{Name: "app", Resources: corev1.ResourceRequirements{Claims: []corev1.ResourceClaim{{Name: "cpus"}}}},
+				{Name: "sidecar"},
+			},
+		},
+		Status: corev1.PodStatus{
+			ResourceClaimStatuses: []corev1.PodResourceClaimStatus{{Name: "cpus", ResourceClaimName: ptr.To(string(claimUID))}},
+		},
+	}
+
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		kubeClient:         fake.NewClientset(pod),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podClaims:          store.NewPodClaims(),
+		nriOnly:            true,
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+	claim.Namespace = "default"
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{
+		{Resource: "pods", Name: "my-pod", UID: podUID},
+	}
+
+	preparedClaims, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.NoError(t, preparedClaims[claimUID].Err)
+	require.Len(t, preparedClaims[claimUID].Devices, 1)
+	require.Empty(t, preparedClaims[claimUID].Devices[0].CDIDeviceIDs)
+	require.Equal(t, []types.UID{claimUID}, driver.podClaims.Get(podUID, "app"))
+	require.Empty(t, driver.podClaims.Get(podUID, "init"))
+	require.Empty(t, driver.podClaims.Get(podUID, "sidecar"))
+
+	unpreparedClaims, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+	require.NoError(t, err)
+	require.NoError(t, unpreparedClaims[claimUID])
+	require.Empty(t, driver.podClaims.Get(podUID, "app"))
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.False(t, ok)
+}
+
+func TestPrepareResourceClaimsAnnotationPassthrough(t *testing.T) {
+	claimUID := types.UID("claim-passthrough")
+	podUID := types.UID("pod-passthrough")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-pod",
+			Namespace: "default",
+			UID:       podUID,
+			Annotations: map[string]string{
+				"example.com/profile": "from-pod",
+				"example.com/tier":    "gold",
+				"example.com/ignored": "nope",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		allowed      []string
+		target       string
+		expectedSpec func(deviceName, envVar, traceID string) cdiSpec.Device
+	}{
+		{
+			name: "no allow-list only adds the trace ID",
+			expectedSpec: func(deviceName, envVar, traceID string) cdiSpec.Device {
+				return cdiSpec.Device{
+					Name:           deviceName,
+					Annotations:    map[string]string{traceIDAnnotation: traceID},
+					ContainerEdits: cdiSpec.ContainerEdits{Env: []string{envVar, traceIDEnvVar(claimUID, traceID)}},
+				}
+			},
+		},
+		{
+			name:    "annotations target",
+			allowed: []string{"example.com/profile", "example.com/tier", "example.com/missing"},
+			target:  CDI_PASSTHROUGH_ANNOTATIONS,
+			expectedSpec: func(deviceName, envVar, traceID string) cdiSpec.Device {
+				return cdiSpec.Device{
+					Name: deviceName,
+					Annotations: map[string]string{
+						"example.com/profile": "from-claim",
+						"example.com/tier":    "gold",
+						traceIDAnnotation:     traceID,
+					},
+					ContainerEdits: cdiSpec.ContainerEdits{Env: []string{envVar, traceIDEnvVar(claimUID, traceID)}},
+				}
+			},
+		},
+		{
+			name:    "env target",
+			allowed: []string{"example.com/profile", "example.com/tier"},
+			target:  CDI_PASSTHROUGH_ENV,
+			expectedSpec: func(deviceName, envVar, traceID string) cdiSpec.Device {
+				return cdiSpec.Device{
+					Name:        deviceName,
+					Annotations: map[string]string{traceIDAnnotation: traceID},
+					ContainerEdits: cdiSpec.ContainerEdits{Env: []string{
+						envVar,
+						"DRA_CPU_ANNOTATION_claim-passthrough_EXAMPLE_COM_PROFILE=from-claim",
+						"DRA_CPU_ANNOTATION_claim-passthrough_EXAMPLE_COM_TIER=gold",
+						traceIDEnvVar(claimUID, traceID),
+					}},
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_4CPUS_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			cdiMgr := newMockCdiMgr()
+			driver := &CPUDriver{
+				driverName:                testDriverName,
+				kubeClient:                fake.NewClientset(pod),
+				cdiMgr:                    cdiMgr,
+				cpuTopology:               topo,
+				cpuAllocationStore:        store.NewCPUAllocation(topo, cpuset.New()),
+				cpuDeviceMode:             CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy:          GROUP_BY_NUMA_NODE,
+				reservedCPUs:              cpuset.New(),
+				cdiPassthroughAnnotations: tc.allowed,
+				cdiPassthroughTarget:      tc.target,
+				podConfigStore:            store.NewPodConfig(),
+				claimTracker:              store.NewClaimTracker(),
+			}
+			driver.initializeDeviceLookupMaps()
+
+			claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+			claim.Namespace = "default"
+			claim.Annotations = map[string]string{"example.com/profile": "from-claim"}
+			claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{
+				{Resource: "pods", Name: pod.Name, UID: podUID},
+			}
+
+			preparedClaims, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			require.NoError(t, preparedClaims[claimUID].Err)
+
+			deviceName := getCDIDeviceName(claimUID)
+			traceID := driver.cpuAllocationStore.GetResourceClaimTraceID(claimUID)
+			require.Len(t, traceID, traceIDLen)
+			require.Equal(t, tc.expectedSpec(deviceName, cdiMgr.devices[deviceName], traceID), cdiMgr.specs[deviceName])
+		})
+	}
+}
+
 func TestPrepareResourceClaimsGroupedMode(t *testing.T) {
 	logger := testr.New(t)
 
@@ -827,11 +1395,20 @@ func TestPrepareResourceClaimsGroupedMode(t *testing.T) {
 		driver.driverName = testDriverName
 		driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
 		driver.cpuDeviceGroupBy = groupBy
+		driver.reservedCPUs = reservedCPUs
+		driver.preferAlignByUncoreCache = true
 		driver.deviceNameToSocketID = make(map[string]int)
 		driver.deviceNameToNUMANodeID = make(map[string]int)
+		driver.deviceNameToDie = make(map[string]dieIdent)
+		driver.deviceNameToCluster = make(map[string]clusterIdent)
+		driver.deviceNameToUncoreCache = make(map[string]int)
+		driver.deviceNameToCCD = make(map[string]int)
+		driver.deviceNameToCore = make(map[string]coreIdent)
 		mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: cpuInfos}
 		driver.cpuTopology, _ = mockProvider.GetCPUTopology(logger)
 		driver.cpuAllocationStore = store.NewCPUAllocation(driver.cpuTopology, reservedCPUs)
+		driver.podConfigStore = store.NewPodConfig()
+		driver.claimTracker = store.NewClaimTracker()
 		for claimUID, cpus := range initialAllocations {
 			driver.cpuAllocationStore.AddResourceClaimAllocation(logger, claimUID, cpus)
 		}
@@ -848,6 +1425,30 @@ func TestPrepareResourceClaimsGroupedMode(t *testing.T) {
 			for i := 0; i < topo.NumNUMANodes; i++ {
 				driver.deviceNameToNUMANodeID[fmt.Sprintf("%snuma%d", cpuDevicePrefix, i)] = i
 			}
+		case GROUP_BY_DIE:
+			for i, dieID := range topo.CPUDetails.DiesInSockets(0).List() {
+				driver.deviceNameToDie[fmt.Sprintf("%s%d", cpuDeviceDieGroupedPrefix, i)] = dieIdent{socketID: 0, dieID: dieID}
+			}
+		case GROUP_BY_CLUSTER:
+			for _, clusterID := range topo.CPUDetails.ClustersInSockets(0).List() {
+				if clusterID >= 0 {
+					driver.deviceNameToCluster[fmt.Sprintf("%s%d", cpuDeviceClusterGroupedPrefix, clusterID)] = clusterIdent{socketID: 0, clusterID: clusterID}
+				}
+			}
+		case GROUP_BY_L3:
+			for _, uncoreCacheID := range topo.CPUDetails.UncoreCaches().List() {
+				driver.deviceNameToUncoreCache[fmt.Sprintf("%s%d", cpuDeviceL3GroupedPrefix, uncoreCacheID)] = uncoreCacheID
+			}
+		case GROUP_BY_CCD:
+			for _, ccdID := range topo.CPUDetails.CCDs().List() {
+				if ccdID >= 0 {
+					driver.deviceNameToCCD[fmt.Sprintf("%s%d", cpuDeviceCCDGroupedPrefix, ccdID)] = ccdID
+				}
+			}
+		case GROUP_BY_CORE:
+			for _, coreID := range topo.CPUDetails.CoresInSockets(0).List() {
+				driver.deviceNameToCore[fmt.Sprintf("%s%d", cpuDeviceCoreGroupedPrefix, coreID)] = coreIdent{socketID: 0, coreID: coreID}
+			}
 		}
 		return driver
 	}
@@ -918,6 +1519,113 @@ func TestPrepareResourceClaimsGroupedMode(t *testing.T) {
 			expectedCPUSet: cpuset.New(3, 7),
 			expectedError:  false,
 		},
+		{
+			name:     "DieGrouped_SingleSocket2DiesHT_Alloc2CPUFromDie1",
+			cpuInfos: mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:  GROUP_BY_DIE,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevdie1": 2})},
+			// hyperthreads from the same core of die 1 are allocated
+			expectedCPUSet: cpuset.New(2, 6),
+		},
+		{
+			name:          "DieGrouped_SingleSocket2DiesHT_MoreThanAvailable",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:       GROUP_BY_DIE,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevdie0": 5})},
+			expectedError: true,
+		},
+		{
+			name:          "DieGrouped_SingleSocket2DiesHT_DeviceNotFound_Die",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:       GROUP_BY_DIE,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevdie99": 2})},
+			expectedError: true,
+		},
+		{
+			name:     "L3Grouped_SingleSocket2DiesHT_Alloc2CPUFromUncoreCache1",
+			cpuInfos: mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:  GROUP_BY_L3,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevl31": 2})},
+			// hyperthreads from the same core sharing uncore cache 1 are allocated
+			expectedCPUSet: cpuset.New(2, 6),
+		},
+		{
+			name:          "L3Grouped_SingleSocket2DiesHT_MoreThanAvailable",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:       GROUP_BY_L3,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevl30": 5})},
+			expectedError: true,
+		},
+		{
+			name:     "ClusterGrouped_SingleSocket2ClustersARM_Alloc2CPUFromCluster1",
+			cpuInfos: mockCPUInfos_SingleSocket_2Clusters_ARM,
+			groupBy:  GROUP_BY_CLUSTER,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevcluster1": 2})},
+			// both cores of cluster 1 are allocated
+			expectedCPUSet: cpuset.New(2, 3),
+		},
+		{
+			name:          "ClusterGrouped_SingleSocket2ClustersARM_MoreThanAvailable",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Clusters_ARM,
+			groupBy:       GROUP_BY_CLUSTER,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevcluster0": 3})},
+			expectedError: true,
+		},
+		{
+			name:               "CCDGrouped_SingleSocket2CCDsZen2_Alloc2CPUPackedInACCX",
+			cpuInfos:           mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			groupBy:            GROUP_BY_CCD,
+			initialAllocations: map[types.UID]cpuset.CPUSet{"other-claim": cpuset.New(0)},
+			claims:             []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevccd0": 2})},
+			// the free CCX of CCD 0 is allocated rather than the CPUs across its two CCXs.
+			expectedCPUSet: cpuset.New(2, 3),
+		},
+		{
+			name:     "CCDGrouped_SingleSocket2CCDsZen2_AllocWholeCCD",
+			cpuInfos: mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			groupBy:  GROUP_BY_CCD,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevccd1": 4})},
+			// the two CCXs of CCD 1 are allocated.
+			expectedCPUSet: cpuset.New(4, 5, 6, 7),
+		},
+		{
+			name:          "CCDGrouped_SingleSocket2CCDsZen2_NeverSpansCCDs",
+			cpuInfos:      mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			groupBy:       GROUP_BY_CCD,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevccd0": 5})},
+			expectedError: true,
+		},
+		{
+			name:     "CCDGrouped_SingleSocket2CCDsZen2_SpansCCDsWithSeveralDevices",
+			cpuInfos: mockCPUInfos_SingleSocket_2CCDs_Zen2,
+			groupBy:  GROUP_BY_CCD,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevccd0": 4, "cpudevccd1": 1})},
+			// a claim spans several CCDs only by requesting their devices.
+			expectedCPUSet: cpuset.New(0, 1, 2, 3, 4),
+		},
+		{
+			name:     "CoreGrouped_SingleSocket2DiesHT_AllocWholeCore",
+			cpuInfos: mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:  GROUP_BY_CORE,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevcore3": 2})},
+			// both hyperthreads of core 3 are allocated
+			expectedCPUSet: cpuset.New(3, 7),
+		},
+		{
+			name:     "CoreGrouped_SingleSocket2DiesHT_AllocOneThread",
+			cpuInfos: mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:  GROUP_BY_CORE,
+			claims:   []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevcore1": 1})},
+			// a thread of core 1, the other one is left for other claims
+			expectedCPUSet: cpuset.New(1),
+		},
+		{
+			name:          "CoreGrouped_SingleSocket2DiesHT_MoreThanAvailable",
+			cpuInfos:      mockCPUInfos_SingleSocket_2Dies_HT,
+			groupBy:       GROUP_BY_CORE,
+			claims:        []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevcore0": 3})},
+			expectedError: true,
+		},
 		{
 			name:          "SocketGrouped_DualSocketHT_DeviceNotFound_Socket",
 			cpuInfos:      mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
@@ -1018,6 +1726,43 @@ func TestPrepareResourceClaimsGroupedMode(t *testing.T) {
 			claims:         []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma0": 4})},
 			expectedCPUSet: cpuset.New(0, 1, 4, 5),
 		},
+		{
+			name:               "NUMAGrouped_DualSocketHT_AllocAllCPU_PartiallyUsed",
+			cpuInfos:           mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			groupBy:            GROUP_BY_NUMA_NODE,
+			initialAllocations: map[types.UID]cpuset.CPUSet{"other-claim": cpuset.New(0)},
+			claims:             []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma0": 4})},
+			expectedError:      true,
+		},
+		{
+			name:           "NUMAGrouped_DualSocketHT_AllocAllCPU_WithReserved",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			groupBy:        GROUP_BY_NUMA_NODE,
+			reservedCPUs:   cpuset.New(0),
+			claims:         []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma0": 3})},
+			expectedCPUSet: cpuset.New(1, 4, 5),
+		},
+		{
+			name:           "NUMAGrouped_DualSocketHT_AllCPUsConfig",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			groupBy:        GROUP_BY_NUMA_NODE,
+			claims:         []*resourceapi.ResourceClaim{testClaimAllCPUs(testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma1", Request: "req-0"}}), `{"allCPUs": true}`)},
+			expectedCPUSet: cpuset.New(2, 3, 6, 7),
+		},
+		{
+			name:          "NUMAGrouped_DualSocketHT_AllCPUsConfig_PartialCapacity",
+			cpuInfos:      mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			groupBy:       GROUP_BY_NUMA_NODE,
+			claims:        []*resourceapi.ResourceClaim{testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma1": 2}), `{"allCPUs": true}`)},
+			expectedError: true,
+		},
+		{
+			name:          "NUMAGrouped_DualSocketHT_InvalidConfig",
+			cpuInfos:      mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			groupBy:       GROUP_BY_NUMA_NODE,
+			claims:        []*resourceapi.ResourceClaim{testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma1": 2}), `{"allCPUs": "yes"}`)},
+			expectedError: true,
+		},
 		{
 			name:          "SocketGrouped_DualSocketHT_MoreThanAvailable",
 			cpuInfos:      mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
@@ -1168,6 +1913,8 @@ func TestPrepareResourceClaimsRepeatedCalls(t *testing.T) {
 				},
 				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
 				cdiMgr:             newMockCdiMgr(),
+				podConfigStore:     store.NewPodConfig(),
+				claimTracker:       store.NewClaimTracker(),
 			}
 
 			makeClaim := func(devices []string) []*resourceapi.ResourceClaim {
@@ -1195,7 +1942,7 @@ func TestPrepareResourceClaimsRepeatedCalls(t *testing.T) {
 
 			gotCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
 			require.True(t, ok)
-			require.True(t, tc.expectedCPUSet.Equals(gotCPUs), "claim cpus: got %s, want %s", gotCPUs, tc.expectedCPUSet)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String(), "claim cpus")
 			require.True(t, tc.expectedShared.Equals(driver.cpuAllocationStore.GetSharedCPUs()), "shared cpus: got %s, want %s", driver.cpuAllocationStore.GetSharedCPUs(), tc.expectedShared)
 
 			envVar := driver.cdiMgr.(*mockCdiMgr).devices[cdiDeviceName]
@@ -1208,6 +1955,308 @@ func TestPrepareResourceClaimsRepeatedCalls(t *testing.T) {
 	}
 }
 
+func TestPrepareResourceClaimsIndividualModeSubrequests(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-first-available")
+	cdiQualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, getCDIDeviceName(claimUID))
+
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_4CPUS_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		deviceNameToCPUID:  map[string]int{"cpudev0": 0, "cpudev1": 1, "cpudev2": 2, "cpudev3": 3},
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cdiMgr:             newMockCdiMgr(),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+
+	// the claim got the devices of the second subrequest of its prioritized list.
+	claim := testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+		{Driver: testDriverName, Pool: testNodeName, Device: "cpudev0", Request: "cpus/any"},
+		{Driver: testDriverName, Pool: testNodeName, Device: "cpudev1", Request: "cpus/any"},
+	})
+	claim.Spec.Devices.Requests = []resourceapi.DeviceRequest{{
+		Name: "cpus",
+		FirstAvailable: []resourceapi.DeviceSubRequest{
+			{Name: "whole-cores", DeviceClassName: "dra.cpu", Count: 4},
+			{Name: "any", DeviceClassName: "dra.cpu", Count: 2},
+		},
+	}}
+	expectedDevices := []kubeletplugin.Device{
+		{PoolName: testNodeName, DeviceName: "cpudev0", Requests: []string{"cpus/any"}, CDIDeviceIDs: []string{cdiQualifiedName}},
+		{PoolName: testNodeName, DeviceName: "cpudev1", Requests: []string{"cpus/any"}, CDIDeviceIDs: []string{cdiQualifiedName}},
+	}
+
+	preparedClaims, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.NoError(t, preparedClaims[claimUID].Err)
+	require.Equal(t, expectedDevices, preparedClaims[claimUID].Devices)
+
+	// the kubelet preparing the claim again gets the same subrequests.
+	preparedClaims, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.NoError(t, preparedClaims[claimUID].Err)
+	require.Equal(t, expectedDevices, preparedClaims[claimUID].Devices)
+}
+
+func TestPrepareResourceClaimsGroupedModeRetry(t *testing.T) {
+	claimUID := types.UID("claim-1")
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             newMockCdiMgr(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	prepare := func(device string) (kubeletplugin.PrepareResult, cpuset.CPUSet) {
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(claimUID, testDriverName, testNodeName, map[string]int64{device: 2}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[claimUID].Err)
+		cpus, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		require.True(t, ok)
+		return prepared[claimUID], cpus
+	}
+
+	firstResult, firstCPUs := prepare("cpudevnuma000")
+	sharedCPUs := driver.cpuAllocationStore.GetSharedCPUs()
+
+	// the kubelet retries with the identical claim: the existing allocation is returned.
+	retryResult, retryCPUs := prepare("cpudevnuma000")
+	require.Equal(t, firstResult, retryResult)
+	require.True(t, firstCPUs.Equals(retryCPUs), "got %s, want %s", retryCPUs, firstCPUs)
+	require.True(t, sharedCPUs.Equals(driver.cpuAllocationStore.GetSharedCPUs()), "shared cpus: got %s, want %s", driver.cpuAllocationStore.GetSharedCPUs(), sharedCPUs)
+
+	// the claim prepared again with a different allocation is prepared from scratch.
+	_, changedCPUs := prepare("cpudevnuma001")
+	require.True(t, changedCPUs.IsSubsetOf(cpuset.New(2, 3, 6, 7)), "got %s", changedCPUs)
+
+	// an unprepared claim is prepared from scratch too.
+	_, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+	require.NoError(t, err)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimPreparedResult(claimUID)
+	require.False(t, ok)
+}
+
+func TestPrepareResourceClaimsExposeFailureRetry(t *testing.T) {
+	claimUID := types.UID("claim-1")
+	podUID := types.UID("pod-1")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "kube-system", UID: podUID},
+		Spec: corev1.PodSpec{
+			ResourceClaims: []corev1.PodResourceClaim{{Name: "cpus", ResourceClaimName: ptr.To(string(claimUID))}},
+			Containers:     []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{Claims: []corev1.ResourceClaim{{Name: "cpus"}}}}},
+		},
+	}
+	withNamespace := func(claim *resourceapi.ResourceClaim) *resourceapi.ResourceClaim {
+		claim.Namespace = "kube-system"
+		claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: pod.Name, UID: podUID}}
+		return claim
+	}
+
+	testCases := []struct {
+		name     string
+		mode     string
+		newClaim func(driver *CPUDriver) *resourceapi.ResourceClaim
+	}{
+		{
+			name: "grouped",
+			mode: CPU_DEVICE_MODE_GROUPED,
+			newClaim: func(*CPUDriver) *resourceapi.ResourceClaim {
+				return withNamespace(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}))
+			},
+		},
+		{
+			name: "grouped with pod level pinning",
+			mode: CPU_DEVICE_MODE_GROUPED,
+			newClaim: func(*CPUDriver) *resourceapi.ResourceClaim {
+				claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+				return withNamespace(testClaimAllCPUs(claim, `{"podLevelPinning": true}`))
+			},
+		},
+		{
+			name: "individual",
+			mode: CPU_DEVICE_MODE_INDIVIDUAL,
+			newClaim: func(driver *CPUDriver) *resourceapi.ResourceClaim {
+				var results []resourceapi.DeviceRequestAllocationResult
+				for name, cpuID := range driver.deviceNameToCPUID {
+					if cpuID == 1 || cpuID == 5 {
+						results = append(results, resourceapi.DeviceRequestAllocationResult{Driver: testDriverName, Pool: testNodeName, Device: name})
+					}
+				}
+				return withNamespace(testClaimWithResults(claimUID, results))
+			},
+		},
+		{
+			name: "system claim",
+			mode: CPU_DEVICE_MODE_GROUPED,
+			newClaim: func(*CPUDriver) *resourceapi.ResourceClaim {
+				claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 0})
+				return withNamespace(testClaimAllCPUs(claim, `{"systemCPUs":1}`))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCdiMgr := newMockCdiMgr()
+			mockCdiMgr.addError = fmt.Errorf("cdi add error")
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.cpuDeviceMode = tc.mode
+				cp.cdiMgr = mockCdiMgr
+				cp.kubeClient = fake.NewClientset(pod)
+				cp.podClaims = store.NewPodClaims()
+				cp.reservedCPUs = cpuset.New(0, 4)
+				cp.systemClaimNamespaces = sets.New("kube-system")
+			})
+			sharedCPUs := driver.cpuAllocationStore.GetSharedCPUs()
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.newClaim(driver)})
+			require.NoError(t, err)
+			require.ErrorContains(t, prepared[claimUID].Err, "cdi add error")
+			// nothing is left of the failed preparation.
+			_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.False(t, ok)
+			require.True(t, sharedCPUs.Equals(driver.cpuAllocationStore.GetSharedCPUs()), "shared cpus: got %s, want %s", driver.cpuAllocationStore.GetSharedCPUs(), sharedCPUs)
+			require.True(t, driver.cpuAllocationStore.GetSystemClaimCPUs().IsEmpty(), "got %s", driver.cpuAllocationStore.GetSystemClaimCPUs())
+			require.False(t, driver.podClaims.Has(claimUID))
+
+			// the kubelet retry prepares the claim from scratch.
+			mockCdiMgr.addError = nil
+			prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.newClaim(driver)})
+			require.NoError(t, err)
+			require.NoError(t, prepared[claimUID].Err)
+			require.Contains(t, mockCdiMgr.devices, getCDIDeviceName(claimUID))
+			_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.True(t, ok)
+		})
+	}
+}
+
+func TestPrepareResourceClaimsZeroCapacityPolicy(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-zero")
+	cdiQualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, getCDIDeviceName(claimUID))
+
+	testCases := []struct {
+		name                    string
+		policy                  string
+		claim                   *resourceapi.ResourceClaim
+		expectedError           bool
+		expectedPreparedDevices []kubeletplugin.Device
+		expectedCPUSet          cpuset.CPUSet
+	}{
+		{
+			name:   "shared policy grants share-only access",
+			policy: ZERO_CAPACITY_POLICY_SHARED,
+			claim: testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma000", Request: "req-0"},
+			}),
+			expectedPreparedDevices: []kubeletplugin.Device{
+				{PoolName: testNodeName, DeviceName: "cpudevnuma000", Requests: []string{"req-0"}},
+			},
+			expectedCPUSet: cpuset.New(),
+		},
+		{
+			name: "unset policy is shared",
+			claim: testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma000", Request: "req-0"},
+			}),
+			expectedPreparedDevices: []kubeletplugin.Device{
+				{PoolName: testNodeName, DeviceName: "cpudevnuma000", Requests: []string{"req-0"}},
+			},
+			expectedCPUSet: cpuset.New(),
+		},
+		{
+			name:   "one-cpu policy assigns one CPU",
+			policy: ZERO_CAPACITY_POLICY_ONE_CPU,
+			claim: testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma001", Request: "req-0"},
+			}),
+			expectedPreparedDevices: []kubeletplugin.Device{
+				{PoolName: testNodeName, DeviceName: "cpudevnuma001", Requests: []string{"req-0"}, CDIDeviceIDs: []string{cdiQualifiedName}},
+			},
+			expectedCPUSet: cpuset.New(2),
+		},
+		{
+			name:   "error policy fails the claim",
+			policy: ZERO_CAPACITY_POLICY_ERROR,
+			claim: testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma000", Request: "req-0"},
+			}),
+			expectedError: true,
+		},
+		{
+			name:           "consumed capacity is not affected by the policy",
+			policy:         ZERO_CAPACITY_POLICY_ERROR,
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:   "all CPUs without consumed capacity are not affected by the policy",
+			policy: ZERO_CAPACITY_POLICY_ERROR,
+			claim: testClaimAllCPUs(testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+				{Driver: testDriverName, Pool: testNodeName, Device: "cpudevnuma000", Request: "req-0"},
+			}), `{"allCPUs": true}`),
+			expectedPreparedDevices: []kubeletplugin.Device{
+				{PoolName: testNodeName, DeviceName: "cpudevnuma000", Requests: []string{"req-0"}, CDIDeviceIDs: []string{cdiQualifiedName}},
+			},
+			expectedCPUSet: cpuset.New(0, 1, 4, 5),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			driver := &CPUDriver{
+				driverName:         testDriverName,
+				cpuTopology:        topo,
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				cdiMgr:             newMockCdiMgr(),
+				cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+				reservedCPUs:       cpuset.New(),
+				zeroCapacityPolicy: tc.policy,
+				podConfigStore:     store.NewPodConfig(),
+				claimTracker:       store.NewClaimTracker(),
+			}
+			driver.initializeDeviceLookupMaps()
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			if tc.expectedPreparedDevices != nil {
+				require.Equal(t, tc.expectedPreparedDevices, prepared[claimUID].Devices)
+			}
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String(), "claim cpus")
+			if tc.expectedCPUSet.IsEmpty() {
+				require.NotContains(t, driver.cdiMgr.(*mockCdiMgr).devices, getCDIDeviceName(claimUID))
+			}
+		})
+	}
+}
+
 func TestUnprepareResourceClaims(t *testing.T) {
 	logger := testr.New(t)
 	claimUID := types.UID("test-claim-uid")
@@ -1298,3 +2347,17 @@ func testClaim(claimUID types.UID, driverName, poolName string, consumedCapacity
 		},
 	}
 }
+
+// testClaimAllCPUs adds to the claim an opaque driver configuration applying to all its requests.
+func testClaimAllCPUs(claim *resourceapi.ResourceClaim, parameters string) *resourceapi.ResourceClaim {
+	claim.Status.Allocation.Devices.Config = append(claim.Status.Allocation.Devices.Config, resourceapi.DeviceAllocationConfiguration{
+		Source: resourceapi.AllocationConfigSourceClaim,
+		DeviceConfiguration: resourceapi.DeviceConfiguration{
+			Opaque: &resourceapi.OpaqueDeviceConfiguration{
+				Driver:     testDriverName,
+				Parameters: runtime.RawExtension{Raw: []byte(parameters)},
+			},
+		},
+	})
+	return claim
+}
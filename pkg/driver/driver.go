@@ -17,22 +17,35 @@ limitations under the License.
 package driver
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/containerd/nri/pkg/stub"
 	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/buildinfo"
 	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/procpinner"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
 	resourceapi "k8s.io/api/resource/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/dynamic-resource-allocation/resourceslice"
 	"k8s.io/utils/cpuset"
@@ -43,17 +56,90 @@ const (
 	CPU_DEVICE_MODE_GROUPED = "grouped"
 	// CPU_DEVICE_MODE_INDIVIDUAL exposes each CPU as a separate device.
 	CPU_DEVICE_MODE_INDIVIDUAL = "individual"
+	// CPU_DEVICE_MODE_MIXED exposes each CPU both as a separate device and in a grouped device,
+	// the two views sharing per NUMA node counters so a CPU is never allocated through both.
+	CPU_DEVICE_MODE_MIXED = "mixed"
 )
 
+const (
+	// SLICE_CLEANUP_POLICY_RETAIN leaves the ResourceSlices in place on shutdown, for a fast restart.
+	SLICE_CLEANUP_POLICY_RETAIN = "retain"
+	// SLICE_CLEANUP_POLICY_DELETE deletes the ResourceSlices of the node on shutdown, for a clean uninstall.
+	SLICE_CLEANUP_POLICY_DELETE = "delete"
+)
+
+const (
+	// SLICE_GROUPING_NONE fills the ResourceSlices with the devices in order, for the fewest slices.
+	SLICE_GROUPING_NONE = "none"
+	// SLICE_GROUPING_SOCKET keeps the devices of each socket in their own ResourceSlices.
+	SLICE_GROUPING_SOCKET = "socket"
+	// SLICE_GROUPING_NUMA_NODE keeps the devices of each NUMA node in their own ResourceSlices.
+	SLICE_GROUPING_NUMA_NODE = "numanode"
+	// SLICE_GROUPING_L3 keeps the devices of each uncore (L3) cache in their own ResourceSlices.
+	SLICE_GROUPING_L3 = "l3"
+)
+
+const (
+	// ZERO_CAPACITY_POLICY_SHARED prepares the grouped devices allocated without consumed CPU capacity
+	// with no exclusive CPUs: the containers run on the shared CPUs.
+	ZERO_CAPACITY_POLICY_SHARED = "shared"
+	// ZERO_CAPACITY_POLICY_ONE_CPU assigns one exclusive CPU to the grouped devices allocated without consumed CPU capacity.
+	ZERO_CAPACITY_POLICY_ONE_CPU = "one-cpu"
+	// ZERO_CAPACITY_POLICY_ERROR fails the claims with grouped devices allocated without consumed CPU capacity.
+	ZERO_CAPACITY_POLICY_ERROR = "error"
+)
+
+const (
+	// CPU_SORTING_STRATEGY_PACKED allocates the CPUs of the grouped devices by whole cores first, filling a core
+	// before moving to the next one.
+	CPU_SORTING_STRATEGY_PACKED = "packed"
+	// CPU_SORTING_STRATEGY_SPREAD allocates the CPUs of the grouped devices from distinct physical cores first,
+	// before using the sibling threads of the cores already allocated.
+	CPU_SORTING_STRATEGY_SPREAD = "spread"
+)
+
+const (
+	// ALLOCATION_STRATEGY_PACKED picks the CPUs of a request with the numa-packed policy and the packed CPU sorting.
+	ALLOCATION_STRATEGY_PACKED = "packed"
+	// ALLOCATION_STRATEGY_SPREAD picks the CPUs of a request with the numa-packed policy and the spread CPU sorting.
+	ALLOCATION_STRATEGY_SPREAD = "spread"
+	// ALLOCATION_STRATEGY_DISTRIBUTED picks the CPUs of a request with the numa-distributed policy.
+	ALLOCATION_STRATEGY_DISTRIBUTED = "distributed"
+)
+
+const (
+	// CAPACITY_REQUEST_POLICY_NONE publishes no request policy for the CPU capacity of the grouped devices.
+	CAPACITY_REQUEST_POLICY_NONE = "none"
+	// CAPACITY_REQUEST_POLICY_CPUS lets the scheduler allocate whole CPUs only, or millicores with the fractional CPUs.
+	CAPACITY_REQUEST_POLICY_CPUS = "cpus"
+	// CAPACITY_REQUEST_POLICY_CORES lets the scheduler allocate multiples of the threads of a core only.
+	CAPACITY_REQUEST_POLICY_CORES = "cores"
+)
+
+// sliceCleanupTimeout bounds the time spent deleting the ResourceSlices on shutdown.
+const sliceCleanupTimeout = 10 * time.Second
+
 const (
 	// GROUP_BY_SOCKET groups CPUs by socket.
 	GROUP_BY_SOCKET = "socket"
 	// GROUP_BY_NUMA_NODE groups CPUs by NUMA node.
 	GROUP_BY_NUMA_NODE = "numanode"
+	// GROUP_BY_DIE groups CPUs by die, for multi-die packages.
+	GROUP_BY_DIE = "die"
+	// GROUP_BY_CLUSTER groups CPUs by CPU cluster, the sharing boundary of the arm64 servers.
+	GROUP_BY_CLUSTER = "cluster"
+	// GROUP_BY_L3 groups CPUs by uncore (last level) cache, for the parts with several L3 caches per NUMA node.
+	GROUP_BY_L3 = "l3"
+	// GROUP_BY_CCD groups CPUs by AMD CCD (core complex die), which holds one or two L3 caches.
+	GROUP_BY_CCD = "ccd"
+	// GROUP_BY_CORE groups CPUs by physical core: the capacity of each device is the number of its hardware threads.
+	GROUP_BY_CORE = "core"
 )
 
+// podClaimsCheckpointFile is the file, in the plugin data directory, checkpointing the claims prepared in NRI-only mode.
+const podClaimsCheckpointFile = "pod-claims.json"
+
 const (
-	kubeletPluginPath = "/var/lib/kubelet/plugins"
 	// maxAttempts indicates the number of times the driver will try to recover itself before failing
 	maxAttempts = 5
 )
@@ -67,7 +153,7 @@ type KubeletPlugin interface {
 }
 
 type cdiManager interface {
-	AddDevice(logger logr.Logger, deviceName string, envVar string) error
+	AddDevice(logger logr.Logger, deviceName string, envVar string, opts ...cdiDeviceOption) error
 	RemoveDevice(logger logr.Logger, deviceName string) error
 }
 
@@ -80,24 +166,159 @@ type CPUInfoProvider interface {
 
 // CPUDriver is the structure that holds all the driver runtime information.
 type CPUDriver struct {
-	driverName              string
-	nodeName                string
-	kubeClient              kubernetes.Interface
-	draPlugin               KubeletPlugin
-	nriPlugin               stub.Stub
-	podConfigStore          *store.PodConfig
-	cpuAllocationStore      *store.CPUAllocation
-	cdiMgr                  cdiManager
-	cpuTopology             *cpuinfo.CPUTopology
-	deviceNameToCPUID       map[string]int
-	deviceNameToSocketID    map[string]int
-	deviceNameToNUMANodeID  map[string]int
-	reservedCPUs            cpuset.CPUSet
-	cpuDeviceMode           string
-	cpuDeviceGroupBy        string
-	claimTracker            *store.ClaimTracker
-	pcieRootMapper          *store.PCIeRootMapper
-	devicesPerResourceSlice int
+	driverName                string
+	nodeName                  string
+	kubeClient                kubernetes.Interface
+	draPlugin                 KubeletPlugin
+	publisher                 *ResourcePublisher
+	publishedPools            publishedPools
+	nriPlugin                 stub.Stub
+	nriSupervisor             *nriSupervisor
+	podConfigStore            *store.PodConfig
+	cpuAllocationStore        *store.CPUAllocation
+	cdiMgr                    cdiManager
+	nriOnly                   bool
+	cdiPassthroughAnnotations []string
+	cdiPassthroughTarget      string
+	cpuTopology               *cpuinfo.CPUTopology
+	cpuTopologyProvider       cpuTopologyProvider
+	deviceNameToCPUID         map[string]int
+	deviceNameToSocketID      map[string]int
+	deviceNameToNUMANodeID    map[string]int
+	deviceNameToDie           map[string]dieIdent
+	deviceNameToCluster       map[string]clusterIdent
+	deviceNameToUncoreCache   map[string]int
+	deviceNameToCCD           map[string]int
+	deviceNameToCore          map[string]coreIdent
+	reservedCPUs              cpuset.CPUSet
+	cpuDeviceMode             string
+	cpuDeviceGroupBy          string
+	socketDeviceModes         map[int]string
+	claimTracker              *store.ClaimTracker
+	podClaims                 *store.PodClaims
+	pcieRootMapper            *store.PCIeRootMapper
+	devicesPerResourceSlice   int
+	sliceCleanupPolicy        string
+	// sliceGrouping selects the devices which never share a ResourceSlice.
+	sliceGrouping string
+	// resourcePoolPerGroup publishes the slices of each slice group in a pool of its own.
+	resourcePoolPerGroup bool
+	// legacyDeviceNames maps the device names used by previous driver versions to the current ones.
+	legacyDeviceNames    map[string]string
+	translateLegacyNames bool
+	// collapseUMADevices publishes a single node device on the UMA nodes, whatever the group-by mode.
+	collapseUMADevices bool
+	// legacyNUMAAttribute also publishes the legacy dra.net/numaNode alignment attribute.
+	legacyNUMAAttribute bool
+	// cpuTiers are the CPUs of the operator-defined CPU tiers, published as separate devices.
+	cpuTiers            map[string]cpuset.CPUSet
+	deviceNameToCPUTier map[string]string
+	// cpuPools are the CPUs of the admin-defined CPU pools, published as a device each.
+	cpuPools            map[string]cpuset.CPUSet
+	deviceNameToCPUPool map[string]string
+	// nodeStatusClient and nodeStatusNamespace locate the CPUDriverNodeStatus object of the node.
+	nodeStatusClient    dynamic.Interface
+	nodeStatusNamespace string
+	// zeroCapacityPolicy is how the grouped devices allocated without consumed CPU capacity are prepared.
+	zeroCapacityPolicy string
+	// capacityRequestPolicy is the request policy published for the CPU capacity of the grouped devices.
+	capacityRequestPolicy string
+	// peakUsage tracks the history of the peak exclusive CPU usage of the NUMA nodes.
+	peakUsage *store.PeakUsage
+	// buildAttributes are the attributes of the build of the driver, set on all the devices.
+	buildAttributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+	// kernelFeatures are the kernel features probed at startup, at kernelFeaturesProbeTime.
+	kernelFeatures          []KernelFeatureStatus
+	kernelFeaturesProbeTime time.Time
+	// pinMemoryNodes sets the cpuset memory nodes of the containers with guaranteed CPUs.
+	pinMemoryNodes bool
+	// sharedPoolDevice publishes the virtual device of the shared pool.
+	sharedPoolDevice bool
+	// isolationLabel is the pod label whose values are the isolation tiers, isolationDomain what the tiers don't share.
+	isolationLabel  string
+	isolationDomain string
+	// claimTiers tracks the isolation tier of the prepared claims.
+	claimTiers *store.ClaimTiers
+	// systemClaimNamespaces are the namespaces whose claims may be allocated reserved CPUs.
+	systemClaimNamespaces sets.Set[string]
+	// podLevelPinningNamespaces are the namespaces whose claims pin all the containers of their pods.
+	podLevelPinningNamespaces sets.Set[string]
+	// strictEnforcement fails the preparation of all the claims while their CPUs can't be enforced.
+	strictEnforcement bool
+	// fullPCPUsOnly allocates whole physical cores only to all the claims when SMT is enabled.
+	fullPCPUsOnly bool
+	// smtIsolation pads the allocations to whole physical cores when SMT is enabled, so the claims never share a core.
+	smtIsolation bool
+	// preferAlignByUncoreCache allocates the CPUs of the grouped devices from as few uncore caches as possible.
+	preferAlignByUncoreCache bool
+	// cpuSortingStrategy is how the CPUs of the grouped devices are picked within the NUMA nodes and sockets.
+	cpuSortingStrategy string
+	// allocationPolicy is the name of the cpumanager policy picking the CPUs of the grouped devices.
+	allocationPolicy string
+	// fractionalCPUs lets the claims consume a fraction of the CPU capacity of the grouped devices.
+	fractionalCPUs bool
+	// efficiency reports the utilization of the exclusive CPUs of the workloads, nil if disabled.
+	efficiency *efficiencyReporter
+	// featureGates are the effective feature gates, fixed at startup.
+	featureGates *featureGates
+	// claimStatus maintains the device conditions of the prepared claims, if the ClaimDeviceStatus feature gate is enabled.
+	claimStatus *claimStatusReporter
+	// startupStatus has the conditions of the startup steps retried in the background, if the
+	// DegradedStartup feature gate is enabled.
+	startupStatus *startupStatus
+	// faults are the faults to inject in the resilience tests, if the FaultInjection feature gate is enabled.
+	faults *faultInjector
+	// tuner applies the tunings of the profiles of the claims, nil unless the LowLatencyProfile or the
+	// CPUProfiles feature gate is enabled.
+	tuner *cpuTuner
+	// cpuProfiles caches the CPUProfiles, nil unless the CPUProfiles feature gate is enabled.
+	cpuProfiles *cpuProfileWatcher
+	// cgroupFS is the sysfs the container cgroups are read from, set if the CPUSetVerification feature gate is enabled.
+	cgroupFS fs.FS
+	// nriSocketPath is the NRI socket of the runtime.
+	nriSocketPath string
+	// sharedPool signals when the shared CPUs reach the minimum, nil if disabled.
+	sharedPool *sharedPoolMonitor
+	// sharedPoolFile keeps the shared CPUs in a host file, nil if disabled.
+	sharedPoolFile *sharedPoolFile
+	// numaDeviceNames are the physical names of the NUMA node devices, by NUMA node ID, empty with the kernel names.
+	numaDeviceNames map[int]string
+	// cpuDeviceNames are the names of the individual devices, by CPU ID, from the checkpointed device IDs.
+	// Empty, the devices are named in order.
+	cpuDeviceNames map[int]string
+	// cpufreqFS is the sysfs the frequency limits of the CPUs are read from, nil if they are not read.
+	cpufreqFS fs.FS
+	// performanceScores are the frequency limits and the relative performance scores of the CPUs, published as
+	// device attributes.
+	performanceScores performanceScores
+	// cpuFlags are the feature flags of the CPUs, by CPU ID, published as instruction set feature attributes.
+	cpuFlags map[int]sets.Set[string]
+	// cpuModels are the models of the CPUs, by CPU ID, published as the vendor, model name, family and stepping
+	// attributes.
+	cpuModels map[int]cpuinfo.CPUModel
+	// numaDistances are the distances between the NUMA nodes, by NUMA node ID, published as the NUMA distance
+	// attributes.
+	numaDistances map[int]map[int]int
+	// kernelIsolation are the CPUs isolated by the kernel boot parameters, published as the isolated and nohzFull
+	// attributes of the individual devices.
+	kernelIsolation *kernelIsolation
+	// cpuCapacities are the capacities of the CPUs of the asymmetric systems, by CPU ID, published as the CPU
+	// capacity attributes.
+	cpuCapacities map[int]int64
+	// numaMemoryBandwidth is the memory bandwidth of the NUMA nodes in bytes per second, by NUMA node ID,
+	// published as a capacity of the NUMA node devices.
+	numaMemoryBandwidth map[int]int64
+	// cpuHealthFS is the sysfs the online CPUs are read from, nil if they are not read.
+	cpuHealthFS fs.ReadLinkFS
+	// unhealthyCPUsFile is the host file listing the CPUs flagged unhealthy by the health agents, empty if none.
+	unhealthyCPUsFile string
+	// cpuHealth tracks the offline and the unhealthy CPUs, whose devices are tainted.
+	cpuHealth cpuHealth
+	// socketNUMAPartitions publishes a partition per NUMA node along the socket devices.
+	socketNUMAPartitions bool
+	// lifecycle starts and stops the components of the driver, calling the hooks around them.
+	lifecycle lifecycle
+	hooks     LifecycleHooks
 }
 
 // Config is the configuration for the CPUDriver.
@@ -108,39 +329,255 @@ type Config struct {
 	CPUDeviceMode    string
 	CPUDeviceGroupBy string
 	ExposePCIeRoots  bool
+	// NUMADeviceNaming names the NUMA node devices after the kernel NUMA node IDs, the default,
+	// or after the physical identity of the NUMA nodes.
+	NUMADeviceNaming string
+	// SocketNUMAPartitions publishes, with the socket devices, a device per NUMA node, consuming from
+	// per NUMA node counter sets shared with the socket devices.
+	SocketNUMAPartitions bool
+	// SocketDeviceModes overrides CPUDeviceMode for the given socket IDs, so the sockets of
+	// a node can expose CPUs with different modes.
+	SocketDeviceModes map[int]string
+	// NUMAMemoryBandwidth maps NUMA node IDs to their memory bandwidth in GB/s, published as a capacity of the
+	// NUMA node devices, overriding the bandwidth reported by the firmware.
+	NUMAMemoryBandwidth map[int]int64
+	// EnableCDI controls whether the claim allocation is also exposed to containers
+	// through CDI. When disabled, the driver works in NRI-only mode: CPUs are pinned
+	// but no environment variable is injected in the containers.
+	EnableCDI bool
+	// CDIPassthroughAnnotations is the allow-list of claim and pod annotations
+	// copied into the CDI device of each claim.
+	CDIPassthroughAnnotations []string
+	// CDIPassthroughTarget selects where the passthrough annotations are copied:
+	// CDI_PASSTHROUGH_ANNOTATIONS or CDI_PASSTHROUGH_ENV.
+	CDIPassthroughTarget string
+	// PinnedSystemdUnits and PinnedProcessNames select the host processes which
+	// are periodically moved onto the reserved CPUs. Both empty disables the pinning.
+	PinnedSystemdUnits []string
+	PinnedProcessNames []string
+	// ProcessPinningInterval is how often the host processes are pinned again,
+	// to catch the processes started after the driver.
+	ProcessPinningInterval time.Duration
+	// ResourceSliceCleanupPolicy is what to do with the ResourceSlices of the node on shutdown:
+	// SLICE_CLEANUP_POLICY_RETAIN or SLICE_CLEANUP_POLICY_DELETE.
+	ResourceSliceCleanupPolicy string
+	// TranslateLegacyDeviceNames enables the translation of the device names allocated by previous
+	// driver versions, so the claims allocated before an upgrade still resolve. Deprecated.
+	TranslateLegacyDeviceNames bool
+	// CollapseUMADevices publishes a single grouped device, without NUMA attributes, on the nodes
+	// with a single socket, NUMA node and die, whatever the group-by mode.
+	CollapseUMADevices bool
+	// LegacyNUMAAttribute also publishes the NUMA node of the devices as the legacy dra.net/numaNode attribute,
+	// next to resource.kubernetes.io/numaNode, for the drivers aligning on it. Deprecated.
+	LegacyNUMAAttribute bool
+	// CPUTiers maps the names of the CPU tiers to their CPUs, as a cpuset or a core type. The CPUs of
+	// each tier are published as separate devices, with the tier attribute.
+	CPUTiers map[string]string
+	// SplitCoreTypes splits the grouped devices of the hybrid parts in a device per core type, as the
+	// CPU tiers named after the core types do. Exclusive with CPUTiers.
+	SplitCoreTypes bool
+	// CPUPoolsFile is the file mapping the names of the admin-defined CPU pools to their cpusets. Each pool
+	// is published as a device, and its CPUs are taken out of the other devices. Empty disables the pools.
+	CPUPoolsFile string
+	// IsolatedCPUsPool publishes the CPUs isolated by the kernel, with isolcpus or nohz_full, as the "isolated"
+	// CPU pool, so only the claims asking for it get them.
+	IsolatedCPUsPool bool
+	// NodeStatusNamespace is the namespace of the CPUDriverNodeStatus object summarizing the
+	// driver state on the node. Empty disables the node status, otherwise NodeStatusClient is required.
+	NodeStatusNamespace string
+	NodeStatusClient    dynamic.Interface
+	// CPUProfileClient watches the CPUProfiles, required by the CPUProfiles feature gate.
+	CPUProfileClient dynamic.Interface
+	// NodeStatusInterval is how often the node status is updated.
+	NodeStatusInterval time.Duration
+	// EfficiencyReportInterval is how often the exclusive CPUs allocated to the workloads are compared
+	// with their utilization. Zero disables the efficiency report.
+	EfficiencyReportInterval time.Duration
+	// ZeroCapacityPolicy is how the grouped devices allocated without consumed CPU capacity are prepared:
+	// ZERO_CAPACITY_POLICY_SHARED, ZERO_CAPACITY_POLICY_ONE_CPU or ZERO_CAPACITY_POLICY_ERROR.
+	ZeroCapacityPolicy string
+	// CapacityRequestPolicy is the request policy published for the CPU capacity of the grouped devices, which the
+	// scheduler enforces: CAPACITY_REQUEST_POLICY_NONE, CAPACITY_REQUEST_POLICY_CPUS or CAPACITY_REQUEST_POLICY_CORES.
+	CapacityRequestPolicy string
+	// PeakUsageFile is where the history of the peak exclusive CPU usage is persisted.
+	// Empty keeps the history in memory only.
+	PeakUsageFile string
+	// SharedPoolFile is the host file kept up to date with the shared CPUs, for the host agents. Empty disables it.
+	SharedPoolFile string
+	// PinMemoryNodes restricts the memory of the containers with guaranteed CPUs to the NUMA nodes of their CPUs.
+	PinMemoryNodes bool
+	// SharedPoolDevice publishes a virtual device of the shared pool, which any number of claims can be
+	// allocated, so the pods claim explicitly the shared CPUs.
+	SharedPoolDevice bool
+	// IsolationLabel is the pod label key whose values are the isolation tiers: the exclusive CPUs of the
+	// pods of different tiers never share an IsolationDomain. Empty disables the isolation.
+	IsolationLabel string
+	// IsolationDomain is ISOLATION_DOMAIN_NUMA_NODE or ISOLATION_DOMAIN_L3.
+	IsolationDomain string
+	// ResourceSliceMaxDevices caps the devices of each ResourceSlice below the API limit, for smaller
+	// slices. Zero uses the API limit.
+	ResourceSliceMaxDevices int
+	// ResourceSliceGrouping keeps the devices of each group in their own ResourceSlices, so the changes to a group
+	// only update its slices: SLICE_GROUPING_NONE, SLICE_GROUPING_SOCKET, SLICE_GROUPING_NUMA_NODE or SLICE_GROUPING_L3.
+	ResourceSliceGrouping string
+	// ResourcePoolPerGroup publishes the slices of each group of ResourceSliceGrouping in a pool of its own,
+	// instead of a single pool named as the node, so the failure domains of the pools are smaller.
+	ResourcePoolPerGroup bool
+	// KubeletPluginsDir and KubeletRegistrarDir are the kubelet plugin directories. The kubelet connects to
+	// the sockets of the driver through them, so they must be mounted at the same paths as on the host.
+	// Empty uses DefaultKubeletPluginsDir and DefaultKubeletRegistrarDir.
+	KubeletPluginsDir   string
+	KubeletRegistrarDir string
+	// CDISpecDir is where the CDI spec directory is mounted. Empty uses DefaultCDISpecDir.
+	CDISpecDir string
+	// NRISocketPath is where the NRI socket of the runtime is mounted. Empty uses DefaultNRISocketPath.
+	NRISocketPath string
+	// MinSharedCPUs is the minimum size of the shared pool: when the allocations shrink it to MinSharedCPUs
+	// or less, the driver reports it by metrics and node status. Zero disables the check.
+	MinSharedCPUs int
+	// SharedPoolEvents also reports with events on the node when the shared pool reaches MinSharedCPUs, and
+	// when it is above it again.
+	SharedPoolEvents bool
+	// SystemClaimNamespaces are the namespaces whose claims may request reserved CPUs with the systemCPUs
+	// device configuration, for the privileged system workloads. Empty disables the system claims.
+	SystemClaimNamespaces []string
+	// PodLevelPinningNamespaces are the namespaces whose claims pin all the containers of their pods to the
+	// claim CPUs, and not only the containers consuming them, as the podLevelPinning device configuration does.
+	PodLevelPinningNamespaces []string
+	// StrictEnforcement fails the preparation of the claims while the NRI plugin is not connected to the runtime, or
+	// the runtime doesn't apply the container updates, instead of preparing them without enforcing their CPUs.
+	StrictEnforcement bool
+	// FullPCPUsOnly allocates whole physical cores only when SMT is enabled, and fails the preparation of the claims
+	// which can't get them.
+	FullPCPUsOnly bool
+	// SMTIsolation pads the allocations to whole physical cores when SMT is enabled, so the claims never share a core,
+	// even when they request a number of CPUs which is not a multiple of the threads of a core.
+	SMTIsolation bool
+	// PreferAlignByUncoreCache allocates the CPUs of the grouped devices from as few uncore caches as possible,
+	// as the prefer-align-cpus-by-uncorecache option of the kubelet cpumanager.
+	PreferAlignByUncoreCache bool
+	// CPUSortingStrategy is how the CPUs of the grouped devices are picked: CPU_SORTING_STRATEGY_PACKED fills whole
+	// cores first, CPU_SORTING_STRATEGY_SPREAD takes distinct physical cores first. Empty uses CPU_SORTING_STRATEGY_PACKED.
+	CPUSortingStrategy string
+	// AllocationPolicy is the name of the cpumanager policy picking the CPUs of the claims consuming a part of a
+	// grouped device, a builtin one or one registered with cpumanager.RegisterPolicy. Empty uses cpumanager.PolicyNUMAPacked.
+	AllocationPolicy string
+	// UnhealthyCPUsFile is the host file where the health agents of the node list the CPUs flagged unhealthy,
+	// in the cpulist format. The devices of the unhealthy CPUs are tainted, as the devices of the offline CPUs.
+	// Empty taints the devices of the offline CPUs only.
+	UnhealthyCPUsFile string
+	// FractionalCPUs lets the claims consume a fraction of the CPU capacity of the grouped devices, in millicores.
+	// Their containers run on the shared CPUs of the device, limited by a CPU quota and weighted by the millicores.
+	// Requires EnableCDI.
+	FractionalCPUs bool
+	// FeatureGates enables or disables the named experimental capabilities, overriding their defaults.
+	// Unknown names are an error.
+	FeatureGates map[string]bool
+	// Components are started after the components of the driver, and stopped before them.
+	Components []Component
+	// Hooks are called around the lifecycle of the driver components.
+	Hooks LifecycleHooks
 }
 
 func (cfg Config) DevicesPerResourceSlice() int {
-	if cfg.ExposePCIeRoots {
+	limit := cfg.resourceSliceDeviceLimit()
+	if cfg.ResourceSliceMaxDevices > 0 && cfg.ResourceSliceMaxDevices < limit {
+		return cfg.ResourceSliceMaxDevices
+	}
+	return limit
+}
+
+// resourceSliceDeviceLimit is the maximum number of devices of a ResourceSlice the API accepts.
+func (cfg Config) resourceSliceDeviceLimit() int {
+	if cfg.ExposePCIeRoots || cfg.CPUDeviceMode == CPU_DEVICE_MODE_MIXED || cfg.SocketNUMAPartitions {
 		// We use the lower "advanced features" limit because the driver
-		// may set list-type attributes (StringValues) such as PCIe roots.
+		// may set list-type attributes (StringValues) such as PCIe roots,
+		// or consume counters in mixed mode and with the NUMA partitions.
 		return resourceapi.ResourceSliceMaxDevicesWithAdvancedFeatures
 	}
 	return resourceapi.ResourceSliceMaxDevices
 }
 
+// validate checks the configuration on its own, before the discovery of the host.
+func (cfg Config) validate() error {
+	if limit := cfg.resourceSliceDeviceLimit(); cfg.ResourceSliceMaxDevices > limit {
+		return fmt.Errorf("at most %d devices per ResourceSlice are allowed, got %d", limit, cfg.ResourceSliceMaxDevices)
+	}
+	if cfg.FractionalCPUs && !cfg.EnableCDI {
+		return fmt.Errorf("the fractional CPUs require CDI")
+	}
+	if (len(cfg.PinnedSystemdUnits) > 0 || len(cfg.PinnedProcessNames) > 0) && cfg.ReservedCPUs.IsEmpty() {
+		return fmt.Errorf("pinning host processes requires reserved CPUs")
+	}
+	if _, ok := cpumanager.LookupPolicy(cfg.AllocationPolicy); cfg.AllocationPolicy != "" && !ok {
+		return fmt.Errorf("unknown allocation policy %q, must be one of %s", cfg.AllocationPolicy, strings.Join(cpumanager.PolicyNames(), ", "))
+	}
+	if cfg.MinSharedCPUs < 0 {
+		return fmt.Errorf("the minimum number of shared CPUs must not be negative, got %d", cfg.MinSharedCPUs)
+	}
+	if !cfg.EnableCDI && len(cfg.CDIPassthroughAnnotations) > 0 {
+		// the passthrough annotations are copied into the CDI device, there is nowhere to put them without it.
+		return fmt.Errorf("the CDI passthrough annotations require CDI to be enabled")
+	}
+	if cfg.EnableCDI && cfg.CDIPassthroughTarget == CDI_PASSTHROUGH_ENV {
+		if err := validateAnnotationEnvVarNames(cfg.CDIPassthroughAnnotations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostPaths returns where the host directories and sockets are mounted, defaulting the unset ones.
+func (cfg Config) hostPaths() hostPaths {
+	return hostPaths{
+		kubeletPluginsDir:   cmp.Or(cfg.KubeletPluginsDir, DefaultKubeletPluginsDir),
+		kubeletRegistrarDir: cmp.Or(cfg.KubeletRegistrarDir, DefaultKubeletRegistrarDir),
+		cdiSpecDir:          cmp.Or(cfg.CDISpecDir, DefaultCDISpecDir),
+		nriSocketPath:       cmp.Or(cfg.NRISocketPath, DefaultNRISocketPath),
+		sysfsRoot:           device.SysfsRoot,
+	}
+}
+
 // Start creates and starts a new CPUDriver.
 func Start(ctx context.Context, clientset kubernetes.Interface, config *Config) (*CPUDriver, <-chan error, error) {
 	var logger logr.Logger
 	ctx, logger = ctxlog.WithValues(ctx, "driver", config.DriverName)
 
 	asyncErr := make(chan error, 1)
-	plugin := &CPUDriver{
-		driverName:              config.DriverName,
-		nodeName:                config.NodeName,
-		kubeClient:              clientset,
-		deviceNameToCPUID:       make(map[string]int),
-		deviceNameToSocketID:    make(map[string]int),
-		deviceNameToNUMANodeID:  make(map[string]int),
-		reservedCPUs:            config.ReservedCPUs,
-		cpuDeviceMode:           config.CPUDeviceMode,
-		cpuDeviceGroupBy:        config.CPUDeviceGroupBy,
-		claimTracker:            store.NewClaimTracker(),
-		pcieRootMapper:          store.NewPCIeRootMapper(),
-		devicesPerResourceSlice: config.DevicesPerResourceSlice(),
+	if err := config.validate(); err != nil {
+		return nil, asyncErr, err
+	}
+	gates, err := newFeatureGates(knownFeatureGates, config.FeatureGates)
+	if err != nil {
+		return nil, asyncErr, err
+	}
+	gates.report(logger)
+	plugin := newCPUDriver(clientset, config)
+	plugin.featureGates = gates
+	if gates.Enabled(FEATURE_GATE_DEGRADED_STARTUP) {
+		plugin.startupStatus = &startupStatus{}
+	}
+	if gates.Enabled(FEATURE_GATE_FAULT_INJECTION) {
+		logger.Info("fault injection enabled, not meant for production")
+		plugin.faults = &faultInjector{}
+	}
+	paths := config.hostPaths()
+	plugin.nriSocketPath = paths.nriSocketPath
+	// the privileges are checked upfront, so a driver running as non-root reports all the missing ones at once.
+	if err := checkPrivileges(privilegeChecks(config, paths, procSelfStatus)); err != nil {
+		return nil, asyncErr, fmt.Errorf("missing privileges: %w", err)
 	}
 	sysfs := os.DirFS(device.SysfsRoot).(device.SysFS)
 
+	plugin.kernelFeatures = probeKernelFeatures(sysfs)
+	if gates.Enabled(FEATURE_GATE_CPUSET_VERIFICATION) {
+		plugin.cgroupFS = resolveCgroupFS(logger, sysfs, procSelfCgroup, hostSysfsRoot)
+	}
+	plugin.kernelFeaturesProbeTime = time.Now()
+	if err := checkKernelFeatures(logger, plugin.kernelFeatures); err != nil {
+		return nil, asyncErr, err
+	}
+
 	onlineCPUs, err := cpuinfo.OnlineCPUs(logger, sysfs)
 	if err != nil {
 		return nil, asyncErr, fmt.Errorf("failed to get online CPUs: %w", err)
@@ -156,6 +593,34 @@ func Start(ctx context.Context, clientset kubernetes.Interface, config *Config)
 		return nil, asyncErr, fmt.Errorf("failed to get CPU topology: topology is nil")
 	}
 	plugin.cpuTopology = topo
+	plugin.cpuTopologyProvider = cpuInfoProvider
+	if plugin.usesGroupedDevices() && plugin.collapseUMADevices && plugin.collapsibleUMATopology() {
+		logger.Info("UMA node detected, publishing a single grouped device", "device", cpuDeviceNodeName, "groupBy", config.CPUDeviceGroupBy)
+	}
+
+	if err := plugin.validateTopology(logger, config, sysfs); err != nil {
+		return nil, asyncErr, err
+	}
+
+	plugin.readCPUFlags(logger, os.DirFS(procRoot))
+	plugin.readCPUModels(logger, os.DirFS(procRoot))
+	plugin.readNUMADistances(logger, sysfs)
+	plugin.readKernelIsolation(logger, sysfs)
+	plugin.readCPUCapacities(logger, sysfs)
+	// the frequency limits of the CPUs are read before the first publication, and then periodically.
+	plugin.cpufreqFS = sysfs
+	plugin.refreshPerformanceScores(logger)
+	if len(plugin.performanceScores.get()) > 0 {
+		plugin.lifecycle.add(newRunnerComponent(COMPONENT_FREQUENCY_MONITOR, func(ctx context.Context) {
+			plugin.runFrequencyMonitor(ctx, frequencyMonitorInterval)
+		}))
+	}
+	// the CPUs going offline, or flagged unhealthy, after the start taint their devices.
+	plugin.cpuHealthFS = sysfs
+	plugin.refreshCPUHealth(logger)
+	plugin.lifecycle.add(newRunnerComponent(COMPONENT_CPU_HEALTH_MONITOR, func(ctx context.Context) {
+		plugin.runCPUHealthMonitor(ctx, cpuHealthMonitorInterval)
+	}))
 
 	if config.ExposePCIeRoots {
 		if err := plugin.pcieRootMapper.Probe(logger, sysfs, onlineCPUs); err != nil {
@@ -163,100 +628,423 @@ func Start(ctx context.Context, clientset kubernetes.Interface, config *Config)
 		}
 	}
 
+	driverPluginPath := filepath.Join(paths.kubeletPluginsDir, config.DriverName)
+	if err := os.MkdirAll(driverPluginPath, 0750); err != nil {
+		return nil, asyncErr, fmt.Errorf("failed to create plugin path %s: %w", driverPluginPath, err)
+	}
+	if plugin.usesIndividualDevices() {
+		deviceIDs, err := store.NewDeviceIDsCheckpoint(filepath.Join(driverPluginPath, deviceIDsCheckpointFile))
+		if err != nil {
+			return nil, asyncErr, err
+		}
+		if err := plugin.resolveCPUDeviceNames(logger, deviceIDs); err != nil {
+			return nil, asyncErr, err
+		}
+	}
+
+	if gates.Enabled(FEATURE_GATE_LOW_LATENCY_PROFILE) || gates.Enabled(FEATURE_GATE_CPU_PROFILES) {
+		// the tunings of the claims prepared before a restart are restored when they are unprepared.
+		tuner, err := newCPUTunerCheckpoint(device.SysfsRoot, procRoot, onlineCPUs, filepath.Join(driverPluginPath, cpuTuningsCheckpointFile))
+		if err != nil {
+			return nil, asyncErr, err
+		}
+		plugin.tuner = tuner
+	}
+
 	plugin.cpuAllocationStore = store.NewCPUAllocation(plugin.cpuTopology, config.ReservedCPUs)
 	plugin.podConfigStore = store.NewPodConfig()
 	plugin.initializeDeviceLookupMaps()
+	// the ResourceSlices are published later, so the ones found now are the ones the in-flight claims were allocated from.
+	if _, err := plugin.verifyPublishedDeviceMappings(ctx); err != nil {
+		logger.Error(err, "failed to verify the device mapping against the published ResourceSlices")
+	}
+	plugin.peakUsage = store.NewPeakUsage(logger, config.PeakUsageFile)
 
-	driverPluginPath := filepath.Join(kubeletPluginPath, config.DriverName)
-	if err := os.MkdirAll(driverPluginPath, 0750); err != nil {
-		return nil, asyncErr, fmt.Errorf("failed to create plugin path %s: %w", driverPluginPath, err)
+	if config.NodeStatusNamespace != "" && config.NodeStatusClient == nil {
+		return nil, asyncErr, fmt.Errorf("the node status requires a dynamic client")
+	}
+	if gates.Enabled(FEATURE_GATE_CPU_PROFILES) {
+		if config.CPUProfileClient == nil {
+			return nil, asyncErr, fmt.Errorf("the %s feature gate requires a dynamic client", FEATURE_GATE_CPU_PROFILES)
+		}
+		// the profiles are listed before the kubelet plugin starts, so the first claims find them.
+		plugin.cpuProfiles = newCPUProfileWatcher(config.CPUProfileClient)
+		plugin.lifecycle.add(plugin.cpuProfiles)
 	}
 
-	cdiMgr, err := NewCdiManager(logger, config.DriverName, cdiSpecDir)
-	if err != nil {
-		return nil, asyncErr, fmt.Errorf("failed to create CDI manager: %w", err)
+	if len(config.PinnedSystemdUnits) > 0 || len(config.PinnedProcessNames) > 0 {
+		pinner := procpinner.New(procpinner.ProcRoot, config.ReservedCPUs, config.PinnedSystemdUnits, config.PinnedProcessNames)
+		interval := config.ProcessPinningInterval
+		if interval <= 0 {
+			interval = procpinner.DefaultInterval
+		}
+		plugin.lifecycle.add(newRunnerComponent(COMPONENT_PROCESS_PINNER, func(ctx context.Context) {
+			pinner.Run(ctx, logger.WithName("procpinner"), interval)
+		}))
 	}
-	plugin.cdiMgr = cdiMgr
 
-	kubeletOpts := []kubeletplugin.Option{
-		kubeletplugin.DriverName(config.DriverName),
-		kubeletplugin.NodeName(config.NodeName),
-		kubeletplugin.KubeClient(clientset),
+	if config.MinSharedCPUs > 0 {
+		var recorder record.EventRecorder
+		if config.SharedPoolEvents {
+			var component Component
+			recorder, component = newEventRecorder(clientset, config.DriverName, config.NodeName)
+			plugin.lifecycle.add(component)
+		}
+		plugin.sharedPool = newSharedPoolMonitor(config.NodeName, config.MinSharedCPUs, recorder)
 	}
-	d, err := kubeletplugin.Start(ctx, plugin, kubeletOpts...)
+
+	if config.EnableCDI {
+		if gates.Enabled(FEATURE_GATE_DEGRADED_STARTUP) {
+			// the claims can't be prepared until the CDI manager is created, but the driver still starts.
+			cdiMgr := newDeferredCdiManager(func() (cdiManager, error) {
+				cdiMgr, err := NewCdiManager(logger, config.DriverName, paths.cdiSpecDir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create CDI manager: %w", err)
+				}
+				return cdiMgr, nil
+			}, plugin.startupStatus)
+			plugin.cdiMgr = cdiMgr
+			plugin.lifecycle.add(cdiMgr)
+		} else {
+			cdiMgr, err := NewCdiManager(logger, config.DriverName, paths.cdiSpecDir)
+			if err != nil {
+				return nil, asyncErr, fmt.Errorf("failed to create CDI manager: %w", err)
+			}
+			plugin.cdiMgr = cdiMgr
+		}
+		if plugin.faults != nil {
+			plugin.cdiMgr = &faultyCdiManager{cdiManager: plugin.cdiMgr, faults: plugin.faults}
+		}
+	} else {
+		logger.Info("CDI disabled, running in NRI-only mode")
+		plugin.nriOnly = true
+	}
+	// the kubelet doesn't prepare again the claims it prepared before a restart of the driver: the allocations
+	// and the containers of the claims bound to their pods, in NRI-only mode or with the pod-level pinning,
+	// can only come from the checkpoint.
+	podClaims, err := store.NewPodClaimsCheckpoint(filepath.Join(driverPluginPath, podClaimsCheckpointFile))
 	if err != nil {
-		return nil, asyncErr, fmt.Errorf("start kubelet plugin: %w", err)
+		return nil, asyncErr, err
 	}
-	plugin.draPlugin = d
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 30*time.Second, true, func(context.Context) (bool, error) {
-		status := d.RegistrationStatus()
-		if status == nil {
-			return false, nil
+	plugin.podClaims = podClaims
+	for claimUID, cpus := range podClaims.Allocations() {
+		if plugin.isSystemClaimAllocation(cpus) {
+			plugin.cpuAllocationStore.AddSystemClaimAllocation(logger, claimUID, cpus)
+		} else {
+			plugin.cpuAllocationStore.AddResourceClaimAllocation(logger, claimUID, cpus)
 		}
-		return status.PluginRegistered, nil
+	}
+
+	plugin.lifecycle.add(&kubeletPluginComponent{
+		cp:       plugin,
+		degraded: gates.Enabled(FEATURE_GATE_DEGRADED_STARTUP),
+		status:   plugin.startupStatus,
+		opts: []kubeletplugin.Option{
+			kubeletplugin.DriverName(config.DriverName),
+			kubeletplugin.NodeName(config.NodeName),
+			kubeletplugin.KubeClient(clientset),
+			kubeletplugin.PluginDataDirectoryPath(driverPluginPath),
+			kubeletplugin.RegistrarDirectoryPath(paths.kubeletRegistrarDir),
+		},
 	})
-	if err != nil {
+	if gates.Enabled(FEATURE_GATE_CLAIM_DEVICE_STATUS) {
+		plugin.claimStatus = newClaimStatusReporter(clientset, config.DriverName)
+		plugin.lifecycle.add(plugin.claimStatus)
+	}
+	if gates.Enabled(FEATURE_GATE_BINDING_CONDITIONS) {
+		plugin.lifecycle.add(newBindingConditionsReporter(plugin, clientset))
+	}
+	plugin.lifecycle.add(&nriEnforcer{cp: plugin, maxAttempts: maxAttempts, asyncErr: asyncErr})
+	// publish available resources
+	plugin.publisher = newResourcePublisher(plugin.PublishResources)
+	plugin.lifecycle.add(plugin.publisher)
+	if config.NodeStatusNamespace != "" {
+		interval := config.NodeStatusInterval
+		if interval <= 0 {
+			interval = DefaultNodeStatusInterval
+		}
+		plugin.lifecycle.add(newRunnerComponent(COMPONENT_NODE_STATUS, func(ctx context.Context) {
+			plugin.runNodeStatusUpdater(ctx, interval)
+		}))
+	}
+	if config.EfficiencyReportInterval > 0 {
+		plugin.efficiency = newEfficiencyReporter(plugin, procStatPath, config.EfficiencyReportInterval)
+		plugin.lifecycle.add(newRunnerComponent(COMPONENT_EFFICIENCY_REPORTER, plugin.efficiency.run))
+	}
+	// stopped like the other components, so the history is persisted before the driver exits.
+	plugin.lifecycle.add(newRunnerComponent(COMPONENT_PEAK_USAGE_RECORDER, func(ctx context.Context) {
+		plugin.runPeakUsageRecorder(ctx, peakUsageInterval)
+	}))
+	if config.SharedPoolFile != "" {
+		// the file is first written when the driver synchronizes with the runtime: until then, the one
+		// of the previous run is more accurate than the allocations known so far.
+		plugin.sharedPoolFile = newSharedPoolFile(config.SharedPoolFile)
+		plugin.lifecycle.add(newRunnerComponent(COMPONENT_SHARED_POOL_FILE, plugin.sharedPoolFile.run))
+	}
+	plugin.lifecycle.add(config.Components...)
+	plugin.hooks = config.Hooks
+
+	if err := plugin.lifecycle.start(ctx); err != nil {
 		return nil, asyncErr, err
 	}
+	if plugin.hooks.PostStart != nil {
+		if err := plugin.hooks.PostStart(ctx, plugin); err != nil {
+			plugin.lifecycle.stop(ctx)
+			return nil, asyncErr, fmt.Errorf("post-start hook failed: %w", err)
+		}
+	}
+
+	return plugin, asyncErr, nil
+}
 
-	// register the NRI plugin
-	nriOpts := []stub.Option{
-		stub.WithPluginName(config.DriverName),
-		stub.WithPluginIdx("00"),
-		// https://github.com/containerd/nri/pull/173
-		// Otherwise it silently exits the program
-		stub.WithOnClose(func() {
-			logger.Info("NRI plugin closed")
-		}),
+// cpuTopologyProvider discovers the CPU topology of the node.
+type cpuTopologyProvider interface {
+	GetCPUTopology(logger logr.Logger) (*cpuinfo.CPUTopology, error)
+}
+
+// RevalidateReservedCPUs discovers again the CPU topology and checks the reserved CPUs against it,
+// refreshing the reserved CPUs metrics. A mismatch is only reported: the published devices and the
+// allocations keep using the topology discovered at startup until the driver is restarted.
+func (cp *CPUDriver) RevalidateReservedCPUs(logger logr.Logger) error {
+	if cp.cpuTopologyProvider == nil {
+		return nil
 	}
-	stub, err := stub.New(plugin, nriOpts...)
+	topo, err := cp.cpuTopologyProvider.GetCPUTopology(logger)
 	if err != nil {
-		return nil, asyncErr, fmt.Errorf("failed to create plugin stub: %w", err)
+		return fmt.Errorf("failed to get CPU topology: %w", err)
 	}
-	plugin.nriPlugin = stub
+	return validateReservedCPUs(logger, topo, cp.reservedCPUs)
+}
 
-	go func() {
-		if err := runNRIPluginWithRetry(ctx, plugin.nriPlugin, maxAttempts); err != nil && ctx.Err() == nil {
-			logger.Error(err, "NRI plugin failed to be restarted", "maxAttempts", maxAttempts)
-			asyncErr <- err
+// resolveCPUPartitions resolves the CPU tiers, split by core type if so configured, and the CPU pools
+// carving the devices out of the topology, including the pool of the isolated CPUs read from sysfs.
+// The CPU topology must be known.
+func (cp *CPUDriver) resolveCPUPartitions(logger logr.Logger, config *Config, sysfs fs.FS) error {
+	topo := cp.cpuTopology
+	cpuTierSpecs := config.CPUTiers
+	if config.SplitCoreTypes {
+		if len(config.CPUTiers) > 0 {
+			return fmt.Errorf("the CPU tiers and the split by core type are mutually exclusive")
 		}
-	}()
+		if cpuTierSpecs = coreTypeTierSpecs(topo); cpuTierSpecs == nil {
+			logger.Info("the CPUs have a single core type, the devices are not split by core type")
+		}
+	}
+	var err error
+	if cp.cpuTiers, err = resolveCPUTiers(topo, cpuTierSpecs); err != nil {
+		return err
+	}
+	specs := map[string]string{}
+	if config.CPUPoolsFile != "" {
+		if specs, err = loadCPUPools(config.CPUPoolsFile); err != nil {
+			return err
+		}
+		logger.Info("CPU pools loaded", "file", config.CPUPoolsFile, "pools", len(specs))
+	}
+	if config.IsolatedCPUsPool {
+		if specs, err = withIsolatedCPUPool(logger, specs, sysfs, topo, config.ReservedCPUs); err != nil {
+			return err
+		}
+	}
+	if cp.cpuPools, err = resolveCPUPools(topo, config.ReservedCPUs, specs); err != nil {
+		return err
+	}
+	return cp.validateCPUPools()
+}
 
-	// publish available resources
-	go plugin.PublishResources(ctx)
+// validateTopology checks the configuration against the CPU topology of the node, resolving the names of the
+// devices and the CPU partitions it depends on.
+func (cp *CPUDriver) validateTopology(logger logr.Logger, config *Config, sysfs fs.FS) error {
+	if err := validateReservedCPUs(logger, cp.cpuTopology, config.ReservedCPUs); err != nil {
+		return err
+	}
+	if err := validateSocketDeviceModes(cp.cpuTopology, config.SocketDeviceModes); err != nil {
+		return err
+	}
+	if cp.usesGroupedDevices() && !(cp.collapseUMADevices && cp.collapsibleUMATopology()) {
+		if err := validateGroupBy(cp.cpuTopology, config.CPUDeviceGroupBy); err != nil {
+			return err
+		}
+	}
+	if err := cp.resolveNUMADeviceNames(logger, config, sysfs); err != nil {
+		return err
+	}
+	if err := cp.resolveCPUPartitions(logger, config, sysfs); err != nil {
+		return err
+	}
+	if err := cp.resolveMemoryBandwidth(logger, config, sysfs); err != nil {
+		return err
+	}
+	if err := cp.validateMixedDeviceMode(); err != nil {
+		return err
+	}
+	if err := cp.validateDeviceManagers(); err != nil {
+		return err
+	}
+	if err := cp.validateSocketNUMAPartitions(); err != nil {
+		return err
+	}
+	return cp.validateResourcePools()
+}
 
-	return plugin, asyncErr, nil
+// ValidateConfig checks the configuration against the CPU topology as Start does, without starting the driver
+// nor changing anything on the node.
+func ValidateConfig(ctx context.Context, config *Config, cpuInfoProvider CPUInfoProvider) error {
+	logger := ctxlog.FromContext(ctx)
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if _, err := newFeatureGates(knownFeatureGates, config.FeatureGates); err != nil {
+		return err
+	}
+	topo, err := cpuInfoProvider.GetCPUTopology(logger)
+	if err != nil {
+		return fmt.Errorf("failed to get CPU topology: %w", err)
+	}
+	cp := newCPUDriver(nil, config)
+	cp.cpuTopology = topo
+	return cp.validateTopology(logger, config, os.DirFS(device.SysfsRoot))
 }
 
-// Stop stops the CPUDriver.
-func (cp *CPUDriver) Stop() {
-	cp.nriPlugin.Stop()
-	cp.draPlugin.Stop()
+// newCPUDriver returns a driver set up from the configuration, before the discovery of the host.
+func newCPUDriver(clientset kubernetes.Interface, config *Config) *CPUDriver {
+	return &CPUDriver{
+		driverName:                config.DriverName,
+		nodeName:                  config.NodeName,
+		kubeClient:                clientset,
+		deviceNameToCPUID:         make(map[string]int),
+		deviceNameToSocketID:      make(map[string]int),
+		deviceNameToNUMANodeID:    make(map[string]int),
+		deviceNameToDie:           make(map[string]dieIdent),
+		deviceNameToCluster:       make(map[string]clusterIdent),
+		deviceNameToUncoreCache:   make(map[string]int),
+		deviceNameToCCD:           make(map[string]int),
+		deviceNameToCore:          make(map[string]coreIdent),
+		deviceNameToCPUTier:       make(map[string]string),
+		deviceNameToCPUPool:       make(map[string]string),
+		reservedCPUs:              config.ReservedCPUs,
+		cpuDeviceMode:             config.CPUDeviceMode,
+		cpuDeviceGroupBy:          config.CPUDeviceGroupBy,
+		socketDeviceModes:         config.SocketDeviceModes,
+		socketNUMAPartitions:      config.SocketNUMAPartitions,
+		claimTracker:              store.NewClaimTracker(),
+		podClaims:                 store.NewPodClaims(),
+		cdiPassthroughAnnotations: config.CDIPassthroughAnnotations,
+		cdiPassthroughTarget:      config.CDIPassthroughTarget,
+		pcieRootMapper:            store.NewPCIeRootMapper(),
+		devicesPerResourceSlice:   config.DevicesPerResourceSlice(),
+		sliceCleanupPolicy:        config.ResourceSliceCleanupPolicy,
+		sliceGrouping:             config.ResourceSliceGrouping,
+		resourcePoolPerGroup:      config.ResourcePoolPerGroup,
+		nriSupervisor:             newNRISupervisor(),
+		translateLegacyNames:      config.TranslateLegacyDeviceNames,
+		collapseUMADevices:        config.CollapseUMADevices,
+		legacyNUMAAttribute:       config.LegacyNUMAAttribute,
+		nodeStatusClient:          config.NodeStatusClient,
+		nodeStatusNamespace:       config.NodeStatusNamespace,
+		zeroCapacityPolicy:        config.ZeroCapacityPolicy,
+		capacityRequestPolicy:     config.CapacityRequestPolicy,
+		pinMemoryNodes:            config.PinMemoryNodes,
+		sharedPoolDevice:          config.SharedPoolDevice,
+		buildAttributes:           newBuildAttributes(buildinfo.Read()),
+		isolationLabel:            config.IsolationLabel,
+		isolationDomain:           config.IsolationDomain,
+		claimTiers:                store.NewClaimTiers(),
+		systemClaimNamespaces:     sets.New(config.SystemClaimNamespaces...),
+		podLevelPinningNamespaces: sets.New(config.PodLevelPinningNamespaces...),
+		strictEnforcement:         config.StrictEnforcement,
+		fullPCPUsOnly:             config.FullPCPUsOnly,
+		smtIsolation:              config.SMTIsolation,
+		preferAlignByUncoreCache:  config.PreferAlignByUncoreCache,
+		cpuSortingStrategy:        config.CPUSortingStrategy,
+		allocationPolicy:          config.AllocationPolicy,
+		fractionalCPUs:            config.FractionalCPUs,
+		unhealthyCPUsFile:         config.UnhealthyCPUsFile,
+	}
 }
 
-// Shutdown is called when the runtime is shutting down.
-func (cp *CPUDriver) Shutdown(ctx context.Context) {
+// validateReservedCPUs checks the reserved CPUs against the discovered topology.
+// Reserving CPUs which don't exist is an error, because the driver would publish
+// a capacity which doesn't match the intent of the user. Reserving a whole NUMA node
+// is legal, but very likely a mistake, so it is only reported.
+func validateReservedCPUs(logger logr.Logger, topo *cpuinfo.CPUTopology, reservedCPUs cpuset.CPUSet) error {
+	unknownCPUs := reservedCPUs.Difference(topo.CPUDetails.CPUs())
+	reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU).Set(float64(unknownCPUs.Size()))
+
+	fullyReservedNUMANodes := 0
+	for _, numaNodeID := range topo.CPUDetails.NUMANodes().List() {
+		numaNodeCPUs := topo.CPUDetails.CPUsInNUMANodes(numaNodeID)
+		if numaNodeCPUs.IsSubsetOf(reservedCPUs) {
+			logger.Info("all the CPUs of the NUMA node are reserved, no allocatable CPUs will be published for it", "numaNode", numaNodeID, "cpus", numaNodeCPUs.String())
+			fullyReservedNUMANodes++
+		}
+	}
+	reservedCPUsIssues.WithLabelValues(reservedCPUsIssueNUMANodeReserved).Set(float64(fullyReservedNUMANodes))
+
+	if !unknownCPUs.IsEmpty() {
+		return fmt.Errorf("reserved CPUs %q are not present in the CPU topology (available CPUs: %q)", unknownCPUs.String(), topo.CPUDetails.CPUs().String())
+	}
+	return nil
+}
+
+// Stop stops the CPUDriver. If the cleanup policy says so, the ResourceSlices
+// of the node are deleted once the plugin stopped publishing them.
+func (cp *CPUDriver) Stop(ctx context.Context) {
+	if cp.hooks.PreStop != nil {
+		cp.hooks.PreStop(ctx, cp)
+	}
+	cp.lifecycle.stop(ctx)
+
+	if cp.sliceCleanupPolicy != SLICE_CLEANUP_POLICY_DELETE {
+		return
+	}
 	logger := ctxlog.FromContext(ctx)
-	logger.Info("runtime shutting down")
+	ctx, cancel := context.WithTimeout(ctx, sliceCleanupTimeout)
+	defer cancel()
+	if err := cp.deleteResourceSlices(ctx); err != nil {
+		logger.Error(err, "failed to delete ResourceSlices on shutdown")
+		return
+	}
+	logger.Info("deleted ResourceSlices on shutdown")
 }
 
-type nriRunner interface {
-	Run(context.Context) error
+// listResourceSlices lists all the ResourceSlices published by this driver for this node.
+func (cp *CPUDriver) listResourceSlices(ctx context.Context) ([]resourceapi.ResourceSlice, error) {
+	sliceList, err := cp.kubeClient.ResourceV1().ResourceSlices().List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			resourceapi.ResourceSliceSelectorNodeName: cp.nodeName,
+			resourceapi.ResourceSliceSelectorDriver:   cp.driverName,
+		}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ResourceSlices: %w", err)
+	}
+	// the field selector already filters, but it doesn't hurt to double check.
+	return slices.DeleteFunc(sliceList.Items, func(slice resourceapi.ResourceSlice) bool {
+		return slice.Spec.Driver != cp.driverName || slice.Spec.NodeName == nil || *slice.Spec.NodeName != cp.nodeName
+	}), nil
 }
 
-func runNRIPluginWithRetry(ctx context.Context, plugin nriRunner, maxAttempts int) error {
-	logger := ctxlog.FromContext(ctx)
-	for i := 0; i < maxAttempts; i++ {
-		err := plugin.Run(ctx)
-		if ctx.Err() != nil {
-			logger.Info("NRI plugin stopped", "reason", "context cancelled")
-			return ctx.Err()
-		}
-		if err != nil {
-			logger.Error(err, "NRI plugin failed, restarting", "attempt", i+1, "maxAttempts", maxAttempts)
+// deleteResourceSlices deletes all the ResourceSlices published by this driver for this node.
+func (cp *CPUDriver) deleteResourceSlices(ctx context.Context) error {
+	resourceSlices, err := cp.listResourceSlices(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, slice := range resourceSlices {
+		err := cp.kubeClient.ResourceV1().ResourceSlices().Delete(ctx, slice.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete ResourceSlice %q: %w", slice.Name, err))
 		}
 	}
-	return fmt.Errorf("NRI plugin failed for %d times to be restarted", maxAttempts)
+	return errors.Join(errs...)
+}
+
+// Shutdown is called when the runtime is shutting down.
+func (cp *CPUDriver) Shutdown(ctx context.Context) {
+	logger := ctxlog.FromContext(ctx)
+	logger.Info("runtime shutting down")
 }
 
 // generateShortID generates a non-crypto safe unique ID in cases on which a full UUID would be a overkill.
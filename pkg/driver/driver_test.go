@@ -18,87 +18,56 @@ package driver
 
 import (
 	"context"
-	"fmt"
 	"strings"
-	"sync/atomic"
 	"testing"
 
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
 )
 
-type mockNRIRunner struct {
-	runFunc func(ctx context.Context) error
-	calls   atomic.Int32
-}
-
-func (m *mockNRIRunner) Run(ctx context.Context) error {
-	m.calls.Add(1)
-	return m.runFunc(ctx)
-}
-
-func TestRunNRIPluginWithRetry_ContextCancelled(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	runner := &mockNRIRunner{
-		runFunc: func(ctx context.Context) error {
-			cancel()
-			return context.Canceled
-		},
-	}
-
-	err := runNRIPluginWithRetry(ctx, runner, maxAttempts)
-	require.ErrorIs(t, err, context.Canceled, "should return context.Canceled when context is cancelled")
-	require.Equal(t, int32(1), runner.calls.Load(), "Run should be called exactly once before context cancel")
-}
-
-func TestRunNRIPluginWithRetry_ContextCancelledAfterSeveralRetries(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	var calls atomic.Int32
-	runner := &mockNRIRunner{
-		runFunc: func(ctx context.Context) error {
-			n := calls.Add(1)
-			if n >= 3 {
-				cancel()
-				return context.Canceled
-			}
-			return fmt.Errorf("transient error")
-		},
+// newTestDriver returns a driver on the topology of the CPUs, grouping by NUMA node and without reserved CPUs,
+// set up by the options before the lookup maps are built.
+func newTestDriver(t *testing.T, cpuInfos []cpuinfo.CPUInfo, opts ...func(*CPUDriver)) *CPUDriver {
+	t.Helper()
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: cpuInfos}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		driverName:               testDriverName,
+		nodeName:                 testNodeName,
+		cpuTopology:              topo,
+		cdiMgr:                   newMockCdiMgr(),
+		cpuDeviceMode:            CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:         GROUP_BY_NUMA_NODE,
+		reservedCPUs:             cpuset.New(),
+		pcieRootMapper:           store.NewPCIeRootMapper(),
+		claimTiers:               store.NewClaimTiers(),
+		preferAlignByUncoreCache: true,
+		podConfigStore:           store.NewPodConfig(),
+		claimTracker:             store.NewClaimTracker(),
+		devicesPerResourceSlice:  resourceapi.ResourceSliceMaxDevices,
 	}
-
-	err := runNRIPluginWithRetry(ctx, runner, maxAttempts)
-	require.ErrorIs(t, err, context.Canceled, "should return context.Canceled when context is cancelled")
-	require.Equal(t, int32(3), calls.Load(), "Run should be called 3 times before context cancel")
-}
-
-func TestRunNRIPluginWithRetry_ExhaustsAttempts(t *testing.T) {
-	ctx := context.Background()
-
-	runner := &mockNRIRunner{
-		runFunc: func(ctx context.Context) error {
-			return fmt.Errorf("persistent error")
-		},
+	for _, opt := range opts {
+		opt(driver)
 	}
-
-	err := runNRIPluginWithRetry(ctx, runner, 3)
-	require.Error(t, err, "should return error after exhausting attempts")
-	require.Equal(t, int32(3), runner.calls.Load(), "Run should be called exactly maxAttempts times")
+	driver.cpuAllocationStore = store.NewCPUAllocation(topo, driver.reservedCPUs)
+	driver.initializeDeviceLookupMaps()
+	return driver
 }
 
-func TestRunNRIPluginWithRetry_SuccessfulRunNoRetry(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	runner := &mockNRIRunner{
-		runFunc: func(ctx context.Context) error {
-			cancel()
-			return nil
-		},
-	}
-
-	err := runNRIPluginWithRetry(ctx, runner, maxAttempts)
-	require.ErrorIs(t, err, context.Canceled)
-	require.Equal(t, int32(1), runner.calls.Load())
+// capacityValue returns the value of a capacity of a device, 0 if the device has none.
+func capacityValue(device resourceapi.Device, name resourceapi.QualifiedName) int64 {
+	capacity := device.Capacity[name]
+	return capacity.Value.Value()
 }
 
 func TestGenerateShortID(t *testing.T) {
@@ -141,3 +110,109 @@ func isHex(s string) bool {
 	}
 	return true
 }
+
+func TestValidateReservedCPUs(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		reservedCPUs          cpuset.CPUSet
+		expectedError         string
+		expectedUnknownCPUs   float64
+		expectedReservedNUMAs float64
+	}{
+		{
+			name:         "no reserved CPUs",
+			reservedCPUs: cpuset.New(),
+		},
+		{
+			name:         "reserved CPUs within the topology",
+			reservedCPUs: cpuset.New(0, 4),
+		},
+		{
+			name:                "reserved CPUs not in the topology",
+			reservedCPUs:        cpuset.New(0, 8, 9),
+			expectedError:       "reserved CPUs \"8-9\" are not present in the CPU topology",
+			expectedUnknownCPUs: 2,
+		},
+		{
+			name:                  "whole NUMA node reserved",
+			reservedCPUs:          cpuset.New(0, 1, 4, 5),
+			expectedReservedNUMAs: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			err = validateReservedCPUs(logger, topo, tc.reservedCPUs)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectedUnknownCPUs, testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU)))
+			require.Equal(t, tc.expectedReservedNUMAs, testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueNUMANodeReserved)))
+		})
+	}
+}
+
+func TestRevalidateReservedCPUs(t *testing.T) {
+	logger := testr.New(t)
+	// CPUs 6 and 7 went offline after the driver started.
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT[:6]}
+	driver := &CPUDriver{
+		cpuTopologyProvider: mockProvider,
+		reservedCPUs:        cpuset.New(0, 7),
+	}
+	require.ErrorContains(t, driver.RevalidateReservedCPUs(logger), "reserved CPUs \"7\" are not present in the CPU topology")
+	require.Equal(t, float64(1), testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU)))
+
+	driver.reservedCPUs = cpuset.New(0)
+	require.NoError(t, driver.RevalidateReservedCPUs(logger))
+	require.Equal(t, float64(0), testutil.ToFloat64(reservedCPUsIssues.WithLabelValues(reservedCPUsIssueUnknownCPU)))
+}
+
+func TestDevicesPerResourceSlice(t *testing.T) {
+	require.Equal(t, resourceapi.ResourceSliceMaxDevices, Config{}.DevicesPerResourceSlice())
+	require.Equal(t, resourceapi.ResourceSliceMaxDevicesWithAdvancedFeatures, Config{ExposePCIeRoots: true}.DevicesPerResourceSlice())
+	require.Equal(t, 16, Config{ResourceSliceMaxDevices: 16}.DevicesPerResourceSlice())
+	// the API limit always wins, Start refuses the larger values.
+	require.Equal(t, resourceapi.ResourceSliceMaxDevicesWithAdvancedFeatures, Config{ExposePCIeRoots: true, ResourceSliceMaxDevices: resourceapi.ResourceSliceMaxDevices}.DevicesPerResourceSlice())
+}
+
+func TestDeleteResourceSlices(t *testing.T) {
+	newSlice := func(name, driverName, nodeName string) *resourceapi.ResourceSlice {
+		return &resourceapi.ResourceSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: resourceapi.ResourceSliceSpec{
+				Driver:   driverName,
+				NodeName: ptr.To(nodeName),
+				Pool:     resourceapi.ResourcePool{Name: nodeName},
+			},
+		}
+	}
+	client := fake.NewClientset(
+		newSlice("own-slice-1", testDriverName, testNodeName),
+		newSlice("own-slice-2", testDriverName, testNodeName),
+		newSlice("other-node-slice", testDriverName, "other-node"),
+		newSlice("other-driver-slice", "other.driver", testNodeName),
+	)
+	driver := &CPUDriver{
+		driverName: testDriverName,
+		nodeName:   testNodeName,
+		kubeClient: client,
+	}
+
+	require.NoError(t, driver.deleteResourceSlices(context.Background()))
+
+	sliceList, err := client.ResourceV1().ResourceSlices().List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, slice := range sliceList.Items {
+		names = append(names, slice.Name)
+	}
+	require.ElementsMatch(t, []string{"other-node-slice", "other-driver-slice"}, names)
+}
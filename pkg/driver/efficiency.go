@@ -0,0 +1,322 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// procStatPath is the kernel CPU accounting file. It is not namespaced: the driver reads the host CPU times.
+	procStatPath = "/proc/stat"
+	// podTemplateHashLabel is the label the Deployment controller sets on its ReplicaSets and their pods.
+	podTemplateHashLabel = "pod-template-hash"
+)
+
+// WorkloadEfficiency compares the exclusive CPUs allocated to the pods of a workload with their utilization.
+type WorkloadEfficiency struct {
+	Namespace string `json:"namespace"`
+	// Kind and Name identify the owner of the pods, e.g. a Deployment or a StatefulSet.
+	// The pods without a controller are reported on their own, with kind Pod.
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Pods int    `json:"pods"`
+	// AllocatedCPUs is the number of exclusive CPUs allocated to the claims of the pods.
+	AllocatedCPUs int `json:"allocatedCPUs"`
+	// Utilization is the mean utilization of the allocated CPUs over the last interval, from 0 to 1.
+	Utilization float64 `json:"utilization"`
+	// IdleCPUs is the number of allocated CPUs left unused on average over the last interval.
+	IdleCPUs float64 `json:"idleCPUs"`
+}
+
+// EfficiencyReport is the periodic report of the efficiency of the exclusive CPU allocations of the node.
+type EfficiencyReport struct {
+	APIVersion string `json:"apiVersion"`
+	// Time is when the report was produced, zero until the first report after two samples of the CPU times.
+	Time      time.Time            `json:"time"`
+	Interval  string               `json:"interval"`
+	Workloads []WorkloadEfficiency `json:"workloads"`
+}
+
+// cpuTimes are the cumulative busy and total times of a CPU, in USER_HZ.
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+// readCPUTimes parses the per-CPU times of the /proc/stat file.
+func readCPUTimes(path string) (map[int]cpuTimes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	times := make(map[int]cpuTimes)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpuID, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+		if err != nil {
+			return nil, fmt.Errorf("malformed %q line %q: %w", path, scanner.Text(), err)
+		}
+		// user nice system idle iowait irq softirq steal; guest and guest_nice are already in user and nice.
+		var values [8]uint64
+		for i := 0; i < len(values) && i+1 < len(fields); i++ {
+			values[i], err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed %q line %q: %w", path, scanner.Text(), err)
+			}
+		}
+		var total uint64
+		for _, value := range values {
+			total += value
+		}
+		idle := values[3] + values[4]
+		times[cpuID] = cpuTimes{busy: total - idle, total: total}
+	}
+	return times, scanner.Err()
+}
+
+// cpuUtilization returns the mean utilization of the CPUs between two samples of their times.
+func cpuUtilization(previous, current map[int]cpuTimes, cpus cpuset.CPUSet) float64 {
+	var busy, total uint64
+	for _, cpuID := range cpus.UnsortedList() {
+		prev, ok := previous[cpuID]
+		if !ok {
+			continue
+		}
+		cur, ok := current[cpuID]
+		// the counters only go backwards if the CPU went offline and back.
+		if !ok || cur.total < prev.total || cur.busy < prev.busy {
+			continue
+		}
+		busy += cur.busy - prev.busy
+		total += cur.total - prev.total
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(busy) / float64(total)
+}
+
+// workloadOwner returns the kind and name of the workload owning a pod. The pods of the ReplicaSets
+// created by a Deployment are attributed to the Deployment, whose name is the ReplicaSet name without
+// the pod template hash, so the ReplicaSets don't need to be read.
+func workloadOwner(pod *corev1.Pod) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod", pod.Name
+	}
+	if owner.Kind == "ReplicaSet" {
+		if hash := pod.Labels[podTemplateHashLabel]; hash != "" {
+			if name, ok := strings.CutSuffix(owner.Name, "-"+hash); ok {
+				return "Deployment", name
+			}
+		}
+	}
+	return owner.Kind, owner.Name
+}
+
+// efficiencyReporter periodically compares the exclusive CPUs allocated to the workloads of the node with their utilization.
+type efficiencyReporter struct {
+	cp       *CPUDriver
+	statPath string
+	interval time.Duration
+
+	lock     sync.Mutex
+	previous map[int]cpuTimes
+	report   EfficiencyReport
+}
+
+func newEfficiencyReporter(cp *CPUDriver, statPath string, interval time.Duration) *efficiencyReporter {
+	return &efficiencyReporter{
+		cp:       cp,
+		statPath: statPath,
+		interval: interval,
+		report: EfficiencyReport{
+			APIVersion: ClaimsAPIVersion,
+			Interval:   interval.String(),
+			Workloads:  []WorkloadEfficiency{},
+		},
+	}
+}
+
+// podsOnNode returns the pods of the node, by UID.
+func (r *efficiencyReporter) podsOnNode(ctx context.Context) (map[types.UID]*corev1.Pod, error) {
+	pods, err := r.cp.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + r.cp.nodeName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of node %s: %w", r.cp.nodeName, err)
+	}
+	podsByUID := make(map[types.UID]*corev1.Pod, len(pods.Items))
+	for i := range pods.Items {
+		podsByUID[pods.Items[i].UID] = &pods.Items[i]
+	}
+	return podsByUID, nil
+}
+
+// update samples the CPU times and, from the second sample on, refreshes the report and the metrics.
+func (r *efficiencyReporter) update(ctx context.Context) error {
+	current, err := readCPUTimes(r.statPath)
+	if err != nil {
+		return err
+	}
+	podsByUID, err := r.podsOnNode(ctx)
+	if err != nil {
+		return err
+	}
+
+	type workloadKey struct {
+		namespace, kind, name string
+	}
+	cpusByWorkload := make(map[workloadKey]cpuset.CPUSet)
+	podsByWorkload := make(map[workloadKey]map[types.UID]struct{})
+	containersByClaim := r.cp.podConfigStore.GetContainersByClaim()
+	for claimUID, cpus := range r.cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		for _, ctr := range containersByClaim[claimUID] {
+			pod, ok := podsByUID[ctr.PodUID]
+			if !ok {
+				continue
+			}
+			kind, name := workloadOwner(pod)
+			key := workloadKey{namespace: pod.Namespace, kind: kind, name: name}
+			cpusByWorkload[key] = cpusByWorkload[key].Union(cpus)
+			if podsByWorkload[key] == nil {
+				podsByWorkload[key] = make(map[types.UID]struct{})
+			}
+			podsByWorkload[key][pod.UID] = struct{}{}
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	previous := r.previous
+	r.previous = current
+	if previous == nil {
+		return nil
+	}
+
+	workloads := []WorkloadEfficiency{}
+	for key, cpus := range cpusByWorkload {
+		utilization := cpuUtilization(previous, current, cpus)
+		workloads = append(workloads, WorkloadEfficiency{
+			Namespace:     key.namespace,
+			Kind:          key.kind,
+			Name:          key.name,
+			Pods:          len(podsByWorkload[key]),
+			AllocatedCPUs: cpus.Size(),
+			Utilization:   utilization,
+			IdleCPUs:      float64(cpus.Size()) * (1 - utilization),
+		})
+	}
+	slices.SortFunc(workloads, func(a, b WorkloadEfficiency) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Name, b.Name))
+	})
+	r.report.Time = time.Now()
+	r.report.Workloads = workloads
+
+	// the workloads gone since the last report must not linger in the metrics.
+	workloadExclusiveCPUs.Reset()
+	workloadExclusiveCPUsUtilization.Reset()
+	for _, workload := range workloads {
+		workloadExclusiveCPUs.WithLabelValues(workload.Namespace, workload.Kind, workload.Name).Set(float64(workload.AllocatedCPUs))
+		workloadExclusiveCPUsUtilization.WithLabelValues(workload.Namespace, workload.Kind, workload.Name).Set(workload.Utilization)
+	}
+	return nil
+}
+
+// current returns the last report.
+func (r *efficiencyReporter) current() EfficiencyReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := r.report
+	report.Workloads = slices.Clone(r.report.Workloads)
+	return report
+}
+
+// run periodically updates the report until the context is cancelled. The containers of the claims
+// are known from the NRI plugin, so the report is paused while the plugin is not connected, rather
+// than attributing the CPUs after stale containers, and sampled afresh once it connects again.
+func (r *efficiencyReporter) run(ctx context.Context) {
+	ctx, logger := ctxlog.WithValues(ctx, "interval", r.interval)
+	logger.Info("reporting the efficiency of the exclusive CPU allocations")
+	nriConditions := r.cp.SubscribeNRICondition()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	connected := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case condition := <-nriConditions:
+			wasConnected := connected
+			connected = condition.State == NRI_STATE_CONNECTED
+			if connected == wasConnected {
+				continue
+			}
+			if !connected {
+				logger.Info("pausing the efficiency report", "nriState", condition.State, "reason", condition.Reason)
+				r.reset()
+				continue
+			}
+			logger.Info("resuming the efficiency report")
+		case <-ticker.C:
+			if !connected {
+				continue
+			}
+		}
+		if err := r.update(ctx); err != nil {
+			logger.Error(err, "failed to update the efficiency report, will retry")
+			continue
+		}
+		logger.V(4).Info("updated the efficiency report")
+	}
+}
+
+// reset forgets the last sample of the CPU times, so the next update starts a new interval.
+func (r *efficiencyReporter) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.previous = nil
+}
+
+// efficiencyReport returns the last efficiency report, empty if not enabled.
+func (cp *CPUDriver) efficiencyReport() EfficiencyReport {
+	if cp.efficiency == nil {
+		return EfficiencyReport{APIVersion: ClaimsAPIVersion, Workloads: []WorkloadEfficiency{}}
+	}
+	return cp.efficiency.current()
+}
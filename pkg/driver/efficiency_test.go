@@ -0,0 +1,226 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+func TestReadCPUTimes(t *testing.T) {
+	statPath := filepath.Join(t.TempDir(), "stat")
+	require.NoError(t, os.WriteFile(statPath, []byte(`cpu  400 0 100 1500 0 0 0 0 0 0
+cpu0 100 0 50 800 50 0 0 0 0 0
+cpu1 300 0 50 700 0 0 0 0 20 0
+intr 12345
+ctxt 6789
+`), 0600))
+
+	times, err := readCPUTimes(statPath)
+	require.NoError(t, err)
+	require.Equal(t, map[int]cpuTimes{
+		0: {busy: 150, total: 1000},
+		1: {busy: 350, total: 1050},
+	}, times)
+
+	_, err = readCPUTimes(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestCPUUtilization(t *testing.T) {
+	previous := map[int]cpuTimes{0: {busy: 100, total: 1000}, 1: {busy: 100, total: 1000}, 2: {busy: 500, total: 1000}}
+	current := map[int]cpuTimes{0: {busy: 200, total: 1100}, 1: {busy: 150, total: 1100}, 2: {busy: 10, total: 20}}
+
+	require.InDelta(t, 1.0, cpuUtilization(previous, current, cpuset.New(0)), 1e-9)
+	require.InDelta(t, 0.75, cpuUtilization(previous, current, cpuset.New(0, 1)), 1e-9)
+	// the counters of CPU 2 went backwards, and CPU 3 is unknown.
+	require.InDelta(t, 0.5, cpuUtilization(previous, current, cpuset.New(1, 2, 3)), 1e-9)
+	require.Zero(t, cpuUtilization(previous, current, cpuset.New(3)))
+}
+
+func TestWorkloadOwner(t *testing.T) {
+	controller := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}}
+	}
+	testCases := []struct {
+		name         string
+		pod          *corev1.Pod
+		expectedKind string
+		expectedName string
+	}{
+		{
+			name:         "no controller",
+			pod:          &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "standalone"}},
+			expectedKind: "Pod",
+			expectedName: "standalone",
+		},
+		{
+			name: "deployment",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-5d4f8b7c9-abcde",
+				Labels:          map[string]string{podTemplateHashLabel: "5d4f8b7c9"},
+				OwnerReferences: controller("ReplicaSet", "web-5d4f8b7c9"),
+			}},
+			expectedKind: "Deployment",
+			expectedName: "web",
+		},
+		{
+			name: "bare replicaset",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:            "rs-abcde",
+				OwnerReferences: controller("ReplicaSet", "rs"),
+			}},
+			expectedKind: "ReplicaSet",
+			expectedName: "rs",
+		},
+		{
+			name: "statefulset",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:            "db-0",
+				OwnerReferences: controller("StatefulSet", "db"),
+			}},
+			expectedKind: "StatefulSet",
+			expectedName: "db",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kind, name := workloadOwner(tc.pod)
+			require.Equal(t, tc.expectedKind, kind)
+			require.Equal(t, tc.expectedName, name)
+		})
+	}
+}
+
+func TestEfficiencyReporter(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	statefulPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "db",
+				UID:             types.UID(name + "-uid"),
+				OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: ptr.To(true)}},
+			},
+			Spec: corev1.PodSpec{NodeName: testNodeName},
+		}
+	}
+
+	driver := &CPUDriver{
+		nodeName:           testNodeName,
+		kubeClient:         fake.NewClientset(statefulPod("db-0"), statefulPod("db-1")),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podConfigStore:     store.NewPodConfig(),
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-0", cpuset.New(0, 4))
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(1, 5))
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-pending", cpuset.New(2))
+	driver.podConfigStore.SetContainerState("db-0-uid", store.NewContainerState("db", "ctr-0", "claim-0"))
+	driver.podConfigStore.SetContainerState("db-1-uid", store.NewContainerState("db", "ctr-1", "claim-1"))
+
+	statPath := filepath.Join(t.TempDir(), "stat")
+	writeStat := func(busy [8]uint64, total uint64) {
+		content := "cpu  0 0 0 0 0 0 0 0 0 0\n"
+		for cpuID, cpuBusy := range busy {
+			content += fmt.Sprintf("cpu%d %d 0 0 %d 0 0 0 0 0 0\n", cpuID, cpuBusy, total-cpuBusy)
+		}
+		require.NoError(t, os.WriteFile(statPath, []byte(content), 0600))
+	}
+
+	driver.efficiency = newEfficiencyReporter(driver, statPath, time.Minute)
+	writeStat([8]uint64{}, 1000)
+	require.NoError(t, driver.efficiency.update(context.Background()))
+	// a single sample gives no utilization.
+	require.Empty(t, driver.efficiencyReport().Workloads)
+	require.True(t, driver.efficiencyReport().Time.IsZero())
+
+	// over the interval, the CPUs 0,4 of db-0 are fully busy and the CPUs 1,5 of db-1 idle.
+	writeStat([8]uint64{1000, 0, 0, 0, 1000, 0, 0, 0}, 2000)
+	require.NoError(t, driver.efficiency.update(context.Background()))
+
+	report := driver.efficiencyReport()
+	require.False(t, report.Time.IsZero())
+	require.Equal(t, ClaimsAPIVersion, report.APIVersion)
+	require.Equal(t, "1m0s", report.Interval)
+	require.Equal(t, []WorkloadEfficiency{
+		{Namespace: "db", Kind: "StatefulSet", Name: "db", Pods: 2, AllocatedCPUs: 4, Utilization: 0.5, IdleCPUs: 2},
+	}, report.Workloads)
+	require.Equal(t, 4.0, testutil.ToFloat64(workloadExclusiveCPUs.WithLabelValues("db", "StatefulSet", "db")))
+	require.Equal(t, 0.5, testutil.ToFloat64(workloadExclusiveCPUsUtilization.WithLabelValues("db", "StatefulSet", "db")))
+}
+
+func TestEfficiencyReportDisabled(t *testing.T) {
+	driver := &CPUDriver{}
+	require.Equal(t, EfficiencyReport{APIVersion: ClaimsAPIVersion, Workloads: []WorkloadEfficiency{}}, driver.efficiencyReport())
+}
+
+func TestEfficiencyReporterPausedWhileNRIDisconnected(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	driver := &CPUDriver{
+		nodeName:           testNodeName,
+		kubeClient:         fake.NewClientset(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		podConfigStore:     store.NewPodConfig(),
+		nriSupervisor:      newNRISupervisor(),
+	}
+	statPath := filepath.Join(t.TempDir(), "stat")
+	require.NoError(t, os.WriteFile(statPath, []byte("cpu  0 0 0 0 0 0 0 0 0 0\ncpu0 0 0 0 1000 0 0 0 0 0 0\n"), 0600))
+	driver.efficiency = newEfficiencyReporter(driver, statPath, 10*time.Millisecond)
+	sampled := func() bool {
+		driver.efficiency.lock.Lock()
+		defer driver.efficiency.lock.Unlock()
+		return driver.efficiency.previous != nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go driver.efficiency.run(ctx)
+
+	// not connected yet: the CPU times are not sampled.
+	require.Never(t, sampled, 100*time.Millisecond, 10*time.Millisecond)
+
+	driver.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+	require.Eventually(t, func() bool { return !driver.efficiencyReport().Time.IsZero() }, 5*time.Second, 10*time.Millisecond)
+
+	// disconnected: the sample is dropped, and no new one is taken until the plugin connects again.
+	driver.nriSupervisor.setCondition(NRI_STATE_RECONNECTING, "ConnectionClosed", "the runtime closed the connection")
+	require.Eventually(t, func() bool { return !sampled() }, 5*time.Second, 10*time.Millisecond)
+	require.Never(t, sampled, 100*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,211 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/cpuset"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// exampleClaimPrefix is the prefix of the names of the example claims, followed by the device name.
+	exampleClaimPrefix = "example-"
+	// exampleRequestName is the name of the device request of the example claims.
+	exampleRequestName = "cpus"
+)
+
+// exampleSelectorAttributes are the attributes the selectors of the example claims may compare, the most
+// specific first: only the attributes telling the device apart from the other published devices are used.
+var exampleSelectorAttributes = []resourceapi.QualifiedName{
+	AttributeCPUID,
+	AttributeCoreID,
+	AttributeCPUPool,
+	AttributeSharedPool,
+	AttributeNUMANodeID,
+	AttributeCacheL3ID,
+	AttributeClusterID,
+	AttributeDieID,
+	AttributeSocketID,
+	AttributeCPUTier,
+	AttributeCoreType,
+}
+
+// exampleClaim is an example claim allocating from a published device, with a comment describing it.
+type exampleClaim struct {
+	comment string
+	claim   *resourceapi.ResourceClaim
+}
+
+// publishedDeviceCPUs returns the CPUs of the devices the driver publishes, by device name. The shared pool
+// device has no CPU of its own.
+func (cp *CPUDriver) publishedDeviceCPUs() map[string]cpuset.CPUSet {
+	deviceCPUs := make(map[string]cpuset.CPUSet)
+	if cp.usesGroupedDevices() {
+		for _, device := range cp.groupedCPUDeviceInfos() {
+			deviceCPUs[device.name] = device.cpus
+		}
+	}
+	for _, partition := range cp.socketNUMAPartitionInfos() {
+		deviceCPUs[partition.name] = partition.cpus
+	}
+	for pool, cpus := range cp.cpuPools {
+		deviceCPUs[cpuPoolDeviceName(pool)] = cpus
+	}
+	if cp.usesIndividualDevices() {
+		for _, device := range cp.cpuDeviceInfos() {
+			deviceCPUs[device.name] = cpuset.New(device.cpu.CpuID)
+		}
+	}
+	return deviceCPUs
+}
+
+// exampleClaims returns, for each device of the last publication which can be allocated given the CPUs
+// allocated on the node, an example claim allocating from it, sorted by pool. The grouped devices are
+// requested the CPUs of a core, or less if they have fewer.
+func (cp *CPUDriver) exampleClaims() []exampleClaim {
+	pools := cp.publishedPools.get()
+	var devices []resourceapi.Device
+	poolOf := make(map[string]string)
+	for _, poolName := range slices.Sorted(maps.Keys(pools)) {
+		for _, slice := range pools[poolName].Slices {
+			for _, device := range slice.Devices {
+				devices = append(devices, device)
+				poolOf[device.Name] = poolName
+			}
+		}
+	}
+
+	deviceCPUs := cp.publishedDeviceCPUs()
+	sharedCPUs := cp.cpuAllocationStore.GetSharedCPUs()
+	var examples []exampleClaim
+	for _, device := range devices {
+		request := &resourceapi.ExactDeviceRequest{
+			DeviceClassName: cp.driverName,
+			Selectors:       exampleSelectors(device, devices),
+		}
+		numCPUs := int64(1)
+		if capacity, ok := device.Capacity[cpuResourceQualifiedName]; ok {
+			numCPUs = min(int64(cp.cpuTopology.CPUsPerCore()), capacity.Value.Value())
+			request.Capacity = &resourceapi.CapacityRequirements{
+				Requests: map[resourceapi.QualifiedName]resource.Quantity{
+					cpuResourceQualifiedName: *resource.NewQuantity(numCPUs, resource.DecimalSI),
+				},
+			}
+		}
+		comment := fmt.Sprintf("device %s of pool %s", device.Name, poolOf[device.Name])
+		if cpus, ok := deviceCPUs[device.Name]; ok {
+			freeCPUs := sharedCPUs.Intersection(cpus)
+			if int64(freeCPUs.Size()) < numCPUs {
+				continue
+			}
+			comment = fmt.Sprintf("%s: %d CPUs requested, %d of its %d CPUs are free", comment, numCPUs, freeCPUs.Size(), cpus.Size())
+		} else {
+			comment += ": the shared CPUs"
+		}
+		examples = append(examples, exampleClaim{
+			comment: comment,
+			claim: &resourceapi.ResourceClaim{
+				TypeMeta:   metav1.TypeMeta{APIVersion: resourceapi.SchemeGroupVersion.String(), Kind: "ResourceClaim"},
+				ObjectMeta: metav1.ObjectMeta{Name: exampleClaimPrefix + device.Name},
+				Spec: resourceapi.ResourceClaimSpec{
+					Devices: resourceapi.DeviceClaim{
+						Requests: []resourceapi.DeviceRequest{{Name: exampleRequestName, Exactly: request}},
+					},
+				},
+			},
+		})
+	}
+	return examples
+}
+
+// exampleSelectors returns the CEL selector of the device: the comparison of the fewest attributes, taken in
+// the order of exampleSelectorAttributes, matching none of the other devices. If the attributes can't tell the
+// device apart, the selector also matches the devices with the same attributes.
+func exampleSelectors(device resourceapi.Device, devices []resourceapi.Device) []resourceapi.DeviceSelector {
+	others := slices.DeleteFunc(slices.Clone(devices), func(other resourceapi.Device) bool { return other.Name == device.Name })
+	var terms []string
+	for _, name := range exampleSelectorAttributes {
+		if len(others) == 0 {
+			break
+		}
+		attr, ok := device.Attributes[name]
+		if !ok {
+			continue
+		}
+		matching := slices.DeleteFunc(slices.Clone(others), func(other resourceapi.Device) bool {
+			otherAttr, ok := other.Attributes[name]
+			return !ok || celValue(otherAttr) != celValue(attr)
+		})
+		if len(matching) == len(others) {
+			continue
+		}
+		domain, id, _ := strings.Cut(string(name), "/")
+		terms = append(terms, fmt.Sprintf("device.attributes[%q].%s == %s", domain, id, celValue(attr)))
+		others = matching
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return []resourceapi.DeviceSelector{{CEL: &resourceapi.CELDeviceSelector{Expression: strings.Join(terms, " && ")}}}
+}
+
+// celValue returns the CEL literal of the attribute value.
+func celValue(attr resourceapi.DeviceAttribute) string {
+	switch {
+	case attr.IntValue != nil:
+		return strconv.FormatInt(*attr.IntValue, 10)
+	case attr.BoolValue != nil:
+		return strconv.FormatBool(*attr.BoolValue)
+	case attr.StringValue != nil:
+		return strconv.Quote(*attr.StringValue)
+	case attr.VersionValue != nil:
+		return fmt.Sprintf("semver(%q)", *attr.VersionValue)
+	}
+	return ""
+}
+
+// exampleClaimsYAML renders the example claims as a multi-document YAML stream, ready to be applied.
+func (cp *CPUDriver) exampleClaimsYAML() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, example := range cp.exampleClaims() {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(example.claim)
+		if err != nil {
+			return nil, err
+		}
+		unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(obj, "status")
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "---\n# %s\n", example.comment)
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
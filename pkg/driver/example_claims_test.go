@@ -0,0 +1,114 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"sigs.k8s.io/yaml"
+)
+
+func TestExampleClaimsGrouped(t *testing.T) {
+	logger := testr.New(t)
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.podConfigStore = store.NewPodConfig()
+	})
+	// nothing is published yet.
+	require.Empty(t, driver.exampleClaims())
+
+	driver.publishedPools.set(driver.resourcePools(driver.createGroupedCPUDeviceChunks(logger)))
+	// a single CPU of NUMA node 0 is left, less than a core.
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-a", cpuset.New(0, 1, 4))
+
+	rec := httptest.NewRecorder()
+	driver.ClaimsAPIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ExamplesAPIPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	require.Contains(t, body, "# device cpudevnuma001 of pool "+testNodeName+": 2 CPUs requested, 4 of its 4 CPUs are free\n")
+	require.NotContains(t, body, "cpudevnuma000")
+	require.NotContains(t, body, "creationTimestamp")
+	require.NotContains(t, body, "status")
+
+	docs := strings.Split(strings.TrimPrefix(body, "---\n"), "---\n")
+	require.Len(t, docs, 1)
+	var claim resourceapi.ResourceClaim
+	require.NoError(t, yaml.UnmarshalStrict([]byte(docs[0]), &claim))
+	require.Equal(t, "ResourceClaim", claim.Kind)
+	require.Equal(t, "resource.k8s.io/v1", claim.APIVersion)
+	require.Equal(t, "example-cpudevnuma001", claim.Name)
+	require.Len(t, claim.Spec.Devices.Requests, 1)
+	request := claim.Spec.Devices.Requests[0].Exactly
+	require.NotNil(t, request)
+	require.Equal(t, testDriverName, request.DeviceClassName)
+	quantity := request.Capacity.Requests[cpuResourceQualifiedName]
+	require.Equal(t, "2", quantity.String())
+	require.Equal(t, []resourceapi.DeviceSelector{
+		{CEL: &resourceapi.CELDeviceSelector{Expression: `device.attributes["dra.cpu"].numaNodeID == 1`}},
+	}, request.Selectors)
+}
+
+func TestExampleClaimsIndividual(t *testing.T) {
+	logger := testr.New(t)
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.publishedPools.set(driver.resourcePools(driver.createCPUDeviceChunks()))
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-a", cpuset.New(0))
+
+	examples := driver.exampleClaims()
+	require.Len(t, examples, 3)
+	for _, example := range examples {
+		request := example.claim.Spec.Devices.Requests[0].Exactly
+		require.Nil(t, request.Capacity)
+		require.Len(t, request.Selectors, 1)
+		require.Contains(t, request.Selectors[0].CEL.Expression, `device.attributes["dra.cpu"].cpuID == `)
+		require.NotContains(t, request.Selectors[0].CEL.Expression, "&&")
+		require.NotContains(t, request.Selectors[0].CEL.Expression, "cpuID == 0")
+	}
+}
+
+func TestExampleSelectorsNarrowing(t *testing.T) {
+	numaDevice := func(name string, numaNodeID int64, tier string) resourceapi.Device {
+		attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			AttributeNUMANodeID: {IntValue: &numaNodeID},
+		}
+		if tier != "" {
+			attrs[AttributeCPUTier] = resourceapi.DeviceAttribute{StringValue: &tier}
+		}
+		return resourceapi.Device{Name: name, Attributes: attrs}
+	}
+	devices := []resourceapi.Device{
+		numaDevice("cpudevnuma000", 0, ""),
+		numaDevice("cpudevnuma000-gold", 0, "gold"),
+		numaDevice("cpudevnuma001-gold", 1, "gold"),
+	}
+	require.Equal(t, `device.attributes["dra.cpu"].numaNodeID == 0 && device.attributes["dra.cpu"].tier == "gold"`,
+		exampleSelectors(devices[1], devices)[0].CEL.Expression)
+	require.Equal(t, `device.attributes["dra.cpu"].numaNodeID == 1`, exampleSelectors(devices[2], devices)[0].CEL.Expression)
+	// no attribute tells the device without tier apart from the gold one.
+	require.Equal(t, `device.attributes["dra.cpu"].numaNodeID == 0`, exampleSelectors(devices[0], devices)[0].CEL.Expression)
+	require.Nil(t, exampleSelectors(devices[0], devices[:1]))
+}
@@ -0,0 +1,162 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FaultsAPIPath is the path the fault injection is controlled at, with the FaultInjection feature gate only.
+const FaultsAPIPath = "/apis/" + ClaimsAPIVersion + "/faults"
+
+// errInjectedFault is returned by the operations failed on purpose.
+var errInjectedFault = errors.New("injected fault")
+
+// Faults are the faults to inject in the next operations of the driver, for the resilience tests of its recovery.
+type Faults struct {
+	// FailCDIWrites is the number of the next writes of CDI devices, added or removed, to fail.
+	FailCDIWrites int `json:"failCDIWrites,omitempty"`
+	// NRIAdjustmentDelay delays the adjustment of each container created, until the faults are changed.
+	NRIAdjustmentDelay metav1.Duration `json:"nriAdjustmentDelay,omitempty"`
+	// DropUnprepares is the number of the next claims to unprepare which are reported as unprepared,
+	// but keep their CPUs and their CDI device.
+	DropUnprepares int `json:"dropUnprepares,omitempty"`
+}
+
+// faultInjector holds the faults left to inject. A nil injector injects none.
+type faultInjector struct {
+	lock   sync.Mutex
+	faults Faults
+}
+
+// get returns the faults left to inject.
+func (f *faultInjector) get() Faults {
+	if f == nil {
+		return Faults{}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.faults
+}
+
+// set replaces the faults left to inject.
+func (f *faultInjector) set(faults Faults) error {
+	if faults.FailCDIWrites < 0 || faults.DropUnprepares < 0 || faults.NRIAdjustmentDelay.Duration < 0 {
+		return fmt.Errorf("the faults must not be negative")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = faults
+	return nil
+}
+
+// failCDIWrite returns true if the current CDI write must fail, consuming the fault.
+func (f *faultInjector) failCDIWrite() bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.faults.FailCDIWrites == 0 {
+		return false
+	}
+	f.faults.FailCDIWrites--
+	return true
+}
+
+// dropUnprepare returns true if the current claim must not be unprepared, consuming the fault.
+func (f *faultInjector) dropUnprepare() bool {
+	if f == nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.faults.DropUnprepares == 0 {
+		return false
+	}
+	f.faults.DropUnprepares--
+	return true
+}
+
+// delayNRIAdjustment waits the NRI adjustment delay, if any, or until the context is done.
+func (f *faultInjector) delayNRIAdjustment(ctx context.Context, logger logr.Logger) {
+	delay := f.get().NRIAdjustmentDelay.Duration
+	if delay == 0 {
+		return
+	}
+	logger.Info("injected fault: delaying the NRI adjustment", "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// faultyCdiManager fails the CDI writes as the fault injector says.
+type faultyCdiManager struct {
+	cdiManager
+	faults *faultInjector
+}
+
+// AddDevice implements cdiManager.
+func (m *faultyCdiManager) AddDevice(logger logr.Logger, deviceName string, envVar string, opts ...cdiDeviceOption) error {
+	if m.faults.failCDIWrite() {
+		logger.Info("injected fault: failing the CDI device write", "device", deviceName)
+		return fmt.Errorf("failed to add CDI device %s: %w", deviceName, errInjectedFault)
+	}
+	return m.cdiManager.AddDevice(logger, deviceName, envVar, opts...)
+}
+
+// RemoveDevice implements cdiManager.
+func (m *faultyCdiManager) RemoveDevice(logger logr.Logger, deviceName string) error {
+	if m.faults.failCDIWrite() {
+		logger.Info("injected fault: failing the CDI device removal", "device", deviceName)
+		return fmt.Errorf("failed to remove CDI device %s: %w", deviceName, errInjectedFault)
+	}
+	return m.cdiManager.RemoveDevice(logger, deviceName)
+}
+
+// handleFaults serves the faults left to inject, and replaces them.
+func (f *faultInjector) handleFaults(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var faults Faults
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&faults); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.set(faults); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f.get()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestFaultsAPI(t *testing.T) {
+	driver := &CPUDriver{}
+	rec := httptest.NewRecorder()
+	driver.ClaimsAPIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, FaultsAPIPath, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code, "served without the feature gate")
+
+	driver.faults = &faultInjector{}
+	handler := driver.ClaimsAPIHandler()
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, FaultsAPIPath, strings.NewReader(`{"failCDIWrites": 2, "nriAdjustmentDelay": "1s", "dropUnprepares": 1}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, FaultsAPIPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got Faults
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Equal(t, Faults{FailCDIWrites: 2, NRIAdjustmentDelay: metav1.Duration{Duration: time.Second}, DropUnprepares: 1}, got)
+
+	for _, body := range []string{`{"failCDIWrites": -1}`, `{"unknown": 1}`, `not json`} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, FaultsAPIPath, strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	require.Equal(t, got, driver.faults.get(), "invalid faults must not replace the current ones")
+
+	// the faults are cleared with an empty object.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, FaultsAPIPath, strings.NewReader(`{}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, Faults{}, driver.faults.get())
+}
+
+func TestFaultInjection(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	faults := &faultInjector{}
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             &faultyCdiManager{cdiManager: cdiMgr, faults: faults},
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		faults:             faults,
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+	claimUID := types.UID("claim-uid-1")
+	claims := []*resourceapi.ResourceClaim{testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})}
+
+	require.NoError(t, faults.set(Faults{FailCDIWrites: 1, DropUnprepares: 1}))
+	prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+	require.ErrorIs(t, prepared[claimUID].Err, errInjectedFault)
+	require.Empty(t, cdiMgr.devices)
+
+	// the kubelet retries, and the fault is consumed.
+	prepared, err = driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+	require.NoError(t, prepared[claimUID].Err)
+	require.Contains(t, cdiMgr.devices, getCDIDeviceName(claimUID))
+
+	// the dropped unprepare reports success, but keeps the claim prepared.
+	unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared[claimUID])
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.True(t, ok)
+	require.Contains(t, cdiMgr.devices, getCDIDeviceName(claimUID))
+
+	unprepared, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared[claimUID])
+	_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.False(t, ok)
+	require.Equal(t, Faults{}, faults.get())
+}
+
+func TestDelayNRIAdjustment(t *testing.T) {
+	logger := testr.New(t)
+	var faults *faultInjector
+	// a nil injector never waits.
+	faults.delayNRIAdjustment(context.Background(), logger)
+
+	faults = &faultInjector{}
+	require.NoError(t, faults.set(Faults{NRIAdjustmentDelay: metav1.Duration{Duration: time.Hour}}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	faults.delayNRIAdjustment(ctx, logger)
+	require.Less(t, time.Since(start), time.Hour, "the delay must end with the context")
+}
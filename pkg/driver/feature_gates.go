@@ -0,0 +1,165 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// FeatureGate is the name of a gate guarding an experimental capability of the driver.
+type FeatureGate string
+
+// FeatureStage is the maturity of a gated capability.
+type FeatureStage string
+
+const (
+	// FEATURE_STAGE_ALPHA capabilities are disabled by default, and may change or go away.
+	FEATURE_STAGE_ALPHA FeatureStage = "alpha"
+	// FEATURE_STAGE_BETA capabilities are enabled by default, and can still be disabled.
+	FEATURE_STAGE_BETA FeatureStage = "beta"
+)
+
+// FeatureGateSpec describes a feature gate.
+type FeatureGateSpec struct {
+	Default bool
+	Stage   FeatureStage
+}
+
+const (
+	// FEATURE_GATE_SMALL_CLAIM_FAST_PATH allocates the grouped device requests of one or two CPUs from the
+	// free lists of the uncore caches, skipping the topology packing.
+	FEATURE_GATE_SMALL_CLAIM_FAST_PATH FeatureGate = "SmallClaimFastPath"
+	// FEATURE_GATE_CPUSET_VERIFICATION reads back the cpuset of the containers from their cgroup once they
+	// started, and sends the update again if it doesn't match the assigned CPUs.
+	FEATURE_GATE_CPUSET_VERIFICATION FeatureGate = "CPUSetVerification"
+	// FEATURE_GATE_CLAIM_DEVICE_STATUS maintains the Prepared, Enforced and Degraded conditions of the
+	// devices in the status of the prepared claims.
+	FEATURE_GATE_CLAIM_DEVICE_STATUS FeatureGate = "ClaimDeviceStatus"
+	// FEATURE_GATE_DEGRADED_STARTUP completes the start of the driver when the registration with the kubelet
+	// or the creation of the CDI manager fails, and retries them in the background.
+	FEATURE_GATE_DEGRADED_STARTUP FeatureGate = "DegradedStartup"
+	// FEATURE_GATE_FAULT_INJECTION serves the fault injection endpoint on the claims API, to fail the CDI
+	// writes, delay the NRI adjustments and drop the unprepares in the resilience tests.
+	FEATURE_GATE_FAULT_INJECTION FeatureGate = "FaultInjection"
+	// FEATURE_GATE_BINDING_CONDITIONS publishes the devices with binding conditions, so the scheduler binds the
+	// pods only once the driver reported the node ready to prepare their claims. Requires ClaimDeviceStatus.
+	FEATURE_GATE_BINDING_CONDITIONS FeatureGate = "BindingConditions"
+	// FEATURE_GATE_LOW_LATENCY_PROFILE lets the claims use the low-latency profile, which writes the cpufreq
+	// governor of their CPUs, the affinity of the interrupts and kernel.timer_migration of the host.
+	FEATURE_GATE_LOW_LATENCY_PROFILE FeatureGate = "LowLatencyProfile"
+	// FEATURE_GATE_CPU_PROFILES watches the CPUProfiles and lets the claims reference them, which writes the
+	// cpufreq governor and the cpuidle states of their CPUs and the affinity of the interrupts of the host.
+	FEATURE_GATE_CPU_PROFILES FeatureGate = "CPUProfiles"
+)
+
+// knownFeatureGates are the feature gates of the driver. The risky capabilities are added here as alpha,
+// disabled by default, so they ship dark and are enabled node by node with --feature-gates. The gate
+// of a graduated capability is removed together with the code paths it guarded.
+var knownFeatureGates = map[FeatureGate]FeatureGateSpec{
+	FEATURE_GATE_SMALL_CLAIM_FAST_PATH: {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_CPUSET_VERIFICATION:   {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_CLAIM_DEVICE_STATUS:   {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_DEGRADED_STARTUP:      {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_FAULT_INJECTION:       {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_BINDING_CONDITIONS:    {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_LOW_LATENCY_PROFILE:   {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	FEATURE_GATE_CPU_PROFILES:          {Default: false, Stage: FEATURE_STAGE_ALPHA},
+}
+
+// KnownFeatureGates describes the known feature gates, sorted by name, e.g. for the flag help.
+func KnownFeatureGates() []string {
+	var descriptions []string
+	for _, gate := range slices.Sorted(maps.Keys(knownFeatureGates)) {
+		spec := knownFeatureGates[gate]
+		descriptions = append(descriptions, fmt.Sprintf("%s=true|false (%s - default=%t)", gate, spec.Stage, spec.Default))
+	}
+	return descriptions
+}
+
+// featureGates are the effective feature gates of the driver, fixed when the driver starts.
+type featureGates struct {
+	known   map[FeatureGate]FeatureGateSpec
+	enabled map[FeatureGate]bool
+}
+
+// newFeatureGates applies the overrides to the defaults of the known gates. Unknown gates are an error,
+// so a typo doesn't silently leave a capability disabled.
+func newFeatureGates(known map[FeatureGate]FeatureGateSpec, overrides map[string]bool) (*featureGates, error) {
+	enabled := make(map[FeatureGate]bool, len(known))
+	for gate, spec := range known {
+		enabled[gate] = spec.Default
+	}
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		gate := FeatureGate(name)
+		if _, ok := known[gate]; !ok {
+			var knownNames []string
+			for _, gate := range slices.Sorted(maps.Keys(known)) {
+				knownNames = append(knownNames, string(gate))
+			}
+			return nil, fmt.Errorf("unknown feature gate %q, known gates: [%s]", name, strings.Join(knownNames, ", "))
+		}
+		enabled[gate] = overrides[name]
+	}
+	if enabled[FEATURE_GATE_BINDING_CONDITIONS] && !enabled[FEATURE_GATE_CLAIM_DEVICE_STATUS] {
+		// the binding conditions are set in the status of the claims.
+		return nil, fmt.Errorf("the %s feature gate requires the %s feature gate", FEATURE_GATE_BINDING_CONDITIONS, FEATURE_GATE_CLAIM_DEVICE_STATUS)
+	}
+	return &featureGates{known: known, enabled: enabled}, nil
+}
+
+// Enabled returns true if the gate is enabled. Unknown gates are disabled.
+func (fg *featureGates) Enabled(gate FeatureGate) bool {
+	if fg == nil {
+		return false
+	}
+	return fg.enabled[gate]
+}
+
+// report logs the effective feature gates and exports them as metrics.
+func (fg *featureGates) report(logger logr.Logger) {
+	featureGateEnabled.Reset()
+	for _, gate := range slices.Sorted(maps.Keys(fg.enabled)) {
+		enabled := fg.enabled[gate]
+		value := 0.0
+		if enabled {
+			value = 1.0
+		}
+		featureGateEnabled.WithLabelValues(string(gate), string(fg.known[gate].Stage)).Set(value)
+		if enabled != fg.known[gate].Default {
+			logger.Info("feature gate overridden", "featureGate", gate, "stage", fg.known[gate].Stage, "enabled", enabled)
+		}
+	}
+	logger.Info("feature gates", "gates", fg.enabled)
+}
+
+// FeatureEnabled returns true if the feature gate is enabled on this driver instance.
+func (cp *CPUDriver) FeatureEnabled(gate FeatureGate) bool {
+	return cp.featureGates.Enabled(gate)
+}
+
+// FeatureGates returns the effective feature gates of this driver instance.
+func (cp *CPUDriver) FeatureGates() map[FeatureGate]bool {
+	if cp.featureGates == nil {
+		return map[FeatureGate]bool{}
+	}
+	return maps.Clone(cp.featureGates.enabled)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var testFeatureGates = map[FeatureGate]FeatureGateSpec{
+	"AlphaThing": {Default: false, Stage: FEATURE_STAGE_ALPHA},
+	"BetaThing":  {Default: true, Stage: FEATURE_STAGE_BETA},
+}
+
+func TestNewFeatureGates(t *testing.T) {
+	testCases := []struct {
+		name          string
+		overrides     map[string]bool
+		expected      map[FeatureGate]bool
+		expectedError string
+	}{
+		{
+			name:     "defaults",
+			expected: map[FeatureGate]bool{"AlphaThing": false, "BetaThing": true},
+		},
+		{
+			name:      "overrides",
+			overrides: map[string]bool{"AlphaThing": true, "BetaThing": false},
+			expected:  map[FeatureGate]bool{"AlphaThing": true, "BetaThing": false},
+		},
+		{
+			name:          "unknown gate",
+			overrides:     map[string]bool{"AlphaThing": true, "Typo": true},
+			expectedError: `unknown feature gate "Typo", known gates: [AlphaThing, BetaThing]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gates, err := newFeatureGates(testFeatureGates, tc.overrides)
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			driver := &CPUDriver{featureGates: gates}
+			require.Equal(t, tc.expected, driver.FeatureGates())
+			for gate, enabled := range tc.expected {
+				require.Equal(t, enabled, driver.FeatureEnabled(gate))
+			}
+			require.False(t, driver.FeatureEnabled("Unknown"))
+		})
+	}
+}
+
+func TestFeatureGatesReport(t *testing.T) {
+	gates, err := newFeatureGates(testFeatureGates, map[string]bool{"AlphaThing": true})
+	require.NoError(t, err)
+	gates.report(testr.New(t))
+	require.Equal(t, 1.0, testutil.ToFloat64(featureGateEnabled.WithLabelValues("AlphaThing", string(FEATURE_STAGE_ALPHA))))
+	require.Equal(t, 1.0, testutil.ToFloat64(featureGateEnabled.WithLabelValues("BetaThing", string(FEATURE_STAGE_BETA))))
+
+	gates, err = newFeatureGates(testFeatureGates, map[string]bool{"BetaThing": false})
+	require.NoError(t, err)
+	gates.report(testr.New(t))
+	require.Equal(t, 0.0, testutil.ToFloat64(featureGateEnabled.WithLabelValues("AlphaThing", string(FEATURE_STAGE_ALPHA))))
+	require.Equal(t, 0.0, testutil.ToFloat64(featureGateEnabled.WithLabelValues("BetaThing", string(FEATURE_STAGE_BETA))))
+}
+
+func TestFeatureGatesDisabled(t *testing.T) {
+	driver := &CPUDriver{}
+	require.False(t, driver.FeatureEnabled("AlphaThing"))
+	require.Empty(t, driver.FeatureGates())
+}
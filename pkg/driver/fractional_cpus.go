@@ -0,0 +1,238 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/cpuset"
+	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
+)
+
+const (
+	// fractionalCPUsEnvVarPrefix is the prefix of the container environment variable carrying the fractional
+	// allocation of a claim, as "<millicores>m:<cpus of the device>". Like the trace ID, it survives the driver restarts.
+	fractionalCPUsEnvVarPrefix = "DRA_CPU_FRACTION"
+	// defaultCPUPeriod is the CFS period, in microseconds, of the containers created without one.
+	defaultCPUPeriod int64 = 100000
+	// minCPUQuota is the smallest CFS quota the kernel accepts, in microseconds.
+	minCPUQuota int64 = 1000
+	// minCPUShares and maxCPUShares bound the CPU shares, converted by the runtime to the cgroup v2 cpu.weight,
+	// as the kubelet does.
+	minCPUShares uint64 = 2
+	maxCPUShares uint64 = 262144
+)
+
+// isFractionalCPUQuantity returns true if the consumed CPU capacity is not a whole number of CPUs.
+func isFractionalCPUQuantity(quantity resource.Quantity) bool {
+	return quantity.MilliValue()%1000 != 0
+}
+
+// fractionalCPUsEnvVar returns the environment variable carrying the fractional allocation of a claim.
+func fractionalCPUsEnvVar(claimUID types.UID, claim store.FractionalClaim) string {
+	return fmt.Sprintf("%s_%s=%dm:%s", fractionalCPUsEnvVarPrefix, claimUID, claim.MilliCPUs, claim.CPUs.String())
+}
+
+// parseFractionalCPUsEnv returns the fractional allocations of the claims found in the container environment.
+// The malformed entries are skipped.
+func parseFractionalCPUsEnv(logger logr.Logger, envs []string) map[types.UID]store.FractionalClaim {
+	claims := make(map[types.UID]store.FractionalClaim)
+	for _, env := range envs {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok {
+			continue
+		}
+		claimUID, ok := strings.CutPrefix(key, fractionalCPUsEnvVarPrefix+"_")
+		if !ok || claimUID == "" {
+			continue
+		}
+		claim, err := parseFractionalClaim(value)
+		if err != nil {
+			logger.Error(err, "malformed fractional CPUs env entry", "env", env)
+			continue
+		}
+		claims[types.UID(claimUID)] = claim
+	}
+	return claims
+}
+
+// parseFractionalClaim parses the value of the fractional CPUs environment variable.
+func parseFractionalClaim(value string) (store.FractionalClaim, error) {
+	milliCPUs, cpus, ok := strings.Cut(value, ":")
+	if !ok {
+		return store.FractionalClaim{}, fmt.Errorf("missing the CPUs of the device in %q", value)
+	}
+	quantity, err := resource.ParseQuantity(milliCPUs)
+	if err != nil {
+		return store.FractionalClaim{}, fmt.Errorf("invalid CPU quantity %q: %w", milliCPUs, err)
+	}
+	claim := store.FractionalClaim{MilliCPUs: quantity.MilliValue()}
+	if claim.MilliCPUs <= 0 {
+		return store.FractionalClaim{}, fmt.Errorf("invalid CPU quantity %q", milliCPUs)
+	}
+	if claim.CPUs, err = cpuset.Parse(cpus); err != nil {
+		return store.FractionalClaim{}, fmt.Errorf("invalid CPUs %q: %w", cpus, err)
+	}
+	return claim, nil
+}
+
+// mergeFractionalClaims returns the fraction of the CPUs of all the claims of a container, and their UIDs, sorted.
+func mergeFractionalClaims(claims map[types.UID]store.FractionalClaim) (store.FractionalClaim, []types.UID) {
+	merged := store.FractionalClaim{}
+	claimUIDs := slices.Sorted(maps.Keys(claims))
+	for _, claimUID := range claimUIDs {
+		merged.MilliCPUs += claims[claimUID].MilliCPUs
+		merged.CPUs = merged.CPUs.Union(claims[claimUID].CPUs)
+	}
+	return merged, claimUIDs
+}
+
+// prepareFractionalClaim prepares a claim consuming a fraction of the CPUs of its devices. No CPU is allocated:
+// the containers consuming the claim learn the millicores and the CPUs of the devices from the CDI device, and
+// run on the shared CPUs of the devices, as they shrink and grow with the exclusive allocations. The other
+// device configurations don't apply.
+func (cp *CPUDriver) prepareFractionalClaim(logger logr.Logger, claim *resourceapi.ResourceClaim, fractional store.FractionalClaim, traceID string) ([]string, error) {
+	if cp.nriOnly {
+		return nil, fmt.Errorf("claim %s/%s consumes a fraction of the CPUs, which requires CDI", claim.Namespace, claim.Name)
+	}
+	cp.cpuAllocationStore.AddFractionalClaimAllocation(logger, claim.UID, fractional)
+	cp.cpuAllocationStore.SetResourceClaimTraceID(claim.UID, traceID)
+
+	deviceName := getCDIDeviceName(claim.UID)
+	envVar := fractionalCPUsEnvVar(claim.UID, fractional)
+	opts := []cdiDeviceOption{
+		withCDIAnnotations(map[string]string{traceIDAnnotation: traceID}),
+		withCDIEnv(traceIDEnvVar(claim.UID, traceID)),
+	}
+	if err := cp.cdiMgr.AddDevice(logger, deviceName, envVar, opts...); err != nil {
+		cp.cpuAllocationStore.RemoveResourceClaimAllocation(logger, claim.UID)
+		return nil, err
+	}
+	qualifiedName := cdiparser.QualifiedName(cdiVendor, cdiClass, deviceName)
+	logger.V(2).Info("claim prepared with a fraction of the shared CPUs of its devices", "milliCPUs", fractional.MilliCPUs, "deviceCPUs", fractional.CPUs.String(), "cdiDeviceName", deviceName)
+	return []string{qualifiedName}, nil
+}
+
+// fractionalClaimsOf returns the fraction of the CPUs of the claims of a container, if they are all fractional.
+func (cp *CPUDriver) fractionalClaimsOf(claimUIDs []types.UID) (store.FractionalClaim, bool) {
+	claims := make(map[types.UID]store.FractionalClaim, len(claimUIDs))
+	for _, claimUID := range claimUIDs {
+		claim, ok := cp.cpuAllocationStore.GetFractionalClaimAllocation(claimUID)
+		if !ok {
+			return store.FractionalClaim{}, false
+		}
+		claims[claimUID] = claim
+	}
+	if len(claims) == 0 {
+		return store.FractionalClaim{}, false
+	}
+	merged, _ := mergeFractionalClaims(claims)
+	return merged, true
+}
+
+// fractionalContainerCPUs returns the CPUs the containers of fractional claims run on: the shared CPUs of their
+// devices. If the exclusive allocations took all of them, the containers run on all the shared CPUs.
+func (cp *CPUDriver) fractionalContainerCPUs(deviceCPUs cpuset.CPUSet) cpuset.CPUSet {
+	sharedCPUs := cp.cpuAllocationStore.GetSharedCPUs()
+	if cpus := sharedCPUs.Intersection(deviceCPUs); !cpus.IsEmpty() {
+		return cpus
+	}
+	return sharedCPUs
+}
+
+// milliCPUsToQuota returns the CFS quota of the millicores over the period, in microseconds.
+func milliCPUsToQuota(milliCPUs, period int64) int64 {
+	return max(milliCPUs*period/1000, minCPUQuota)
+}
+
+// milliCPUsToShares returns the CPU shares of the millicores, as the kubelet computes them for the CPU requests.
+func milliCPUsToShares(milliCPUs int64) uint64 {
+	return min(max(uint64(milliCPUs)*1024/1000, minCPUShares), maxCPUShares)
+}
+
+// adjustFractionalContainer runs a container being created, consuming only fractional claims, on the shared CPUs
+// of their devices, limited by a CPU quota and weighted by their millicores.
+func (cp *CPUDriver) adjustFractionalContainer(logger logr.Logger, pod *api.PodSandbox, ctr *api.Container, claims map[types.UID]store.FractionalClaim, envTraceIDs map[types.UID]string, adjust *api.ContainerAdjustment) error {
+	fractional, claimUIDs := mergeFractionalClaims(claims)
+	for _, claimUID := range claimUIDs {
+		traceID := cp.claimTraceID(envTraceIDs, claimUID)
+		cLogger := logger.WithValues("claimUID", claimUID, "traceID", traceID)
+		if err := cp.claimTracker.SetOwner(cLogger, claimUID, types.UID(pod.GetUid()), ctr.GetName()); err != nil {
+			return err
+		}
+		if traceID != "" {
+			adjust.AddAnnotation(traceIDContainerAnnotation(claimUID), traceID)
+		}
+		// the allocation is released when a container of the claim stops, and is back with the next one.
+		if _, ok := cp.cpuAllocationStore.GetFractionalClaimAllocation(claimUID); !ok {
+			cp.cpuAllocationStore.AddFractionalClaimAllocation(cLogger, claimUID, claims[claimUID])
+		}
+	}
+	period := defaultCPUPeriod
+	if value := ctr.GetLinux().GetResources().GetCpu().GetPeriod().GetValue(); value > 0 {
+		period = int64(value)
+	} else {
+		adjust.SetLinuxCPUPeriod(period)
+	}
+	cpus := cp.fractionalContainerCPUs(fractional.CPUs)
+	adjust.SetLinuxCPUSetCPUs(cpus.String())
+	adjust.SetLinuxCPUQuota(milliCPUsToQuota(fractional.MilliCPUs, period))
+	adjust.SetLinuxCPUShares(milliCPUsToShares(fractional.MilliCPUs))
+	logger.V(2).Info("running container on a fraction of the shared CPUs", "milliCPUs", fractional.MilliCPUs, "cpus", cpus.String(), "period", period)
+
+	state := store.NewContainerState(ctr.GetName(), types.UID(ctr.GetId()), claimUIDs...).SetCgroupsPath(ctr.GetLinux().GetCgroupsPath())
+	cp.podConfigStore.SetContainerState(types.UID(pod.GetUid()), state)
+	return nil
+}
+
+// getFractionalContainerUpdates returns the updates of the cpusets of the containers of fractional claims, to the
+// current shared CPUs of their devices, sorted by container ID.
+func (cp *CPUDriver) getFractionalContainerUpdates(logger logr.Logger, excludeID types.UID) []*api.ContainerUpdate {
+	var updates []*api.ContainerUpdate
+	seen := sets.New[types.UID]()
+	for _, containers := range cp.podConfigStore.GetContainersByClaim() {
+		for _, ctr := range containers {
+			if ctr.ContainerUID == excludeID || seen.Has(ctr.ContainerUID) {
+				continue
+			}
+			seen.Insert(ctr.ContainerUID)
+			state := cp.podConfigStore.GetContainerState(ctr.PodUID, ctr.ContainerName)
+			fractional, ok := cp.fractionalClaimsOf(state.ResourceClaimUIDs())
+			if !ok {
+				continue
+			}
+			update := &api.ContainerUpdate{ContainerId: string(ctr.ContainerUID)}
+			update.SetLinuxCPUSetCPUs(cp.fractionalContainerCPUs(fractional.CPUs).String())
+			updates = append(updates, update)
+		}
+	}
+	slices.SortFunc(updates, func(a, b *api.ContainerUpdate) int { return strings.Compare(a.ContainerId, b.ContainerId) })
+	if len(updates) > 0 {
+		logger.V(2).Info("updating CPU allocation for containers of fractional claims", "sharedCPUs", cp.cpuAllocationStore.GetSharedCPUs().String(), "entries", len(updates))
+	}
+	return updates
+}
@@ -0,0 +1,190 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+// testClaimMilliCPUs returns a claim consuming the given millicores of each device.
+func testClaimMilliCPUs(claimUID types.UID, consumedMilliCPUs map[string]int64) *resourceapi.ResourceClaim {
+	claim := testClaim(claimUID, testDriverName, testNodeName, consumedMilliCPUs)
+	for i, result := range claim.Status.Allocation.Devices.Results {
+		claim.Status.Allocation.Devices.Results[i].ConsumedCapacity = map[resourceapi.QualifiedName]resource.Quantity{
+			cpuResourceQualifiedName: *resource.NewMilliQuantity(consumedMilliCPUs[result.Device], resource.DecimalSI),
+		}
+	}
+	return claim
+}
+
+func TestParseFractionalCPUsEnv(t *testing.T) {
+	logger := testr.New(t)
+	claims := parseFractionalCPUsEnv(logger, []string{
+		fractionalCPUsEnvVar("claim-A", store.FractionalClaim{MilliCPUs: 2500, CPUs: cpuset.New(0, 1, 4, 5)}),
+		"DRA_CPU_FRACTION_claim-B=1500m",
+		"DRA_CPU_FRACTION_claim-C=fast:0-3",
+		fmt.Sprintf("%s_claim-D=%s", cdiEnvVarPrefix, "0-1"),
+	})
+	require.Len(t, claims, 1)
+	require.Equal(t, int64(2500), claims["claim-A"].MilliCPUs)
+	require.Equal(t, "0-1,4-5", claims["claim-A"].CPUs.String())
+}
+
+func TestMilliCPUsConversions(t *testing.T) {
+	testCases := []struct {
+		milliCPUs      int64
+		period         int64
+		expectedQuota  int64
+		expectedShares uint64
+	}{
+		{milliCPUs: 2500, period: defaultCPUPeriod, expectedQuota: 250000, expectedShares: 2560},
+		{milliCPUs: 500, period: 50000, expectedQuota: 25000, expectedShares: 512},
+		{milliCPUs: 1, period: defaultCPUPeriod, expectedQuota: minCPUQuota, expectedShares: minCPUShares},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%dm", tc.milliCPUs), func(t *testing.T) {
+			require.Equal(t, tc.expectedQuota, milliCPUsToQuota(tc.milliCPUs, tc.period))
+			require.Equal(t, tc.expectedShares, milliCPUsToShares(tc.milliCPUs))
+		})
+	}
+}
+
+func TestPrepareFractionalClaim(t *testing.T) {
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.fractionalCPUs = true
+		cp.podConfigStore = store.NewPodConfig()
+		cp.claimTracker = store.NewClaimTracker()
+	})
+
+	fractionalUID := types.UID("claim-fraction")
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaimMilliCPUs(fractionalUID, map[string]int64{"cpudevnuma000": 1500}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[fractionalUID].Err)
+	// a fraction allocates no CPU.
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(fractionalUID)
+	require.False(t, ok)
+	require.Equal(t, "0-7", driver.cpuAllocationStore.GetSharedCPUs().String())
+	envVar := driver.cdiMgr.(*mockCdiMgr).devices[getCDIDeviceName(fractionalUID)]
+	require.Equal(t, fractionalCPUsEnvVar(fractionalUID, store.FractionalClaim{MilliCPUs: 1500, CPUs: cpuset.New(0, 1, 4, 5)}), envVar)
+
+	fractionalCtr := &api.Container{Id: "fraction", PodSandboxId: pod.Id, Name: "fraction", Env: []string{envVar}}
+	adjust, _, err := driver.CreateContainer(context.Background(), pod, fractionalCtr)
+	require.NoError(t, err)
+	cpu := adjust.GetLinux().GetResources().GetCpu()
+	require.Equal(t, "0-1,4-5", cpu.GetCpus())
+	require.Equal(t, int64(150000), cpu.GetQuota().GetValue())
+	require.Equal(t, uint64(defaultCPUPeriod), cpu.GetPeriod().GetValue())
+	require.Equal(t, uint64(1536), cpu.GetShares().GetValue())
+	expected, ok := driver.expectedContainerCPUs("pod-uid-1", "fraction")
+	require.True(t, ok)
+	require.Equal(t, "0-1,4-5", expected.String())
+
+	// an exclusive claim of the same device shrinks the CPUs of the fraction.
+	exclusiveUID := types.UID("claim-exclusive")
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim(exclusiveUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[exclusiveUID].Err)
+	exclusiveCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(exclusiveUID)
+	require.True(t, ok)
+	exclusiveCtr := &api.Container{
+		Id: "exclusive", PodSandboxId: pod.Id, Name: "exclusive",
+		Env: []string{fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, exclusiveUID, exclusiveCPUs.String())},
+	}
+	_, updates, err := driver.CreateContainer(context.Background(), pod, exclusiveCtr)
+	require.NoError(t, err)
+	cpusByID := make(map[string]string)
+	for _, update := range updates {
+		cpusByID[update.ContainerId] = update.GetLinux().GetResources().GetCpu().GetCpus()
+	}
+	require.Equal(t, cpuset.New(0, 1, 4, 5).Difference(exclusiveCPUs).String(), cpusByID["fraction"])
+
+	// the fraction is restored from the container environment.
+	driver.cpuAllocationStore = store.NewCPUAllocation(driver.cpuTopology, driver.reservedCPUs)
+	driver.claimTracker = store.NewClaimTracker()
+	updates, err = driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, []*api.Container{fractionalCtr, exclusiveCtr})
+	require.NoError(t, err)
+	claim, ok := driver.cpuAllocationStore.GetFractionalClaimAllocation(fractionalUID)
+	require.True(t, ok)
+	require.Equal(t, int64(1500), claim.MilliCPUs)
+	cpusByID = make(map[string]string)
+	for _, update := range updates {
+		cpusByID[update.ContainerId] = update.GetLinux().GetResources().GetCpu().GetCpus()
+	}
+	require.Equal(t, cpuset.New(0, 1, 4, 5).Difference(exclusiveCPUs).String(), cpusByID["fraction"])
+	require.Equal(t, exclusiveCPUs.String(), cpusByID["exclusive"])
+}
+
+func TestPrepareFractionalClaimErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		fractionalCPUs bool
+		claim          *resourceapi.ResourceClaim
+		expectedError  bool
+		expectedCPUs   int
+	}{
+		{
+			name:         "fractions rounded up when disabled",
+			claim:        testClaimMilliCPUs("claim-A", map[string]int64{"cpudevnuma000": 1500}),
+			expectedCPUs: 2,
+		},
+		{
+			name:           "whole CPUs are exclusive",
+			fractionalCPUs: true,
+			claim:          testClaimMilliCPUs("claim-A", map[string]int64{"cpudevnuma000": 2000}),
+			expectedCPUs:   2,
+		},
+		{
+			name:           "fraction mixed with whole CPUs",
+			fractionalCPUs: true,
+			claim:          testClaimMilliCPUs("claim-A", map[string]int64{"cpudevnuma000": 1500, "cpudevnuma001": 2000}),
+			expectedError:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.fractionalCPUs = tc.fractionalCPUs
+			})
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[tc.claim.UID].Err)
+				return
+			}
+			require.NoError(t, prepared[tc.claim.UID].Err)
+			cpus, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(tc.claim.UID)
+			require.True(t, ok)
+			require.Equal(t, tc.expectedCPUs, cpus.Size())
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"k8s.io/utils/cpuset"
+)
+
+// freeFullCoreCPUs returns the CPUs of the cores whose CPUs are all free.
+func freeFullCoreCPUs(topo *cpuinfo.CPUTopology, freeCPUs cpuset.CPUSet) cpuset.CPUSet {
+	result := cpuset.New()
+	for _, coreCPUs := range fullCores(topo, freeCPUs) {
+		result = result.Union(coreCPUs)
+	}
+	return result
+}
+
+// numaNodeFragmentation scores how fragmented the free CPUs of a NUMA node are, from 0 to 1.
+// The largest free block is the largest set of free full cores sharing the same uncore cache:
+// the score is 0 when all the free CPUs are in such block, and grows towards 1 as the free
+// CPUs get scattered in partially used cores and uncore caches.
+func numaNodeFragmentation(topo *cpuinfo.CPUTopology, freeCPUs cpuset.CPUSet, numaNodeID int) float64 {
+	numaFreeCPUs := freeCPUs.Intersection(topo.CPUDetails.CPUsInNUMANodes(numaNodeID))
+	if numaFreeCPUs.IsEmpty() {
+		return 0
+	}
+	fullCoreCPUs := freeFullCoreCPUs(topo, numaFreeCPUs)
+	largestBlock := 0
+	for _, uncoreCacheID := range topo.CPUDetails.UncoreInNUMANodes(numaNodeID).UnsortedList() {
+		block := fullCoreCPUs.Intersection(topo.CPUDetails.CPUsInUncoreCaches(uncoreCacheID)).Size()
+		largestBlock = max(largestBlock, block)
+	}
+	return 1 - float64(largestBlock)/float64(numaFreeCPUs.Size())
+}
+
+// updateFragmentationMetrics refreshes the fragmentation score of all the NUMA nodes.
+// Called by updateAllocationMetrics on each change of the allocations.
+func (cp *CPUDriver) updateFragmentationMetrics() {
+	if cp.cpuTopology == nil || cp.cpuAllocationStore == nil {
+		return
+	}
+	freeCPUs := cp.cpuAllocationStore.GetSharedCPUs()
+	for _, numaNodeID := range cp.cpuTopology.CPUDetails.NUMANodes().UnsortedList() {
+		score := numaNodeFragmentation(cp.cpuTopology, freeCPUs, numaNodeID)
+		numaNodeFragmentationScore.WithLabelValues(strconv.Itoa(numaNodeID)).Set(score)
+	}
+}
+
+// warnIfFragmented reports the allocations which could have been full-core or single uncore cache
+// judging by the raw count of available CPUs, but were not because the available CPUs are fragmented.
+func warnIfFragmented(logger logr.Logger, topo *cpuinfo.CPUTopology, availableCPUs cpuset.CPUSet, numCPUs int, assigned cpuset.CPUSet) {
+	if numCPUs == 0 || availableCPUs.Size() < numCPUs {
+		return
+	}
+	cpusPerCore := topo.CPUsPerCore()
+	if cpusPerCore > 0 && numCPUs%cpusPerCore == 0 && !freeFullCoreCPUs(topo, assigned).Equals(assigned) {
+		logger.Info("fragmentation prevented a full-core allocation", "numCPUs", numCPUs, "availableCPUs", availableCPUs.String(), "assigned", assigned.String())
+	}
+	if numCPUs <= topo.CPUsPerUncore() && topo.CPUDetails.KeepOnly(assigned).UncoreCaches().Size() > 1 {
+		logger.Info("fragmentation prevented a single uncore cache allocation", "numCPUs", numCPUs, "availableCPUs", availableCPUs.String(), "assigned", assigned.String())
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestNUMANodeFragmentation(t *testing.T) {
+	logger := testr.New(t)
+	// NUMA node 0: cores 0 (CPUs 0,4) and 1 (CPUs 1,5)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		freeCPUs cpuset.CPUSet
+		expected float64
+	}{
+		{
+			name:     "all CPUs free",
+			freeCPUs: cpuset.New(0, 1, 4, 5),
+			expected: 0,
+		},
+		{
+			name:     "no CPUs free",
+			freeCPUs: cpuset.New(2, 3),
+			expected: 0,
+		},
+		{
+			name:     "one full core and a sibling free",
+			freeCPUs: cpuset.New(0, 1, 4),
+			expected: 1 - 2.0/3.0,
+		},
+		{
+			name:     "only siblings free",
+			freeCPUs: cpuset.New(0, 1),
+			expected: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.InDelta(t, tc.expected, numaNodeFragmentation(topo, tc.freeCPUs, 0), 0.0001)
+		})
+	}
+}
+
+func TestNUMANodeFragmentationRepeatedCoreIDs(t *testing.T) {
+	logger := testr.New(t)
+	// the core IDs repeat on both sockets: socket 0 has cores 0 (CPUs 0,4) and 1 (CPUs 1,5),
+	// socket 1 has cores 0 (CPUs 2,6) and 1 (CPUs 3,7).
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: []cpuinfo.CPUInfo{
+		{CpuID: 0, CoreID: 0, SocketID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 4},
+		{CpuID: 1, CoreID: 1, SocketID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 5},
+		{CpuID: 2, CoreID: 0, SocketID: 1, NUMANodeID: 1, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 6},
+		{CpuID: 3, CoreID: 1, SocketID: 1, NUMANodeID: 1, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 7},
+		{CpuID: 4, CoreID: 0, SocketID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 0},
+		{CpuID: 5, CoreID: 1, SocketID: 0, NUMANodeID: 0, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 1},
+		{CpuID: 6, CoreID: 0, SocketID: 1, NUMANodeID: 1, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 2},
+		{CpuID: 7, CoreID: 1, SocketID: 1, NUMANodeID: 1, UncoreCacheID: 1, CoreType: cpuinfo.CoreTypePerformance, SiblingCPUID: 3},
+	}}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	require.Equal(t, cpuset.New(0, 1, 4, 5), freeFullCoreCPUs(topo, cpuset.New(0, 1, 4, 5)))
+	require.InDelta(t, 0, numaNodeFragmentation(topo, cpuset.New(0, 1, 2, 4, 5), 0), 0.0001)
+	require.InDelta(t, 1-2.0/3.0, numaNodeFragmentation(topo, cpuset.New(2, 3, 6), 1), 0.0001)
+}
+
+func TestUpdateFragmentationMetrics(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(0, 5))
+	driver.updateFragmentationMetrics()
+	require.InDelta(t, 1, testutil.ToFloat64(numaNodeFragmentationScore.WithLabelValues("0")), 0.0001)
+	require.InDelta(t, 0, testutil.ToFloat64(numaNodeFragmentationScore.WithLabelValues("1")), 0.0001)
+
+	driver.cpuAllocationStore.RemoveResourceClaimAllocation(logger, "claim-1")
+	driver.updateFragmentationMetrics()
+	require.InDelta(t, 0, testutil.ToFloat64(numaNodeFragmentationScore.WithLabelValues("0")), 0.0001)
+}
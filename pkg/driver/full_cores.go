@@ -0,0 +1,137 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// fullCoresResourceQualifiedName is the qualified name of the capacity of whole cores of the grouped devices.
+	// The claims consuming it are allocated whole cores, and must consume the matching CPU capacity too.
+	fullCoresResourceQualifiedName = "dra.cpu/fullCores"
+	// fullCoresEnvVarPrefix is the prefix of the container environment variable marking the claims
+	// allocated whole cores. Like the trace ID, it survives the driver restarts.
+	fullCoresEnvVarPrefix = "DRA_CPU_FULL_CORES"
+)
+
+// fullCoresEnvVar returns the environment variable marking the containers of a claim allocated whole cores.
+func fullCoresEnvVar(claimUID types.UID) string {
+	return fmt.Sprintf("%s_%s=true", fullCoresEnvVarPrefix, claimUID)
+}
+
+// parseFullCoresEnv returns the claims allocated whole cores, from the container environment.
+func parseFullCoresEnv(envs []string) sets.Set[types.UID] {
+	claimUIDs := sets.New[types.UID]()
+	for _, env := range envs {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || value != "true" {
+			continue
+		}
+		claimUID, ok := strings.CutPrefix(key, fullCoresEnvVarPrefix+"_")
+		if !ok || claimUID == "" {
+			continue
+		}
+		claimUIDs.Insert(types.UID(claimUID))
+	}
+	return claimUIDs
+}
+
+// fullCores returns the CPUs of each core whose threads are all in the given CPUs.
+// Core IDs are unique within a socket only, so the cores are looked up by socket.
+func fullCores(topo *cpuinfo.CPUTopology, cpus cpuset.CPUSet) []cpuset.CPUSet {
+	var cores []cpuset.CPUSet
+	for _, cpu := range cpus.List() {
+		info := topo.CPUDetails[cpu]
+		coreCPUs := topo.CPUDetails.CPUsInCores(info.CoreID).Intersection(topo.CPUDetails.CPUsInSockets(info.SocketID))
+		// each core is found once, from its first thread.
+		if coreCPUs.List()[0] != cpu || !coreCPUs.IsSubsetOf(cpus) {
+			continue
+		}
+		cores = append(cores, coreCPUs)
+	}
+	return cores
+}
+
+// brokenCoreCPUs returns the allocated CPUs which break the whole cores: all the CPUs of the claims
+// consuming the CPU capacity only, and the CPUs of the claims allocated whole cores not forming one.
+func (cp *CPUDriver) brokenCoreCPUs() cpuset.CPUSet {
+	broken := cpuset.New()
+	if cp.cpuAllocationStore == nil {
+		return broken
+	}
+	for claimUID, cpus := range cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		if cp.cpuAllocationStore.IsResourceClaimFullCores(claimUID) {
+			for _, core := range fullCores(cp.cpuTopology, cpus) {
+				cpus = cpus.Difference(core)
+			}
+		}
+		broken = broken.Union(cpus)
+	}
+	return broken
+}
+
+// fullCoresCapacity returns the full cores capacity of a grouped device: its cores not broken by
+// the allocations of single threads. The scheduler accounts for the cores consumed by the claims.
+func (cp *CPUDriver) fullCoresCapacity(deviceCPUs cpuset.CPUSet) int64 {
+	return int64(len(fullCores(cp.cpuTopology, deviceCPUs.Difference(cp.brokenCoreCPUs()))))
+}
+
+// fullCoresCapacityRequestPolicy returns the request policy of the full cores capacity of the grouped devices: the
+// claims which don't request it consume no full core, instead of all the full cores of the device.
+func fullCoresCapacityRequestPolicy() *resourceapi.CapacityRequestPolicy {
+	return &resourceapi.CapacityRequestPolicy{
+		Default: ptr.To(resource.MustParse("0")),
+		ValidRange: &resourceapi.CapacityRequestPolicyRange{
+			Min:  ptr.To(resource.MustParse("0")),
+			Step: ptr.To(resource.MustParse("1")),
+		},
+	}
+}
+
+// takeFullCores takes the given number of whole cores from the available CPUs of a device.
+func (cp *CPUDriver) takeFullCores(logger logr.Logger, deviceName string, availableCPUs cpuset.CPUSet, numCores int) (cpuset.CPUSet, error) {
+	topo := cp.cpuTopology
+	freeCoreCPUs := cpuset.New()
+	cores := fullCores(topo, availableCPUs)
+	for _, core := range cores {
+		freeCoreCPUs = freeCoreCPUs.Union(core)
+	}
+	if len(cores) < numCores {
+		return cpuset.New(), fmt.Errorf("%d full cores of device %s requested, but only %d are available", numCores, deviceName, len(cores))
+	}
+	return cpumanager.TakeByTopologyNUMAPacked(logger, topo, freeCoreCPUs, numCores*topo.CPUsPerCore(), cpumanager.CPUSortingStrategyPacked, cp.preferAlignByUncoreCache)
+}
+
+// republishFullCores publishes again the full cores capacity of the grouped devices after the allocations changed.
+func (cp *CPUDriver) republishFullCores() {
+	if !cp.usesGroupedDevices() {
+		return
+	}
+	cp.RequestPublish(PUBLISH_TRIGGER_ALLOCATION_CHANGE)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+// testClaimFullCores returns a claim consuming both the CPU and the full cores capacity of a device.
+func testClaimFullCores(claimUID types.UID, device string, numCPUs, numCores int64) *resourceapi.ResourceClaim {
+	return testClaimWithResults(claimUID, []resourceapi.DeviceRequestAllocationResult{
+		{
+			Driver:  testDriverName,
+			Pool:    testNodeName,
+			Device:  device,
+			Request: "req-0",
+			ConsumedCapacity: map[resourceapi.QualifiedName]resource.Quantity{
+				cpuResourceQualifiedName:       *resource.NewQuantity(numCPUs, resource.DecimalSI),
+				fullCoresResourceQualifiedName: *resource.NewQuantity(numCores, resource.DecimalSI),
+			},
+		},
+	})
+}
+
+// publishedFullCores returns the full cores capacity of the published grouped devices.
+func publishedFullCores(t *testing.T, driver *CPUDriver) map[string]int64 {
+	t.Helper()
+	capacities := make(map[string]int64)
+	for _, device := range driver.createGroupedCPUDeviceSlices(testr.New(t))[0] {
+		capacity := device.Capacity[fullCoresResourceQualifiedName]
+		capacities[device.Name] = capacity.Value.Value()
+	}
+	return capacities
+}
+
+func TestParseFullCoresEnv(t *testing.T) {
+	claimUIDs := parseFullCoresEnv([]string{
+		fullCoresEnvVar("claim-A"),
+		"DRA_CPU_FULL_CORES_claim-B=false",
+		"DRA_CPU_FULL_CORES_=true",
+		fmt.Sprintf("%s_claim-C=%s", cdiEnvVarPrefix, "0-1"),
+	})
+	require.ElementsMatch(t, []types.UID{"claim-A"}, claimUIDs.UnsortedList())
+}
+
+func TestFullCoresCapacity(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             cdiMgr,
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		podConfigStore:     store.NewPodConfig(),
+		pcieRootMapper:     store.NewPCIeRootMapper(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+	require.Equal(t, map[string]int64{"cpudevnuma000": 2, "cpudevnuma001": 2}, publishedFullCores(t, driver))
+
+	// a single thread breaks a core of the NUMA node.
+	threadUID := types.UID("claim-thread")
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim(threadUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[threadUID].Err)
+	require.Equal(t, map[string]int64{"cpudevnuma000": 1, "cpudevnuma001": 2}, publishedFullCores(t, driver))
+
+	// the cores consumed by a claim are accounted by the scheduler, the published capacity is unchanged.
+	coresUID := types.UID("claim-cores")
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaimFullCores(coresUID, "cpudevnuma000", 2, 1),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[coresUID].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(coresUID)
+	require.True(t, cpuset.New(1, 5).Equals(gotCPUs), "claim cpus: got %s", gotCPUs)
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimFullCores(coresUID))
+	require.Contains(t, cdiMgr.specs[getCDIDeviceName(coresUID)].ContainerEdits.Env, fullCoresEnvVar(coresUID))
+	require.NotContains(t, cdiMgr.specs[getCDIDeviceName(threadUID)].ContainerEdits.Env, fullCoresEnvVar(threadUID))
+	require.Equal(t, map[string]int64{"cpudevnuma000": 1, "cpudevnuma001": 2}, publishedFullCores(t, driver))
+
+	// no full core is left on the NUMA node.
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaimFullCores("claim-no-cores", "cpudevnuma000", 2, 1),
+	})
+	require.NoError(t, err)
+	require.ErrorContains(t, prepared["claim-no-cores"].Err, "1 full cores of device cpudevnuma000 requested, but only 0 are available")
+
+	unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: threadUID}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared[threadUID])
+	require.Equal(t, map[string]int64{"cpudevnuma000": 2, "cpudevnuma001": 2}, publishedFullCores(t, driver))
+}
+
+func TestFullCoresCapacityRequestPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		driver func(t *testing.T) *CPUDriver
+	}{
+		{name: "grouped devices", driver: func(t *testing.T) *CPUDriver { return newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT) }},
+		{name: "CPU pools", driver: newCPUPoolsTestDriver},
+		{name: "socket NUMA partitions", driver: newSocketNUMAPartitionsDriver},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := tc.driver(t)
+			for _, chunk := range driver.createGroupedCPUDeviceSlices(testr.New(t)) {
+				for _, device := range chunk {
+					policy := device.Capacity[fullCoresResourceQualifiedName].RequestPolicy
+					require.NotNil(t, policy, "device %s", device.Name)
+					require.True(t, policy.Default.IsZero(), "device %s", device.Name)
+					require.True(t, policy.ValidRange.Min.IsZero(), "device %s", device.Name)
+					require.Equal(t, "1", policy.ValidRange.Step.String(), "device %s", device.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareResourceClaimsFullCoresOmitted(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	device := driver.createGroupedCPUDeviceSlices(testr.New(t))[0][0]
+	policy := device.Capacity[fullCoresResourceQualifiedName].RequestPolicy
+	require.NotNil(t, policy)
+
+	// the claim requests a single CPU and omits the full cores, so the scheduler consumes the default.
+	claimUID := types.UID("claim-no-full-cores")
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaimFullCores(claimUID, device.Name, 1, policy.Default.Value()),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[claimUID].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.Equal(t, 1, gotCPUs.Size(), "claim cpus: got %s", gotCPUs)
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimFullCores(claimUID))
+}
+
+func TestPrepareResourceClaimsFullCoresMismatch(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             newMockCdiMgr(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	claimUID := types.UID("claim-mismatch")
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaimFullCores(claimUID, "cpudevnuma001", 3, 2),
+	})
+	require.NoError(t, err)
+	require.ErrorContains(t, prepared[claimUID].Err, "consumed CPU capacity is 3 instead of 4")
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.False(t, ok)
+}
+
+func TestSynchronizeFullCores(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	containers := []*api.Container{
+		{Id: "cores", PodSandboxId: pod.Id, Name: "cores", Env: []string{fmt.Sprintf("%s_claim-A=%s", cdiEnvVarPrefix, "0,4"), fullCoresEnvVar("claim-A")}},
+		{Id: "thread", PodSandboxId: pod.Id, Name: "thread", Env: []string{fmt.Sprintf("%s_claim-B=%s", cdiEnvVarPrefix, "2")}},
+	}
+
+	_, err = driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, containers)
+	require.NoError(t, err)
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimFullCores("claim-A"))
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimFullCores("claim-B"))
+	require.True(t, cpuset.New(2).Equals(driver.brokenCoreCPUs()), "broken core cpus: got %s", driver.brokenCoreCPUs())
+}
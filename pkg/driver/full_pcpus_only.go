@@ -0,0 +1,59 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+)
+
+// claimUsesFullPCPUsOnly returns true if the claim must be allocated whole physical cores only: SMT is enabled,
+// and either --full-pcpus-only is set, its opaque configuration enables fullPCPUsOnly, or its CPUProfile has the
+// full-cores SMT policy.
+func (cp *CPUDriver) claimUsesFullPCPUsOnly(claim *resourceapi.ResourceClaim) (bool, error) {
+	enabled := cp.fullPCPUsOnly
+	if !enabled && claim.Status.Allocation != nil {
+		var err error
+		enabled, err = cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.FullPCPUsOnly })
+		if err != nil {
+			return false, err
+		}
+	}
+	if !enabled {
+		profile, err := cp.claimCPUProfile(claim)
+		if err != nil {
+			return false, err
+		}
+		enabled = profile != nil && profile.SMTPolicy == SMT_POLICY_FULL_CORES
+	}
+	return enabled && cp.cpuTopology.CPUsPerCore() > 1, nil
+}
+
+// checkFullPCPUs returns an error if the CPUs of a claim don't form whole physical cores, so the claim would
+// share a core with another workload.
+func (cp *CPUDriver) checkFullPCPUs(claim *resourceapi.ResourceClaim, cpus cpuset.CPUSet) error {
+	coreCPUs := cpuset.New()
+	for _, core := range fullCores(cp.cpuTopology, cpus) {
+		coreCPUs = coreCPUs.Union(core)
+	}
+	if partial := cpus.Difference(coreCPUs); !partial.IsEmpty() {
+		return fmt.Errorf("claim %s/%s requires whole physical cores, but the CPUs %s don't form whole cores", claim.Namespace, claim.Name, partial.String())
+	}
+	return nil
+}
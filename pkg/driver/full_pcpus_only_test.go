@@ -0,0 +1,125 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsFullPCPUsOnly(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-full-pcpus")
+
+	testCases := []struct {
+		name           string
+		fullPCPUsOnly  bool
+		allocated      cpuset.CPUSet
+		claim          *resourceapi.ResourceClaim
+		expectedCPUSet cpuset.CPUSet
+		expectedError  bool
+	}{
+		{
+			name:           "whole cores",
+			fullPCPUsOnly:  true,
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:          "not a multiple of the threads of a core",
+			fullPCPUsOnly: true,
+			claim:         testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 3}),
+			expectedError: true,
+		},
+		{
+			name:          "no whole core left",
+			fullPCPUsOnly: true,
+			allocated:     cpuset.New(0, 1),
+			claim:         testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			expectedError: true,
+		},
+		{
+			name:           "broken cores without the option",
+			allocated:      cpuset.New(0, 1),
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			expectedCPUSet: cpuset.New(4, 5),
+		},
+		{
+			name:          "enabled by the device configuration",
+			claim:         testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}), `{"fullPCPUsOnly": true}`),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.fullPCPUsOnly = tc.fullPCPUsOnly
+			})
+			if !tc.allocated.IsEmpty() {
+				driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", tc.allocated)
+			}
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestPrepareResourceClaimsFullPCPUsOnlyIndividualDevices(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.fullPCPUsOnly = true
+	})
+	deviceNames := map[int]string{}
+	for name, cpuID := range driver.deviceNameToCPUID {
+		deviceNames[cpuID] = name
+	}
+	claimOf := func(claimUID types.UID, cpuIDs ...int) *resourceapi.ResourceClaim {
+		var results []resourceapi.DeviceRequestAllocationResult
+		for _, cpuID := range cpuIDs {
+			results = append(results, resourceapi.DeviceRequestAllocationResult{Driver: testDriverName, Pool: testNodeName, Device: deviceNames[cpuID]})
+		}
+		return testClaimWithResults(claimUID, results)
+	}
+
+	// the siblings 0 and 4 form a core, 1 and 2 don't.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-core", 0, 4),
+		claimOf("claim-threads", 1, 2),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-core"].Err)
+	require.Error(t, prepared["claim-threads"].Err)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-threads")
+	require.False(t, ok)
+}
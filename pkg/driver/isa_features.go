@@ -0,0 +1,77 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// procRoot is where the cpuinfo file is read from. It is not namespaced: the driver reads the host CPUs.
+const procRoot = "/proc"
+
+// isaFeatures are the instruction set features published as device attributes, with the flags of the cpuinfo
+// file reporting them: a CPU has the feature if it reports all the flags.
+var isaFeatures = []struct {
+	attribute resourceapi.QualifiedName
+	flags     []string
+}{
+	{attribute: AttributeAVX512, flags: []string{"avx512f"}},
+	{attribute: AttributeAMX, flags: []string{"amx_tile"}},
+	{attribute: AttributeSSE4, flags: []string{"sse4_1", "sse4_2"}},
+	{attribute: AttributeSVE, flags: []string{"sve"}},
+	{attribute: AttributeSGX, flags: []string{"sgx"}},
+}
+
+// readCPUFlags reads the feature flags of the CPUs. The devices report no instruction set feature if they
+// can't be read.
+func (cp *CPUDriver) readCPUFlags(logger logr.Logger, procfs fs.FS) {
+	flags, err := cpuinfo.CPUFlags(procfs)
+	if err != nil {
+		logger.Error(err, "failed to read the feature flags of the CPUs, the devices report no instruction set feature")
+		return
+	}
+	cp.cpuFlags = flags
+}
+
+// setISAFeatureAttributes reports the instruction set features of a device: true if all its CPUs have the
+// feature, as a claim may get any of them. Not reported if the flags of a CPU are unknown.
+func (cp *CPUDriver) setISAFeatureAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	if len(cp.cpuFlags) == 0 || cpus.IsEmpty() {
+		return
+	}
+	for _, cpuID := range cpus.UnsortedList() {
+		if _, ok := cp.cpuFlags[cpuID]; !ok {
+			return
+		}
+	}
+	for _, feature := range isaFeatures {
+		supported := true
+		for _, cpuID := range cpus.UnsortedList() {
+			if !cp.cpuFlags[cpuID].HasAll(feature.flags...) {
+				supported = false
+				break
+			}
+		}
+		attrs[feature.attribute] = resourceapi.DeviceAttribute{BoolValue: ptr.To(supported)}
+	}
+}
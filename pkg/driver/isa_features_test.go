@@ -0,0 +1,67 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestISAFeatureAttributes(t *testing.T) {
+	logger := testr.New(t)
+	var cpuinfo strings.Builder
+	for cpuID := range 4 {
+		flags := "fpu sse4_1 sse4_2 avx512f amx_tile"
+		if cpuID == 3 {
+			flags = "fpu sse4_1 sse4_2"
+		}
+		fmt.Fprintf(&cpuinfo, "processor\t: %d\nflags\t\t: %s\n\n", cpuID, flags)
+	}
+	procfs := fstest.MapFS{"cpuinfo": &fstest.MapFile{Data: []byte(cpuinfo.String())}}
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.readCPUFlags(logger, procfs)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			fast := driver.deviceNameToCPUID[dev.Name] != 3
+			require.Equal(t, fast, *dev.Attributes[AttributeAVX512].BoolValue, dev.Name)
+			require.Equal(t, fast, *dev.Attributes[AttributeAMX].BoolValue, dev.Name)
+			require.True(t, *dev.Attributes[AttributeSSE4].BoolValue, dev.Name)
+			require.False(t, *dev.Attributes[AttributeSVE].BoolValue, dev.Name)
+			require.False(t, *dev.Attributes[AttributeSGX].BoolValue, dev.Name)
+		}
+	}
+
+	// the grouped devices report the features all their CPUs have.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	attrs := driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.False(t, *attrs[AttributeAVX512].BoolValue)
+	require.True(t, *attrs[AttributeSSE4].BoolValue)
+
+	// without the flags, no feature is reported.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	driver.readCPUFlags(logger, fstest.MapFS{})
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeSSE4)
+}
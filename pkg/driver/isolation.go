@@ -0,0 +1,160 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// ISOLATION_DOMAIN_NUMA_NODE keeps the claims of different tiers on different NUMA nodes.
+	ISOLATION_DOMAIN_NUMA_NODE = "numanode"
+	// ISOLATION_DOMAIN_L3 keeps the claims of different tiers on different L3 caches.
+	ISOLATION_DOMAIN_L3 = "l3"
+)
+
+// IsolationConflictError is returned when a claim can't be prepared without sharing an isolation
+// domain with the claims of another tier.
+type IsolationConflictError struct {
+	// Tier is the tier of the claim being prepared.
+	Tier string
+	// ConflictingTiers are the tiers of the claims already using the domains the claim needs.
+	ConflictingTiers []string
+	// Domain is the isolation domain, ISOLATION_DOMAIN_NUMA_NODE or ISOLATION_DOMAIN_L3.
+	Domain string
+	// Reason details the conflict.
+	Reason string
+}
+
+func (e *IsolationConflictError) Error() string {
+	return fmt.Sprintf("claim of tier %q can't share a %s with the claims of tiers %q: %s", e.Tier, e.Domain, e.ConflictingTiers, e.Reason)
+}
+
+// claimTier returns the tier of the claim: the value of the isolation label of the pods it is reserved for.
+// A claim without tier is not isolated from the others. The pods sharing a claim must have the same tier.
+func (cp *CPUDriver) claimTier(ctx context.Context, logger logr.Logger, claim *resourceapi.ResourceClaim) (string, error) {
+	if cp.isolationLabel == "" || cp.kubeClient == nil {
+		return "", nil
+	}
+	tier := ""
+	for _, consumer := range claim.Status.ReservedFor {
+		if consumer.Resource != "pods" {
+			continue
+		}
+		pod, err := cp.kubeClient.CoreV1().Pods(claim.Namespace).Get(ctx, consumer.Name, metav1.GetOptions{})
+		if err != nil {
+			// unlike the passthrough annotations, a missing tier could break the isolation.
+			return "", fmt.Errorf("cannot read the isolation label of pod %s/%s: %w", claim.Namespace, consumer.Name, err)
+		}
+		if pod.UID != consumer.UID {
+			continue
+		}
+		podTier := pod.Labels[cp.isolationLabel]
+		if tier != "" && podTier != tier {
+			return "", fmt.Errorf("claim %s/%s is reserved for pods of different tiers %q and %q", claim.Namespace, claim.Name, tier, podTier)
+		}
+		tier = podTier
+	}
+	logger.V(4).Info("claim isolation tier", "label", cp.isolationLabel, "tier", tier)
+	return tier, nil
+}
+
+// isolationDomainCPUs expands the CPUs to all the CPUs of the isolation domains they belong to.
+func (cp *CPUDriver) isolationDomainCPUs(cpus cpuset.CPUSet) cpuset.CPUSet {
+	details := cp.cpuTopology.CPUDetails
+	if cp.isolationDomain == ISOLATION_DOMAIN_L3 {
+		return details.CPUsInUncoreCaches(details.KeepOnly(cpus).UncoreCaches().UnsortedList()...)
+	}
+	return details.CPUsInNUMANodes(details.KeepOnly(cpus).NUMANodes().UnsortedList()...)
+}
+
+// isolatedCPUs returns the CPUs a claim of the tier can't use, because their isolation domains
+// host claims of other tiers, and these tiers.
+func (cp *CPUDriver) isolatedCPUs(tier string) (cpuset.CPUSet, []string) {
+	isolated := cpuset.New()
+	var conflictingTiers []string
+	if tier == "" || cp.claimTiers == nil {
+		return isolated, nil
+	}
+	for claimUID, claimTier := range cp.claimTiers.All() {
+		if claimTier == tier {
+			continue
+		}
+		cpus, ok := cp.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		if !ok {
+			continue
+		}
+		isolated = isolated.Union(cp.isolationDomainCPUs(cpus))
+		if !slices.Contains(conflictingTiers, claimTier) {
+			conflictingTiers = append(conflictingTiers, claimTier)
+		}
+	}
+	return isolated, conflictingTiers
+}
+
+// checkIsolation verifies the CPUs allocated to a claim of the tier don't share an isolation domain with other tiers.
+func (cp *CPUDriver) checkIsolation(tier string, cpus cpuset.CPUSet) error {
+	isolated, conflictingTiers := cp.isolatedCPUs(tier)
+	if overlap := cpus.Intersection(isolated); !overlap.IsEmpty() {
+		return &IsolationConflictError{
+			Tier:             tier,
+			ConflictingTiers: conflictingTiers,
+			Domain:           cp.isolationDomain,
+			Reason:           fmt.Sprintf("the allocated CPUs %s share a %s with them", overlap.String(), cp.isolationDomain),
+		}
+	}
+	return nil
+}
+
+// isolationError turns the failure to allocate CPUs from a device into an IsolationConflictError,
+// if the isolation of the other tiers made some of the device CPUs unavailable.
+func (cp *CPUDriver) isolationError(err error, tier string, conflictingTiers []string, deviceCPUs, isolated cpuset.CPUSet) error {
+	if deviceCPUs.Intersection(isolated).IsEmpty() {
+		return err
+	}
+	isolationConflicts.Inc()
+	return &IsolationConflictError{
+		Tier:             tier,
+		ConflictingTiers: conflictingTiers,
+		Domain:           cp.isolationDomain,
+		Reason:           err.Error(),
+	}
+}
+
+// setClaimTier records the tier of a prepared claim. An empty tier forgets the claim.
+func (cp *CPUDriver) setClaimTier(claimUID types.UID, tier string) {
+	if cp.claimTiers == nil {
+		return
+	}
+	cp.claimTiers.Set(claimUID, tier)
+}
+
+// forgetClaimTier forgets the tier of a claim which is unprepared, or whose preparation failed.
+func (cp *CPUDriver) forgetClaimTier(claimUID types.UID) {
+	if cp.claimTiers == nil {
+		return
+	}
+	cp.claimTiers.Remove(claimUID)
+}
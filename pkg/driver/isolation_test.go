@@ -0,0 +1,179 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+const testIsolationLabel = "example.com/tier"
+
+// isolationTestPod returns a pod with the given tier, or without the isolation label if the tier is empty.
+func isolationTestPod(name, tier string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(name + "-uid"),
+		},
+	}
+	if tier != "" {
+		pod.Labels = map[string]string{testIsolationLabel: tier}
+	}
+	return pod
+}
+
+// reservedForPods makes the claim reserved for the pods.
+func reservedForPods(claim *resourceapi.ResourceClaim, pods ...*corev1.Pod) *resourceapi.ResourceClaim {
+	claim.Namespace = "default"
+	for _, pod := range pods {
+		claim.Status.ReservedFor = append(claim.Status.ReservedFor, resourceapi.ResourceClaimConsumerReference{
+			Resource: "pods", Name: pod.Name, UID: pod.UID,
+		})
+	}
+	return claim
+}
+
+func newIsolationDriver(t *testing.T, cpuInfos []cpuinfo.CPUInfo, domain string, pods ...*corev1.Pod) *CPUDriver {
+	t.Helper()
+	var objects []runtime.Object
+	for _, pod := range pods {
+		objects = append(objects, pod)
+	}
+	return newTestDriver(t, cpuInfos, func(driver *CPUDriver) {
+		driver.kubeClient = fake.NewClientset(objects...)
+		driver.isolationLabel = testIsolationLabel
+		driver.isolationDomain = domain
+	})
+}
+
+func prepareOne(t *testing.T, driver *CPUDriver, claim *resourceapi.ResourceClaim) error {
+	t.Helper()
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	return prepared[claim.UID].Err
+}
+
+func TestIsolationGroupedNUMANode(t *testing.T) {
+	latency := isolationTestPod("latency", "latency")
+	latency2 := isolationTestPod("latency2", "latency")
+	batch := isolationTestPod("batch", "batch")
+	untiered := isolationTestPod("untiered", "")
+	driver := newIsolationDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, ISOLATION_DOMAIN_NUMA_NODE, latency, latency2, batch, untiered)
+
+	latencyClaim := reservedForPods(testClaim("claim-latency", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), latency)
+	require.NoError(t, prepareOne(t, driver, latencyClaim))
+	require.Equal(t, "latency", driver.claimTiers.Get(latencyClaim.UID))
+
+	// NUMA node 0 has free CPUs, but hosts the latency tier.
+	batchClaim := reservedForPods(testClaim("claim-batch", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), batch)
+	err := prepareOne(t, driver, batchClaim)
+	var conflict *IsolationConflictError
+	require.True(t, errors.As(err, &conflict), "got %v", err)
+	require.Equal(t, "batch", conflict.Tier)
+	require.Equal(t, []string{"latency"}, conflict.ConflictingTiers)
+	require.Equal(t, ISOLATION_DOMAIN_NUMA_NODE, conflict.Domain)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(batchClaim.UID)
+	require.False(t, ok)
+
+	batchClaim = reservedForPods(testClaim("claim-batch-numa1", testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}), batch)
+	require.NoError(t, prepareOne(t, driver, batchClaim))
+
+	// the same tier and the pods without tier share the NUMA node.
+	require.NoError(t, prepareOne(t, driver, reservedForPods(testClaim("claim-latency2", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}), latency2)))
+	require.NoError(t, prepareOne(t, driver, reservedForPods(testClaim("claim-untiered", testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 1}), untiered)))
+
+	// once the other tier is gone from the NUMA node, it can be used.
+	_, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{
+		{UID: "claim-latency"}, {UID: "claim-latency2"},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, driver.claimTiers.All(), types.UID("claim-latency"))
+	require.NoError(t, prepareOne(t, driver, reservedForPods(testClaim("claim-batch-numa0", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), batch)))
+}
+
+func TestIsolationGroupedL3(t *testing.T) {
+	latency := isolationTestPod("latency", "latency")
+	batch := isolationTestPod("batch", "batch")
+	best := isolationTestPod("best-effort", "best-effort")
+	driver := newIsolationDriver(t, mockCPUInfos_SingleSocket_2Dies_HT, ISOLATION_DOMAIN_L3, latency, batch, best)
+
+	// the single NUMA node has two L3 caches: two tiers fit, a third one doesn't.
+	latencyClaim := reservedForPods(testClaim("claim-latency", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), latency)
+	require.NoError(t, prepareOne(t, driver, latencyClaim))
+	batchClaim := reservedForPods(testClaim("claim-batch", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), batch)
+	require.NoError(t, prepareOne(t, driver, batchClaim))
+
+	latencyCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(latencyClaim.UID)
+	batchCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(batchClaim.UID)
+	details := driver.cpuTopology.CPUDetails
+	require.True(t, details.KeepOnly(latencyCPUs).UncoreCaches().Intersection(details.KeepOnly(batchCPUs).UncoreCaches()).IsEmpty(),
+		"latency %s and batch %s share an L3 cache", latencyCPUs, batchCPUs)
+
+	err := prepareOne(t, driver, reservedForPods(testClaim("claim-best-effort", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}), best))
+	var conflict *IsolationConflictError
+	require.True(t, errors.As(err, &conflict), "got %v", err)
+	require.ElementsMatch(t, []string{"latency", "batch"}, conflict.ConflictingTiers)
+}
+
+func TestIsolationIndividual(t *testing.T) {
+	latency := isolationTestPod("latency", "latency")
+	batch := isolationTestPod("batch", "batch")
+	driver := newIsolationDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, ISOLATION_DOMAIN_NUMA_NODE, latency, batch)
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	driver.initializeDeviceLookupMaps()
+	deviceForCPU := make(map[int]string)
+	for name, cpuID := range driver.deviceNameToCPUID {
+		deviceForCPU[cpuID] = name
+	}
+	individualClaim := func(uid types.UID, cpuID int, pod *corev1.Pod) *resourceapi.ResourceClaim {
+		return reservedForPods(testClaimWithResults(uid, []resourceapi.DeviceRequestAllocationResult{
+			{Driver: testDriverName, Pool: testNodeName, Device: deviceForCPU[cpuID], Request: "req-0"},
+		}), pod)
+	}
+
+	require.NoError(t, prepareOne(t, driver, individualClaim("claim-latency", 0, latency)))
+
+	// the scheduler picked a CPU of the NUMA node hosting the latency tier.
+	err := prepareOne(t, driver, individualClaim("claim-batch", 1, batch))
+	var conflict *IsolationConflictError
+	require.True(t, errors.As(err, &conflict), "got %v", err)
+	require.Equal(t, []string{"latency"}, conflict.ConflictingTiers)
+
+	require.NoError(t, prepareOne(t, driver, individualClaim("claim-batch-numa1", 2, batch)))
+}
+
+func TestClaimTierConflictingPods(t *testing.T) {
+	latency := isolationTestPod("latency", "latency")
+	batch := isolationTestPod("batch", "batch")
+	driver := newIsolationDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, ISOLATION_DOMAIN_NUMA_NODE, latency, batch)
+
+	claim := reservedForPods(testClaim("claim-shared", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), latency, batch)
+	require.ErrorContains(t, prepareOne(t, driver, claim), "reserved for pods of different tiers")
+}
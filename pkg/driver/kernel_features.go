@@ -0,0 +1,210 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// KernelFeature is a kernel feature the driver depends on.
+type KernelFeature string
+
+const (
+	// KERNEL_FEATURE_CGROUP_V2_CPUSET is the cpuset controller of the cgroup v2 unified hierarchy. Optional:
+	// the runtime pins the containers through NRI, which works with cgroup v1 as well.
+	KERNEL_FEATURE_CGROUP_V2_CPUSET KernelFeature = "CgroupV2Cpuset"
+	// KERNEL_FEATURE_SYSFS_TOPOLOGY is the CPU topology exposed in sysfs, used to discover the CPUs. Required.
+	KERNEL_FEATURE_SYSFS_TOPOLOGY KernelFeature = "SysfsTopology"
+	// KERNEL_FEATURE_CPUSET_PARTITIONS is the support of the cpuset partitions (cpuset.cpus.partition). Optional.
+	KERNEL_FEATURE_CPUSET_PARTITIONS KernelFeature = "CpusetPartitions"
+	// KERNEL_FEATURE_SMT_CONTROL is the SMT control interface in sysfs, used to detect if SMT is enabled. Optional:
+	// without it, SMT is inferred from the number of CPUs and cores.
+	KERNEL_FEATURE_SMT_CONTROL KernelFeature = "SMTControl"
+)
+
+const (
+	cgroupRoot = "fs/cgroup"
+	cpuRoot    = "devices/system/cpu"
+)
+
+// topologyFiles are the per-CPU sysfs files the CPU topology is built from.
+var topologyFiles = []string{"core_id", "physical_package_id", "thread_siblings_list"}
+
+// KernelFeatureStatus is the result of the probe of a kernel feature.
+type KernelFeatureStatus struct {
+	Feature   KernelFeature `json:"feature"`
+	Required  bool          `json:"required"`
+	Supported bool          `json:"supported"`
+	// Message explains why the feature is not supported.
+	Message string `json:"message,omitempty"`
+}
+
+// probeKernelFeatures checks the kernel features the driver depends on, looking at sysfs.
+func probeKernelFeatures(sysfs fs.FS) []KernelFeatureStatus {
+	return []KernelFeatureStatus{
+		probeFeature(KERNEL_FEATURE_CGROUP_V2_CPUSET, false, probeCgroupV2Cpuset(sysfs)),
+		probeFeature(KERNEL_FEATURE_SYSFS_TOPOLOGY, true, probeSysfsTopology(sysfs)),
+		probeFeature(KERNEL_FEATURE_CPUSET_PARTITIONS, false, probeCpusetPartitions(sysfs)),
+		probeFeature(KERNEL_FEATURE_SMT_CONTROL, false, probeSMTControl(sysfs)),
+	}
+}
+
+func probeFeature(feature KernelFeature, required bool, err error) KernelFeatureStatus {
+	status := KernelFeatureStatus{Feature: feature, Required: required, Supported: err == nil}
+	if err != nil {
+		status.Message = err.Error()
+	}
+	return status
+}
+
+func probeCgroupV2Cpuset(sysfs fs.FS) error {
+	controllersPath := path.Join(cgroupRoot, "cgroup.controllers")
+	data, err := fs.ReadFile(sysfs, controllersPath)
+	if err != nil {
+		return fmt.Errorf("cannot read /sys/%s, is the cgroup v2 unified hierarchy mounted? %w", controllersPath, err)
+	}
+	if !slices.Contains(strings.Fields(string(data)), "cpuset") {
+		return fmt.Errorf("the cpuset controller is not enabled in the cgroup v2 hierarchy (/sys/%s: %q)", controllersPath, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+func probeSysfsTopology(sysfs fs.FS) error {
+	onlinePath := path.Join(cpuRoot, "online")
+	data, err := fs.ReadFile(sysfs, onlinePath)
+	if err != nil {
+		return fmt.Errorf("cannot read /sys/%s: %w", onlinePath, err)
+	}
+	onlineCPUs, err := cpuset.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("cannot parse /sys/%s: %w", onlinePath, err)
+	}
+	if onlineCPUs.IsEmpty() {
+		return fmt.Errorf("no online CPUs listed in /sys/%s", onlinePath)
+	}
+	for _, cpuID := range onlineCPUs.List() {
+		for _, name := range topologyFiles {
+			topologyPath := path.Join(cpuRoot, fmt.Sprintf("cpu%d", cpuID), "topology", name)
+			if _, err := fs.Stat(sysfs, topologyPath); err != nil {
+				return fmt.Errorf("missing CPU topology file /sys/%s: %w", topologyPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// probeCpusetPartitions looks for the partition file in the cgroup the driver runs in, which is
+// the root of the hierarchy in its cgroup namespace, or in its children: the root cgroup has no partition file.
+func probeCpusetPartitions(sysfs fs.FS) error {
+	const partitionFile = "cpuset.cpus.partition"
+	if _, err := fs.Stat(sysfs, path.Join(cgroupRoot, partitionFile)); err == nil {
+		return nil
+	}
+	entries, err := fs.ReadDir(sysfs, cgroupRoot)
+	if err != nil {
+		return fmt.Errorf("cannot list /sys/%s: %w", cgroupRoot, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := fs.Stat(sysfs, path.Join(cgroupRoot, entry.Name(), partitionFile)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s file found in /sys/%s, the kernel does not support the cpuset partitions", partitionFile, cgroupRoot)
+}
+
+func probeSMTControl(sysfs fs.FS) error {
+	controlPath := path.Join(cpuRoot, "smt", "control")
+	if _, err := fs.Stat(sysfs, controlPath); err != nil {
+		return fmt.Errorf("cannot find /sys/%s: %w", controlPath, err)
+	}
+	return nil
+}
+
+// checkKernelFeatures logs the probed kernel features and returns an error listing the missing required ones.
+func checkKernelFeatures(logger logr.Logger, features []KernelFeatureStatus) error {
+	var missing []string
+	for _, feature := range features {
+		supported := 0.0
+		if feature.Supported {
+			supported = 1.0
+		}
+		kernelFeatureSupported.WithLabelValues(string(feature.Feature)).Set(supported)
+
+		if feature.Supported {
+			logger.V(2).Info("kernel feature supported", "feature", feature.Feature)
+			continue
+		}
+		if !feature.Required {
+			logger.Info("optional kernel feature not supported", "feature", feature.Feature, "reason", feature.Message)
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("%s: %s", feature.Feature, feature.Message))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required kernel features are missing: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// kernelFeatureConditions returns a condition for each probed kernel feature.
+func kernelFeatureConditions(features []KernelFeatureStatus, lastTransitionTime metav1.Time) []metav1.Condition {
+	conditions := make([]metav1.Condition, 0, len(features))
+	for _, feature := range features {
+		condition := metav1.Condition{
+			Type:               string(feature.Feature),
+			Status:             metav1.ConditionTrue,
+			Reason:             "Supported",
+			LastTransitionTime: lastTransitionTime,
+		}
+		if !feature.Supported {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "NotSupported"
+			condition.Message = feature.Message
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+// setKernelFeatureAttributes exposes the optional kernel features as device attributes, so the
+// workloads depending on them can select the nodes supporting them. The required features are
+// always supported on a running driver, so they are not exposed.
+func (cp *CPUDriver) setKernelFeatureAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute) {
+	for _, feature := range cp.kernelFeatures {
+		switch feature.Feature {
+		case KERNEL_FEATURE_CGROUP_V2_CPUSET:
+			attrs[AttributeCgroupV2Cpuset] = resourceapi.DeviceAttribute{BoolValue: ptr.To(feature.Supported)}
+		case KERNEL_FEATURE_CPUSET_PARTITIONS:
+			attrs[AttributeCpusetPartitions] = resourceapi.DeviceAttribute{BoolValue: ptr.To(feature.Supported)}
+		case KERNEL_FEATURE_SMT_CONTROL:
+			attrs[AttributeSMTControl] = resourceapi.DeviceAttribute{BoolValue: ptr.To(feature.Supported)}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func fullKernelFeaturesSysFS() fstest.MapFS {
+	sysfs := fstest.MapFS{
+		"fs/cgroup/cgroup.controllers":                   {Data: []byte("cpuset cpu io memory pids\n")},
+		"fs/cgroup/kubepods.slice/cpuset.cpus.partition": {Data: []byte("member\n")},
+		"devices/system/cpu/online":                      {Data: []byte("0-1\n")},
+		"devices/system/cpu/smt/control":                 {Data: []byte("on\n")},
+	}
+	for _, cpu := range []string{"cpu0", "cpu1"} {
+		for _, name := range topologyFiles {
+			sysfs["devices/system/cpu/"+cpu+"/topology/"+name] = &fstest.MapFile{Data: []byte("0\n")}
+		}
+	}
+	return sysfs
+}
+
+func TestProbeKernelFeatures(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mutate      func(sysfs fstest.MapFS)
+		unsupported []KernelFeature
+		expectedErr string
+	}{
+		{
+			name:   "all supported",
+			mutate: func(sysfs fstest.MapFS) {},
+		},
+		{
+			name: "cgroup v1",
+			mutate: func(sysfs fstest.MapFS) {
+				delete(sysfs, "fs/cgroup/cgroup.controllers")
+			},
+			unsupported: []KernelFeature{KERNEL_FEATURE_CGROUP_V2_CPUSET},
+		},
+		{
+			name: "cpuset controller not enabled",
+			mutate: func(sysfs fstest.MapFS) {
+				sysfs["fs/cgroup/cgroup.controllers"] = &fstest.MapFile{Data: []byte("cpu io memory\n")}
+			},
+			unsupported: []KernelFeature{KERNEL_FEATURE_CGROUP_V2_CPUSET},
+		},
+		{
+			name: "missing topology file",
+			mutate: func(sysfs fstest.MapFS) {
+				delete(sysfs, "devices/system/cpu/cpu1/topology/core_id")
+			},
+			unsupported: []KernelFeature{KERNEL_FEATURE_SYSFS_TOPOLOGY},
+			expectedErr: "missing CPU topology file /sys/devices/system/cpu/cpu1/topology/core_id",
+		},
+		{
+			name: "partition in the own cgroup",
+			mutate: func(sysfs fstest.MapFS) {
+				delete(sysfs, "fs/cgroup/kubepods.slice/cpuset.cpus.partition")
+				sysfs["fs/cgroup/cpuset.cpus.partition"] = &fstest.MapFile{Data: []byte("member\n")}
+			},
+		},
+		{
+			name: "optional features missing",
+			mutate: func(sysfs fstest.MapFS) {
+				delete(sysfs, "fs/cgroup/kubepods.slice/cpuset.cpus.partition")
+				delete(sysfs, "devices/system/cpu/smt/control")
+			},
+			unsupported: []KernelFeature{KERNEL_FEATURE_CPUSET_PARTITIONS, KERNEL_FEATURE_SMT_CONTROL},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sysfs := fullKernelFeaturesSysFS()
+			tc.mutate(sysfs)
+
+			features := probeKernelFeatures(sysfs)
+			require.Len(t, features, 4)
+			var unsupported []KernelFeature
+			for _, feature := range features {
+				if !feature.Supported {
+					require.NotEmpty(t, feature.Message)
+					unsupported = append(unsupported, feature.Feature)
+				}
+			}
+			require.Equal(t, tc.unsupported, unsupported)
+
+			err := checkKernelFeatures(testr.New(t), features)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestKernelFeatureConditions(t *testing.T) {
+	probeTime := metav1.NewTime(time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC))
+	features := []KernelFeatureStatus{
+		{Feature: KERNEL_FEATURE_CGROUP_V2_CPUSET, Supported: true},
+		{Feature: KERNEL_FEATURE_SMT_CONTROL, Supported: false, Message: "cannot find /sys/devices/system/cpu/smt/control"},
+	}
+	require.Equal(t, []metav1.Condition{
+		{Type: "CgroupV2Cpuset", Status: metav1.ConditionTrue, Reason: "Supported", LastTransitionTime: probeTime},
+		{Type: "SMTControl", Status: metav1.ConditionFalse, Reason: "NotSupported", Message: "cannot find /sys/devices/system/cpu/smt/control", LastTransitionTime: probeTime},
+	}, kernelFeatureConditions(features, probeTime))
+}
+
+func TestSetKernelFeatureAttributes(t *testing.T) {
+	cp := &CPUDriver{
+		kernelFeatures: []KernelFeatureStatus{
+			{Feature: KERNEL_FEATURE_CGROUP_V2_CPUSET, Supported: true},
+			{Feature: KERNEL_FEATURE_CPUSET_PARTITIONS, Supported: true},
+			{Feature: KERNEL_FEATURE_SMT_CONTROL, Supported: false},
+		},
+	}
+	attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{}
+	cp.setKernelFeatureAttributes(attrs)
+	require.Equal(t, map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		AttributeCgroupV2Cpuset:   {BoolValue: ptr.To(true)},
+		AttributeCpusetPartitions: {BoolValue: ptr.To(true)},
+		AttributeSMTControl:       {BoolValue: ptr.To(false)},
+	}, attrs)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// kernelIsolation are the CPUs the kernel boot parameters isolate: from the scheduler with isolcpus, and from
+// the periodic tick with nohz_full.
+type kernelIsolation struct {
+	isolcpus cpuset.CPUSet
+	nohzFull cpuset.CPUSet
+}
+
+// readKernelIsolation reads the CPUs isolated by the kernel. The devices report no isolation if they can't be
+// read.
+func (cp *CPUDriver) readKernelIsolation(logger logr.Logger, sysfs fs.FS) {
+	isolcpus, nohzFull, err := cpuinfo.KernelIsolatedCPUs(sysfs)
+	if err != nil {
+		logger.Error(err, "failed to read the CPUs isolated by the kernel, the devices report no isolation")
+		return
+	}
+	cp.kernelIsolation = &kernelIsolation{isolcpus: isolcpus, nohzFull: nohzFull}
+}
+
+// setKernelIsolationAttributes reports whether the CPU of an individual device is isolated by the kernel.
+func (cp *CPUDriver) setKernelIsolationAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpuID int) {
+	if cp.kernelIsolation == nil {
+		return
+	}
+	attrs[AttributeIsolated] = resourceapi.DeviceAttribute{BoolValue: ptr.To(cp.kernelIsolation.isolcpus.Contains(cpuID))}
+	attrs[AttributeNohzFull] = resourceapi.DeviceAttribute{BoolValue: ptr.To(cp.kernelIsolation.nohzFull.Contains(cpuID))}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelIsolationAttributes(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{
+		filepath.Join("devices", "system", "cpu", "isolated"):  &fstest.MapFile{Data: []byte("2-3\n")},
+		filepath.Join("devices", "system", "cpu", "nohz_full"): &fstest.MapFile{Data: []byte("3\n")},
+	}
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.readKernelIsolation(logger, sysfs)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			cpuID := driver.deviceNameToCPUID[dev.Name]
+			require.Equal(t, cpuID >= 2, *dev.Attributes[AttributeIsolated].BoolValue, dev.Name)
+			require.Equal(t, cpuID == 3, *dev.Attributes[AttributeNohzFull].BoolValue, dev.Name)
+		}
+	}
+
+	// the grouped devices report no isolation.
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeIsolated)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+// claimUsesL3AntiAffinity returns true if the opaque configuration of the claim, or of the device class of
+// one of its requests, enables l3AntiAffinity.
+func (cp *CPUDriver) claimUsesL3AntiAffinity(claim *resourceapi.ResourceClaim) (bool, error) {
+	if claim.Status.Allocation == nil {
+		return false, nil
+	}
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.L3AntiAffinity })
+}
+
+// sharedL3CPUs returns the CPUs of the uncore caches hosting exclusive CPUs of the claims other than the given one.
+func (cp *CPUDriver) sharedL3CPUs(claimUID types.UID) cpuset.CPUSet {
+	allocated := cpuset.New()
+	for otherUID, cpus := range cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		if otherUID != claimUID {
+			allocated = allocated.Union(cpus)
+		}
+	}
+	details := cp.cpuTopology.CPUDetails
+	return details.CPUsInUncoreCaches(details.KeepOnly(allocated).UncoreCaches().UnsortedList()...)
+}
+
+// preferL3AntiAffinity returns the available CPUs outside of the shared uncore caches if they are enough for
+// numCPUs, else all the available CPUs: the anti-affinity is best effort.
+func preferL3AntiAffinity(logger logr.Logger, deviceName string, availableCPUs, sharedL3CPUs cpuset.CPUSet, numCPUs int) cpuset.CPUSet {
+	preferred := availableCPUs.Difference(sharedL3CPUs)
+	if preferred.Size() < numCPUs {
+		logger.V(2).Info("not enough CPUs without other claims in their uncore caches", "device", deviceName, "numCPUs", numCPUs, "preferredCPUs", preferred.String())
+		return availableCPUs
+	}
+	return preferred
+}
+
+// reportL3AntiAffinity records if the CPUs allocated to a claim requesting L3 anti-affinity share an uncore
+// cache with other claims.
+func (cp *CPUDriver) reportL3AntiAffinity(logger logr.Logger, claim *resourceapi.ResourceClaim, cpus, sharedL3CPUs cpuset.CPUSet) {
+	shared := cpus.Intersection(sharedL3CPUs)
+	if !shared.IsEmpty() {
+		l3AntiAffinityFallbacks.Inc()
+		logger.Info("L3 anti-affinity not met, CPUs sharing an uncore cache with other claims", "claim", claim.Namespace+"/"+claim.Name, "cpus", shared.String())
+	}
+	if cp.claimStatus == nil {
+		return
+	}
+	cp.claimStatus.track(claim)
+	if !shared.IsEmpty() {
+		cp.claimStatus.setCondition(claim.UID, ClaimConditionL3AntiAffinity, metav1.ConditionFalse, "SharedL3", fmt.Sprintf("CPUs %s share an uncore cache with other claims", shared.String()))
+		return
+	}
+	cp.claimStatus.setCondition(claim.UID, ClaimConditionL3AntiAffinity, metav1.ConditionTrue, "ExclusiveL3", "the CPUs share no uncore cache with other claims")
+}
@@ -0,0 +1,91 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsL3AntiAffinity(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-l3")
+
+	testCases := []struct {
+		name              string
+		parameters        string
+		allocated         cpuset.CPUSet
+		expectedCPUSet    cpuset.CPUSet
+		expectedCondition metav1.ConditionStatus
+	}{
+		{
+			// the uncore cache with the fewest free CPUs.
+			name:           "without anti-affinity",
+			parameters:     `{}`,
+			allocated:      cpuset.New(0, 4),
+			expectedCPUSet: cpuset.New(1, 5),
+		},
+		{
+			name:              "free uncore cache",
+			parameters:        `{"l3AntiAffinity": true}`,
+			allocated:         cpuset.New(0, 4),
+			expectedCPUSet:    cpuset.New(2, 6),
+			expectedCondition: metav1.ConditionTrue,
+		},
+		{
+			// both uncore caches host other claims.
+			name:              "fallback",
+			parameters:        `{"l3AntiAffinity": true}`,
+			allocated:         cpuset.New(0, 2, 4, 6),
+			expectedCPUSet:    cpuset.New(1, 5),
+			expectedCondition: metav1.ConditionFalse,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_SingleSocket_2Dies_HT, func(cp *CPUDriver) {
+				cp.claimStatus = newClaimStatusReporter(fake.NewClientset(), testDriverName)
+			})
+			driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", tc.allocated)
+
+			claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), tc.parameters)
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+
+			condition := meta.FindStatusCondition(driver.claimStatus.conditions(claimUID), ClaimConditionL3AntiAffinity)
+			if tc.expectedCondition == "" {
+				require.Nil(t, condition)
+				return
+			}
+			require.NotNil(t, condition)
+			require.Equal(t, tc.expectedCondition, condition.Status)
+		})
+	}
+}
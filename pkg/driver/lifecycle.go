@@ -0,0 +1,227 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+)
+
+const (
+	// COMPONENT_PROCESS_PINNER pins the host processes onto the reserved CPUs.
+	COMPONENT_PROCESS_PINNER = "process-pinner"
+	// COMPONENT_KUBELET_PLUGIN registers the driver with the kubelet and serves the DRA hooks.
+	COMPONENT_KUBELET_PLUGIN = "kubelet-plugin"
+	// COMPONENT_NRI_ENFORCER pins the containers to their CPUs through the NRI plugin.
+	COMPONENT_NRI_ENFORCER = "nri-enforcer"
+	// COMPONENT_RESOURCE_PUBLISHER publishes the ResourceSlices of the node.
+	COMPONENT_RESOURCE_PUBLISHER = "resource-publisher"
+	// COMPONENT_NODE_STATUS updates the CPUDriverNodeStatus object of the node.
+	COMPONENT_NODE_STATUS = "node-status"
+	// COMPONENT_EFFICIENCY_REPORTER reports the utilization of the exclusive CPUs of the workloads.
+	COMPONENT_EFFICIENCY_REPORTER = "efficiency-reporter"
+	// COMPONENT_PEAK_USAGE_RECORDER records and persists the peak exclusive CPU usage.
+	COMPONENT_PEAK_USAGE_RECORDER = "peak-usage-recorder"
+	// COMPONENT_SHARED_POOL_FILE writes the shared CPUs to the host file for the host agents.
+	COMPONENT_SHARED_POOL_FILE = "shared-pool-file"
+	// COMPONENT_CLAIM_STATUS maintains the device conditions in the status of the prepared claims.
+	COMPONENT_CLAIM_STATUS = "claim-status"
+	// COMPONENT_CDI_MANAGER creates the CDI manager, in the background when it fails at startup.
+	COMPONENT_CDI_MANAGER = "cdi-manager"
+	// COMPONENT_EVENT_RECORDER sends the events of the driver to the API server.
+	COMPONENT_EVENT_RECORDER = "event-recorder"
+	// COMPONENT_FREQUENCY_MONITOR reads the frequency limits of the CPUs for their performance scores.
+	COMPONENT_FREQUENCY_MONITOR = "frequency-monitor"
+	// COMPONENT_CPU_HEALTH_MONITOR reads the online and the unhealthy CPUs for the device taints.
+	COMPONENT_CPU_HEALTH_MONITOR = "cpu-health-monitor"
+	// COMPONENT_BINDING_CONDITIONS sets the binding conditions of the devices of the claims allocated on the node.
+	COMPONENT_BINDING_CONDITIONS = "binding-conditions"
+	// COMPONENT_CPU_PROFILES watches the CPUProfiles the claims reference.
+	COMPONENT_CPU_PROFILES = "cpu-profiles"
+)
+
+// Component is a part of the driver with its own lifecycle. The driver starts its components
+// in order and stops them in reverse order, so the embedders of the driver, like a binary
+// combining several drivers, can reuse its pieces or add their own.
+type Component interface {
+	// Name identifies the component.
+	Name() string
+	// Start starts the component. The long-running work must happen in the background,
+	// and last until Stop is called or the context is cancelled.
+	Start(ctx context.Context) error
+	// Stop stops the component. It is called only if Start succeeded.
+	Stop(ctx context.Context)
+	// Healthy returns an error describing why the component is not working properly, if so.
+	Healthy() error
+}
+
+// LifecycleHooks are called around the lifecycle of the driver components.
+type LifecycleHooks struct {
+	// PostStart is called once all the components started. An error fails the start of the driver.
+	PostStart func(ctx context.Context, cp *CPUDriver) error
+	// PreStop is called before the components are stopped.
+	PreStop func(ctx context.Context, cp *CPUDriver)
+}
+
+// lifecycle starts and stops an ordered list of components.
+type lifecycle struct {
+	lock       sync.Mutex
+	components []Component
+	// started is how many components, in order, were started.
+	started int
+}
+
+func (l *lifecycle) add(components ...Component) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.components = append(l.components, components...)
+}
+
+// start starts the components in order. If one fails, the components already started are stopped.
+func (l *lifecycle) start(ctx context.Context) error {
+	logger := ctxlog.FromContext(ctx)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, component := range l.components[l.started:] {
+		logger.V(2).Info("starting component", "component", component.Name())
+		if err := component.Start(ctx); err != nil {
+			l.stopLocked(ctx)
+			return fmt.Errorf("failed to start %s: %w", component.Name(), err)
+		}
+		l.started++
+	}
+	return nil
+}
+
+// stop stops the started components in reverse order.
+func (l *lifecycle) stop(ctx context.Context) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.stopLocked(ctx)
+}
+
+func (l *lifecycle) stopLocked(ctx context.Context) {
+	logger := ctxlog.FromContext(ctx)
+	for ; l.started > 0; l.started-- {
+		component := l.components[l.started-1]
+		logger.V(2).Info("stopping component", "component", component.Name())
+		component.Stop(ctx)
+	}
+}
+
+// healthy returns the problems of the started components.
+func (l *lifecycle) healthy() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.started < len(l.components) {
+		return fmt.Errorf("%d of %d components started", l.started, len(l.components))
+	}
+	var errs []error
+	for _, component := range l.components {
+		if err := component.Healthy(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", component.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *lifecycle) list() []Component {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]Component(nil), l.components...)
+}
+
+// runnerComponent runs a function in the background until it is stopped.
+type runnerComponent struct {
+	name   string
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newRunnerComponent(name string, run func(ctx context.Context)) *runnerComponent {
+	return &runnerComponent{name: name, run: run}
+}
+
+func (r *runnerComponent) Name() string {
+	return r.name
+}
+
+func (r *runnerComponent) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		r.run(ctx)
+	}()
+	return nil
+}
+
+func (r *runnerComponent) Stop(ctx context.Context) {
+	r.cancel()
+	<-r.done
+}
+
+func (r *runnerComponent) Healthy() error {
+	return nil
+}
+
+// Components returns the components of the driver, in start order.
+func (cp *CPUDriver) Components() []Component {
+	return cp.lifecycle.list()
+}
+
+// Component returns the component with the given name, or nil if there is none.
+func (cp *CPUDriver) Component(name string) Component {
+	for _, component := range cp.Components() {
+		if component.Name() == name {
+			return component
+		}
+	}
+	return nil
+}
+
+// Healthy returns an error describing the components not working properly, if any.
+func (cp *CPUDriver) Healthy() error {
+	return cp.lifecycle.healthy()
+}
+
+// Publisher returns the publisher of the ResourceSlices of the node.
+func (cp *CPUDriver) Publisher() *ResourcePublisher {
+	return cp.publisher
+}
+
+// AllocationStore returns the store of the CPUs allocated to the claims.
+func (cp *CPUDriver) AllocationStore() *store.CPUAllocation {
+	return cp.cpuAllocationStore
+}
+
+// PodConfigStore returns the store of the containers pinned by the driver.
+func (cp *CPUDriver) PodConfigStore() *store.PodConfig {
+	return cp.podConfigStore
+}
+
+// Topology returns the CPU topology of the node.
+func (cp *CPUDriver) Topology() *cpuinfo.CPUTopology {
+	return cp.cpuTopology
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeComponent struct {
+	name       string
+	startErr   error
+	healthyErr error
+	events     *[]string
+}
+
+func (f *fakeComponent) Name() string {
+	return f.name
+}
+
+func (f *fakeComponent) Start(ctx context.Context) error {
+	*f.events = append(*f.events, "start "+f.name)
+	return f.startErr
+}
+
+func (f *fakeComponent) Stop(ctx context.Context) {
+	*f.events = append(*f.events, "stop "+f.name)
+}
+
+func (f *fakeComponent) Healthy() error {
+	return f.healthyErr
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	var events []string
+	cp := &CPUDriver{}
+	cp.lifecycle.add(
+		&fakeComponent{name: "a", events: &events},
+		&fakeComponent{name: "b", events: &events},
+		&fakeComponent{name: "c", events: &events},
+	)
+
+	require.NoError(t, cp.lifecycle.start(context.Background()))
+	require.NoError(t, cp.Healthy())
+	cp.lifecycle.stop(context.Background())
+	// a second stop is a no-op.
+	cp.lifecycle.stop(context.Background())
+
+	require.Equal(t, []string{"start a", "start b", "start c", "stop c", "stop b", "stop a"}, events)
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	var events []string
+	cp := &CPUDriver{}
+	cp.lifecycle.add(
+		&fakeComponent{name: "a", events: &events},
+		&fakeComponent{name: "b", events: &events, startErr: fmt.Errorf("boom")},
+		&fakeComponent{name: "c", events: &events},
+	)
+
+	err := cp.lifecycle.start(context.Background())
+	require.ErrorContains(t, err, "failed to start b: boom")
+	// the components started before the failure are stopped, the failed one is not.
+	require.Equal(t, []string{"start a", "start b", "stop a"}, events)
+	require.Error(t, cp.Healthy())
+}
+
+func TestLifecycleHealthy(t *testing.T) {
+	var events []string
+	cp := &CPUDriver{}
+	cp.lifecycle.add(
+		&fakeComponent{name: "a", events: &events, healthyErr: fmt.Errorf("not connected")},
+		&fakeComponent{name: "b", events: &events},
+		&fakeComponent{name: "c", events: &events, healthyErr: fmt.Errorf("not registered")},
+	)
+	require.NoError(t, cp.lifecycle.start(context.Background()))
+
+	err := cp.Healthy()
+	require.ErrorContains(t, err, "a: not connected")
+	require.ErrorContains(t, err, "c: not registered")
+	require.NotContains(t, err.Error(), "b:")
+}
+
+func TestComponentAccessors(t *testing.T) {
+	var events []string
+	cp := &CPUDriver{}
+	cp.publisher = newResourcePublisher(func(context.Context) {})
+	cp.lifecycle.add(&fakeComponent{name: "a", events: &events}, cp.publisher)
+
+	require.Len(t, cp.Components(), 2)
+	require.Equal(t, cp.publisher, cp.Component(COMPONENT_RESOURCE_PUBLISHER))
+	require.Same(t, cp.publisher, cp.Publisher())
+	require.Nil(t, cp.Component("missing"))
+}
+
+func TestRunnerComponentStopWaits(t *testing.T) {
+	stopped := false
+	runner := newRunnerComponent("runner", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = true
+	})
+	require.NoError(t, runner.Start(context.Background()))
+	runner.Stop(context.Background())
+	require.True(t, stopped)
+}
+
+func TestResourcePublisherComponent(t *testing.T) {
+	published := make(chan struct{}, 1)
+	publisher := newResourcePublisher(func(context.Context) {
+		published <- struct{}{}
+	})
+	require.NoError(t, publisher.Start(context.Background()))
+	// the resources are published when the publisher starts.
+	<-published
+	publisher.Stop(context.Background())
+	require.NoError(t, publisher.Healthy())
+}
@@ -0,0 +1,61 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+const (
+	// PROFILE_LOW_LATENCY tunes the node for the latency-sensitive workloads while the claim is prepared:
+	// the performance governor on its CPUs, no interrupts and no migrated timers on them.
+	PROFILE_LOW_LATENCY = "low-latency"
+)
+
+// lowLatencyTuning are the tunings of the CPUs of the low-latency claims.
+var lowLatencyTuning = cpuTuning{
+	governor:              "performance",
+	excludeInterrupts:     true,
+	disableTimerMigration: true,
+}
+
+// validateProfileConfig returns an error if the profile of the opaque configuration of a request is invalid.
+func validateProfileConfig(request string, config DeviceConfig) error {
+	switch config.Profile {
+	case "", PROFILE_LOW_LATENCY:
+		return nil
+	}
+	return fmt.Errorf("invalid profile %q for request %q, must be %s", config.Profile, request, PROFILE_LOW_LATENCY)
+}
+
+// claimUsesLowLatencyProfile returns true if any request of the claim allocated by the driver uses the
+// low-latency profile. Returns an error if the profile is not enabled on the node.
+func (cp *CPUDriver) claimUsesLowLatencyProfile(claim *resourceapi.ResourceClaim) (bool, error) {
+	if claim.Status.Allocation == nil {
+		return false, nil
+	}
+	enabled, err := cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.Profile == PROFILE_LOW_LATENCY })
+	if err != nil {
+		return false, err
+	}
+	if enabled && (cp.tuner == nil || !cp.featureGates.Enabled(FEATURE_GATE_LOW_LATENCY_PROFILE)) {
+		return false, fmt.Errorf("claim %s/%s uses the %s profile, which requires the %s feature gate", claim.Namespace, claim.Name, PROFILE_LOW_LATENCY, FEATURE_GATE_LOW_LATENCY_PROFILE)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsLowLatencyProfile(t *testing.T) {
+	claimUID := types.UID("claim-low-latency")
+	newClaim := func() *resourceapi.ResourceClaim {
+		return testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), `{"profile": "low-latency"}`)
+	}
+
+	t.Run("feature gate disabled", func(t *testing.T) {
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{newClaim()})
+		require.NoError(t, err)
+		require.ErrorContains(t, prepared[claimUID].Err, "requires the LowLatencyProfile feature gate")
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+		claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), `{"profile": "realtime"}`)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+		require.NoError(t, err)
+		require.ErrorContains(t, prepared[claimUID].Err, `invalid profile "realtime"`)
+	})
+
+	t.Run("applied and reverted", func(t *testing.T) {
+		onlineCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+		sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+		gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_LOW_LATENCY_PROFILE): true})
+		require.NoError(t, err)
+		driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+			cp.tuner = newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+			cp.featureGates = gates
+		})
+
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{newClaim()})
+		require.NoError(t, err)
+		require.NoError(t, prepared[claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		require.Equal(t, "0,4", gotCPUs.String())
+		require.Equal(t, "performance", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+		require.Equal(t, "1-3,5-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+		require.Equal(t, "0", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+
+		_, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+		require.NoError(t, err)
+		require.Equal(t, "powersave", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+		require.Equal(t, "0-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+		require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+	})
+	t.Run("CDI failure", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			mode     string
+			newClaim func(driver *CPUDriver) *resourceapi.ResourceClaim
+		}{
+			{
+				name:     "grouped",
+				mode:     CPU_DEVICE_MODE_GROUPED,
+				newClaim: func(*CPUDriver) *resourceapi.ResourceClaim { return newClaim() },
+			},
+			{
+				name: "individual",
+				mode: CPU_DEVICE_MODE_INDIVIDUAL,
+				newClaim: func(driver *CPUDriver) *resourceapi.ResourceClaim {
+					var results []resourceapi.DeviceRequestAllocationResult
+					for name, cpuID := range driver.deviceNameToCPUID {
+						if cpuID == 4 || cpuID == 5 {
+							results = append(results, resourceapi.DeviceRequestAllocationResult{Driver: testDriverName, Pool: testNodeName, Device: name})
+						}
+					}
+					return testClaimAllCPUs(testClaimWithResults(claimUID, results), `{"profile": "low-latency"}`)
+				},
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				onlineCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+				sysfsRoot, procfsRoot := newTestTunables(t, onlineCPUs, 10)
+				mockCdiMgr := newMockCdiMgr()
+				mockCdiMgr.addError = fmt.Errorf("cdi add error")
+				gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_LOW_LATENCY_PROFILE): true})
+				require.NoError(t, err)
+				driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+					cp.cpuDeviceMode = tc.mode
+					cp.cdiMgr = mockCdiMgr
+					cp.tuner = newCPUTuner(sysfsRoot, procfsRoot, onlineCPUs)
+					cp.featureGates = gates
+				})
+
+				prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.newClaim(driver)})
+				require.NoError(t, err)
+				require.ErrorContains(t, prepared[claimUID].Err, "cdi add error")
+				// the kubelet retry finds the CPUs free and untuned.
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				require.Equal(t, onlineCPUs.String(), driver.cpuAllocationStore.GetSharedCPUs().String())
+				require.Equal(t, "powersave", readTestTunable(t, sysfsRoot, "devices", "system", "cpu", "cpu4", "cpufreq", "scaling_governor"))
+				require.Equal(t, "0-7", readTestTunable(t, procfsRoot, "irq", "10", "smp_affinity_list"))
+				require.Equal(t, "ff", readTestTunable(t, procfsRoot, "irq", "default_smp_affinity"))
+				require.Equal(t, "1", readTestTunable(t, procfsRoot, "sys", "kernel", "timer_migration"))
+			})
+		}
+	})
+}
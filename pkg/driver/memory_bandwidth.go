@@ -0,0 +1,86 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+// memoryBandwidthResourceQualifiedName is the qualified name of the memory bandwidth capacity of the NUMA node
+// devices, in bytes per second. The claims not asking for it consume none.
+const memoryBandwidthResourceQualifiedName = "dra.cpu/memoryBandwidth"
+
+// resolveMemoryBandwidth sets the memory bandwidth of the NUMA nodes, in bytes per second: from the configured
+// table, in GB/s, or else from the HMAT of the firmware. The NUMA nodes with neither publish no bandwidth.
+func (cp *CPUDriver) resolveMemoryBandwidth(logger logr.Logger, config *Config, sysfs fs.FS) error {
+	numaNodes := cp.cpuTopology.CPUDetails.NUMANodes()
+	for _, numaNodeID := range slices.Sorted(maps.Keys(config.NUMAMemoryBandwidth)) {
+		if !numaNodes.Contains(numaNodeID) {
+			return fmt.Errorf("the memory bandwidth of NUMA node %d is configured, but the NUMA node is not in the CPU topology", numaNodeID)
+		}
+	}
+	if cp.cpuDeviceMode != CPU_DEVICE_MODE_GROUPED || cp.cpuDeviceGroupBy != GROUP_BY_NUMA_NODE {
+		if len(config.NUMAMemoryBandwidth) > 0 {
+			return fmt.Errorf("the memory bandwidth of the NUMA nodes requires --cpu-device-mode=%s and --group-by=%s", CPU_DEVICE_MODE_GROUPED, GROUP_BY_NUMA_NODE)
+		}
+		return nil
+	}
+	cp.numaMemoryBandwidth = make(map[int]int64)
+	for _, numaNodeID := range numaNodes.List() {
+		if gbps, ok := config.NUMAMemoryBandwidth[numaNodeID]; ok {
+			cp.numaMemoryBandwidth[numaNodeID] = gbps * 1000 * 1000 * 1000
+			continue
+		}
+		mbps, err := cpuinfo.NUMANodeReadBandwidth(sysfs, numaNodeID)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			logger.Error(err, "failed to read the memory bandwidth of the NUMA node, its device publishes none", "numaNodeID", numaNodeID)
+			continue
+		}
+		cp.numaMemoryBandwidth[numaNodeID] = mbps * 1000 * 1000
+	}
+	if len(cp.numaMemoryBandwidth) > 0 {
+		logger.Info("publishing the memory bandwidth of the NUMA nodes", "bytesPerSecond", cp.numaMemoryBandwidth)
+	}
+	return nil
+}
+
+// setMemoryBandwidthCapacity adds the memory bandwidth capacity of its NUMA node to a device, if known.
+func (cp *CPUDriver) setMemoryBandwidthCapacity(capacity map[resourceapi.QualifiedName]resourceapi.DeviceCapacity, numaNodeID int) {
+	bandwidth, ok := cp.numaMemoryBandwidth[numaNodeID]
+	if !ok || bandwidth <= 0 {
+		return
+	}
+	capacity[memoryBandwidthResourceQualifiedName] = resourceapi.DeviceCapacity{
+		Value: *resource.NewQuantity(bandwidth, resource.DecimalSI),
+		RequestPolicy: &resourceapi.CapacityRequestPolicy{
+			Default: ptr.To(resource.MustParse("0")),
+		},
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMemoryBandwidthCapacity(t *testing.T) {
+	logger := testr.New(t)
+	sysfs := fstest.MapFS{
+		filepath.Join("devices", "system", "node", "node0", "access0", "initiators", "read_bandwidth"): &fstest.MapFile{Data: []byte("200000\n")},
+		filepath.Join("devices", "system", "node", "node1", "access0", "initiators", "read_bandwidth"): &fstest.MapFile{Data: []byte("200000\n")},
+	}
+
+	// the firmware bandwidth of NUMA node 0, and the configured one of NUMA node 1.
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	require.NoError(t, driver.resolveMemoryBandwidth(logger, &Config{NUMAMemoryBandwidth: map[int]int64{1: 250}}, sysfs))
+	chunks := driver.createGroupedCPUDeviceChunks(logger)
+	require.Len(t, chunks[0].devices, 2)
+	for _, dev := range chunks[0].devices {
+		expected := resource.MustParse("200G")
+		if *dev.Attributes[AttributeNUMANodeID].IntValue == 1 {
+			expected = resource.MustParse("250G")
+		}
+		capacity := dev.Capacity[memoryBandwidthResourceQualifiedName]
+		require.Zero(t, expected.Cmp(capacity.Value), dev.Name)
+		require.True(t, capacity.RequestPolicy.Default.IsZero(), dev.Name)
+	}
+
+	// without bandwidth, no capacity is published.
+	driver = newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	require.NoError(t, driver.resolveMemoryBandwidth(logger, &Config{}, fstest.MapFS{}))
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Capacity, memoryBandwidthResourceQualifiedName)
+
+	// the configured bandwidth must match the topology and the device mode.
+	err := driver.resolveMemoryBandwidth(logger, &Config{NUMAMemoryBandwidth: map[int]int64{7: 250}}, sysfs)
+	require.ErrorContains(t, err, "NUMA node 7 is configured")
+	driver = newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceGroupBy = GROUP_BY_SOCKET
+	})
+	err = driver.resolveMemoryBandwidth(logger, &Config{NUMAMemoryBandwidth: map[int]int64{0: 250}}, sysfs)
+	require.ErrorContains(t, err, "requires --cpu-device-mode=grouped")
+}
@@ -0,0 +1,251 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "dra_driver_cpu"
+
+// The labels of the node metrics follow the conventions of kube-state-metrics, so the dashboards of
+// kube_node_status_allocatable can join them on the node, resource and unit labels.
+const (
+	nodeMetricResourceCPU = "cpu"
+	nodeMetricUnitCore    = "core"
+)
+
+const (
+	reservedCPUsIssueUnknownCPU       = "unknown_cpu"
+	reservedCPUsIssueNUMANodeReserved = "numa_node_fully_reserved"
+)
+
+var (
+	// reservedCPUsIssues reports the problems found validating the reserved CPUs against the topology.
+	reservedCPUsIssues = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "reserved_cpus_issues",
+		Help:      "Number of problems found validating the reserved CPUs against the discovered CPU topology, by issue.",
+	}, []string{"issue"})
+
+	// numaNodeFragmentationScore reports how fragmented the free CPUs of each NUMA node are.
+	numaNodeFragmentationScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "numa_node_fragmentation_score",
+		Help:      "Fragmentation of the free CPUs of the NUMA node, from 0 (all free CPUs are full cores sharing an uncore cache) to 1 (scattered).",
+	}, []string{"numa_node"})
+
+	// nriConnectionState reports the state of the connection between the NRI plugin and the runtime.
+	nriConnectionState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nri_connection_state",
+		Help:      "State of the NRI plugin connection with the runtime: 1 for the current state, 0 for the others.",
+	}, []string{"state"})
+
+	// nriContainerUpdatesSupported reports if the runtime applies the updates of the running containers.
+	nriContainerUpdatesSupported = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nri_container_updates_supported",
+		Help:      "1 if the runtime applies the CPU updates of the running containers, 0 if the CPUs are pinned only at container creation.",
+	})
+
+	// resourcePublications counts the ResourceSlices publications, by trigger.
+	resourcePublications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "resource_publications_total",
+		Help:      "Number of ResourceSlices publications, by trigger. A publication coalescing several triggers is counted once for each of them.",
+	}, []string{"trigger"})
+
+	// resourcePublicationsSkipped counts the ResourceSlices publications skipped because nothing changed.
+	resourcePublicationsSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "resource_publications_skipped_total",
+		Help:      "Number of ResourceSlices publications skipped because no resource pool changed since the last publication.",
+	})
+
+	// numaNodePeakExclusiveCPUs reports the peak number of exclusive CPUs allocated on each NUMA node in the current period.
+	numaNodePeakExclusiveCPUs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "numa_node_peak_exclusive_cpus",
+		Help:      "Peak number of exclusive CPUs allocated on the NUMA node in the current day or ISO week, by period.",
+	}, []string{"numa_node", "period"})
+
+	// deviceMappingMismatches reports the published devices not matching the device mapping derived at startup.
+	deviceMappingMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "device_mapping_mismatches",
+		Help:      "Number of devices of the ResourceSlices found at startup which don't resolve to the same CPUs with the current topology and configuration.",
+	})
+
+	// isolationConflicts counts the claims failed because of the isolation of the other tiers.
+	isolationConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "isolation_conflicts_total",
+		Help:      "Number of claims which could not be prepared without sharing an isolation domain with the claims of another tier.",
+	})
+
+	// l3AntiAffinityFallbacks counts the claims with L3 anti-affinity allocated CPUs sharing an uncore cache with other claims.
+	l3AntiAffinityFallbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "l3_anti_affinity_fallbacks_total",
+		Help:      "Number of claims requesting L3 anti-affinity which were allocated CPUs sharing an uncore cache with other claims.",
+	})
+
+	// kernelFeatureSupported reports the kernel features probed at startup.
+	kernelFeatureSupported = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "kernel_feature_supported",
+		Help:      "1 if the kernel feature is supported, 0 otherwise, by feature. Probed at startup.",
+	}, []string{"feature"})
+
+	// workloadExclusiveCPUs reports the exclusive CPUs allocated to the pods of each workload of the node.
+	workloadExclusiveCPUs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "workload_exclusive_cpus",
+		Help:      "Number of exclusive CPUs allocated to the pods of the workload on the node, by owner. Updated with the efficiency report.",
+	}, []string{"namespace", "kind", "name"})
+
+	// workloadExclusiveCPUsUtilization reports the mean utilization of the exclusive CPUs of each workload of the node.
+	workloadExclusiveCPUsUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "workload_exclusive_cpus_utilization",
+		Help:      "Mean utilization of the exclusive CPUs allocated to the pods of the workload on the node over the last report interval, from 0 to 1, by owner.",
+	}, []string{"namespace", "kind", "name"})
+
+	// featureGateEnabled reports the effective feature gates.
+	featureGateEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "feature_gate_enabled",
+		Help:      "1 if the feature gate is enabled, 0 otherwise, by feature gate and stage.",
+	}, []string{"feature_gate", "stage"})
+
+	// sharedCPUs reports the number of CPUs of the shared pool.
+	sharedCPUs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "shared_cpus",
+		Help:      "Number of CPUs of the shared pool, not reserved and not allocated to any claim.",
+	})
+
+	// nodeStatusAllocatable reports the CPUs the driver can allocate exclusively on the node.
+	nodeStatusAllocatable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_status_allocatable",
+		Help:      "Number of CPUs of the node the driver can allocate exclusively, without the reserved CPUs. Labeled like kube_node_status_allocatable.",
+	}, []string{"node", "resource", "unit"})
+
+	// nodeStatusRemaining reports the CPUs the driver can still allocate exclusively on the node.
+	nodeStatusRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_status_remaining",
+		Help:      "Number of CPUs of the node the driver can still allocate exclusively, not allocated to any claim. Labeled like kube_node_status_allocatable.",
+	}, []string{"node", "resource", "unit"})
+
+	// sharedPoolExhausted reports if the shared pool is at or below the minimum size.
+	sharedPoolExhausted = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "shared_pool_exhausted",
+		Help:      "1 if the shared pool has at most the minimum number of CPUs set by --min-shared-cpus, 0 otherwise. Always 0 if no minimum is set.",
+	})
+
+	// sharedPoolExhaustions counts the times the shared pool dropped to the minimum size.
+	sharedPoolExhaustions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "shared_pool_exhaustions_total",
+		Help:      "Number of times the allocations shrank the shared pool to at most the minimum number of CPUs set by --min-shared-cpus.",
+	})
+
+	// smallClaimAllocations counts the small claims allocated with the SmallClaimFastPath feature gate, by path.
+	smallClaimAllocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "small_claim_allocations_total",
+		Help:      "Number of device allocations of one or two CPUs with the SmallClaimFastPath feature gate enabled, by path: served by the free lists, or falling back to the topology packing.",
+	}, []string{"path"})
+
+	// cpusetVerificationMismatches counts the containers whose cgroup cpuset doesn't match the assigned CPUs.
+	cpusetVerificationMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cpuset_verification_mismatches_total",
+		Help:      "Number of containers whose cgroup cpuset did not match the assigned CPUs once started, by check: first_check, or after_retry once the update was sent again. Only counted with the CPUSetVerification feature gate.",
+	}, []string{"check"})
+
+	// startupDegraded reports the components whose start is retried in the background.
+	startupDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "startup_degraded",
+		Help:      "1 while the start of the component is retried in the background, 0 once it completed. Only reported with the DegradedStartup feature gate.",
+	}, []string{"component"})
+
+	// legacyDeviceNameTranslations counts the device names of the allocations translated from the legacy naming.
+	legacyDeviceNameTranslations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "legacy_device_name_translations_total",
+		Help:      "Number of allocated device names translated from the naming of previous driver versions. Claims using them should be recreated before the translation is removed.",
+	})
+
+	// cpuBorrowingEvents counts the containers borrowing the idle CPUs, and the revocations of the borrowed CPUs.
+	cpuBorrowingEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cpu_borrowing_events_total",
+		Help:      "Number of containers of the claims with borrowIdleCPUs, by event: borrow when created on the idle CPUs, revoke when shrunk for a new exclusive claim, revoke_failure when they could not be shrunk and the claim preparation failed.",
+	}, []string{"event"})
+)
+
+func init() {
+	prometheus.MustRegister(reservedCPUsIssues)
+	prometheus.MustRegister(numaNodeFragmentationScore)
+	prometheus.MustRegister(nriConnectionState)
+	prometheus.MustRegister(nriContainerUpdatesSupported)
+	prometheus.MustRegister(resourcePublications)
+	prometheus.MustRegister(resourcePublicationsSkipped)
+	prometheus.MustRegister(numaNodePeakExclusiveCPUs)
+	prometheus.MustRegister(legacyDeviceNameTranslations)
+	prometheus.MustRegister(kernelFeatureSupported)
+	prometheus.MustRegister(deviceMappingMismatches)
+	prometheus.MustRegister(isolationConflicts)
+	prometheus.MustRegister(l3AntiAffinityFallbacks)
+	prometheus.MustRegister(workloadExclusiveCPUs)
+	prometheus.MustRegister(workloadExclusiveCPUsUtilization)
+	prometheus.MustRegister(featureGateEnabled)
+	prometheus.MustRegister(sharedCPUs)
+	prometheus.MustRegister(nodeStatusAllocatable)
+	prometheus.MustRegister(nodeStatusRemaining)
+	prometheus.MustRegister(sharedPoolExhausted)
+	prometheus.MustRegister(sharedPoolExhaustions)
+	prometheus.MustRegister(smallClaimAllocations)
+	prometheus.MustRegister(cpusetVerificationMismatches)
+	prometheus.MustRegister(startupDegraded)
+	prometheus.MustRegister(cpuBorrowingEvents)
+}
+
+// updateAllocationMetrics refreshes the metrics derived from the allocations.
+// Must be called after each change of the allocations.
+func (cp *CPUDriver) updateAllocationMetrics(logger logr.Logger) {
+	cp.updateFragmentationMetrics()
+	cp.updatePeakUsage(logger)
+	if cp.cpuTopology != nil {
+		allocatable := cp.cpuTopology.CPUDetails.CPUs().Difference(cp.reservedCPUs)
+		nodeStatusAllocatable.WithLabelValues(cp.nodeName, nodeMetricResourceCPU, nodeMetricUnitCore).Set(float64(allocatable.Size()))
+	}
+	if cp.cpuAllocationStore != nil {
+		shared := cp.cpuAllocationStore.GetSharedCPUs()
+		sharedCPUs.Set(float64(shared.Size()))
+		nodeStatusRemaining.WithLabelValues(cp.nodeName, nodeMetricResourceCPU, nodeMetricUnitCore).Set(float64(shared.Size()))
+		cp.sharedPool.update(logger, shared)
+		cp.sharedPoolFile.update(shared)
+	}
+}
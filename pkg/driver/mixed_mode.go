@@ -0,0 +1,100 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/cpuset"
+)
+
+// numaNodeCPUsCounter is the counter of the allocatable CPUs of a NUMA node, in mixed mode and with the
+// NUMA partitions of the socket devices.
+const numaNodeCPUsCounter = "cpus"
+
+// numaNodeCounterSetName returns the name of the counter set of a NUMA node, in mixed mode: the name of its device.
+func (cp *CPUDriver) numaNodeCounterSetName(numaNodeID int) string {
+	return cp.numaDeviceName(numaNodeID)
+}
+
+// allocatableCPUsByNUMANode returns the allocatable CPUs of each NUMA node, the ones of the individual devices.
+func (cp *CPUDriver) allocatableCPUsByNUMANode() map[int]cpuset.CPUSet {
+	cpusByNUMANode := make(map[int]cpuset.CPUSet)
+	for _, device := range cp.cpuDeviceInfos() {
+		cpusByNUMANode[device.cpu.NUMANodeID] = cpusByNUMANode[device.cpu.NUMANodeID].Union(cpuset.New(device.cpu.CpuID))
+	}
+	return cpusByNUMANode
+}
+
+// numaNodeCounterSets returns the counter sets shared by the individual and the grouped devices in mixed mode:
+// one per NUMA node, counting its allocatable CPUs.
+func (cp *CPUDriver) numaNodeCounterSets() []resourceapi.CounterSet {
+	cpusByNUMANode := cp.allocatableCPUsByNUMANode()
+	var counterSets []resourceapi.CounterSet
+	for _, numaNodeID := range slices.Sorted(maps.Keys(cpusByNUMANode)) {
+		counterSets = append(counterSets, resourceapi.CounterSet{
+			Name: cp.numaNodeCounterSetName(numaNodeID),
+			Counters: map[string]resourceapi.Counter{
+				numaNodeCPUsCounter: {Value: *resource.NewQuantity(int64(cpusByNUMANode[numaNodeID].Size()), resource.DecimalSI)},
+			},
+		})
+	}
+	return counterSets
+}
+
+// numaNodeCounterConsumption returns the counters a device with the given CPUs consumes in mixed mode:
+// its CPUs, from the counter set of each of their NUMA nodes.
+func (cp *CPUDriver) numaNodeCounterConsumption(cpus cpuset.CPUSet) []resourceapi.DeviceCounterConsumption {
+	details := cp.cpuTopology.CPUDetails.KeepOnly(cpus)
+	var consumption []resourceapi.DeviceCounterConsumption
+	for _, numaNodeID := range details.NUMANodes().List() {
+		consumption = append(consumption, resourceapi.DeviceCounterConsumption{
+			CounterSet: cp.numaNodeCounterSetName(numaNodeID),
+			Counters: map[string]resourceapi.Counter{
+				numaNodeCPUsCounter: {Value: *resource.NewQuantity(int64(details.CPUsInNUMANodes(numaNodeID).Size()), resource.DecimalSI)},
+			},
+		})
+	}
+	return consumption
+}
+
+// validateMixedDeviceMode checks each grouped device spans whole NUMA nodes. The counters are per NUMA node,
+// so a grouped device consuming only a part of one would leave room on the counter for the individual devices
+// of its own CPUs, and the scheduler could hand out the same CPU through both views.
+func (cp *CPUDriver) validateMixedDeviceMode() error {
+	if cp.cpuDeviceMode != CPU_DEVICE_MODE_MIXED {
+		return nil
+	}
+	if len(cp.socketDeviceModes) > 0 {
+		return fmt.Errorf("the %s device mode can't be combined with per-socket device modes", CPU_DEVICE_MODE_MIXED)
+	}
+	cpusByNUMANode := cp.allocatableCPUsByNUMANode()
+	for _, device := range cp.groupedCPUDeviceInfos() {
+		numaNodeCPUs := cpuset.New()
+		for _, numaNodeID := range cp.cpuTopology.CPUDetails.KeepOnly(device.cpus).NUMANodes().List() {
+			numaNodeCPUs = numaNodeCPUs.Union(cpusByNUMANode[numaNodeID])
+		}
+		if !device.cpus.Equals(numaNodeCPUs) {
+			return fmt.Errorf("the %s device mode requires grouped devices spanning whole NUMA nodes, device %s has CPUs %q of NUMA nodes with CPUs %q", CPU_DEVICE_MODE_MIXED, device.name, device.cpus.String(), numaNodeCPUs.String())
+		}
+	}
+	return nil
+}
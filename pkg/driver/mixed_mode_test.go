@@ -0,0 +1,101 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/cpuset"
+)
+
+func newMixedDeviceModeDriver(t *testing.T, opts ...func(*CPUDriver)) *CPUDriver {
+	t.Helper()
+	return newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, append([]func(*CPUDriver){func(driver *CPUDriver) {
+		driver.cpuDeviceMode = CPU_DEVICE_MODE_MIXED
+	}}, opts...)...)
+}
+
+func cpusCounter(value int64) map[string]resourceapi.Counter {
+	return map[string]resourceapi.Counter{numaNodeCPUsCounter: {Value: *resource.NewQuantity(value, resource.DecimalSI)}}
+}
+
+func TestMixedDeviceModeCounters(t *testing.T) {
+	driver := newMixedDeviceModeDriver(t, func(driver *CPUDriver) {
+		driver.reservedCPUs = cpuset.New(0)
+	})
+	require.NoError(t, driver.validateMixedDeviceMode())
+	require.True(t, driver.usesGroupedDevices())
+	require.True(t, driver.usesIndividualDevices())
+
+	require.Equal(t, []resourceapi.CounterSet{
+		{Name: "cpudevnuma000", Counters: cpusCounter(3)},
+		{Name: "cpudevnuma001", Counters: cpusCounter(4)},
+	}, driver.numaNodeCounterSets())
+
+	// each grouped device consumes all the CPUs of its NUMA node.
+	grouped := driver.createGroupedCPUDeviceSlices(testr.New(t))
+	require.Len(t, grouped, 1)
+	require.Len(t, grouped[0], 2)
+	for i, expected := range []resourceapi.DeviceCounterConsumption{
+		{CounterSet: "cpudevnuma000", Counters: cpusCounter(3)},
+		{CounterSet: "cpudevnuma001", Counters: cpusCounter(4)},
+	} {
+		require.Equal(t, []resourceapi.DeviceCounterConsumption{expected}, grouped[0][i].ConsumesCounters)
+	}
+
+	// each individual device consumes its CPU from its NUMA node.
+	individual := driver.createCPUDeviceSlices()
+	require.Len(t, individual, 1)
+	require.Len(t, individual[0], 7)
+	for _, device := range individual[0] {
+		numaNodeID := driver.cpuTopology.CPUDetails[driver.deviceNameToCPUID[device.Name]].NUMANodeID
+		require.Equal(t, []resourceapi.DeviceCounterConsumption{
+			{CounterSet: driver.numaNodeCounterSetName(numaNodeID), Counters: cpusCounter(1)},
+		}, device.ConsumesCounters, device.Name)
+	}
+}
+
+func TestValidateMixedDeviceMode(t *testing.T) {
+	driver := newMixedDeviceModeDriver(t, func(driver *CPUDriver) {
+		driver.cpuDeviceGroupBy = GROUP_BY_SOCKET
+	})
+	require.NoError(t, driver.validateMixedDeviceMode())
+
+	// a core is a part of a NUMA node: the individual devices of its NUMA node would not be fenced off.
+	driver = newMixedDeviceModeDriver(t, func(driver *CPUDriver) {
+		driver.cpuDeviceGroupBy = GROUP_BY_CORE
+	})
+	require.Error(t, driver.validateMixedDeviceMode())
+
+	driver = newMixedDeviceModeDriver(t, func(driver *CPUDriver) {
+		driver.socketDeviceModes = map[int]string{0: CPU_DEVICE_MODE_INDIVIDUAL}
+	})
+	require.Error(t, driver.validateMixedDeviceMode())
+
+	// the other modes consume no counters.
+	driver = newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		driver.cpuDeviceGroupBy = GROUP_BY_CORE
+	})
+	require.NoError(t, driver.validateMixedDeviceMode())
+	for _, device := range driver.createGroupedCPUDeviceSlices(testr.New(t))[0] {
+		require.Empty(t, device.ConsumesCounters)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// NodeStatusKind is the kind of the object summarizing the driver state on a node.
+	NodeStatusKind = "CPUDriverNodeStatus"
+	// NodeStatusConditionNRIConnected is true while the NRI plugin is connected to the runtime.
+	NodeStatusConditionNRIConnected = "NRIConnected"
+	// NodeStatusConditionSharedCPUPoolExhausted is true while the shared pool is at or below the minimum size.
+	// Reported only if a minimum is set.
+	NodeStatusConditionSharedCPUPoolExhausted = "SharedCPUPoolExhausted"
+	// DefaultNodeStatusInterval is how often the node status is updated by default.
+	DefaultNodeStatusInterval = 30 * time.Second
+)
+
+// NodeStatusResource is the resource of the CPUDriverNodeStatus objects.
+var NodeStatusResource = schema.GroupVersionResource{Group: "cpu.dra.x-k8s.io", Version: "v1alpha1", Resource: "cpudrivernodestatuses"}
+
+// NodeStatus is the status of the CPUDriverNodeStatus object of a node.
+type NodeStatus struct {
+	ReservedCPUs string             `json:"reservedCPUs"`
+	SharedCPUs   string             `json:"sharedCPUs"`
+	Allocations  []ClaimInfo        `json:"allocations"`
+	Runtime      NodeStatusRuntime  `json:"runtime"`
+	Conditions   []metav1.Condition `json:"conditions"`
+}
+
+// NodeStatusRuntime describes the container runtime the NRI plugin is connected to.
+type NodeStatusRuntime struct {
+	Name             string `json:"name,omitempty"`
+	Version          string `json:"version,omitempty"`
+	ContainerUpdates bool   `json:"containerUpdates"`
+}
+
+func (cp *CPUDriver) nodeStatus() NodeStatus {
+	nriCondition := cp.NRICondition()
+	connected := metav1.ConditionFalse
+	if nriCondition.State == NRI_STATE_CONNECTED {
+		connected = metav1.ConditionTrue
+	}
+	nriRuntime := cp.NRIRuntime()
+	conditions := []metav1.Condition{
+		{
+			Type:               NodeStatusConditionNRIConnected,
+			Status:             connected,
+			Reason:             nriCondition.Reason,
+			Message:            nriCondition.Message,
+			LastTransitionTime: metav1.NewTime(nriCondition.LastTransitionTime),
+		},
+	}
+	if cp.sharedPool != nil {
+		conditions = append(conditions, cp.sharedPool.condition())
+	}
+	conditions = append(conditions, cp.startupStatus.list()...)
+	conditions = append(conditions, kernelFeatureConditions(cp.kernelFeatures, metav1.NewTime(cp.kernelFeaturesProbeTime))...)
+	return NodeStatus{
+		ReservedCPUs: cp.reservedCPUs.String(),
+		SharedCPUs:   cp.cpuAllocationStore.GetSharedCPUs().String(),
+		Allocations:  cp.listClaims().Claims,
+		Runtime: NodeStatusRuntime{
+			Name:             nriRuntime.Name,
+			Version:          nriRuntime.Version,
+			ContainerUpdates: nriRuntime.ContainerUpdates,
+		},
+		Conditions: conditions,
+	}
+}
+
+// newNodeStatusObject returns the CPUDriverNodeStatus object of the node, owned by the node
+// so it is garbage collected with it. The status is set only if not nil.
+func newNodeStatusObject(namespace string, node *corev1.Node, status *NodeStatus) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(NodeStatusResource.GroupVersion().String())
+	obj.SetKind(NodeStatusKind)
+	obj.SetNamespace(namespace)
+	obj.SetName(node.Name)
+	obj.SetOwnerReferences([]metav1.OwnerReference{
+		{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+		},
+	})
+	if err := unstructured.SetNestedField(obj.Object, node.Name, "spec", "nodeName"); err != nil {
+		return nil, err
+	}
+	if status != nil {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert the node status: %w", err)
+		}
+		obj.Object["status"] = content
+	}
+	return obj, nil
+}
+
+// updateNodeStatus creates or updates the CPUDriverNodeStatus object of the node.
+func (cp *CPUDriver) updateNodeStatus(ctx context.Context, node *corev1.Node) error {
+	client := cp.nodeStatusClient.Resource(NodeStatusResource).Namespace(cp.nodeStatusNamespace)
+	opts := metav1.ApplyOptions{FieldManager: cp.driverName, Force: true}
+
+	obj, err := newNodeStatusObject(cp.nodeStatusNamespace, node, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Apply(ctx, node.Name, obj, opts); err != nil {
+		return fmt.Errorf("failed to apply %s %s/%s: %w", NodeStatusKind, cp.nodeStatusNamespace, node.Name, err)
+	}
+	status := cp.nodeStatus()
+	obj, err = newNodeStatusObject(cp.nodeStatusNamespace, node, &status)
+	if err != nil {
+		return err
+	}
+	if _, err := client.ApplyStatus(ctx, node.Name, obj, opts); err != nil {
+		return fmt.Errorf("failed to apply the status of %s %s/%s: %w", NodeStatusKind, cp.nodeStatusNamespace, node.Name, err)
+	}
+	return nil
+}
+
+// runNodeStatusUpdater periodically updates the CPUDriverNodeStatus object of the node until the context is cancelled.
+func (cp *CPUDriver) runNodeStatusUpdater(ctx context.Context, interval time.Duration) {
+	ctx, logger := ctxlog.WithValues(ctx, "namespace", cp.nodeStatusNamespace, "interval", interval)
+	logger.Info("updating the node status")
+
+	var node *corev1.Node
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if node == nil {
+			var err error
+			node, err = cp.kubeClient.CoreV1().Nodes().Get(ctx, cp.nodeName, metav1.GetOptions{})
+			if err != nil {
+				logger.Error(err, "failed to get the node, will retry")
+				node = nil
+				return
+			}
+		}
+		if err := cp.updateNodeStatus(ctx, node); err != nil {
+			logger.Error(err, "failed to update the node status, will retry")
+			return
+		}
+		logger.V(4).Info("updated the node status")
+	}, interval)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/cpuset"
+)
+
+func TestNodeStatus(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	reservedCPUs := cpuset.New(0)
+	driver := &CPUDriver{
+		reservedCPUs:       reservedCPUs,
+		cpuAllocationStore: store.NewCPUAllocation(topo, reservedCPUs),
+		podConfigStore:     store.NewPodConfig(),
+		nriSupervisor:      newNRISupervisor(),
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-a", cpuset.New(2, 6))
+	driver.podConfigStore.SetContainerState("pod-1", store.NewContainerState("ctr-1", "ctr-id-1", "claim-a"))
+
+	status := driver.nodeStatus()
+	require.Equal(t, "0", status.ReservedCPUs)
+	require.Equal(t, "1,3-5,7", status.SharedCPUs)
+	require.Equal(t, []ClaimInfo{
+		{
+			ClaimUID:   "claim-a",
+			CPUs:       "2,6",
+			Containers: []ContainerInfo{{PodUID: "pod-1", ContainerName: "ctr-1", ContainerID: "ctr-id-1"}},
+		},
+	}, status.Allocations)
+	require.True(t, status.Runtime.ContainerUpdates)
+	require.Len(t, status.Conditions, 1)
+	require.Equal(t, NodeStatusConditionNRIConnected, status.Conditions[0].Type)
+	require.Equal(t, metav1.ConditionFalse, status.Conditions[0].Status)
+
+	driver.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+	status = driver.nodeStatus()
+	require.Equal(t, metav1.ConditionTrue, status.Conditions[0].Status)
+	require.Equal(t, "Synchronized", status.Conditions[0].Reason)
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "my-node", UID: "node-uid"}}
+	obj, err := newNodeStatusObject("kube-system", node, &status)
+	require.NoError(t, err)
+	require.Equal(t, "cpu.dra.x-k8s.io/v1alpha1", obj.GetAPIVersion())
+	require.Equal(t, NodeStatusKind, obj.GetKind())
+	require.Equal(t, "kube-system", obj.GetNamespace())
+	require.Equal(t, "my-node", obj.GetName())
+	require.Equal(t, []metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: "my-node", UID: "node-uid"}}, obj.GetOwnerReferences())
+	nodeName, _, err := unstructured.NestedString(obj.Object, "spec", "nodeName")
+	require.NoError(t, err)
+	require.Equal(t, "my-node", nodeName)
+	sharedCPUs, _, err := unstructured.NestedString(obj.Object, "status", "sharedCPUs")
+	require.NoError(t, err)
+	require.Equal(t, "1,3-5,7", sharedCPUs)
+
+	obj, err = newNodeStatusObject("kube-system", node, nil)
+	require.NoError(t, err)
+	_, found := obj.Object["status"]
+	require.False(t, found)
+}
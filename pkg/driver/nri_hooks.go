@@ -19,6 +19,8 @@ package driver
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/containerd/nri/pkg/api"
@@ -40,6 +42,12 @@ func (cp *CPUDriver) Synchronize(ctx context.Context, pods []*api.PodSandbox, co
 	cpuAllocationStore := store.NewCPUAllocation(cp.cpuTopology, cp.reservedCPUs)
 	podConfigStore := store.NewPodConfig()
 	var containerUpdates []*api.ContainerUpdate
+	// cpuQuotaRestores are the CPU quotas to restore on the containers not pinned to exclusive CPUs anymore.
+	cpuQuotaRestores := make(map[string]int64)
+	// borrowerUpdates are the updates of the containers borrowing the idle CPUs, with their guaranteed CPUs.
+	borrowerUpdates := make(map[*api.ContainerUpdate]cpuset.CPUSet)
+	// fractionalUpdates are the updates of the containers of fractional claims, with the CPUs of their devices.
+	fractionalUpdates := make(map[*api.ContainerUpdate]cpuset.CPUSet)
 
 	for _, pod := range pods {
 		pLogger := logger.WithValues("pod", ctxlog.KObj(pod), "podUID", pod.Uid)
@@ -55,47 +63,157 @@ func (cp *CPUDriver) Synchronize(ctx context.Context, pods []*api.PodSandbox, co
 				cLogger.Error(err, "error parsing DRA env for container")
 				continue
 			}
+			podAllocations := cp.podClaimAllocations(types.UID(pod.GetUid()), container.GetName())
+			claimAllocations = withPodClaimAllocations(claimAllocations, podAllocations)
 			containerUID := types.UID(container.GetId())
+			fractionalClaims := parseFractionalCPUsEnv(cLogger, container.Env)
 			var state *store.ContainerState
 			var claimUIDs []types.UID
-			if len(claimAllocations) == 0 {
+			if len(claimAllocations) == 0 && len(fractionalClaims) > 0 {
+				var fractional store.FractionalClaim
+				fractional, claimUIDs = mergeFractionalClaims(fractionalClaims)
+				envTraceIDs := parseTraceIDEnv(container.Env)
+				for _, uid := range claimUIDs {
+					traceID := cp.claimTraceID(envTraceIDs, uid)
+					caLogger := cLogger.WithValues("claimUID", uid, "traceID", traceID)
+					if err := cp.claimTracker.SetOwner(caLogger, uid, types.UID(pod.Uid), container.Name); err != nil {
+						return nil, err
+					}
+					cpuAllocationStore.AddFractionalClaimAllocation(caLogger, uid, fractionalClaims[uid])
+					if traceID != "" {
+						cpuAllocationStore.SetResourceClaimTraceID(uid, traceID)
+					}
+				}
+				cLogger.V(2).Info("found fractional CPUs", "milliCPUs", fractional.MilliCPUs, "deviceCPUs", fractional.CPUs.String())
+				state = store.NewContainerState(container.GetName(), containerUID, claimUIDs...).SetCgroupsPath(container.GetLinux().GetCgroupsPath())
+				fractionalUpdate := &api.ContainerUpdate{ContainerId: container.GetId()}
+				containerUpdates = append(containerUpdates, fractionalUpdate)
+				fractionalUpdates[fractionalUpdate] = fractional.CPUs
+			} else if len(claimAllocations) == 0 {
 				state = store.NewContainerState(container.GetName(), containerUID)
+				if quota, ok := originalCPUQuota(container); ok {
+					cpuQuotaRestores[container.GetId()] = quota
+				}
 			} else {
 				allGuaranteedCPUs := cpuset.New()
+				cpuQuotaDisabled := false
+				numaBalancingDisabled := false
+				borrowIdleCPUs := false
+				envTraceIDs := parseTraceIDEnv(container.Env)
+				envFullCores := parseFullCoresEnv(container.Env)
 				for uid, cpus := range claimAllocations {
-					caLogger := cLogger.WithValues("claimUID", uid)
-					err := cp.claimTracker.SetOwner(caLogger, uid, types.UID(pod.Uid), container.Name)
-					if err != nil {
-						return nil, err
+					// the store being rebuilt is not yet in use: the trace IDs not in the environment come from the previous one.
+					traceID := cp.claimTraceID(envTraceIDs, uid)
+					caLogger := cLogger.WithValues("claimUID", uid, "traceID", traceID)
+					if _, podLevel := podAllocations[uid]; !podLevel {
+						err := cp.claimTracker.SetOwner(caLogger, uid, types.UID(pod.Uid), container.Name)
+						if err != nil {
+							return nil, err
+						}
 					}
 
 					allGuaranteedCPUs = allGuaranteedCPUs.Union(cpus)
 					claimUIDs = append(claimUIDs, uid)
-					cpuAllocationStore.AddResourceClaimAllocation(caLogger, uid, cpus)
+					if cp.isSystemClaimAllocation(cpus) {
+						cpuAllocationStore.AddSystemClaimAllocation(caLogger, uid, cpus)
+					} else {
+						cpuAllocationStore.AddResourceClaimAllocation(caLogger, uid, cpus)
+					}
+					if traceID != "" {
+						cpuAllocationStore.SetResourceClaimTraceID(uid, traceID)
+					}
+					if cp.isolationLabel != "" {
+						cp.setClaimTier(uid, pod.GetLabels()[cp.isolationLabel])
+					}
+					if cp.containerCPUQuotaDisabled(container.Env, []types.UID{uid}) {
+						cpuAllocationStore.SetResourceClaimCPUQuotaDisabled(uid, true)
+						cpuQuotaDisabled = true
+					}
+					if cp.containerNUMABalancingDisabled(container.Env, []types.UID{uid}) {
+						cpuAllocationStore.SetResourceClaimNUMABalancingDisabled(uid, true)
+						numaBalancingDisabled = true
+					}
+					if cp.containerBorrowsIdleCPUs(container.Env, []types.UID{uid}) {
+						cpuAllocationStore.SetResourceClaimBorrowing(uid, true)
+						borrowIdleCPUs = true
+					}
+					if envFullCores.Has(uid) || cp.cpuAllocationStore.IsResourceClaimFullCores(uid) {
+						cpuAllocationStore.SetResourceClaimFullCores(uid, true)
+					}
 				}
 				cLogger.V(2).Info("found guaranteed CPUs", "cpus", allGuaranteedCPUs.String())
-				state = store.NewContainerState(container.GetName(), containerUID, claimUIDs...)
+				state = store.NewContainerState(container.GetName(), containerUID, claimUIDs...).SetCgroupsPath(container.GetLinux().GetCgroupsPath())
 
 				// Reconcile guaranteed container CPU mask.
 				guaranteedUpdate := &api.ContainerUpdate{
 					ContainerId: container.GetId(),
 				}
 				guaranteedUpdate.SetLinuxCPUSetCPUs(allGuaranteedCPUs.String())
+				if mems := cp.guaranteedMemoryNodes(allGuaranteedCPUs, numaBalancingDisabled); mems != "" {
+					guaranteedUpdate.SetLinuxCPUSetMems(mems)
+				}
+				if cpuQuotaDisabled {
+					if _, ok := originalCPUQuota(container); ok {
+						guaranteedUpdate.SetLinuxCPUQuota(unlimitedCPUQuota)
+					}
+				}
 				containerUpdates = append(containerUpdates, guaranteedUpdate)
+				if borrowIdleCPUs {
+					borrowerUpdates[guaranteedUpdate] = allGuaranteedCPUs
+				}
 			}
 			podConfigStore.SetContainerState(types.UID(pod.GetUid()), state)
 		}
 	}
 
+	if cp.podClaims != nil {
+		// the claims bound to their pods, in NRI-only mode or with the pod-level pinning, are released only
+		// in UnprepareResourceClaims, so the prepared ones stay allocated even if none of their containers runs.
+		for claimUID, cpus := range cp.podClaims.Allocations() {
+			if _, ok := cpuAllocationStore.GetResourceClaimAllocation(claimUID); ok {
+				continue
+			}
+			if cp.isSystemClaimAllocation(cpus) {
+				cpuAllocationStore.AddSystemClaimAllocation(logger, claimUID, cpus)
+			} else {
+				cpuAllocationStore.AddResourceClaimAllocation(logger, claimUID, cpus)
+			}
+		}
+	}
+
 	cp.podConfigStore = podConfigStore
 	cp.cpuAllocationStore = cpuAllocationStore
+	cp.updateAllocationMetrics(logger)
+	cp.republishFullCores()
+	// the shared CPUs are known only once all the allocations are restored.
+	for update, guaranteedCPUs := range borrowerUpdates {
+		update.SetLinuxCPUSetCPUs(guaranteedCPUs.Union(cpuAllocationStore.GetSharedCPUs()).String())
+	}
+	for update, deviceCPUs := range fractionalUpdates {
+		update.SetLinuxCPUSetCPUs(cp.fractionalContainerCPUs(deviceCPUs).String())
+	}
 
 	// Reconcile container CPU masks to handle cases where the NRI plugin might have crashed
 	// or restarted and missed updating the cgroup settings.
 	// See: https://github.com/containerd/nri/issues/282
 	sharedContainerUpdates := cp.getSharedContainerUpdates(logger, types.UID(""))
+	for _, update := range sharedContainerUpdates {
+		if quota, ok := cpuQuotaRestores[update.ContainerId]; ok {
+			logger.V(2).Info("restoring the CPU quota of the container", "containerID", update.ContainerId, "quota", quota)
+			update.SetLinuxCPUQuota(quota)
+		}
+	}
 	containerUpdates = append(containerUpdates, sharedContainerUpdates...)
-	return containerUpdates, nil
+	if cp.nriSupervisor.Runtime().ContainerUpdates {
+		cp.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+	} else {
+		cp.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "CreateTimePinningOnly", "the runtime does not support container updates: CPUs are pinned only at container creation")
+	}
+	if cp.nriPlugin != nil && cp.nriSupervisor.Runtime().ContainerUpdates {
+		// the plugin can't request updates before the synchronization completes.
+		go cp.probeContainerUpdates(logger, pods, containers)
+	}
+	return cp.containerUpdates(logger, containerUpdates), nil
 }
 
 func parseDRAEnvToClaimAllocations(logger logr.Logger, envs []string) (map[types.UID]cpuset.CPUSet, error) {
@@ -128,6 +246,41 @@ func parseDRAEnvToClaimAllocations(logger logr.Logger, envs []string) (map[types
 	return allocations, nil
 }
 
+// podClaimAllocations returns the allocations of the claims bound to the pod which the container consumes.
+// Used in NRI-only mode, when the claims can't be learned from the container environment, and for the
+// claims with the pod-level pinning, which the containers share without consuming them.
+func (cp *CPUDriver) podClaimAllocations(podUID types.UID, containerName string) map[types.UID]cpuset.CPUSet {
+	allocations := make(map[types.UID]cpuset.CPUSet)
+	if cp.podClaims == nil {
+		return allocations
+	}
+	for _, claimUID := range cp.podClaims.Get(podUID, containerName) {
+		cpus, ok := cp.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		if !ok {
+			continue
+		}
+		allocations[claimUID] = cpus
+	}
+	return allocations
+}
+
+// withPodClaimAllocations adds the allocations of the claims bound to the pod to the ones of the container environment.
+func withPodClaimAllocations(allocations, podAllocations map[types.UID]cpuset.CPUSet) map[types.UID]cpuset.CPUSet {
+	if len(podAllocations) == 0 {
+		return allocations
+	}
+	if allocations == nil {
+		allocations = make(map[types.UID]cpuset.CPUSet, len(podAllocations))
+	}
+	maps.Copy(allocations, podAllocations)
+	return allocations
+}
+
+// isPodClaim returns true if the claim is bound to its pods, and released only when it is unprepared.
+func (cp *CPUDriver) isPodClaim(claimUID types.UID) bool {
+	return cp.podClaims != nil && cp.podClaims.Has(claimUID)
+}
+
 func (cp *CPUDriver) getSharedContainerUpdates(logger logr.Logger, excludeID types.UID) []*api.ContainerUpdate {
 	updates := []*api.ContainerUpdate{}
 	sharedCPUs := cp.cpuAllocationStore.GetSharedCPUs()
@@ -148,11 +301,28 @@ func (cp *CPUDriver) getSharedContainerUpdates(logger logr.Logger, excludeID typ
 	return updates
 }
 
+// guaranteedMemoryNodes returns the cpuset memory nodes of a container with the given guaranteed CPUs:
+// the NUMA nodes of the CPUs if pinning the memory nodes is enabled, globally or because a claim of the
+// container disables the automatic NUMA balancing, otherwise empty to leave them unchanged.
+// The NRI adjustments are applied to the OCI spec of the container before it is created, so the runtime
+// creates the cgroup with the final values; CDI can't set them, because its container edits don't cover the resources.
+func (cp *CPUDriver) guaranteedMemoryNodes(cpus cpuset.CPUSet, numaBalancingDisabled bool) string {
+	if !(cp.pinMemoryNodes || numaBalancingDisabled) || cp.cpuTopology == nil {
+		return ""
+	}
+	return cp.cpuTopology.CPUDetails.KeepOnly(cpus).NUMANodes().String()
+}
+
 // CreateContainer handles container creation requests from the NRI.
 func (cp *CPUDriver) CreateContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
 	_, logger := ctxlog.WithValues(ctx, "opID", generateShortID(opIDLen), "pod", ctxlog.KObj(pod), "podUID", pod.Uid, "container", ctr.Name, "containerID", ctr.Id)
+	if podUsesUserNamespace(pod, ctr) {
+		// the adjustments apply to the cgroup the runtime creates on the host, like for any other container.
+		logger = logger.WithValues("userNamespace", true)
+	}
 	logger.V(2).Info("begin: CreateContainer")
 	defer logger.V(2).Info("end: CreateContainer")
+	cp.faults.delayNRIAdjustment(ctx, logger)
 
 	adjust := &api.ContainerAdjustment{}
 	var updates []*api.ContainerUpdate
@@ -161,11 +331,22 @@ func (cp *CPUDriver) CreateContainer(ctx context.Context, pod *api.PodSandbox, c
 	if err != nil {
 		logger.Error(err, "error parsing DRA env for container")
 	}
+	envTraceIDs := parseTraceIDEnv(ctr.Env)
 
 	containerId := types.UID(ctr.GetId())
 	podUID := types.UID(pod.GetUid())
 
-	if len(claimAllocations) == 0 {
+	// In NRI-only mode, and with the pod-level pinning, claims are bound to the pod as a whole,
+	// so all the containers of the pod bound to a claim share its CPUs.
+	podAllocations := cp.podClaimAllocations(podUID, ctr.GetName())
+	claimAllocations = withPodClaimAllocations(claimAllocations, podAllocations)
+	fractionalClaims := parseFractionalCPUsEnv(logger, ctr.Env)
+
+	if len(claimAllocations) == 0 && len(fractionalClaims) > 0 {
+		if err := cp.adjustFractionalContainer(logger, pod, ctr, fractionalClaims, envTraceIDs, adjust); err != nil {
+			return nil, nil, err
+		}
+	} else if len(claimAllocations) == 0 {
 		// This is a shared container.
 		state := store.NewContainerState(ctr.GetName(), containerId)
 		cp.podConfigStore.SetContainerState(podUID, state)
@@ -177,24 +358,52 @@ func (cp *CPUDriver) CreateContainer(ctx context.Context, pod *api.PodSandbox, c
 		guaranteedCPUs := cpuset.New()
 		claimUIDs := []types.UID{}
 		for uid, cpus := range claimAllocations {
-			cLogger := logger.WithValues("claimUID", uid)
-			err := cp.claimTracker.SetOwner(cLogger, uid, types.UID(pod.Uid), ctr.Name)
-			if err != nil {
-				return nil, nil, err
+			traceID := cp.claimTraceID(envTraceIDs, uid)
+			cLogger := logger.WithValues("claimUID", uid, "traceID", traceID)
+			if _, podLevel := podAllocations[uid]; !podLevel {
+				err := cp.claimTracker.SetOwner(cLogger, uid, types.UID(pod.Uid), ctr.Name)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			if traceID != "" {
+				adjust.AddAnnotation(traceIDContainerAnnotation(uid), traceID)
 			}
+			cLogger.V(2).Info("pinning container to claim CPUs", "cpus", cpus.String())
 
 			guaranteedCPUs = guaranteedCPUs.Union(cpus)
 			claimUIDs = append(claimUIDs, uid)
 		}
 		logger.V(2).Info("guaranteed CPUs found", "cpus", guaranteedCPUs.String())
-		state := store.NewContainerState(ctr.GetName(), containerId, claimUIDs...)
-		adjust.SetLinuxCPUSetCPUs(guaranteedCPUs.String())
+		if len(fractionalClaims) > 0 {
+			// the guaranteed CPUs cover the fractions: a CPU quota would throttle them.
+			logger.V(2).Info("ignoring the fractional claims of the container with guaranteed CPUs", "claims", len(fractionalClaims))
+		}
+		state := store.NewContainerState(ctr.GetName(), containerId, claimUIDs...).SetCgroupsPath(ctr.GetLinux().GetCgroupsPath())
+		containerCPUs := guaranteedCPUs
+		if cp.containerBorrowsIdleCPUs(ctr.Env, claimUIDs) {
+			// the borrowed CPUs are given back, in PrepareResourceClaims, before an exclusive claim gets them.
+			containerCPUs = guaranteedCPUs.Union(cp.cpuAllocationStore.GetSharedCPUs())
+			cpuBorrowingEvents.WithLabelValues(borrowEventBorrow).Inc()
+			logger.V(2).Info("container borrows the idle CPUs", "cpus", containerCPUs.String())
+		}
+		adjust.SetLinuxCPUSetCPUs(containerCPUs.String())
+		if mems := cp.guaranteedMemoryNodes(guaranteedCPUs, cp.containerNUMABalancingDisabled(ctr.Env, claimUIDs)); mems != "" {
+			adjust.SetLinuxCPUSetMems(mems)
+		}
+		if cp.containerCPUQuotaDisabled(ctr.Env, claimUIDs) && disableCPUQuota(ctr, adjust) {
+			logger.V(2).Info("removed the CPU quota of the container", "quota", ctr.GetLinux().GetResources().GetCpu().GetQuota().GetValue())
+		}
 		cp.podConfigStore.SetContainerState(podUID, state)
-		// Remove the guaranteed CPUs from the containers with shared CPUs.
+		cp.reportEnforced(claimUIDs, pod.GetName(), ctr.GetName(), guaranteedCPUs)
+		// Remove the guaranteed CPUs from the containers with shared CPUs, from the ones borrowing them,
+		// and from the ones of the fractional claims.
 		updates = cp.getSharedContainerUpdates(logger, containerId)
+		updates = append(updates, cp.getBorrowerContainerUpdates(logger, containerId)...)
+		updates = append(updates, cp.getFractionalContainerUpdates(logger, containerId)...)
 	}
 
-	return adjust, updates, nil
+	return adjust, cp.containerUpdates(logger, updates), nil
 }
 
 func (cp *CPUDriver) StopContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) ([]*api.ContainerUpdate, error) {
@@ -205,6 +414,12 @@ func (cp *CPUDriver) StopContainer(ctx context.Context, pod *api.PodSandbox, ctr
 	updates := []*api.ContainerUpdate{}
 	claimUIDs := cp.podConfigStore.RemoveContainerState(types.UID(pod.GetUid()), ctr.GetName())
 	entries := "none"
+	if slices.ContainsFunc(claimUIDs, cp.isPodClaim) {
+		// In NRI-only mode, and with the pod-level pinning, claims are bound to the pod, and other containers
+		// may still run on the claim CPUs. The allocation will be released in UnprepareResourceClaims.
+		logger.V(2).Info("StopContainer skipping early claim release", "reason", "claims bound to the pod")
+		claimUIDs = slices.DeleteFunc(claimUIDs, cp.isPodClaim)
+	}
 	if len(claimUIDs) > 0 {
 		// This early release in StopContainer is a workaround for a lifecycle mismatch between DRA and NRI.
 		// The proper place to release claim allocations is in the DRA UnprepareResourceClaims hook.
@@ -218,13 +433,18 @@ func (cp *CPUDriver) StopContainer(ctx context.Context, pod *api.PodSandbox, ctr
 			cLogger := logger.WithValues("claimUID", claimUID)
 			cp.cpuAllocationStore.RemoveResourceClaimAllocation(cLogger, claimUID)
 		}
-		// Remove the guaranteed CPUs from the containers with shared CPUs.
+		cp.updateAllocationMetrics(logger)
+		cp.republishFullCores()
+		// Give the released CPUs back to the containers with shared CPUs, to the ones borrowing them,
+		// and to the ones of the fractional claims.
 		updates = cp.getSharedContainerUpdates(logger, types.UID(ctr.GetId()))
+		updates = append(updates, cp.getBorrowerContainerUpdates(logger, types.UID(ctr.GetId()))...)
+		updates = append(updates, cp.getFractionalContainerUpdates(logger, types.UID(ctr.GetId()))...)
 		cp.claimTracker.Cleanup(claimUIDs...)
 		entries = fmt.Sprintf("%d entries", len(updates))
 	}
 	logger.V(2).Info("StopContainer updates needed", "entries", entries)
-	return updates, nil
+	return cp.containerUpdates(logger, updates), nil
 }
 
 // RemoveContainer handles container removal requests from the NRI.
@@ -145,6 +145,22 @@ func TestCreateContainer(t *testing.T) {
 			},
 			expectedContainerUpdates: []*api.ContainerUpdate{},
 		},
+		{
+			name:               "guaranteed container is annotated with the claim trace ID",
+			podConfigStore:     store.NewPodConfig(),
+			cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+			claimTracker:       store.NewClaimTracker(),
+			container: func() *api.Container {
+				ctr := newTestContainer(claimUID, "0-3")
+				ctr.Env = append(ctr.Env, traceIDEnvVar(types.UID(claimUID), "0123456789abcdef"))
+				return ctr
+			}(),
+			expectedContainerAdjustment: &api.ContainerAdjustment{
+				Annotations: map[string]string{"dra.cpu/trace-id." + claimUID: "0123456789abcdef"},
+				Linux:       &api.LinuxContainerAdjustment{Resources: &api.LinuxResources{Cpu: &api.LinuxCPU{Cpus: "0-3"}}},
+			},
+			expectedContainerUpdates: []*api.ContainerUpdate{},
+		},
 		{
 			name:               "shared container triggers container adjustment with all cpus",
 			podConfigStore:     store.NewPodConfig(),
@@ -219,6 +235,117 @@ func TestCreateContainer(t *testing.T) {
 	}
 }
 
+func TestCreateContainerNRIOnly(t *testing.T) {
+	logger := testr.New(t)
+	allCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+
+	var infos []cpuinfo.CPUInfo
+	for _, cpuID := range allCPUs.UnsortedList() {
+		infos = append(infos, cpuinfo.CPUInfo{CpuID: cpuID, CoreID: cpuID, SocketID: 0, NUMANodeID: 0})
+	}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: infos}
+	topo, _ := mockProvider.GetCPUTopology(logger)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		podClaims:          store.NewPodClaims(),
+		nriOnly:            true,
+	}
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-uid-1", cpuset.New(2, 3))
+	require.NoError(t, driver.podClaims.Set("claim-uid-1", cpuset.New(2, 3), map[types.UID][]string{types.UID(pod.Uid): {"ctr-1", "ctr-2"}}))
+
+	// all the containers consuming the claim share its CPUs, there is no env to tell them apart.
+	for _, ctrName := range []string{"ctr-1", "ctr-2"} {
+		ctr := &api.Container{Id: ctrName + "-id", PodSandboxId: pod.Id, Name: ctrName}
+		adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+		require.NoError(t, err)
+		require.Equal(t, "2-3", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+	}
+
+	// the containers of the pod not consuming the claim run on the shared CPUs.
+	sidecar := &api.Container{Id: "sidecar-id", PodSandboxId: pod.Id, Name: "sidecar"}
+	adjust, _, err := driver.CreateContainer(context.Background(), pod, sidecar)
+	require.NoError(t, err)
+	require.Equal(t, "0-1,4-7", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+
+	otherPod := &api.PodSandbox{Id: "pod-id-2", Name: "other-pod", Namespace: "my-ns", Uid: "pod-uid-2"}
+	ctr := &api.Container{Id: "other-ctr-id", PodSandboxId: otherPod.Id, Name: "other-ctr"}
+	adjust, _, err = driver.CreateContainer(context.Background(), otherPod, ctr)
+	require.NoError(t, err)
+	require.Equal(t, "0-1,4-7", adjust.GetLinux().GetResources().GetCpu().GetCpus())
+
+	// the claim allocation is not released early when the container stops.
+	_, err = driver.StopContainer(context.Background(), pod, &api.Container{Id: "ctr-1-id", PodSandboxId: pod.Id, Name: "ctr-1"})
+	require.NoError(t, err)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-uid-1")
+	require.True(t, ok)
+}
+
+func TestCreateContainerPinMemoryNodes(t *testing.T) {
+	logger := testr.New(t)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		pinMemoryNodes bool
+		cpus           string
+		expectedMems   string
+	}{
+		{
+			name:           "disabled",
+			pinMemoryNodes: false,
+			cpus:           "2,6",
+			expectedMems:   "",
+		},
+		{
+			name:           "single NUMA node",
+			pinMemoryNodes: true,
+			cpus:           "2,6",
+			expectedMems:   "1",
+		},
+		{
+			name:           "spanning NUMA nodes",
+			pinMemoryNodes: true,
+			cpus:           "0,2",
+			expectedMems:   "0-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &CPUDriver{
+				podConfigStore:     store.NewPodConfig(),
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				claimTracker:       store.NewClaimTracker(),
+				cpuTopology:        topo,
+				pinMemoryNodes:     tc.pinMemoryNodes,
+			}
+			ctr := &api.Container{
+				Id:           "ctr-id-1",
+				PodSandboxId: pod.Id,
+				Name:         "my-ctr",
+				Env:          []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, tc.cpus)},
+			}
+			adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+			require.NoError(t, err)
+			require.Equal(t, tc.cpus, adjust.GetLinux().GetResources().GetCpu().GetCpus())
+			require.Equal(t, tc.expectedMems, adjust.GetLinux().GetResources().GetCpu().GetMems())
+
+			// the shared containers keep the memory nodes unchanged.
+			shared := &api.Container{Id: "ctr-id-2", PodSandboxId: pod.Id, Name: "my-shared-ctr"}
+			adjust, _, err = driver.CreateContainer(context.Background(), pod, shared)
+			require.NoError(t, err)
+			require.Empty(t, adjust.GetLinux().GetResources().GetCpu().GetMems())
+		})
+	}
+}
+
 func TestStopContainer(t *testing.T) {
 	logger := testr.New(t)
 	allCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
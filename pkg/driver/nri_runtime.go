@@ -0,0 +1,103 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NRIRuntime describes the container runtime the NRI plugin is connected to.
+type NRIRuntime struct {
+	Name    string
+	Version string
+	// ContainerUpdates is true if the runtime applies the cpuset updates the plugin requests
+	// for containers other than the one of the current event. Without them, the CPUs are
+	// pinned only when the containers are created, and the shared CPUs of the running
+	// containers are not resized when guaranteed CPUs are allocated or released.
+	ContainerUpdates bool
+}
+
+// Configure is called by the NRI when the plugin connects, and reports the runtime it is connected to.
+func (cp *CPUDriver) Configure(ctx context.Context, config, runtime, runtimeVersion string) (api.EventMask, error) {
+	_, logger := ctxlog.WithValues(ctx, "runtime", runtime, "version", runtimeVersion)
+	// the container updates are probed once the plugin is synchronized: see probeContainerUpdates.
+	cp.nriSupervisor.setRuntime(NRIRuntime{Name: runtime, Version: runtimeVersion, ContainerUpdates: true})
+	logger.Info("connected to the runtime")
+	// zero means the events of the handlers the plugin implements.
+	return 0, nil
+}
+
+// probeContainerUpdates checks if the runtime applies the container updates the plugin requests, sending again
+// the cpuset the driver assigned to a running container: the update changes nothing, but a runtime which can't
+// apply it fails. Without containers the driver knows there is nothing to probe, and the runtime is assumed to
+// support the updates. A container exiting meanwhile also fails the probe, which errs on the safe side.
+func (cp *CPUDriver) probeContainerUpdates(logger logr.Logger, pods []*api.PodSandbox, containers []*api.Container) {
+	podUIDs := make(map[string]types.UID, len(pods))
+	for _, pod := range pods {
+		podUIDs[pod.GetId()] = types.UID(pod.GetUid())
+	}
+	for _, ctr := range containers {
+		if ctr.GetState() != api.ContainerState_CONTAINER_RUNNING {
+			continue
+		}
+		cpus, ok := cp.expectedContainerCPUs(podUIDs[ctr.GetPodSandboxId()], ctr.GetName())
+		if !ok || cpus.IsEmpty() {
+			continue
+		}
+		update := &api.ContainerUpdate{ContainerId: ctr.GetId()}
+		update.SetLinuxCPUSetCPUs(cpus.String())
+		failed, err := cp.nriPlugin.UpdateContainers([]*api.ContainerUpdate{update})
+		if err == nil && len(failed) > 0 {
+			err = fmt.Errorf("the runtime failed to update the container %s", ctr.GetId())
+		}
+		if err == nil {
+			logger.V(2).Info("the runtime applies the container updates", "containerID", ctr.GetId())
+			return
+		}
+		if cp.nriSupervisor.Condition().State != NRI_STATE_CONNECTED {
+			// the connection was lost meanwhile: the probe runs again after the next synchronization.
+			return
+		}
+		runtime := cp.nriSupervisor.Runtime()
+		runtime.ContainerUpdates = false
+		cp.nriSupervisor.setRuntime(runtime)
+		cp.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "CreateTimePinningOnly", "the runtime does not support container updates: CPUs are pinned only at container creation")
+		logger.Error(err, "the runtime does not apply the container updates, CPUs are pinned only at container creation and the shared CPUs of running containers are not resized")
+		return
+	}
+	logger.V(2).Info("no running container to probe the container updates, assuming the runtime supports them")
+}
+
+// containerUpdates returns the updates the runtime can apply: none if it does not support them.
+func (cp *CPUDriver) containerUpdates(logger logr.Logger, updates []*api.ContainerUpdate) []*api.ContainerUpdate {
+	if len(updates) == 0 || cp.nriSupervisor.Runtime().ContainerUpdates {
+		return updates
+	}
+	logger.V(2).Info("runtime does not support container updates, skipping them", "entries", len(updates))
+	return nil
+}
+
+// NRIRuntime returns the container runtime the NRI plugin is connected to.
+func (cp *CPUDriver) NRIRuntime() NRIRuntime {
+	return cp.nriSupervisor.Runtime()
+}
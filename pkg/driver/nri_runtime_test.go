@@ -0,0 +1,126 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestConfigureWithoutContainerUpdates(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	nriPlugin := &fakeNRIStub{err: errors.New("container updates not supported")}
+	driver := &CPUDriver{
+		nriPlugin:          nriPlugin,
+		nriSupervisor:      newNRISupervisor(),
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	pods := []*api.PodSandbox{{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}}
+	containers := []*api.Container{{Id: "ctr-id-1", PodSandboxId: "pod-id-1", Name: "my-ctr", State: api.ContainerState_CONTAINER_RUNNING}}
+
+	events, err := driver.Configure(context.Background(), "", "containerd", "1.7.0")
+	require.NoError(t, err)
+	require.Zero(t, events)
+	require.True(t, driver.NRIRuntime().ContainerUpdates)
+	require.Equal(t, "containerd", driver.NRIRuntime().Name)
+
+	_, err = driver.Synchronize(context.Background(), pods, containers)
+	require.NoError(t, err)
+	// the probe runs in the background after the synchronization, and falls back to the pinning at creation.
+	require.Eventually(t, func() bool {
+		return driver.NRICondition().Reason == "CreateTimePinningOnly"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, NRI_STATE_CONNECTED, driver.NRICondition().State)
+	require.False(t, driver.NRIRuntime().ContainerUpdates)
+	require.Equal(t, 0.0, testutil.ToFloat64(nriContainerUpdatesSupported))
+
+	updates := []*api.ContainerUpdate{{ContainerId: "ctr-id-1"}}
+	require.Empty(t, driver.containerUpdates(logger, updates))
+
+	// a new connection probes the runtime again.
+	_, err = driver.Configure(context.Background(), "", "containerd", "1.7.0")
+	require.NoError(t, err)
+	require.True(t, driver.NRIRuntime().ContainerUpdates)
+	require.Equal(t, 1.0, testutil.ToFloat64(nriContainerUpdatesSupported))
+	require.Equal(t, updates, driver.containerUpdates(logger, updates))
+}
+
+func TestProbeContainerUpdates(t *testing.T) {
+	pods := []*api.PodSandbox{{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}}
+	running := &api.Container{Id: "ctr-id-1", PodSandboxId: "pod-id-1", Name: "my-ctr", State: api.ContainerState_CONTAINER_RUNNING}
+	stopped := &api.Container{Id: "ctr-id-2", PodSandboxId: "pod-id-1", Name: "my-other-ctr", State: api.ContainerState_CONTAINER_STOPPED}
+	testCases := []struct {
+		name             string
+		containers       []*api.Container
+		err              error
+		expectedUpdates  int
+		containerUpdates bool
+	}{
+		{name: "updates applied", containers: []*api.Container{running}, expectedUpdates: 1, containerUpdates: true},
+		{name: "updates failed", containers: []*api.Container{running}, err: errors.New("not supported"), containerUpdates: false},
+		{name: "no running container", containers: []*api.Container{stopped}, err: errors.New("not supported"), containerUpdates: true},
+		{name: "no container", err: errors.New("not supported"), containerUpdates: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+			nriPlugin := &fakeNRIStub{err: tc.err}
+			driver := &CPUDriver{
+				nriPlugin:          nriPlugin,
+				nriSupervisor:      newNRISupervisor(),
+				podConfigStore:     store.NewPodConfig(),
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				claimTracker:       store.NewClaimTracker(),
+				cpuTopology:        topo,
+			}
+			for _, ctr := range []*api.Container{running, stopped} {
+				driver.podConfigStore.SetContainerState("pod-uid-1", store.NewContainerState(ctr.Name, types.UID(ctr.Id)))
+			}
+			driver.nriSupervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+
+			driver.probeContainerUpdates(logger, pods, tc.containers)
+			require.Equal(t, tc.containerUpdates, driver.NRIRuntime().ContainerUpdates)
+			require.Len(t, nriPlugin.updates, tc.expectedUpdates)
+			if tc.expectedUpdates > 0 {
+				require.Equal(t, "0-7", nriPlugin.updates[0].GetLinux().GetResources().GetCpu().GetCpus())
+			}
+			if !tc.containerUpdates {
+				require.Equal(t, "CreateTimePinningOnly", driver.NRICondition().Reason)
+			}
+		})
+	}
+}
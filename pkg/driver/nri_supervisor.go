@@ -0,0 +1,188 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+)
+
+// NRIState is the state of the connection between the NRI plugin and the runtime.
+type NRIState string
+
+const (
+	// NRI_STATE_CONNECTED means the plugin is registered and synchronized with the runtime.
+	NRI_STATE_CONNECTED NRIState = "connected"
+	// NRI_STATE_RECONNECTING means the plugin is not connected yet, or lost the connection and is being restarted.
+	NRI_STATE_RECONNECTING NRIState = "reconnecting"
+	// NRI_STATE_FAILED means the plugin exhausted its restart attempts and will not reconnect.
+	NRI_STATE_FAILED NRIState = "failed"
+)
+
+var nriStates = []NRIState{NRI_STATE_CONNECTED, NRI_STATE_RECONNECTING, NRI_STATE_FAILED}
+
+// NRICondition describes the current state of the NRI connection and why it was entered.
+type NRICondition struct {
+	State              NRIState
+	Reason             string
+	Message            string
+	LastTransitionTime time.Time
+}
+
+type nriRunner interface {
+	Run(context.Context) error
+}
+
+// nriSupervisor runs the NRI plugin, restarting it when it fails, and tracks the
+// state of its connection. Interested subsystems can subscribe to the state changes.
+type nriSupervisor struct {
+	lock        sync.Mutex
+	condition   NRICondition
+	subscribers []chan NRICondition
+	runtime     NRIRuntime
+}
+
+func newNRISupervisor() *nriSupervisor {
+	s := &nriSupervisor{}
+	s.setRuntime(NRIRuntime{ContainerUpdates: true})
+	s.setCondition(NRI_STATE_RECONNECTING, "Starting", "waiting for the first synchronization with the runtime")
+	return s
+}
+
+// Condition returns the current condition. A nil supervisor is never connected.
+func (s *nriSupervisor) Condition() NRICondition {
+	if s == nil {
+		return NRICondition{State: NRI_STATE_RECONNECTING, Reason: "NotStarted"}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.condition
+}
+
+// Subscribe returns a channel which receives the current condition, and then a new condition
+// on each state change. The channel only buffers the latest condition, so slow subscribers
+// miss the intermediate states but always observe the last one. The channel of a nil supervisor
+// only receives its never connected condition.
+func (s *nriSupervisor) Subscribe() <-chan NRICondition {
+	ch := make(chan NRICondition, 1)
+	if s == nil {
+		ch <- s.Condition()
+		return ch
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ch <- s.condition
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// Runtime returns the runtime the plugin is connected to. Until the plugin connects,
+// and without a supervisor, the runtime is assumed to support the container updates.
+func (s *nriSupervisor) Runtime() NRIRuntime {
+	if s == nil {
+		return NRIRuntime{ContainerUpdates: true}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.runtime
+}
+
+func (s *nriSupervisor) setRuntime(runtime NRIRuntime) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.runtime = runtime
+	value := 0.0
+	if runtime.ContainerUpdates {
+		value = 1
+	}
+	nriContainerUpdatesSupported.Set(value)
+}
+
+// setCondition records the new condition. The transition time and the subscribers
+// notification happen only when the state actually changes.
+func (s *nriSupervisor) setCondition(state NRIState, reason, message string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.condition.State == state {
+		s.condition.Reason = reason
+		s.condition.Message = message
+		return
+	}
+	s.condition = NRICondition{
+		State:              state,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: time.Now(),
+	}
+	for _, st := range nriStates {
+		value := 0.0
+		if st == state {
+			value = 1
+		}
+		nriConnectionState.WithLabelValues(string(st)).Set(value)
+	}
+	for _, ch := range s.subscribers {
+		// we are the only sender and we hold the lock, so after draining there is room for the update.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s.condition
+	}
+}
+
+// run runs the plugin until the context is cancelled, restarting it up to maxAttempts times.
+func (s *nriSupervisor) run(ctx context.Context, plugin nriRunner, maxAttempts int) error {
+	logger := ctxlog.FromContext(ctx)
+	for i := 0; i < maxAttempts; i++ {
+		err := plugin.Run(ctx)
+		if ctx.Err() != nil {
+			logger.Info("NRI plugin stopped", "reason", "context cancelled")
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Error(err, "NRI plugin failed, restarting", "attempt", i+1, "maxAttempts", maxAttempts)
+			s.setCondition(NRI_STATE_RECONNECTING, "PluginFailed", err.Error())
+		} else {
+			s.setCondition(NRI_STATE_RECONNECTING, "ConnectionClosed", "the runtime closed the connection")
+		}
+	}
+	err := fmt.Errorf("NRI plugin failed for %d times to be restarted", maxAttempts)
+	s.setCondition(NRI_STATE_FAILED, "RestartsExhausted", err.Error())
+	return err
+}
+
+// NRICondition returns the current condition of the NRI connection.
+func (cp *CPUDriver) NRICondition() NRICondition {
+	return cp.nriSupervisor.Condition()
+}
+
+// SubscribeNRICondition returns a channel notified when the NRI connection changes state.
+// Subsystems which depend on the runtime should pause their work while not connected.
+func (cp *CPUDriver) SubscribeNRICondition() <-chan NRICondition {
+	return cp.nriSupervisor.Subscribe()
+}
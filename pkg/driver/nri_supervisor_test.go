@@ -0,0 +1,147 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type mockNRIRunner struct {
+	runFunc func(ctx context.Context) error
+	calls   atomic.Int32
+}
+
+func (m *mockNRIRunner) Run(ctx context.Context) error {
+	m.calls.Add(1)
+	return m.runFunc(ctx)
+}
+
+func TestNRISupervisorRun_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runner := &mockNRIRunner{
+		runFunc: func(ctx context.Context) error {
+			cancel()
+			return context.Canceled
+		},
+	}
+
+	err := newNRISupervisor().run(ctx, runner, maxAttempts)
+	require.ErrorIs(t, err, context.Canceled, "should return context.Canceled when context is cancelled")
+	require.Equal(t, int32(1), runner.calls.Load(), "Run should be called exactly once before context cancel")
+}
+
+func TestNRISupervisorRun_ContextCancelledAfterSeveralRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls atomic.Int32
+	runner := &mockNRIRunner{
+		runFunc: func(ctx context.Context) error {
+			n := calls.Add(1)
+			if n >= 3 {
+				cancel()
+				return context.Canceled
+			}
+			return fmt.Errorf("transient error")
+		},
+	}
+
+	err := newNRISupervisor().run(ctx, runner, maxAttempts)
+	require.ErrorIs(t, err, context.Canceled, "should return context.Canceled when context is cancelled")
+	require.Equal(t, int32(3), calls.Load(), "Run should be called 3 times before context cancel")
+}
+
+func TestNRISupervisorRun_ExhaustsAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	runner := &mockNRIRunner{
+		runFunc: func(ctx context.Context) error {
+			return fmt.Errorf("persistent error")
+		},
+	}
+
+	err := newNRISupervisor().run(ctx, runner, 3)
+	require.Error(t, err, "should return error after exhausting attempts")
+	require.Equal(t, int32(3), runner.calls.Load(), "Run should be called exactly maxAttempts times")
+}
+
+func TestNRISupervisorRun_SuccessfulRunNoRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &mockNRIRunner{
+		runFunc: func(ctx context.Context) error {
+			cancel()
+			return nil
+		},
+	}
+
+	err := newNRISupervisor().run(ctx, runner, maxAttempts)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int32(1), runner.calls.Load())
+}
+
+func TestNRISupervisorNil(t *testing.T) {
+	var supervisor *nriSupervisor
+	require.Equal(t, NRI_STATE_RECONNECTING, supervisor.Condition().State)
+	require.Equal(t, NRI_STATE_RECONNECTING, (<-supervisor.Subscribe()).State)
+	require.True(t, supervisor.Runtime().ContainerUpdates)
+}
+
+func TestNRISupervisorStateTransitions(t *testing.T) {
+	supervisor := newNRISupervisor()
+	require.Equal(t, NRI_STATE_RECONNECTING, supervisor.Condition().State)
+
+	updates := supervisor.Subscribe()
+	require.Equal(t, NRI_STATE_RECONNECTING, (<-updates).State)
+
+	supervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+	cond := <-updates
+	require.Equal(t, NRI_STATE_CONNECTED, cond.State)
+	require.Equal(t, "Synchronized", cond.Reason)
+	require.Equal(t, 1.0, testutil.ToFloat64(nriConnectionState.WithLabelValues(string(NRI_STATE_CONNECTED))))
+	require.Equal(t, 0.0, testutil.ToFloat64(nriConnectionState.WithLabelValues(string(NRI_STATE_RECONNECTING))))
+
+	// same state: no notification and no transition
+	supervisor.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized again")
+	require.Len(t, updates, 0)
+	require.Equal(t, cond.LastTransitionTime, supervisor.Condition().LastTransitionTime)
+	require.Equal(t, "synchronized again", supervisor.Condition().Message)
+
+	runner := &mockNRIRunner{
+		runFunc: func(ctx context.Context) error {
+			return fmt.Errorf("persistent error")
+		},
+	}
+	require.Error(t, supervisor.run(context.Background(), runner, 2))
+	// slow subscribers observe only the latest state
+	cond = <-updates
+	require.Equal(t, NRI_STATE_FAILED, cond.State)
+	require.Equal(t, "RestartsExhausted", cond.Reason)
+	require.Equal(t, 1.0, testutil.ToFloat64(nriConnectionState.WithLabelValues(string(NRI_STATE_FAILED))))
+}
+
+func TestNRIConditionWithoutSupervisor(t *testing.T) {
+	driver := &CPUDriver{}
+	require.Equal(t, NRI_STATE_RECONNECTING, driver.NRICondition().State)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// numaBalancingDisabledEnvVarPrefix is the prefix of the container environment variable marking the claims
+// whose containers have their memory confined to the NUMA nodes of their CPUs. Like the trace ID, it survives
+// the driver restarts.
+const numaBalancingDisabledEnvVarPrefix = "DRA_CPU_NUMA_BALANCING_DISABLED"
+
+// numaBalancingDisabledEnvVar returns the environment variable marking the containers of a claim to have their
+// memory confined to the NUMA nodes of their CPUs.
+func numaBalancingDisabledEnvVar(claimUID types.UID) string {
+	return fmt.Sprintf("%s_%s=true", numaBalancingDisabledEnvVarPrefix, claimUID)
+}
+
+// parseNUMABalancingDisabledEnv returns the claims whose containers have their memory confined to the NUMA nodes
+// of their CPUs, from the container environment.
+func parseNUMABalancingDisabledEnv(envs []string) sets.Set[types.UID] {
+	return parseClaimFlagEnv(envs, numaBalancingDisabledEnvVarPrefix)
+}
+
+// claimDisablesNUMABalancing returns true if any request of the claim allocated by the driver disables the
+// automatic NUMA balancing.
+func (cp *CPUDriver) claimDisablesNUMABalancing(claim *resourceapi.ResourceClaim) (bool, error) {
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.DisableNUMABalancing })
+}
+
+// containerNUMABalancingDisabled returns true if any of the claims of a container disables the automatic NUMA
+// balancing, preferring what is found in the container environment.
+//
+// The kernel has no per-task switch for the automatic NUMA balancing, and kernel.numa_balancing is node-wide:
+// the driver confines the memory of the container to the NUMA nodes of its CPUs instead, so the balancing finds
+// no remote node to migrate the pages to. The setting goes away with the container, restoring the defaults.
+func (cp *CPUDriver) containerNUMABalancingDisabled(envs []string, claimUIDs []types.UID) bool {
+	envClaimUIDs := parseNUMABalancingDisabledEnv(envs)
+	for _, claimUID := range claimUIDs {
+		if envClaimUIDs.Has(claimUID) || cp.cpuAllocationStore.IsResourceClaimNUMABalancingDisabled(claimUID) {
+			return true
+		}
+	}
+	return false
+}
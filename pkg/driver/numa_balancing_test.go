@@ -0,0 +1,160 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestParseNUMABalancingDisabledEnv(t *testing.T) {
+	claimUIDs := parseNUMABalancingDisabledEnv([]string{
+		numaBalancingDisabledEnvVar("claim-A"),
+		cpuQuotaDisabledEnvVar("claim-B"),
+		"DRA_CPU_NUMA_BALANCING_DISABLED_claim-C=false",
+		fmt.Sprintf("%s_claim-D=%s", cdiEnvVarPrefix, "0-1"),
+	})
+	require.ElementsMatch(t, []types.UID{"claim-A"}, claimUIDs.UnsortedList())
+}
+
+func TestPrepareResourceClaimsDisableNUMABalancing(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             cdiMgr,
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	pinnedUID := types.UID("claim-no-numa-balancing")
+	defaultUID := types.UID("claim-default")
+	claims := []*resourceapi.ResourceClaim{
+		testClaimAllCPUs(testClaim(pinnedUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}), `{"disableNUMABalancing": true}`),
+		testClaim(defaultUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}),
+	}
+	prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+	require.NoError(t, prepared[pinnedUID].Err)
+	require.NoError(t, prepared[defaultUID].Err)
+
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimNUMABalancingDisabled(pinnedUID))
+	require.Contains(t, cdiMgr.specs[getCDIDeviceName(pinnedUID)].ContainerEdits.Env, numaBalancingDisabledEnvVar(pinnedUID))
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimNUMABalancingDisabled(defaultUID))
+	require.NotContains(t, cdiMgr.specs[getCDIDeviceName(defaultUID)].ContainerEdits.Env, numaBalancingDisabledEnvVar(defaultUID))
+}
+
+func TestCreateContainerDisableNUMABalancing(t *testing.T) {
+	logger := testr.New(t)
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		env          []string
+		expectedMems string
+	}{
+		{
+			name: "memory nodes kept by default",
+			env:  []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "2,6")},
+		},
+		{
+			name:         "single NUMA node",
+			env:          []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "2,6"), numaBalancingDisabledEnvVar("claim-uid-1")},
+			expectedMems: "1",
+		},
+		{
+			name:         "spanning NUMA nodes",
+			env:          []string{fmt.Sprintf("%s_claim-uid-1=%s", cdiEnvVarPrefix, "0,2"), numaBalancingDisabledEnvVar("claim-uid-1")},
+			expectedMems: "0-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &CPUDriver{
+				podConfigStore:     store.NewPodConfig(),
+				cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+				claimTracker:       store.NewClaimTracker(),
+				cpuTopology:        topo,
+			}
+			ctr := &api.Container{Id: "ctr-id-1", PodSandboxId: pod.Id, Name: "my-ctr", Env: tc.env}
+			adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedMems, adjust.GetLinux().GetResources().GetCpu().GetMems())
+		})
+	}
+}
+
+func TestSynchronizeNUMABalancing(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		podConfigStore:     store.NewPodConfig(),
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		claimTracker:       store.NewClaimTracker(),
+		cpuTopology:        topo,
+	}
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	containers := []*api.Container{
+		{
+			Id: "pinned", PodSandboxId: pod.Id, Name: "pinned",
+			Env: []string{fmt.Sprintf("%s_claim-A=%s", cdiEnvVarPrefix, "2,6"), numaBalancingDisabledEnvVar("claim-A")},
+		},
+		{
+			Id: "default", PodSandboxId: pod.Id, Name: "default",
+			Env: []string{fmt.Sprintf("%s_claim-B=%s", cdiEnvVarPrefix, "0,4")},
+		},
+	}
+
+	updates, err := driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, containers)
+	require.NoError(t, err)
+	require.True(t, driver.cpuAllocationStore.IsResourceClaimNUMABalancingDisabled("claim-A"))
+	require.False(t, driver.cpuAllocationStore.IsResourceClaimNUMABalancingDisabled("claim-B"))
+
+	mems := make(map[string]string)
+	for _, update := range updates {
+		mems[update.ContainerId] = update.GetLinux().GetResources().GetCpu().GetMems()
+	}
+	require.Equal(t, "1", mems["pinned"])
+	require.Empty(t, mems["default"])
+}
@@ -0,0 +1,108 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+)
+
+const (
+	// NUMA_DEVICE_NAMING_KERNEL names the NUMA node devices after the NUMA node IDs of the kernel, e.g. cpudevnuma001.
+	NUMA_DEVICE_NAMING_KERNEL = "kernel"
+	// NUMA_DEVICE_NAMING_PHYSICAL names the NUMA node devices after the physical characteristics of the NUMA
+	// nodes, e.g. cpudevnuma-5c1d0e7a, so the names survive a renumbering of the NUMA nodes.
+	NUMA_DEVICE_NAMING_PHYSICAL = "physical"
+)
+
+// gib rounds the memory of the NUMA nodes in their physical identity, so the memory the kernel and the
+// firmware reserve, which changes with their versions, doesn't change the identity.
+const gib = 1 << 30
+
+// numaNodeIdentity is what identifies a NUMA node across the renumberings: its socket, its dies, and its memory.
+// The dies are a cpuset-formatted list.
+type numaNodeIdentity struct {
+	socketID int
+	dies     string
+	memGiB   int64
+}
+
+// physicalNUMADeviceNames returns the names of the NUMA node devices derived from the physical identity
+// of the NUMA nodes, by NUMA node ID. The NUMA nodes with the same identity, e.g. the sub-NUMA clusters
+// of a die with the same memory, are told apart by their order.
+func physicalNUMADeviceNames(topo *cpuinfo.CPUTopology, memTotal map[int]int64) map[int]string {
+	names := make(map[int]string)
+	ordinals := make(map[numaNodeIdentity]int)
+	for _, numaNodeID := range topo.CPUDetails.NUMANodes().List() {
+		// all the CPUs of a NUMA node belong to the same socket.
+		details := topo.CPUDetails.KeepOnly(topo.CPUDetails.CPUsInNUMANodes(numaNodeID))
+		socketID := details.Sockets().List()[0]
+		identity := numaNodeIdentity{
+			socketID: socketID,
+			dies:     details.DiesInSockets(socketID).String(),
+			memGiB:   (memTotal[numaNodeID] + gib/2) / gib,
+		}
+		ordinal := ordinals[identity]
+		ordinals[identity]++
+		hash := fnv.New32a()
+		fmt.Fprintf(hash, "socket=%d,dies=%s,memGiB=%d,ordinal=%d", identity.socketID, identity.dies, identity.memGiB, ordinal)
+		names[numaNodeID] = fmt.Sprintf("%s-%08x", cpuDeviceNUMAGroupedPrefix, hash.Sum32())
+	}
+	return names
+}
+
+// resolveNUMADeviceNames reads the memory of the NUMA nodes from sysfs and names their devices after their
+// physical identity, if so configured. The kernel names are kept otherwise.
+func (cp *CPUDriver) resolveNUMADeviceNames(logger logr.Logger, config *Config, sysfs fs.FS) error {
+	if config.NUMADeviceNaming != NUMA_DEVICE_NAMING_PHYSICAL {
+		return nil
+	}
+	memTotal := make(map[int]int64)
+	for _, numaNodeID := range cp.cpuTopology.CPUDetails.NUMANodes().List() {
+		mem, err := cpuinfo.NUMANodeMemTotal(sysfs, numaNodeID)
+		if err != nil {
+			return fmt.Errorf("failed to read the memory of NUMA node %d for its device name: %w", numaNodeID, err)
+		}
+		memTotal[numaNodeID] = mem
+	}
+	cp.numaDeviceNames = physicalNUMADeviceNames(cp.cpuTopology, memTotal)
+	logger.Info("NUMA node devices named after their physical identity", "names", cp.numaDeviceNames)
+	return nil
+}
+
+// numaDeviceName returns the name of the device of the NUMA node.
+func (cp *CPUDriver) numaDeviceName(numaNodeID int) string {
+	if name, ok := cp.numaDeviceNames[numaNodeID]; ok {
+		return name
+	}
+	return fmt.Sprintf("%s%03d", cpuDeviceNUMAGroupedPrefix, numaNodeID)
+}
+
+// isPhysicalNUMADeviceName returns true if the name is the physical name of a NUMA node device: these
+// names never had a legacy form.
+func (cp *CPUDriver) isPhysicalNUMADeviceName(name string) bool {
+	for _, physicalName := range cp.numaDeviceNames {
+		if name == physicalName {
+			return true
+		}
+	}
+	return false
+}
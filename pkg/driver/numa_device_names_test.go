@@ -0,0 +1,94 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+)
+
+func numaMemInfoFS(memKiB map[int]int64) fstest.MapFS {
+	sysfs := fstest.MapFS{}
+	for numaNodeID, kiB := range memKiB {
+		sysfs[fmt.Sprintf("devices/system/node/node%d/meminfo", numaNodeID)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("Node %d MemTotal:       %d kB\n", numaNodeID, kiB)),
+		}
+	}
+	return sysfs
+}
+
+func testTopology(t *testing.T, cpuInfos []cpuinfo.CPUInfo) *cpuinfo.CPUTopology {
+	t.Helper()
+	topo, err := (&cpuinfo.MockCPUInfoProvider{CPUInfos: cpuInfos}).GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+	return topo
+}
+
+func TestPhysicalNUMADeviceNamesSurviveRenumbering(t *testing.T) {
+	topo := testTopology(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	names := physicalNUMADeviceNames(topo, map[int]int64{0: 64 * gib, 1: 32 * gib})
+	require.Len(t, names, 2)
+	require.NotEqual(t, names[0], names[1])
+	require.Regexp(t, `^cpudevnuma-[0-9a-f]{8}$`, names[0])
+
+	// the same hardware with the NUMA node IDs swapped, and a few MiB less reserved by the new firmware.
+	var renumbered []cpuinfo.CPUInfo
+	for _, info := range mockCPUInfos_DualSocket_4CPUsPerSocket_HT {
+		info.NUMANodeID = 1 - info.NUMANodeID
+		renumbered = append(renumbered, info)
+	}
+	renumberedNames := physicalNUMADeviceNames(testTopology(t, renumbered), map[int]int64{0: 32*gib - 40<<20, 1: 64*gib - 40<<20})
+	require.Equal(t, names[0], renumberedNames[1])
+	require.Equal(t, names[1], renumberedNames[0])
+}
+
+func TestPhysicalNUMADeviceNamesIdenticalNodes(t *testing.T) {
+	// a socket split in two sub-NUMA clusters of the same die, with the same memory.
+	var infos []cpuinfo.CPUInfo
+	for cpuID := 0; cpuID < 4; cpuID++ {
+		infos = append(infos, cpuinfo.CPUInfo{CpuID: cpuID, CoreID: cpuID, NUMANodeID: cpuID / 2, SiblingCPUID: -1})
+	}
+	names := physicalNUMADeviceNames(testTopology(t, infos), map[int]int64{0: 16 * gib, 1: 16 * gib})
+	require.Len(t, names, 2)
+	require.NotEqual(t, names[0], names[1])
+}
+
+func TestPhysicalNUMADeviceNaming(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		sysfs := numaMemInfoFS(map[int]int64{0: 64 << 20, 1: 64 << 20})
+		require.NoError(t, driver.resolveNUMADeviceNames(testr.New(t), &Config{NUMADeviceNaming: NUMA_DEVICE_NAMING_PHYSICAL}, sysfs))
+	})
+	for _, device := range driver.groupedCPUDeviceInfos() {
+		require.Equal(t, driver.numaDeviceNames[device.numaNodeID], device.name)
+		require.True(t, driver.isPhysicalNUMADeviceName(device.name))
+		require.Equal(t, device.numaNodeID, driver.deviceNameToNUMANodeID[device.name])
+	}
+	// the kernel names are not published, and are not translated either.
+	_, ok := driver.deviceNameToNUMANodeID["cpudevnuma000"]
+	require.False(t, ok)
+
+	kernel := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		require.NoError(t, driver.resolveNUMADeviceNames(testr.New(t), &Config{NUMADeviceNaming: NUMA_DEVICE_NAMING_KERNEL}, fstest.MapFS{}))
+	})
+	require.Equal(t, "cpudevnuma001", kernel.numaDeviceName(1))
+	require.False(t, kernel.isPhysicalNUMADeviceName("cpudevnuma001"))
+}
@@ -0,0 +1,66 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// readNUMADistances reads the distances between the NUMA nodes. The devices report no distance if they can't
+// be read.
+func (cp *CPUDriver) readNUMADistances(logger logr.Logger, sysfs fs.FS) {
+	distances, err := cpuinfo.NUMADistances(sysfs)
+	if err != nil {
+		logger.Error(err, "failed to read the distances between the NUMA nodes, the devices report no distance")
+		return
+	}
+	cp.numaDistances = distances
+}
+
+// setNUMADistanceAttributes reports the distances from the NUMA node of a device to the nearest and the farthest
+// other NUMA nodes. The devices spanning several NUMA nodes, and the nodes with a single NUMA node, report none.
+func (cp *CPUDriver) setNUMADistanceAttributes(attrs map[resourceapi.QualifiedName]resourceapi.DeviceAttribute, cpus cpuset.CPUSet) {
+	if len(cp.numaDistances) == 0 || cp.cpuTopology == nil {
+		return
+	}
+	numaNodes := cp.cpuTopology.CPUDetails.KeepOnly(cpus).NUMANodes()
+	if numaNodes.Size() != 1 {
+		return
+	}
+	numaNodeID := numaNodes.List()[0]
+	nearest, farthest := -1, -1
+	for otherID, distance := range cp.numaDistances[numaNodeID] {
+		if otherID == numaNodeID {
+			continue
+		}
+		if nearest < 0 || distance < nearest {
+			nearest = distance
+		}
+		farthest = max(farthest, distance)
+	}
+	if nearest < 0 {
+		return
+	}
+	attrs[AttributeNUMANearestRemoteDistance] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(nearest))}
+	attrs[AttributeNUMAFarthestRemoteDistance] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(farthest))}
+}
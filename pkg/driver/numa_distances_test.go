@@ -0,0 +1,66 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNUMADistanceAttributes(t *testing.T) {
+	logger := testr.New(t)
+	nodeDir := filepath.Join("devices", "system", "node")
+	sysfs := fstest.MapFS{
+		filepath.Join(nodeDir, "online"):            &fstest.MapFile{Data: []byte("0-2\n")},
+		filepath.Join(nodeDir, "node0", "distance"): &fstest.MapFile{Data: []byte("10 21 32\n")},
+		filepath.Join(nodeDir, "node1", "distance"): &fstest.MapFile{Data: []byte("21 10 21\n")},
+		filepath.Join(nodeDir, "node2", "distance"): &fstest.MapFile{Data: []byte("32 21 10\n")},
+	}
+
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	driver.readNUMADistances(logger, sysfs)
+	for _, chunk := range driver.createCPUDeviceChunks() {
+		for _, dev := range chunk.devices {
+			farthest := int64(32)
+			if *dev.Attributes[AttributeNUMANodeID].IntValue == 1 {
+				farthest = 21
+			}
+			require.Equal(t, int64(21), *dev.Attributes[AttributeNUMANearestRemoteDistance].IntValue, dev.Name)
+			require.Equal(t, farthest, *dev.Attributes[AttributeNUMAFarthestRemoteDistance].IntValue, dev.Name)
+		}
+	}
+
+	driver.cpuDeviceMode = CPU_DEVICE_MODE_GROUPED
+	driver.initializeDeviceLookupMaps()
+	attrs := driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes
+	require.Equal(t, int64(21), *attrs[AttributeNUMANearestRemoteDistance].IntValue)
+	require.Equal(t, int64(32), *attrs[AttributeNUMAFarthestRemoteDistance].IntValue)
+
+	// a single NUMA node has no remote distance.
+	driver = newTestDriver(t, mockCPUInfos_SingleSocket_4CPUS_HT)
+	driver.readNUMADistances(logger, fstest.MapFS{
+		filepath.Join(nodeDir, "online"):            &fstest.MapFile{Data: []byte("0\n")},
+		filepath.Join(nodeDir, "node0", "distance"): &fstest.MapFile{Data: []byte("10\n")},
+	})
+	require.NotContains(t, driver.createGroupedCPUDeviceChunks(logger)[0].devices[0].Attributes, AttributeNUMANearestRemoteDistance)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/utils/cpuset"
+)
+
+// validateNUMANodeConfig returns an error if the NUMA nodes of the opaque configuration of a request are invalid.
+func validateNUMANodeConfig(request string, config DeviceConfig) error {
+	if config.RequiredNUMANode != nil && *config.RequiredNUMANode < 0 {
+		return fmt.Errorf("invalid requiredNUMANode %d for request %q", *config.RequiredNUMANode, request)
+	}
+	if config.PreferredNUMANode != nil && *config.PreferredNUMANode < 0 {
+		return fmt.Errorf("invalid preferredNUMANode %d for request %q", *config.PreferredNUMANode, request)
+	}
+	return nil
+}
+
+// checkRequiredNUMANode returns an error if the given CPUs, all the allocatable CPUs of a fully consumed device,
+// are not all in the NUMA node the opaque configuration of the request requires.
+func (cp *CPUDriver) checkRequiredNUMANode(deviceName string, config DeviceConfig, cpus cpuset.CPUSet) error {
+	if config.RequiredNUMANode == nil {
+		return nil
+	}
+	numaCPUs := cp.cpuTopology.CPUDetails.CPUsInNUMANodes(*config.RequiredNUMANode)
+	if !cpus.IsSubsetOf(numaCPUs) {
+		return fmt.Errorf("all CPUs of device %s requested, but CPUs %s are not in the required NUMA node %d", deviceName, cpus.Difference(numaCPUs).String(), *config.RequiredNUMANode)
+	}
+	return nil
+}
+
+// filterByNUMANode returns the available CPUs of a request consuming a part of a device, restricted to the NUMA
+// node its opaque configuration requires or prefers. The required NUMA node must have numCPUs available CPUs,
+// while the preferred one is used only when it has enough of them: otherwise all the available CPUs are.
+func (cp *CPUDriver) filterByNUMANode(logger logr.Logger, deviceName string, config DeviceConfig, availableCPUs cpuset.CPUSet, numCPUs int) (cpuset.CPUSet, error) {
+	details := cp.cpuTopology.CPUDetails
+	if config.RequiredNUMANode != nil {
+		required := availableCPUs.Intersection(details.CPUsInNUMANodes(*config.RequiredNUMANode))
+		if required.Size() < numCPUs {
+			return cpuset.New(), fmt.Errorf("not enough CPUs of device %s available in the required NUMA node %d: requested=%d, available=%d", deviceName, *config.RequiredNUMANode, numCPUs, required.Size())
+		}
+		return required, nil
+	}
+	if config.PreferredNUMANode != nil {
+		preferred := availableCPUs.Intersection(details.CPUsInNUMANodes(*config.PreferredNUMANode))
+		if preferred.Size() < numCPUs {
+			logger.V(2).Info("not enough CPUs available in the preferred NUMA node", "device", deviceName, "numaNode", *config.PreferredNUMANode, "numCPUs", numCPUs, "preferredCPUs", preferred.String())
+			return availableCPUs, nil
+		}
+		return preferred, nil
+	}
+	return availableCPUs, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPrepareResourceClaimsNUMANodePreference(t *testing.T) {
+	claimUID := types.UID("claim-numa")
+
+	// socket 0 spans NUMA node 0 (CPUs 0-1) and NUMA node 1 (CPUs 2-3).
+	testCases := []struct {
+		name        string
+		parameters  string
+		numCPUs     int64
+		expectedCPU string
+		expectedErr string
+	}{
+		{
+			name:        "no preference",
+			parameters:  `{}`,
+			numCPUs:     2,
+			expectedCPU: "0-1",
+		},
+		{
+			name:        "preferred NUMA node",
+			parameters:  `{"preferredNUMANode": 1}`,
+			numCPUs:     2,
+			expectedCPU: "2-3",
+		},
+		{
+			// the preferred NUMA node has too few CPUs, any NUMA node of the device is used.
+			name:        "preferred NUMA node too small",
+			parameters:  `{"preferredNUMANode": 1}`,
+			numCPUs:     3,
+			expectedCPU: "0-2",
+		},
+		{
+			name:        "required NUMA node",
+			parameters:  `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "placement": {"requiredNUMANode": 1}}`,
+			numCPUs:     1,
+			expectedCPU: "2",
+		},
+		{
+			name:        "required NUMA node too small",
+			parameters:  `{"requiredNUMANode": 1}`,
+			numCPUs:     3,
+			expectedErr: "not enough CPUs of device cpudevsocket000 available in the required NUMA node 1",
+		},
+		{
+			name:        "required NUMA node of another socket",
+			parameters:  `{"requiredNUMANode": 2}`,
+			numCPUs:     1,
+			expectedErr: "required NUMA node 2",
+		},
+		{
+			name:        "required NUMA node of a fully consumed device",
+			parameters:  `{"requiredNUMANode": 1}`,
+			numCPUs:     4,
+			expectedErr: "CPUs 0-1 are not in the required NUMA node 1",
+		},
+		{
+			name:        "negative NUMA node",
+			parameters:  `{"preferredNUMANode": -1}`,
+			numCPUs:     1,
+			expectedErr: "invalid preferredNUMANode -1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_2NUMANodesPerSocket, func(cp *CPUDriver) {
+				cp.cpuDeviceGroupBy = GROUP_BY_SOCKET
+			})
+			claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevsocket000": tc.numCPUs}), tc.parameters)
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, prepared[claimUID].Err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPU, gotCPUs.String())
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	peakUsagePeriodDay  = "day"
+	peakUsagePeriodWeek = "week"
+)
+
+// peakUsageInterval is how often the usage is observed and the history persisted, besides the
+// observations on each change of the allocations: the steady allocations are recorded in each
+// new day and week too.
+const peakUsageInterval = time.Minute
+
+// exclusiveCPUsByNUMANode returns how many CPUs are allocated to claims on each NUMA node.
+func (cp *CPUDriver) exclusiveCPUsByNUMANode() map[int]int {
+	allocated := cpuset.New()
+	for _, cpus := range cp.cpuAllocationStore.GetResourceClaimAllocations() {
+		allocated = allocated.Union(cpus)
+	}
+	usage := make(map[int]int)
+	for _, numaNodeID := range cp.cpuTopology.CPUDetails.NUMANodes().UnsortedList() {
+		usage[numaNodeID] = cp.cpuTopology.CPUDetails.CPUsInNUMANodes(numaNodeID).Intersection(allocated).Size()
+	}
+	return usage
+}
+
+// updatePeakUsage records the current exclusive CPU usage in the peak usage history, in memory:
+// it runs on the allocation path, so the history is persisted by runPeakUsageRecorder.
+func (cp *CPUDriver) updatePeakUsage(logger logr.Logger) {
+	if cp.peakUsage == nil || cp.cpuTopology == nil || cp.cpuAllocationStore == nil {
+		return
+	}
+	cp.peakUsage.Observe(cp.exclusiveCPUsByNUMANode())
+	daily, weekly := cp.peakUsage.Current()
+	for numaNodeID, cpus := range daily {
+		numaNodePeakExclusiveCPUs.WithLabelValues(strconv.Itoa(numaNodeID), peakUsagePeriodDay).Set(float64(cpus))
+	}
+	for numaNodeID, cpus := range weekly {
+		numaNodePeakExclusiveCPUs.WithLabelValues(strconv.Itoa(numaNodeID), peakUsagePeriodWeek).Set(float64(cpus))
+	}
+}
+
+// runPeakUsageRecorder observes the usage and persists the history periodically, until the context is cancelled.
+// The history is persisted one last time on the way out.
+func (cp *CPUDriver) runPeakUsageRecorder(ctx context.Context, interval time.Duration) {
+	logger := ctxlog.FromContext(ctx).WithName("peakusage")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := cp.peakUsage.Persist(); err != nil {
+				logger.Error(err, "failed to persist the peak CPU usage")
+			}
+			return
+		case <-ticker.C:
+		}
+		cp.updatePeakUsage(logger)
+		if err := cp.peakUsage.Persist(); err != nil {
+			// the peaks are still tracked in memory, and persisted on the next tick.
+			logger.Error(err, "failed to persist the peak CPU usage")
+		}
+	}
+}
+
+// peakUsageHistory returns the recorded peak usage history, empty if not tracked.
+func (cp *CPUDriver) peakUsageHistory() store.PeakUsageHistory {
+	if cp.peakUsage == nil {
+		return store.PeakUsageHistory{Daily: map[string]map[int]int{}, Weekly: map[string]map[int]int{}}
+	}
+	return cp.peakUsage.History()
+}
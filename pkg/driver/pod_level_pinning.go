@@ -0,0 +1,68 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// claimUsesPodLevelPinning returns true if all the containers of the pods the claim is reserved for are
+// pinned to its CPUs, and not only the containers consuming it: either the namespace of the claim is
+// allowed by --pod-level-pinning-namespaces, or its opaque configuration enables podLevelPinning.
+func (cp *CPUDriver) claimUsesPodLevelPinning(claim *resourceapi.ResourceClaim) (bool, error) {
+	if cp.podLevelPinningNamespaces.Has(claim.Namespace) {
+		return true, nil
+	}
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.PodLevelPinning })
+}
+
+// claimPodContainers returns the names of all the containers of the pods the claim is reserved for,
+// by pod UID. As for the consumers in NRI-only mode, a pod which can't be read fails the Prepare.
+func (cp *CPUDriver) claimPodContainers(ctx context.Context, claim *resourceapi.ResourceClaim) (map[types.UID][]string, error) {
+	containersByPodUID := make(map[types.UID][]string)
+	ctx, cancel := context.WithTimeout(ctx, podReadTimeout)
+	defer cancel()
+	for _, consumer := range claim.Status.ReservedFor {
+		if consumer.Resource != "pods" {
+			continue
+		}
+		if cp.kubeClient == nil {
+			return nil, fmt.Errorf("cannot read pod %s/%s: no API client", claim.Namespace, consumer.Name)
+		}
+		pod, err := cp.getConsumerPod(ctx, claim.Namespace, consumer)
+		if err != nil {
+			return nil, err
+		}
+		containersByPodUID[consumer.UID] = podContainerNames(pod)
+	}
+	return containersByPodUID, nil
+}
+
+// podContainerNames returns the names of the init and of the regular containers of the pod.
+func podContainerNames(pod *corev1.Pod) []string {
+	var containers []string
+	for _, ctr := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+		containers = append(containers, ctr.Name)
+	}
+	return containers
+}
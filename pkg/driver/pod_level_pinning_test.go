@@ -0,0 +1,148 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+func TestPodLevelPinning(t *testing.T) {
+	claimUID := types.UID("claim-pod-level")
+	podUID := types.UID("pod-level")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-pod", Namespace: "default", UID: podUID},
+		Spec: corev1.PodSpec{
+			ResourceClaims: []corev1.PodResourceClaim{{Name: "cpus", ResourceClaimName: ptr.To(string(claimUID))}},
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers: []corev1.Container{
+				{Name: "app", Resources: corev1.ResourceRequirements{Claims: []corev1.ResourceClaim{{Name: "cpus"}}}},
+				{Name: "sidecar"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		namespaces []string
+		parameters string
+		podLevel   bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:       "enabled by the device configuration",
+			parameters: `{"podLevelPinning": true}`,
+			podLevel:   true,
+		},
+		{
+			name:       "enabled by the namespace",
+			namespaces: []string{"default"},
+			podLevel:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := testr.New(t)
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+
+			cdiMgr := newMockCdiMgr()
+			driver := &CPUDriver{
+				driverName:                testDriverName,
+				kubeClient:                fake.NewClientset(pod),
+				cdiMgr:                    cdiMgr,
+				cpuTopology:               topo,
+				cpuAllocationStore:        store.NewCPUAllocation(topo, cpuset.New()),
+				podConfigStore:            store.NewPodConfig(),
+				claimTracker:              store.NewClaimTracker(),
+				podClaims:                 store.NewPodClaims(),
+				cpuDeviceMode:             CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy:          GROUP_BY_NUMA_NODE,
+				reservedCPUs:              cpuset.New(),
+				podLevelPinningNamespaces: sets.New(tc.namespaces...),
+			}
+			driver.initializeDeviceLookupMaps()
+
+			claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+			claim.Namespace = "default"
+			claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{{Resource: "pods", Name: "my-pod", UID: podUID}}
+			if tc.parameters != "" {
+				claim = testClaimAllCPUs(claim, tc.parameters)
+			}
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			require.NoError(t, prepared[claimUID].Err)
+			// the containers consuming the claim still get its CDI device.
+			require.Contains(t, cdiMgr.devices, getCDIDeviceName(claimUID))
+			claimCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.True(t, ok)
+			require.Equal(t, tc.podLevel, driver.podClaims.Has(claimUID))
+
+			sandbox := &api.PodSandbox{Id: "pod-id", Name: pod.Name, Namespace: pod.Namespace, Uid: string(podUID)}
+			app := &api.Container{Id: "app-id", PodSandboxId: sandbox.Id, Name: "app", Env: []string{fmt.Sprintf("%s_%s=%s", cdiEnvVarPrefix, claimUID, claimCPUs.String())}}
+			adjust, _, err := driver.CreateContainer(context.Background(), sandbox, app)
+			require.NoError(t, err)
+			require.Equal(t, claimCPUs.String(), adjust.GetLinux().GetResources().GetCpu().GetCpus())
+
+			sharedCPUs := driver.cpuAllocationStore.GetSharedCPUs()
+			expectedSidecarCPUs := sharedCPUs
+			if tc.podLevel {
+				expectedSidecarCPUs = claimCPUs
+			}
+			for _, name := range []string{"init", "sidecar"} {
+				ctr := &api.Container{Id: name + "-id", PodSandboxId: sandbox.Id, Name: name}
+				adjust, _, err := driver.CreateContainer(context.Background(), sandbox, ctr)
+				require.NoError(t, err)
+				require.Equal(t, expectedSidecarCPUs.String(), adjust.GetLinux().GetResources().GetCpu().GetCpus(), name)
+			}
+
+			// the claim CPUs are released early only if no other container of the pod can run on them.
+			_, err = driver.StopContainer(context.Background(), sandbox, app)
+			require.NoError(t, err)
+			_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.podLevel, ok)
+
+			unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+			require.NoError(t, err)
+			require.NoError(t, unprepared[claimUID])
+			require.False(t, driver.podClaims.Has(claimUID))
+			_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.False(t, ok)
+			require.NotContains(t, cdiMgr.devices, getCDIDeviceName(claimUID))
+		})
+	}
+}
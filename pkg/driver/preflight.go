@@ -0,0 +1,61 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/device"
+)
+
+// PreflightCheck is the result of a check of the node the driver needs to start.
+type PreflightCheck struct {
+	Name string `json:"name"`
+	// Required checks fail the start of the driver, the optional ones only disable a capability.
+	Required bool `json:"required"`
+	Passed   bool `json:"passed"`
+	// Message explains why the check failed.
+	Message string `json:"message,omitempty"`
+}
+
+// Preflight runs the checks of the privileges and of the kernel features Start runs, without starting the driver,
+// and reports all of them, passed or not.
+func Preflight(config *Config) []PreflightCheck {
+	return preflightChecks(privilegeChecks(config, config.hostPaths(), procSelfStatus), os.DirFS(device.SysfsRoot))
+}
+
+func preflightChecks(privileges []privilegeCheck, sysfs fs.FS) []PreflightCheck {
+	var checks []PreflightCheck
+	for _, privilege := range privileges {
+		check := PreflightCheck{Name: privilege.subsystem + ": " + privilege.privilege, Required: true, Passed: true}
+		if err := privilege.check(); err != nil {
+			check.Passed = false
+			check.Message = err.Error()
+		}
+		checks = append(checks, check)
+	}
+	for _, feature := range probeKernelFeatures(sysfs) {
+		checks = append(checks, PreflightCheck{
+			Name:     "kernel feature " + string(feature.Feature),
+			Required: feature.Required,
+			Passed:   feature.Supported,
+			Message:  feature.Message,
+		})
+	}
+	return checks
+}
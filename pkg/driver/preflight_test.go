@@ -0,0 +1,95 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPreflightChecks(t *testing.T) {
+	sysfs := fullKernelFeaturesSysFS()
+	delete(sysfs, "devices/system/cpu/smt/control")
+	privileges := []privilegeCheck{
+		{subsystem: SUBSYSTEM_CDI, privilege: "write access", check: func() error { return nil }},
+		{subsystem: SUBSYSTEM_NRI, privilege: "socket access", check: func() error { return errors.New("permission denied") }},
+	}
+
+	checks := preflightChecks(privileges, sysfs)
+	require.Len(t, checks, 2+4)
+	require.Equal(t, PreflightCheck{Name: "cdi: write access", Required: true, Passed: true}, checks[0])
+	require.Equal(t, PreflightCheck{Name: "nri: socket access", Required: true, Message: "permission denied"}, checks[1])
+	for _, check := range checks[2:] {
+		if check.Name == "kernel feature "+string(KERNEL_FEATURE_SMT_CONTROL) {
+			require.False(t, check.Passed)
+			require.False(t, check.Required)
+			require.NotEmpty(t, check.Message)
+			continue
+		}
+		require.True(t, check.Passed, check.Name)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	provider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	testCases := []struct {
+		name        string
+		config      Config
+		expectedErr string
+	}{
+		{
+			name:   "valid",
+			config: Config{ReservedCPUs: cpuset.New(0, 4)},
+		},
+		{
+			name:        "unknown reserved CPUs",
+			config:      Config{ReservedCPUs: cpuset.New(42)},
+			expectedErr: "not present in the CPU topology",
+		},
+		{
+			name:        "fractional CPUs without CDI",
+			config:      Config{FractionalCPUs: true},
+			expectedErr: "the fractional CPUs require CDI",
+		},
+		{
+			name:        "unknown feature gate",
+			config:      Config{FeatureGates: map[string]bool{"NoSuchGate": true}},
+			expectedErr: "NoSuchGate",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.DriverName = testDriverName
+			config.NodeName = testNodeName
+			config.CPUDeviceMode = CPU_DEVICE_MODE_GROUPED
+			config.CPUDeviceGroupBy = GROUP_BY_NUMA_NODE
+			config.EnableCDI = !config.FractionalCPUs
+			err := ValidateConfig(context.Background(), &config, provider)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+)
+
+// claimAllocationKey identifies the devices of the driver allocated to a claim, with their consumed capacity.
+func (cp *CPUDriver) claimAllocationKey(claim *resourceapi.ResourceClaim) string {
+	var key strings.Builder
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		fmt.Fprintf(&key, "%s/%s/%s", alloc.Request, alloc.Pool, alloc.Device)
+		for _, name := range slices.Sorted(maps.Keys(alloc.ConsumedCapacity)) {
+			quantity := alloc.ConsumedCapacity[name]
+			fmt.Fprintf(&key, ",%s=%s", name, quantity.String())
+		}
+		key.WriteString(";")
+	}
+	return key.String()
+}
+
+// recordPreparedResult remembers the outcome of the preparation of a claim, so the claim prepared
+// again with the same allocation gets the same CPUs.
+func (cp *CPUDriver) recordPreparedResult(claim *resourceapi.ResourceClaim, cdiDeviceIDs []string) {
+	cp.cpuAllocationStore.SetResourceClaimPreparedResult(claim.UID, store.PreparedResult{
+		AllocationKey: cp.claimAllocationKey(claim),
+		CDIDeviceIDs:  cdiDeviceIDs,
+	})
+}
+
+// preparedResult returns the outcome of the previous preparation of a claim, if the kubelet prepares
+// it again with the same allocation, like it does after a restart. A claim prepared again with a
+// different allocation is prepared from scratch.
+func (cp *CPUDriver) preparedResult(logger logr.Logger, claim *resourceapi.ResourceClaim) (kubeletplugin.PrepareResult, bool) {
+	if claim.Status.Allocation == nil {
+		return kubeletplugin.PrepareResult{}, false
+	}
+	prepared, ok := cp.cpuAllocationStore.GetResourceClaimPreparedResult(claim.UID)
+	if !ok || prepared.AllocationKey != cp.claimAllocationKey(claim) {
+		return kubeletplugin.PrepareResult{}, false
+	}
+	cpus, _ := cp.cpuAllocationStore.GetResourceClaimAllocation(claim.UID)
+	logger.V(2).Info("claim already prepared, returning the existing allocation", "cpus", cpus.String())
+
+	preparedDevices := []kubeletplugin.Device{}
+	for _, allocResult := range claim.Status.Allocation.Devices.Results {
+		if allocResult.Driver != cp.driverName {
+			continue
+		}
+		preparedDevice := kubeletplugin.Device{
+			PoolName:     allocResult.Pool,
+			DeviceName:   allocResult.Device,
+			CDIDeviceIDs: prepared.CDIDeviceIDs,
+			Requests:     []string{allocResult.Request},
+		}
+		preparedDevices = append(preparedDevices, preparedDevice)
+	}
+	return kubeletplugin.PrepareResult{Devices: preparedDevices}, true
+}
@@ -0,0 +1,210 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultKubeletPluginsDir is the directory of the kubelet plugin sockets, including the driver one.
+	DefaultKubeletPluginsDir = "/var/lib/kubelet/plugins"
+	// DefaultKubeletRegistrarDir is the directory of the kubelet plugin registration sockets.
+	DefaultKubeletRegistrarDir = "/var/lib/kubelet/plugins_registry"
+	// DefaultCDISpecDir is the directory the CDI specs of the claims are written to.
+	DefaultCDISpecDir = "/var/run/cdi"
+	// DefaultNRISocketPath is the socket of the NRI server of the container runtime.
+	DefaultNRISocketPath = "/var/run/nri/nri.sock"
+
+	// procSelfStatus is where the capabilities of the driver process are read from.
+	procSelfStatus = "/proc/self/status"
+)
+
+const (
+	// SUBSYSTEM_KUBELET_PLUGIN serves the DRA hooks to the kubelet through sockets in the kubelet directories.
+	SUBSYSTEM_KUBELET_PLUGIN = "kubelet-plugin"
+	// SUBSYSTEM_CDI writes the CDI specs exposing the allocations to the containers.
+	SUBSYSTEM_CDI = "cdi"
+	// SUBSYSTEM_NRI pins the containers through the NRI socket of the runtime.
+	SUBSYSTEM_NRI = "nri"
+	// SUBSYSTEM_SYSFS discovers the CPU topology from sysfs.
+	SUBSYSTEM_SYSFS = "sysfs"
+	// SUBSYSTEM_PROCESS_PINNING moves the host processes onto the reserved CPUs.
+	SUBSYSTEM_PROCESS_PINNING = "process-pinning"
+)
+
+// capSysNice is the bit of CAP_SYS_NICE, needed to set the CPU affinity of the processes of other users.
+const capSysNice = 23
+
+// PrivilegeError reports a privilege a subsystem of the driver needs and is missing.
+type PrivilegeError struct {
+	// Subsystem is the part of the driver missing the privilege, one of the SUBSYSTEM_* values.
+	Subsystem string
+	// Privilege describes what is needed, e.g. write access to a directory or a capability.
+	Privilege string
+	Err       error
+}
+
+func (e *PrivilegeError) Error() string {
+	return fmt.Sprintf("%s: missing %s: %v", e.Subsystem, e.Privilege, e.Err)
+}
+
+func (e *PrivilegeError) Unwrap() error {
+	return e.Err
+}
+
+// privilegeCheck verifies a privilege needed by a subsystem.
+type privilegeCheck struct {
+	subsystem string
+	privilege string
+	check     func() error
+}
+
+// checkPrivileges runs all the checks, so all the missing privileges are reported at once.
+func checkPrivileges(checks []privilegeCheck) error {
+	var errs []error
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			errs = append(errs, &PrivilegeError{Subsystem: c.subsystem, Privilege: c.privilege, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAccess verifies the driver process can access the path with the mode, using its effective IDs.
+// When running as non-root, the host paths must be owned or group-writable by the driver user.
+func checkAccess(path string, mode uint32) error {
+	if err := unix.Faccessat(unix.AT_FDCWD, path, mode, unix.AT_EACCESS); err != nil {
+		return fmt.Errorf("%s (uid %d, gid %d): %w", path, os.Geteuid(), os.Getegid(), err)
+	}
+	return nil
+}
+
+// checkDirCreatable verifies the directory can be written, or created if missing.
+func checkDirCreatable(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return checkAccess(filepath.Dir(path), unix.W_OK|unix.X_OK)
+	}
+	return checkAccess(path, unix.W_OK|unix.X_OK)
+}
+
+// checkSocketAccess verifies the socket can be connected to. A missing socket is not an error:
+// the runtime may not be up yet, and the connection is retried.
+func checkSocketAccess(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return checkAccess(path, unix.R_OK|unix.W_OK)
+}
+
+// effectiveCapabilities reads the effective capability set from a /proc/<pid>/status file.
+func effectiveCapabilities(statusPath string) (uint64, error) {
+	data, err := os.ReadFile(statusPath)
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed CapEff in %s: %w", statusPath, err)
+		}
+		return caps, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no CapEff in %s", statusPath)
+}
+
+// checkCapability verifies the capability is in the effective set of the process.
+func checkCapability(statusPath string, capability uint, name string) error {
+	caps, err := effectiveCapabilities(statusPath)
+	if err != nil {
+		return err
+	}
+	if caps&(1<<capability) == 0 {
+		return fmt.Errorf("%s not in the effective capabilities %#x", name, caps)
+	}
+	return nil
+}
+
+// hostPaths are where the host directories and sockets the driver uses are mounted in its container.
+type hostPaths struct {
+	kubeletPluginsDir   string
+	kubeletRegistrarDir string
+	cdiSpecDir          string
+	nriSocketPath       string
+	sysfsRoot           string
+}
+
+// privilegeChecks returns the checks of the privileges needed by the enabled subsystems.
+func privilegeChecks(config *Config, paths hostPaths, statusPath string) []privilegeCheck {
+	driverPluginDir := filepath.Join(paths.kubeletPluginsDir, config.DriverName)
+	checks := []privilegeCheck{
+		{
+			subsystem: SUBSYSTEM_SYSFS,
+			privilege: "read access to the CPU topology",
+			check: func() error {
+				return checkAccess(filepath.Join(paths.sysfsRoot, cpuRoot), unix.R_OK|unix.X_OK)
+			},
+		},
+		{
+			subsystem: SUBSYSTEM_KUBELET_PLUGIN,
+			privilege: "write access to the driver plugin directory",
+			check:     func() error { return checkDirCreatable(driverPluginDir) },
+		},
+		{
+			subsystem: SUBSYSTEM_KUBELET_PLUGIN,
+			privilege: "write access to the plugin registration directory",
+			check:     func() error { return checkAccess(paths.kubeletRegistrarDir, unix.W_OK|unix.X_OK) },
+		},
+		{
+			subsystem: SUBSYSTEM_NRI,
+			privilege: "read and write access to the NRI socket",
+			check:     func() error { return checkSocketAccess(paths.nriSocketPath) },
+		},
+	}
+	if config.EnableCDI {
+		checks = append(checks, privilegeCheck{
+			subsystem: SUBSYSTEM_CDI,
+			privilege: "write access to the CDI spec directory",
+			check:     func() error { return checkDirCreatable(paths.cdiSpecDir) },
+		})
+	}
+	if len(config.PinnedSystemdUnits) > 0 || len(config.PinnedProcessNames) > 0 {
+		checks = append(checks, privilegeCheck{
+			subsystem: SUBSYSTEM_PROCESS_PINNING,
+			privilege: "the CAP_SYS_NICE capability",
+			check:     func() error { return checkCapability(statusPath, capSysNice, "CAP_SYS_NICE") },
+		})
+	}
+	return checks
+}
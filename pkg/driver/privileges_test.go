@@ -0,0 +1,140 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeProcStatus writes a /proc/<pid>/status file with the given effective capabilities.
+func writeProcStatus(t *testing.T, capEff string) string {
+	t.Helper()
+	statusPath := filepath.Join(t.TempDir(), "status")
+	content := "Name:\tdracpu\nCapInh:\t0000000000000000\nCapEff:\t" + capEff + "\nCapBnd:\t000001ffffffffff\n"
+	require.NoError(t, os.WriteFile(statusPath, []byte(content), 0600))
+	return statusPath
+}
+
+func TestEffectiveCapabilities(t *testing.T) {
+	caps, err := effectiveCapabilities(writeProcStatus(t, "0000000000800000"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1<<capSysNice), caps)
+
+	_, err = effectiveCapabilities(writeProcStatus(t, "not-hex"))
+	require.ErrorContains(t, err, "malformed CapEff")
+
+	require.NoError(t, checkCapability(writeProcStatus(t, "000001ffffffffff"), capSysNice, "CAP_SYS_NICE"))
+	require.ErrorContains(t, checkCapability(writeProcStatus(t, "0000000000000000"), capSysNice, "CAP_SYS_NICE"), "CAP_SYS_NICE not in the effective capabilities")
+}
+
+// testHostPaths returns host paths in a temporary directory, all existing but the NRI socket.
+func testHostPaths(t *testing.T) hostPaths {
+	t.Helper()
+	root := t.TempDir()
+	paths := hostPaths{
+		kubeletPluginsDir:   filepath.Join(root, "plugins"),
+		kubeletRegistrarDir: filepath.Join(root, "plugins_registry"),
+		cdiSpecDir:          filepath.Join(root, "cdi"),
+		nriSocketPath:       filepath.Join(root, "nri", "nri.sock"),
+		sysfsRoot:           filepath.Join(root, "sys"),
+	}
+	for _, dir := range []string{paths.kubeletPluginsDir, paths.kubeletRegistrarDir, filepath.Join(paths.sysfsRoot, cpuRoot)} {
+		require.NoError(t, os.MkdirAll(dir, 0750))
+	}
+	return paths
+}
+
+func TestCheckPrivileges(t *testing.T) {
+	withSysNice := writeProcStatus(t, "0000000000800000")
+	withoutSysNice := writeProcStatus(t, "0000000000000000")
+
+	testCases := []struct {
+		name               string
+		config             *Config
+		paths              func(paths hostPaths) hostPaths
+		statusPath         string
+		expectedSubsystems []string
+	}{
+		{
+			name:       "all privileges",
+			config:     &Config{DriverName: testDriverName, EnableCDI: true, PinnedProcessNames: []string{"irqbalance"}},
+			statusPath: withSysNice,
+		},
+		{
+			name:   "missing host paths",
+			config: &Config{DriverName: testDriverName, EnableCDI: true},
+			paths: func(paths hostPaths) hostPaths {
+				paths.kubeletRegistrarDir = filepath.Join(paths.kubeletRegistrarDir, "missing")
+				paths.cdiSpecDir = filepath.Join(paths.cdiSpecDir, "missing", "cdi")
+				return paths
+			},
+			statusPath:         withSysNice,
+			expectedSubsystems: []string{SUBSYSTEM_KUBELET_PLUGIN, SUBSYSTEM_CDI},
+		},
+		{
+			name:   "CDI disabled",
+			config: &Config{DriverName: testDriverName},
+			paths: func(paths hostPaths) hostPaths {
+				paths.cdiSpecDir = filepath.Join(paths.cdiSpecDir, "missing", "cdi")
+				return paths
+			},
+			statusPath: withSysNice,
+		},
+		{
+			name:               "process pinning without CAP_SYS_NICE",
+			config:             &Config{DriverName: testDriverName, PinnedSystemdUnits: []string{"sshd"}},
+			statusPath:         withoutSysNice,
+			expectedSubsystems: []string{SUBSYSTEM_PROCESS_PINNING},
+		},
+		{
+			name:   "missing sysfs",
+			config: &Config{DriverName: testDriverName},
+			paths: func(paths hostPaths) hostPaths {
+				paths.sysfsRoot = filepath.Join(paths.sysfsRoot, "missing")
+				return paths
+			},
+			statusPath:         withoutSysNice,
+			expectedSubsystems: []string{SUBSYSTEM_SYSFS},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := testHostPaths(t)
+			if tc.paths != nil {
+				paths = tc.paths(paths)
+			}
+			err := checkPrivileges(privilegeChecks(tc.config, paths, tc.statusPath))
+			if len(tc.expectedSubsystems) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			var subsystems []string
+			for _, joined := range err.(interface{ Unwrap() []error }).Unwrap() {
+				var privErr *PrivilegeError
+				require.True(t, errors.As(joined, &privErr), "got %v", joined)
+				subsystems = append(subsystems, privErr.Subsystem)
+			}
+			require.Equal(t, tc.expectedSubsystems, subsystems)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+// PublishTrigger is the reason the ResourceSlices of the node are published.
+type PublishTrigger string
+
+const (
+	// PUBLISH_TRIGGER_STARTUP publishes the ResourceSlices when the driver starts.
+	PUBLISH_TRIGGER_STARTUP PublishTrigger = "startup"
+	// PUBLISH_TRIGGER_ALLOCATION_CHANGE publishes the ResourceSlices after the allocations changed the published devices.
+	PUBLISH_TRIGGER_ALLOCATION_CHANGE PublishTrigger = "allocation-change"
+	// PUBLISH_TRIGGER_MANUAL publishes the ResourceSlices on request of the operator, sending SIGHUP to the driver.
+	PUBLISH_TRIGGER_MANUAL PublishTrigger = "manual"
+	// PUBLISH_TRIGGER_FREQUENCY_CHANGE publishes the ResourceSlices after the frequency limits of the CPUs changed
+	// their performance scores.
+	PUBLISH_TRIGGER_FREQUENCY_CHANGE PublishTrigger = "frequency-change"
+	// PUBLISH_TRIGGER_TOPOLOGY_CHANGE publishes the ResourceSlices after CPUs went offline or online again,
+	// changing the taints of the devices.
+	PUBLISH_TRIGGER_TOPOLOGY_CHANGE PublishTrigger = "topology-change"
+	// PUBLISH_TRIGGER_CPU_HEALTH_CHANGE publishes the ResourceSlices after CPUs were flagged unhealthy, or recovered,
+	// changing the taints of the devices.
+	PUBLISH_TRIGGER_CPU_HEALTH_CHANGE PublishTrigger = "cpu-health-change"
+)
+
+// ResourcePublisher serializes the publication of the ResourceSlices. Triggers received
+// while a publication is pending or in progress are coalesced in the next publication,
+// so a burst of triggers results in at most one extra publication.
+type ResourcePublisher struct {
+	publish func(context.Context)
+	lock    sync.Mutex
+	pending []PublishTrigger
+	wakeup  chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func newResourcePublisher(publish func(context.Context)) *ResourcePublisher {
+	return &ResourcePublisher{
+		publish: publish,
+		wakeup:  make(chan struct{}, 1),
+	}
+}
+
+// Trigger requests a publication. It never blocks.
+func (p *ResourcePublisher) Trigger(trigger PublishTrigger) {
+	p.lock.Lock()
+	if !slices.Contains(p.pending, trigger) {
+		p.pending = append(p.pending, trigger)
+	}
+	p.lock.Unlock()
+	select {
+	case p.wakeup <- struct{}{}:
+	default:
+		// a publication is already pending, it will include this trigger.
+	}
+}
+
+// run publishes the ResourceSlices on each trigger, until the context is cancelled.
+func (p *ResourcePublisher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wakeup:
+		}
+		p.lock.Lock()
+		triggers := p.pending
+		p.pending = nil
+		p.lock.Unlock()
+		if len(triggers) == 0 {
+			continue
+		}
+		for _, trigger := range triggers {
+			resourcePublications.WithLabelValues(string(trigger)).Inc()
+		}
+		pctx, _ := ctxlog.WithValues(ctx, "triggers", triggers)
+		p.publish(pctx)
+	}
+}
+
+// Name implements Component.
+func (p *ResourcePublisher) Name() string {
+	return COMPONENT_RESOURCE_PUBLISHER
+}
+
+// Start publishes the ResourceSlices for the first time, and then on each trigger.
+func (p *ResourcePublisher) Start(ctx context.Context) error {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.Trigger(PUBLISH_TRIGGER_STARTUP)
+	go func() {
+		defer close(p.done)
+		p.run(ctx)
+	}()
+	return nil
+}
+
+// Stop stops publishing, waiting for the publication in progress, if any.
+func (p *ResourcePublisher) Stop(ctx context.Context) {
+	p.cancel()
+	<-p.done
+}
+
+// Healthy implements Component. The publication failures are retried by the kubelet plugin helper.
+func (p *ResourcePublisher) Healthy() error {
+	return nil
+}
+
+// RequestPublish asks to publish again the ResourceSlices of the node. The manual publications
+// publish all the pools, changed or not, so they restore the ResourceSlices deleted by mistake.
+func (cp *CPUDriver) RequestPublish(trigger PublishTrigger) {
+	if cp.publisher == nil {
+		return
+	}
+	if trigger == PUBLISH_TRIGGER_MANUAL {
+		cp.publishedPools.reset()
+	}
+	cp.publisher.Trigger(trigger)
+}
+
+// publishedPools are the resource pools of the last publication, to detect the publications which change
+// nothing: the frequent publications, e.g. of the full cores capacity, often publish the same devices again.
+// Within the changed pools, the kubelet plugin helper updates only the ResourceSlices which differ from the
+// ones in the API server.
+type publishedPools struct {
+	lock  sync.Mutex
+	pools map[string]resourceslice.Pool
+}
+
+// changed returns the names of the pools added, changed or removed since the last publication, sorted.
+func (p *publishedPools) changed(pools map[string]resourceslice.Pool) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var names []string
+	for name, pool := range pools {
+		if published, ok := p.pools[name]; !ok || !equality.Semantic.DeepEqual(published, pool) {
+			names = append(names, name)
+		}
+	}
+	for name := range p.pools {
+		if _, ok := pools[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// set records the pools of a publication.
+func (p *publishedPools) set(pools map[string]resourceslice.Pool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pools = pools
+}
+
+// get returns the pools of the last publication, nil before the first one. The pools are not modified once set.
+func (p *publishedPools) get() map[string]resourceslice.Pool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.pools
+}
+
+// reset forgets the last publication, so the next one publishes all the pools.
+func (p *publishedPools) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pools = nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+)
+
+func TestResourcePublisherCoalescesTriggers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	publisher := newResourcePublisher(func(context.Context) {
+		calls++
+		started <- struct{}{}
+		<-release
+	})
+	manual := testutil.ToFloat64(resourcePublications.WithLabelValues(string(PUBLISH_TRIGGER_MANUAL)))
+
+	done := make(chan struct{})
+	go func() {
+		publisher.run(ctx)
+		close(done)
+	}()
+
+	publisher.Trigger(PUBLISH_TRIGGER_STARTUP)
+	<-started
+	// the triggers received while publishing are coalesced in one publication.
+	publisher.Trigger(PUBLISH_TRIGGER_MANUAL)
+	publisher.Trigger(PUBLISH_TRIGGER_ALLOCATION_CHANGE)
+	publisher.Trigger(PUBLISH_TRIGGER_MANUAL)
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+
+	select {
+	case <-started:
+		t.Fatal("unexpected publication")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	<-done
+
+	require.Equal(t, 2, calls)
+	require.Equal(t, manual+1, testutil.ToFloat64(resourcePublications.WithLabelValues(string(PUBLISH_TRIGGER_MANUAL))))
+}
+
+func TestRequestPublishWithoutPublisher(t *testing.T) {
+	driver := &CPUDriver{}
+	require.NotPanics(t, func() { driver.RequestPublish(PUBLISH_TRIGGER_MANUAL) })
+}
+
+func TestPublishResourcesSkipsUnchangedPools(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT)
+	mockPlugin := &mockKubeletPlugin{}
+	driver.draPlugin = mockPlugin
+	driver.publisher = newResourcePublisher(func(context.Context) {})
+	skipped := testutil.ToFloat64(resourcePublicationsSkipped)
+
+	driver.PublishResources(context.Background())
+	require.NotNil(t, mockPlugin.publishedResources)
+
+	// the same devices are not published again.
+	mockPlugin.publishedResources = nil
+	driver.PublishResources(context.Background())
+	require.Nil(t, mockPlugin.publishedResources)
+	require.Equal(t, skipped+1, testutil.ToFloat64(resourcePublicationsSkipped))
+
+	// a changed pool is published.
+	driver.sharedPoolDevice = true
+	driver.PublishResources(context.Background())
+	require.NotNil(t, mockPlugin.publishedResources)
+
+	// the manual publications are never skipped.
+	mockPlugin.publishedResources = nil
+	driver.RequestPublish(PUBLISH_TRIGGER_MANUAL)
+	driver.PublishResources(context.Background())
+	require.NotNil(t, mockPlugin.publishedResources)
+
+	// a failed publication is not skipped the next time.
+	driver.sharedPoolDevice = false
+	mockPlugin.publishError = errors.New("publish failed")
+	driver.PublishResources(context.Background())
+	mockPlugin.publishError = nil
+	mockPlugin.publishedResources = nil
+	driver.PublishResources(context.Background())
+	require.NotNil(t, mockPlugin.publishedResources)
+}
+
+func TestPublishedPoolsChanged(t *testing.T) {
+	var published publishedPools
+	pools := map[string]resourceslice.Pool{
+		"node-a": {Slices: []resourceslice.Slice{{Devices: []resourceapi.Device{{Name: "cpudevnuma000"}}}}},
+		"node-b": {Slices: []resourceslice.Slice{{Devices: []resourceapi.Device{{Name: "cpudevnuma001"}}}}},
+	}
+	require.Equal(t, []string{"node-a", "node-b"}, published.changed(pools))
+
+	published.set(pools)
+	require.Empty(t, published.changed(pools))
+
+	changed := map[string]resourceslice.Pool{
+		"node-a": pools["node-a"],
+		"node-c": {Slices: []resourceslice.Slice{{Devices: []resourceapi.Device{{Name: "cpudevnuma002"}}}}},
+	}
+	require.Equal(t, []string{"node-b", "node-c"}, published.changed(changed))
+
+	published.reset()
+	require.Equal(t, []string{"node-a", "node-b"}, published.changed(pools))
+}
@@ -0,0 +1,34 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// claimRequiresFullCores returns true if the CPUs of the claim must be rounded up to whole physical cores:
+// SMT is enabled, and the opaque configuration of the claim enables requireFullCores.
+func (cp *CPUDriver) claimRequiresFullCores(claim *resourceapi.ResourceClaim) (bool, error) {
+	if claim.Status.Allocation == nil {
+		return false, nil
+	}
+	enabled, err := cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.RequireFullCores })
+	if err != nil {
+		return false, err
+	}
+	return enabled && cp.cpuTopology.CPUsPerCore() > 1, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsRequireFullCores(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-full-cores")
+
+	testCases := []struct {
+		name           string
+		cpuInfos       []cpuinfo.CPUInfo
+		fullPCPUsOnly  bool
+		parameters     string
+		numCPUs        int64
+		allocated      cpuset.CPUSet
+		expectedCPUSet cpuset.CPUSet
+		expectedError  bool
+	}{
+		{
+			name:           "without the parameter",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			parameters:     `{}`,
+			numCPUs:        1,
+			allocated:      cpuset.New(0),
+			expectedCPUSet: cpuset.New(4),
+		},
+		{
+			// the request is rounded up to the next whole core.
+			name:           "odd CPU count",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			parameters:     `{"requireFullCores": true}`,
+			numCPUs:        3,
+			expectedCPUSet: cpuset.New(0, 1, 4, 5),
+		},
+		{
+			name:           "broken core skipped",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			parameters:     `{"apiVersion": "cpu.dra.x-k8s.io/v1alpha1", "kind": "CPUClaimParameters", "requireFullCores": true}`,
+			numCPUs:        1,
+			allocated:      cpuset.New(0),
+			expectedCPUSet: cpuset.New(1, 5),
+		},
+		{
+			// the claim rounds up instead of failing as --full-pcpus-only does.
+			name:           "with full-pcpus-only",
+			cpuInfos:       mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			fullPCPUsOnly:  true,
+			parameters:     `{"requireFullCores": true}`,
+			numCPUs:        1,
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:          "no whole core left",
+			cpuInfos:      mockCPUInfos_DualSocket_4CPUsPerSocket_HT,
+			parameters:    `{"requireFullCores": true}`,
+			numCPUs:       1,
+			allocated:     cpuset.New(0, 1),
+			expectedError: true,
+		},
+		{
+			name:           "without SMT",
+			cpuInfos:       mockCPUInfos_SingleSocket_4CPUs_HT_Off,
+			parameters:     `{"requireFullCores": true}`,
+			numCPUs:        1,
+			expectedCPUSet: cpuset.New(0),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, tc.cpuInfos, func(cp *CPUDriver) {
+				cp.fullPCPUsOnly = tc.fullPCPUsOnly
+			})
+			if !tc.allocated.IsEmpty() {
+				driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", tc.allocated)
+			}
+
+			claim := testClaimAllCPUs(testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": tc.numCPUs}), tc.parameters)
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestPrepareResourceClaimsRequireFullCoresIndividualDevices(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+	})
+	deviceNames := map[int]string{}
+	for name, cpuID := range driver.deviceNameToCPUID {
+		deviceNames[cpuID] = name
+	}
+	claimOf := func(claimUID types.UID, parameters string, cpuIDs ...int) *resourceapi.ResourceClaim {
+		var results []resourceapi.DeviceRequestAllocationResult
+		for _, cpuID := range cpuIDs {
+			results = append(results, resourceapi.DeviceRequestAllocationResult{Driver: testDriverName, Pool: testNodeName, Device: deviceNames[cpuID]})
+		}
+		return testClaimAllCPUs(testClaimWithResults(claimUID, results), parameters)
+	}
+
+	// the claim of CPU 0 is padded with its sibling 4, while the claim of CPU 1 is not.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-full-cores", `{"requireFullCores": true}`, 0),
+		claimOf("claim-thread", `{}`, 1),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-full-cores"].Err)
+	require.NoError(t, prepared["claim-thread"].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-full-cores")
+	require.Equal(t, "0,4", gotCPUs.String())
+	gotCPUs, _ = driver.cpuAllocationStore.GetResourceClaimAllocation("claim-thread")
+	require.Equal(t, "1", gotCPUs.String())
+
+	// the sibling 1 of CPU 5 is allocated to another claim.
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-sibling", `{"requireFullCores": true}`, 5),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-sibling"].Err)
+}
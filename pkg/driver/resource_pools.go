@@ -0,0 +1,120 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/resourceslice"
+	"k8s.io/utils/cpuset"
+)
+
+// nodePoolGroup is the slice group of the devices spanning all the groups, published in the pool named as the node.
+const nodePoolGroup = -1
+
+// resourcePoolName returns the name of the pool of the slices of a slice group. All the slices are published in
+// a single pool named as the node, unless --resourcepool-per-group publishes each group in a pool of its own,
+// e.g. "node-1-numa001".
+func (cp *CPUDriver) resourcePoolName(group int) string {
+	if !cp.resourcePoolPerGroup || group == nodePoolGroup {
+		return cp.nodeName
+	}
+	switch cp.sliceGrouping {
+	case SLICE_GROUPING_SOCKET:
+		return fmt.Sprintf("%s-socket%03d", cp.nodeName, group)
+	case SLICE_GROUPING_NUMA_NODE:
+		return fmt.Sprintf("%s-numa%03d", cp.nodeName, group)
+	}
+	return cp.nodeName
+}
+
+// ownsResourcePool returns true if the pool is one of the pools the driver publishes for the node.
+func (cp *CPUDriver) ownsResourcePool(pool string) bool {
+	if pool == cp.nodeName {
+		return true
+	}
+	if !cp.resourcePoolPerGroup {
+		return false
+	}
+	for _, cpuID := range cp.cpuTopology.CPUDetails.CPUs().List() {
+		if pool == cp.resourcePoolName(cp.sliceGroupOf(cpuset.New(cpuID))) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourcePools returns the pools of the chunks of devices. The counter sets go in a slice of their own, first,
+// in the pool of their NUMA node: the devices of all the slices of the pool consume them.
+func (cp *CPUDriver) resourcePools(chunks []deviceChunk) map[string]resourceslice.Pool {
+	pools := make(map[string]resourceslice.Pool)
+	if cp.usesNUMANodeCounters() {
+		var poolOrder []string
+		counterSets := make(map[string][]resourceapi.CounterSet)
+		groups := cp.counterSetGroups()
+		for _, counterSet := range cp.numaNodeCounterSets() {
+			name := cp.resourcePoolName(groups[counterSet.Name])
+			if _, ok := counterSets[name]; !ok {
+				poolOrder = append(poolOrder, name)
+			}
+			counterSets[name] = append(counterSets[name], counterSet)
+		}
+		for _, name := range poolOrder {
+			pools[name] = resourceslice.Pool{Slices: []resourceslice.Slice{{SharedCounters: counterSets[name]}}}
+		}
+	}
+	for _, chunk := range chunks {
+		name := cp.resourcePoolName(chunk.group)
+		pool := pools[name]
+		pool.Slices = append(pool.Slices, resourceslice.Slice{Devices: chunk.devices})
+		pools[name] = pool
+	}
+	return pools
+}
+
+// counterSetGroups returns the slice group of the counter set of each NUMA node, by name.
+func (cp *CPUDriver) counterSetGroups() map[string]int {
+	groups := make(map[string]int)
+	for numaNodeID := range cp.allocatableCPUsByNUMANode() {
+		groups[cp.numaNodeCounterSetName(numaNodeID)] = cp.sliceGroupOf(cp.cpuTopology.CPUDetails.CPUsInNUMANodes(numaNodeID))
+	}
+	return groups
+}
+
+// validateResourcePools checks the pools of the groups can be published: the devices must consume only the
+// counter sets of their own pool, as the counters are shared within a pool only.
+func (cp *CPUDriver) validateResourcePools() error {
+	if !cp.resourcePoolPerGroup {
+		return nil
+	}
+	if cp.sliceGrouping != SLICE_GROUPING_SOCKET && cp.sliceGrouping != SLICE_GROUPING_NUMA_NODE {
+		return fmt.Errorf("the pools per group require --resourceslice-grouping=%s or %s", SLICE_GROUPING_SOCKET, SLICE_GROUPING_NUMA_NODE)
+	}
+	if !cp.usesNUMANodeCounters() {
+		return nil
+	}
+	for _, device := range append(cp.groupedCPUDeviceInfos(), cp.socketNUMAPartitionInfos()...) {
+		details := cp.cpuTopology.CPUDetails.KeepOnly(device.cpus)
+		for _, numaNodeID := range details.NUMANodes().List() {
+			if group := cp.sliceGroupOf(details.CPUsInNUMANodes(numaNodeID)); group != cp.sliceGroupOf(device.cpus) {
+				return fmt.Errorf("device %s consumes the counters of NUMA nodes in different pools, use --resourceslice-grouping=%s", device.name, SLICE_GROUPING_SOCKET)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+func TestPublishResourcesPoolPerGroup(t *testing.T) {
+	mockPlugin := &mockKubeletPlugin{}
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		driver.draPlugin = mockPlugin
+		driver.cpuDeviceMode = CPU_DEVICE_MODE_MIXED
+		driver.sliceGrouping = SLICE_GROUPING_NUMA_NODE
+		driver.resourcePoolPerGroup = true
+		driver.sharedPoolDevice = true
+	})
+	require.NoError(t, driver.validateResourcePools())
+	driver.PublishResources(context.Background())
+
+	require.NotNil(t, mockPlugin.publishedResources)
+	pools := mockPlugin.publishedResources.Pools
+	require.Len(t, pools, 3)
+	for numaNodeID, name := range []string{testNodeName + "-numa000", testNodeName + "-numa001"} {
+		pool, ok := pools[name]
+		require.True(t, ok, "missing pool %s", name)
+		// the counter set of the NUMA node comes first, in the pool of the devices consuming it.
+		require.Len(t, pool.Slices[0].SharedCounters, 1)
+		require.Equal(t, driver.numaNodeCounterSetName(numaNodeID), pool.Slices[0].SharedCounters[0].Name)
+		for _, slice := range pool.Slices[1:] {
+			for _, device := range slice.Devices {
+				for _, consumption := range device.ConsumesCounters {
+					require.Equal(t, driver.numaNodeCounterSetName(numaNodeID), consumption.CounterSet, "device %s", device.Name)
+				}
+			}
+		}
+	}
+	require.Equal(t, []resourceapi.Device{driver.createSharedPoolDevice()}, pools[testNodeName].Slices[0].Devices)
+
+	require.True(t, driver.ownsResourcePool(testNodeName))
+	require.True(t, driver.ownsResourcePool(testNodeName+"-numa001"))
+	require.False(t, driver.ownsResourcePool(testNodeName+"-numa002"))
+	require.False(t, driver.ownsResourcePool("other-node"))
+}
+
+func TestValidateResourcePools(t *testing.T) {
+	driver := newSocketNUMAPartitionsDriver(t)
+	driver.resourcePoolPerGroup = true
+	driver.sliceGrouping = SLICE_GROUPING_NONE
+	require.ErrorContains(t, driver.validateResourcePools(), "--resourceslice-grouping")
+
+	// the socket devices consume the counters of the NUMA nodes of their socket.
+	driver.sliceGrouping = SLICE_GROUPING_NUMA_NODE
+	require.ErrorContains(t, driver.validateResourcePools(), "different pools")
+	driver.sliceGrouping = SLICE_GROUPING_SOCKET
+	require.NoError(t, driver.validateResourcePools())
+}
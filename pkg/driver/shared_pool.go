@@ -0,0 +1,130 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// sharedPoolExhaustedReason is the reason of the node event and condition when the shared CPUs reach the minimum.
+	sharedPoolExhaustedReason = "SharedCPUPoolExhausted"
+	// sharedPoolRecoveredReason is the reason of the node event and condition when the shared CPUs are above the minimum again.
+	sharedPoolRecoveredReason = "SharedCPUPoolRecovered"
+)
+
+// sharedPoolMonitor signals when the exclusive allocations shrink the shared CPUs to the minimum,
+// so the operators or the cluster autoscaler can act before the next claims fail to be prepared.
+// The claims which shrink the pool are still prepared: the signal is a soft one.
+type sharedPoolMonitor struct {
+	minCPUs int
+	node    *corev1.ObjectReference
+	// recorder emits the events on the node, nil if the events are disabled.
+	recorder record.EventRecorder
+
+	mu                 sync.Mutex
+	exhausted          bool
+	sharedCPUs         int
+	lastTransitionTime time.Time
+}
+
+func newSharedPoolMonitor(nodeName string, minCPUs int, recorder record.EventRecorder) *sharedPoolMonitor {
+	return &sharedPoolMonitor{
+		minCPUs: minCPUs,
+		// the kubelet uses the node name as the UID of the node events, so they are listed with its own ones.
+		node:               &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)},
+		recorder:           recorder,
+		lastTransitionTime: time.Now(),
+	}
+}
+
+// update checks the shared CPUs against the minimum. Only the transitions are reported by event,
+// so the node events don't grow with the allocations while the pool stays exhausted.
+func (m *sharedPoolMonitor) update(logger logr.Logger, sharedCPUs cpuset.CPUSet) {
+	if m == nil {
+		return
+	}
+	exhausted := sharedCPUs.Size() <= m.minCPUs
+	if exhausted {
+		sharedPoolExhausted.Set(1)
+	} else {
+		sharedPoolExhausted.Set(0)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sharedCPUs = sharedCPUs.Size()
+	if exhausted == m.exhausted {
+		return
+	}
+	m.exhausted = exhausted
+	m.lastTransitionTime = time.Now()
+	if exhausted {
+		sharedPoolExhaustions.Inc()
+		logger.Info("the shared CPU pool is exhausted", "sharedCPUs", sharedCPUs.String(), "minSharedCPUs", m.minCPUs)
+		if m.recorder != nil {
+			m.recorder.Eventf(m.node, corev1.EventTypeWarning, sharedPoolExhaustedReason, "%d shared CPUs left, the minimum is %d: the next claims may fail to be prepared", sharedCPUs.Size(), m.minCPUs)
+		}
+		return
+	}
+	logger.Info("the shared CPU pool is above the minimum again", "sharedCPUs", sharedCPUs.String(), "minSharedCPUs", m.minCPUs)
+	if m.recorder != nil {
+		m.recorder.Eventf(m.node, corev1.EventTypeNormal, sharedPoolRecoveredReason, "%d shared CPUs left, above the minimum of %d", sharedCPUs.Size(), m.minCPUs)
+	}
+}
+
+// condition returns the SharedCPUPoolExhausted condition of the node status.
+func (m *sharedPoolMonitor) condition() metav1.Condition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	condition := metav1.Condition{
+		Type:               NodeStatusConditionSharedCPUPoolExhausted,
+		Status:             metav1.ConditionFalse,
+		Reason:             sharedPoolRecoveredReason,
+		Message:            fmt.Sprintf("%d shared CPUs, the minimum is %d", m.sharedCPUs, m.minCPUs),
+		LastTransitionTime: metav1.NewTime(m.lastTransitionTime),
+	}
+	if m.exhausted {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = sharedPoolExhaustedReason
+	}
+	return condition
+}
+
+// newEventRecorder returns a recorder of the events of the driver, and the component sending them to the API server.
+func newEventRecorder(clientset kubernetes.Interface, driverName, nodeName string) (record.EventRecorder, Component) {
+	broadcaster := record.NewBroadcaster()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: driverName, Host: nodeName})
+	return recorder, newRunnerComponent(COMPONENT_EVENT_RECORDER, func(ctx context.Context) {
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+		<-ctx.Done()
+		broadcaster.Shutdown()
+	})
+}
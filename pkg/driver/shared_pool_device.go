@@ -0,0 +1,87 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/ptr"
+)
+
+// cpuDeviceSharedPool is the virtual device of the shared pool, published with --shared-pool-device.
+const cpuDeviceSharedPool = "cpudevshared"
+
+// createSharedPoolDevice returns the virtual device of the shared pool. It has no capacity: any number
+// of claims are allocated it, and their containers run on the shared CPUs, which shrink and grow with
+// the exclusive allocations.
+func (cp *CPUDriver) createSharedPoolDevice() resourceapi.Device {
+	attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+		AttributeSharedPool: {BoolValue: ptr.To(true)},
+		AttributeSMTEnabled: {BoolValue: ptr.To(cp.cpuTopology.SMTEnabled)},
+	}
+	cp.setKernelFeatureAttributes(attrs)
+	cp.setBuildAttributes(attrs)
+	return resourceapi.Device{
+		Name:                     cpuDeviceSharedPool,
+		Attributes:               attrs,
+		AllowMultipleAllocations: ptr.To(true),
+	}
+}
+
+// isSharedPoolClaim returns true if the devices of the driver allocated to the claim are all the shared pool
+// device. A claim can't mix it with the CPU devices: its containers would run on both the exclusive and the shared CPUs.
+func (cp *CPUDriver) isSharedPoolClaim(claim *resourceapi.ResourceClaim) (bool, error) {
+	if !cp.sharedPoolDevice || claim.Status.Allocation == nil {
+		return false, nil
+	}
+	shared, other := 0, 0
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		if alloc.Device == cpuDeviceSharedPool {
+			shared++
+		} else {
+			other++
+		}
+	}
+	if shared > 0 && other > 0 {
+		return false, fmt.Errorf("claim %s/%s mixes the shared pool device with CPU devices", claim.Namespace, claim.Name)
+	}
+	return shared > 0, nil
+}
+
+// prepareSharedPoolClaim prepares a claim of the shared pool device. There is nothing to pin: the containers
+// consuming the claim are created on the shared CPUs, and updated as the exclusive allocations change.
+func (cp *CPUDriver) prepareSharedPoolClaim(logger logr.Logger, claim *resourceapi.ResourceClaim) kubeletplugin.PrepareResult {
+	preparedDevices := []kubeletplugin.Device{}
+	for _, alloc := range claim.Status.Allocation.Devices.Results {
+		if alloc.Driver != cp.driverName {
+			continue
+		}
+		preparedDevices = append(preparedDevices, kubeletplugin.Device{
+			PoolName:   alloc.Pool,
+			DeviceName: alloc.Device,
+			Requests:   []string{alloc.Request},
+		})
+	}
+	logger.V(2).Info("claim prepared with access to the shared CPUs", "sharedCPUs", cp.cpuAllocationStore.GetSharedCPUs().String())
+	return kubeletplugin.PrepareResult{Devices: preparedDevices}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestSharedPoolDevice(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             cdiMgr,
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		sharedPoolDevice:   true,
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	device := driver.createSharedPoolDevice()
+	require.Equal(t, cpuDeviceSharedPool, device.Name)
+	require.True(t, *device.AllowMultipleAllocations)
+	require.True(t, *device.Attributes[AttributeSharedPool].BoolValue)
+	require.Empty(t, device.Capacity)
+
+	exclusiveUID := types.UID("claim-exclusive")
+	sharedUID := types.UID("claim-shared")
+	mixedUID := types.UID("claim-mixed")
+	claims := []*resourceapi.ResourceClaim{
+		testClaim(exclusiveUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+		testClaim(sharedUID, testDriverName, testNodeName, map[string]int64{cpuDeviceSharedPool: 0}),
+		testClaim(mixedUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2, cpuDeviceSharedPool: 0}),
+	}
+	prepared, err := driver.PrepareResourceClaims(context.Background(), claims)
+	require.NoError(t, err)
+	require.NoError(t, prepared[exclusiveUID].Err)
+	require.Error(t, prepared[mixedUID].Err)
+
+	// the shared pool claim gets its device, without CPUs and without CDI device.
+	require.NoError(t, prepared[sharedUID].Err)
+	require.Len(t, prepared[sharedUID].Devices, 1)
+	require.Equal(t, cpuDeviceSharedPool, prepared[sharedUID].Devices[0].DeviceName)
+	require.Empty(t, prepared[sharedUID].Devices[0].CDIDeviceIDs)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(sharedUID)
+	require.False(t, ok)
+	require.NotContains(t, cdiMgr.devices, getCDIDeviceName(sharedUID))
+	require.Equal(t, topo.CPUDetails.CPUs().Size()-2, driver.cpuAllocationStore.GetSharedCPUs().Size())
+
+	unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: sharedUID}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared[sharedUID])
+	_, ok = driver.cpuAllocationStore.GetResourceClaimAllocation(exclusiveUID)
+	require.True(t, ok, "the exclusive claim must be left untouched")
+}
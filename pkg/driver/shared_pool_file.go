@@ -0,0 +1,114 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/internal/ctxlog"
+	"k8s.io/utils/cpuset"
+)
+
+// sharedPoolFile keeps the shared CPUs in a host file, in the cpulist format of sysfs (e.g. "0-1,4-7"),
+// so the host agents, like irqbalance, tuned or the monitoring, can align with the view of the driver.
+// The updates run on the allocation path and only record the shared CPUs: the file is written by run.
+type sharedPoolFile struct {
+	path    string
+	trigger chan struct{}
+
+	mu   sync.Mutex
+	cpus string
+	set  bool
+}
+
+func newSharedPoolFile(path string) *sharedPoolFile {
+	return &sharedPoolFile{
+		path:    path,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// update records the shared CPUs, and wakes up the writer if they changed.
+func (f *sharedPoolFile) update(sharedCPUs cpuset.CPUSet) {
+	if f == nil {
+		return
+	}
+	cpus := sharedCPUs.String()
+	f.mu.Lock()
+	changed := !f.set || f.cpus != cpus
+	f.cpus, f.set = cpus, true
+	f.mu.Unlock()
+	if !changed {
+		return
+	}
+	select {
+	case f.trigger <- struct{}{}:
+	default:
+		// a write is already pending, and it writes the latest CPUs.
+	}
+}
+
+// run writes the file each time the shared CPUs change, until the context is cancelled. The file is left
+// in place on the way out: the shared CPUs don't change while the driver is down.
+func (f *sharedPoolFile) run(ctx context.Context) {
+	logger := ctxlog.FromContext(ctx).WithName("sharedpoolfile")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.trigger:
+		}
+		f.mu.Lock()
+		cpus := f.cpus
+		f.mu.Unlock()
+		if err := writeFileAtomically(f.path, []byte(cpus+"\n")); err != nil {
+			logger.Error(err, "failed to write the shared pool file", "path", f.path)
+			continue
+		}
+		logger.V(4).Info("shared pool file written", "path", f.path, "sharedCPUs", cpus)
+	}
+}
+
+// writeFileAtomically replaces the file with the data through a rename, so the readers never see a
+// truncated file. The file is readable by all, as the host agents reading it may run as any user.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// after a successful rename there is nothing left to remove.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestSharedPoolFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared_pool")
+	readFile := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+
+	var disabled *sharedPoolFile
+	// a nil file is never written.
+	disabled.update(cpuset.New(0))
+
+	file := newSharedPoolFile(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		file.run(ctx)
+	}()
+
+	file.update(cpuset.New(0, 1, 4, 5, 6, 7))
+	require.Eventually(t, func() bool { return readFile() == "0-1,4-7\n" }, 5*time.Second, 10*time.Millisecond)
+	file.update(cpuset.New(0, 1))
+	require.Eventually(t, func() bool { return readFile() == "0-1\n" }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	// the file is left in place, and no temporary file is left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "0-1\n", readFile())
+}
@@ -0,0 +1,96 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestSharedPoolMonitor(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(10)
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		nodeName:           testNodeName,
+		cdiMgr:             newMockCdiMgr(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		sharedPool:         newSharedPoolMonitor(testNodeName, 4, recorder),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	// the pool keeps 6 CPUs, above the minimum.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-small", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-small"].Err)
+	require.Equal(t, 0.0, testutil.ToFloat64(sharedPoolExhausted))
+	require.Equal(t, metav1.ConditionFalse, driver.sharedPool.condition().Status)
+	require.Empty(t, recorder.Events)
+
+	// the claim reaching the minimum is still prepared.
+	exhaustions := testutil.ToFloat64(sharedPoolExhaustions)
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-large", testDriverName, testNodeName, map[string]int64{"cpudevnuma001": 2}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-large"].Err)
+	require.Equal(t, 4.0, testutil.ToFloat64(sharedCPUs))
+	require.Equal(t, 8.0, testutil.ToFloat64(nodeStatusAllocatable.WithLabelValues(testNodeName, "cpu", "core")))
+	require.Equal(t, 4.0, testutil.ToFloat64(nodeStatusRemaining.WithLabelValues(testNodeName, "cpu", "core")))
+	require.Equal(t, 1.0, testutil.ToFloat64(sharedPoolExhausted))
+	require.Equal(t, exhaustions+1, testutil.ToFloat64(sharedPoolExhaustions))
+	condition := driver.sharedPool.condition()
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Equal(t, sharedPoolExhaustedReason, condition.Reason)
+	require.Equal(t, "Warning SharedCPUPoolExhausted 4 shared CPUs left, the minimum is 4: the next claims may fail to be prepared", <-recorder.Events)
+
+	unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: types.UID("claim-large")}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared["claim-large"])
+	require.Equal(t, 0.0, testutil.ToFloat64(sharedPoolExhausted))
+	require.Equal(t, metav1.ConditionFalse, driver.sharedPool.condition().Status)
+	require.Equal(t, "Normal SharedCPUPoolRecovered 6 shared CPUs left, above the minimum of 4", <-recorder.Events)
+}
+
+func TestSharedPoolMonitorDisabled(t *testing.T) {
+	var monitor *sharedPoolMonitor
+	require.NotPanics(t, func() { monitor.update(testr.New(t), cpuset.New()) })
+}
@@ -0,0 +1,113 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"k8s.io/utils/cpuset"
+)
+
+// smallClaimMaxCPUs is the largest claim served by the free lists, skipping the topology packing.
+const smallClaimMaxCPUs = 2
+
+const (
+	smallClaimPathFreeLists = "free_lists"
+	smallClaimPathPacking   = "packing"
+)
+
+// takeSmallClaim serves the claims of up to smallClaimMaxCPUs CPUs from the free lists of the allocation store,
+// when the SmallClaimFastPath feature gate is enabled. The free lists pack the sibling threads, so the spread
+// CPU sorting strategy always runs the topology packing. Returns false if the topology packing must run instead.
+func (cp *CPUDriver) takeSmallClaim(availableCPUs cpuset.CPUSet, numCPUs int, strategy allocationStrategy) (cpuset.CPUSet, bool) {
+	if numCPUs > smallClaimMaxCPUs || !cp.FeatureEnabled(FEATURE_GATE_SMALL_CLAIM_FAST_PATH) || strategy.cpuSorting == CPU_SORTING_STRATEGY_SPREAD {
+		return cpuset.New(), false
+	}
+	cpus, ok := takeSmallClaimCPUs(cp.cpuTopology, cp.cpuAllocationStore.GetFreeCPULists(), availableCPUs, numCPUs)
+	if ok {
+		smallClaimAllocations.WithLabelValues(smallClaimPathFreeLists).Inc()
+	} else {
+		smallClaimAllocations.WithLabelValues(smallClaimPathPacking).Inc()
+	}
+	return cpus, ok
+}
+
+// takeSmallClaimCPUs picks the CPUs of a claim of up to smallClaimMaxCPUs CPUs from the free lists of the
+// uncore caches, without running the topology packing. A single CPU comes from a partially allocated core,
+// not to break a free one, and a sibling pair from a free core. Like the packing, the uncore cache with the
+// fewest free CPUs wins, to keep the others for the larger claims. Returns false if the claim can't be served
+// this way, e.g. two CPUs with no free core left, and the packing must run.
+func takeSmallClaimCPUs(topo *cpuinfo.CPUTopology, lists map[int]store.FreeCPUList, availableCPUs cpuset.CPUSet, numCPUs int) (cpuset.CPUSet, bool) {
+	if numCPUs < 1 || numCPUs > smallClaimMaxCPUs || (numCPUs == 2 && topo.CPUsPerCore() != 2) {
+		return cpuset.New(), false
+	}
+
+	bestUncoreCacheID := -1
+	var best store.FreeCPUList
+	var bestCPUs cpuset.CPUSet
+	for uncoreCacheID, list := range lists {
+		// only the CPUs available to the device, e.g. not isolated for other tiers.
+		list = store.FreeCPUList{
+			FullCores: list.FullCores.Intersection(availableCPUs),
+			Singles:   list.Singles.Intersection(availableCPUs),
+		}
+		cpus, ok := smallClaimCPUsOf(topo, list, numCPUs)
+		if !ok {
+			continue
+		}
+		if bestUncoreCacheID >= 0 && !smallClaimBetter(list, uncoreCacheID, best, bestUncoreCacheID, numCPUs) {
+			continue
+		}
+		bestUncoreCacheID, best, bestCPUs = uncoreCacheID, list, cpus
+	}
+	return bestCPUs, bestUncoreCacheID >= 0
+}
+
+// smallClaimCPUsOf picks the CPUs of the claim among the free CPUs of an uncore cache.
+func smallClaimCPUsOf(topo *cpuinfo.CPUTopology, list store.FreeCPUList, numCPUs int) (cpuset.CPUSet, bool) {
+	if numCPUs == 1 {
+		if !list.Singles.IsEmpty() {
+			return cpuset.New(list.Singles.List()[0]), true
+		}
+		if !list.FullCores.IsEmpty() {
+			return cpuset.New(list.FullCores.List()[0]), true
+		}
+		return cpuset.New(), false
+	}
+	// the available CPUs may leave a single thread of a free core.
+	for _, cpu := range list.FullCores.List() {
+		if sibling := topo.CPUDetails[cpu].SiblingCPUID; sibling > cpu && list.FullCores.Contains(sibling) {
+			return cpuset.New(cpu, sibling), true
+		}
+	}
+	return cpuset.New(), false
+}
+
+// smallClaimBetter returns true if the uncore cache a is a better fit than b for the claim: for one CPU the
+// partially allocated cores come first, then the fewest free CPUs, then the lowest ID.
+func smallClaimBetter(a store.FreeCPUList, aID int, b store.FreeCPUList, bID int, numCPUs int) bool {
+	if numCPUs == 1 {
+		aSingles, bSingles := !a.Singles.IsEmpty(), !b.Singles.IsEmpty()
+		if aSingles != bSingles {
+			return aSingles
+		}
+	}
+	if a.Size() != b.Size() {
+		return a.Size() < b.Size()
+	}
+	return aID < bID
+}
@@ -0,0 +1,227 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestTakeSmallClaimCPUs(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_2Dies_HT}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		lists         map[int]store.FreeCPUList
+		availableCPUs cpuset.CPUSet
+		numCPUs       int
+		expectedCPUs  cpuset.CPUSet
+		expectedOK    bool
+	}{
+		{
+			name: "one CPU from a partially allocated core",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(0, 4), Singles: cpuset.New()},
+				1: {FullCores: cpuset.New(2, 3, 6, 7), Singles: cpuset.New(5)},
+			},
+			availableCPUs: cpuset.New(0, 2, 3, 4, 5, 6, 7),
+			numCPUs:       1,
+			expectedCPUs:  cpuset.New(5),
+			expectedOK:    true,
+		},
+		{
+			name: "one CPU from the uncore cache with the fewest free CPUs",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(0, 1, 4, 5), Singles: cpuset.New()},
+				1: {FullCores: cpuset.New(2, 6), Singles: cpuset.New()},
+			},
+			availableCPUs: cpuset.New(0, 1, 2, 4, 5, 6),
+			numCPUs:       1,
+			expectedCPUs:  cpuset.New(2),
+			expectedOK:    true,
+		},
+		{
+			name: "two CPUs from a free core",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(1, 5), Singles: cpuset.New(4)},
+				1: {FullCores: cpuset.New(2, 3, 6, 7), Singles: cpuset.New()},
+			},
+			availableCPUs: cpuset.New(1, 2, 3, 4, 5, 6, 7),
+			numCPUs:       2,
+			expectedCPUs:  cpuset.New(1, 5),
+			expectedOK:    true,
+		},
+		{
+			name: "two CPUs skipping the free cores split by the available CPUs",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(0, 1, 4, 5), Singles: cpuset.New()},
+			},
+			availableCPUs: cpuset.New(1, 4, 5),
+			numCPUs:       2,
+			expectedCPUs:  cpuset.New(1, 5),
+			expectedOK:    true,
+		},
+		{
+			name: "two CPUs without free cores fall back to the packing",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(), Singles: cpuset.New(4, 5)},
+			},
+			availableCPUs: cpuset.New(4, 5),
+			numCPUs:       2,
+			expectedOK:    false,
+		},
+		{
+			name: "no available CPUs",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(0, 4), Singles: cpuset.New()},
+			},
+			availableCPUs: cpuset.New(),
+			numCPUs:       1,
+			expectedOK:    false,
+		},
+		{
+			name: "larger claims are not served",
+			lists: map[int]store.FreeCPUList{
+				0: {FullCores: cpuset.New(0, 1, 4, 5), Singles: cpuset.New()},
+			},
+			availableCPUs: cpuset.New(0, 1, 4, 5),
+			numCPUs:       3,
+			expectedOK:    false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cpus, ok := takeSmallClaimCPUs(topo, tc.lists, tc.availableCPUs, tc.numCPUs)
+			require.Equal(t, tc.expectedOK, ok)
+			if tc.expectedOK {
+				require.True(t, tc.expectedCPUs.Equals(cpus), "got %s", cpus)
+			}
+		})
+	}
+}
+
+func TestPrepareResourceClaimsSmallClaimFastPath(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	gates, err := newFeatureGates(knownFeatureGates, map[string]bool{string(FEATURE_GATE_SMALL_CLAIM_FAST_PATH): true})
+	require.NoError(t, err)
+
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             newMockCdiMgr(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		featureGates:       gates,
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	// the second single CPU fills the core broken by the first one, the pair takes the free core left.
+	for _, tc := range []struct {
+		claimUID     types.UID
+		numCPUs      int64
+		expectedCPUs cpuset.CPUSet
+	}{
+		{"claim-1", 1, cpuset.New(0)},
+		{"claim-2", 1, cpuset.New(4)},
+		{"claim-3", 2, cpuset.New(1, 5)},
+	} {
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(tc.claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": tc.numCPUs}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[tc.claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(tc.claimUID)
+		require.True(t, tc.expectedCPUs.Equals(gotCPUs), "claim %s: got %s", tc.claimUID, gotCPUs)
+	}
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-4", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-4"].Err)
+}
+
+// benchmarkTopology returns a busy node: 2 sockets of 32 cores with HT, 4 uncore caches per socket,
+// with the first thread of every third core allocated.
+func benchmarkTopology(b *testing.B) (*cpuinfo.CPUTopology, *store.CPUAllocation) {
+	const sockets, coresPerSocket, coresPerUncoreCache = 2, 32, 8
+	numCPUs := sockets * coresPerSocket * 2
+	var infos []cpuinfo.CPUInfo
+	for cpuID := 0; cpuID < numCPUs; cpuID++ {
+		core := cpuID % (numCPUs / 2)
+		socketID := core / coresPerSocket
+		infos = append(infos, cpuinfo.CPUInfo{
+			CpuID:         cpuID,
+			CoreID:        core % coresPerSocket,
+			SocketID:      socketID,
+			NUMANodeID:    socketID,
+			UncoreCacheID: core / coresPerUncoreCache,
+			SiblingCPUID:  (cpuID + numCPUs/2) % numCPUs,
+		})
+	}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: infos}
+	topo, err := mockProvider.GetCPUTopology(logr.Discard())
+	require.NoError(b, err)
+	allocation := store.NewCPUAllocation(topo, cpuset.New())
+	for core := 0; core < numCPUs/2; core += 3 {
+		allocation.AddResourceClaimAllocation(logr.Discard(), types.UID(fmt.Sprintf("claim-%d", core)), cpuset.New(core))
+	}
+	return topo, allocation
+}
+
+func BenchmarkSmallClaimAllocation(b *testing.B) {
+	topo, allocation := benchmarkTopology(b)
+	socketCPUs := topo.CPUDetails.CPUsInSockets(0)
+	for _, numCPUs := range []int{1, 2} {
+		b.Run(fmt.Sprintf("%d_cpus/free_lists", numCPUs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				available := allocation.GetSharedCPUs().Intersection(socketCPUs)
+				if _, ok := takeSmallClaimCPUs(topo, allocation.GetFreeCPULists(), available, numCPUs); !ok {
+					b.Fatal("no CPUs from the free lists")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%d_cpus/packing", numCPUs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				available := allocation.GetSharedCPUs().Intersection(socketCPUs)
+				if _, err := cpumanager.TakeByTopologyNUMAPacked(logr.Discard(), topo, available, numCPUs, cpumanager.CPUSortingStrategyPacked, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+)
+
+// usesSMTIsolation returns true if the claims must never share a physical core: --smt-isolation is set
+// and SMT is enabled.
+func (cp *CPUDriver) usesSMTIsolation() bool {
+	return cp.smtIsolation && cp.cpuTopology.CPUsPerCore() > 1
+}
+
+// padToFullCores returns the CPUs of a claim with the sibling threads of their physical cores, so the
+// siblings are never allocated to another claim. The reserved siblings are not claimed by anyone and are
+// left out. Returns an error if a sibling is not free.
+func (cp *CPUDriver) padToFullCores(claim *resourceapi.ResourceClaim, cpus, freeCPUs cpuset.CPUSet) (cpuset.CPUSet, error) {
+	topo := cp.cpuTopology
+	padded := cpus
+	for _, cpu := range cpus.List() {
+		info := topo.CPUDetails[cpu]
+		padded = padded.Union(topo.CPUDetails.CPUsInCores(info.CoreID).Intersection(topo.CPUDetails.CPUsInSockets(info.SocketID)))
+	}
+	siblings := padded.Difference(cpus).Difference(cp.reservedCPUs)
+	if busy := siblings.Difference(freeCPUs); !busy.IsEmpty() {
+		return cpuset.New(), fmt.Errorf("claim %s/%s can't share physical cores with other claims, but the sibling CPUs %s are allocated", claim.Namespace, claim.Name, busy.String())
+	}
+	return cpus.Union(siblings), nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsSMTIsolation(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-smt-isolation")
+
+	testCases := []struct {
+		name           string
+		smtIsolation   bool
+		fullPCPUsOnly  bool
+		allocated      cpuset.CPUSet
+		claim          *resourceapi.ResourceClaim
+		expectedCPUSet cpuset.CPUSet
+		expectedError  bool
+	}{
+		{
+			// the sibling of the CPU is padded.
+			name:           "single CPU",
+			smtIsolation:   true,
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			name:           "odd CPU count",
+			smtIsolation:   true,
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 3}),
+			expectedCPUSet: cpuset.New(0, 1, 4, 5),
+		},
+		{
+			name:           "whole cores",
+			smtIsolation:   true,
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2}),
+			expectedCPUSet: cpuset.New(0, 4),
+		},
+		{
+			// the free thread shares a core with the other claim.
+			name:          "no whole core left",
+			smtIsolation:  true,
+			allocated:     cpuset.New(0, 1, 4),
+			claim:         testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+			expectedError: true,
+		},
+		{
+			name:           "shared core without the option",
+			allocated:      cpuset.New(0, 1, 4),
+			claim:          testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+			expectedCPUSet: cpuset.New(5),
+		},
+		{
+			name:          "not padded with full-pcpus-only",
+			smtIsolation:  true,
+			fullPCPUsOnly: true,
+			claim:         testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+				cp.smtIsolation = tc.smtIsolation
+				cp.fullPCPUsOnly = tc.fullPCPUsOnly
+			})
+			if !tc.allocated.IsEmpty() {
+				driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", tc.allocated)
+			}
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{tc.claim})
+			require.NoError(t, err)
+			if tc.expectedError {
+				require.Error(t, prepared[claimUID].Err)
+				_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+				require.False(t, ok)
+				return
+			}
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestPrepareResourceClaimsSMTIsolationIndividualDevices(t *testing.T) {
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(cp *CPUDriver) {
+		cp.cpuDeviceMode = CPU_DEVICE_MODE_INDIVIDUAL
+		cp.smtIsolation = true
+	})
+	deviceNames := map[int]string{}
+	for name, cpuID := range driver.deviceNameToCPUID {
+		deviceNames[cpuID] = name
+	}
+	claimOf := func(claimUID types.UID, cpuIDs ...int) *resourceapi.ResourceClaim {
+		var results []resourceapi.DeviceRequestAllocationResult
+		for _, cpuID := range cpuIDs {
+			results = append(results, resourceapi.DeviceRequestAllocationResult{Driver: testDriverName, Pool: testNodeName, Device: deviceNames[cpuID]})
+		}
+		return testClaimWithResults(claimUID, results)
+	}
+
+	// the claim of CPU 0 is padded with its sibling 4, which the next claim can't get.
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-thread", 0),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared["claim-thread"].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-thread")
+	require.Equal(t, "0,4", gotCPUs.String())
+
+	// CPU 5 is free, but its sibling 1 is taken by the first claim in the same batch.
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		claimOf("claim-sibling", 4),
+		claimOf("claim-first", 1),
+		claimOf("claim-second", 5),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-sibling"].Err)
+	require.NoError(t, prepared["claim-first"].Err)
+	require.Error(t, prepared["claim-second"].Err)
+	_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation("claim-second")
+	require.False(t, ok)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+// usesSocketNUMAPartitions returns true if the socket devices are published with a partition per NUMA node,
+// with --socket-numa-partitions. The node device of the UMA nodes has a single NUMA node, and no partition.
+func (cp *CPUDriver) usesSocketNUMAPartitions() bool {
+	return cp.socketNUMAPartitions && cp.cpuDeviceGroupBy == GROUP_BY_SOCKET && !(cp.collapseUMADevices && cp.collapsibleUMATopology())
+}
+
+// usesNUMANodeCounters returns true if the devices consume from the counter sets of the NUMA nodes: in mixed
+// mode, and with the NUMA partitions of the socket devices.
+func (cp *CPUDriver) usesNUMANodeCounters() bool {
+	return cp.cpuDeviceMode == CPU_DEVICE_MODE_MIXED || cp.usesSocketNUMAPartitions()
+}
+
+// validateSocketNUMAPartitions checks the NUMA partitions are used in a configuration which supports them. As
+// in mixed mode, the counters are per NUMA node, so the devices must span whole NUMA nodes: the CPU tiers
+// and the CPU pools, which take CPUs out of the socket devices, are not supported.
+func (cp *CPUDriver) validateSocketNUMAPartitions() error {
+	if !cp.socketNUMAPartitions {
+		return nil
+	}
+	if cp.cpuDeviceMode != CPU_DEVICE_MODE_GROUPED || len(cp.socketDeviceModes) > 0 || cp.cpuDeviceGroupBy != GROUP_BY_SOCKET {
+		return fmt.Errorf("the NUMA partitions of the socket devices require the %s device mode on all the sockets, grouped by %s", CPU_DEVICE_MODE_GROUPED, GROUP_BY_SOCKET)
+	}
+	if len(cp.cpuTiers) > 0 || len(cp.cpuPools) > 0 {
+		return fmt.Errorf("the NUMA partitions of the socket devices can't be combined with the CPU tiers nor the CPU pools")
+	}
+	return nil
+}
+
+// socketNUMAPartitionInfos returns the NUMA partitions of the socket devices: a device per NUMA node, named
+// as with --group-by=numanode, so the claims which must fit a NUMA node can still be allocated a part of a socket.
+func (cp *CPUDriver) socketNUMAPartitionInfos() []groupedCPUDeviceInfo {
+	if !cp.usesSocketNUMAPartitions() {
+		return nil
+	}
+	var partitions []groupedCPUDeviceInfo
+	topo := cp.cpuTopology
+	for _, numaNodeID := range topo.CPUDetails.NUMANodes().List() {
+		allocatableCPUs := topo.CPUDetails.CPUsInNUMANodes(numaNodeID).Difference(cp.reservedCPUs)
+		if allocatableCPUs.IsEmpty() {
+			continue
+		}
+		// All CPUs in a NUMA node belong to the same socket.
+		partitions = append(partitions, groupedCPUDeviceInfo{
+			name:       cp.numaDeviceName(numaNodeID),
+			cpus:       allocatableCPUs,
+			socketID:   topo.CPUDetails[allocatableCPUs.List()[0]].SocketID,
+			numaNodeID: numaNodeID,
+		})
+	}
+	return partitions
+}
+
+// createSocketNUMAPartitionDevices returns the devices of the NUMA partitions, with their slice groups. Each
+// consumes all the CPUs of its NUMA node, as the socket device does, so the scheduler hands out a NUMA
+// node either through the socket device or through its partition, and never overcommits it.
+func (cp *CPUDriver) createSocketNUMAPartitionDevices() ([]resourceapi.Device, []int) {
+	var devices []resourceapi.Device
+	var groups []int
+	topo := cp.cpuTopology
+	for _, partition := range cp.socketNUMAPartitionInfos() {
+		numCPUs := int64(partition.cpus.Size())
+		attrs := map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			AttributeSocketID:   {IntValue: ptr.To(int64(partition.socketID))},
+			AttributeNUMANodeID: {IntValue: ptr.To(int64(partition.numaNodeID))},
+			AttributeSMTEnabled: {BoolValue: ptr.To(topo.SMTEnabled)},
+			AttributeNumCPUs:    {IntValue: ptr.To(numCPUs)},
+		}
+		cp.setAlignmentAttributes(attrs, partition.numaNodeID)
+		setCoreTypeAttribute(attrs, topo, partition.cpus)
+		cp.setPerformanceScoreAttribute(attrs, partition.cpus)
+		cp.setFrequencyAttributes(attrs, partition.cpus)
+		cp.setISAFeatureAttributes(attrs, partition.cpus)
+		cp.setCPUModelAttributes(attrs, partition.cpus)
+		cp.setCPUCapacityAttributes(attrs, partition.cpus)
+		cp.setNUMADistanceAttributes(attrs, partition.cpus)
+		setCacheSizeAttributes(attrs, cp.cpuTopology, partition.cpus)
+		setCPUsAttribute(attrs, partition.cpus)
+		cp.setPCIeRootsAttribute(attrs, partition.cpus.UnsortedList()...)
+		cp.setKernelFeatureAttributes(attrs)
+		cp.setBuildAttributes(attrs)
+
+		devices = append(devices, resourceapi.Device{
+			Name:       partition.name,
+			Attributes: attrs,
+			Capacity: map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+				cpuResourceQualifiedName:       {Value: *resource.NewQuantity(numCPUs, resource.DecimalSI), RequestPolicy: cp.cpuCapacityRequestPolicy()},
+				fullCoresResourceQualifiedName: {Value: *resource.NewQuantity(cp.fullCoresCapacity(partition.cpus), resource.DecimalSI), RequestPolicy: fullCoresCapacityRequestPolicy()},
+			},
+			AllowMultipleAllocations: ptr.To(true),
+			ConsumesCounters:         cp.numaNodeCounterConsumption(partition.cpus),
+			Taints:                   cp.cpuHealth.taints(partition.cpus),
+		})
+		groups = append(groups, cp.sliceGroupOf(partition.cpus))
+	}
+	return devices, groups
+}
@@ -0,0 +1,117 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+// 2 sockets, 2 NUMA nodes per socket, 2 cores per NUMA node, no SMT.
+var mockCPUInfos_DualSocket_2NUMANodesPerSocket = func() []cpuinfo.CPUInfo {
+	var infos []cpuinfo.CPUInfo
+	for cpuID := 0; cpuID < 8; cpuID++ {
+		infos = append(infos, cpuinfo.CPUInfo{CpuID: cpuID, CoreID: cpuID, SocketID: cpuID / 4, NUMANodeID: cpuID / 2, SiblingCPUID: -1})
+	}
+	return infos
+}()
+
+func newSocketNUMAPartitionsDriver(t *testing.T) *CPUDriver {
+	t.Helper()
+	return newTestDriver(t, mockCPUInfos_DualSocket_2NUMANodesPerSocket, func(driver *CPUDriver) {
+		driver.cpuDeviceGroupBy = GROUP_BY_SOCKET
+		driver.socketNUMAPartitions = true
+		driver.reservedCPUs = cpuset.New(0)
+	})
+}
+
+func TestSocketNUMAPartitionsCounters(t *testing.T) {
+	driver := newSocketNUMAPartitionsDriver(t)
+	require.NoError(t, driver.validateSocketNUMAPartitions())
+	require.True(t, driver.usesNUMANodeCounters())
+
+	require.Equal(t, []resourceapi.CounterSet{
+		{Name: "cpudevnuma000", Counters: cpusCounter(1)},
+		{Name: "cpudevnuma001", Counters: cpusCounter(2)},
+		{Name: "cpudevnuma002", Counters: cpusCounter(2)},
+		{Name: "cpudevnuma003", Counters: cpusCounter(2)},
+	}, driver.numaNodeCounterSets())
+
+	chunks := driver.createGroupedCPUDeviceSlices(testr.New(t))
+	require.Len(t, chunks, 1)
+	consumption := make(map[string][]resourceapi.DeviceCounterConsumption)
+	for _, device := range chunks[0] {
+		consumption[device.Name] = device.ConsumesCounters
+	}
+	// each socket device consumes all the CPUs of its NUMA nodes, and each partition the CPUs of its NUMA node.
+	require.Equal(t, map[string][]resourceapi.DeviceCounterConsumption{
+		"cpudevsocket000": {{CounterSet: "cpudevnuma000", Counters: cpusCounter(1)}, {CounterSet: "cpudevnuma001", Counters: cpusCounter(2)}},
+		"cpudevsocket001": {{CounterSet: "cpudevnuma002", Counters: cpusCounter(2)}, {CounterSet: "cpudevnuma003", Counters: cpusCounter(2)}},
+		"cpudevnuma000":   {{CounterSet: "cpudevnuma000", Counters: cpusCounter(1)}},
+		"cpudevnuma001":   {{CounterSet: "cpudevnuma001", Counters: cpusCounter(2)}},
+		"cpudevnuma002":   {{CounterSet: "cpudevnuma002", Counters: cpusCounter(2)}},
+		"cpudevnuma003":   {{CounterSet: "cpudevnuma003", Counters: cpusCounter(2)}},
+	}, consumption)
+}
+
+func TestPrepareResourceClaimsSocketNUMAPartitions(t *testing.T) {
+	driver := newSocketNUMAPartitionsDriver(t)
+
+	for _, tc := range []struct {
+		device     string
+		numCPUs    int64
+		deviceCPUs cpuset.CPUSet
+	}{
+		{"cpudevnuma003", 2, cpuset.New(6, 7)},
+		{"cpudevsocket000", 3, cpuset.New(1, 2, 3)},
+	} {
+		claimUID := types.UID("claim-" + tc.device)
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(claimUID, testDriverName, testNodeName, map[string]int64{tc.device: tc.numCPUs}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[claimUID].Err)
+		gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+		require.True(t, gotCPUs.Equals(tc.deviceCPUs), "device %s: got %s", tc.device, gotCPUs)
+	}
+}
+
+func TestValidateSocketNUMAPartitions(t *testing.T) {
+	driver := newSocketNUMAPartitionsDriver(t)
+	driver.cpuDeviceGroupBy = GROUP_BY_NUMA_NODE
+	require.ErrorContains(t, driver.validateSocketNUMAPartitions(), "grouped by socket")
+
+	driver.cpuDeviceGroupBy = GROUP_BY_SOCKET
+	driver.cpuTiers = map[string]cpuset.CPUSet{"gold": cpuset.New(1)}
+	require.ErrorContains(t, driver.validateSocketNUMAPartitions(), "CPU tiers")
+
+	// the UMA nodes publish no partition.
+	uma := newTestDriver(t, edgeCPUInfos(4, false), func(driver *CPUDriver) {
+		driver.cpuDeviceGroupBy = GROUP_BY_SOCKET
+		driver.socketNUMAPartitions = true
+		driver.collapseUMADevices = true
+	})
+	require.Empty(t, uma.socketNUMAPartitionInfos())
+	require.False(t, uma.usesNUMANodeCounters())
+}
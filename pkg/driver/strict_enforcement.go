@@ -0,0 +1,62 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1"
+)
+
+// errEnforcementUnavailable is returned while the CPUs of the claims with the strict enforcement can't be enforced.
+// The kubelet retries the preparation of the claims, which succeeds once the enforcement is available again.
+var errEnforcementUnavailable = errors.New("the CPUs can't be enforced")
+
+// claimUsesStrictEnforcement returns true if the claim must be prepared only when its CPUs can be enforced:
+// either --strict-enforcement is set, or its opaque configuration enables strictEnforcement.
+func (cp *CPUDriver) claimUsesStrictEnforcement(claim *resourceapi.ResourceClaim) (bool, error) {
+	if cp.strictEnforcement {
+		return true, nil
+	}
+	if claim.Status.Allocation == nil {
+		return false, nil
+	}
+	return cp.claimDeviceConfigEnables(claim, func(config DeviceConfig) bool { return config.StrictEnforcement })
+}
+
+// checkEnforcement returns why the CPUs of the claims can't be enforced, or nil if they can. Without the NRI
+// plugin the containers are not pinned and only get the CPUs of their claims in their environment, and without
+// the container updates the running containers keep their shared CPUs, overlapping with the CPUs of the claims.
+func (cp *CPUDriver) checkEnforcement() error {
+	if condition := cp.nriSupervisor.Condition(); condition.State != NRI_STATE_CONNECTED {
+		return fmt.Errorf("%w: the NRI plugin is %s: %s", errEnforcementUnavailable, condition.State, condition.Message)
+	}
+	if runtime := cp.nriSupervisor.Runtime(); !runtime.ContainerUpdates {
+		return fmt.Errorf("%w: the runtime %s %s doesn't apply the CPU updates of the running containers", errEnforcementUnavailable, runtime.Name, runtime.Version)
+	}
+	return nil
+}
+
+// checkClaimEnforcement fails the claims with the strict enforcement while their CPUs can't be enforced.
+func (cp *CPUDriver) checkClaimEnforcement(claim *resourceapi.ResourceClaim) error {
+	strict, err := cp.claimUsesStrictEnforcement(claim)
+	if err != nil || !strict {
+		return err
+	}
+	return cp.checkEnforcement()
+}
@@ -0,0 +1,107 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCheckClaimEnforcement(t *testing.T) {
+	connected := func() *nriSupervisor {
+		s := newNRISupervisor()
+		s.setCondition(NRI_STATE_CONNECTED, "Synchronized", "synchronized with the runtime")
+		return s
+	}
+	createTimePinningOnly := func() *nriSupervisor {
+		s := connected()
+		s.setRuntime(NRIRuntime{Name: "containerd", Version: "1.6.20"})
+		return s
+	}
+	testCases := []struct {
+		name              string
+		strictEnforcement bool
+		parameters        string
+		supervisor        *nriSupervisor
+		expectErr         bool
+	}{
+		{
+			name:       "not strict, NRI not connected",
+			supervisor: newNRISupervisor(),
+		},
+		{
+			name:              "strict, NRI connected",
+			strictEnforcement: true,
+			supervisor:        connected(),
+		},
+		{
+			name:              "strict, NRI not connected",
+			strictEnforcement: true,
+			supervisor:        newNRISupervisor(),
+			expectErr:         true,
+		},
+		{
+			name:              "strict, runtime without container updates",
+			strictEnforcement: true,
+			supervisor:        createTimePinningOnly(),
+			expectErr:         true,
+		},
+		{
+			name:       "strict by the device configuration, NRI not connected",
+			parameters: `{"strictEnforcement": true}`,
+			supervisor: newNRISupervisor(),
+			expectErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+				driver.strictEnforcement = tc.strictEnforcement
+				driver.nriSupervisor = tc.supervisor
+			})
+			claim := testClaim("claim-strict", testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+			if tc.parameters != "" {
+				claim = testClaimAllCPUs(claim, tc.parameters)
+			}
+			err := driver.checkClaimEnforcement(claim)
+			if tc.expectErr {
+				require.ErrorIs(t, err, errEnforcementUnavailable)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPrepareResourceClaimsStrictEnforcement(t *testing.T) {
+	claimUID := types.UID("claim-strict")
+	driver := newTestDriver(t, mockCPUInfos_DualSocket_4CPUsPerSocket_HT, func(driver *CPUDriver) {
+		driver.strictEnforcement = true
+		driver.nriSupervisor = newNRISupervisor()
+	})
+	claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+
+	result, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.ErrorIs(t, result[claimUID].Err, errEnforcementUnavailable)
+	_, allocated := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.False(t, allocated)
+}
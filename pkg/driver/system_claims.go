@@ -0,0 +1,50 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpumanager"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/cpuset"
+)
+
+// takeSystemCPUs assigns to a request of a system claim the given number of reserved CPUs of the group
+// of the allocated device. The system claims don't share their reserved CPUs with each other, but the
+// reserved CPUs are never part of the capacity of the devices, so the other claims are unaffected.
+func (cp *CPUDriver) takeSystemCPUs(logger logr.Logger, claim *resourceapi.ResourceClaim, deviceName string, deviceCPUs, assignedCPUs cpuset.CPUSet, claimCPUCount int64, numCPUs int) (cpuset.CPUSet, error) {
+	if !cp.systemClaimNamespaces.Has(claim.Namespace) {
+		return cpuset.New(), fmt.Errorf("claim %s/%s requests reserved CPUs, but its namespace is not allowed by --system-claim-namespaces", claim.Namespace, claim.Name)
+	}
+	if claimCPUCount != 0 {
+		return cpuset.New(), fmt.Errorf("reserved CPUs of device %s requested, but the request consumes %d CPUs of the capacity of the device instead of none", deviceName, claimCPUCount)
+	}
+	availableCPUs := deviceCPUs.Intersection(cp.reservedCPUs).Difference(cp.cpuAllocationStore.GetSystemClaimCPUs()).Difference(assignedCPUs)
+	if availableCPUs.Size() < numCPUs {
+		return cpuset.New(), fmt.Errorf("%d reserved CPUs of device %s requested, but only %d are available", numCPUs, deviceName, availableCPUs.Size())
+	}
+	logger.V(4).Info("reserved CPU availability", "device", deviceName, "availableCPUs", availableCPUs.String())
+	return cpumanager.TakeByTopologyNUMAPacked(logger, cp.cpuTopology, availableCPUs, numCPUs, cpumanager.CPUSortingStrategyPacked, cp.preferAlignByUncoreCache)
+}
+
+// isSystemClaimAllocation returns true if the CPUs of a claim learned from the containers are reserved CPUs,
+// so the claim is a system claim.
+func (cp *CPUDriver) isSystemClaimAllocation(cpus cpuset.CPUSet) bool {
+	return !cpus.IsEmpty() && cpus.IsSubsetOf(cp.reservedCPUs)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsSystemClaims(t *testing.T) {
+	reservedCPUs := cpuset.New(0, 4)
+	systemClaim := func(uid types.UID, namespace string, consumedCapacity map[string]int64, parameters string) *resourceapi.ResourceClaim {
+		claim := testClaimAllCPUs(testClaim(uid, testDriverName, testNodeName, consumedCapacity), parameters)
+		claim.Namespace = namespace
+		return claim
+	}
+
+	testCases := []struct {
+		name           string
+		claims         []*resourceapi.ResourceClaim
+		expectedErrors []bool
+		expectedCPUs   []cpuset.CPUSet
+	}{
+		{
+			name: "system claim gets reserved CPUs",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "kube-system", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{false},
+			expectedCPUs:   []cpuset.CPUSet{cpuset.New(0)},
+		},
+		{
+			name: "system claims don't share reserved CPUs",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "kube-system", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":1}`),
+				systemClaim("claim-2", "kube-system", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{false, false},
+			expectedCPUs:   []cpuset.CPUSet{cpuset.New(0), cpuset.New(4)},
+		},
+		{
+			name: "more reserved CPUs than available",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "kube-system", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":2}`),
+				systemClaim("claim-2", "kube-system", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{false, true},
+			expectedCPUs:   []cpuset.CPUSet{reservedCPUs},
+		},
+		{
+			name: "no reserved CPUs in the group of the device",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "kube-system", map[string]int64{"cpudevnuma001": 0}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{true},
+		},
+		{
+			name: "namespace not allowed",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "default", map[string]int64{"cpudevnuma000": 0}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{true},
+		},
+		{
+			name: "request consuming CPU capacity",
+			claims: []*resourceapi.ResourceClaim{
+				systemClaim("claim-1", "kube-system", map[string]int64{"cpudevnuma000": 1}, `{"systemCPUs":1}`),
+			},
+			expectedErrors: []bool{true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+			topo, err := mockProvider.GetCPUTopology(testr.New(t))
+			require.NoError(t, err)
+			driver := &CPUDriver{
+				driverName:            testDriverName,
+				cdiMgr:                newMockCdiMgr(),
+				cpuTopology:           topo,
+				cpuAllocationStore:    store.NewCPUAllocation(topo, reservedCPUs),
+				cpuDeviceMode:         CPU_DEVICE_MODE_GROUPED,
+				cpuDeviceGroupBy:      GROUP_BY_NUMA_NODE,
+				reservedCPUs:          reservedCPUs,
+				systemClaimNamespaces: sets.New("kube-system"),
+			}
+			driver.initializeDeviceLookupMaps()
+			sharedCPUs := driver.cpuAllocationStore.GetSharedCPUs()
+
+			for i, claim := range tc.claims {
+				prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+				require.NoError(t, err)
+				if tc.expectedErrors[i] {
+					require.Error(t, prepared[claim.UID].Err)
+					_, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claim.UID)
+					require.False(t, ok)
+					continue
+				}
+				require.NoError(t, prepared[claim.UID].Err)
+				cpus, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(claim.UID)
+				require.True(t, ok)
+				require.True(t, tc.expectedCPUs[i].Equals(cpus), "got %s, want %s", cpus, tc.expectedCPUs[i])
+			}
+			// the reserved CPUs are outside of the shared pool, which is unaffected.
+			require.True(t, sharedCPUs.Equals(driver.cpuAllocationStore.GetSharedCPUs()), "shared cpus: got %s, want %s", driver.cpuAllocationStore.GetSharedCPUs(), sharedCPUs)
+
+			// the unprepared system claims release their reserved CPUs.
+			for _, claim := range tc.claims {
+				_, err = driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claim.UID}})
+				require.NoError(t, err)
+			}
+			require.True(t, driver.cpuAllocationStore.GetSystemClaimCPUs().IsEmpty(), "got %s", driver.cpuAllocationStore.GetSystemClaimCPUs())
+		})
+	}
+}
+
+func TestNRISynchronizeSystemClaimsNRIOnly(t *testing.T) {
+	logger := testr.New(t)
+	reservedCPUs := cpuset.New(0, 4)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	// the claims prepared before the restart are only known from the checkpoint in NRI-only mode.
+	podClaims := store.NewPodClaims()
+	require.NoError(t, podClaims.Set("system-claim", cpuset.New(0), map[types.UID][]string{"pod-1": {"ctr"}}))
+	require.NoError(t, podClaims.Set("claim", cpuset.New(1, 5), map[types.UID][]string{"pod-2": {"ctr"}}))
+	driver := &CPUDriver{
+		nriOnly:            true,
+		podClaims:          podClaims,
+		podConfigStore:     store.NewPodConfig(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, reservedCPUs),
+		reservedCPUs:       reservedCPUs,
+	}
+
+	_, err = driver.Synchronize(context.Background(), nil, nil)
+	require.NoError(t, err)
+	// the reserved CPUs of the system claim are not taken from the shared pool.
+	require.True(t, cpuset.New(0).Equals(driver.cpuAllocationStore.GetSystemClaimCPUs()), "got %s", driver.cpuAllocationStore.GetSystemClaimCPUs())
+	require.Equal(t, map[types.UID]cpuset.CPUSet{"claim": cpuset.New(1, 5)}, driver.cpuAllocationStore.GetResourceClaimAllocations())
+	require.True(t, cpuset.New(2, 3, 6, 7).Equals(driver.cpuAllocationStore.GetSharedCPUs()), "got %s", driver.cpuAllocationStore.GetSharedCPUs())
+}
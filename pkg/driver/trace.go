@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// traceIDLen is the length of the trace ID generated when a claim is prepared.
+	traceIDLen = 16
+	// traceIDEnvVarPrefix is the prefix of the container environment variable carrying the trace ID of a claim.
+	// It lets the NRI hooks recover the trace ID of a claim, also across driver restarts.
+	traceIDEnvVarPrefix = "DRA_CPU_TRACE_ID"
+	// traceIDAnnotation is the annotation carrying the trace ID. It is set on the CDI device of the claim
+	// and, suffixed with the claim UID, on the containers pinned to the claim CPUs.
+	traceIDAnnotation = "dra.cpu/trace-id"
+)
+
+// traceIDEnvVar returns the environment variable carrying the trace ID of a claim.
+func traceIDEnvVar(claimUID types.UID, traceID string) string {
+	return fmt.Sprintf("%s_%s=%s", traceIDEnvVarPrefix, claimUID, traceID)
+}
+
+// traceIDContainerAnnotation returns the key of the container annotation carrying the trace ID of a claim.
+func traceIDContainerAnnotation(claimUID types.UID) string {
+	return fmt.Sprintf("%s.%s", traceIDAnnotation, claimUID)
+}
+
+// parseTraceIDEnv extracts the trace IDs of the claims from the container environment.
+func parseTraceIDEnv(envs []string) map[types.UID]string {
+	traceIDs := make(map[types.UID]string)
+	for _, env := range envs {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || value == "" {
+			continue
+		}
+		claimUID, ok := strings.CutPrefix(key, traceIDEnvVarPrefix+"_")
+		if !ok || claimUID == "" {
+			continue
+		}
+		traceIDs[types.UID(claimUID)] = value
+	}
+	return traceIDs
+}
+
+// claimTraceID returns the trace ID of the claim, preferring the one found in the container environment.
+func (cp *CPUDriver) claimTraceID(envTraceIDs map[types.UID]string, claimUID types.UID) string {
+	if traceID, ok := envTraceIDs[claimUID]; ok {
+		return traceID
+	}
+	return cp.cpuAllocationStore.GetResourceClaimTraceID(claimUID)
+}
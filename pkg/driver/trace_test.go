@@ -0,0 +1,109 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/dynamic-resource-allocation/kubeletplugin"
+	"k8s.io/utils/cpuset"
+)
+
+func TestParseTraceIDEnv(t *testing.T) {
+	envs := []string{
+		"PATH=/usr/bin",
+		fmt.Sprintf("%s_claim-a=0-1", cdiEnvVarPrefix),
+		traceIDEnvVar("claim-a", "0123456789abcdef"),
+		traceIDEnvVar("claim-b", "fedcba9876543210"),
+		traceIDEnvVarPrefix + "_claim-c=",
+		traceIDEnvVarPrefix + "_=0123456789abcdef",
+	}
+	require.Equal(t, map[types.UID]string{
+		"claim-a": "0123456789abcdef",
+		"claim-b": "fedcba9876543210",
+	}, parseTraceIDEnv(envs))
+}
+
+func TestPrepareResourceClaimsTraceID(t *testing.T) {
+	logger := testr.New(t)
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: mockCPUInfos_SingleSocket_4CPUS_HT}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	claimUID := types.UID("claim-traced")
+	cdiMgr := newMockCdiMgr()
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             cdiMgr,
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, cpuset.New()),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       cpuset.New(),
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+	claim := testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 2})
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.NoError(t, prepared[claimUID].Err)
+	traceID := driver.cpuAllocationStore.GetResourceClaimTraceID(claimUID)
+	require.Len(t, traceID, traceIDLen)
+	require.Equal(t, traceID, cdiMgr.specs[getCDIDeviceName(claimUID)].Annotations[traceIDAnnotation])
+
+	// preparing the claim again keeps the trace ID
+	prepared, err = driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{claim})
+	require.NoError(t, err)
+	require.NoError(t, prepared[claimUID].Err)
+	require.Equal(t, traceID, driver.cpuAllocationStore.GetResourceClaimTraceID(claimUID))
+
+	// the containers consuming the claim carry the same trace ID
+	pod := &api.PodSandbox{Id: "pod-id-1", Name: "my-pod", Namespace: "my-ns", Uid: "pod-uid-1"}
+	ctr := &api.Container{
+		Id:           "ctr-id-1",
+		PodSandboxId: pod.Id,
+		Name:         "my-ctr",
+		Env:          cdiMgr.specs[getCDIDeviceName(claimUID)].ContainerEdits.Env,
+	}
+	driver.podConfigStore = store.NewPodConfig()
+	driver.claimTracker = store.NewClaimTracker()
+	adjust, _, err := driver.CreateContainer(context.Background(), pod, ctr)
+	require.NoError(t, err)
+	require.Equal(t, traceID, adjust.GetAnnotations()[traceIDContainerAnnotation(claimUID)])
+
+	// and the trace ID survives the resynchronization with the runtime
+	driver.cpuAllocationStore = store.NewCPUAllocation(topo, cpuset.New())
+	_, err = driver.Synchronize(context.Background(), []*api.PodSandbox{pod}, []*api.Container{ctr})
+	require.NoError(t, err)
+	require.Equal(t, traceID, driver.cpuAllocationStore.GetResourceClaimTraceID(claimUID))
+
+	unprepared, err := driver.UnprepareResourceClaims(context.Background(), []kubeletplugin.NamespacedObject{{UID: claimUID}})
+	require.NoError(t, err)
+	require.NoError(t, unprepared[claimUID])
+	require.Empty(t, driver.cpuAllocationStore.GetResourceClaimTraceID(claimUID))
+}
@@ -0,0 +1,71 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+)
+
+// cpuDeviceNodeName is the single grouped device of the UMA nodes, whatever the group-by mode.
+const cpuDeviceNodeName = cpuDeviceNodeGroupedPrefix + "000"
+
+// isUMATopology returns true if the node has a single socket, NUMA node and die, like the small
+// edge nodes: all the group-by modes group the same CPUs and there is no NUMA locality to advertise.
+func isUMATopology(topo *cpuinfo.CPUTopology) bool {
+	if topo == nil {
+		return false
+	}
+	return topo.NumSockets == 1 && topo.NumNUMANodes == 1 && topo.NumDies == 1
+}
+
+// collapsibleUMATopology returns true if the node is UMA and the group-by mode groups all its CPUs
+// in one device: the L3 grouping of the UMA nodes with several uncore caches is still meaningful,
+// and so are the cluster, CCD and core groupings of the UMA nodes with several clusters, CCDs or cores.
+func (cp *CPUDriver) collapsibleUMATopology() bool {
+	if !isUMATopology(cp.cpuTopology) {
+		return false
+	}
+	switch cp.cpuDeviceGroupBy {
+	case GROUP_BY_L3:
+		return cp.cpuTopology.NumUncoreCache == 1
+	case GROUP_BY_CLUSTER:
+		return cp.cpuTopology.CPUDetails.ClustersInSockets(cp.cpuTopology.CPUDetails.Sockets().List()...).Size() == 1
+	case GROUP_BY_CCD:
+		return cp.cpuTopology.CPUDetails.CCDs().Size() == 1
+	case GROUP_BY_CORE:
+		return cp.cpuTopology.NumCores == 1
+	}
+	return true
+}
+
+// collapseUMADeviceInfos renames the device of the group-by mode of a UMA node to the node device.
+// Both names stay resolvable whether the devices are collapsed or not, so the claims allocated
+// before --collapse-uma-devices changed are still prepared.
+func (cp *CPUDriver) collapseUMADeviceInfos(devices []groupedCPUDeviceInfo) []groupedCPUDeviceInfo {
+	if !cp.collapsibleUMATopology() {
+		return devices
+	}
+	for i := range devices {
+		if cp.collapseUMADevices {
+			devices[i].aliases = []string{devices[i].name}
+			devices[i].name = cpuDeviceNodeName
+			continue
+		}
+		devices[i].aliases = []string{cpuDeviceNodeName}
+	}
+	return devices
+}
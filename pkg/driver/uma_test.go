@@ -0,0 +1,243 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/store"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+// edgeCPUInfos returns the topology of a small edge node: a single socket, NUMA node, die and uncore cache.
+// With SMT, the sibling of CPU i is CPU i+cores.
+func edgeCPUInfos(cores int, smt bool) []cpuinfo.CPUInfo {
+	var infos []cpuinfo.CPUInfo
+	for cpuID := 0; cpuID < cores; cpuID++ {
+		sibling := -1
+		if smt {
+			sibling = cpuID + cores
+		}
+		infos = append(infos, cpuinfo.CPUInfo{CpuID: cpuID, CoreID: cpuID, SiblingCPUID: sibling})
+	}
+	if smt {
+		for cpuID := cores; cpuID < 2*cores; cpuID++ {
+			infos = append(infos, cpuinfo.CPUInfo{CpuID: cpuID, CoreID: cpuID - cores, SiblingCPUID: cpuID - cores})
+		}
+	}
+	return infos
+}
+
+func TestIsUMATopology(t *testing.T) {
+	logger := testr.New(t)
+	testCases := []struct {
+		name     string
+		cpuInfos []cpuinfo.CPUInfo
+		expected bool
+	}{
+		{name: "edge node, 4 CPUs", cpuInfos: edgeCPUInfos(4, false), expected: true},
+		{name: "edge node, 8 CPUs with SMT", cpuInfos: edgeCPUInfos(4, true), expected: true},
+		{name: "dual socket", cpuInfos: mockCPUInfos_DualSocket_4CPUsPerSocket_HT, expected: false},
+		{name: "single socket with 2 dies", cpuInfos: mockCPUInfos_SingleSocket_2Dies_HT, expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: tc.cpuInfos}
+			topo, err := mockProvider.GetCPUTopology(logger)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, isUMATopology(topo))
+		})
+	}
+	require.False(t, isUMATopology(nil))
+}
+
+func TestCreateGroupedCPUDeviceSlicesUMA(t *testing.T) {
+	logger := testr.New(t)
+	profiles := []struct {
+		name         string
+		cpuInfos     []cpuinfo.CPUInfo
+		reservedCPUs cpuset.CPUSet
+	}{
+		{name: "4 CPUs", cpuInfos: edgeCPUInfos(4, false), reservedCPUs: cpuset.New()},
+		{name: "4 CPUs with SMT", cpuInfos: edgeCPUInfos(2, true), reservedCPUs: cpuset.New()},
+		{name: "8 CPUs with SMT", cpuInfos: edgeCPUInfos(4, true), reservedCPUs: cpuset.New()},
+		{name: "8 CPUs with SMT and a reserved core", cpuInfos: edgeCPUInfos(4, true), reservedCPUs: cpuset.New(0, 4)},
+	}
+	modeNames := map[string]string{
+		GROUP_BY_SOCKET:    "cpudevsocket000",
+		GROUP_BY_NUMA_NODE: "cpudevnuma000",
+		GROUP_BY_DIE:       "cpudevdie000",
+	}
+
+	for _, profile := range profiles {
+		for groupBy, modeName := range modeNames {
+			for _, collapse := range []bool{true, false} {
+				t.Run(fmt.Sprintf("%s/%s/collapse=%v", profile.name, groupBy, collapse), func(t *testing.T) {
+					mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: profile.cpuInfos}
+					topo, err := mockProvider.GetCPUTopology(logger)
+					require.NoError(t, err)
+					cp := &CPUDriver{
+						cpuTopology:        topo,
+						reservedCPUs:       profile.reservedCPUs,
+						cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+						cpuDeviceGroupBy:   groupBy,
+						collapseUMADevices: collapse,
+						pcieRootMapper:     store.NewPCIeRootMapper(),
+					}
+
+					deviceSlices := cp.createGroupedCPUDeviceSlices(logger)
+					require.Len(t, deviceSlices, 1)
+					require.Len(t, deviceSlices[0], 1)
+					device := deviceSlices[0][0]
+					allocatable := int64(len(profile.cpuInfos) - profile.reservedCPUs.Size())
+					require.Equal(t, allocatable, capacityValue(device, cpuResourceQualifiedName))
+					require.Equal(t, ptr.To(allocatable), device.Attributes[AttributeNumCPUs].IntValue)
+					require.Equal(t, ptr.To(topo.SMTEnabled), device.Attributes[AttributeSMTEnabled].BoolValue)
+					require.True(t, *device.AllowMultipleAllocations)
+					if !collapse {
+						require.Equal(t, modeName, device.Name)
+						return
+					}
+					require.Equal(t, cpuDeviceNodeName, device.Name)
+					require.Equal(t, ptr.To(int64(0)), device.Attributes[AttributeSocketID].IntValue)
+					for _, name := range []resourceapi.QualifiedName{AttributeNUMANodeID, AttributeDieID, "resource.kubernetes.io/numaNode", "dra.net/numaNode"} {
+						require.NotContains(t, device.Attributes, name)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestInitializeDeviceLookupMapsUMA(t *testing.T) {
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: edgeCPUInfos(4, true)}
+	topo, err := mockProvider.GetCPUTopology(testr.New(t))
+	require.NoError(t, err)
+
+	// both names resolve whether the devices are collapsed or not.
+	for _, collapse := range []bool{true, false} {
+		cp := &CPUDriver{
+			cpuTopology:        topo,
+			reservedCPUs:       cpuset.New(),
+			cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+			cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+			collapseUMADevices: collapse,
+		}
+		cp.initializeDeviceLookupMaps()
+		require.Equal(t, map[string]int{"cpudevnuma000": 0, cpuDeviceNodeName: 0}, cp.deviceNameToNUMANodeID)
+	}
+
+	// the collapsed device only publishes the socket attribute.
+	cp := &CPUDriver{cpuTopology: topo}
+	require.Empty(t, cp.verifyDeviceMapping(resourceapi.Device{
+		Name:       cpuDeviceNodeName,
+		Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{AttributeSocketID: {IntValue: ptr.To(int64(0))}},
+	}))
+}
+
+func TestPrepareResourceClaimsUMA(t *testing.T) {
+	logger := testr.New(t)
+	// 8 CPUs with SMT, CPU 0 reserved for the system.
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: edgeCPUInfos(4, true)}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	reservedCPUs := cpuset.New(0)
+
+	driver := &CPUDriver{
+		driverName:         testDriverName,
+		cdiMgr:             newMockCdiMgr(),
+		cpuTopology:        topo,
+		cpuAllocationStore: store.NewCPUAllocation(topo, reservedCPUs),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_NUMA_NODE,
+		reservedCPUs:       reservedCPUs,
+		collapseUMADevices: true,
+		podConfigStore:     store.NewPodConfig(),
+		claimTracker:       store.NewClaimTracker(),
+	}
+	driver.initializeDeviceLookupMaps()
+
+	// the claims allocated before the collapse, with the NUMA node device, share the CPUs with the new ones.
+	allocated := cpuset.New()
+	for _, tc := range []struct {
+		claimUID types.UID
+		device   string
+		numCPUs  int64
+	}{
+		{"claim-1", cpuDeviceNodeName, 2},
+		{"claim-2", "cpudevnuma000", 2},
+		{"claim-3", cpuDeviceNodeName, 3},
+	} {
+		prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+			testClaim(tc.claimUID, testDriverName, testNodeName, map[string]int64{tc.device: tc.numCPUs}),
+		})
+		require.NoError(t, err)
+		require.NoError(t, prepared[tc.claimUID].Err)
+		gotCPUs, ok := driver.cpuAllocationStore.GetResourceClaimAllocation(tc.claimUID)
+		require.True(t, ok)
+		require.Equal(t, int(tc.numCPUs), gotCPUs.Size(), "claim %s: got %s", tc.claimUID, gotCPUs)
+		require.True(t, gotCPUs.Intersection(allocated.Union(reservedCPUs)).IsEmpty(), "claim %s: got %s", tc.claimUID, gotCPUs)
+		allocated = allocated.Union(gotCPUs)
+	}
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim("claim-4", testDriverName, testNodeName, map[string]int64{cpuDeviceNodeName: 1}),
+	})
+	require.NoError(t, err)
+	require.Error(t, prepared["claim-4"].Err)
+}
+
+func TestCreateGroupedCPUDeviceSlicesUMAWithSeveralL3(t *testing.T) {
+	logger := testr.New(t)
+	// a single die with the cores split over 2 uncore caches.
+	cpuInfos := edgeCPUInfos(4, true)
+	for i := range cpuInfos {
+		cpuInfos[i].UncoreCacheID = cpuInfos[i].CoreID / 2
+	}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: cpuInfos}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+	require.True(t, isUMATopology(topo))
+
+	cp := &CPUDriver{
+		cpuTopology:        topo,
+		reservedCPUs:       cpuset.New(),
+		cpuDeviceMode:      CPU_DEVICE_MODE_GROUPED,
+		cpuDeviceGroupBy:   GROUP_BY_L3,
+		collapseUMADevices: true,
+		pcieRootMapper:     store.NewPCIeRootMapper(),
+	}
+
+	// the L3 devices are not collapsed in the node device.
+	var names []string
+	for _, chunk := range cp.createGroupedCPUDeviceSlices(logger) {
+		for _, device := range chunk {
+			names = append(names, device.Name)
+			require.Equal(t, int64(4), capacityValue(device, cpuResourceQualifiedName), "device %s", device.Name)
+			require.Contains(t, device.Attributes, AttributeCacheL3ID)
+		}
+	}
+	require.ElementsMatch(t, []string{"cpudevl3000", "cpudevl3001"}, names)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPrepareResourceClaimsPreferAlignByUncoreCache(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-uncore")
+
+	testCases := []struct {
+		name           string
+		prefer         bool
+		expectedCPUSet cpuset.CPUSet
+	}{
+		{
+			// the free uncore cache fits the request.
+			name:           "aligned by uncore cache",
+			prefer:         true,
+			expectedCPUSet: cpuset.New(2, 3, 6, 7),
+		},
+		{
+			// the cores are packed, spanning both uncore caches.
+			name:           "not aligned",
+			expectedCPUSet: cpuset.New(1, 2, 5, 6),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := newTestDriver(t, mockCPUInfos_SingleSocket_2Dies_HT, func(cp *CPUDriver) {
+				cp.preferAlignByUncoreCache = tc.prefer
+			})
+			// a core of the first uncore cache is allocated.
+			driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", cpuset.New(0, 4))
+
+			prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+				testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 4}),
+			})
+			require.NoError(t, err)
+			require.NoError(t, prepared[claimUID].Err)
+			gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+			require.Equal(t, tc.expectedCPUSet.String(), gotCPUs.String())
+		})
+	}
+}
+
+func TestPrepareResourceClaimsPreferBrokenCores(t *testing.T) {
+	logger := testr.New(t)
+	claimUID := types.UID("claim-broken-core")
+
+	driver := newTestDriver(t, mockCPUInfos_SingleSocket_2Dies_HT)
+	// the core 1,5 is broken by another claim.
+	driver.cpuAllocationStore.AddResourceClaimAllocation(logger, "claim-other", cpuset.New(1))
+
+	prepared, err := driver.PrepareResourceClaims(context.Background(), []*resourceapi.ResourceClaim{
+		testClaim(claimUID, testDriverName, testNodeName, map[string]int64{"cpudevnuma000": 1}),
+	})
+	require.NoError(t, err)
+	require.NoError(t, prepared[claimUID].Err)
+	gotCPUs, _ := driver.cpuAllocationStore.GetResourceClaimAllocation(claimUID)
+	require.Equal(t, "5", gotCPUs.String())
+}
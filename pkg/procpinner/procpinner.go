@@ -0,0 +1,196 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package procpinner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// ProcRoot is the default procfs mount point. The driver must run in the
+	// host PID namespace for it to expose the host processes.
+	ProcRoot = "/proc"
+	// DefaultInterval is the default period between two pinning passes.
+	DefaultInterval = time.Minute
+)
+
+// Pinner sets the CPU affinity of all the tasks of the matching processes to the given CPUs.
+// Processes are matched either by the systemd unit they belong to, or by their command name.
+type Pinner struct {
+	procRoot     string
+	cpus         cpuset.CPUSet
+	systemdUnits sets.Set[string]
+	commNames    sets.Set[string]
+	// setAffinity is replaceable for testing purposes.
+	setAffinity func(tid int, cpus cpuset.CPUSet) error
+}
+
+// New creates a Pinner. Systemd unit names without a type suffix are assumed to be services.
+func New(procRoot string, cpus cpuset.CPUSet, systemdUnits, commNames []string) *Pinner {
+	units := sets.New[string]()
+	for _, unit := range systemdUnits {
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+		units.Insert(unit)
+	}
+	return &Pinner{
+		procRoot:     procRoot,
+		cpus:         cpus,
+		systemdUnits: units,
+		commNames:    sets.New(commNames...),
+		setAffinity:  schedSetAffinity,
+	}
+}
+
+// Run pins the matching processes immediately and then every interval, until the context is done.
+func (p *Pinner) Run(ctx context.Context, logger logr.Logger, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(context.Context) {
+		pinned, err := p.PinOnce(logger)
+		if err != nil {
+			logger.Error(err, "failed to pin host processes to reserved CPUs")
+			return
+		}
+		logger.V(4).Info("pinned host processes to reserved CPUs", "tasks", pinned, "cpus", p.cpus.String())
+	}, interval)
+}
+
+// PinOnce scans the procfs once and pins all the tasks of the matching processes.
+// Processes which vanish during the scan are ignored. Returns the number of tasks pinned.
+func (p *Pinner) PinOnce(logger logr.Logger) (int, error) {
+	entries, err := os.ReadDir(p.procRoot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list processes in %q: %w", p.procRoot, err)
+	}
+	pinned := 0
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // not a process
+		}
+		if !p.matches(pid) {
+			continue
+		}
+		pLogger := logger.WithValues("pid", pid)
+		tids, err := p.tasks(pid)
+		if err != nil {
+			pLogger.V(4).Info("cannot list process tasks", "err", err)
+			continue
+		}
+		for _, tid := range tids {
+			err := p.setAffinity(tid, p.cpus)
+			if errors.Is(err, unix.ESRCH) {
+				continue // task exited meanwhile
+			}
+			if err != nil {
+				// some tasks, like per-CPU kernel threads, can't be moved. Not fatal.
+				pLogger.V(2).Info("cannot set task affinity", "tid", tid, "err", err)
+				continue
+			}
+			pinned++
+		}
+	}
+	return pinned, nil
+}
+
+func (p *Pinner) matches(pid int) bool {
+	if p.commNames.Len() > 0 {
+		comm, err := os.ReadFile(filepath.Join(p.procRoot, strconv.Itoa(pid), "comm"))
+		if err == nil && p.commNames.Has(strings.TrimSpace(string(comm))) {
+			return true
+		}
+	}
+	if p.systemdUnits.Len() > 0 {
+		unit, err := p.systemdUnit(pid)
+		if err == nil && p.systemdUnits.Has(unit) {
+			return true
+		}
+	}
+	return false
+}
+
+// systemdUnit returns the innermost systemd unit the process belongs to, reading its cgroup path.
+// Works with both cgroup v1 (name=systemd hierarchy) and cgroup v2 (unified hierarchy).
+func (p *Pinner) systemdUnit(pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// format: hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] != "" && fields[1] != "name=systemd" {
+			continue
+		}
+		components := strings.Split(fields[2], "/")
+		for i := len(components) - 1; i >= 0; i-- {
+			if isSystemdUnit(components[i]) {
+				return components[i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no systemd unit found for pid %d", pid)
+}
+
+func isSystemdUnit(name string) bool {
+	for _, suffix := range []string{".service", ".scope", ".socket"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pinner) tasks(pid int) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(p.procRoot, strconv.Itoa(pid), "task"))
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+func schedSetAffinity(tid int, cpus cpuset.CPUSet) error {
+	var mask unix.CPUSet
+	for _, cpu := range cpus.UnsortedList() {
+		mask.Set(cpu)
+	}
+	return unix.SchedSetaffinity(tid, &mask)
+}
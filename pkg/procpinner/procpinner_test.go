@@ -0,0 +1,117 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package procpinner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"k8s.io/utils/cpuset"
+)
+
+type fakeProcess struct {
+	pid    int
+	comm   string
+	cgroup string
+	tids   []int
+}
+
+func makeFakeProcfs(t *testing.T, procs []fakeProcess) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, proc := range procs {
+		procDir := filepath.Join(root, strconv.Itoa(proc.pid))
+		for _, tid := range proc.tids {
+			require.NoError(t, os.MkdirAll(filepath.Join(procDir, "task", strconv.Itoa(tid)), 0755))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, "comm"), []byte(proc.comm+"\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, "cgroup"), []byte(proc.cgroup), 0644))
+	}
+	// non-process entries must be skipped
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys"), 0755))
+	return root
+}
+
+func TestPinOnce(t *testing.T) {
+	procs := []fakeProcess{
+		{pid: 100, comm: "sshd", cgroup: "0::/system.slice/sshd.service\n", tids: []int{100}},
+		{pid: 200, comm: "chronyd", cgroup: "0::/system.slice/chronyd.service\n", tids: []int{200, 201}},
+		{pid: 300, comm: "irqbalance", cgroup: "0::/system.slice/irqbalance.service\n", tids: []int{300}},
+		{pid: 400, comm: "journald", cgroup: "12:cpuset:/\n1:name=systemd:/system.slice/systemd-journald.service\n", tids: []int{400}},
+		{pid: 500, comm: "gone", cgroup: "0::/system.slice/gone.service\n", tids: []int{500}},
+	}
+
+	testCases := []struct {
+		name         string
+		systemdUnits []string
+		commNames    []string
+		expectedTIDs []int
+	}{
+		{
+			name:         "nothing configured",
+			expectedTIDs: []int{},
+		},
+		{
+			name:         "by comm name",
+			commNames:    []string{"irqbalance"},
+			expectedTIDs: []int{300},
+		},
+		{
+			name:         "by systemd unit, cgroup v2 and v1",
+			systemdUnits: []string{"chronyd", "systemd-journald.service"},
+			expectedTIDs: []int{200, 201, 400},
+		},
+		{
+			name:         "vanished tasks are skipped",
+			systemdUnits: []string{"sshd"},
+			commNames:    []string{"gone"},
+			expectedTIDs: []int{100},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cpus := cpuset.New(0, 1)
+			pinner := New(makeFakeProcfs(t, procs), cpus, tc.systemdUnits, tc.commNames)
+			gotTIDs := []int{}
+			pinner.setAffinity = func(tid int, got cpuset.CPUSet) error {
+				if tid == 500 {
+					return unix.ESRCH
+				}
+				require.True(t, cpus.Equals(got))
+				gotTIDs = append(gotTIDs, tid)
+				return nil
+			}
+
+			pinned, err := pinner.PinOnce(testr.New(t))
+			require.NoError(t, err)
+			require.ElementsMatch(t, tc.expectedTIDs, gotTIDs)
+			require.Equal(t, len(tc.expectedTIDs), pinned)
+		})
+	}
+}
+
+func TestPinOnceMissingProcfs(t *testing.T) {
+	pinner := New(filepath.Join(t.TempDir(), "missing"), cpuset.New(0), nil, []string{"sshd"})
+	_, err := pinner.PinOnce(testr.New(t))
+	require.Error(t, err)
+}
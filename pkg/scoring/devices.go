@@ -0,0 +1,122 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scoring decodes the CPU devices published by the driver in the ResourceSlices and scores
+// them, for the scheduler score extensions. It depends only on the Kubernetes API types.
+package scoring
+
+import (
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/utils/ptr"
+)
+
+// The attributes and capacities published by the driver.
+const (
+	AttributeNUMANodeID resourceapi.QualifiedName = "dra.cpu/numaNodeID"
+	AttributeSocketID   resourceapi.QualifiedName = "dra.cpu/socketID"
+	AttributeDieID      resourceapi.QualifiedName = "dra.cpu/dieID"
+	AttributeClusterID  resourceapi.QualifiedName = "dra.cpu/clusterID"
+	AttributeSMTEnabled resourceapi.QualifiedName = "dra.cpu/smtEnabled"
+	AttributeCacheL3ID  resourceapi.QualifiedName = "dra.cpu/cacheL3ID"
+	AttributeCCDID      resourceapi.QualifiedName = "dra.cpu/ccdID"
+	AttributeCoreType   resourceapi.QualifiedName = "dra.cpu/coreType"
+	AttributeCoreID     resourceapi.QualifiedName = "dra.cpu/coreID"
+	AttributeCPUID      resourceapi.QualifiedName = "dra.cpu/cpuID"
+	AttributeNumCPUs    resourceapi.QualifiedName = "dra.cpu/numCPUs"
+	AttributeCPUTier    resourceapi.QualifiedName = "dra.cpu/tier"
+
+	CapacityCPU       resourceapi.QualifiedName = "dra.cpu/cpu"
+	CapacityFullCores resourceapi.QualifiedName = "dra.cpu/fullCores"
+)
+
+// Device is a CPU device decoded from a ResourceSlice. The topology attributes a device
+// does not publish are nil: for example the devices grouped by socket have no NUMA node,
+// and the single device of the UMA nodes has only the socket.
+type Device struct {
+	Name     string
+	Pool     string
+	NodeName string
+	// NumCPUs is the cpu capacity of the grouped devices, and 1 for the individual devices.
+	NumCPUs int64
+	// FullCores is the whole cores capacity of the grouped devices, 0 if not published.
+	FullCores  int64
+	SocketID   *int64
+	NUMANodeID *int64
+	DieID      *int64
+	ClusterID  *int64
+	CacheL3ID  *int64
+	CCDID      *int64
+	CoreID     *int64
+	CPUID      *int64
+	CoreType   string
+	// Tier is the operator-defined CPU tier of the device, empty if none.
+	Tier       string
+	SMTEnabled bool
+}
+
+// Grouped returns true if the device groups several CPUs, false if it is a single CPU.
+func (d Device) Grouped() bool {
+	return d.CPUID == nil
+}
+
+// DecodeResourceSlice decodes the devices of a ResourceSlice published by the driver, or returns
+// nil if the slice belongs to another driver. The attributes with an unexpected type are ignored.
+func DecodeResourceSlice(slice *resourceapi.ResourceSlice, driverName string) []Device {
+	if slice == nil || slice.Spec.Driver != driverName {
+		return nil
+	}
+	devices := make([]Device, 0, len(slice.Spec.Devices))
+	for _, dev := range slice.Spec.Devices {
+		devices = append(devices, decodeDevice(dev, slice.Spec.Pool.Name, ptr.Deref(slice.Spec.NodeName, "")))
+	}
+	return devices
+}
+
+func decodeDevice(dev resourceapi.Device, pool, nodeName string) Device {
+	d := Device{
+		Name:       dev.Name,
+		Pool:       pool,
+		NodeName:   nodeName,
+		SocketID:   intAttribute(dev, AttributeSocketID),
+		NUMANodeID: intAttribute(dev, AttributeNUMANodeID),
+		DieID:      intAttribute(dev, AttributeDieID),
+		ClusterID:  intAttribute(dev, AttributeClusterID),
+		CacheL3ID:  intAttribute(dev, AttributeCacheL3ID),
+		CCDID:      intAttribute(dev, AttributeCCDID),
+		CoreID:     intAttribute(dev, AttributeCoreID),
+		CPUID:      intAttribute(dev, AttributeCPUID),
+		CoreType:   ptr.Deref(dev.Attributes[AttributeCoreType].StringValue, ""),
+		Tier:       ptr.Deref(dev.Attributes[AttributeCPUTier].StringValue, ""),
+		SMTEnabled: ptr.Deref(dev.Attributes[AttributeSMTEnabled].BoolValue, false),
+	}
+	if capacity, ok := dev.Capacity[CapacityCPU]; ok {
+		d.NumCPUs = capacity.Value.Value()
+	} else if d.CPUID != nil {
+		d.NumCPUs = 1
+	}
+	if capacity, ok := dev.Capacity[CapacityFullCores]; ok {
+		d.FullCores = capacity.Value.Value()
+	}
+	return d
+}
+
+func intAttribute(dev resourceapi.Device, name resourceapi.QualifiedName) *int64 {
+	attr, ok := dev.Attributes[name]
+	if !ok || attr.IntValue == nil {
+		return nil
+	}
+	return ptr.To(*attr.IntValue)
+}
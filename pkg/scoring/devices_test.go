@@ -0,0 +1,90 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	resourceapi "k8s.io/api/resource/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+func TestDecodeResourceSlice(t *testing.T) {
+	slice := &resourceapi.ResourceSlice{
+		Spec: resourceapi.ResourceSliceSpec{
+			Driver:   "dra.cpu",
+			Pool:     resourceapi.ResourcePool{Name: "node-a"},
+			NodeName: ptr.To("node-a"),
+			Devices: []resourceapi.Device{
+				{
+					Name: "cpudevnuma001",
+					Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+						AttributeNUMANodeID: {IntValue: ptr.To(int64(1))},
+						AttributeSocketID:   {IntValue: ptr.To(int64(0))},
+						AttributeSMTEnabled: {BoolValue: ptr.To(true)},
+						AttributeCPUTier:    {StringValue: ptr.To("gold")},
+						// mistyped attributes are ignored.
+						AttributeDieID: {StringValue: ptr.To("0")},
+					},
+					Capacity: map[resourceapi.QualifiedName]resourceapi.DeviceCapacity{
+						CapacityCPU:       {Value: *resource.NewQuantity(8, resource.DecimalSI)},
+						CapacityFullCores: {Value: *resource.NewQuantity(4, resource.DecimalSI)},
+					},
+				},
+				{
+					Name: "cpudev003",
+					Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+						AttributeCPUID:    {IntValue: ptr.To(int64(3))},
+						AttributeCoreID:   {IntValue: ptr.To(int64(1))},
+						AttributeCoreType: {StringValue: ptr.To("p-core")},
+					},
+				},
+			},
+		},
+	}
+
+	devices := DecodeResourceSlice(slice, "dra.cpu")
+	require.Equal(t, []Device{
+		{
+			Name:       "cpudevnuma001",
+			Pool:       "node-a",
+			NodeName:   "node-a",
+			NumCPUs:    8,
+			FullCores:  4,
+			SocketID:   ptr.To(int64(0)),
+			NUMANodeID: ptr.To(int64(1)),
+			Tier:       "gold",
+			SMTEnabled: true,
+		},
+		{
+			Name:     "cpudev003",
+			Pool:     "node-a",
+			NodeName: "node-a",
+			NumCPUs:  1,
+			CoreID:   ptr.To(int64(1)),
+			CPUID:    ptr.To(int64(3)),
+			CoreType: "p-core",
+		},
+	}, devices)
+	require.True(t, devices[0].Grouped())
+	require.False(t, devices[1].Grouped())
+
+	require.Nil(t, DecodeResourceSlice(slice, "other.driver"))
+	require.Nil(t, DecodeResourceSlice(nil, "dra.cpu"))
+}
@@ -0,0 +1,83 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+)
+
+// LocalityScore scores how local the devices of an allocation are, from 0 to 1: 1 when they
+// are all in the same NUMA node, and 1/n when they span n NUMA nodes. The devices with no NUMA
+// node count by socket, and the devices with neither as a single domain. No devices scores 0.
+func LocalityScore(devices []Device) float64 {
+	if len(devices) == 0 {
+		return 0
+	}
+	domains := sets.New[string]()
+	for _, d := range devices {
+		domains.Insert(localityDomain(d))
+	}
+	return 1 / float64(domains.Len())
+}
+
+func localityDomain(d Device) string {
+	switch {
+	case d.NUMANodeID != nil:
+		return fmt.Sprintf("numa%d", *d.NUMANodeID)
+	case d.SocketID != nil:
+		return fmt.Sprintf("socket%d", *d.SocketID)
+	}
+	return "node"
+}
+
+// FragmentationScore scores how much taking the requested CPUs out of the available CPUs of
+// a grouped device fragments it, from 0 to 1: 0 when the request takes all the available CPUs,
+// growing with the share of the device left over. The best fit has the lowest score. The last
+// return value is false if the request does not fit.
+func FragmentationScore(device Device, availableCPUs, requestedCPUs int64) (float64, bool) {
+	if requestedCPUs <= 0 || requestedCPUs > availableCPUs || availableCPUs > device.NumCPUs {
+		return 0, false
+	}
+	return float64(availableCPUs-requestedCPUs) / float64(device.NumCPUs), true
+}
+
+// SplitCoresScore scores how many cores the individual devices of an allocation share with
+// other allocations, from 0 to 1: 0 when the devices take whole cores, 1 when no core is whole.
+// cpusPerCore is the number of CPUs per core of the node. The grouped devices are ignored.
+func SplitCoresScore(devices []Device, cpusPerCore int) float64 {
+	cpusOfCore := map[string]int{}
+	for _, d := range devices {
+		if d.Grouped() || d.CoreID == nil {
+			continue
+		}
+		// the core IDs are unique within a socket only.
+		cpusOfCore[fmt.Sprintf("%d/%d", ptr.Deref(d.SocketID, 0), *d.CoreID)]++
+	}
+	if len(cpusOfCore) == 0 || cpusPerCore <= 1 {
+		return 0
+	}
+	split := 0
+	for _, cpus := range cpusOfCore {
+		if cpus < cpusPerCore {
+			split++
+		}
+	}
+	return float64(split) / float64(len(cpusOfCore))
+}
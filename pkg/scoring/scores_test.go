@@ -0,0 +1,98 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func cpuDevice(socketID, numaNodeID, coreID, cpuID int64) Device {
+	return Device{
+		NumCPUs:    1,
+		SocketID:   ptr.To(socketID),
+		NUMANodeID: ptr.To(numaNodeID),
+		CoreID:     ptr.To(coreID),
+		CPUID:      ptr.To(cpuID),
+	}
+}
+
+func TestLocalityScore(t *testing.T) {
+	testCases := []struct {
+		name     string
+		devices  []Device
+		expected float64
+	}{
+		{name: "no devices", expected: 0},
+		{name: "single NUMA node", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(0, 0, 1, 1)}, expected: 1},
+		{name: "two NUMA nodes", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(0, 1, 2, 2)}, expected: 0.5},
+		{name: "two sockets", devices: []Device{{SocketID: ptr.To(int64(0))}, {SocketID: ptr.To(int64(1))}}, expected: 0.5},
+		{name: "UMA node device", devices: []Device{{Name: "cpudevnode000"}}, expected: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.InDelta(t, tc.expected, LocalityScore(tc.devices), 1e-9)
+		})
+	}
+}
+
+func TestFragmentationScore(t *testing.T) {
+	device := Device{Name: "cpudevnuma000", NumCPUs: 8}
+	testCases := []struct {
+		name          string
+		availableCPUs int64
+		requestedCPUs int64
+		expected      float64
+		expectedFit   bool
+	}{
+		{name: "exact fit", availableCPUs: 4, requestedCPUs: 4, expected: 0, expectedFit: true},
+		{name: "half left over", availableCPUs: 8, requestedCPUs: 4, expected: 0.5, expectedFit: true},
+		{name: "does not fit", availableCPUs: 2, requestedCPUs: 4},
+		{name: "nothing requested", availableCPUs: 2},
+		{name: "more available than the device", availableCPUs: 9, requestedCPUs: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			score, fit := FragmentationScore(device, tc.availableCPUs, tc.requestedCPUs)
+			require.Equal(t, tc.expectedFit, fit)
+			require.InDelta(t, tc.expected, score, 1e-9)
+		})
+	}
+}
+
+func TestSplitCoresScore(t *testing.T) {
+	testCases := []struct {
+		name        string
+		devices     []Device
+		cpusPerCore int
+		expected    float64
+	}{
+		{name: "whole core", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(0, 0, 0, 4)}, cpusPerCore: 2, expected: 0},
+		{name: "two halves", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(0, 0, 1, 1)}, cpusPerCore: 2, expected: 1},
+		{name: "same core ID on two sockets", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(1, 1, 0, 2)}, cpusPerCore: 2, expected: 1},
+		{name: "whole and half core", devices: []Device{cpuDevice(0, 0, 0, 0), cpuDevice(0, 0, 0, 4), cpuDevice(0, 0, 1, 1)}, cpusPerCore: 2, expected: 0.5},
+		{name: "no SMT", devices: []Device{cpuDevice(0, 0, 0, 0)}, cpusPerCore: 1, expected: 0},
+		{name: "grouped devices", devices: []Device{{Name: "cpudevnuma000", NumCPUs: 4}}, cpusPerCore: 2, expected: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.InDelta(t, tc.expected, SplitCoresScore(tc.devices, tc.cpusPerCore), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"maps"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClaimTiers tracks the isolation tier of the prepared claims, taken from
+// the labels of the pods the claims are reserved for.
+type ClaimTiers struct {
+	mu    sync.RWMutex
+	tiers map[types.UID]string
+}
+
+// NewClaimTiers creates a new ClaimTiers.
+func NewClaimTiers() *ClaimTiers {
+	return &ClaimTiers{
+		tiers: make(map[types.UID]string),
+	}
+}
+
+// Set records the tier of the claim. An empty tier forgets the claim.
+func (ct *ClaimTiers) Set(claimUID types.UID, tier string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if tier == "" {
+		delete(ct.tiers, claimUID)
+		return
+	}
+	ct.tiers[claimUID] = tier
+}
+
+// Get returns the tier of the claim, or empty if it has none.
+func (ct *ClaimTiers) Get(claimUID types.UID) string {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.tiers[claimUID]
+}
+
+// Remove forgets the claim.
+func (ct *ClaimTiers) Remove(claimUID types.UID) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	delete(ct.tiers, claimUID)
+}
+
+// All returns a copy of the tiers of all the claims.
+func (ct *ClaimTiers) All() map[types.UID]string {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return maps.Clone(ct.tiers)
+}
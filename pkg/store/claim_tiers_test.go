@@ -0,0 +1,39 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestClaimTiers(t *testing.T) {
+	ct := NewClaimTiers()
+	ct.Set("claim-a", "noisy")
+	ct.Set("claim-b", "sensitive")
+	ct.Set("claim-c", "")
+
+	require.Equal(t, "noisy", ct.Get("claim-a"))
+	require.Empty(t, ct.Get("claim-c"))
+	require.Equal(t, map[types.UID]string{"claim-a": "noisy", "claim-b": "sensitive"}, ct.All())
+
+	ct.Remove("claim-a")
+	ct.Set("claim-b", "")
+	require.Empty(t, ct.All())
+}
@@ -17,11 +17,13 @@ limitations under the License.
 package store
 
 import (
+	"maps"
 	"sync"
 
 	"github.com/go-logr/logr"
 	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/utils/cpuset"
 )
 
@@ -32,6 +34,43 @@ type CPUAllocation struct {
 	reservedCPUs             cpuset.CPUSet
 	resourceClaimAllocations map[types.UID]cpuset.CPUSet
 	allocatedCPUs            cpuset.CPUSet
+	// systemClaimAllocations are the resource claims allocated reserved CPUs. They are tracked apart,
+	// so they never change the allocated and the shared CPUs.
+	systemClaimAllocations map[types.UID]cpuset.CPUSet
+	// traceIDs correlate all the operations done on behalf of a resource claim allocation.
+	traceIDs map[types.UID]string
+	// cpuQuotaDisabled are the resource claims whose containers run without CPU quota.
+	cpuQuotaDisabled sets.Set[types.UID]
+	// numaBalancingDisabled are the resource claims whose containers have their memory confined to the NUMA nodes of their CPUs.
+	numaBalancingDisabled sets.Set[types.UID]
+	// fullCores are the resource claims allocated whole cores, consuming the full cores capacity.
+	fullCores sets.Set[types.UID]
+	// borrowing are the resource claims whose containers also run on the shared CPUs, until they are allocated.
+	borrowing sets.Set[types.UID]
+	// fractionalClaims are the resource claims consuming a fraction of the CPUs of a device, on its shared CPUs.
+	fractionalClaims map[types.UID]FractionalClaim
+	// freeLists index the free CPUs by uncore cache and core state, for the small allocations.
+	freeLists *freeLists
+	// preparedResults are the outcomes of the preparation of the resource claims, replayed when the kubelet
+	// prepares them again.
+	preparedResults map[types.UID]PreparedResult
+}
+
+// PreparedResult is the outcome of the preparation of a resource claim allocation.
+type PreparedResult struct {
+	// AllocationKey identifies the devices allocated to the claim when it was prepared.
+	AllocationKey string
+	// CDIDeviceIDs are the CDI devices reported back to the kubelet, if any.
+	CDIDeviceIDs []string
+}
+
+// FractionalClaim is a resource claim consuming a fraction of the CPUs of a device. It allocates no CPU:
+// its containers run on the shared CPUs of the device, limited to the millicores.
+type FractionalClaim struct {
+	// MilliCPUs is the consumed CPU capacity, in millicores.
+	MilliCPUs int64
+	// CPUs are the CPUs of the device, whose shared ones the containers run on.
+	CPUs cpuset.CPUSet
 }
 
 // NewCPUAllocation creates a new CPUAllocation.
@@ -48,6 +87,15 @@ func NewCPUAllocation(cpuTopology *cpuinfo.CPUTopology, reservedCPUs cpuset.CPUS
 		reservedCPUs:             reservedCPUs,
 		resourceClaimAllocations: make(map[types.UID]cpuset.CPUSet),
 		allocatedCPUs:            cpuset.New(),
+		systemClaimAllocations:   make(map[types.UID]cpuset.CPUSet),
+		traceIDs:                 make(map[types.UID]string),
+		cpuQuotaDisabled:         sets.New[types.UID](),
+		numaBalancingDisabled:    sets.New[types.UID](),
+		fullCores:                sets.New[types.UID](),
+		borrowing:                sets.New[types.UID](),
+		fractionalClaims:         make(map[types.UID]FractionalClaim),
+		freeLists:                newFreeLists(cpuTopology, availableCPUs),
+		preparedResults:          make(map[types.UID]PreparedResult),
 	}
 }
 
@@ -55,11 +103,14 @@ func NewCPUAllocation(cpuTopology *cpuinfo.CPUTopology, reservedCPUs cpuset.CPUS
 func (s *CPUAllocation) AddResourceClaimAllocation(logger logr.Logger, claimUID types.UID, cpus cpuset.CPUSet) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	changed := cpus
 	if old, ok := s.resourceClaimAllocations[claimUID]; ok {
 		s.allocatedCPUs = s.allocatedCPUs.Difference(old)
+		changed = changed.Union(old)
 	}
 	s.resourceClaimAllocations[claimUID] = cpus
 	s.allocatedCPUs = s.allocatedCPUs.Union(cpus)
+	s.freeLists.update(changed, s.availableCPUs.Difference(s.allocatedCPUs))
 	logger.Info("added allocation for resource claim", "cpus", cpus.String())
 }
 
@@ -67,9 +118,24 @@ func (s *CPUAllocation) AddResourceClaimAllocation(logger logr.Logger, claimUID
 func (s *CPUAllocation) RemoveResourceClaimAllocation(logger logr.Logger, claimUID types.UID) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	delete(s.traceIDs, claimUID)
+	delete(s.preparedResults, claimUID)
+	if cpus, ok := s.systemClaimAllocations[claimUID]; ok {
+		delete(s.systemClaimAllocations, claimUID)
+		logger.Info("removed system allocation for resource claim", "cpus", cpus.String())
+	}
+	s.cpuQuotaDisabled.Delete(claimUID)
+	s.numaBalancingDisabled.Delete(claimUID)
+	s.fullCores.Delete(claimUID)
+	s.borrowing.Delete(claimUID)
+	if claim, ok := s.fractionalClaims[claimUID]; ok {
+		delete(s.fractionalClaims, claimUID)
+		logger.Info("removed fractional allocation for resource claim", "milliCPUs", claim.MilliCPUs, "cpus", claim.CPUs.String())
+	}
 	if cpus, ok := s.resourceClaimAllocations[claimUID]; ok {
 		delete(s.resourceClaimAllocations, claimUID)
 		s.allocatedCPUs = s.allocatedCPUs.Difference(cpus)
+		s.freeLists.update(cpus, s.availableCPUs.Difference(s.allocatedCPUs))
 		logger.Info("removed allocation for resource claim")
 	}
 }
@@ -81,10 +147,164 @@ func (s *CPUAllocation) GetSharedCPUs() cpuset.CPUSet {
 	return s.availableCPUs.Difference(s.allocatedCPUs)
 }
 
-// GetResourceClaimAllocation returns the cpuset for a given resource claim.
+// GetResourceClaimAllocation returns the cpuset for a given resource claim, including the system claims.
 func (s *CPUAllocation) GetResourceClaimAllocation(claimUID types.UID) (cpuset.CPUSet, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if cpus, ok := s.systemClaimAllocations[claimUID]; ok {
+		return cpus, true
+	}
 	cpus, ok := s.resourceClaimAllocations[claimUID]
 	return cpus, ok
 }
+
+// AddSystemClaimAllocation adds the allocation of reserved CPUs of a system claim to the store.
+func (s *CPUAllocation) AddSystemClaimAllocation(logger logr.Logger, claimUID types.UID, cpus cpuset.CPUSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.systemClaimAllocations[claimUID] = cpus
+	logger.Info("added system allocation for resource claim", "cpus", cpus.String())
+}
+
+// GetSystemClaimCPUs returns the reserved CPUs allocated to the system claims.
+func (s *CPUAllocation) GetSystemClaimCPUs() cpuset.CPUSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cpus := cpuset.New()
+	for _, claimCPUs := range s.systemClaimAllocations {
+		cpus = cpus.Union(claimCPUs)
+	}
+	return cpus
+}
+
+// GetResourceClaimAllocations returns a snapshot of all the resource claim allocations.
+func (s *CPUAllocation) GetResourceClaimAllocations() map[types.UID]cpuset.CPUSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.resourceClaimAllocations)
+}
+
+// SetResourceClaimTraceID sets the trace ID of a resource claim allocation.
+// The trace ID is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimTraceID(claimUID types.UID, traceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traceIDs[claimUID] = traceID
+}
+
+// GetResourceClaimTraceID returns the trace ID of a resource claim allocation, or empty if unknown.
+func (s *CPUAllocation) GetResourceClaimTraceID(claimUID types.UID) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.traceIDs[claimUID]
+}
+
+// SetResourceClaimCPUQuotaDisabled sets whether the containers of a resource claim allocation run without CPU quota.
+// The setting is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimCPUQuotaDisabled(claimUID types.UID, disabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if disabled {
+		s.cpuQuotaDisabled.Insert(claimUID)
+		return
+	}
+	s.cpuQuotaDisabled.Delete(claimUID)
+}
+
+// IsResourceClaimCPUQuotaDisabled returns true if the containers of a resource claim allocation run without CPU quota.
+func (s *CPUAllocation) IsResourceClaimCPUQuotaDisabled(claimUID types.UID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cpuQuotaDisabled.Has(claimUID)
+}
+
+// SetResourceClaimNUMABalancingDisabled sets whether the containers of a resource claim allocation have their memory
+// confined to the NUMA nodes of their CPUs. The setting is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimNUMABalancingDisabled(claimUID types.UID, disabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if disabled {
+		s.numaBalancingDisabled.Insert(claimUID)
+		return
+	}
+	s.numaBalancingDisabled.Delete(claimUID)
+}
+
+// IsResourceClaimNUMABalancingDisabled returns true if the containers of a resource claim allocation have their memory
+// confined to the NUMA nodes of their CPUs.
+func (s *CPUAllocation) IsResourceClaimNUMABalancingDisabled(claimUID types.UID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.numaBalancingDisabled.Has(claimUID)
+}
+
+// SetResourceClaimFullCores sets whether a resource claim allocation consumed the full cores capacity.
+// The setting is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimFullCores(claimUID types.UID, fullCores bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fullCores {
+		s.fullCores.Insert(claimUID)
+		return
+	}
+	s.fullCores.Delete(claimUID)
+}
+
+// IsResourceClaimFullCores returns true if a resource claim allocation consumed the full cores capacity.
+func (s *CPUAllocation) IsResourceClaimFullCores(claimUID types.UID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fullCores.Has(claimUID)
+}
+
+// SetResourceClaimBorrowing sets whether the containers of a resource claim allocation also run on the shared CPUs.
+// The setting is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimBorrowing(claimUID types.UID, borrowing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if borrowing {
+		s.borrowing.Insert(claimUID)
+		return
+	}
+	s.borrowing.Delete(claimUID)
+}
+
+// IsResourceClaimBorrowing returns true if the containers of a resource claim allocation also run on the shared CPUs.
+func (s *CPUAllocation) IsResourceClaimBorrowing(claimUID types.UID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.borrowing.Has(claimUID)
+}
+
+// SetResourceClaimPreparedResult records the outcome of the preparation of a resource claim allocation.
+// The result is forgotten when the allocation is removed.
+func (s *CPUAllocation) SetResourceClaimPreparedResult(claimUID types.UID, result PreparedResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preparedResults[claimUID] = result
+}
+
+// GetResourceClaimPreparedResult returns the outcome of the preparation of a resource claim allocation, if any.
+func (s *CPUAllocation) GetResourceClaimPreparedResult(claimUID types.UID) (PreparedResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.preparedResults[claimUID]
+	return result, ok
+}
+
+// AddFractionalClaimAllocation adds the allocation of a resource claim consuming a fraction of the CPUs of a device.
+// It doesn't change the allocated and the shared CPUs.
+func (s *CPUAllocation) AddFractionalClaimAllocation(logger logr.Logger, claimUID types.UID, claim FractionalClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fractionalClaims[claimUID] = claim
+	logger.Info("added fractional allocation for resource claim", "milliCPUs", claim.MilliCPUs, "cpus", claim.CPUs.String())
+}
+
+// GetFractionalClaimAllocation returns the allocation of a resource claim consuming a fraction of the CPUs of a device.
+func (s *CPUAllocation) GetFractionalClaimAllocation(claimUID types.UID) (FractionalClaim, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	claim, ok := s.fractionalClaims[claimUID]
+	return claim, ok
+}
@@ -85,16 +85,89 @@ func TestCPUAllocationResourceClaimAllocation(t *testing.T) {
 	gotCPUs, ok := store.GetResourceClaimAllocation(claimUID)
 	require.True(t, ok)
 	require.True(t, cpus.Equals(gotCPUs))
+	require.Equal(t, map[types.UID]cpuset.CPUSet{claimUID: cpus}, store.GetResourceClaimAllocations())
+	store.SetResourceClaimTraceID(claimUID, "0123abcd")
+	require.Equal(t, "0123abcd", store.GetResourceClaimTraceID(claimUID))
+	require.False(t, store.IsResourceClaimCPUQuotaDisabled(claimUID))
+	store.SetResourceClaimCPUQuotaDisabled(claimUID, true)
+	require.True(t, store.IsResourceClaimCPUQuotaDisabled(claimUID))
+	require.False(t, store.IsResourceClaimNUMABalancingDisabled(claimUID))
+	store.SetResourceClaimNUMABalancingDisabled(claimUID, true)
+	require.True(t, store.IsResourceClaimNUMABalancingDisabled(claimUID))
+	require.False(t, store.IsResourceClaimFullCores(claimUID))
+	store.SetResourceClaimFullCores(claimUID, true)
+	require.True(t, store.IsResourceClaimFullCores(claimUID))
+	require.False(t, store.IsResourceClaimBorrowing(claimUID))
+	store.SetResourceClaimBorrowing(claimUID, true)
+	require.True(t, store.IsResourceClaimBorrowing(claimUID))
+	_, ok = store.GetResourceClaimPreparedResult(claimUID)
+	require.False(t, ok)
+	prepared := PreparedResult{AllocationKey: "key", CDIDeviceIDs: []string{"vendor/class=claim"}}
+	store.SetResourceClaimPreparedResult(claimUID, prepared)
+	gotPrepared, ok := store.GetResourceClaimPreparedResult(claimUID)
+	require.True(t, ok)
+	require.Equal(t, prepared, gotPrepared)
 
 	// Remove allocation
 	store.RemoveResourceClaimAllocation(logger, claimUID)
 	_, ok = store.GetResourceClaimAllocation(claimUID)
 	require.False(t, ok)
+	require.Empty(t, store.GetResourceClaimAllocations())
+	require.Empty(t, store.GetResourceClaimTraceID(claimUID))
+	require.False(t, store.IsResourceClaimCPUQuotaDisabled(claimUID))
+	require.False(t, store.IsResourceClaimNUMABalancingDisabled(claimUID))
+	require.False(t, store.IsResourceClaimFullCores(claimUID))
+	require.False(t, store.IsResourceClaimBorrowing(claimUID))
+	_, ok = store.GetResourceClaimPreparedResult(claimUID)
+	require.False(t, ok)
 
 	// Remove non-existent allocation
 	store.RemoveResourceClaimAllocation(logger, types.UID("non-existent"))
 }
 
+func TestCPUAllocationSystemClaimAllocation(t *testing.T) {
+	logger := testr.New(t)
+	allCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+	reserved := cpuset.New(0, 4)
+	store := newTestCPUAllocation(logger, allCPUs, reserved)
+	claimUID := types.UID("system-claim")
+
+	store.AddSystemClaimAllocation(logger, claimUID, cpuset.New(0))
+	gotCPUs, ok := store.GetResourceClaimAllocation(claimUID)
+	require.True(t, ok)
+	require.True(t, cpuset.New(0).Equals(gotCPUs))
+	require.True(t, cpuset.New(0).Equals(store.GetSystemClaimCPUs()))
+	// the system claims don't count as allocations of the shared CPUs.
+	require.Empty(t, store.GetResourceClaimAllocations())
+	require.True(t, allCPUs.Difference(reserved).Equals(store.GetSharedCPUs()))
+
+	store.RemoveResourceClaimAllocation(logger, claimUID)
+	_, ok = store.GetResourceClaimAllocation(claimUID)
+	require.False(t, ok)
+	require.True(t, store.GetSystemClaimCPUs().IsEmpty())
+}
+
+func TestCPUAllocationFractionalClaimAllocation(t *testing.T) {
+	logger := testr.New(t)
+	allCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
+	store := newTestCPUAllocation(logger, allCPUs, cpuset.New())
+	claimUID := types.UID("fractional-claim")
+
+	store.AddFractionalClaimAllocation(logger, claimUID, FractionalClaim{MilliCPUs: 2500, CPUs: cpuset.New(0, 1, 2, 3)})
+	claim, ok := store.GetFractionalClaimAllocation(claimUID)
+	require.True(t, ok)
+	require.Equal(t, int64(2500), claim.MilliCPUs)
+	require.True(t, cpuset.New(0, 1, 2, 3).Equals(claim.CPUs))
+	// the fractional claims run on the shared CPUs, and allocate none.
+	_, ok = store.GetResourceClaimAllocation(claimUID)
+	require.False(t, ok)
+	require.True(t, allCPUs.Equals(store.GetSharedCPUs()))
+
+	store.RemoveResourceClaimAllocation(logger, claimUID)
+	_, ok = store.GetFractionalClaimAllocation(claimUID)
+	require.False(t, ok)
+}
+
 func TestCPUAllocationGetSharedCPUs(t *testing.T) {
 	logger := testr.New(t)
 	allCPUs := cpuset.New(0, 1, 2, 3, 4, 5, 6, 7)
@@ -0,0 +1,113 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// DeviceIDs tracks the ID of the individual device of each CPU, from which the device name is derived.
+// The IDs are checkpointed, so a CPU keeps its device name across the driver restarts even if the CPUs
+// before it are reserved or go offline: the claims allocated with the name keep getting the same CPU.
+// The IDs are never reused, and the CPUs without one get the IDs after the highest one.
+type DeviceIDs struct {
+	mu   sync.Mutex
+	path string
+	ids  map[int]int
+}
+
+// deviceIDsCheckpoint is the serialized form of the DeviceIDs.
+type deviceIDsCheckpoint struct {
+	// DeviceIDs maps the CPU IDs to their device IDs.
+	DeviceIDs map[int]int `json:"deviceIDs"`
+}
+
+// NewDeviceIDsCheckpoint creates a new DeviceIDs checkpointed at the path, restoring the IDs from there
+// if it exists. Like the pod claims, an unreadable checkpoint is fatal: new IDs could rename the devices
+// of the claims already allocated.
+func NewDeviceIDsCheckpoint(path string) (*DeviceIDs, error) {
+	d := &DeviceIDs{path: path, ids: make(map[int]int)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the device IDs checkpoint: %w", err)
+	}
+	var checkpoint deviceIDsCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("cannot parse the device IDs checkpoint: %w", err)
+	}
+	seen := make(map[int]int, len(checkpoint.DeviceIDs))
+	for cpuID, deviceID := range checkpoint.DeviceIDs {
+		if other, ok := seen[deviceID]; ok {
+			return nil, fmt.Errorf("cannot parse the device IDs checkpoint: CPUs %d and %d have the same device ID %d", min(cpuID, other), max(cpuID, other), deviceID)
+		}
+		seen[deviceID] = cpuID
+		d.ids[cpuID] = deviceID
+	}
+	return d, nil
+}
+
+// Assign returns the device IDs of the CPUs, by CPU ID, keeping the recorded ones. The CPUs without one
+// get new IDs in the given order. The checkpoint is written if any ID was added.
+func (d *DeviceIDs) Assign(cpuIDs []int) (map[int]int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	next := 0
+	for _, deviceID := range d.ids {
+		next = max(next, deviceID+1)
+	}
+	added := false
+	assigned := make(map[int]int, len(cpuIDs))
+	for _, cpuID := range cpuIDs {
+		deviceID, ok := d.ids[cpuID]
+		if !ok {
+			deviceID = next
+			next++
+			d.ids[cpuID] = deviceID
+			added = true
+		}
+		assigned[cpuID] = deviceID
+	}
+	if added {
+		if err := d.persist(); err != nil {
+			return nil, err
+		}
+	}
+	return assigned, nil
+}
+
+// persist writes the checkpoint atomically.
+func (d *DeviceIDs) persist() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(deviceIDsCheckpoint{DeviceIDs: d.ids})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(d.path, data); err != nil {
+		return fmt.Errorf("failed to persist the device IDs checkpoint: %w", err)
+	}
+	return nil
+}
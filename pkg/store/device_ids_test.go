@@ -0,0 +1,59 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceIDsCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device-ids.json")
+	d, err := NewDeviceIDsCheckpoint(path)
+	require.NoError(t, err)
+	ids, err := d.Assign([]int{0, 4, 1, 5})
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{0: 0, 4: 1, 1: 2, 5: 3}, ids)
+
+	// CPU 4 is reserved and CPU 6 is new after the restart: the others keep their IDs.
+	restored, err := NewDeviceIDsCheckpoint(path)
+	require.NoError(t, err)
+	ids, err = restored.Assign([]int{0, 1, 5, 6})
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{0: 0, 1: 2, 5: 3, 6: 4}, ids)
+
+	// CPU 4 is back: its ID was not reused.
+	restored, err = NewDeviceIDsCheckpoint(path)
+	require.NoError(t, err)
+	ids, err = restored.Assign([]int{4, 6})
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{4: 1, 6: 4}, ids)
+}
+
+func TestDeviceIDsCheckpointCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device-ids.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	_, err := NewDeviceIDsCheckpoint(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"deviceIDs":{"0":0,"1":0}}`), 0600))
+	_, err = NewDeviceIDsCheckpoint(path)
+	require.ErrorContains(t, err, "same device ID 0")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"maps"
+
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"k8s.io/utils/cpuset"
+)
+
+// FreeCPUList are the free CPUs of an uncore (L3) cache, by the state of their core.
+type FreeCPUList struct {
+	// FullCores are the CPUs of the cores whose CPUs are all free.
+	FullCores cpuset.CPUSet
+	// Singles are the free CPUs of the cores partially allocated or reserved.
+	Singles cpuset.CPUSet
+}
+
+// Size returns the number of free CPUs of the uncore cache.
+func (l FreeCPUList) Size() int {
+	return l.FullCores.Size() + l.Singles.Size()
+}
+
+// freeLists index the free CPUs by uncore cache and core state. They are updated with
+// each allocation change, for the affected cores only, so reading them is cheap.
+type freeLists struct {
+	// coreCPUs maps each CPU to the CPUs of its core.
+	coreCPUs map[int]cpuset.CPUSet
+	// uncoreCacheOf maps each CPU to its uncore cache.
+	uncoreCacheOf map[int]int
+	lists         map[int]FreeCPUList
+}
+
+func newFreeLists(topo *cpuinfo.CPUTopology, freeCPUs cpuset.CPUSet) *freeLists {
+	fl := &freeLists{
+		coreCPUs:      make(map[int]cpuset.CPUSet, len(topo.CPUDetails)),
+		uncoreCacheOf: make(map[int]int, len(topo.CPUDetails)),
+		lists:         make(map[int]FreeCPUList),
+	}
+	// core IDs are unique within a socket only.
+	type coreKey struct{ socketID, coreID int }
+	cores := make(map[coreKey][]int)
+	for cpuID, info := range topo.CPUDetails {
+		key := coreKey{info.SocketID, info.CoreID}
+		cores[key] = append(cores[key], cpuID)
+		fl.uncoreCacheOf[cpuID] = info.UncoreCacheID
+	}
+	for _, cpuIDs := range cores {
+		coreCPUs := cpuset.New(cpuIDs...)
+		for _, cpuID := range cpuIDs {
+			fl.coreCPUs[cpuID] = coreCPUs
+		}
+	}
+	fl.update(topo.CPUDetails.CPUs(), freeCPUs)
+	return fl
+}
+
+// update reclassifies the cores of the changed CPUs against the free CPUs.
+func (fl *freeLists) update(changed, freeCPUs cpuset.CPUSet) {
+	done := cpuset.New()
+	for _, cpuID := range changed.UnsortedList() {
+		coreCPUs, ok := fl.coreCPUs[cpuID]
+		if !ok || done.Contains(cpuID) {
+			continue
+		}
+		done = done.Union(coreCPUs)
+		uncoreCacheID := fl.uncoreCacheOf[cpuID]
+		list := fl.lists[uncoreCacheID]
+		list.FullCores = list.FullCores.Difference(coreCPUs)
+		list.Singles = list.Singles.Difference(coreCPUs)
+		free := coreCPUs.Intersection(freeCPUs)
+		if free.Equals(coreCPUs) {
+			list.FullCores = list.FullCores.Union(free)
+		} else {
+			list.Singles = list.Singles.Union(free)
+		}
+		if list.Size() == 0 {
+			delete(fl.lists, uncoreCacheID)
+			continue
+		}
+		fl.lists[uncoreCacheID] = list
+	}
+}
+
+// GetFreeCPULists returns the free CPUs of each uncore cache having any, by the state of their core.
+func (s *CPUAllocation) GetFreeCPULists() map[int]FreeCPUList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.freeLists.lists)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/kubernetes-sigs/dra-driver-cpu/pkg/cpuinfo"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/cpuset"
+)
+
+func TestFreeCPULists(t *testing.T) {
+	logger := testr.New(t)
+	// 2 sockets with 2 cores each, HT on, one uncore cache per socket. The core IDs repeat across sockets.
+	infos := []cpuinfo.CPUInfo{
+		{CpuID: 0, CoreID: 0, SocketID: 0, UncoreCacheID: 0, SiblingCPUID: 4},
+		{CpuID: 1, CoreID: 1, SocketID: 0, UncoreCacheID: 0, SiblingCPUID: 5},
+		{CpuID: 2, CoreID: 0, SocketID: 1, UncoreCacheID: 1, SiblingCPUID: 6},
+		{CpuID: 3, CoreID: 1, SocketID: 1, UncoreCacheID: 1, SiblingCPUID: 7},
+		{CpuID: 4, CoreID: 0, SocketID: 0, UncoreCacheID: 0, SiblingCPUID: 0},
+		{CpuID: 5, CoreID: 1, SocketID: 0, UncoreCacheID: 0, SiblingCPUID: 1},
+		{CpuID: 6, CoreID: 0, SocketID: 1, UncoreCacheID: 1, SiblingCPUID: 2},
+		{CpuID: 7, CoreID: 1, SocketID: 1, UncoreCacheID: 1, SiblingCPUID: 3},
+	}
+	mockProvider := &cpuinfo.MockCPUInfoProvider{CPUInfos: infos}
+	topo, err := mockProvider.GetCPUTopology(logger)
+	require.NoError(t, err)
+
+	// the reserved CPU 3 leaves its sibling single.
+	store := NewCPUAllocation(topo, cpuset.New(3))
+	requireFreeLists(t, map[int]FreeCPUList{
+		0: {FullCores: cpuset.New(0, 1, 4, 5), Singles: cpuset.New()},
+		1: {FullCores: cpuset.New(2, 6), Singles: cpuset.New(7)},
+	}, store.GetFreeCPULists())
+
+	store.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(0))
+	store.AddResourceClaimAllocation(logger, "claim-2", cpuset.New(2, 6, 7))
+	requireFreeLists(t, map[int]FreeCPUList{
+		0: {FullCores: cpuset.New(1, 5), Singles: cpuset.New(4)},
+	}, store.GetFreeCPULists())
+
+	// a repeated allocation releases the CPUs it doesn't have anymore.
+	store.AddResourceClaimAllocation(logger, "claim-1", cpuset.New(1))
+	requireFreeLists(t, map[int]FreeCPUList{
+		0: {FullCores: cpuset.New(0, 4), Singles: cpuset.New(5)},
+	}, store.GetFreeCPULists())
+
+	store.RemoveResourceClaimAllocation(logger, "claim-1")
+	store.RemoveResourceClaimAllocation(logger, "claim-2")
+	requireFreeLists(t, map[int]FreeCPUList{
+		0: {FullCores: cpuset.New(0, 1, 4, 5), Singles: cpuset.New()},
+		1: {FullCores: cpuset.New(2, 6), Singles: cpuset.New(7)},
+	}, store.GetFreeCPULists())
+}
+
+func requireFreeLists(t *testing.T, expected, got map[int]FreeCPUList) {
+	t.Helper()
+	require.Len(t, got, len(expected))
+	for uncoreCacheID, list := range expected {
+		require.True(t, list.FullCores.Equals(got[uncoreCacheID].FullCores), "uncore cache %d full cores: got %s", uncoreCacheID, got[uncoreCacheID].FullCores)
+		require.True(t, list.Singles.Equals(got[uncoreCacheID].Singles), "uncore cache %d singles: got %s", uncoreCacheID, got[uncoreCacheID].Singles)
+	}
+}
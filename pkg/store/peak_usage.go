@@ -0,0 +1,195 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// PeakUsageDays is how many days of daily peaks are kept.
+	PeakUsageDays = 14
+	// PeakUsageWeeks is how many weeks of weekly peaks are kept.
+	PeakUsageWeeks = 8
+)
+
+// PeakUsageHistory is the peak number of exclusive CPUs allocated on each NUMA node,
+// by day (e.g. "2025-01-31") and by ISO week (e.g. "2025-W05").
+type PeakUsageHistory struct {
+	Daily  map[string]map[int]int `json:"daily"`
+	Weekly map[string]map[int]int `json:"weekly"`
+}
+
+// PeakUsage tracks the historical peak exclusive CPU usage of the NUMA nodes.
+// If a path is set, the history is persisted there, so it survives the driver restarts.
+type PeakUsage struct {
+	mu      sync.Mutex
+	path    string
+	now     func() time.Time
+	history PeakUsageHistory
+	// dirty is set while the history has changes not persisted yet.
+	dirty bool
+}
+
+// NewPeakUsage creates a PeakUsage, loading the history from the path, if any.
+// A missing or unreadable history is not fatal: the tracking starts from scratch.
+func NewPeakUsage(logger logr.Logger, path string) *PeakUsage {
+	pu := &PeakUsage{
+		path: path,
+		now:  time.Now,
+		history: PeakUsageHistory{
+			Daily:  make(map[string]map[int]int),
+			Weekly: make(map[string]map[int]int),
+		},
+	}
+	if path == "" {
+		return pu
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Error(err, "cannot read the peak usage history, starting from scratch", "path", path)
+		}
+		return pu
+	}
+	var history PeakUsageHistory
+	if err := json.Unmarshal(data, &history); err != nil {
+		logger.Error(err, "cannot parse the peak usage history, starting from scratch", "path", path)
+		return pu
+	}
+	if history.Daily != nil {
+		pu.history.Daily = history.Daily
+	}
+	if history.Weekly != nil {
+		pu.history.Weekly = history.Weekly
+	}
+	return pu
+}
+
+// Observe records the current number of exclusive CPUs allocated on each NUMA node.
+// It only updates the history in memory: Persist writes it.
+func (pu *PeakUsage) Observe(usage map[int]int) {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+
+	now := pu.now()
+	year, week := now.ISOWeek()
+	changed := updatePeaks(pu.history.Daily, now.Format(time.DateOnly), usage, PeakUsageDays)
+	changed = updatePeaks(pu.history.Weekly, fmt.Sprintf("%d-W%02d", year, week), usage, PeakUsageWeeks) || changed
+	pu.dirty = pu.dirty || changed
+}
+
+// Persist writes the history if it changed since the last write. A failed write is retried on the next call.
+func (pu *PeakUsage) Persist() error {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+
+	if !pu.dirty || pu.path == "" {
+		return nil
+	}
+	if err := pu.persist(); err != nil {
+		return err
+	}
+	pu.dirty = false
+	return nil
+}
+
+// Current returns the peaks of the current day and week.
+func (pu *PeakUsage) Current() (daily, weekly map[int]int) {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+	now := pu.now()
+	year, week := now.ISOWeek()
+	return maps.Clone(pu.history.Daily[now.Format(time.DateOnly)]), maps.Clone(pu.history.Weekly[fmt.Sprintf("%d-W%02d", year, week)])
+}
+
+// History returns a copy of the recorded history.
+func (pu *PeakUsage) History() PeakUsageHistory {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+	history := PeakUsageHistory{
+		Daily:  make(map[string]map[int]int, len(pu.history.Daily)),
+		Weekly: make(map[string]map[int]int, len(pu.history.Weekly)),
+	}
+	for period, peaks := range pu.history.Daily {
+		history.Daily[period] = maps.Clone(peaks)
+	}
+	for period, peaks := range pu.history.Weekly {
+		history.Weekly[period] = maps.Clone(peaks)
+	}
+	return history
+}
+
+// persist writes the history atomically, so a crash never leaves a truncated file behind.
+func (pu *PeakUsage) persist() error {
+	data, err := json.Marshal(pu.history)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(pu.path), filepath.Base(pu.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to persist the peak usage history: %w", err)
+	}
+	// after a successful rename there is nothing left to remove.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist the peak usage history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist the peak usage history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), pu.path); err != nil {
+		return fmt.Errorf("failed to persist the peak usage history: %w", err)
+	}
+	return nil
+}
+
+// updatePeaks raises the peaks of the period, keeping only the latest periods. The period
+// keys sort chronologically, so the oldest periods are the first ones in order.
+func updatePeaks(history map[string]map[int]int, period string, usage map[int]int, keep int) bool {
+	changed := false
+	peaks, ok := history[period]
+	if !ok {
+		peaks = make(map[int]int)
+		history[period] = peaks
+		changed = true
+	}
+	for numaNodeID, cpus := range usage {
+		if cur, ok := peaks[numaNodeID]; !ok || cpus > cur {
+			peaks[numaNodeID] = cpus
+			changed = true
+		}
+	}
+	periods := slices.Sorted(maps.Keys(history))
+	for len(periods) > keep {
+		delete(history, periods[0])
+		periods = periods[1:]
+	}
+	return changed
+}
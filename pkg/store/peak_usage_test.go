@@ -0,0 +1,94 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeakUsageObserve(t *testing.T) {
+	logger := testr.New(t)
+	path := filepath.Join(t.TempDir(), "peak-usage.json")
+	now := time.Date(2025, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+	pu := NewPeakUsage(logger, path)
+	pu.now = func() time.Time { return now }
+
+	pu.Observe(map[int]int{0: 4, 1: 2})
+	pu.Observe(map[int]int{0: 2, 1: 6})
+	daily, weekly := pu.Current()
+	require.Equal(t, map[int]int{0: 4, 1: 6}, daily)
+	require.Equal(t, map[int]int{0: 4, 1: 6}, weekly)
+
+	// a new day in the same ISO week starts a new daily peak, and keeps the weekly one.
+	now = now.Add(24 * time.Hour)
+	pu.Observe(map[int]int{0: 1, 1: 0})
+	daily, weekly = pu.Current()
+	require.Equal(t, map[int]int{0: 1, 1: 0}, daily)
+	require.Equal(t, map[int]int{0: 4, 1: 6}, weekly)
+
+	history := pu.History()
+	require.Equal(t, map[string]map[int]int{
+		"2025-01-31": {0: 4, 1: 6},
+		"2025-02-01": {0: 1, 1: 0},
+	}, history.Daily)
+	require.Equal(t, map[string]map[int]int{
+		"2025-W05": {0: 4, 1: 6},
+	}, history.Weekly)
+
+	// the history survives a restart once persisted.
+	require.Empty(t, NewPeakUsage(logger, path).History().Daily)
+	require.NoError(t, pu.Persist())
+	restored := NewPeakUsage(logger, path)
+	require.Equal(t, history, restored.History())
+}
+
+func TestPeakUsageRetention(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+	pu := NewPeakUsage(testr.New(t), "")
+	pu.now = func() time.Time { return now }
+
+	for i := 0; i < 10*7; i++ {
+		pu.Observe(map[int]int{0: i})
+		now = now.Add(24 * time.Hour)
+	}
+	history := pu.History()
+	require.Len(t, history.Daily, PeakUsageDays)
+	require.Len(t, history.Weekly, PeakUsageWeeks)
+	require.Contains(t, history.Daily, "2025-03-11")
+	require.NotContains(t, history.Daily, "2025-02-25")
+}
+
+func TestPeakUsageInvalidHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peak-usage.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+
+	pu := NewPeakUsage(testr.New(t), path)
+	require.Empty(t, pu.History().Daily)
+	require.Empty(t, pu.History().Weekly)
+
+	// the invalid history is replaced.
+	pu.Observe(map[int]int{0: 2})
+	require.NoError(t, pu.Persist())
+	require.Len(t, NewPeakUsage(testr.New(t), path).History().Daily, 1)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/cpuset"
+)
+
+// PodClaims tracks which resource claims are reserved for which containers of which pods.
+// When CDI is disabled the claim allocation can't be read back from the
+// container environment, so the NRI hooks use this mapping instead.
+// If a path is set, the mapping is checkpointed there on every change, so it survives
+// the driver restarts: the kubelet doesn't prepare again the claims it already prepared.
+type PodClaims struct {
+	mu     sync.RWMutex
+	path   string
+	claims map[types.UID]podClaim
+}
+
+// podClaim is the allocation of a claim and the containers consuming it, by pod UID.
+type podClaim struct {
+	cpus cpuset.CPUSet
+	pods map[types.UID]sets.Set[string]
+}
+
+// podClaimCheckpoint is the serialized form of a podClaim.
+type podClaimCheckpoint struct {
+	CPUs string                 `json:"cpus"`
+	Pods map[types.UID][]string `json:"pods"`
+}
+
+// NewPodClaims creates a new PodClaims, kept in memory only.
+func NewPodClaims() *PodClaims {
+	return &PodClaims{
+		claims: make(map[types.UID]podClaim),
+	}
+}
+
+// NewPodClaimsCheckpoint creates a new PodClaims checkpointed at the path, restoring the
+// mapping from there if it exists. An unreadable checkpoint is fatal: starting from
+// scratch would hand out again the CPUs of the claims already prepared.
+func NewPodClaimsCheckpoint(path string) (*PodClaims, error) {
+	pc := NewPodClaims()
+	pc.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the pod claims checkpoint: %w", err)
+	}
+	var checkpoint map[types.UID]podClaimCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("cannot parse the pod claims checkpoint: %w", err)
+	}
+	for claimUID, entry := range checkpoint {
+		cpus, err := cpuset.Parse(entry.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse the CPUs of claim %s in the pod claims checkpoint: %w", claimUID, err)
+		}
+		claim := podClaim{cpus: cpus, pods: make(map[types.UID]sets.Set[string], len(entry.Pods))}
+		for podUID, containers := range entry.Pods {
+			claim.pods[podUID] = sets.New(containers...)
+		}
+		pc.claims[claimUID] = claim
+	}
+	return pc, nil
+}
+
+// Set records the allocation of the claim and the containers consuming it, by pod UID,
+// replacing what was recorded before for the claim.
+func (pc *PodClaims) Set(claimUID types.UID, cpus cpuset.CPUSet, containersByPodUID map[types.UID][]string) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	claim := podClaim{cpus: cpus, pods: make(map[types.UID]sets.Set[string], len(containersByPodUID))}
+	for podUID, containers := range containersByPodUID {
+		claim.pods[podUID] = sets.New(containers...)
+	}
+	pc.claims[claimUID] = claim
+	return pc.persist()
+}
+
+// Get returns the claims consumed by the container of the pod, in stable order.
+func (pc *PodClaims) Get(podUID types.UID, containerName string) []types.UID {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	var claimUIDs []types.UID
+	for claimUID, claim := range pc.claims {
+		if claim.pods[podUID].Has(containerName) {
+			claimUIDs = append(claimUIDs, claimUID)
+		}
+	}
+	slices.Sort(claimUIDs)
+	return claimUIDs
+}
+
+// Allocations returns the CPUs of all the recorded claims.
+func (pc *PodClaims) Allocations() map[types.UID]cpuset.CPUSet {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	allocations := make(map[types.UID]cpuset.CPUSet, len(pc.claims))
+	for claimUID, claim := range pc.claims {
+		allocations[claimUID] = claim.cpus
+	}
+	return allocations
+}
+
+// Has returns true if the claim is recorded.
+func (pc *PodClaims) Has(claimUID types.UID) bool {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	_, ok := pc.claims[claimUID]
+	return ok
+}
+
+// RemoveClaim forgets the claim for all the pods it was reserved for.
+func (pc *PodClaims) RemoveClaim(claimUID types.UID) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if _, ok := pc.claims[claimUID]; !ok {
+		return nil
+	}
+	delete(pc.claims, claimUID)
+	return pc.persist()
+}
+
+// Len returns the number of the recorded claims.
+func (pc *PodClaims) Len() int {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return len(pc.claims)
+}
+
+// persist writes the checkpoint atomically.
+func (pc *PodClaims) persist() error {
+	if pc.path == "" {
+		return nil
+	}
+	checkpoint := make(map[types.UID]podClaimCheckpoint, len(pc.claims))
+	for claimUID, claim := range pc.claims {
+		entry := podClaimCheckpoint{CPUs: claim.cpus.String(), Pods: make(map[types.UID][]string, len(claim.pods))}
+		for podUID, containers := range claim.pods {
+			entry.Pods[podUID] = sets.List(containers)
+		}
+		checkpoint[claimUID] = entry
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(pc.path, data); err != nil {
+		return fmt.Errorf("failed to persist the pod claims checkpoint: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomically writes the file through a temporary file renamed over it, so a crash never leaves
+// a truncated file behind.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// after a successful rename there is nothing left to remove.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
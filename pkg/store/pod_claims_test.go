@@ -0,0 +1,74 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+)
+
+func TestPodClaims(t *testing.T) {
+	pc := NewPodClaims()
+	require.Empty(t, pc.Get("pod-AAA", "ctr-1"))
+
+	require.NoError(t, pc.Set("claim-2", cpuset.New(2, 3), map[types.UID][]string{"pod-AAA": {"ctr-1"}}))
+	require.NoError(t, pc.Set("claim-1", cpuset.New(4), map[types.UID][]string{"pod-AAA": {"ctr-1", "ctr-2"}}))
+	require.NoError(t, pc.Set("claim-3", cpuset.New(5), map[types.UID][]string{"pod-BBB": {"ctr-1"}}))
+	require.Equal(t, []types.UID{"claim-1", "claim-2"}, pc.Get("pod-AAA", "ctr-1"))
+	require.Equal(t, []types.UID{"claim-1"}, pc.Get("pod-AAA", "ctr-2"))
+	require.Empty(t, pc.Get("pod-AAA", "ctr-3"))
+	require.Equal(t, []types.UID{"claim-3"}, pc.Get("pod-BBB", "ctr-1"))
+	require.Equal(t, 3, pc.Len())
+	require.True(t, pc.Has("claim-1"))
+	require.False(t, pc.Has("claim-404"))
+
+	require.NoError(t, pc.RemoveClaim("claim-1"))
+	require.False(t, pc.Has("claim-1"))
+	require.Equal(t, []types.UID{"claim-2"}, pc.Get("pod-AAA", "ctr-1"))
+	require.Empty(t, pc.Get("pod-AAA", "ctr-2"))
+
+	require.NoError(t, pc.RemoveClaim("claim-3"))
+	require.Empty(t, pc.Get("pod-BBB", "ctr-1"))
+	require.Equal(t, 1, pc.Len())
+
+	// removing an unknown claim is a no-op
+	require.NoError(t, pc.RemoveClaim("claim-404"))
+	require.Equal(t, 1, pc.Len())
+}
+
+func TestPodClaimsCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pod-claims.json")
+	pc, err := NewPodClaimsCheckpoint(path)
+	require.NoError(t, err)
+	require.NoError(t, pc.Set("claim-1", cpuset.New(2, 3), map[types.UID][]string{"pod-AAA": {"ctr-1"}}))
+	require.NoError(t, pc.Set("claim-2", cpuset.New(4, 5), map[types.UID][]string{"pod-BBB": {"ctr-2"}}))
+	require.NoError(t, pc.RemoveClaim("claim-2"))
+
+	restored, err := NewPodClaimsCheckpoint(path)
+	require.NoError(t, err)
+	require.Equal(t, []types.UID{"claim-1"}, restored.Get("pod-AAA", "ctr-1"))
+	require.Equal(t, map[types.UID]cpuset.CPUSet{"claim-1": cpuset.New(2, 3)}, restored.Allocations())
+
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	_, err = NewPodClaimsCheckpoint(path)
+	require.Error(t, err)
+}
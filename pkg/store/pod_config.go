@@ -30,6 +30,16 @@ type ContainerState struct {
 	containerUID types.UID
 	// resourceClaimUIDs is a list of resource claims associated with this container.
 	resourceClaimUIDs []types.UID
+	// cgroupsPath is the container cgroup path as reported by the runtime, if known.
+	cgroupsPath string
+}
+
+// ContainerInfo describes a container consuming a resource claim.
+type ContainerInfo struct {
+	PodUID        types.UID
+	ContainerName string
+	ContainerUID  types.UID
+	CgroupsPath   string
 }
 
 // NewContainerState creates a new ContainerState.
@@ -41,6 +51,12 @@ func NewContainerState(containerName string, containerUID types.UID, claimUIDs .
 	}
 }
 
+// SetCgroupsPath records the container cgroup path as reported by the runtime.
+func (cs *ContainerState) SetCgroupsPath(cgroupsPath string) *ContainerState {
+	cs.cgroupsPath = cgroupsPath
+	return cs
+}
+
 // PodCPUAssignments maps a container name to its state.
 type PodCPUAssignments map[string]*ContainerState
 
@@ -130,12 +146,37 @@ func (s *PodConfig) GetContainersWithSharedCPUs() []types.UID {
 	return s.sharedCPUContainers.UnsortedList()
 }
 
+// GetContainersByClaim returns the containers consuming each resource claim.
+func (s *PodConfig) GetContainersByClaim() map[types.UID][]ContainerInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	containersByClaim := make(map[types.UID][]ContainerInfo)
+	for podUID, podAssignments := range s.configs {
+		for _, cs := range podAssignments {
+			for _, claimUID := range cs.resourceClaimUIDs {
+				containersByClaim[claimUID] = append(containersByClaim[claimUID], ContainerInfo{
+					PodUID:        podUID,
+					ContainerName: cs.containerName,
+					ContainerUID:  cs.containerUID,
+					CgroupsPath:   cs.cgroupsPath,
+				})
+			}
+		}
+	}
+	return containersByClaim
+}
+
 func (s *PodConfig) Len() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.configs)
 }
 
+// ResourceClaimUIDs returns the resource claims associated with the container.
+func (cs *ContainerState) ResourceClaimUIDs() []types.UID {
+	return cs.resourceClaimUIDs
+}
+
 // HasExclusiveCPUAllocation returns true if the container has associated resource claims.
 func (cs *ContainerState) HasExclusiveCPUAllocation() bool {
 	return len(cs.resourceClaimUIDs) > 0
@@ -219,3 +219,20 @@ func BenchmarkGetContainersWithSharedCPUs(b *testing.B) {
 		})
 	}
 }
+
+func TestGetContainersByClaim(t *testing.T) {
+	store := NewPodConfig()
+	store.SetContainerState("pod-uid-1", NewContainerState("ctr-name-1", "ctr-uid-1", "claim-uid-1", "claim-uid-2").SetCgroupsPath("/kubepods/pod-uid-1/ctr-uid-1"))
+	store.SetContainerState("pod-uid-1", NewContainerState("ctr-name-2", "ctr-uid-2"))
+	store.SetContainerState("pod-uid-2", NewContainerState("ctr-name-3", "ctr-uid-3", "claim-uid-2"))
+
+	got := store.GetContainersByClaim()
+	require.Len(t, got, 2)
+	require.Equal(t, []ContainerInfo{
+		{PodUID: "pod-uid-1", ContainerName: "ctr-name-1", ContainerUID: "ctr-uid-1", CgroupsPath: "/kubepods/pod-uid-1/ctr-uid-1"},
+	}, got["claim-uid-1"])
+	require.ElementsMatch(t, []ContainerInfo{
+		{PodUID: "pod-uid-1", ContainerName: "ctr-name-1", ContainerUID: "ctr-uid-1", CgroupsPath: "/kubepods/pod-uid-1/ctr-uid-1"},
+		{PodUID: "pod-uid-2", ContainerName: "ctr-name-3", ContainerUID: "ctr-uid-3"},
+	}, got["claim-uid-2"])
+}
@@ -115,7 +115,7 @@ var _ = ginkgo.Describe("dra-driver-cpu HTTP health endpoints", ginkgo.Ordered,
 
 		// Test 2: verify the probe wiring in the YAML, not just the handler.
 		// A container only becomes Ready after k8s itself has successfully
-		// called the readiness probe (also /healthz:8080). So Ready=true means
+		// called the readiness probe (/readyz:8080, which also requires the NRI plugin to be connected). So Ready=true means
 		// the path, port, and delay values in the container spec are all correct.
 		ginkgo.It("should mark every driver container as Ready (readiness probe passes)", func(ctx context.Context) {
 			pods := waitForRunningDriverPods(ctx, fxt.K8SClientset)